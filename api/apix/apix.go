@@ -0,0 +1,111 @@
+// Package apix has the experimental fields of the API's requests. They may change or be removed in any release,
+// so they are kept out of the api package, whose types only change in ways which don't break programs using
+// them. A request here embeds the stable request of the same endpoint, the fields of both are sent together
+// the same as any other request.
+//
+// Fields move from apix to api once they are stable. A program which only uses the api package doesn't
+// notice, one which uses apix has to move to the api field.
+package apix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+type GenerateRequest struct {
+	api.GenerateRequest
+
+	// Think separates the model's reasoning, between <think> tags, into the Thinking of responses
+	Think bool `json:"think,omitempty"`
+
+	// Continue extends the response Context ends with instead of answering a new prompt
+	Continue bool `json:"continue,omitempty"`
+
+	// Schema constrains the response to JSON matching the JSON schema, in place of Format
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	// Debug adds the options used to the final response
+	Debug bool `json:"debug,omitempty"`
+
+	// ReturnPrompt adds the prompt sent to the model, after the template is applied, to the final response
+	ReturnPrompt bool `json:"return_prompt,omitempty"`
+}
+
+// NewGenerateRequest returns an experimental request with the fields of req
+func NewGenerateRequest(req api.GenerateRequest) *GenerateRequest {
+	return &GenerateRequest{GenerateRequest: req}
+}
+
+// Stable returns the request without its experimental fields
+func (r *GenerateRequest) Stable() api.GenerateRequest {
+	return r.GenerateRequest
+}
+
+type ChatRequest struct {
+	api.ChatRequest
+
+	// Think separates the model's reasoning, between <think> tags, into the Thinking of messages
+	Think bool `json:"think,omitempty"`
+
+	// Conversation is the ID of a stored conversation. Its history is sent ahead of Messages
+	// and the messages and reply are added to it.
+	Conversation string `json:"conversation,omitempty"`
+
+	// Preset is the name of a stored preset providing the model, system message and options
+	Preset string `json:"preset,omitempty"`
+
+	// Logprobs adds the log probabilities of the tokens of the reply to the responses, with the TopLogprobs
+	// most likely tokens in place of each, at most 20
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs int  `json:"top_logprobs,omitempty"`
+
+	// Continue appends the reply to the last message, which must be from the assistant, instead of
+	// starting a new turn, e.g. to finish a response cut short by num_predict
+	Continue bool `json:"continue,omitempty"`
+
+	// Schema constrains the response to JSON matching the JSON schema, in place of Format
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	// Debug adds the options used to the final response
+	Debug bool `json:"debug,omitempty"`
+
+	// ReturnPrompt adds the prompt sent to the model, after the template is applied, to the final response
+	ReturnPrompt bool `json:"return_prompt,omitempty"`
+}
+
+// NewChatRequest returns an experimental request with the fields of req
+func NewChatRequest(req api.ChatRequest) *ChatRequest {
+	return &ChatRequest{ChatRequest: req}
+}
+
+// Stable returns the request without its experimental fields
+func (r *ChatRequest) Stable() api.ChatRequest {
+	return r.ChatRequest
+}
+
+// Generate is api.Client.Generate for an experimental request
+func Generate(ctx context.Context, c *api.Client, req *GenerateRequest, fn api.GenerateResponseFunc) error {
+	return c.Stream(ctx, http.MethodPost, "/api/generate", req, func(bts []byte) error {
+		var resp api.GenerateResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
+// Chat is api.Client.Chat for an experimental request
+func Chat(ctx context.Context, c *api.Client, req *ChatRequest, fn api.ChatResponseFunc) error {
+	return c.Stream(ctx, http.MethodPost, "/api/chat", req, func(bts []byte) error {
+		var resp api.ChatResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
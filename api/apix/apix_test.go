@@ -0,0 +1,38 @@
+package apix
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestRequestJSON(t *testing.T) {
+	req := NewChatRequest(api.ChatRequest{Model: "llama2", Messages: []api.Message{{Role: "user", Content: "hi"}}})
+	req.Think = true
+	req.Conversation = "abc"
+
+	bts, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	// the experimental fields are sent alongside the stable ones
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(bts, &fields))
+	assert.Equal(t, "llama2", fields["model"])
+	assert.Equal(t, true, fields["think"])
+	assert.Equal(t, "abc", fields["conversation"])
+
+	// and a stable request ignores them
+	var stable api.ChatRequest
+	require.NoError(t, json.Unmarshal(bts, &stable))
+	assert.Equal(t, req.Stable(), stable)
+
+	var generate GenerateRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"model": "llama2", "prompt": "hi", "continue": true, "return_prompt": true}`), &generate))
+	assert.Equal(t, api.GenerateRequest{Model: "llama2", Prompt: "hi"}, generate.Stable())
+	assert.True(t, generate.Continue)
+	assert.True(t, generate.ReturnPrompt)
+}
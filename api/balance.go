@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// hostRetryAfter is how long a host which couldn't be reached is passed over
+const hostRetryAfter = 10 * time.Second
+
+// clientHost is one of the servers in OLLAMA_HOST
+type clientHost struct {
+	base *url.URL
+	http http.Client
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func newClientHost(host Host) (*clientHost, error) {
+	if host.Network() == "unix" {
+		return &clientHost{
+			base: &url.URL{Scheme: "http", Host: "localhost"},
+			http: http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						var d net.Dialer
+						return d.DialContext(ctx, "unix", host.Path)
+					},
+				},
+			},
+		}, nil
+	}
+
+	h := clientHost{
+		base: &url.URL{
+			Scheme: host.Scheme,
+			Host:   host.Address(),
+			Path:   host.Prefix,
+		},
+	}
+
+	mockRequest, err := http.NewRequest(http.MethodHead, h.base.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyURL, err := http.ProxyFromEnvironment(mockRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	h.http = http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+		},
+	}
+
+	return &h, nil
+}
+
+func (h *clientHost) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Now().After(h.downUntil)
+}
+
+func (h *clientHost) setHealthy(healthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.downUntil = time.Time{}
+	if !healthy {
+		h.downUntil = time.Now().Add(hostRetryAfter)
+	}
+}
+
+// balancedPaths are spread across the hosts by model, so each model is loaded on one server. Every other
+// request, such as pulling or listing models, goes to the first host which is up.
+var balancedPaths = map[string]bool{
+	"/api/generate":   true,
+	"/api/chat":       true,
+	"/api/infill":     true,
+	"/api/classify":   true,
+	"/api/embeddings": true,
+	"/api/load":       true,
+}
+
+// requestModel is the model a request body names
+func requestModel(data []byte) string {
+	var req struct {
+		Model string `json:"model"`
+		Name  string `json:"name"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		return ""
+	}
+
+	if req.Model != "" {
+		return req.Model
+	}
+
+	return req.Name
+}
+
+// weight ranks the hosts for a model, the host with the highest weight serves it. Unlike round robin every
+// client picks the same host, and when a host goes down only its models move.
+func (h *clientHost) weight(model string) uint64 {
+	sum := sha256.Sum256([]byte(h.base.String() + "\x00" + model))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// route returns the hosts to try a request on in order, hosts which are up come first
+func (c *Client) route(path string, data []byte) []*clientHost {
+	hosts := make([]*clientHost, len(c.hosts))
+	copy(hosts, c.hosts)
+
+	if model := requestModel(data); model != "" && balancedPaths[path] && len(hosts) > 1 {
+		sort.SliceStable(hosts, func(i, j int) bool {
+			return hosts[i].weight(model) > hosts[j].weight(model)
+		})
+	}
+
+	var up, down []*clientHost
+	for _, h := range hosts {
+		if h.healthy() {
+			up = append(up, h)
+		} else {
+			down = append(down, h)
+		}
+	}
+
+	return append(up, down...)
+}
+
+// send sends a request to the first host which can be reached. A host which can't be reached is passed over
+// for a while, and the request is sent to the next host if retry is set and nothing was sent.
+func (c *Client) send(ctx context.Context, path string, data []byte, retry bool, newRequest func(*url.URL) (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for _, h := range c.route(path, data) {
+		request, err := newRequest(h.base.JoinPath(path))
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := h.http.Do(request)
+		if err == nil {
+			h.setHealthy(true)
+			return response, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		h.setHealthy(false)
+		lastErr = err
+
+		var opErr *net.OpError
+		if !retry || !errors.As(err, &opErr) || opErr.Op != "dial" {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
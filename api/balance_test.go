@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer records the requests it receives
+type testServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	hits []string
+}
+
+func newTestServer(t *testing.T, name string) *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits = append(s.hits, r.URL.Path)
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/version":
+			fmt.Fprintf(w, `{"version":"%s"}`, name)
+		default:
+			fmt.Fprintf(w, `{"model":"%s","done":true}`, name)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) Hits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.hits)
+}
+
+// generateOn returns the name of the server a generate request for the model went to
+func generateOn(t *testing.T, client *Client, model string) string {
+	var served string
+	err := client.Generate(context.Background(), &GenerateRequest{Model: model}, func(resp GenerateResponse) error {
+		served = resp.Model
+		return nil
+	})
+	require.NoError(t, err)
+	return served
+}
+
+func TestClientBalancesByModel(t *testing.T) {
+	a, b := newTestServer(t, "a"), newTestServer(t, "b")
+	t.Setenv("OLLAMA_HOST", strings.Join([]string{a.URL, b.URL}, ","))
+
+	client, err := ClientFromEnvironment()
+	require.NoError(t, err)
+	require.Len(t, client.hosts, 2)
+
+	// requests without a model go to the first host
+	for i := 0; i < 3; i++ {
+		v, err := client.Version(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "a", v)
+	}
+
+	// each model sticks to one host, and models are spread across both
+	served := make(map[string]string)
+	for i := 0; i < 16; i++ {
+		model := fmt.Sprintf("model-%d", i)
+		served[model] = generateOn(t, client, model)
+		assert.Equal(t, served[model], generateOn(t, client, model), model)
+	}
+
+	assert.Contains(t, served, "model-0")
+	var onA, onB int
+	for _, host := range served {
+		if host == "a" {
+			onA++
+		} else {
+			onB++
+		}
+	}
+
+	assert.Positive(t, onA)
+	assert.Positive(t, onB)
+}
+
+func TestClientFailsOver(t *testing.T) {
+	a, b := newTestServer(t, "a"), newTestServer(t, "b")
+	t.Setenv("OLLAMA_HOST", strings.Join([]string{a.URL, b.URL}, ","))
+
+	client, err := ClientFromEnvironment()
+	require.NoError(t, err)
+
+	var model string
+	for i := 0; model == ""; i++ {
+		if m := fmt.Sprintf("model-%d", i); generateOn(t, client, m) == "a" {
+			model = m
+		}
+	}
+
+	// a connection kept alive to a server which went away fails with EOF instead, a request is only sent again
+	// when it could not have reached the server
+	a.Close()
+	client.hosts[0].http.CloseIdleConnections()
+
+	// the request is sent to the next host, which serves the model until the first is back
+	assert.Equal(t, "b", generateOn(t, client, model))
+	assert.False(t, client.hosts[0].healthy())
+
+	hits := b.Hits()
+	assert.Equal(t, "b", generateOn(t, client, model))
+	assert.Equal(t, hits+1, b.Hits())
+
+	v, err := client.Version(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "b", v)
+}
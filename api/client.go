@@ -8,20 +8,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
-	"strings"
+	"strconv"
 
 	"github.com/jmorganca/ollama/format"
 	"github.com/jmorganca/ollama/version"
 )
 
+// Client talks to the servers in OLLAMA_HOST, requests to generate with a model are spread across them
 type Client struct {
-	base *url.URL
-	http http.Client
+	hosts []*clientHost
 }
 
 func checkError(resp *http.Response, body []byte) error {
@@ -41,66 +42,33 @@ func checkError(resp *http.Response, body []byte) error {
 }
 
 func ClientFromEnvironment() (*Client, error) {
-	defaultPort := "11434"
-
-	scheme, hostport, ok := strings.Cut(os.Getenv("OLLAMA_HOST"), "://")
-	switch {
-	case !ok:
-		scheme, hostport = "http", os.Getenv("OLLAMA_HOST")
-	case scheme == "http":
-		defaultPort = "80"
-	case scheme == "https":
-		defaultPort = "443"
-	}
-
-	// trim trailing slashes
-	hostport = strings.TrimRight(hostport, "/")
-
-	host, port, err := net.SplitHostPort(hostport)
-	if err != nil {
-		host, port = "127.0.0.1", defaultPort
-		if ip := net.ParseIP(strings.Trim(hostport, "[]")); ip != nil {
-			host = ip.String()
-		} else if hostport != "" {
-			host = hostport
-		}
-	}
-
-	client := Client{
-		base: &url.URL{
-			Scheme: scheme,
-			Host:   net.JoinHostPort(host, port),
-		},
-	}
-
-	mockRequest, err := http.NewRequest(http.MethodHead, client.base.String(), nil)
+	hosts, err := ParseHosts(os.Getenv("OLLAMA_HOST"))
 	if err != nil {
 		return nil, err
 	}
 
-	proxyURL, err := http.ProxyFromEnvironment(mockRequest)
-	if err != nil {
-		return nil, err
-	}
+	var client Client
+	for _, host := range hosts {
+		h, err := newClientHost(host)
+		if err != nil {
+			return nil, err
+		}
 
-	client.http = http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-		},
+		client.hosts = append(client.hosts, h)
 	}
 
 	return &client, nil
 }
 
 func (c *Client) do(ctx context.Context, method, path string, reqData, respData any) error {
-	var reqBody io.Reader
+	var reader io.Reader
 	var data []byte
 	var err error
 
 	switch reqData := reqData.(type) {
 	case io.Reader:
-		// reqData is already an io.Reader
-		reqBody = reqData
+		// reqData is already an io.Reader, it can't be sent again to another host
+		reader = reqData
 	case nil:
 		// noop
 	default:
@@ -108,21 +76,24 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 		if err != nil {
 			return err
 		}
-
-		reqBody = bytes.NewReader(data)
 	}
 
-	requestURL := c.base.JoinPath(path)
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), reqBody)
-	if err != nil {
-		return err
-	}
+	respObj, err := c.send(ctx, path, data, reader == nil, func(requestURL *url.URL) (*http.Request, error) {
+		reqBody := reader
+		if data != nil {
+			reqBody = bytes.NewReader(data)
+		}
 
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/json")
-	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+		request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), reqBody)
+		if err != nil {
+			return nil, err
+		}
 
-	respObj, err := c.http.Do(request)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+		return request, nil
+	})
 	if err != nil {
 		return err
 	}
@@ -148,27 +119,31 @@ func (c *Client) do(ctx context.Context, method, path string, reqData, respData
 const maxBufferSize = 512 * format.KiloByte
 
 func (c *Client) stream(ctx context.Context, method, path string, data any, fn func([]byte) error) error {
-	var buf *bytes.Buffer
+	var bts []byte
 	if data != nil {
-		bts, err := json.Marshal(data)
+		var err error
+		bts, err = json.Marshal(data)
 		if err != nil {
 			return err
 		}
-
-		buf = bytes.NewBuffer(bts)
 	}
 
-	requestURL := c.base.JoinPath(path)
-	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), buf)
-	if err != nil {
-		return err
-	}
+	response, err := c.send(ctx, path, bts, true, func(requestURL *url.URL) (*http.Request, error) {
+		var buf io.Reader
+		if bts != nil {
+			buf = bytes.NewReader(bts)
+		}
 
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Accept", "application/x-ndjson")
-	request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+		request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), buf)
+		if err != nil {
+			return nil, err
+		}
 
-	response, err := c.http.Do(request)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Accept", "application/x-ndjson")
+		request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+		return request, nil
+	})
 	if err != nil {
 		return err
 	}
@@ -188,11 +163,12 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 			return fmt.Errorf("unmarshal: %w", err)
 		}
 
-		if errorResponse.Error != "" {
-			return fmt.Errorf(errorResponse.Error)
-		}
-
 		if response.StatusCode >= http.StatusBadRequest {
+			if errorResponse.Error != "" {
+				// keep the status code so callers can tell error classes apart
+				return StatusError{StatusCode: response.StatusCode, ErrorMessage: errorResponse.Error}
+			}
+
 			return StatusError{
 				StatusCode:   response.StatusCode,
 				Status:       response.Status,
@@ -200,6 +176,10 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 			}
 		}
 
+		if errorResponse.Error != "" {
+			return errors.New(errorResponse.Error)
+		}
+
 		if err := fn(bts); err != nil {
 			return err
 		}
@@ -208,6 +188,12 @@ func (c *Client) stream(ctx context.Context, method, path string, data any, fn f
 	return nil
 }
 
+// Stream sends data to path and calls fn with each object of the streamed response. It is for endpoints
+// without a method of their own, such as the experimental requests of the apix package.
+func (c *Client) Stream(ctx context.Context, method, path string, data any, fn func([]byte) error) error {
+	return c.stream(ctx, method, path, data, fn)
+}
+
 type GenerateResponseFunc func(GenerateResponse) error
 
 func (c *Client) Generate(ctx context.Context, req *GenerateRequest, fn GenerateResponseFunc) error {
@@ -221,6 +207,25 @@ func (c *Client) Generate(ctx context.Context, req *GenerateRequest, fn Generate
 	})
 }
 
+func (c *Client) Infill(ctx context.Context, req *InfillRequest, fn GenerateResponseFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/infill", req, func(bts []byte) error {
+		var resp GenerateResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
+func (c *Client) Classify(ctx context.Context, req *ClassifyRequest) (*ClassifyResponse, error) {
+	var resp ClassifyResponse
+	if err := c.do(ctx, http.MethodPost, "/api/classify", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 type ChatResponseFunc func(ChatResponse) error
 
 func (c *Client) Chat(ctx context.Context, req *ChatRequest, fn ChatResponseFunc) error {
@@ -281,6 +286,39 @@ func (c *Client) List(ctx context.Context) (*ListResponse, error) {
 	return &lr, nil
 }
 
+// ListRunning lists the models loaded in memory
+func (c *Client) ListRunning(ctx context.Context) (*ProcessResponse, error) {
+	var pr ProcessResponse
+	if err := c.do(ctx, http.MethodGet, "/api/ps", nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (c *Client) Metrics(ctx context.Context) (*MetricsResponse, error) {
+	var mr MetricsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/metrics", nil, &mr); err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+func (c *Client) Egress(ctx context.Context) (*EgressResponse, error) {
+	var er EgressResponse
+	if err := c.do(ctx, http.MethodGet, "/api/egress", nil, &er); err != nil {
+		return nil, err
+	}
+	return &er, nil
+}
+
+func (c *Client) Share(ctx context.Context, req *ShareRequest) (*ShareResponse, error) {
+	var sr ShareResponse
+	if err := c.do(ctx, http.MethodPost, "/api/shares", req, &sr); err != nil {
+		return nil, err
+	}
+	return &sr, nil
+}
+
 func (c *Client) Copy(ctx context.Context, req *CopyRequest) error {
 	if err := c.do(ctx, http.MethodPost, "/api/copy", req, nil); err != nil {
 		return err
@@ -295,6 +333,20 @@ func (c *Client) Delete(ctx context.Context, req *DeleteRequest) error {
 	return nil
 }
 
+// Restore brings back a deleted model from the trash
+func (c *Client) Restore(ctx context.Context, req *RestoreRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/restore", req, nil)
+}
+
+// ListTrash lists the deleted models which can be restored
+func (c *Client) ListTrash(ctx context.Context) (*TrashResponse, error) {
+	var resp TrashResponse
+	if err := c.do(ctx, http.MethodGet, "/api/trash", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 func (c *Client) Show(ctx context.Context, req *ShowRequest) (*ShowResponse, error) {
 	var resp ShowResponse
 	if err := c.do(ctx, http.MethodPost, "/api/show", req, &resp); err != nil {
@@ -303,6 +355,161 @@ func (c *Client) Show(ctx context.Context, req *ShowRequest) (*ShowResponse, err
 	return &resp, nil
 }
 
+type LoadResponseFunc func(LoadResponse) error
+
+func (c *Client) Load(ctx context.Context, req *LoadRequest, fn LoadResponseFunc) error {
+	return c.stream(ctx, http.MethodPost, "/api/load", req, func(bts []byte) error {
+		var resp LoadResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
+func (c *Client) Embeddings(ctx context.Context, req *EmbeddingRequest) (*EmbeddingResponse, error) {
+	var resp EmbeddingResponse
+	if err := c.do(ctx, http.MethodPost, "/api/embeddings", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) BatchEmbeddings(ctx context.Context, req *BatchEmbeddingRequest) (*BatchEmbeddingResponse, error) {
+	var resp BatchEmbeddingResponse
+	if err := c.do(ctx, http.MethodPost, "/api/embeddings/batch", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Tokenize(ctx context.Context, req *TokenizeRequest) (*TokenizeResponse, error) {
+	var resp TokenizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/tokenize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Detokenize(ctx context.Context, req *DetokenizeRequest) (*DetokenizeResponse, error) {
+	var resp DetokenizeResponse
+	if err := c.do(ctx, http.MethodPost, "/api/detokenize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Chunk(ctx context.Context, req *ChunkRequest) (*ChunkResponse, error) {
+	var resp ChunkResponse
+	if err := c.do(ctx, http.MethodPost, "/api/chunk", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreateCollection(ctx context.Context, req *CreateCollectionRequest) (*Collection, error) {
+	var resp Collection
+	if err := c.do(ctx, http.MethodPost, "/api/collections", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListLicenses lists the model licenses accepted on the server
+func (c *Client) ListLicenses(ctx context.Context) (*ListLicensesResponse, error) {
+	var resp ListLicensesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/licenses", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListCollections(ctx context.Context) (*ListCollectionsResponse, error) {
+	var resp ListCollectionsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/collections", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteCollection(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/collections/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *Client) UpsertDocuments(ctx context.Context, name string, req *UpsertDocumentsRequest) (*Collection, error) {
+	var resp Collection
+	if err := c.do(ctx, http.MethodPost, "/api/collections/"+url.PathEscape(name)+"/documents", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) QueryCollection(ctx context.Context, name string, req *QueryCollectionRequest) (*QueryCollectionResponse, error) {
+	var resp QueryCollectionResponse
+	if err := c.do(ctx, http.MethodPost, "/api/collections/"+url.PathEscape(name)+"/query", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreateConversation(ctx context.Context, req *CreateConversationRequest) (*Conversation, error) {
+	var resp Conversation
+	if err := c.do(ctx, http.MethodPost, "/api/conversations", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListConversations(ctx context.Context) (*ListConversationsResponse, error) {
+	var resp ListConversationsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/conversations", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetConversation(ctx context.Context, id string) (*Conversation, error) {
+	var resp Conversation
+	if err := c.do(ctx, http.MethodGet, "/api/conversations/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteConversation(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/conversations/"+url.PathEscape(id), nil, nil)
+}
+
+// CreatePreset creates the preset or replaces an existing preset with the same name
+func (c *Client) CreatePreset(ctx context.Context, req *Preset) (*Preset, error) {
+	var resp Preset
+	if err := c.do(ctx, http.MethodPost, "/api/presets", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListPresets(ctx context.Context) (*ListPresetsResponse, error) {
+	var resp ListPresetsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/presets", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetPreset(ctx context.Context, name string) (*Preset, error) {
+	var resp Preset
+	if err := c.do(ctx, http.MethodGet, "/api/presets/"+url.PathEscape(name), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeletePreset(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/presets/"+url.PathEscape(name), nil, nil)
+}
+
 func (c *Client) Heartbeat(ctx context.Context) error {
 	if err := c.do(ctx, http.MethodHead, "/", nil, nil); err != nil {
 		return err
@@ -325,14 +532,105 @@ func (c *Client) CreateBlob(ctx context.Context, digest string, r io.Reader) err
 	return nil
 }
 
-func (c *Client) Version(ctx context.Context) (string, error) {
-	var version struct {
-		Version string `json:"version"`
+func (c *Client) Transcribe(ctx context.Context, req *TranscriptionRequest, audio io.Reader) (*TranscriptionResponse, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	part, err := mw.CreateFormFile("file", filepath.Base(req.Filename))
+	if err != nil {
+		return nil, err
 	}
 
-	if err := c.do(ctx, http.MethodGet, "/api/version", nil, &version); err != nil {
+	if _, err := io.Copy(part, audio); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{"model": req.Model, "language": req.Language, "prompt": req.Prompt}
+	if req.Temperature > 0 {
+		fields["temperature"] = strconv.FormatFloat(float64(req.Temperature), 'f', -1, 32)
+	}
+
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+
+		if err := mw.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	response, err := c.send(ctx, "/v1/audio/transcriptions", nil, true, func(requestURL *url.URL) (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL.String(), bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Set("Content-Type", mw.FormDataContentType())
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("User-Agent", fmt.Sprintf("ollama/%s (%s %s) Go/%s", version.Version, runtime.GOARCH, runtime.GOOS, runtime.Version()))
+		return request, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkError(response, respBody); err != nil {
+		return nil, err
+	}
+
+	var resp TranscriptionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) GenerateImage(ctx context.Context, req *ImageGenerateRequest) (*ImageGenerateResponse, error) {
+	var resp ImageGenerateResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/images/generations", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Logs(ctx context.Context, req *LogsRequest, fn func(LogsResponse) error) error {
+	return c.stream(ctx, http.MethodPost, "/api/logs", req, func(bts []byte) error {
+		var resp LogsResponse
+		if err := json.Unmarshal(bts, &resp); err != nil {
+			return err
+		}
+
+		return fn(resp)
+	})
+}
+
+func (c *Client) Version(ctx context.Context) (string, error) {
+	version, err := c.VersionDetails(ctx)
+	if err != nil {
 		return "", err
 	}
 
 	return version.Version, nil
 }
+
+// VersionDetails returns the server's version along with how it was built
+func (c *Client) VersionDetails(ctx context.Context) (*VersionResponse, error) {
+	var version VersionResponse
+	if err := c.do(ctx, http.MethodGet, "/api/version", nil, &version); err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
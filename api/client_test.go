@@ -24,6 +24,9 @@ func TestClientFromEnvironment(t *testing.T) {
 		"scheme, hostname, and port": {value: "https://example.com:1234", expect: "https://example.com:1234"},
 		"trailing slash":             {value: "example.com/", expect: "http://example.com:11434"},
 		"trailing slash port":        {value: "example.com:1234/", expect: "http://example.com:1234"},
+		"several addresses":          {value: "1.2.3.4:1234, [::1]:1234", expect: "http://1.2.3.4:1234"},
+		"path prefix":                {value: "https://example.com/ollama/", expect: "https://example.com:443/ollama"},
+		"unix socket":                {value: "unix:///run/ollama.sock,127.0.0.1:11434", expect: "http://localhost"},
 	}
 
 	for k, v := range testCases {
@@ -35,8 +38,8 @@ func TestClientFromEnvironment(t *testing.T) {
 				t.Fatalf("expected %s, got %s", v.err, err)
 			}
 
-			if client.base.String() != v.expect {
-				t.Fatalf("expected %s, got %s", v.expect, client.base.String())
+			if client.hosts[0].base.String() != v.expect {
+				t.Fatalf("expected %s, got %s", v.expect, client.hosts[0].base.String())
 			}
 		})
 	}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Host is an address of the server as it is written in OLLAMA_HOST, both the client and the server read
+// OLLAMA_HOST with ParseHosts so they agree where the server is
+type Host struct {
+	// Scheme is http, https or unix
+	Scheme string
+	// Host is a hostname or an IP address, IPv6 addresses are not bracketed
+	Host string
+	Port string
+
+	// Path is the socket of a unix host
+	Path string
+	// Prefix is the path the API is served under, e.g. /ollama behind a reverse proxy
+	Prefix string
+}
+
+// ParseHosts reads a comma separated list of hosts, e.g.
+//
+//	127.0.0.1:11434,[::1]:11434,unix:///run/ollama.sock
+//
+// An empty list is 127.0.0.1:11434.
+func ParseHosts(s string) ([]Host, error) {
+	var hosts []Host
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		h, err := ParseHost(part)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	if len(hosts) == 0 {
+		return []Host{{Scheme: "http", Host: "127.0.0.1", Port: "11434"}}, nil
+	}
+
+	return hosts, nil
+}
+
+// ParseHost reads a single host. The scheme defaults to http, and the port to 11434 without a scheme
+// and to the scheme's port with one. The host defaults to 127.0.0.1 and may be a hostname or an IPv4 or
+// IPv6 address, with or without brackets. A path after the host is the prefix the API is served under.
+func ParseHost(s string) (Host, error) {
+	s = strings.TrimSpace(s)
+
+	h := Host{Scheme: "http", Port: "11434"}
+	if scheme, rest, ok := strings.Cut(s, "://"); ok {
+		h.Scheme, s = strings.ToLower(scheme), rest
+		switch h.Scheme {
+		case "http":
+			h.Port = "80"
+		case "https":
+			h.Port = "443"
+		case "unix":
+			if s == "" {
+				return Host{}, fmt.Errorf("invalid host %q: missing socket path", "unix://")
+			}
+
+			return Host{Scheme: "unix", Path: s}, nil
+		default:
+			return Host{}, fmt.Errorf("invalid host %q: unsupported scheme %q", scheme+"://"+s, scheme)
+		}
+	}
+
+	hostport, prefix, _ := strings.Cut(s, "/")
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		h.Prefix = "/" + prefix
+	}
+
+	if hostport == "" {
+		h.Host = "127.0.0.1"
+		return h, nil
+	}
+
+	// a bare IPv6 address has colons but no port
+	bare := hostport
+	if strings.HasPrefix(bare, "[") && strings.HasSuffix(bare, "]") {
+		bare = bare[1 : len(bare)-1]
+	}
+
+	if !strings.ContainsAny(bare, "[]") {
+		if addr, err := netip.ParseAddr(bare); err == nil {
+			h.Host = addr.String()
+			return h, nil
+		}
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// a hostname or IPv4 address without a port
+		if strings.ContainsAny(hostport, ":[]") {
+			return Host{}, fmt.Errorf("invalid host %q", s)
+		}
+
+		h.Host = hostport
+		return h, nil
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return Host{}, fmt.Errorf("invalid host %q: invalid port %q", s, port)
+	}
+
+	h.Host, h.Port = host, port
+	return h, nil
+}
+
+// Network is the network to dial or listen on, tcp or unix
+func (h Host) Network() string {
+	if h.Scheme == "unix" {
+		return "unix"
+	}
+
+	return "tcp"
+}
+
+// Address is the address to dial or listen on, host:port or the path of a socket
+func (h Host) Address() string {
+	if h.Scheme == "unix" {
+		return h.Path
+	}
+
+	return net.JoinHostPort(h.Host, h.Port)
+}
+
+func (h Host) String() string {
+	if h.Scheme == "unix" {
+		return "unix://" + h.Path
+	}
+
+	return h.Scheme + "://" + h.Address() + h.Prefix
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHost(t *testing.T) {
+	cases := map[string]string{
+		"":                            "http://127.0.0.1:11434",
+		"1.2.3.4":                     "http://1.2.3.4:11434",
+		"1.2.3.4:1234":                "http://1.2.3.4:1234",
+		":1234":                       "http://:1234",
+		"example.com":                 "http://example.com:11434",
+		"example.com:1234/":           "http://example.com:1234",
+		"http://example.com":          "http://example.com:80",
+		"HTTPS://example.com":         "https://example.com:443",
+		"https://example.com:99":      "https://example.com:99",
+		"::1":                         "http://[::1]:11434",
+		"[::1]":                       "http://[::1]:11434",
+		"[::1]:1234":                  "http://[::1]:1234",
+		"https://[::1]":               "https://[::1]:443",
+		"fe80::1%eth0":                "http://[fe80::1%eth0]:11434",
+		"[fe80::1%eth0]:1234":         "http://[fe80::1%eth0]:1234",
+		"2001:db8::1":                 "http://[2001:db8::1]:11434",
+		"unix:///run/ollama.sock":     "unix:///run/ollama.sock",
+		"https://example.com/ollama/": "https://example.com:443/ollama",
+		"example.com:1234/a/b":        "http://example.com:1234/a/b",
+	}
+
+	for s, expected := range cases {
+		h, err := ParseHost(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, h.String(), s)
+	}
+}
+
+func TestParseHostErrors(t *testing.T) {
+	for _, s := range []string{"ftp://example.com", "example.com:port", "1.2.3.4:65536", "[::1", "unix://"} {
+		_, err := ParseHost(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	hosts, err := ParseHosts("127.0.0.1:11434, [::1]:11434,unix:///run/ollama.sock,")
+	require.NoError(t, err)
+	assert.Equal(t, []Host{
+		{Scheme: "http", Host: "127.0.0.1", Port: "11434"},
+		{Scheme: "http", Host: "::1", Port: "11434"},
+		{Scheme: "unix", Path: "/run/ollama.sock"},
+	}, hosts)
+
+	hosts, err = ParseHosts(" ")
+	require.NoError(t, err)
+	assert.Equal(t, []Host{{Scheme: "http", Host: "127.0.0.1", Port: "11434"}}, hosts)
+
+	_, err = ParseHosts("127.0.0.1,ftp://example.com")
+	assert.Error(t, err)
+}
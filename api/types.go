@@ -6,6 +6,7 @@ import (
 	"math"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -33,6 +34,7 @@ func (e StatusError) Error() string {
 
 type ImageData []byte
 
+// GenerateRequest is the stable request of /api/generate, apix.GenerateRequest adds the experimental fields
 type GenerateRequest struct {
 	Model    string      `json:"model"`
 	Prompt   string      `json:"prompt"`
@@ -47,6 +49,40 @@ type GenerateRequest struct {
 	Options map[string]interface{} `json:"options"`
 }
 
+type InfillRequest struct {
+	Model     string `json:"model"`
+	Prefix    string `json:"prefix"`
+	Suffix    string `json:"suffix"`
+	MaxTokens int    `json:"max_tokens,omitempty"`
+	Stream    *bool  `json:"stream,omitempty"`
+
+	Options map[string]interface{} `json:"options"`
+}
+
+type ClassifyRequest struct {
+	Model   string   `json:"model"`
+	Prompt  string   `json:"prompt"`
+	System  string   `json:"system"`
+	Choices []string `json:"choices"`
+	Raw     bool     `json:"raw,omitempty"`
+
+	Options map[string]interface{} `json:"options"`
+}
+
+type ClassifyResponse struct {
+	Model     string           `json:"model"`
+	CreatedAt time.Time        `json:"created_at"`
+	Choices   []ClassifyChoice `json:"choices"`
+
+	Metrics
+}
+
+type ClassifyChoice struct {
+	Choice      string  `json:"choice"`
+	Probability float64 `json:"probability"`
+}
+
+// ChatRequest is the stable request of /api/chat, apix.ChatRequest adds the experimental fields
 type ChatRequest struct {
 	Model    string    `json:"model"`
 	Messages []Message `json:"messages"`
@@ -57,9 +93,10 @@ type ChatRequest struct {
 }
 
 type Message struct {
-	Role    string      `json:"role"` // one of ["system", "user", "assistant"]
-	Content string      `json:"content"`
-	Images  []ImageData `json:"images, omitempty"`
+	Role     string      `json:"role"` // one of ["system", "user", "assistant"]
+	Content  string      `json:"content"`
+	Thinking string      `json:"thinking,omitempty"`
+	Images   []ImageData `json:"images,omitempty"`
 }
 
 type ChatResponse struct {
@@ -67,11 +104,84 @@ type ChatResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	Message   *Message  `json:"message,omitempty"`
 
+	// Load reports progress while the model is loading
+	Load *LoadProgress `json:"load,omitempty"`
+
 	Done bool `json:"done"`
+	// FinishReason is set on the final response, "length" if the response was cut off by num_predict or
+	// num_predict_chars and "stop" otherwise
+	FinishReason string `json:"finish_reason,omitempty"`
+
+	// OptionsUsed are the model's defaults merged with the request options, set when debugging
+	OptionsUsed map[string]interface{} `json:"options_used,omitempty"`
+
+	// Prompt is the prompt sent to the model, set on the final response when the request asks for it
+	Prompt string `json:"prompt,omitempty"`
+
+	// Moderation is set on the final response when the server moderates generations
+	Moderation *Moderation `json:"moderation,omitempty"`
+
+	// Logprobs are the log probabilities of the tokens of the response's content, set when the request asks
+	// for them
+	Logprobs []TokenLogprob `json:"logprobs,omitempty"`
 
 	Metrics
 }
 
+// TokenLogprob is the natural log of the probability of a generated token, with the most likely tokens in its
+// place when they are asked for
+type TokenLogprob struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	TopLogprobs []TopLogprob `json:"top_logprobs,omitempty"`
+}
+
+// TopLogprob is a token the model could have generated in place of another, with its log probability
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+}
+
+// LoadRequest loads a model into memory ahead of generating with it
+type LoadRequest struct {
+	Model string `json:"model"`
+
+	// KeepAlive is how long the model stays loaded after the request, e.g. "10m"
+	KeepAlive string `json:"keep_alive,omitempty"`
+
+	// MainGPU is the GPU to place the model on when several are available
+	MainGPU *int `json:"main_gpu,omitempty"`
+
+	Stream *bool `json:"stream,omitempty"`
+
+	Options map[string]interface{} `json:"options"`
+}
+
+type LoadResponse struct {
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Load reports progress while the model is loading
+	Load *LoadProgress `json:"load,omitempty"`
+
+	ExpiresAt    time.Time     `json:"expires_at,omitempty"`
+	LoadDuration time.Duration `json:"load_duration,omitempty"`
+
+	Size        int64 `json:"size,omitempty"`
+	TotalLayers int   `json:"total_layers,omitempty"`
+	GPULayers   int   `json:"gpu_layers,omitempty"`
+	MainGPU     int   `json:"main_gpu,omitempty"`
+}
+
+// LoadProgress reports the progress of loading a model into memory
+type LoadProgress struct {
+	Percent         float64 `json:"percent"`
+	Completed       int64   `json:"completed"`
+	Total           int64   `json:"total"`
+	LayersOffloaded int     `json:"layers_offloaded"`
+	TotalLayers     int     `json:"total_layers"`
+}
+
 type Metrics struct {
 	TotalDuration      time.Duration `json:"total_duration,omitempty"`
 	LoadDuration       time.Duration `json:"load_duration,omitempty"`
@@ -79,6 +189,13 @@ type Metrics struct {
 	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
 	EvalCount          int           `json:"eval_count,omitempty"`
 	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
+	FirstTokenDuration time.Duration `json:"first_token_duration,omitempty"`
+	ChunkTimestamps    []time.Time   `json:"chunk_timestamps,omitempty"`
+
+	// PromptTokens and ContextRemaining report how much of the context window the exchange used,
+	// they are set on the final response
+	PromptTokens     int  `json:"prompt_tokens,omitempty"`
+	ContextRemaining *int `json:"context_remaining,omitempty"`
 }
 
 // Options specfied in GenerateRequest, if you add a new option here add it to the API docs also
@@ -89,6 +206,8 @@ type Options struct {
 	NumKeep          int      `json:"num_keep,omitempty"`
 	Seed             int      `json:"seed,omitempty"`
 	NumPredict       int      `json:"num_predict,omitempty"`
+	NumPredictChars  int      `json:"num_predict_chars,omitempty"`
+	StopAtSentence   bool     `json:"stop_at_sentence,omitempty"`
 	TopK             int      `json:"top_k,omitempty"`
 	TopP             float32  `json:"top_p,omitempty"`
 	TFSZ             float32  `json:"tfs_z,omitempty"`
@@ -126,14 +245,485 @@ type Runner struct {
 }
 
 type EmbeddingRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model  string      `json:"model"`
+	Prompt string      `json:"prompt"`
+	Images []ImageData `json:"images,omitempty"`
+
+	// Truncate is how prompts longer than the context are handled: "error" (default),
+	// "head" to drop tokens from the start or "tail" to drop tokens from the end
+	Truncate string `json:"truncate,omitempty"`
+
+	// Pooling is how token embeddings are combined: "last" (default), "mean" or "cls"
+	Pooling string `json:"pooling,omitempty"`
+
+	// Dimensions truncates the embedding to its first N dimensions for Matryoshka models
+	Dimensions int `json:"dimensions,omitempty"`
+
+	// Normalize scales the embedding to unit length
+	Normalize bool `json:"normalize,omitempty"`
 
 	Options map[string]interface{} `json:"options"`
 }
 
 type EmbeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
+
+	// Tokens is the number of prompt tokens embedded after any truncation
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// BatchEmbeddingRequest embeds many prompts with the same options, for indexing jobs which care about
+// throughput rather than the latency of each prompt
+type BatchEmbeddingRequest struct {
+	Model   string   `json:"model"`
+	Prompts []string `json:"prompts"`
+
+	Truncate   string `json:"truncate,omitempty"`
+	Pooling    string `json:"pooling,omitempty"`
+	Dimensions int    `json:"dimensions,omitempty"`
+	Normalize  bool   `json:"normalize,omitempty"`
+
+	Options map[string]interface{} `json:"options"`
+}
+
+type BatchEmbeddingResponse struct {
+	// Embeddings are in the order of the prompts
+	Embeddings [][]float64 `json:"embeddings"`
+
+	// Tokens is the number of prompt tokens embedded across every prompt
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// TokenizeRequest tokenizes text with a model's tokenizer, without loading the model
+type TokenizeRequest struct {
+	Model   string `json:"model"`
+	Content string `json:"content"`
+
+	// AddSpecial adds the tokens the model expects around a prompt, such as BOS (default true)
+	AddSpecial *bool `json:"add_special,omitempty"`
+
+	// ParseSpecial tokenizes the text of control tokens, such as <|im_start|>, as those tokens rather than
+	// as text
+	ParseSpecial bool `json:"parse_special,omitempty"`
+}
+
+type TokenizeResponse struct {
+	Tokens []int `json:"tokens"`
+}
+
+type DetokenizeRequest struct {
+	Model  string `json:"model"`
+	Tokens []int  `json:"tokens"`
+
+	// RenderSpecial writes the text of control tokens, which are otherwise left out
+	RenderSpecial bool `json:"render_special,omitempty"`
+}
+
+type DetokenizeResponse struct {
+	Content string `json:"content"`
+}
+
+type ChunkRequest struct {
+	Model string `json:"model"`
+	Text  string `json:"text"`
+
+	// ChunkSize is the maximum number of tokens in each chunk
+	ChunkSize int `json:"chunk_size,omitempty"`
+
+	// Overlap is the number of tokens each chunk repeats from the one before it
+	Overlap int `json:"overlap,omitempty"`
+
+	Options map[string]interface{} `json:"options"`
+}
+
+type ChunkResponse struct {
+	Model  string  `json:"model"`
+	Tokens int     `json:"tokens"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Chunk is a piece of text along with its token offsets in the original text
+type Chunk struct {
+	Text   string `json:"text"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Tokens int    `json:"tokens"`
+}
+
+type CreateCollectionRequest struct {
+	Name string `json:"name"`
+
+	// Model embeds the documents and queries of the collection
+	Model string `json:"model"`
+}
+
+type Collection struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	Dimensions int       `json:"dimensions,omitempty"`
+	Documents  int       `json:"documents"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+type ListCollectionsResponse struct {
+	Collections []Collection `json:"collections"`
+}
+
+// License is a model license accepted when the model was pulled
+type License struct {
+	Digest     string    `json:"digest"`
+	Title      string    `json:"title"`
+	Model      string    `json:"model"`
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+type ListLicensesResponse struct {
+	Licenses []License `json:"licenses"`
+}
+
+// Document is a piece of text stored in a collection. Documents without an embedding are
+// embedded with the collection's model.
+type Document struct {
+	ID        string            `json:"id"`
+	Text      string            `json:"text"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Embedding []float64         `json:"embedding,omitempty"`
+}
+
+type UpsertDocumentsRequest struct {
+	Documents []Document `json:"documents"`
+}
+
+type QueryCollectionRequest struct {
+	// Text is embedded with the collection's model unless Embedding is set
+	Text      string    `json:"text,omitempty"`
+	Embedding []float64 `json:"embedding,omitempty"`
+
+	// TopK is the number of documents to return, by default 5
+	TopK int `json:"top_k,omitempty"`
+}
+
+type QueryCollectionResponse struct {
+	Results []QueryResult `json:"results"`
+}
+
+type QueryResult struct {
+	Document
+	Score float64 `json:"score"`
+}
+
+type CreateConversationRequest struct {
+	Model string `json:"model"`
+
+	// Messages start the conversation, e.g. with a system message
+	Messages []Message `json:"messages,omitempty"`
+}
+
+type Conversation struct {
+	ID         string    `json:"id"`
+	Model      string    `json:"model"`
+	Messages   []Message `json:"messages,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+type ListConversationsResponse struct {
+	Conversations []Conversation `json:"conversations"`
+}
+
+// Preset bundles a model with a system message and options under a name
+type Preset struct {
+	Name       string                 `json:"name"`
+	Model      string                 `json:"model"`
+	System     string                 `json:"system,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+	ModifiedAt time.Time              `json:"modified_at"`
+}
+
+type ListPresetsResponse struct {
+	Presets []Preset `json:"presets"`
+}
+
+type TranscriptionRequest struct {
+	Model       string  `json:"model"`
+	Filename    string  `json:"filename"`
+	Language    string  `json:"language,omitempty"`
+	Prompt      string  `json:"prompt,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+}
+
+type TranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// ModerationRequest is the OpenAI compatible moderation request, Input is a string or a list of strings
+type ModerationRequest struct {
+	Model string `json:"model,omitempty"`
+	Input any    `json:"input"`
+}
+
+type ModerationResponse struct {
+	ID      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
+
+// ModerationResult scores a text in each category, a category is flagged when its score reaches the threshold
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// Moderation is the moderation of a generation's input and output
+type Moderation struct {
+	Input  *ModerationResult `json:"input,omitempty"`
+	Output *ModerationResult `json:"output,omitempty"`
+}
+
+// CompletionOptions are the sampling parameters of the OpenAI compatible completion requests, which are
+// passed on as options. Stop is a string or a list of strings.
+type CompletionOptions struct {
+	MaxTokens        *int     `json:"max_tokens,omitempty"`
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"top_p,omitempty"`
+	PresencePenalty  *float32 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float32 `json:"frequency_penalty,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	Stop             any      `json:"stop,omitempty"`
+}
+
+// StreamOptions are the options of a streamed OpenAI compatible completion
+type StreamOptions struct {
+	// IncludeUsage sends the usage in a last chunk without choices
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+// CompletionRequest is the OpenAI compatible text completion request, Prompt is a string or a list of one string
+type CompletionRequest struct {
+	Model         string         `json:"model"`
+	Prompt        any            `json:"prompt"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+
+	// Suffix is the text after the completion, a prompt with a suffix is filled in the middle as with
+	// InfillRequest
+	Suffix string `json:"suffix,omitempty"`
+
+	CompletionOptions
+}
+
+// CompletionResponse is a text completion, or a chunk of one when it is streamed
+type CompletionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+
+	// SystemFingerprint identifies the model and the server version which generated the completion
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	// Usage is set on the response. Streams only have it in a last chunk without choices, when it is asked for
+	// with StreamOptions.
+	Usage *CompletionUsage `json:"usage,omitempty"`
+}
+
+type CompletionChoice struct {
+	Text  string `json:"text"`
+	Index int    `json:"index"`
+
+	// FinishReason is "stop" or "length" once the completion has finished and null until then
+	FinishReason *string `json:"finish_reason"`
+}
+
+type CompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatCompletionRequest is the OpenAI compatible chat completion request
+type ChatCompletionRequest struct {
+	Model         string                  `json:"model"`
+	Messages      []ChatCompletionMessage `json:"messages"`
+	Stream        bool                    `json:"stream,omitempty"`
+	StreamOptions *StreamOptions          `json:"stream_options,omitempty"`
+
+	// Tools are the functions the model may call. ToolChoice is "auto", the default, "none", "required", or
+	// {"type": "function", "function": {"name": "..."}} to call that function.
+	Tools      []Tool `json:"tools,omitempty"`
+	ToolChoice any    `json:"tool_choice,omitempty"`
+
+	// N is the number of choices to generate, 1 by default. Each is a generation of its own.
+	N *int `json:"n,omitempty"`
+
+	// Logprobs returns the log probabilities of the tokens of the reply, with the TopLogprobs most likely
+	// tokens in place of each, at most 20
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs *int `json:"top_logprobs,omitempty"`
+
+	// ResponseFormat constrains the reply to JSON, or to JSON matching a schema
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	CompletionOptions
+}
+
+// ResponseFormat is the format of a chat completion's reply. Type is "text", the default, "json_object" for
+// any JSON object or "json_schema" for JSON matching JSONSchema.
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema is a schema for the reply. The reply always matches the schema, whether or not Strict is set.
+type JSONSchema struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// ChatCompletionMessage is a message of a chat completion. The Content of a request's message is a string or a
+// list of text parts, {"type": "text", "text": "..."}, that of a response is a string, or null when the
+// assistant calls tools.
+type ChatCompletionMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content any    `json:"content"`
+
+	// ToolCalls are the tools called by an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// ToolCallID is the call a "tool" message has the result of
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Tool is a function a chat completion's model may call, Type is "function"
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction describes a function, Parameters is the JSON schema of its arguments
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a call of a function by the model, Type is "function"
+type ToolCall struct {
+	// Index is the position of the call in the message, which streamed chunks use to tell calls apart
+	Index    int              `json:"index"`
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the function called and its JSON encoded Arguments
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ChatCompletionResponse is a chat completion, or a chunk of one when it is streamed
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+
+	// SystemFingerprint identifies the model and the server version which generated the completion
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	// Usage is set on the response. Streams only have it in a last chunk without choices, when it is asked for
+	// with StreamOptions.
+	Usage *CompletionUsage `json:"usage,omitempty"`
+}
+
+// ChatCompletionChoice has the Message of a response, or the Delta of a streamed chunk
+type ChatCompletionChoice struct {
+	Index   int                    `json:"index"`
+	Message *ChatCompletionMessage `json:"message,omitempty"`
+	Delta   *ChatCompletionMessage `json:"delta,omitempty"`
+
+	// Logprobs are those of the tokens of the message, or of the delta's, when the request asks for them
+	Logprobs *ChatCompletionLogprobs `json:"logprobs,omitempty"`
+
+	// FinishReason is "stop", "length" or "tool_calls" once the completion has finished and null until then
+	FinishReason *string `json:"finish_reason"`
+}
+
+type ChatCompletionLogprobs struct {
+	Content []ChatCompletionLogprob `json:"content"`
+}
+
+// ChatCompletionLogprob is the log probability of a token of a chat completion. Bytes are the UTF-8 bytes
+// of the token, as a token may be part of a character.
+type ChatCompletionLogprob struct {
+	Token       string                     `json:"token"`
+	Logprob     float64                    `json:"logprob"`
+	Bytes       []int                      `json:"bytes"`
+	TopLogprobs []ChatCompletionTopLogprob `json:"top_logprobs"`
+}
+
+type ChatCompletionTopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes"`
+}
+
+// EmbeddingsRequest is the OpenAI compatible embeddings request, Input is a string or a list of strings and
+// EncodingFormat is "float", the default, or "base64"
+type EmbeddingsRequest struct {
+	Model          string `json:"model"`
+	Input          any    `json:"input"`
+	EncodingFormat string `json:"encoding_format,omitempty"`
+	Dimensions     int    `json:"dimensions,omitempty"`
+	User           string `json:"user,omitempty"`
+}
+
+type EmbeddingsResponse struct {
+	Object string          `json:"object"`
+	Data   []EmbeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  EmbeddingsUsage `json:"usage"`
+}
+
+// EmbeddingData is the embedding of the input at Index, a list of numbers or, with the "base64" encoding
+// format, a base64 string of little endian float32s
+type EmbeddingData struct {
+	Object    string `json:"object"`
+	Embedding any    `json:"embedding"`
+	Index     int    `json:"index"`
+}
+
+type EmbeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type ImageGenerateRequest struct {
+	Model          string  `json:"model"`
+	Prompt         string  `json:"prompt"`
+	NegativePrompt string  `json:"negative_prompt,omitempty"`
+	N              int     `json:"n,omitempty"`
+	Size           string  `json:"size,omitempty"`
+	Steps          int     `json:"steps,omitempty"`
+	CFGScale       float32 `json:"cfg_scale,omitempty"`
+	Seed           *int64  `json:"seed,omitempty"`
+	ResponseFormat string  `json:"response_format,omitempty"`
+}
+
+type ImageGenerateResponse struct {
+	Created int64            `json:"created"`
+	Data    []GeneratedImage `json:"data"`
+}
+
+type GeneratedImage struct {
+	B64JSON string `json:"b64_json"`
+	Seed    int64  `json:"seed"`
 }
 
 type CreateRequest struct {
@@ -141,10 +731,33 @@ type CreateRequest struct {
 	Path      string `json:"path"`
 	Modelfile string `json:"modelfile"`
 	Stream    *bool  `json:"stream,omitempty"`
+
+	// Wait for another process changing the model store instead of failing
+	Wait bool `json:"wait,omitempty"`
 }
 
 type DeleteRequest struct {
 	Name string `json:"name"`
+
+	// Purge deletes the model and its layers straight away instead of moving it to the trash
+	Purge bool `json:"purge,omitempty"`
+}
+
+type RestoreRequest struct {
+	Name string `json:"name"`
+}
+
+// TrashedModel is a deleted model which can be restored until it expires
+type TrashedModel struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type TrashResponse struct {
+	Models []TrashedModel `json:"models"`
 }
 
 type ShowRequest struct {
@@ -158,6 +771,23 @@ type ShowResponse struct {
 	Template   string       `json:"template,omitempty"`
 	System     string       `json:"system,omitempty"`
 	Details    ModelDetails `json:"details,omitempty"`
+
+	// Labels are the key=value pairs set with LABEL in the Modelfile
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Digest is the sha256 digest of the model's manifest and Layers are the blobs it lists, config first
+	Digest string          `json:"digest,omitempty"`
+	Layers []LayerResponse `json:"layers,omitempty"`
+}
+
+// LayerResponse is a blob of a model. Registry is where the model, or the model the layer was inherited
+// from, is named for.
+type LayerResponse struct {
+	MediaType string `json:"media_type"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Registry  string `json:"registry"`
+	From      string `json:"from,omitempty"`
 }
 
 type CopyRequest struct {
@@ -171,6 +801,34 @@ type PullRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Stream   *bool  `json:"stream,omitempty"`
+
+	// URL is a GGUF file on a web server to create the model from instead of pulling it from a registry. Its
+	// sha256 checksum is in the url's sha256 parameter, or else published next to it in <url>.sha256. A url
+	// from ShareResponse pulls the shared model as it is. Name defaults to the file's or shared model's name.
+	URL string `json:"url,omitempty"`
+
+	// Wait for another process changing the model store instead of failing
+	Wait bool `json:"wait,omitempty"`
+
+	// AcceptLicense accepts the model's license when the server requires restrictive licenses to be accepted
+	// before a model is pulled
+	AcceptLicense bool `json:"accept_license,omitempty"`
+}
+
+// ShareRequest shares a local model, so it can be downloaded by another machine for a while
+type ShareRequest struct {
+	Name string `json:"name"`
+
+	// Duration is how long the share lasts, e.g. "30m", it defaults to an hour
+	Duration string `json:"duration,omitempty"`
+}
+
+type ShareResponse struct {
+	Name string `json:"name"`
+
+	// URLs are where the model can be downloaded from, one for each address of the server
+	URLs      []string  `json:"urls"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type ProgressResponse struct {
@@ -192,12 +850,130 @@ type ListResponse struct {
 	Models []ModelResponse `json:"models"`
 }
 
+// ProcessResponse lists the models loaded in memory
+type ProcessResponse struct {
+	Models []ProcessModel `json:"models"`
+}
+
+type LogsRequest struct {
+	// Lines is how many of the last lines of the log to send, 100 by default
+	Lines int `json:"lines,omitempty"`
+
+	// Follow keeps sending lines as they are logged
+	Follow bool `json:"follow,omitempty"`
+}
+
+type LogsResponse struct {
+	Line string `json:"line"`
+}
+
+type VersionResponse struct {
+	Version string `json:"version"`
+
+	// Commit and BuildDate identify the build, they are empty if unknown
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+
+	// LlamaCppCommit is the llama.cpp the runners were built from
+	LlamaCppCommit string `json:"llama_cpp_commit,omitempty"`
+
+	// Backends are the runner builds available, such as "cpu", "cuda" or "metal"
+	Backends []string `json:"backends,omitempty"`
+}
+
+type ProcessModel struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+
+	// Size is the size of the model weights in bytes
+	Size int64 `json:"size"`
+
+	GPULayers   int       `json:"gpu_layers"`
+	TotalLayers int       `json:"total_layers"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MetricsResponse reports the load on the server and the resources of the machine it runs on
+type MetricsResponse struct {
+	// ActiveRequests are being processed by the loaded model, QueuedRequests are waiting for it
+	ActiveRequests int   `json:"active_requests"`
+	QueuedRequests int   `json:"queued_requests"`
+	TotalRequests  int64 `json:"total_requests"`
+
+	// TokensPerSecond is the number of tokens generated per second over the last minute
+	TokensPerSecond float64 `json:"tokens_per_second"`
+
+	NumCPU int `json:"num_cpu"`
+
+	// CPULoad is the one minute load average, it is 0 where it is not available
+	CPULoad float64 `json:"cpu_load"`
+
+	// MemoryTotal and MemoryAvailable are in bytes, they are 0 where they are not available
+	MemoryTotal     uint64 `json:"memory_total"`
+	MemoryAvailable uint64 `json:"memory_available"`
+
+	GPUs []GPUMetrics `json:"gpus,omitempty"`
+
+	Streams StreamMetrics `json:"streams"`
+}
+
+// StreamMetrics reports the responses streamed responses hold for clients reading slower than they are generated
+type StreamMetrics struct {
+	// Active is the number of responses being streamed
+	Active int `json:"active"`
+
+	// Buffered is the number of responses waiting for their clients across all streams, BufferSize is the
+	// most each stream holds and Peak is the most any stream has held
+	Buffered   int `json:"buffered"`
+	BufferSize int `json:"buffer_size"`
+	Peak       int `json:"peak"`
+
+	// Overflow is what happens when a stream is full, "pause" or "summary"
+	Overflow string `json:"overflow"`
+
+	// Pauses counts the times generation waited for a client, Summarized the responses merged into the one
+	// before them
+	Pauses     int64 `json:"pauses"`
+	Summarized int64 `json:"summarized"`
+}
+
+type GPUMetrics struct {
+	Name string `json:"name"`
+
+	// Utilization is the percentage of time the GPU was busy
+	Utilization float64 `json:"utilization"`
+
+	// MemoryUsed and MemoryTotal are in bytes
+	MemoryUsed  uint64 `json:"memory_used"`
+	MemoryTotal uint64 `json:"memory_total"`
+}
+
+// EgressResponse lists every destination off the machine the server may send requests to with its current
+// configuration. The server sends no telemetry, so nothing else is contacted.
+type EgressResponse struct {
+	// Offline is set when OLLAMA_OFFLINE keeps the server from contacting registries
+	Offline      bool                `json:"offline"`
+	Destinations []EgressDestination `json:"destinations"`
+}
+
+type EgressDestination struct {
+	// URL is where requests are sent with any credentials removed, * stands for any host
+	URL string `json:"url"`
+
+	// Purpose is one of registry, mirror, huggingface, hook or proxy
+	Purpose string `json:"purpose"`
+	Reason  string `json:"reason"`
+}
+
 type ModelResponse struct {
 	Name       string       `json:"name"`
 	ModifiedAt time.Time    `json:"modified_at"`
 	Size       int64        `json:"size"`
 	Digest     string       `json:"digest"`
 	Details    ModelDetails `json:"details,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type TokenResponse struct {
@@ -208,9 +984,25 @@ type GenerateResponse struct {
 	Model     string    `json:"model"`
 	CreatedAt time.Time `json:"created_at"`
 	Response  string    `json:"response"`
+	Thinking  string    `json:"thinking,omitempty"`
+
+	// Load reports progress while the model is loading
+	Load *LoadProgress `json:"load,omitempty"`
 
 	Done    bool  `json:"done"`
 	Context []int `json:"context,omitempty"`
+	// FinishReason is set on the final response, "length" if the response was cut off by num_predict or
+	// num_predict_chars and "stop" otherwise
+	FinishReason string `json:"finish_reason,omitempty"`
+
+	// OptionsUsed are the model's defaults merged with the request options, set when debugging
+	OptionsUsed map[string]interface{} `json:"options_used,omitempty"`
+
+	// Prompt is the prompt sent to the model, set on the final response when the request asks for it
+	Prompt string `json:"prompt,omitempty"`
+
+	// Moderation is set on the final response when the server moderates generations
+	Moderation *Moderation `json:"moderation,omitempty"`
 
 	Metrics
 }
@@ -232,6 +1024,10 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "load duration:        %v\n", m.LoadDuration)
 	}
 
+	if m.FirstTokenDuration > 0 {
+		fmt.Fprintf(os.Stderr, "first token duration: %v\n", m.FirstTokenDuration)
+	}
+
 	if m.PromptEvalCount > 0 {
 		fmt.Fprintf(os.Stderr, "prompt eval count:    %d token(s)\n", m.PromptEvalCount)
 	}
@@ -249,10 +1045,24 @@ func (m *Metrics) Summary() {
 		fmt.Fprintf(os.Stderr, "eval duration:        %s\n", m.EvalDuration)
 		fmt.Fprintf(os.Stderr, "eval rate:            %.2f tokens/s\n", float64(m.EvalCount)/m.EvalDuration.Seconds())
 	}
+
+	if m.ContextRemaining != nil {
+		fmt.Fprintf(os.Stderr, "context remaining:    %d token(s)\n", *m.ContextRemaining)
+	}
+}
+
+// ContextSize is the size of the context window, it is only known from the final response
+func (m *Metrics) ContextSize() int {
+	if m.ContextRemaining == nil {
+		return 0
+	}
+
+	return m.PromptEvalCount + m.EvalCount + *m.ContextRemaining
 }
 
 var ErrInvalidOpts = fmt.Errorf("invalid options")
 
+// FromMap sets the options in m, every unknown option or value of the wrong type is reported in the error
 func (opts *Options) FromMap(m map[string]interface{}) error {
 	valueOpts := reflect.ValueOf(opts).Elem() // names of the fields in the options struct
 	typeOpts := reflect.TypeOf(opts).Elem()   // types of the fields in the options struct
@@ -266,67 +1076,101 @@ func (opts *Options) FromMap(m map[string]interface{}) error {
 		}
 	}
 
-	invalidOpts := []string{}
-	for key, val := range m {
-		if opt, ok := jsonOpts[key]; ok {
-			field := valueOpts.FieldByName(opt.Name)
-			if field.IsValid() && field.CanSet() {
-				if val == nil {
+	// report the options in a stable order
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var invalidOpts []string
+	for _, key := range keys {
+		val := m[key]
+		opt, ok := jsonOpts[key]
+		if !ok {
+			if suggestion := closestOption(key, jsonOpts); suggestion != "" {
+				invalidOpts = append(invalidOpts, fmt.Sprintf("unknown option %q (did you mean %q?)", key, suggestion))
+			} else {
+				invalidOpts = append(invalidOpts, fmt.Sprintf("unknown option %q", key))
+			}
+			continue
+		}
+
+		field := valueOpts.FieldByName(opt.Name)
+		if !field.IsValid() || !field.CanSet() || val == nil {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.Int:
+			switch t := val.(type) {
+			case int:
+				field.SetInt(int64(t))
+			case int64:
+				field.SetInt(t)
+			case float64:
+				// when JSON unmarshals numbers, it uses float64, not int
+				if t != float64(int64(t)) {
+					invalidOpts = append(invalidOpts, fmt.Sprintf("option %q must be an integer", key))
 					continue
 				}
-
-				switch field.Kind() {
-				case reflect.Int:
-					switch t := val.(type) {
-					case int64:
-						field.SetInt(t)
-					case float64:
-						// when JSON unmarshals numbers, it uses float64, not int
-						field.SetInt(int64(t))
-					default:
-						return fmt.Errorf("option %q must be of type integer", key)
-					}
-				case reflect.Bool:
-					val, ok := val.(bool)
-					if !ok {
-						return fmt.Errorf("option %q must be of type boolean", key)
-					}
-					field.SetBool(val)
-				case reflect.Float32:
-					// JSON unmarshals to float64
-					val, ok := val.(float64)
-					if !ok {
-						return fmt.Errorf("option %q must be of type float32", key)
-					}
-					field.SetFloat(val)
-				case reflect.String:
-					val, ok := val.(string)
-					if !ok {
-						return fmt.Errorf("option %q must be of type string", key)
-					}
-					field.SetString(val)
-				case reflect.Slice:
-					// JSON unmarshals to []interface{}, not []string
-					val, ok := val.([]interface{})
+				field.SetInt(int64(t))
+			default:
+				invalidOpts = append(invalidOpts, fmt.Sprintf("option %q must be an integer", key))
+			}
+		case reflect.Bool:
+			val, ok := val.(bool)
+			if !ok {
+				invalidOpts = append(invalidOpts, fmt.Sprintf("option %q must be a boolean", key))
+				continue
+			}
+			field.SetBool(val)
+		case reflect.Float32:
+			switch t := val.(type) {
+			case float64:
+				// JSON unmarshals to float64
+				field.SetFloat(t)
+			case float32:
+				field.SetFloat(float64(t))
+			case int:
+				field.SetFloat(float64(t))
+			case int64:
+				field.SetFloat(float64(t))
+			default:
+				invalidOpts = append(invalidOpts, fmt.Sprintf("option %q must be a number", key))
+			}
+		case reflect.String:
+			val, ok := val.(string)
+			if !ok {
+				invalidOpts = append(invalidOpts, fmt.Sprintf("option %q must be a string", key))
+				continue
+			}
+			field.SetString(val)
+		case reflect.Slice:
+			var slice []string
+			switch t := val.(type) {
+			case []string:
+				slice = t
+			case []interface{}:
+				// JSON unmarshals to []interface{}, not []string
+				slice = make([]string, len(t))
+				for i, item := range t {
+					str, ok := item.(string)
 					if !ok {
-						return fmt.Errorf("option %q must be of type array", key)
-					}
-					// convert []interface{} to []string
-					slice := make([]string, len(val))
-					for i, item := range val {
-						str, ok := item.(string)
-						if !ok {
-							return fmt.Errorf("option %q must be of an array of strings", key)
-						}
-						slice[i] = str
+						slice = nil
+						break
 					}
-					field.Set(reflect.ValueOf(slice))
-				default:
-					return fmt.Errorf("unknown type loading config params: %v", field.Kind())
+					slice[i] = str
 				}
 			}
-		} else {
-			invalidOpts = append(invalidOpts, key)
+
+			if slice == nil {
+				invalidOpts = append(invalidOpts, fmt.Sprintf("option %q must be an array of strings", key))
+				continue
+			}
+			field.Set(reflect.ValueOf(slice))
+		default:
+			return fmt.Errorf("unknown type loading config params: %v", field.Kind())
 		}
 	}
 
@@ -336,6 +1180,98 @@ func (opts *Options) FromMap(m map[string]interface{}) error {
 	return nil
 }
 
+// closestOption suggests the option a misspelled key was probably meant to be
+func closestOption(key string, options map[string]reflect.StructField) string {
+	best, bestDistance := "", 3
+	for name := range options {
+		if d := editDistance(key, name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// Validate checks the options are within the ranges the runner accepts, every offending option is
+// reported in the error
+func (opts *Options) Validate() error {
+	var invalidOpts []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			invalidOpts = append(invalidOpts, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(opts.NumCtx > 0, "num_ctx must be greater than 0, got %d", opts.NumCtx)
+	check(opts.NumBatch > 0, "num_batch must be greater than 0, got %d", opts.NumBatch)
+	check(opts.NumThread >= 0, "num_thread must not be negative, got %d", opts.NumThread)
+	check(opts.NumKeep >= -1, "num_keep must be -1 or greater, got %d", opts.NumKeep)
+	check(opts.NumPredict >= -2, "num_predict must be -2 or greater, got %d", opts.NumPredict)
+	check(opts.NumPredictChars >= 0, "num_predict_chars must not be negative, got %d", opts.NumPredictChars)
+	check(opts.TopK >= 0, "top_k must not be negative, got %d", opts.TopK)
+	check(opts.TopP >= 0 && opts.TopP <= 1, "top_p must be between 0 and 1, got %g", opts.TopP)
+	check(opts.TFSZ >= 0, "tfs_z must not be negative, got %g", opts.TFSZ)
+	check(opts.TypicalP >= 0 && opts.TypicalP <= 1, "typical_p must be between 0 and 1, got %g", opts.TypicalP)
+	check(opts.RepeatLastN >= -1, "repeat_last_n must be -1 or greater, got %d", opts.RepeatLastN)
+	check(opts.Temperature >= 0, "temperature must not be negative, got %g", opts.Temperature)
+	check(opts.RepeatPenalty >= 0, "repeat_penalty must not be negative, got %g", opts.RepeatPenalty)
+	check(opts.Mirostat >= 0 && opts.Mirostat <= 2, "mirostat must be 0, 1 or 2, got %d", opts.Mirostat)
+	check(opts.MirostatTau >= 0, "mirostat_tau must not be negative, got %g", opts.MirostatTau)
+	check(opts.MirostatEta >= 0, "mirostat_eta must not be negative, got %g", opts.MirostatEta)
+
+	if len(invalidOpts) > 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidOpts, strings.Join(invalidOpts, ", "))
+	}
+	return nil
+}
+
+// Map returns every option keyed by its name, including options with zero values
+func (opts *Options) Map() map[string]interface{} {
+	valueOpts := reflect.ValueOf(opts).Elem()
+
+	m := make(map[string]interface{})
+	for _, field := range reflect.VisibleFields(valueOpts.Type()) {
+		jsonTag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if jsonTag == "" || jsonTag == "-" || field.Anonymous {
+			continue
+		}
+
+		m[jsonTag] = valueOpts.FieldByIndex(field.Index).Interface()
+	}
+
+	return m
+}
+
 func DefaultOptions() Options {
 	return Options{
 		// options set on request to runner
@@ -422,44 +1358,137 @@ func FormatParams(params map[string][]string) (map[string]interface{}, error) {
 	out := make(map[string]interface{})
 	// iterate params and set values based on json struct tags
 	for key, vals := range params {
-		if opt, ok := jsonOpts[key]; !ok {
+		opt, ok := jsonOpts[key]
+		if !ok {
+			if suggestion := closestOption(key, jsonOpts); suggestion != "" {
+				return nil, fmt.Errorf("unknown parameter '%s', did you mean '%s'?", key, suggestion)
+			}
 			return nil, fmt.Errorf("unknown parameter '%s'", key)
-		} else {
-			field := valueOpts.FieldByName(opt.Name)
-			if field.IsValid() && field.CanSet() {
-				switch field.Kind() {
-				case reflect.Float32:
-					floatVal, err := strconv.ParseFloat(vals[0], 32)
-					if err != nil {
-						return nil, fmt.Errorf("invalid float value %s", vals)
-					}
+		}
 
-					out[key] = float32(floatVal)
-				case reflect.Int:
-					intVal, err := strconv.ParseInt(vals[0], 10, 64)
-					if err != nil {
-						return nil, fmt.Errorf("invalid int value %s", vals)
-					}
+		field := valueOpts.FieldByName(opt.Name)
+		if !field.IsValid() || !field.CanSet() {
+			continue
+		}
 
-					out[key] = intVal
-				case reflect.Bool:
-					boolVal, err := strconv.ParseBool(vals[0])
-					if err != nil {
-						return nil, fmt.Errorf("invalid bool value %s", vals)
-					}
+		if len(vals) == 0 {
+			return nil, fmt.Errorf("missing value for parameter '%s'", key)
+		}
 
-					out[key] = boolVal
-				case reflect.String:
-					out[key] = vals[0]
-				case reflect.Slice:
-					// TODO: only string slices are supported right now
-					out[key] = vals
-				default:
-					return nil, fmt.Errorf("unknown type %s for %s", field.Kind(), key)
+		if field.Kind() != reflect.Slice && len(vals) > 1 {
+			return nil, fmt.Errorf("parameter '%s' takes a single value, got %d", key, len(vals))
+		}
+
+		switch field.Kind() {
+		case reflect.Float32:
+			floatVal, err := strconv.ParseFloat(vals[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value '%s' for parameter '%s', expected a number", vals[0], key)
+			}
+
+			out[key] = floatVal
+		case reflect.Int:
+			intVal, err := strconv.Atoi(vals[0])
+			if err != nil {
+				// accept whole numbers written as floats, e.g. 4096.0
+				floatVal, ferr := strconv.ParseFloat(vals[0], 64)
+				if ferr != nil || floatVal != math.Trunc(floatVal) {
+					return nil, fmt.Errorf("invalid value '%s' for parameter '%s', expected an integer", vals[0], key)
 				}
+
+				intVal = int(floatVal)
 			}
+
+			out[key] = intVal
+		case reflect.Bool:
+			boolVal, err := parseBool(vals[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value '%s' for parameter '%s', expected true or false", vals[0], key)
+			}
+
+			out[key] = boolVal
+		case reflect.String:
+			out[key] = vals[0]
+		case reflect.Slice:
+			// TODO: only string slices are supported right now
+			out[key] = vals
+		default:
+			return nil, fmt.Errorf("unknown type %s for %s", field.Kind(), key)
 		}
 	}
 
 	return out, nil
 }
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	default:
+		return strconv.ParseBool(s)
+	}
+}
+
+// SplitParamValues splits the values of a parameter set on a single line, e.g. for the stop parameter
+//
+//	"<|im_end|>", "### User:" ok
+//
+// returns the values <|im_end|>, ### User: and ok. Values are separated by spaces or commas and may be
+// quoted to include either. Double quoted values support the escapes of Go string literals such as \n.
+func SplitParamValues(s string) ([]string, error) {
+	var values []string
+	var sb strings.Builder
+	inValue := false
+
+	flush := func() {
+		if inValue {
+			values = append(values, sb.String())
+		}
+		sb.Reset()
+		inValue = false
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == ',':
+			flush()
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated quote in %s", s)
+			}
+
+			unquoted, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value %s", s[i:end+1])
+			}
+
+			sb.WriteString(unquoted)
+			inValue = true
+			i = end
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %s", s)
+			}
+
+			sb.WriteString(s[i+1 : i+1+end])
+			inValue = true
+			i += end + 1
+		default:
+			sb.WriteByte(c)
+			inValue = true
+		}
+	}
+
+	flush()
+	return values, nil
+}
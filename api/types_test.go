@@ -0,0 +1,100 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsMap(t *testing.T) {
+	opts := DefaultOptions()
+	require.NoError(t, opts.FromMap(map[string]interface{}{"temperature": 0.0, "num_ctx": 4096.0, "stop": []interface{}{"a"}}))
+
+	m := opts.Map()
+	// zero values are included so it is clear which value applied
+	assert.Equal(t, float32(0), m["temperature"])
+	assert.Equal(t, 4096, m["num_ctx"])
+	assert.Equal(t, []string{"a"}, m["stop"])
+	assert.Equal(t, 40, m["top_k"])
+	assert.NotContains(t, m, "Runner")
+}
+
+func TestOptionsFromMapErrors(t *testing.T) {
+	opts := DefaultOptions()
+	err := opts.FromMap(map[string]interface{}{
+		"temprature": 0.5,
+		"top_k":      "ten",
+		"seed":       1.5,
+		"foo":        1,
+	})
+
+	require.ErrorIs(t, err, ErrInvalidOpts)
+	assert.Equal(t, `invalid options: unknown option "foo", option "seed" must be an integer, unknown option "temprature" (did you mean "temperature"?), option "top_k" must be an integer`, err.Error())
+}
+
+func TestOptionsValidate(t *testing.T) {
+	opts := DefaultOptions()
+	require.NoError(t, opts.Validate())
+
+	opts.Temperature = -1
+	opts.TopP = 1.5
+	opts.NumCtx = 0
+	opts.NumPredictChars = -1
+
+	err := opts.Validate()
+	require.ErrorIs(t, err, ErrInvalidOpts)
+	assert.Contains(t, err.Error(), "num_ctx must be greater than 0, got 0")
+	assert.Contains(t, err.Error(), "top_p must be between 0 and 1, got 1.5")
+	assert.Contains(t, err.Error(), "temperature must not be negative, got -1")
+	assert.Contains(t, err.Error(), "num_predict_chars must not be negative, got -1")
+}
+
+func TestFormatParams(t *testing.T) {
+	out, err := FormatParams(map[string][]string{
+		"temperature":      {"1"},
+		"num_ctx":          {"4096.0"},
+		"penalize_newline": {"off"},
+		"stop":             {"<|im_end|>", "### User:"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"temperature":      1.0,
+		"num_ctx":          4096,
+		"penalize_newline": false,
+		"stop":             []string{"<|im_end|>", "### User:"},
+	}, out)
+
+	_, err = FormatParams(map[string][]string{"top_k": {"0.5"}})
+	assert.EqualError(t, err, "invalid value '0.5' for parameter 'top_k', expected an integer")
+
+	_, err = FormatParams(map[string][]string{"temperature": {"0.1", "0.2"}})
+	assert.EqualError(t, err, "parameter 'temperature' takes a single value, got 2")
+
+	_, err = FormatParams(map[string][]string{"temprature": {"0.1"}})
+	assert.EqualError(t, err, "unknown parameter 'temprature', did you mean 'temperature'?")
+}
+
+func TestSplitParamValues(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected []string
+	}{
+		{`0.5`, []string{"0.5"}},
+		{`a b`, []string{"a", "b"}},
+		{`"<|im_end|>", "### User:"`, []string{"<|im_end|>", "### User:"}},
+		{`'single  quoted',","`, []string{"single  quoted", ","}},
+		{`"\n\nUser:" end`, []string{"\n\nUser:", "end"}},
+		{`"say \"hi\""`, []string{`say "hi"`}},
+		{`""`, []string{""}},
+	}
+
+	for _, c := range cases {
+		values, err := SplitParamValues(c.in)
+		require.NoError(t, err, c.in)
+		assert.Equal(t, c.expected, values, c.in)
+	}
+
+	_, err := SplitParamValues(`"unterminated`)
+	assert.Error(t, err)
+}
@@ -24,7 +24,7 @@ const logger = winston.createLogger({
   transports: [
     new winston.transports.Console(),
     new winston.transports.File({
-      filename: path.join(app.getPath('home'), '.ollama', 'logs', 'server.log'),
+      filename: path.join(app.getPath('home'), '.ollama', 'logs', 'app.log'),
       maxsize: 1024 * 1024 * 20,
       maxFiles: 5,
     }),
@@ -140,12 +140,13 @@ function server() {
 
   proc = spawn(binary, ['serve'])
 
+  // the server writes its own log to ~/.ollama/logs/server.log
   proc.stdout.on('data', data => {
-    logger.info(data.toString().trim())
+    console.log(data.toString().trim())
   })
 
   proc.stderr.on('data', data => {
-    logger.error(data.toString().trim())
+    console.error(data.toString().trim())
   })
 
   proc.on('exit', restart)
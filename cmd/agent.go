@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmorganca/ollama/format"
+)
+
+const (
+	// agentMaxSteps limits the number of tool calls made for a single prompt
+	agentMaxSteps = 10
+	// agentMaxOutput truncates tool results so they fit in the context window
+	agentMaxOutput = 16 * format.KiloByte
+	agentTimeout   = 30 * time.Second
+)
+
+// defaultAgentCommands are the programs the shell tool may run unless --agent-allow is set
+var defaultAgentCommands = []string{"ls", "pwd", "date", "echo", "cat", "head", "tail", "wc", "grep"}
+
+const agentInstructions = `You can use the following tools to help answer the user:
+
+- shell: run a command, e.g. {"tool": "shell", "arguments": {"command": "ls -la"}}. Commands are not run by a shell so pipes and redirects are not supported. Allowed commands: %s.
+- http_get: fetch a URL, e.g. {"tool": "http_get", "arguments": {"url": "https://example.com"}}
+- read_file: read a local file, e.g. {"tool": "read_file", "arguments": {"path": "README.md"}}
+
+To use a tool reply with only the JSON object for the tool call and nothing else. The result will be sent back to you. When you have enough information, reply to the user normally.`
+
+// agentToolCall is a tool call made by the model in its response
+type agentToolCall struct {
+	Tool      string         `json:"tool"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// arg returns a string argument, or an empty string if it is missing
+func (t agentToolCall) arg(name string) string {
+	s, _ := t.Arguments[name].(string)
+	return s
+}
+
+func (t agentToolCall) String() string {
+	switch t.Tool {
+	case "shell":
+		return fmt.Sprintf("run '%s'", t.arg("command"))
+	case "http_get":
+		return fmt.Sprintf("fetch '%s'", t.arg("url"))
+	case "read_file":
+		return fmt.Sprintf("read '%s'", t.arg("path"))
+	default:
+		bts, _ := json.Marshal(t.Arguments)
+		return fmt.Sprintf("call '%s' with %s", t.Tool, bts)
+	}
+}
+
+// agent executes the tool calls a model makes in interactive agent mode
+type agent struct {
+	// allowed are the programs the shell tool may run
+	allowed []string
+
+	// confirm asks the user before each tool call is executed
+	confirm func(question string) bool
+
+	// mcp are the MCP servers providing additional tools
+	mcp []*mcpClient
+}
+
+// newAgent starts the configured MCP servers, the agent must be closed to stop them
+func newAgent(ctx context.Context, allowed []string, confirm func(string) bool) (*agent, error) {
+	config, err := loadMCPConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	mcp, err := startMCPServers(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &agent{allowed: allowed, confirm: confirm, mcp: mcp}, nil
+}
+
+func (a *agent) Close() {
+	for _, c := range a.mcp {
+		c.Close()
+	}
+}
+
+// mcpTool finds the MCP server for a tool named "<server>.<tool>"
+func (a *agent) mcpTool(name string) (*mcpClient, string, bool) {
+	server, tool, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, "", false
+	}
+
+	for _, c := range a.mcp {
+		if c.name == server {
+			return c, tool, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// System adds the tool instructions to the system message
+func (a *agent) System(system string) string {
+	instructions := fmt.Sprintf(agentInstructions, strings.Join(a.allowed, ", "))
+	if len(a.mcp) > 0 {
+		var sb strings.Builder
+		sb.WriteString("\n\nThe following tools are also available, call them the same way with arguments matching their JSON schema:\n")
+		for _, c := range a.mcp {
+			for _, tool := range c.tools {
+				fmt.Fprintf(&sb, "\n- %s.%s: %s", c.name, tool.Name, tool.Description)
+				if len(tool.InputSchema) > 0 {
+					fmt.Fprintf(&sb, " (arguments: %s)", tool.InputSchema)
+				}
+			}
+		}
+
+		instructions += sb.String()
+	}
+
+	if system == "" {
+		return instructions
+	}
+
+	return system + "\n\n" + instructions
+}
+
+// parseAgentToolCall returns the tool call in response, if the response is a tool call
+func parseAgentToolCall(response string) (*agentToolCall, bool) {
+	response = strings.TrimSpace(response)
+	// models often wrap the call in a code block
+	response = strings.TrimPrefix(response, "```json")
+	response = strings.TrimPrefix(response, "```")
+	response = strings.TrimSuffix(response, "```")
+	response = strings.TrimSpace(response)
+
+	if !strings.HasPrefix(response, "{") {
+		return nil, false
+	}
+
+	var call agentToolCall
+	if err := json.Unmarshal([]byte(response), &call); err != nil || call.Tool == "" {
+		return nil, false
+	}
+
+	return &call, true
+}
+
+// Execute runs the tool call once the user confirms it, the result is returned as the next prompt
+func (a *agent) Execute(ctx context.Context, call *agentToolCall) string {
+	if !a.confirm(fmt.Sprintf("Allow the model to %s?", call)) {
+		return fmt.Sprintf("The user declined the %s tool call. Answer without it or ask the user how to proceed.", call.Tool)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, agentTimeout)
+	defer cancel()
+
+	var result string
+	var err error
+	switch call.Tool {
+	case "shell":
+		result, err = a.shell(ctx, call.arg("command"))
+	case "http_get":
+		result, err = httpGetTool(ctx, call.arg("url"))
+	case "read_file":
+		result, err = readFileTool(call.arg("path"))
+	default:
+		if c, tool, ok := a.mcpTool(call.Tool); ok {
+			result, err = c.CallTool(ctx, tool, call.Arguments)
+		} else {
+			err = fmt.Errorf("unknown tool '%s'", call.Tool)
+		}
+	}
+
+	if err != nil {
+		return fmt.Sprintf("The %s tool call failed: %v", call.Tool, err)
+	}
+
+	if len(result) > agentMaxOutput {
+		result = result[:agentMaxOutput] + "\n[output truncated]"
+	}
+
+	return fmt.Sprintf("Result of the %s tool call:\n```\n%s\n```", call.Tool, strings.TrimRight(result, "\n"))
+}
+
+func (a *agent) shell(ctx context.Context, command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("command is required")
+	}
+
+	allowed := false
+	for _, name := range a.allowed {
+		if args[0] == name {
+			allowed = true
+			break
+		}
+	}
+
+	if !allowed {
+		return "", fmt.Errorf("'%s' is not an allowed command, allowed commands are: %s", args[0], strings.Join(a.allowed, ", "))
+	}
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w\n%s", err, out.String())
+	}
+
+	return out.String(), nil
+}
+
+func httpGetTool(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	bts, err := io.ReadAll(io.LimitReader(resp.Body, agentMaxOutput+1))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("%s: %s", resp.Status, bts)
+	}
+
+	return string(bts), nil
+}
+
+func readFileTool(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	bts, err := io.ReadAll(io.LimitReader(f, agentMaxOutput+1))
+	if err != nil {
+		return "", err
+	}
+
+	return string(bts), nil
+}
+
+// Run generates a response to opts.Prompt, executing tool calls and sending their results back
+// to the model until it replies without one
+func (a *agent) Run(cmd *cobra.Command, opts generateOptions) error {
+	opts.System = a.System(opts.System)
+	for i := 0; i < agentMaxSteps; i++ {
+		if err := generate(cmd, opts); err != nil {
+			return err
+		}
+
+		response, _ := cmd.Context().Value(generateContextKey("response")).(string)
+		call, ok := parseAgentToolCall(response)
+		if !ok {
+			return nil
+		}
+
+		opts.Prompt = a.Execute(cmd.Context(), call)
+		opts.Typed = ""
+		opts.Images = nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Stopped after %d tool calls.\n\n", agentMaxSteps)
+	return nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAgentToolCall(t *testing.T) {
+	call, ok := parseAgentToolCall("```json\n{\"tool\": \"shell\", \"arguments\": {\"command\": \"ls\"}}\n```")
+	require.True(t, ok)
+	assert.Equal(t, "shell", call.Tool)
+	assert.Equal(t, "ls", call.arg("command"))
+	assert.Equal(t, "run 'ls'", call.String())
+
+	for _, response := range []string{"The answer is 4.", `{"arguments": {}}`, `{"tool": "shell"`} {
+		_, ok := parseAgentToolCall(response)
+		assert.False(t, ok, response)
+	}
+}
+
+func TestAgentExecute(t *testing.T) {
+	var questions []string
+	confirmed := true
+	a := &agent{
+		allowed: []string{"echo"},
+		confirm: func(question string) bool {
+			questions = append(questions, question)
+			return confirmed
+		},
+	}
+
+	if runtime.GOOS != "windows" {
+		out := a.Execute(context.Background(), &agentToolCall{Tool: "shell", Arguments: map[string]any{"command": "echo hi"}})
+		assert.Equal(t, "Result of the shell tool call:\n```\nhi\n```", out)
+		assert.Equal(t, []string{"Allow the model to run 'echo hi'?"}, questions)
+	}
+
+	// only the allowed programs run
+	out := a.Execute(context.Background(), &agentToolCall{Tool: "shell", Arguments: map[string]any{"command": "rm -rf /"}})
+	assert.Equal(t, "The shell tool call failed: 'rm' is not an allowed command, allowed commands are: echo", out)
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("remember the milk\n"), 0o644))
+	out = a.Execute(context.Background(), &agentToolCall{Tool: "read_file", Arguments: map[string]any{"path": path}})
+	assert.Equal(t, "Result of the read_file tool call:\n```\nremember the milk\n```", out)
+
+	out = a.Execute(context.Background(), &agentToolCall{Tool: "missing"})
+	assert.Equal(t, "The missing tool call failed: unknown tool 'missing'", out)
+
+	out = a.Execute(context.Background(), &agentToolCall{Tool: "http_get", Arguments: map[string]any{"url": "file:///etc/passwd"}})
+	assert.Equal(t, "The http_get tool call failed: unsupported scheme 'file'", out)
+
+	// a declined call isn't run
+	confirmed = false
+	out = a.Execute(context.Background(), &agentToolCall{Tool: "read_file", Arguments: map[string]any{"path": path}})
+	assert.Equal(t, "The user declined the read_file tool call. Answer without it or ask the user how to proceed.", out)
+}
+
+func TestAgentMCPTools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.json")
+	t.Setenv("OLLAMA_MCP_CONFIG", path)
+	bts, err := json.Marshal(mcpConfig{Servers: map[string]mcpServerConfig{"helper": helperMCPServer("tools")}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, bts, 0o644))
+
+	a, err := newAgent(context.Background(), []string{"ls"}, func(string) bool { return true })
+	require.NoError(t, err)
+	defer a.Close()
+
+	system := a.System("Be brief.")
+	assert.Contains(t, system, "Be brief.\n\nYou can use the following tools")
+	assert.Contains(t, system, `- helper.echo: Echo the text (arguments: {"type":"object"})`)
+
+	out := a.Execute(context.Background(), &agentToolCall{Tool: "helper.echo", Arguments: map[string]any{"text": "hello"}})
+	assert.Equal(t, "Result of the helper.echo tool call:\n```\nhello\n```", out)
+
+	out = a.Execute(context.Background(), &agentToolCall{Tool: "helper.fail"})
+	assert.Equal(t, "The helper.fail tool call failed: it failed", out)
+
+	out = a.Execute(context.Background(), &agentToolCall{Tool: "other.echo"})
+	assert.Equal(t, "The other.echo tool call failed: unknown tool 'other.echo'", out)
+
+	// a closed agent has stopped its servers, closing it again is harmless
+	a.Close()
+	assert.NotNil(t, a.mcp[0].cmd.ProcessState)
+
+	out = a.Execute(context.Background(), &agentToolCall{Tool: "helper.echo", Arguments: map[string]any{"text": "hello"}})
+	assert.Contains(t, out, "The helper.echo tool call failed")
+}
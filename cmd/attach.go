@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+const (
+	attachChunkSize   = 256
+	attachOverlap     = 32
+	attachNumRetrieve = 3
+)
+
+type attachedChunk struct {
+	source    string
+	text      string
+	embedding []float64
+}
+
+// attachments indexes documents attached in interactive mode so the chunks most
+// relevant to each prompt can be added to it
+type attachments struct {
+	// model generates the embeddings, it defaults to the model being run
+	model string
+
+	files  []string
+	chunks []attachedChunk
+}
+
+// extractText reads the text of a document, PDFs are converted with pdftotext from poppler
+func extractText(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		if _, err := exec.LookPath("pdftotext"); err != nil {
+			return "", errors.New("attaching PDFs requires pdftotext, install poppler to use it")
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("pdftotext", "-enc", "UTF-8", path, "-")
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("pdftotext: %s", strings.TrimSpace(stderr.String()))
+		}
+
+		return stdout.String(), nil
+	case ".txt", ".md", ".markdown", "":
+		bts, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		return string(bts), nil
+	default:
+		return "", fmt.Errorf("unsupported file type '%s', attach .pdf, .md or .txt files", filepath.Ext(path))
+	}
+}
+
+// Attach chunks and embeds the document at path
+func (a *attachments) Attach(ctx context.Context, client *api.Client, path string) (int, error) {
+	text, err := extractText(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return 0, fmt.Errorf("no text found in '%s'", path)
+	}
+
+	chunked, err := client.Chunk(ctx, &api.ChunkRequest{
+		Model:     a.model,
+		Text:      text,
+		ChunkSize: attachChunkSize,
+		Overlap:   attachOverlap,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var chunks []attachedChunk
+	for _, chunk := range chunked.Chunks {
+		resp, err := client.Embeddings(ctx, &api.EmbeddingRequest{Model: a.model, Prompt: chunk.Text, Normalize: true})
+		if err != nil {
+			return 0, err
+		}
+
+		chunks = append(chunks, attachedChunk{source: filepath.Base(path), text: chunk.Text, embedding: resp.Embedding})
+	}
+
+	a.files = append(a.files, path)
+	a.chunks = append(a.chunks, chunks...)
+	return len(chunks), nil
+}
+
+// Retrieve returns the attached chunks most similar to the prompt
+func (a *attachments) Retrieve(ctx context.Context, client *api.Client, prompt string, n int) ([]attachedChunk, error) {
+	if len(a.chunks) == 0 {
+		return nil, nil
+	}
+
+	resp, err := client.Embeddings(ctx, &api.EmbeddingRequest{Model: a.model, Prompt: prompt, Normalize: true})
+	if err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		chunk attachedChunk
+		score float64
+	}
+
+	results := make([]scored, len(a.chunks))
+	for i, chunk := range a.chunks {
+		results[i] = scored{chunk, cosineSimilarity(resp.Embedding, chunk.embedding)}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	if n > len(results) {
+		n = len(results)
+	}
+
+	chunks := make([]attachedChunk, n)
+	for i := range chunks {
+		chunks[i] = results[i].chunk
+	}
+
+	return chunks, nil
+}
+
+// Prompt adds the chunks most relevant to prompt ahead of it
+func (a *attachments) Prompt(ctx context.Context, client *api.Client, prompt string) (string, error) {
+	chunks, err := a.Retrieve(ctx, client, prompt, attachNumRetrieve)
+	if err != nil || len(chunks) == 0 {
+		return prompt, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Use the following excerpts from the attached documents to answer the question.\n\n")
+	for _, chunk := range chunks {
+		fmt.Fprintf(&sb, "Excerpt from %s:\n%s\n\n", chunk.source, strings.TrimSpace(chunk.text))
+	}
+
+	sb.WriteString("Question: ")
+	sb.WriteString(prompt)
+	return sb.String(), nil
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
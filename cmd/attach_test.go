@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// attachServer chunks text by paragraph and embeds it by how often it mentions each of a few topics
+func attachServer(t *testing.T) *[]string {
+	t.Helper()
+
+	topics := []string{"cats", "dogs", "fish"}
+
+	var models []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chunk":
+			var req api.ChunkRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			models = append(models, req.Model)
+
+			var resp api.ChunkResponse
+			for _, paragraph := range strings.Split(req.Text, "\n\n") {
+				if strings.TrimSpace(paragraph) != "" {
+					resp.Chunks = append(resp.Chunks, api.Chunk{Text: paragraph})
+				}
+			}
+
+			json.NewEncoder(w).Encode(resp)
+		case "/api/embeddings":
+			var req api.EmbeddingRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			models = append(models, req.Model)
+
+			var resp api.EmbeddingResponse
+			for _, topic := range topics {
+				resp.Embedding = append(resp.Embedding, float64(strings.Count(strings.ToLower(req.Prompt), topic)))
+			}
+
+			json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+
+	return &models
+}
+
+func TestAttach(t *testing.T) {
+	models := attachServer(t)
+
+	client, err := api.ClientFromEnvironment()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	pets := filepath.Join(dir, "pets.md")
+	require.NoError(t, os.WriteFile(pets, []byte("Cats sleep most of the day, cats purr.\n\nDogs need walks.\n\nFish need clean water, feed fish daily."), 0o644))
+
+	ctx := context.Background()
+	a := &attachments{model: "nomic-embed-text"}
+
+	// nothing is added to prompts until a document is attached
+	prompt, err := a.Prompt(ctx, client, "How often do I feed fish?")
+	require.NoError(t, err)
+	assert.Equal(t, "How often do I feed fish?", prompt)
+
+	n, err := a.Attach(ctx, client, pets)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{pets}, a.files)
+
+	chunks, err := a.Retrieve(ctx, client, "what about fish?", 1)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "pets.md", chunks[0].source)
+	assert.Equal(t, "Fish need clean water, feed fish daily.", chunks[0].text)
+
+	// there are fewer chunks than asked for
+	chunks, err = a.Retrieve(ctx, client, "cats", 10)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "Cats sleep most of the day, cats purr.", chunks[0].text)
+
+	prompt, err = a.Prompt(ctx, client, "Do dogs purr?")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(prompt, "Use the following excerpts from the attached documents to answer the question.\n\nExcerpt from pets.md:\n"), prompt)
+	assert.True(t, strings.HasSuffix(prompt, "\n\nQuestion: Do dogs purr?"), prompt)
+	assert.Contains(t, prompt, "Dogs need walks.")
+
+	// the documents are chunked and embedded with the embedding model, not the chat model
+	for _, model := range *models {
+		assert.Equal(t, "nomic-embed-text", model)
+	}
+}
+
+func TestAttachErrors(t *testing.T) {
+	attachServer(t)
+
+	client, err := api.ClientFromEnvironment()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	a := &attachments{model: "nomic-embed-text"}
+
+	empty := filepath.Join(dir, "empty.txt")
+	require.NoError(t, os.WriteFile(empty, []byte(" \n\n"), 0o644))
+	_, err = a.Attach(context.Background(), client, empty)
+	assert.ErrorContains(t, err, "no text found")
+
+	sheet := filepath.Join(dir, "sheet.xlsx")
+	require.NoError(t, os.WriteFile(sheet, []byte("PK"), 0o644))
+	_, err = a.Attach(context.Background(), client, sheet)
+	assert.ErrorContains(t, err, "unsupported file type '.xlsx'")
+
+	_, err = a.Attach(context.Background(), client, filepath.Join(dir, "missing.md"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// failed attachments aren't listed
+	assert.Empty(t, a.files)
+	assert.Empty(t, a.chunks)
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1, cosineSimilarity([]float64{1, 2, 3}, []float64{2, 4, 6}), 1e-9)
+	assert.InDelta(t, 0, cosineSimilarity([]float64{1, 0}, []float64{0, 1}), 1e-9)
+	assert.InDelta(t, -1, cosineSimilarity([]float64{1, 1}, []float64{-1, -1}), 1e-9)
+
+	// embeddings from different models, or of nothing, aren't similar
+	assert.Zero(t, cosineSimilarity([]float64{1, 2}, []float64{1, 2, 3}))
+	assert.Zero(t, cosineSimilarity([]float64{0, 0}, []float64{1, 2}))
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+// conversationBranch is a snapshot of an interactive conversation
+type conversationBranch struct {
+	context  []int
+	images   []ImageData
+	messages []transcriptMessage
+}
+
+// conversationBranches tracks named snapshots of the interactive conversation so
+// alternative continuations can be explored without losing earlier ones
+type conversationBranches struct {
+	current  string
+	branches map[string]conversationBranch
+}
+
+func newConversationBranches() *conversationBranches {
+	return &conversationBranches{
+		current:  "main",
+		branches: map[string]conversationBranch{"main": {}},
+	}
+}
+
+// save snapshots the current conversation into the active branch
+func (b *conversationBranches) save(cmd *cobra.Command, opts *generateOptions) {
+	generateContext, _ := cmd.Context().Value(generateContextKey("context")).([]int)
+	branch := conversationBranch{
+		context: slices.Clone(generateContext),
+		images:  slices.Clone(opts.Images),
+	}
+	if opts.Transcript != nil {
+		branch.messages = slices.Clone(opts.Transcript.Messages)
+	}
+	b.branches[b.current] = branch
+}
+
+// restore replaces the current conversation with the named branch
+func (b *conversationBranches) restore(cmd *cobra.Command, name string, opts *generateOptions) {
+	branch := b.branches[name]
+	ctx := context.WithValue(cmd.Context(), generateContextKey("context"), slices.Clone(branch.context))
+	cmd.SetContext(ctx)
+	opts.Images = slices.Clone(branch.images)
+	if opts.Transcript != nil {
+		opts.Transcript.Messages = slices.Clone(branch.messages)
+	}
+	b.current = name
+}
+
+func (b *conversationBranches) Fork(cmd *cobra.Command, name string, opts *generateOptions) error {
+	if _, ok := b.branches[name]; ok {
+		return fmt.Errorf("branch '%s' already exists", name)
+	}
+
+	b.save(cmd, opts)
+	b.branches[name] = b.branches[b.current]
+	b.restore(cmd, name, opts)
+	return nil
+}
+
+func (b *conversationBranches) Switch(cmd *cobra.Command, name string, opts *generateOptions) error {
+	if _, ok := b.branches[name]; !ok {
+		return fmt.Errorf("branch '%s' not found", name)
+	}
+
+	b.save(cmd, opts)
+	b.restore(cmd, name, opts)
+	return nil
+}
+
+// List writes the names of the branches, marking the current one
+func (b *conversationBranches) List(w io.Writer) {
+	names := make([]string, 0, len(b.branches))
+	for name := range b.branches {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		marker := " "
+		if name == b.current {
+			marker = "*"
+		}
+
+		fmt.Fprintf(w, "%s %s\n", marker, name)
+	}
+	fmt.Fprintln(w)
+}
+
+// branchCommand runs the /fork and /branches commands of the interactive mode, args are the fields of the line
+func branchCommand(cmd *cobra.Command, w io.Writer, args []string, b *conversationBranches, opts *generateOptions) error {
+	switch {
+	case args[0] == "/fork" && len(args) == 2:
+		if err := b.Fork(cmd, args[1], opts); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Forked conversation into branch '%s'.\n", args[1])
+	case args[0] == "/branches" && len(args) == 1:
+		b.List(w)
+	case args[0] == "/branches" && len(args) == 2:
+		if err := b.Switch(cmd, args[1], opts); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Switched to branch '%s'.\n", args[1])
+	default:
+		return errUsage
+	}
+
+	return nil
+}
+
+func usageBranches() {
+	fmt.Fprintln(os.Stderr, "Available Commands:")
+	fmt.Fprintln(os.Stderr, "  /fork <name>        Copy the current conversation into a new branch and switch to it")
+	fmt.Fprintln(os.Stderr, "  /branches           List conversation branches")
+	fmt.Fprintln(os.Stderr, "  /branches <name>    Switch to a conversation branch")
+	fmt.Fprintln(os.Stderr, "")
+}
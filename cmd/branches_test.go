@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBranchCommand(t *testing.T) {
+	cmd := &cobra.Command{}
+	setContext := func(tokens ...int) {
+		cmd.SetContext(context.WithValue(context.Background(), generateContextKey("context"), tokens))
+	}
+	tokens := func() []int {
+		tokens, _ := cmd.Context().Value(generateContextKey("context")).([]int)
+		return tokens
+	}
+
+	setContext(1, 2)
+	opts := generateOptions{Images: []ImageData{[]byte("a")}, Transcript: &transcript{Messages: []transcriptMessage{{Role: "user", Content: "hi"}}}}
+	b := newConversationBranches()
+
+	run := func(line string) (string, error) {
+		var w strings.Builder
+		err := branchCommand(cmd, &w, strings.Fields(line), b, &opts)
+		return w.String(), err
+	}
+
+	out, err := run("/fork alt")
+	require.NoError(t, err)
+	assert.Equal(t, "Forked conversation into branch 'alt'.\n", out)
+	assert.Equal(t, []int{1, 2}, tokens())
+
+	// the fork goes on without changing main
+	setContext(1, 2, 3)
+	opts.Images = nil
+	opts.Transcript.Messages = append(opts.Transcript.Messages, transcriptMessage{Role: "assistant", Content: "hello"})
+
+	out, err = run("/branches")
+	require.NoError(t, err)
+	assert.Equal(t, "* alt\n  main\n\n", out)
+
+	out, err = run("/branches main")
+	require.NoError(t, err)
+	assert.Equal(t, "Switched to branch 'main'.\n", out)
+	assert.Equal(t, []int{1, 2}, tokens())
+	assert.Len(t, opts.Images, 1)
+	assert.Len(t, opts.Transcript.Messages, 1)
+
+	_, err = run("/branches alt")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, tokens())
+	assert.Empty(t, opts.Images)
+	assert.Len(t, opts.Transcript.Messages, 2)
+
+	_, err = run("/fork main")
+	assert.EqualError(t, err, "branch 'main' already exists")
+
+	_, err = run("/branches missing")
+	assert.EqualError(t, err, "branch 'missing' not found")
+	assert.Equal(t, "alt", b.current)
+
+	for _, line := range []string{"/fork", "/fork a b", "/branches a b"} {
+		_, err := run(line)
+		assert.ErrorIs(t, err, errUsage, line)
+	}
+}
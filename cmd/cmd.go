@@ -1,40 +1,45 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/template"
 	"time"
 
-	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/exp/slices"
 	"golang.org/x/term"
 
 	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+	"github.com/jmorganca/ollama/eval"
 	"github.com/jmorganca/ollama/format"
 	"github.com/jmorganca/ollama/parser"
 	"github.com/jmorganca/ollama/progress"
-	"github.com/jmorganca/ollama/readline"
 	"github.com/jmorganca/ollama/server"
+	"github.com/jmorganca/ollama/style"
 	"github.com/jmorganca/ollama/version"
 )
 
@@ -52,6 +57,10 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := confirmModelChange(cmd, client, args[0], "Overwrite"); err != nil {
+		return err
+	}
+
 	p := progress.NewProgress(os.Stderr)
 	defer p.Stop()
 
@@ -78,7 +87,7 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 
 	for _, c := range commands {
 		switch c.Name {
-		case "model", "adapter":
+		case "model", "adapter", "engine":
 			path := c.Args
 			if path == "~" {
 				path = home
@@ -136,7 +145,12 @@ func CreateHandler(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	request := api.CreateRequest{Name: args[0], Modelfile: string(modelfile)}
+	wait, err := cmd.Flags().GetBool("wait")
+	if err != nil {
+		return err
+	}
+
+	request := api.CreateRequest{Name: args[0], Modelfile: string(modelfile), Wait: wait}
 	if err := client.Create(cmd.Context(), &request, fn); err != nil {
 		return err
 	}
@@ -166,6 +180,118 @@ func RunHandler(cmd *cobra.Command, args []string) error {
 	return RunGenerate(cmd, args)
 }
 
+func TranscribeHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	language, err := cmd.Flags().GetString("language")
+	if err != nil {
+		return err
+	}
+
+	prompt, err := cmd.Flags().GetString("prompt")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.StopAndClear()
+
+	spinner := progress.NewSpinner("")
+	p.Add("", spinner)
+
+	request := api.TranscriptionRequest{Model: args[0], Filename: args[1], Language: language, Prompt: prompt}
+	resp, err := client.Transcribe(cmd.Context(), &request, f)
+	if err != nil {
+		return err
+	}
+
+	p.StopAndClear()
+	fmt.Println(strings.TrimSpace(resp.Text))
+	return nil
+}
+
+func ImagineHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	size, err := cmd.Flags().GetString("size")
+	if err != nil {
+		return err
+	}
+
+	n, err := cmd.Flags().GetInt("number")
+	if err != nil {
+		return err
+	}
+
+	request := api.ImageGenerateRequest{
+		Model:  args[0],
+		Prompt: strings.Join(args[1:], " "),
+		N:      n,
+		Size:   size,
+	}
+
+	if cmd.Flags().Changed("seed") {
+		seed, err := cmd.Flags().GetInt64("seed")
+		if err != nil {
+			return err
+		}
+
+		request.Seed = &seed
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.StopAndClear()
+
+	spinner := progress.NewSpinner("generating image")
+	p.Add("", spinner)
+
+	resp, err := client.GenerateImage(cmd.Context(), &request)
+	if err != nil {
+		return err
+	}
+
+	p.StopAndClear()
+
+	ext := filepath.Ext(output)
+	base := strings.TrimSuffix(output, ext)
+	for i, image := range resp.Data {
+		bts, err := base64.StdEncoding.DecodeString(image.B64JSON)
+		if err != nil {
+			return err
+		}
+
+		name := output
+		if len(resp.Data) > 1 {
+			name = fmt.Sprintf("%s-%d%s", base, i+1, ext)
+		}
+
+		if err := os.WriteFile(name, bts, 0o644); err != nil {
+			return err
+		}
+
+		fmt.Printf("wrote '%s' (seed %d)\n", name, image.Seed)
+	}
+
+	return nil
+}
+
 func PushHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -226,6 +352,11 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	filters, err := cmd.Flags().GetStringArray("filter")
+	if err != nil {
+		return err
+	}
+
 	models, err := client.List(cmd.Context())
 	if err != nil {
 		return err
@@ -235,32 +366,55 @@ func ListHandler(cmd *cobra.Command, args []string) error {
 
 	for _, m := range models.Models {
 		if len(args) == 0 || strings.HasPrefix(m.Name, args[0]) {
+			if !matchLabels(m.Labels, filters) {
+				continue
+			}
+
 			data = append(data, []string{m.Name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.ModifiedAt, "Never")})
 		}
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"NAME", "ID", "SIZE", "MODIFIED"})
-	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetHeaderLine(false)
-	table.SetBorder(false)
-	table.SetNoWhiteSpace(true)
-	table.SetTablePadding("\t")
-	table.AppendBulk(data)
-	table.Render()
+	renderTable(os.Stdout, stdoutWidth(), []string{"NAME", "ID", "SIZE", "MODIFIED"}, data)
 
 	return nil
 }
 
+// matchLabels reports whether labels match every filter, a filter is key=value for a label with that value or
+// key for a label with any value
+func matchLabels(labels map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		key, value, hasValue := strings.Cut(filter, "=")
+		v, ok := labels[key]
+		if !ok || (hasValue && v != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func DeleteHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
 	}
 
+	purge, err := cmd.Flags().GetBool("purge")
+	if err != nil {
+		return err
+	}
+
+	verb := "Remove"
+	if purge {
+		verb = "Permanently delete"
+	}
+
 	for _, name := range args {
-		req := api.DeleteRequest{Name: name}
+		if err := confirmModelChange(cmd, client, name, verb); err != nil {
+			return err
+		}
+
+		req := api.DeleteRequest{Name: name, Purge: purge}
 		if err := client.Delete(cmd.Context(), &req); err != nil {
 			return err
 		}
@@ -269,6 +423,39 @@ func DeleteHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func RestoreHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range args {
+		if err := client.Restore(cmd.Context(), &api.RestoreRequest{Name: name}); err != nil {
+			return err
+		}
+		fmt.Printf("restored '%s'\n", name)
+	}
+
+	if len(args) > 0 {
+		return nil
+	}
+
+	// without a model, list those which can be restored
+	trash, err := client.ListTrash(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, m := range trash.Models {
+		data = append(data, []string{m.Name, m.Digest[:12], format.HumanBytes(m.Size), format.HumanTime(m.DeletedAt, "Never"), format.HumanTime(m.ExpiresAt, "Never")})
+	}
+
+	renderTable(os.Stdout, stdoutWidth(), []string{"NAME", "ID", "SIZE", "DELETED", "PURGED"}, data)
+
+	return nil
+}
+
 func ShowHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
@@ -284,8 +471,10 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 	parameters, errParams := cmd.Flags().GetBool("parameters")
 	system, errSystem := cmd.Flags().GetBool("system")
 	template, errTemplate := cmd.Flags().GetBool("template")
+	digests, errDigests := cmd.Flags().GetBool("digests")
+	spdx, errSPDX := cmd.Flags().GetBool("spdx")
 
-	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate} {
+	for _, boolErr := range []error{errLicense, errModelfile, errParams, errSystem, errTemplate, errDigests, errSPDX} {
 		if boolErr != nil {
 			return errors.New("error retrieving flags")
 		}
@@ -319,10 +508,20 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 		showType = "template"
 	}
 
+	if digests {
+		flagsSet++
+		showType = "digests"
+	}
+
+	if spdx {
+		flagsSet++
+		showType = "spdx"
+	}
+
 	if flagsSet > 1 {
-		return errors.New("only one of '--license', '--modelfile', '--parameters', '--system', or '--template' can be specified")
+		return errors.New("only one of '--license', '--modelfile', '--parameters', '--system', '--template', '--digests', or '--spdx' can be specified")
 	} else if flagsSet == 0 {
-		return errors.New("one of '--license', '--modelfile', '--parameters', '--system', or '--template' must be specified")
+		return errors.New("one of '--license', '--modelfile', '--parameters', '--system', '--template', '--digests', or '--spdx' must be specified")
 	}
 
 	req := api.ShowRequest{Name: args[0]}
@@ -335,24 +534,56 @@ func ShowHandler(cmd *cobra.Command, args []string) error {
 	case "license":
 		fmt.Println(resp.License)
 	case "modelfile":
-		fmt.Println(resp.Modelfile)
+		fmt.Println(styleModelfile(resp.Modelfile))
 	case "parameters":
 		fmt.Println(resp.Parameters)
 	case "system":
 		fmt.Println(resp.System)
 	case "template":
 		fmt.Println(resp.Template)
+	case "digests":
+		var data [][]string
+		for _, layer := range resp.Layers {
+			data = append(data, []string{layer.Digest, strconv.FormatInt(layer.Size, 10), layer.MediaType, layer.Registry})
+		}
+
+		renderTable(os.Stdout, stdoutWidth(), []string{"DIGEST", "SIZE", "MEDIA TYPE", "REGISTRY"}, data)
+	case "spdx":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newSPDXDocument(args[0], resp, time.Now()))
 	}
 
 	return nil
 }
 
+// styleModelfile mutes the comments of a Modelfile, lines in triple quoted values are left as they are
+func styleModelfile(modelfile string) string {
+	lines := strings.Split(modelfile, "\n")
+	var quoted bool
+	for i, line := range lines {
+		if !quoted && strings.HasPrefix(line, "#") {
+			lines[i] = style.Stdout.Render(style.Muted, line)
+		}
+
+		if strings.Count(line, `"""`)%2 == 1 {
+			quoted = !quoted
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func CopyHandler(cmd *cobra.Command, args []string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
 	}
 
+	if err := confirmModelChange(cmd, client, args[1], "Overwrite"); err != nil {
+		return err
+	}
+
 	req := api.CopyRequest{Source: args[0], Destination: args[1]}
 	if err := client.Copy(cmd.Context(), &req); err != nil {
 		return err
@@ -361,12 +592,119 @@ func CopyHandler(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func ShareHandler(cmd *cobra.Command, args []string) error {
+	duration, err := cmd.Flags().GetDuration("duration")
+	if err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Share(cmd.Context(), &api.ShareRequest{Name: args[0], Duration: duration.String()})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Sharing %s until %s. It can be pulled once with:\n\n", resp.Name, format.HumanTimeLower(resp.ExpiresAt, "never"))
+	for _, u := range resp.URLs {
+		fmt.Printf("  ollama pull --url %s\n", u)
+	}
+
+	return nil
+}
+
+// LogsHandler prints the server's log, read from the local log directory if the server isn't running
+func LogsHandler(cmd *cobra.Command, _ []string) error {
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+
+	lines, err := cmd.Flags().GetInt("lines")
+	if err != nil {
+		return err
+	}
+
+	if lines <= 0 {
+		return errors.New("lines must be greater than 0")
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	err = client.Logs(cmd.Context(), &api.LogsRequest{Lines: lines, Follow: follow}, func(resp api.LogsResponse) error {
+		fmt.Println(resp.Line)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		return err
+	}
+
+	dir, err := server.LogDir()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, "server.log")
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w, and there is no log at %s", ErrConnection, path)
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(os.Stderr, "the server isn't running, showing %s\n", path)
+
+	// print the last lines, keeping them in a ring
+	ring := make([]string, 0, lines)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(ring) == lines {
+			ring = ring[1:]
+		}
+
+		ring = append(ring, scanner.Text())
+	}
+
+	for _, line := range ring {
+		fmt.Println(line)
+	}
+
+	return scanner.Err()
+}
+
 func PullHandler(cmd *cobra.Command, args []string) error {
 	insecure, err := cmd.Flags().GetBool("insecure")
 	if err != nil {
 		return err
 	}
 
+	wait, err := cmd.Flags().GetBool("wait")
+	if err != nil {
+		return err
+	}
+
+	url, err := cmd.Flags().GetString("url")
+	if err != nil {
+		return err
+	}
+
+	acceptLicense, err := cmd.Flags().GetBool("accept-license")
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 && url == "" {
+		return errors.New("pull needs a model, or a url with --url")
+	}
+
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
 		return err
@@ -403,75 +741,302 @@ func PullHandler(cmd *cobra.Command, args []string) error {
 			spinner = progress.NewSpinner(status)
 			p.Add(status, spinner)
 		}
-
-		return nil
+
+		return nil
+	}
+
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	request := api.PullRequest{Name: name, URL: url, Insecure: insecure, Wait: wait, AcceptLicense: acceptLicense}
+	if err := client.Pull(cmd.Context(), &request, fn); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func RunGenerate(cmd *cobra.Command, args []string) error {
+	interactive := true
+
+	opts := generateOptions{
+		Model:    args[0],
+		WordWrap: os.Getenv("TERM") == "xterm-256color",
+		Options:  map[string]interface{}{},
+		Images:   []ImageData{},
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	opts.Format = format
+
+	outputTemplate, err := cmd.Flags().GetString("output-template")
+	if err != nil {
+		return err
+	}
+
+	if outputTemplate != "" {
+		opts.OutputTemplate, err = parseOutputTemplate(outputTemplate)
+		if err != nil {
+			return err
+		}
+	}
+
+	stdinStream, err := cmd.Flags().GetBool("stdin-stream")
+	if err != nil {
+		return err
+	}
+
+	if stdinStream {
+		return notifyDone(cmd, args, generateStdinStream(cmd, opts, os.Stdin, os.Stdout))
+	}
+
+	prompts := args[1:]
+	// prepend stdin to the prompt if provided
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		in, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		prompts = append([]string{string(in)}, prompts...)
+		opts.WordWrap = false
+		interactive = false
+	}
+	opts.Prompt = strings.Join(prompts, " ")
+	if len(prompts) > 0 {
+		interactive = false
+	}
+
+	nowrap, err := cmd.Flags().GetBool("nowordwrap")
+	if err != nil {
+		return err
+	}
+	opts.WordWrap = !nowrap
+
+	opts.FailOnEmpty, err = cmd.Flags().GetBool("fail-on-empty")
+	if err != nil {
+		return err
+	}
+
+	opts.Transcript = newTranscript(opts.Model)
+	opts.Transcript.path, err = cmd.Flags().GetString("log-transcript")
+	if err != nil {
+		return err
+	}
+
+	agentMode, err := cmd.Flags().GetBool("agent")
+	if err != nil {
+		return err
+	}
+
+	if !interactive {
+		if agentMode {
+			return errors.New("agent mode requires an interactive session to confirm tool calls")
+		}
+
+		return notifyDone(cmd, args, generate(cmd, opts))
+	}
+
+	if agentMode {
+		allowed, err := cmd.Flags().GetStringSlice("agent-allow")
+		if err != nil {
+			return err
+		}
+
+		// the confirmation prompt is set once the interactive session starts, which stops the agent
+		opts.Agent, err = newAgent(cmd.Context(), allowed, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return generateInteractive(cmd, opts)
+}
+
+// stdinStreamRequest is a single JSONL prompt read by --stdin-stream
+type stdinStreamRequest struct {
+	Prompt  string                 `json:"prompt"`
+	System  string                 `json:"system,omitempty"`
+	Images  []api.ImageData        `json:"images,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// generateStdinStream treats each line of r as a separate prompt and writes one response per line to w.
+// Lines which are JSON objects are answered with a JSON response, other lines with the response text
+// collapsed onto a single line. A line which fails is answered with its error, {"error": "..."} for JSON
+// lines and an empty line for others with the error on stderr, and the lines after it are still answered.
+func generateStdinStream(cmd *cobra.Command, opts generateOptions, r io.Reader, w io.Writer) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	// load the model once up front so it stays loaded between prompts
+	if err := client.Load(cmd.Context(), &api.LoadRequest{Model: opts.Model}, func(api.LoadResponse) error { return nil }); err != nil {
+		return err
+	}
+
+	var failed int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 512*format.KiloByte), 16*format.MegaByte)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		jsonl := strings.HasPrefix(line, "{")
+		if err := generateStdinLine(cmd.Context(), client, opts, line, jsonl, w); err != nil {
+			if cmd.Context().Err() != nil {
+				return err
+			}
+
+			failed++
+			if err := writeStdinError(w, jsonl, err); err != nil {
+				return err
+			}
+		}
 	}
 
-	request := api.PullRequest{Name: args[0], Insecure: insecure}
-	if err := client.Pull(cmd.Context(), &request, fn); err != nil {
+	if err := scanner.Err(); err != nil {
 		return err
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("%d prompt(s) failed", failed)
+	}
+
 	return nil
 }
 
-func RunGenerate(cmd *cobra.Command, args []string) error {
-	interactive := true
+// generateStdinLine answers a line of --stdin-stream
+func generateStdinLine(ctx context.Context, client *api.Client, opts generateOptions, line string, jsonl bool, w io.Writer) error {
+	stream := false
+	request := api.GenerateRequest{
+		Model:   opts.Model,
+		Prompt:  line,
+		Format:  opts.Format,
+		Options: opts.Options,
+		Stream:  &stream,
+	}
 
-	opts := generateOptions{
-		Model:    args[0],
-		WordWrap: os.Getenv("TERM") == "xterm-256color",
-		Options:  map[string]interface{}{},
-		Images:   []ImageData{},
+	if jsonl {
+		var in stdinStreamRequest
+		if err := json.Unmarshal([]byte(line), &in); err != nil {
+			return fmt.Errorf("invalid JSON prompt: %w", err)
+		}
+
+		request.Prompt = in.Prompt
+		request.System = in.System
+		request.Images = in.Images
+		if in.Options != nil {
+			request.Options = in.Options
+		}
 	}
 
-	format, err := cmd.Flags().GetString("format")
-	if err != nil {
+	var response api.GenerateResponse
+	if err := client.Generate(ctx, &request, func(resp api.GenerateResponse) error {
+		response = resp
+		return nil
+	}); err != nil {
 		return err
 	}
-	opts.Format = format
 
-	prompts := args[1:]
-	// prepend stdin to the prompt if provided
-	if !term.IsTerminal(int(os.Stdin.Fd())) {
-		in, err := io.ReadAll(os.Stdin)
+	switch {
+	case jsonl:
+		response.Context = nil
+		bts, err := json.Marshal(response)
 		if err != nil {
 			return err
 		}
 
-		prompts = append([]string{string(in)}, prompts...)
-		opts.WordWrap = false
-		interactive = false
+		_, err = fmt.Fprintln(w, string(bts))
+		return err
+	case opts.OutputTemplate != nil:
+		response.Response = strings.Join(strings.Fields(response.Response), " ")
+		return executeOutputTemplate(w, opts.OutputTemplate, response)
+	default:
+		_, err := fmt.Fprintln(w, strings.Join(strings.Fields(response.Response), " "))
+		return err
 	}
-	opts.Prompt = strings.Join(prompts, " ")
-	if len(prompts) > 0 {
-		interactive = false
+}
+
+// writeStdinError answers a line of --stdin-stream which failed, so each line of input still has a line of output
+func writeStdinError(w io.Writer, jsonl bool, err error) error {
+	if !jsonl {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		_, err := fmt.Fprintln(w)
+		return err
 	}
 
-	nowrap, err := cmd.Flags().GetBool("nowordwrap")
+	bts, merr := json.Marshal(map[string]string{"error": err.Error()})
+	if merr != nil {
+		return merr
+	}
+
+	_, err = fmt.Fprintln(w, string(bts))
+	return err
+}
+
+var outputTemplateEscapes = strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\\`, `\`)
+
+// parseOutputTemplate parses a --output-template value, expanding \t and \n escapes so
+// templates can be written in single quoted shell strings
+func parseOutputTemplate(s string) (*template.Template, error) {
+	tmpl, err := template.New("output").Parse(outputTemplateEscapes.Replace(s))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("invalid output template: %w", err)
 	}
-	opts.WordWrap = !nowrap
 
-	if !interactive {
-		return generate(cmd, opts)
+	return tmpl, nil
+}
+
+func executeOutputTemplate(w io.Writer, tmpl *template.Template, resp api.GenerateResponse) error {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, resp); err != nil {
+		return fmt.Errorf("output template: %w", err)
 	}
 
-	return generateInteractive(cmd, opts)
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
 }
 
 type generateContextKey string
 
 type generateOptions struct {
-	Model    string
-	Prompt   string
+	Model  string
+	Prompt string
+	// Typed is the prompt as the user typed it, before variables and attached documents were added to it
+	Typed    string
 	WordWrap bool
 	Format   string
 	System   string
 	Template string
 	Images   []ImageData
+	Think    bool
 	Options  map[string]interface{}
+
+	// Continue extends the previous response instead of answering a new prompt
+	Continue bool
+
+	// FailOnEmpty returns ErrEmptyResponse if the model generates no text
+	FailOnEmpty bool
+
+	// OutputTemplate replaces the streamed response with the template executed against the final response,
+	// with the whole response and thinking
+	OutputTemplate *template.Template
+	// Transcript records each exchange when set
+	Transcript *transcript
+	// Agent executes the tool calls in responses when set
+	Agent *agent
+	// StatusBar prints a status line after each response
+	StatusBar bool
 }
 
 func generate(cmd *cobra.Command, opts generateOptions) error {
@@ -511,11 +1076,53 @@ func generate(cmd *cobra.Command, opts generateOptions) error {
 
 	var currentLineLength int
 	var wordBuffer string
+	var thinking bool
+	var generated, thoughts strings.Builder
+	empty := true
 
+	var bar *progress.Bar
 	fn := func(response api.GenerateResponse) error {
+		if response.Load != nil {
+			bar = showLoadProgress(p, spinner, bar, response.Load)
+			return nil
+		}
+
+		// keepalives arrive while a long prompt is evaluated, keep the spinner going until there is text
+		if !response.Done && response.Response == "" && response.Thinking == "" {
+			return nil
+		}
+
 		p.StopAndClear()
 
 		latest = response
+		if response.Response != "" {
+			empty = false
+		}
+
+		generated.WriteString(response.Response)
+
+		// thinking is only shown with /set think, but an output template can always use it
+		if opts.Think || opts.OutputTemplate != nil {
+			thoughts.WriteString(response.Thinking)
+		}
+
+		if opts.OutputTemplate != nil {
+			return nil
+		}
+
+		if opts.Think && response.Thinking != "" {
+			if !thinking {
+				thinking = true
+				fmt.Print(style.Stdout.Start(style.Muted) + "Thinking...\n")
+			}
+
+			fmt.Print(response.Thinking)
+		}
+
+		if thinking && response.Response != "" {
+			thinking = false
+			fmt.Print(style.Stdout.End() + "\n\n")
+		}
 
 		termWidth, _, _ = term.GetSize(int(os.Stdout.Fd()))
 		if opts.WordWrap && termWidth >= 10 {
@@ -560,24 +1167,34 @@ func generate(cmd *cobra.Command, opts generateOptions) error {
 	for _, i := range opts.Images {
 		images = append(images, api.ImageData(i))
 	}
-	request := api.GenerateRequest{
-		Model:    opts.Model,
-		Prompt:   opts.Prompt,
-		Context:  generateContext,
-		Format:   opts.Format,
-		System:   opts.System,
-		Template: opts.Template,
-		Options:  opts.Options,
-		Images:   images,
-	}
-
-	if err := client.Generate(ctx, &request, fn); err != nil {
-		if errors.Is(err, context.Canceled) {
-			return nil
-		}
+	request := apix.GenerateRequest{
+		GenerateRequest: api.GenerateRequest{
+			Model:    opts.Model,
+			Prompt:   opts.Prompt,
+			Context:  generateContext,
+			Format:   opts.Format,
+			System:   opts.System,
+			Template: opts.Template,
+			Options:  opts.Options,
+			Images:   images,
+		},
+		Think:    true,
+		Continue: opts.Continue,
+
+		// the prompt is kept for /show prompt
+		ReturnPrompt: true,
+	}
+
+	if err := apix.Generate(ctx, client, &request, fn); err != nil {
 		return err
 	}
-	if opts.Prompt != "" {
+	if thinking {
+		fmt.Print(style.Stdout.End())
+	}
+
+	// a continued response is an exchange of its own even though it has no prompt
+	exchange := opts.Prompt != "" || opts.Continue
+	if exchange && opts.OutputTemplate == nil {
 		fmt.Println()
 		fmt.Println()
 	}
@@ -586,6 +1203,26 @@ func generate(cmd *cobra.Command, opts generateOptions) error {
 		return nil
 	}
 
+	final := latest
+	final.Response = generated.String()
+	final.Thinking = thoughts.String()
+
+	if opts.Transcript != nil && exchange {
+		if err := opts.Transcript.Add(opts, final); err != nil {
+			return err
+		}
+	}
+
+	if opts.OutputTemplate != nil && exchange {
+		if err := executeOutputTemplate(os.Stdout, opts.OutputTemplate, final); err != nil {
+			return err
+		}
+	}
+
+	if opts.FailOnEmpty && exchange && empty {
+		return ErrEmptyResponse
+	}
+
 	verbose, err := cmd.Flags().GetBool("verbose")
 	if err != nil {
 		return err
@@ -595,447 +1232,159 @@ func generate(cmd *cobra.Command, opts generateOptions) error {
 		latest.Summary()
 	}
 
+	if opts.StatusBar {
+		printStatusLine(opts, latest)
+	}
+
+	// warn before the conversation outgrows the context and the start of it is silently dropped
+	if numCtx := latest.ContextSize(); numCtx > 0 && *latest.ContextRemaining <= numCtx/10 {
+		used := numCtx - *latest.ContextRemaining
+		fmt.Fprintln(os.Stderr, style.Stderr.Render(style.Warning, fmt.Sprintf("context is %d%% full, earlier messages will be truncated soon", used*100/numCtx)))
+	}
+
 	ctx = context.WithValue(cmd.Context(), generateContextKey("context"), latest.Context)
+	response := final.Response
+	if opts.Continue {
+		previous, _ := cmd.Context().Value(generateContextKey("response")).(string)
+		response = previous + response
+	}
+
+	ctx = context.WithValue(ctx, generateContextKey("response"), response)
+	ctx = context.WithValue(ctx, generateContextKey("prompt"), latest.Prompt)
 	cmd.SetContext(ctx)
 
 	return nil
 }
 
-type MultilineState int
-
-const (
-	MultilineNone MultilineState = iota
-	MultilinePrompt
-	MultilineSystem
-	MultilineTemplate
-)
-
-func modelIsMultiModal(cmd *cobra.Command, name string) bool {
-	// get model details
+// loadModel loads the model into memory showing a spinner until it is ready
+func loadModel(cmd *cobra.Command, model string) error {
 	client, err := api.ClientFromEnvironment()
 	if err != nil {
-		fmt.Println("error: couldn't connect to ollama server")
-		return false
+		return err
 	}
 
-	req := api.ShowRequest{Name: name}
-	resp, err := client.Show(cmd.Context(), &req)
-	if err != nil {
-		return false
-	}
+	p := progress.NewProgress(os.Stderr)
+	defer p.StopAndClear()
 
-	return slices.Contains(resp.Details.Families, "clip")
-}
+	spinner := progress.NewSpinner("")
+	p.Add("", spinner)
 
-func generateInteractive(cmd *cobra.Command, opts generateOptions) error {
-	multiModal := modelIsMultiModal(cmd, opts.Model)
-
-	// load the model
-	loadOpts := generateOptions{
-		Model:  opts.Model,
-		Prompt: "",
-		Images: []ImageData{},
-	}
-	if err := generate(cmd, loadOpts); err != nil {
-		return err
-	}
-
-	usage := func() {
-		fmt.Fprintln(os.Stderr, "Available Commands:")
-		fmt.Fprintln(os.Stderr, "  /set         Set session variables")
-		fmt.Fprintln(os.Stderr, "  /show        Show model information")
-		fmt.Fprintln(os.Stderr, "  /bye         Exit")
-		fmt.Fprintln(os.Stderr, "  /?, /help    Help for a command")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Use \"\"\" to begin a multi-line message.")
-		fmt.Fprintln(os.Stderr, "")
-	}
-
-	usageSet := func() {
-		fmt.Fprintln(os.Stderr, "Available Commands:")
-		fmt.Fprintln(os.Stderr, "  /set parameter ...     Set a parameter")
-		fmt.Fprintln(os.Stderr, "  /set system <string>   Set system message")
-		fmt.Fprintln(os.Stderr, "  /set template <string> Set prompt template")
-		fmt.Fprintln(os.Stderr, "  /set history           Enable history")
-		fmt.Fprintln(os.Stderr, "  /set nohistory         Disable history")
-		fmt.Fprintln(os.Stderr, "  /set wordwrap          Enable wordwrap")
-		fmt.Fprintln(os.Stderr, "  /set nowordwrap        Disable wordwrap")
-		fmt.Fprintln(os.Stderr, "  /set format json       Enable JSON mode")
-		fmt.Fprintln(os.Stderr, "  /set noformat          Disable formatting")
-		fmt.Fprintln(os.Stderr, "  /set verbose           Show LLM stats")
-		fmt.Fprintln(os.Stderr, "  /set quiet             Disable LLM stats")
-		fmt.Fprintln(os.Stderr, "")
-	}
-
-	usageShow := func() {
-		fmt.Fprintln(os.Stderr, "Available Commands:")
-		fmt.Fprintln(os.Stderr, "  /show license      Show model license")
-		fmt.Fprintln(os.Stderr, "  /show modelfile    Show Modelfile for this model")
-		fmt.Fprintln(os.Stderr, "  /show parameters   Show parameters for this model")
-		fmt.Fprintln(os.Stderr, "  /show system       Show system message")
-		fmt.Fprintln(os.Stderr, "  /show template     Show prompt template")
-		fmt.Fprintln(os.Stderr, "")
-	}
-
-	// only list out the most common parameters
-	usageParameters := func() {
-		fmt.Fprintln(os.Stderr, "Available Parameters:")
-		fmt.Fprintln(os.Stderr, "  /set parameter seed <int>             Random number seed")
-		fmt.Fprintln(os.Stderr, "  /set parameter num_predict <int>      Max number of tokens to predict")
-		fmt.Fprintln(os.Stderr, "  /set parameter top_k <int>            Pick from top k num of tokens")
-		fmt.Fprintln(os.Stderr, "  /set parameter top_p <float>          Pick token based on sum of probabilities")
-		fmt.Fprintln(os.Stderr, "  /set parameter num_ctx <int>          Set the context size")
-		fmt.Fprintln(os.Stderr, "  /set parameter temperature <float>    Set creativity level")
-		fmt.Fprintln(os.Stderr, "  /set parameter repeat_penalty <float> How strongly to penalize repetitions")
-		fmt.Fprintln(os.Stderr, "  /set parameter repeat_last_n <int>    Set how far back to look for repetitions")
-		fmt.Fprintln(os.Stderr, "  /set parameter num_gpu <int>          The number of layers to send to the GPU")
-		fmt.Fprintln(os.Stderr, "  /set parameter stop \"<string>\", ...   Set the stop parameters")
-		fmt.Fprintln(os.Stderr, "")
-	}
-
-	scanner, err := readline.New(readline.Prompt{
-		Prompt:         ">>> ",
-		AltPrompt:      "... ",
-		Placeholder:    "Send a message (/? for help)",
-		AltPlaceholder: `Use """ to end multi-line input`,
+	var bar *progress.Bar
+	return client.Load(cmd.Context(), &api.LoadRequest{Model: model}, func(resp api.LoadResponse) error {
+		if resp.Load != nil {
+			bar = showLoadProgress(p, spinner, bar, resp.Load)
+		}
+
+		return nil
 	})
+}
+
+// printStatusLine shows the model, how much of the context is used, the speed of the last response
+// and the parameters set in the session
+func printStatusLine(opts generateOptions, resp api.GenerateResponse) {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
 	if err != nil {
-		return err
+		width = 0
 	}
 
-	fmt.Print(readline.StartBracketedPaste)
-	defer fmt.Printf(readline.EndBracketedPaste)
-
-	var multiline MultilineState
-	var prompt string
-
-	for {
-		line, err := scanner.Readline()
-		switch {
-		case errors.Is(err, io.EOF):
-			fmt.Println()
-			return nil
-		case errors.Is(err, readline.ErrInterrupt):
-			if line == "" {
-				fmt.Println("\nUse Ctrl-D or /bye to exit.")
-			}
-
-			scanner.Prompt.UseAlt = false
-			prompt = ""
+	fmt.Printf("%s\n\n", style.Stdout.Render(style.Muted, statusLine(opts, resp, width)))
+}
 
-			continue
-		case err != nil:
-			return err
-		}
+// statusLine is the status line cut to width, if width is positive
+func statusLine(opts generateOptions, resp api.GenerateResponse, width int) string {
+	status := []string{opts.Model}
 
-		switch {
-		case strings.HasPrefix(prompt, `"""`):
-			// if the prompt so far starts with """ then we're in multiline mode
-			// and we need to keep reading until we find a line that ends with """
-			cut, found := strings.CutSuffix(line, `"""`)
-			prompt += cut
+	if numCtx := resp.ContextSize(); numCtx > 0 {
+		status = append(status, fmt.Sprintf("context %d/%d tokens", numCtx-*resp.ContextRemaining, numCtx))
+	} else {
+		status = append(status, fmt.Sprintf("context %d tokens", len(resp.Context)))
+	}
 
-			if !found {
-				prompt += "\n"
-				continue
-			}
+	if resp.EvalDuration > 0 {
+		status = append(status, fmt.Sprintf("%.1f tokens/s", float64(resp.EvalCount)/resp.EvalDuration.Seconds()))
+	}
 
-			prompt = strings.TrimPrefix(prompt, `"""`)
-			scanner.Prompt.UseAlt = false
-
-			switch multiline {
-			case MultilineSystem:
-				opts.System = prompt
-				prompt = ""
-				fmt.Println("Set system message.")
-			case MultilineTemplate:
-				opts.Template = prompt
-				prompt = ""
-				fmt.Println("Set prompt template.")
-			}
-			multiline = MultilineNone
-		case strings.HasPrefix(line, `"""`) && len(prompt) == 0:
-			scanner.Prompt.UseAlt = true
-			multiline = MultilinePrompt
-			prompt += line + "\n"
-			continue
-		case scanner.Pasting:
-			prompt += line + "\n"
-			continue
-		case strings.HasPrefix(line, "/list"):
-			args := strings.Fields(line)
-			if err := ListHandler(cmd, args[1:]); err != nil {
-				return err
-			}
-		case strings.HasPrefix(line, "/set"):
-			args := strings.Fields(line)
-			if len(args) > 1 {
-				switch args[1] {
-				case "history":
-					scanner.HistoryEnable()
-				case "nohistory":
-					scanner.HistoryDisable()
-				case "wordwrap":
-					opts.WordWrap = true
-					fmt.Println("Set 'wordwrap' mode.")
-				case "nowordwrap":
-					opts.WordWrap = false
-					fmt.Println("Set 'nowordwrap' mode.")
-				case "verbose":
-					cmd.Flags().Set("verbose", "true")
-					fmt.Println("Set 'verbose' mode.")
-				case "quiet":
-					cmd.Flags().Set("verbose", "false")
-					fmt.Println("Set 'quiet' mode.")
-				case "format":
-					if len(args) < 3 || args[2] != "json" {
-						fmt.Println("Invalid or missing format. For 'json' mode use '/set format json'")
-					} else {
-						opts.Format = args[2]
-						fmt.Printf("Set format to '%s' mode.\n", args[2])
-					}
-				case "noformat":
-					opts.Format = ""
-					fmt.Println("Disabled format.")
-				case "parameter":
-					if len(args) < 4 {
-						usageParameters()
-						continue
-					}
-					var params []string
-					for _, p := range args[3:] {
-						params = append(params, p)
-					}
-					fp, err := api.FormatParams(map[string][]string{args[2]: params})
-					if err != nil {
-						fmt.Printf("Couldn't set parameter: %q\n\n", err)
-						continue
-					}
-					fmt.Printf("Set parameter '%s' to '%s'\n\n", args[2], strings.Join(params, ", "))
-					opts.Options[args[2]] = fp[args[2]]
-				case "system", "template":
-					if len(args) < 3 {
-						usageSet()
-						continue
-					}
-					line := strings.Join(args[2:], " ")
-					line = strings.TrimPrefix(line, `"""`)
-					if strings.HasPrefix(args[2], `"""`) {
-						cut, found := strings.CutSuffix(line, `"""`)
-						prompt += cut
-						if found {
-							if args[1] == "system" {
-								opts.System = prompt
-								fmt.Println("Set system message.")
-							} else {
-								opts.Template = prompt
-								fmt.Println("Set prompt template.")
-							}
-							prompt = ""
-						} else {
-							prompt = `"""` + prompt + "\n"
-							if args[1] == "system" {
-								multiline = MultilineSystem
-							} else {
-								multiline = MultilineTemplate
-							}
-							scanner.Prompt.UseAlt = true
-						}
-					} else {
-						opts.System = line
-						fmt.Println("Set system message.")
-					}
-				default:
-					fmt.Printf("Unknown command '/set %s'. Type /? for help\n", args[1])
-				}
-			} else {
-				usageSet()
-			}
-		case strings.HasPrefix(line, "/show"):
-			args := strings.Fields(line)
-			if len(args) > 1 {
-				client, err := api.ClientFromEnvironment()
-				if err != nil {
-					fmt.Println("error: couldn't connect to ollama server")
-					return err
-				}
-				resp, err := client.Show(cmd.Context(), &api.ShowRequest{Name: opts.Model})
-				if err != nil {
-					fmt.Println("error: couldn't get model")
-					return err
-				}
+	params := make([]string, 0, len(opts.Options))
+	for k, v := range opts.Options {
+		params = append(params, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(params)
+	status = append(status, params...)
 
-				switch args[1] {
-				case "license":
-					if resp.License == "" {
-						fmt.Print("No license was specified for this model.\n\n")
-					} else {
-						fmt.Println(resp.License)
-					}
-				case "modelfile":
-					fmt.Println(resp.Modelfile)
-				case "parameters":
-					if resp.Parameters == "" {
-						fmt.Print("No parameters were specified for this model.\n\n")
-					} else {
-						if len(opts.Options) > 0 {
-							fmt.Println("User defined parameters:")
-							for k, v := range opts.Options {
-								fmt.Printf("%-*s %v\n", 30, k, v)
-							}
-							fmt.Println()
-						}
-						fmt.Println("Model defined parameters:")
-						fmt.Println(resp.Parameters)
-					}
-				case "system":
-					switch {
-					case opts.System != "":
-						fmt.Println(opts.System + "\n")
-					case resp.System != "":
-						fmt.Println(resp.System + "\n")
-					default:
-						fmt.Print("No system message was specified for this model.\n\n")
-					}
-				case "template":
-					switch {
-					case opts.Template != "":
-						fmt.Println(opts.Template + "\n")
-					case resp.Template != "":
-						fmt.Println(resp.Template)
-					default:
-						fmt.Print("No prompt template was specified for this model.\n\n")
-					}
-				default:
-					fmt.Printf("Unknown command '/show %s'. Type /? for help\n", args[1])
-				}
-			} else {
-				usageShow()
-			}
-		case strings.HasPrefix(line, "/help"), strings.HasPrefix(line, "/?"):
-			args := strings.Fields(line)
-			if len(args) > 1 {
-				switch args[1] {
-				case "set", "/set":
-					usageSet()
-				case "show", "/show":
-					usageShow()
-				}
-			} else {
-				usage()
-			}
-		case line == "/exit", line == "/bye":
-			return nil
-		case strings.HasPrefix(line, "/"):
-			args := strings.Fields(line)
-			fmt.Printf("Unknown command '%s'. Type /? for help\n", args[0])
-			continue
-		default:
-			prompt += line
-		}
+	line := strings.Join(status, " | ")
+	if width > 0 && len(line) > width {
+		line = line[:width]
+	}
 
-		if len(prompt) > 0 && multiline == MultilineNone {
-			opts.Prompt = prompt
-			if multiModal {
-				newPrompt, images, err := extractFileNames(prompt)
-				if err != nil {
-					return err
-				}
-				opts.Prompt = newPrompt
-
-				// reset the context if we find another image
-				if len(images) > 0 {
-					opts.Images = images
-					ctx := cmd.Context()
-					ctx = context.WithValue(ctx, generateContextKey("context"), []int{})
-					cmd.SetContext(ctx)
-				}
-				if len(opts.Images) == 0 {
-					fmt.Println("This model requires you to add a jpeg, png, or svg image.")
-					fmt.Println()
-					prompt = ""
-					continue
-				}
-			}
-			if err := generate(cmd, opts); err != nil {
-				return err
-			}
+	return line
+}
 
-			prompt = ""
-		}
+// showLoadProgress replaces the spinner with a progress bar while the model loads
+func showLoadProgress(p *progress.Progress, spinner *progress.Spinner, bar *progress.Bar, load *api.LoadProgress) *progress.Bar {
+	if bar == nil {
+		spinner.Stop()
+		bar = progress.NewBar("loading model", load.Total, 0)
+		p.Add("load", bar)
 	}
-}
 
-func normalizeFilePath(fp string) string {
-	// Define a map of escaped characters and their replacements
-	replacements := map[string]string{
-		"\\ ":  " ",  // Escaped space
-		"\\(":  "(",  // Escaped left parenthesis
-		"\\)":  ")",  // Escaped right parenthesis
-		"\\[":  "[",  // Escaped left square bracket
-		"\\]":  "]",  // Escaped right square bracket
-		"\\{":  "{",  // Escaped left curly brace
-		"\\}":  "}",  // Escaped right curly brace
-		"\\$":  "$",  // Escaped dollar sign
-		"\\&":  "&",  // Escaped ampersand
-		"\\;":  ";",  // Escaped semicolon
-		"\\'":  "'",  // Escaped single quote
-		"\\\\": "\\", // Escaped backslash
-		"\\*":  "*",  // Escaped asterisk
-		"\\?":  "?",  // Escaped question mark
-	}
-
-	for escaped, actual := range replacements {
-		fp = strings.ReplaceAll(fp, escaped, actual)
-	}
-	return fp
+	bar.Set(load.Completed)
+	return bar
 }
 
-func extractFileNames(input string) (string, []ImageData, error) {
-	// Regex to match file paths starting with / or ./ and include escaped spaces (\ or %20)
-	// and followed by more characters and a file extension
-	regexPattern := `(?:\./|/)[\S\\ ]+?\.(?i:jpg|jpeg|png|svg)\b`
-	re := regexp.MustCompile(regexPattern)
+func RunServer(cmd *cobra.Command, _ []string) error {
+	daemon, _ := cmd.Flags().GetBool("daemon")
+	stop, _ := cmd.Flags().GetBool("stop")
+	status, _ := cmd.Flags().GetBool("status")
+	switch {
+	case daemon:
+		return startDaemon(cmd)
+	case stop:
+		return stopDaemon(cmd)
+	case status:
+		return daemonStatus(cmd)
+	}
 
-	filePaths := re.FindAllString(input, -1)
-	var imgs []ImageData
+	if err := server.SetupLogging(); err != nil {
+		return err
+	}
 
-	for _, fp := range filePaths {
-		nfp := normalizeFilePath(fp)
-		data, err := getImageData(nfp)
-		if err != nil {
-			if os.IsNotExist(err) {
-				continue
-			}
-			fmt.Printf("Couldn't process image: %q\n", err)
-			return "", imgs, err
-		}
-		fmt.Printf("Added image '%s'\n", nfp)
-		input = strings.ReplaceAll(input, fp, "")
-		imgs = append(imgs, data)
+	if err := initializeKeypair(); err != nil {
+		return err
 	}
-	return input, imgs, nil
-}
 
-func RunServer(cmd *cobra.Command, _ []string) error {
-	host, port, err := net.SplitHostPort(os.Getenv("OLLAMA_HOST"))
+	lns, err := server.Listen(os.Getenv("OLLAMA_HOST"))
 	if err != nil {
-		host, port = "127.0.0.1", "11434"
-		if ip := net.ParseIP(strings.Trim(os.Getenv("OLLAMA_HOST"), "[]")); ip != nil {
-			host = ip.String()
-		}
+		return err
 	}
 
-	if err := initializeKeypair(); err != nil {
+	return server.Serve(lns...)
+}
+
+// MigrateHandler migrates the local model store, the server also does this when it starts
+func MigrateHandler(cmd *cobra.Command, _ []string) error {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
 		return err
 	}
 
-	ln, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	var pending int
+	err = server.MigrateStore(dryRun, func(m server.StoreMigration) {
+		pending++
+		if dryRun {
+			fmt.Printf("would migrate to version %d: %s\n", m.Version, m.Description)
+		} else {
+			fmt.Printf("migrating to version %d: %s\n", m.Version, m.Description)
+		}
+	})
 	if err != nil {
 		return err
 	}
 
-	return server.Serve(ln)
+	if pending == 0 {
+		fmt.Println("model store is up to date")
+	}
+
+	return nil
 }
 
 func getImageData(filePath string) ([]byte, error) {
@@ -1173,10 +1522,10 @@ func checkServerHeartbeat(cmd *cobra.Command, _ []string) error {
 		}
 		if runtime.GOOS == "darwin" {
 			if err := startMacApp(cmd.Context(), client); err != nil {
-				return fmt.Errorf("could not connect to ollama app, is it running?")
+				return fmt.Errorf("%w, is the ollama app running?", ErrConnection)
 			}
 		} else {
-			return fmt.Errorf("could not connect to ollama server, run 'ollama serve' to start it")
+			return fmt.Errorf("%w, run 'ollama serve' to start it", ErrConnection)
 		}
 	}
 	return nil
@@ -1188,17 +1537,30 @@ func versionHandler(cmd *cobra.Command, _ []string) {
 		return
 	}
 
-	serverVersion, err := client.Version(cmd.Context())
+	fmt.Printf("client version is %s\n", version.Version)
+
+	info, err := client.VersionDetails(cmd.Context())
 	if err != nil {
 		fmt.Println("Warning: could not connect to a running Ollama instance")
+		return
 	}
 
-	if serverVersion != "" {
-		fmt.Printf("ollama version is %s\n", serverVersion)
+	fmt.Printf("server version is %s\n", info.Version)
+
+	for _, field := range [][2]string{
+		{"commit", info.Commit},
+		{"built", info.BuildDate},
+		{"go", info.GoVersion},
+		{"llama.cpp", info.LlamaCppCommit},
+		{"backends", strings.Join(info.Backends, ", ")},
+	} {
+		if field[1] != "" {
+			fmt.Printf("  %-10s %s\n", field[0], field[1])
+		}
 	}
 
-	if serverVersion != version.Version {
-		fmt.Printf("Warning: client version is %s\n", version.Version)
+	if info.Version != version.Version {
+		fmt.Printf("Warning: client version %s does not match server version %s\n", version.Version, info.Version)
 	}
 }
 
@@ -1222,19 +1584,27 @@ func NewCLI() *cobra.Command {
 
 			cmd.Print(cmd.UsageString())
 		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			noColor, _ := cmd.Flags().GetBool("no-color")
+			return style.Configure(noColor)
+		},
 	}
 
 	rootCmd.Flags().BoolP("version", "v", false, "Show version information")
+	rootCmd.PersistentFlags().Bool("no-color", false, "Don't color the output")
 
 	createCmd := &cobra.Command{
 		Use:     "create MODEL",
 		Short:   "Create a model from a Modelfile",
 		Args:    cobra.ExactArgs(1),
 		PreRunE: checkServerHeartbeat,
-		RunE:    CreateHandler,
+		RunE:    withNotify(CreateHandler),
 	}
 
 	createCmd.Flags().StringP("file", "f", "Modelfile", "Name of the Modelfile (default \"Modelfile\")")
+	createCmd.Flags().Bool("wait", false, "Wait if another process is changing the model store")
+	addNotifyFlag(createCmd, "Send a desktop notification when the model is created")
+	addConfirmFlags(createCmd, false)
 
 	showCmd := &cobra.Command{
 		Use:     "show MODEL",
@@ -1249,6 +1619,8 @@ func NewCLI() *cobra.Command {
 	showCmd.Flags().Bool("parameters", false, "Show parameters of a model")
 	showCmd.Flags().Bool("template", false, "Show template of a model")
 	showCmd.Flags().Bool("system", false, "Show system message of a model")
+	showCmd.Flags().Bool("digests", false, "Show digest, size and registry of every layer of a model")
+	showCmd.Flags().Bool("spdx", false, "Export the layers and license of a model as an SPDX document")
 
 	runCmd := &cobra.Command{
 		Use:     "run MODEL [PROMPT]",
@@ -1262,6 +1634,37 @@ func NewCLI() *cobra.Command {
 	runCmd.Flags().Bool("insecure", false, "Use an insecure registry")
 	runCmd.Flags().Bool("nowordwrap", false, "Don't wrap words to the next line automatically")
 	runCmd.Flags().String("format", "", "Response format (e.g. json)")
+	runCmd.Flags().Bool("fail-on-empty", false, "Exit with a non-zero status if the model generates no text")
+	runCmd.Flags().Bool("stdin-stream", false, "Answer each line of stdin as a separate prompt, one response per line")
+	runCmd.Flags().String("log-transcript", "", "Write the conversation to a file (.json for JSON, otherwise Markdown)")
+	runCmd.Flags().Bool("agent", false, "Let the model run tools (shell, HTTP GET, file read) after confirmation")
+	runCmd.Flags().StringSlice("agent-allow", defaultAgentCommands, "Commands the model may run in agent mode")
+	runCmd.Flags().String("output-template", "", "Go template applied to the final response (e.g. '{{.Response}}\\t{{.EvalCount}}')")
+	addNotifyFlag(runCmd, "Send a desktop notification when a prompt passed as an argument or on stdin is answered")
+
+	transcribeCmd := &cobra.Command{
+		Use:     "transcribe MODEL FILE",
+		Short:   "Transcribe an audio file with a whisper model",
+		Args:    cobra.ExactArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    TranscribeHandler,
+	}
+
+	transcribeCmd.Flags().String("language", "", "Spoken language of the audio (e.g. en)")
+	transcribeCmd.Flags().String("prompt", "", "Text to guide the style of the transcription")
+
+	imagineCmd := &cobra.Command{
+		Use:     "imagine MODEL PROMPT",
+		Short:   "Generate an image with a stable diffusion model",
+		Args:    cobra.MinimumNArgs(2),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ImagineHandler,
+	}
+
+	imagineCmd.Flags().StringP("output", "o", "image.png", "File to write the image to")
+	imagineCmd.Flags().String("size", "512x512", "Size of the image as WIDTHxHEIGHT")
+	imagineCmd.Flags().IntP("number", "n", 1, "Number of images to generate")
+	imagineCmd.Flags().Int64("seed", 0, "Random number seed")
 
 	serveCmd := &cobra.Command{
 		Use:     "serve",
@@ -1271,15 +1674,86 @@ func NewCLI() *cobra.Command {
 		RunE:    RunServer,
 	}
 
+	serveCmd.Flags().Bool("daemon", false, "Start ollama in the background and write its pidfile")
+	serveCmd.Flags().Bool("stop", false, "Stop ollama started with --daemon")
+	serveCmd.Flags().Bool("status", false, "Show whether ollama started with --daemon is running")
+	serveCmd.MarkFlagsMutuallyExclusive("daemon", "stop", "status")
+
+	importCmd := &cobra.Command{
+		Use:   "import --from llama.cpp|lmstudio|gpt4all [PATH]",
+		Short: "Import GGUF models from the cache of another tool without copying them",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  ImportHandler,
+	}
+
+	importCmd.Flags().String("from", "", "Tool the models come from: llama.cpp, lmstudio or gpt4all")
+	importCmd.Flags().Bool("dry-run", false, "Show the models and the Modelfiles generated for them without importing")
+	importCmd.MarkFlagRequired("from")
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the model store to the layout of this version",
+		Args:  cobra.ExactArgs(0),
+		RunE:  MigrateHandler,
+	}
+
+	migrateCmd.Flags().Bool("dry-run", false, "List the migrations without running them")
+
+	replayCmd := &cobra.Command{
+		Use:     "replay FILE",
+		Short:   "Run a generation recorded with OLLAMA_RECORD again",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ReplayHandler,
+	}
+
+	evalCmd := &cobra.Command{
+		Use:     "eval MODEL [MODEL...]",
+		Short:   "Score models on a suite of prompts with expected answers",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    EvalHandler,
+	}
+
+	evalCmd.Flags().String("suite", "mmlu-mini", fmt.Sprintf("Suite to run, a JSONL file or one of: %s", strings.Join(eval.Builtin(), ", ")))
+	evalCmd.Flags().String("match", eval.MatchExact, "How responses are scored when a case doesn't say: exact, regex or judge")
+	evalCmd.Flags().String("judge", "", "Model which scores the cases matched by judge")
+	evalCmd.Flags().Int("max-tokens", 256, "Most tokens to generate for each case")
+	evalCmd.Flags().BoolP("verbose", "v", false, "Show the cases each model failed")
+
 	pullCmd := &cobra.Command{
 		Use:     "pull MODEL",
 		Short:   "Pull a model from a registry",
-		Args:    cobra.ExactArgs(1),
+		Args:    cobra.RangeArgs(0, 1),
 		PreRunE: checkServerHeartbeat,
-		RunE:    PullHandler,
+		RunE:    withNotify(PullHandler),
 	}
 
 	pullCmd.Flags().Bool("insecure", false, "Use an insecure registry")
+	pullCmd.Flags().Bool("wait", false, "Wait if another process is changing the model store")
+	pullCmd.Flags().String("url", "", "Create the model from a GGUF file on a web server, with its checksum in ?sha256= or <url>.sha256")
+	pullCmd.Flags().Bool("accept-license", false, "Accept the model's license when the server requires it")
+	addNotifyFlag(pullCmd, "Send a desktop notification when the pull is done")
+
+	shareCmd := &cobra.Command{
+		Use:     "share MODEL",
+		Short:   "Share a model for another machine to pull",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    ShareHandler,
+	}
+
+	shareCmd.Flags().Duration("duration", time.Hour, "How long the share lasts")
+
+	logsCmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show the server log",
+		Args:  cobra.ExactArgs(0),
+		RunE:  LogsHandler,
+	}
+
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep printing the log as it is written")
+	logsCmd.Flags().IntP("lines", "n", 100, "Number of lines to show")
 
 	pushCmd := &cobra.Command{
 		Use:     "push MODEL",
@@ -1299,6 +1773,18 @@ func NewCLI() *cobra.Command {
 		RunE:    ListHandler,
 	}
 
+	listCmd.Flags().StringArray("filter", nil, "Only list models with a label, as key=value or key, may be repeated")
+
+	topCmd := &cobra.Command{
+		Use:     "top",
+		Short:   "Show loaded models, resource usage and request load as it changes",
+		Args:    cobra.NoArgs,
+		PreRunE: checkServerHeartbeat,
+		RunE:    TopHandler,
+	}
+
+	topCmd.Flags().Duration("interval", time.Second, "Time between updates")
+
 	copyCmd := &cobra.Command{
 		Use:     "cp SOURCE TARGET",
 		Short:   "Copy a model",
@@ -1307,6 +1793,8 @@ func NewCLI() *cobra.Command {
 		RunE:    CopyHandler,
 	}
 
+	addConfirmFlags(copyCmd, true)
+
 	deleteCmd := &cobra.Command{
 		Use:     "rm MODEL [MODEL...]",
 		Short:   "Remove a model",
@@ -1315,16 +1803,97 @@ func NewCLI() *cobra.Command {
 		RunE:    DeleteHandler,
 	}
 
+	deleteCmd.Flags().Bool("purge", false, "Delete the model and its layers now instead of moving it to the trash")
+	addConfirmFlags(deleteCmd, true)
+
+	restoreCmd := &cobra.Command{
+		Use:     "restore [MODEL...]",
+		Short:   "Restore a removed model, or list those which can be restored",
+		PreRunE: checkServerHeartbeat,
+		RunE:    RestoreHandler,
+	}
+
+	presetCmd := &cobra.Command{
+		Use:   "preset",
+		Short: "Manage presets of a model, system message and parameters",
+	}
+
+	presetCreateCmd := &cobra.Command{
+		Use:     "create NAME",
+		Short:   "Create or replace a preset",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: checkServerHeartbeat,
+		RunE:    CreatePresetHandler,
+	}
+
+	presetCreateCmd.Flags().StringP("model", "m", "", "Model used by the preset")
+	presetCreateCmd.Flags().StringP("system", "s", "", "System message")
+	presetCreateCmd.Flags().StringArrayP("parameter", "p", nil, "Model parameter as name=value (e.g. temperature=0.2), may be repeated")
+	presetCreateCmd.MarkFlagRequired("model")
+
+	presetCmd.AddCommand(
+		presetCreateCmd,
+		&cobra.Command{
+			Use:     "list",
+			Aliases: []string{"ls"},
+			Short:   "List presets",
+			PreRunE: checkServerHeartbeat,
+			RunE:    ListPresetsHandler,
+		},
+		&cobra.Command{
+			Use:     "show NAME",
+			Short:   "Show a preset",
+			Args:    cobra.ExactArgs(1),
+			PreRunE: checkServerHeartbeat,
+			RunE:    ShowPresetHandler,
+		},
+		&cobra.Command{
+			Use:     "rm NAME [NAME...]",
+			Short:   "Remove presets",
+			Args:    cobra.MinimumNArgs(1),
+			PreRunE: checkServerHeartbeat,
+			RunE:    DeletePresetHandler,
+		},
+	)
+
+	templateCmd := &cobra.Command{
+		Use:   "template",
+		Short: "Test the templates of models",
+	}
+
+	templateTestCmd := &cobra.Command{
+		Use:   "test DIR [DIR...]",
+		Short: "Render the conversations in template test corpora and compare them with their golden files",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  TemplateTestHandler,
+	}
+
+	templateTestCmd.Flags().StringP("model", "m", "", "Test the template of a model instead of the corpus' template")
+	templateTestCmd.Flags().Bool("update", false, "Write the rendered prompts to the golden files")
+	templateCmd.AddCommand(templateTestCmd)
+
 	rootCmd.AddCommand(
 		serveCmd,
+		migrateCmd,
 		createCmd,
+		importCmd,
 		showCmd,
 		runCmd,
+		transcribeCmd,
+		imagineCmd,
+		replayCmd,
+		evalCmd,
 		pullCmd,
 		pushCmd,
+		shareCmd,
 		listCmd,
+		topCmd,
+		logsCmd,
 		copyCmd,
 		deleteCmd,
+		restoreCmd,
+		presetCmd,
+		templateCmd,
 	)
 
 	return rootCmd
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// generateServer answers generate requests with the prompt and system message, prompts of "fail" fail
+func generateServer(t *testing.T) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/load":
+			json.NewEncoder(w).Encode(api.LoadResponse{Model: "test"})
+		case "/api/generate":
+			var req api.GenerateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if req.Prompt == "fail" {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "the model failed"})
+				return
+			}
+
+			json.NewEncoder(w).Encode(api.GenerateResponse{
+				Model:    req.Model,
+				Response: "answer to\n  " + strings.TrimSpace(req.System+" "+req.Prompt),
+				Done:     true,
+				Context:  []int{1, 2, 3},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+}
+
+func TestGenerateStdinStream(t *testing.T) {
+	generateServer(t)
+
+	cases := map[string]struct {
+		input    string
+		template string
+		output   string
+		err      string
+	}{
+		"plain":     {"one\n\ntwo\n", "", "answer to one\nanswer to two\n", ""},
+		"json":      {`{"prompt": "one", "system": "be brief"}`, "", `{"model":"test","created_at":"0001-01-01T00:00:00Z","response":"answer to\n  be brief one","done":true}` + "\n", ""},
+		"mixed":     {"one\n{\"prompt\": \"two\"}\n", "", "answer to one\n" + `{"model":"test","created_at":"0001-01-01T00:00:00Z","response":"answer to\n  two","done":true}` + "\n", ""},
+		"template":  {"one\n", `{{ .Model }}\t{{ .Response }}`, "test\tanswer to one\n", ""},
+		"failed":    {"one\nfail\ntwo\n", "", "answer to one\n\nanswer to two\n", "1 prompt(s) failed"},
+		"json fail": {"{\"prompt\": \"fail\"}\n{\"prompt\": \"one\"}\n", "", `{"error":"the model failed"}` + "\n" + `{"model":"test","created_at":"0001-01-01T00:00:00Z","response":"answer to\n  one","done":true}` + "\n", "1 prompt(s) failed"},
+		"bad json":  {"{\"prompt\": \n{\"prompt\": \"fail\"}\none\n", "", `{"error":"invalid JSON prompt: unexpected end of JSON input"}` + "\n" + `{"error":"the model failed"}` + "\nanswer to one\n", "2 prompt(s) failed"},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+
+			opts := generateOptions{Model: "test"}
+			if tt.template != "" {
+				tmpl, err := parseOutputTemplate(tt.template)
+				require.NoError(t, err)
+				opts.OutputTemplate = tmpl
+			}
+
+			var w strings.Builder
+			err := generateStdinStream(cmd, opts, strings.NewReader(tt.input), &w)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.output, w.String())
+		})
+	}
+}
+
+func TestParseOutputTemplate(t *testing.T) {
+	cases := map[string]string{
+		`{{ .Response }}`:               "answer",
+		`{{ .Model }}\t{{ .Response }}`: "test\tanswer",
+		`{{ .Response }}\n---`:          "answer\n---",
+		`a\\tb`:                         `a\tb`,
+		`\\\n`:                          "\\\n",
+		`{{ .EvalCount }}`:              "3",
+	}
+
+	for s, want := range cases {
+		tmpl, err := parseOutputTemplate(s)
+		require.NoError(t, err, s)
+
+		var sb strings.Builder
+		require.NoError(t, tmpl.Execute(&sb, api.GenerateResponse{Model: "test", Response: "answer", Metrics: api.Metrics{EvalCount: 3}}), s)
+		assert.Equal(t, want, sb.String(), s)
+	}
+
+	_, err := parseOutputTemplate(`{{ .Response `)
+	assert.ErrorContains(t, err, "invalid output template")
+}
+
+func TestExecuteOutputTemplate(t *testing.T) {
+	resp := api.GenerateResponse{
+		Model:        "test",
+		Response:     "the answer",
+		Thinking:     "the reasoning",
+		FinishReason: "length",
+		Metrics:      api.Metrics{TotalDuration: 1500 * time.Millisecond, EvalCount: 3},
+	}
+
+	tmpl, err := parseOutputTemplate(`{{ .Thinking }}|{{ .Response }}|{{ .FinishReason }}|{{ .EvalCount }}|{{ .TotalDuration }}|{{ .TotalDuration.Milliseconds }}`)
+	require.NoError(t, err)
+
+	// the output ends with a newline
+	var w strings.Builder
+	require.NoError(t, executeOutputTemplate(&w, tmpl, resp))
+	assert.Equal(t, "the reasoning|the answer|length|3|1.5s|1500\n", w.String())
+
+	// fields which don't exist fail when the template is executed, not when it is parsed
+	tmpl, err = parseOutputTemplate(`{{ .Missing }}`)
+	require.NoError(t, err)
+
+	w.Reset()
+	assert.ErrorContains(t, executeOutputTemplate(&w, tmpl, resp), "output template")
+	assert.Empty(t, w.String())
+}
+
+func TestGenerateOutputTemplateThinking(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		enc.Encode(api.GenerateResponse{Model: "test", Thinking: "first, "})
+		enc.Encode(api.GenerateResponse{Model: "test", Thinking: "then"})
+		enc.Encode(api.GenerateResponse{Model: "test", Response: "the answer"})
+		enc.Encode(api.GenerateResponse{Model: "test", Done: true})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+
+	tmpl, err := parseOutputTemplate(`{{ .Thinking }}|{{ .Response }}`)
+	require.NoError(t, err)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("verbose", false, "")
+	cmd.SetContext(context.Background())
+
+	// the output template is written to stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = stdout })
+
+	// thinking isn't shown, but the template still has it
+	require.NoError(t, generate(cmd, generateOptions{Model: "test", Prompt: "why?", OutputTemplate: tmpl}))
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "first, then|the answer\n", string(out))
+}
+
+func TestStatusLine(t *testing.T) {
+	remaining := 3000
+	resp := api.GenerateResponse{Metrics: api.Metrics{
+		PromptEvalCount:  900,
+		EvalCount:        196,
+		EvalDuration:     4 * time.Second,
+		ContextRemaining: &remaining,
+	}}
+
+	opts := generateOptions{Model: "llama2", Options: map[string]interface{}{"temperature": 0.2, "num_ctx": 4096, "seed": 42}}
+	assert.Equal(t, "llama2 | context 1096/4096 tokens | 49.0 tokens/s | num_ctx=4096 | seed=42 | temperature=0.2", statusLine(opts, resp, 0))
+
+	// the line is cut to the terminal width rather than wrapped
+	assert.Equal(t, "llama2 | context 1096/4096 tokens", statusLine(opts, resp, 33))
+
+	// older servers don't report the context window, nor is the speed known before anything is generated
+	opts = generateOptions{Model: "llama2"}
+	assert.Equal(t, "llama2 | context 3 tokens", statusLine(opts, api.GenerateResponse{Context: []int{1, 2, 3}}, 80))
+}
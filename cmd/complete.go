@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+var (
+	slashCommands = []string{"/set", "/show", "/model", "/list", "/fork", "/branches", "/snippet", "/export", "/attach", "/continue", "/bye", "/help"}
+
+	setCommands = []string{
+		"parameter", "system", "template", "var", "novar", "embedmodel", "history", "nohistory",
+		"wordwrap", "nowordwrap", "format", "noformat", "think", "nothink", "agent", "noagent", "statusbar", "nostatusbar", "verbose", "quiet",
+	}
+)
+
+// completer completes slash commands, their arguments and model names in interactive mode
+type completer struct {
+	ctx    context.Context
+	client *api.Client
+
+	// models are listed once and cached for the session
+	models []string
+}
+
+func (c *completer) modelNames() []string {
+	if c.models == nil {
+		c.models = []string{}
+		if resp, err := c.client.List(c.ctx); err == nil {
+			for _, m := range resp.Models {
+				c.models = append(c.models, m.Name)
+			}
+		}
+	}
+
+	return c.models
+}
+
+func parameterNames() []string {
+	opts := api.DefaultOptions()
+
+	var names []string
+	for name := range opts.Map() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Complete returns the completions of the last word of a slash command
+func (c *completer) Complete(line string) []string {
+	if !strings.HasPrefix(line, "/") {
+		return nil
+	}
+
+	fields := strings.Fields(line)
+	word := ""
+	if !strings.HasSuffix(line, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+
+	var options []string
+	switch strings.Join(fields, " ") {
+	case "":
+		options = slashCommands
+	case "/set":
+		options = setCommands
+	case "/set parameter":
+		options = parameterNames()
+	case "/set format":
+		options = []string{"json"}
+	case "/show":
+		options = []string{"license", "modelfile", "parameters", "system", "template"}
+	case "/snippet":
+		options = []string{"save", "insert", "list", "delete"}
+	case "/snippet insert", "/snippet delete":
+		options, _ = listSnippets()
+	case "/export":
+		options = []string{"markdown", "json"}
+	case "/help", "/?":
+		options = []string{"set", "show", "fork", "branches", "snippet"}
+	case "/model", "/list", "/set embedmodel":
+		options = c.modelNames()
+	}
+
+	head := line[:len(line)-len(word)]
+
+	var completions []string
+	for _, option := range options {
+		if strings.HasPrefix(option, word) {
+			completions = append(completions, head+option)
+		}
+	}
+
+	return completions
+}
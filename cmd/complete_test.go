@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestComplete(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	require.NoError(t, saveSnippet("review", "Review this code:"))
+
+	var lists int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lists++
+		json.NewEncoder(w).Encode(api.ListResponse{Models: []api.ModelResponse{{Name: "llama2:latest"}, {Name: "llava:latest"}, {Name: "mistral:latest"}}})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+
+	client, err := api.ClientFromEnvironment()
+	require.NoError(t, err)
+
+	c := &completer{ctx: context.Background(), client: client}
+
+	var set []string
+	for _, command := range setCommands {
+		set = append(set, "/set "+command)
+	}
+
+	cases := map[string][]string{
+		"hello":                  nil,
+		"/":                      slashCommands,
+		"/sh":                    {"/show"},
+		"/set th":                {"/set think"},
+		"/set ":                  set,
+		"/set parameter num_c":   {"/set parameter num_ctx"},
+		"/set parameter  top_":   {"/set parameter  top_k", "/set parameter  top_p"},
+		"/show m":                {"/show modelfile"},
+		"/snippet insert r":      {"/snippet insert review"},
+		"/model ll":              {"/model llama2:latest", "/model llava:latest"},
+		"/set embedmodel mis":    {"/set embedmodel mistral:latest"},
+		"/set system Be concise": nil,
+		"/unknown ":              nil,
+	}
+
+	for line, want := range cases {
+		assert.Equal(t, want, c.Complete(line), line)
+	}
+
+	// models are listed once a session
+	assert.Equal(t, 1, lists)
+}
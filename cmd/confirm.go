@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/format"
+)
+
+// stdinIsTerminal reports whether someone can answer a question, tests replace it
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// addConfirmFlags adds --yes and --force to a command which asks before removing or overwriting a model. -f is
+// left out on commands which use it for something else.
+func addConfirmFlags(cmd *cobra.Command, shortForce bool) {
+	cmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+	if shortForce {
+		cmd.Flags().BoolP("force", "f", false, "Don't ask for confirmation")
+	} else {
+		cmd.Flags().Bool("force", false, "Don't ask for confirmation")
+	}
+}
+
+// confirmModelChange asks before a local model is removed or overwritten, showing its size. Nothing is asked
+// if the model doesn't exist, --yes or --force is passed, or stdin isn't a terminal, so scripts keep working.
+func confirmModelChange(cmd *cobra.Command, client *api.Client, name, verb string) error {
+	yes, _ := cmd.Flags().GetBool("yes")
+	force, _ := cmd.Flags().GetBool("force")
+	if yes || force || !stdinIsTerminal() {
+		return nil
+	}
+
+	size, err := modelSize(cmd.Context(), client, name)
+	if err != nil || size < 0 {
+		return err
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s '%s' (%s)? [y/N] ", verb, name, format.HumanBytes(size))
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return ErrNotConfirmed
+}
+
+// modelSize is the size of a local model's layers, -1 if there is no such model
+func modelSize(ctx context.Context, client *api.Client, name string) (int64, error) {
+	resp, err := client.Show(ctx, &api.ShowRequest{Name: name})
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return -1, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, layer := range resp.Layers {
+		size += layer.Size
+	}
+
+	return size, nil
+}
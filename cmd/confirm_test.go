@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestConfirmModelChange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.ShowRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Name != "llama2" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "model not found"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(api.ShowResponse{Layers: []api.LayerResponse{{Size: 3_000_000_000}, {Size: 800_000_000}}})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+
+	client, err := api.ClientFromEnvironment()
+	require.NoError(t, err)
+
+	terminal := true
+	isTerminal := stdinIsTerminal
+	t.Cleanup(func() { stdinIsTerminal = isTerminal })
+	stdinIsTerminal = func() bool { return terminal }
+
+	confirm := func(name, answer string, flags ...string) (string, error) {
+		cmd := &cobra.Command{Use: "rm"}
+		addConfirmFlags(cmd, true)
+		require.NoError(t, cmd.ParseFlags(flags))
+		cmd.SetContext(context.Background())
+		cmd.SetIn(strings.NewReader(answer))
+
+		var stderr strings.Builder
+		cmd.SetErr(&stderr)
+
+		err := confirmModelChange(cmd, client, name, "Delete")
+		return stderr.String(), err
+	}
+
+	question, err := confirm("llama2", "y\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "Delete 'llama2' (3.8 GB)? [y/N] ", question)
+
+	_, err = confirm("llama2", " YES \n")
+	assert.NoError(t, err)
+
+	// anything but yes, including no answer, leaves the model alone
+	for _, answer := range []string{"n\n", "\n", "", "sure\n"} {
+		_, err := confirm("llama2", answer)
+		assert.ErrorIs(t, err, ErrNotConfirmed, answer)
+	}
+
+	// nothing is asked when there is nothing to lose, the user said so already, or no one can answer
+	for _, flags := range [][]string{{"--yes"}, {"-y"}, {"--force"}, {"-f"}} {
+		question, err := confirm("llama2", "", flags...)
+		assert.NoError(t, err, flags)
+		assert.Empty(t, question, flags)
+	}
+
+	question, err = confirm("missing", "")
+	assert.NoError(t, err)
+	assert.Empty(t, question)
+
+	terminal = false
+	question, err = confirm("llama2", "")
+	assert.NoError(t, err)
+	assert.Empty(t, question)
+}
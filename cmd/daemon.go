@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/server"
+)
+
+const (
+	// daemonStartTimeout is how long a server started in the background has to answer
+	daemonStartTimeout = 10 * time.Second
+
+	// daemonStopTimeout is how long a server has to shut down once it is asked to stop
+	daemonStopTimeout = 10 * time.Second
+)
+
+// pidFile is the file with the process ID of the server running in the background, $OLLAMA_PIDFILE or
+// ~/.ollama/ollama.pid
+func pidFile() (string, error) {
+	if path := os.Getenv("OLLAMA_PIDFILE"); path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "ollama.pid"), nil
+}
+
+// readPidFile returns the process ID in the pidfile, or 0 when there is no pidfile or its process has exited.
+// A pidfile left behind by a process which has exited is removed.
+func readPidFile(path string) (int, error) {
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(bts)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pidfile %s: %w", path, err)
+	}
+
+	if !processRunning(pid) {
+		return 0, os.Remove(path)
+	}
+
+	return pid, nil
+}
+
+// startDaemon starts ollama serve in the background, detached from the terminal, and writes its pidfile. It
+// returns once the server answers.
+func startDaemon(cmd *cobra.Command) error {
+	path, err := pidFile()
+	if err != nil {
+		return err
+	}
+
+	if pid, err := readPidFile(path); err != nil {
+		return err
+	} else if pid > 0 {
+		return fmt.Errorf("ollama is already running in the background (pid %d)", pid)
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	// a server started otherwise would make the new one fail to listen, while answering for it
+	if err := client.Heartbeat(cmd.Context()); err == nil {
+		return errors.New("ollama is already running")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// the server's output is in its log, so its standard streams are left unconnected
+	c := exec.Command(exe, "serve")
+	detach(c)
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, []byte(strconv.Itoa(c.Process.Pid)+"\n"), 0o644); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- c.Wait()
+	}()
+
+	logs := "the server log"
+	if dir, err := server.LogDir(); err == nil {
+		logs = filepath.Join(dir, "server.log")
+	}
+
+	timeout := time.After(daemonStartTimeout)
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-exited:
+			os.Remove(path)
+			return fmt.Errorf("ollama exited as it started (%v), see %s", err, logs)
+		case <-timeout:
+			return fmt.Errorf("ollama didn't answer within %s of starting, see %s", daemonStartTimeout, logs)
+		case <-tick.C:
+			if err := client.Heartbeat(cmd.Context()); err == nil {
+				fmt.Printf("ollama is running in the background (pid %d), its log is %s\n", c.Process.Pid, logs)
+				return nil
+			}
+		}
+	}
+}
+
+// stopDaemon asks the server in the pidfile to shut down and waits for it to exit
+func stopDaemon(cmd *cobra.Command) error {
+	path, err := pidFile()
+	if err != nil {
+		return err
+	}
+
+	pid, err := readPidFile(path)
+	if err != nil {
+		return err
+	} else if pid == 0 {
+		return ErrNotRunning
+	}
+
+	if err := terminateProcess(pid); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(daemonStopTimeout)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ollama (pid %d) didn't stop within %s", pid, daemonStopTimeout)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	fmt.Printf("stopped ollama (pid %d)\n", pid)
+	return nil
+}
+
+// daemonStatus reports whether the server in the pidfile is running
+func daemonStatus(cmd *cobra.Command) error {
+	path, err := pidFile()
+	if err != nil {
+		return err
+	}
+
+	pid, err := readPidFile(path)
+	if err != nil {
+		return err
+	} else if pid == 0 {
+		return ErrNotRunning
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	if err := client.Heartbeat(cmd.Context()); err != nil {
+		fmt.Printf("ollama is running in the background (pid %d) but isn't answering: %v\n", pid, err)
+		return nil
+	}
+
+	fmt.Printf("ollama is running in the background (pid %d)\n", pid)
+	return nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exitedPid is the process ID of a process which has exited
+func exitedPid(t *testing.T) int {
+	t.Helper()
+
+	c := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, c.Run())
+	return c.Process.Pid
+}
+
+func TestReadPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ollama.pid")
+
+	pid, err := readPidFile(path)
+	require.NoError(t, err)
+	assert.Zero(t, pid)
+
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644))
+	pid, err = readPidFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+	assert.FileExists(t, path)
+
+	// a pidfile left behind by a server which has exited is removed
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(exitedPid(t))+"\n"), 0o644))
+	pid, err = readPidFile(path)
+	require.NoError(t, err)
+	assert.Zero(t, pid)
+	assert.NoFileExists(t, path)
+
+	require.NoError(t, os.WriteFile(path, []byte("ollama\n"), 0o644))
+	_, err = readPidFile(path)
+	assert.ErrorContains(t, err, "invalid pidfile")
+}
+
+func TestDaemonStatusAndStop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the server is stopped with SIGTERM")
+	}
+
+	path := filepath.Join(t.TempDir(), "ollama.pid")
+	t.Setenv("OLLAMA_PIDFILE", path)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+
+	assert.ErrorIs(t, daemonStatus(cmd), ErrNotRunning)
+	assert.ErrorIs(t, stopDaemon(cmd), ErrNotRunning)
+
+	// a stale pidfile isn't taken for a running server, nor is its pid signalled
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(exitedPid(t))+"\n"), 0o644))
+	assert.ErrorIs(t, daemonStatus(cmd), ErrNotRunning)
+	assert.NoFileExists(t, path)
+
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(exitedPid(t))+"\n"), 0o644))
+	assert.ErrorIs(t, stopDaemon(cmd), ErrNotRunning)
+	assert.NoFileExists(t, path)
+
+	// a server in the background, here a test binary waiting for a test which doesn't end
+	c := exec.Command(os.Args[0], "-test.run=^TestDaemonHelperServer$")
+	c.Env = append(os.Environ(), "OLLAMA_TEST_DAEMON=1")
+	require.NoError(t, c.Start())
+	exited := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() { c.Process.Kill() })
+
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(c.Process.Pid)+"\n"), 0o644))
+	assert.NoError(t, daemonStatus(cmd))
+
+	// it is already running
+	assert.ErrorContains(t, startDaemon(cmd), "already running in the background")
+
+	require.NoError(t, stopDaemon(cmd))
+	<-exited
+	assert.NoFileExists(t, path)
+}
+
+// TestDaemonHelperServer isn't a test, it stands in for a server started in the background until it is stopped
+func TestDaemonHelperServer(t *testing.T) {
+	if os.Getenv("OLLAMA_TEST_DAEMON") == "" {
+		return
+	}
+
+	time.Sleep(time.Hour)
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/eval"
+	"github.com/jmorganca/ollama/progress"
+	"github.com/jmorganca/ollama/style"
+)
+
+// evalResult is how a model did on a suite
+type evalResult struct {
+	model    string
+	passed   int
+	tokens   int
+	eval     time.Duration
+	duration time.Duration
+
+	// failures are the cases the model failed, with its responses
+	failures []evalFailure
+}
+
+type evalFailure struct {
+	index    int
+	c        eval.Case
+	response string
+}
+
+// EvalHandler runs a suite through each model and prints a table comparing their scores
+func EvalHandler(cmd *cobra.Command, args []string) error {
+	name, err := cmd.Flags().GetString("suite")
+	if err != nil {
+		return err
+	}
+
+	match, err := cmd.Flags().GetString("match")
+	if err != nil {
+		return err
+	}
+
+	judge, err := cmd.Flags().GetString("judge")
+	if err != nil {
+		return err
+	}
+
+	maxTokens, err := cmd.Flags().GetInt("max-tokens")
+	if err != nil {
+		return err
+	}
+
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return err
+	}
+
+	suite, err := eval.Load(name, match)
+	if err != nil {
+		return err
+	}
+
+	if suite.Judged() && judge == "" {
+		return errors.New("the suite has cases scored by a judge, name the judge model with --judge")
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	// models which aren't there are reported before any of them is evaluated
+	for _, model := range append([]string{judge}, args...) {
+		if model == "" {
+			continue
+		}
+
+		if _, err := client.Show(cmd.Context(), &api.ShowRequest{Name: model}); err != nil {
+			return fmt.Errorf("%s: %w", model, err)
+		}
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.StopAndClear()
+
+	// responses are generated greedily so that models are compared on their most likely answers
+	options := map[string]any{"temperature": 0, "num_predict": maxTokens}
+
+	results := make([]evalResult, len(args))
+	for i, model := range args {
+		spinner := progress.NewSpinner(fmt.Sprintf("evaluating %s on %d cases of %s", model, len(suite.Cases), suite.Name))
+		p.Add(model, spinner)
+
+		result := evalResult{model: model}
+		start := time.Now()
+		for j, c := range suite.Cases {
+			var resp api.GenerateResponse
+			stream := false
+			request := api.GenerateRequest{Model: model, Prompt: c.Prompt, System: c.System, Stream: &stream, Options: options}
+			if err := client.Generate(cmd.Context(), &request, func(r api.GenerateResponse) error {
+				resp = r
+				return nil
+			}); err != nil {
+				return fmt.Errorf("%s: case %d: %w", model, j+1, err)
+			}
+
+			result.tokens += resp.EvalCount
+			result.eval += resp.EvalDuration
+
+			passed := c.Passes(resp.Response)
+			if c.Match == eval.MatchJudge {
+				if passed, err = judged(cmd, client, judge, c, resp.Response); err != nil {
+					return fmt.Errorf("%s: case %d: judge: %w", model, j+1, err)
+				}
+			}
+
+			if passed {
+				result.passed++
+			} else {
+				result.failures = append(result.failures, evalFailure{index: j + 1, c: c, response: resp.Response})
+			}
+		}
+
+		result.duration = time.Since(start)
+		results[i] = result
+		spinner.Stop()
+	}
+
+	p.StopAndClear()
+
+	var data [][]string
+	for _, r := range results {
+		rate := "-"
+		if r.eval > 0 {
+			rate = fmt.Sprintf("%.1f", float64(r.tokens)/r.eval.Seconds())
+		}
+
+		data = append(data, []string{
+			r.model,
+			fmt.Sprintf("%d/%d", r.passed, len(suite.Cases)),
+			fmt.Sprintf("%.1f%%", 100*float64(r.passed)/float64(len(suite.Cases))),
+			rate,
+			r.duration.Round(time.Second).String(),
+		})
+	}
+
+	renderTable(os.Stdout, stdoutWidth(), []string{"MODEL", "PASSED", "SCORE", "TOKENS/S", "DURATION"}, data)
+
+	if verbose {
+		for _, r := range results {
+			for _, f := range r.failures {
+				fmt.Printf("\n%s %s case %d (%s)\n", style.Stdout.Render(style.Error, "FAIL"), r.model, f.index, f.c.Match)
+				fmt.Printf("  prompt:   %q\n  expected: %q\n  response: %q\n", f.c.Prompt, f.c.Expected, f.response)
+			}
+		}
+	}
+
+	return nil
+}
+
+// judged asks the judge model whether the response agrees with the case's expected answer
+func judged(cmd *cobra.Command, client *api.Client, judge string, c eval.Case, response string) (bool, error) {
+	resp, err := client.Classify(cmd.Context(), &api.ClassifyRequest{
+		Model:   judge,
+		System:  eval.JudgeSystem,
+		Prompt:  c.JudgePrompt(response),
+		Choices: eval.JudgeChoices,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var best api.ClassifyChoice
+	for _, choice := range resp.Choices {
+		if choice.Probability > best.Probability {
+			best = choice
+		}
+	}
+
+	return best.Choice == eval.JudgeChoices[0], nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// Exit codes returned by the ollama command so failures can be told apart in shell pipelines.
+const (
+	ExitSuccess     = 0
+	ExitError       = 1
+	ExitConnection  = 2
+	ExitNotFound    = 3
+	ExitOutOfMemory = 4
+	ExitEmpty       = 5
+	ExitCancelled   = 130
+)
+
+var (
+	ErrConnection    = errors.New("could not connect to ollama server")
+	ErrEmptyResponse = errors.New("model returned an empty response")
+	ErrNotConfirmed  = errors.New("cancelled, nothing was changed")
+	ErrNotRunning    = errors.New("ollama isn't running in the background")
+)
+
+// ExitCode maps an error returned by the command to the process exit code
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+
+	var statusErr api.StatusError
+	var urlErr *url.Error
+	var netErr *net.OpError
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrNotConfirmed):
+		return ExitCancelled
+	case errors.Is(err, ErrEmptyResponse):
+		return ExitEmpty
+	case errors.Is(err, ErrConnection), errors.Is(err, ErrNotRunning), errors.Is(err, syscall.ECONNREFUSED), errors.As(err, &urlErr), errors.As(err, &netErr):
+		return ExitConnection
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		return ExitNotFound
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusInsufficientStorage:
+		return ExitOutOfMemory
+	default:
+		return ExitError
+	}
+}
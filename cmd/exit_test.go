@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected int
+	}{
+		"success":       {nil, ExitSuccess},
+		"cancelled":     {fmt.Errorf("pull: %w", context.Canceled), ExitCancelled},
+		"empty":         {ErrEmptyResponse, ExitEmpty},
+		"connection":    {ErrConnection, ExitConnection},
+		"not found":     {api.StatusError{StatusCode: http.StatusNotFound, ErrorMessage: "model 'llama2' not found"}, ExitNotFound},
+		"out of memory": {api.StatusError{StatusCode: http.StatusInsufficientStorage, ErrorMessage: "model requires at least 16 GB of total memory"}, ExitOutOfMemory},
+		// only the status tells an out of memory error apart, not its message
+		"message":      {errors.New("llama runner: out of memory"), ExitError},
+		"server error": {api.StatusError{StatusCode: http.StatusInternalServerError, ErrorMessage: "out of memory"}, ExitError},
+	}
+
+	for name, tt := range cases {
+		assert.Equal(t, tt.expected, ExitCode(tt.err), name)
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/progress"
+	"github.com/jmorganca/ollama/server"
+)
+
+// ImportHandler registers the GGUF models of another tool in the local model store
+func ImportHandler(cmd *cobra.Command, args []string) error {
+	from, err := cmd.Flags().GetString("from")
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(server.ImportSources, from) {
+		return fmt.Errorf("unknown source '%s', use one of %s", from, strings.Join(server.ImportSources, ", "))
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		path, err = server.ImportSourceDir(from)
+		if err != nil {
+			return err
+		}
+	}
+
+	models, err := server.FindImports(path)
+	if err != nil {
+		return err
+	}
+
+	if len(models) == 0 {
+		return fmt.Errorf("no GGUF models found in %s", path)
+	}
+
+	for _, m := range models {
+		if _, _, err := server.GetManifest(server.ParseModelPath(m.Name)); err == nil {
+			fmt.Fprintf(os.Stderr, "skipping %s, '%s' already exists\n", m.Path, m.Name)
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		if dryRun {
+			fmt.Printf("# %s from %s\nFROM %s\n%s\n", m.Name, m.Path, m.Path, m.Modelfile)
+			continue
+		}
+
+		if err := importModel(cmd, m); err != nil {
+			return fmt.Errorf("importing %s: %w", m.Path, err)
+		}
+
+		fmt.Printf("imported %s as '%s'\n", m.Path, m.Name)
+	}
+
+	return nil
+}
+
+func importModel(cmd *cobra.Command, m server.ImportedModel) error {
+	p := progress.NewProgress(os.Stderr)
+	defer p.StopAndClear()
+
+	var status string
+	var spinner *progress.Spinner
+	return server.ImportModel(cmd.Context(), m, func(resp api.ProgressResponse) {
+		if resp.Status == status {
+			return
+		}
+
+		if spinner != nil {
+			spinner.Stop()
+		}
+
+		status = resp.Status
+		spinner = progress.NewSpinner(status)
+		p.Add(status, spinner)
+	})
+}
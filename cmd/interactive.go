@@ -0,0 +1,697 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/readline"
+)
+
+// errUsage is returned by the commands of the interactive mode when they are used wrongly, so their usage
+// is shown
+var errUsage = errors.New("usage")
+
+type MultilineState int
+
+const (
+	MultilineNone MultilineState = iota
+	MultilinePrompt
+	MultilineSystem
+	MultilineTemplate
+	MultilineSnippet
+)
+
+func modelIsMultiModal(cmd *cobra.Command, name string) bool {
+	// get model details
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: couldn't connect to ollama server")
+		return false
+	}
+
+	req := api.ShowRequest{Name: name}
+	resp, err := client.Show(cmd.Context(), &req)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(resp.Details.Families, "clip")
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Available Commands:")
+	fmt.Fprintln(os.Stderr, "  /set         Set session variables")
+	fmt.Fprintln(os.Stderr, "  /show        Show model information")
+	fmt.Fprintln(os.Stderr, "  /model       Show or switch the model")
+	fmt.Fprintln(os.Stderr, "  /fork        Branch the conversation")
+	fmt.Fprintln(os.Stderr, "  /branches    List or switch conversation branches")
+	fmt.Fprintln(os.Stderr, "  /snippet     Save or insert prompt snippets")
+	fmt.Fprintln(os.Stderr, "  /export      Export the conversation to a file")
+	fmt.Fprintln(os.Stderr, "  /attach      Attach a document to ask questions about")
+	fmt.Fprintln(os.Stderr, "  /continue    Continue the last response")
+	fmt.Fprintln(os.Stderr, "  /bye         Exit")
+	fmt.Fprintln(os.Stderr, "  /?, /help    Help for a command")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Use \"\"\" to begin a multi-line message.")
+	fmt.Fprintln(os.Stderr, "")
+}
+
+func usageSet() {
+	fmt.Fprintln(os.Stderr, "Available Commands:")
+	fmt.Fprintln(os.Stderr, "  /set parameter ...     Set a parameter")
+	fmt.Fprintln(os.Stderr, "  /set system <string>   Set system message")
+	fmt.Fprintln(os.Stderr, "  /set template <string> Set prompt template")
+	fmt.Fprintln(os.Stderr, "  /set var name=value    Set a variable to substitute for {{name}} in prompts")
+	fmt.Fprintln(os.Stderr, "  /set novar name        Remove a variable")
+	fmt.Fprintln(os.Stderr, "  /set embedmodel <name> Set the model used to embed attached documents")
+	fmt.Fprintln(os.Stderr, "  /set history           Enable history")
+	fmt.Fprintln(os.Stderr, "  /set nohistory         Disable history")
+	fmt.Fprintln(os.Stderr, "  /set wordwrap          Enable wordwrap")
+	fmt.Fprintln(os.Stderr, "  /set nowordwrap        Disable wordwrap")
+	fmt.Fprintln(os.Stderr, "  /set format json       Enable JSON mode")
+	fmt.Fprintln(os.Stderr, "  /set noformat          Disable formatting")
+	fmt.Fprintln(os.Stderr, "  /set think             Show model thinking")
+	fmt.Fprintln(os.Stderr, "  /set nothink           Hide model thinking")
+	fmt.Fprintln(os.Stderr, "  /set agent             Let the model run tools after confirmation")
+	fmt.Fprintln(os.Stderr, "  /set noagent           Disable agent mode")
+	fmt.Fprintln(os.Stderr, "  /set statusbar         Show a status line after each response")
+	fmt.Fprintln(os.Stderr, "  /set nostatusbar       Hide the status line")
+	fmt.Fprintln(os.Stderr, "  /set verbose           Show LLM stats")
+	fmt.Fprintln(os.Stderr, "  /set quiet             Disable LLM stats")
+	fmt.Fprintln(os.Stderr, "")
+}
+
+func usageShow() {
+	fmt.Fprintln(os.Stderr, "Available Commands:")
+	fmt.Fprintln(os.Stderr, "  /show license      Show model license")
+	fmt.Fprintln(os.Stderr, "  /show modelfile    Show Modelfile for this model")
+	fmt.Fprintln(os.Stderr, "  /show parameters   Show parameters for this model")
+	fmt.Fprintln(os.Stderr, "  /show prompt       Show the last prompt sent to the model")
+	fmt.Fprintln(os.Stderr, "  /show system       Show system message")
+	fmt.Fprintln(os.Stderr, "  /show template     Show prompt template")
+	fmt.Fprintln(os.Stderr, "")
+}
+
+// only list out the most common parameters
+func usageParameters() {
+	fmt.Fprintln(os.Stderr, "Available Parameters:")
+	fmt.Fprintln(os.Stderr, "  /set parameter seed <int>             Random number seed")
+	fmt.Fprintln(os.Stderr, "  /set parameter num_predict <int>      Max number of tokens to predict")
+	fmt.Fprintln(os.Stderr, "  /set parameter top_k <int>            Pick from top k num of tokens")
+	fmt.Fprintln(os.Stderr, "  /set parameter top_p <float>          Pick token based on sum of probabilities")
+	fmt.Fprintln(os.Stderr, "  /set parameter num_ctx <int>          Set the context size")
+	fmt.Fprintln(os.Stderr, "  /set parameter temperature <float>    Set creativity level")
+	fmt.Fprintln(os.Stderr, "  /set parameter repeat_penalty <float> How strongly to penalize repetitions")
+	fmt.Fprintln(os.Stderr, "  /set parameter repeat_last_n <int>    Set how far back to look for repetitions")
+	fmt.Fprintln(os.Stderr, "  /set parameter num_gpu <int>          The number of layers to send to the GPU")
+	fmt.Fprintln(os.Stderr, "  /set parameter stop \"<string>\", ...   Set one or more stop sequences, quote values containing spaces")
+	fmt.Fprintln(os.Stderr, "")
+}
+
+func generateInteractive(cmd *cobra.Command, opts generateOptions) error {
+	// an agent is stopped when /set agent or /set noagent replaces it, and the last one when the session ends
+	defer func() {
+		if opts.Agent != nil {
+			opts.Agent.Close()
+		}
+	}()
+
+	multiModal := modelIsMultiModal(cmd, opts.Model)
+
+	if err := loadModel(cmd, opts.Model); err != nil {
+		return err
+	}
+
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	scanner, err := readline.New(readline.Prompt{
+		Prompt:         ">>> ",
+		AltPrompt:      "... ",
+		Placeholder:    "Send a message (/? for help)",
+		AltPlaceholder: `Use """ to end multi-line input`,
+	})
+	if err != nil {
+		return err
+	}
+
+	completions := &completer{ctx: cmd.Context(), client: client}
+	scanner.Completer = completions.Complete
+
+	fmt.Print(readline.StartBracketedPaste)
+	defer fmt.Printf(readline.EndBracketedPaste)
+
+	// confirm asks a yes or no question, used to confirm tool calls in agent mode
+	confirm := func(question string) bool {
+		saved, history := *scanner.Prompt, scanner.History.Enabled
+		defer func() {
+			*scanner.Prompt = saved
+			scanner.History.Enabled = history
+		}()
+
+		scanner.Prompt.Prompt = question + " [y/N] "
+		scanner.Prompt.Placeholder = ""
+		scanner.Prompt.UseAlt = false
+		scanner.HistoryDisable()
+
+		line, err := scanner.Readline()
+		if err != nil {
+			return false
+		}
+
+		answer := strings.ToLower(strings.TrimSpace(line))
+		return answer == "y" || answer == "yes"
+	}
+
+	if opts.Agent != nil {
+		opts.Agent.confirm = confirm
+	}
+
+	var multiline MultilineState
+	var prompt string
+	// snippet is the name of the multi-line snippet being saved
+	var snippet string
+
+	branches := newConversationBranches()
+	vars := make(map[string]string)
+	attached := &attachments{model: opts.Model}
+
+	for {
+		line, err := scanner.Readline()
+		switch {
+		case errors.Is(err, io.EOF):
+			fmt.Println()
+			return nil
+		case errors.Is(err, readline.ErrInterrupt):
+			if line == "" {
+				fmt.Println("\nUse Ctrl-D or /bye to exit.")
+			}
+
+			scanner.Prompt.UseAlt = false
+			prompt = ""
+
+			continue
+		case err != nil:
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(prompt, `"""`):
+			// if the prompt so far starts with """ then we're in multiline mode
+			// and we need to keep reading until we find a line that ends with """
+			cut, found := strings.CutSuffix(line, `"""`)
+			prompt += cut
+
+			if !found {
+				prompt += "\n"
+				continue
+			}
+
+			prompt = strings.TrimPrefix(prompt, `"""`)
+			scanner.Prompt.UseAlt = false
+
+			switch multiline {
+			case MultilineSystem:
+				opts.System = prompt
+				prompt = ""
+				fmt.Println("Set system message.")
+			case MultilineTemplate:
+				opts.Template = prompt
+				prompt = ""
+				fmt.Println("Set prompt template.")
+			case MultilineSnippet:
+				if err := saveSnippet(snippet, prompt); err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				} else {
+					fmt.Printf("Saved snippet '%s'.\n", snippet)
+				}
+				prompt = ""
+			}
+			multiline = MultilineNone
+		case strings.HasPrefix(line, `"""`) && len(prompt) == 0:
+			scanner.Prompt.UseAlt = true
+			multiline = MultilinePrompt
+			prompt += line + "\n"
+			continue
+		case scanner.Pasting:
+			prompt += line + "\n"
+			continue
+		case strings.HasPrefix(line, "/model"):
+			args := strings.Fields(line)
+			if len(args) == 1 {
+				fmt.Printf("Using model '%s'.\n", opts.Model)
+				continue
+			}
+
+			if err := loadModel(cmd, args[1]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				continue
+			}
+
+			opts.Model = args[1]
+			opts.Images = nil
+			multiModal = modelIsMultiModal(cmd, opts.Model)
+
+			// the context is made of the previous model's tokens
+			cmd.SetContext(context.WithValue(cmd.Context(), generateContextKey("context"), []int{}))
+			fmt.Printf("Switched to model '%s'.\n", args[1])
+		case strings.HasPrefix(line, "/list"):
+			args := strings.Fields(line)
+			if err := ListHandler(cmd, args[1:]); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "/set"):
+			args := strings.Fields(line)
+			if len(args) > 1 {
+				switch args[1] {
+				case "history":
+					scanner.HistoryEnable()
+				case "nohistory":
+					scanner.HistoryDisable()
+				case "wordwrap":
+					opts.WordWrap = true
+					fmt.Println("Set 'wordwrap' mode.")
+				case "nowordwrap":
+					opts.WordWrap = false
+					fmt.Println("Set 'nowordwrap' mode.")
+				case "think":
+					opts.Think = true
+					fmt.Println("Set 'think' mode.")
+				case "nothink":
+					opts.Think = false
+					fmt.Println("Set 'nothink' mode.")
+				case "agent":
+					allowed, err := cmd.Flags().GetStringSlice("agent-allow")
+					if err != nil {
+						return err
+					}
+					if opts.Agent != nil {
+						opts.Agent.Close()
+					}
+					opts.Agent, err = newAgent(cmd.Context(), allowed, confirm)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "error: %v\n", err)
+						continue
+					}
+					fmt.Println("Set 'agent' mode.")
+				case "noagent":
+					if opts.Agent != nil {
+						opts.Agent.Close()
+					}
+					opts.Agent = nil
+					fmt.Println("Set 'noagent' mode.")
+				case "statusbar":
+					opts.StatusBar = true
+					fmt.Println("Set 'statusbar' mode.")
+				case "nostatusbar":
+					opts.StatusBar = false
+					fmt.Println("Set 'nostatusbar' mode.")
+				case "verbose":
+					cmd.Flags().Set("verbose", "true")
+					fmt.Println("Set 'verbose' mode.")
+				case "quiet":
+					cmd.Flags().Set("verbose", "false")
+					fmt.Println("Set 'quiet' mode.")
+				case "format":
+					if len(args) < 3 || args[2] != "json" {
+						fmt.Println("Invalid or missing format. For 'json' mode use '/set format json'")
+					} else {
+						opts.Format = args[2]
+						fmt.Printf("Set format to '%s' mode.\n", args[2])
+					}
+				case "noformat":
+					opts.Format = ""
+					fmt.Println("Disabled format.")
+				case "embedmodel":
+					if len(args) < 3 {
+						usageSet()
+						continue
+					}
+					files := attached.files
+					attached = &attachments{model: args[2]}
+					fmt.Printf("Set embedding model to '%s'.\n", args[2])
+					for _, file := range files {
+						if _, err := attached.Attach(cmd.Context(), client, file); err != nil {
+							fmt.Fprintf(os.Stderr, "error: couldn't attach '%s': %v\n", file, err)
+						}
+					}
+				case "var", "novar":
+					if err := varCommand(os.Stdout, args, vars); errors.Is(err, errUsage) {
+						usageSet()
+					} else if err != nil {
+						fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					}
+				case "parameter":
+					if len(args) < 4 {
+						usageParameters()
+						continue
+					}
+					// split the raw values so quoted values keep their spacing
+					params, err := api.SplitParamValues(parameterValues.ReplaceAllString(line, ""))
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Couldn't set parameter: %q\n\n", err)
+						continue
+					}
+					fp, err := api.FormatParams(map[string][]string{args[2]: params})
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Couldn't set parameter: %q\n\n", err)
+						continue
+					}
+					fmt.Printf("Set parameter '%s' to %s\n\n", args[2], formatParamValues(params))
+					opts.Options[args[2]] = fp[args[2]]
+				case "system", "template":
+					if len(args) < 3 {
+						usageSet()
+						continue
+					}
+					line := strings.Join(args[2:], " ")
+					line = strings.TrimPrefix(line, `"""`)
+					if strings.HasPrefix(args[2], `"""`) {
+						cut, found := strings.CutSuffix(line, `"""`)
+						prompt += cut
+						if found {
+							if args[1] == "system" {
+								opts.System = prompt
+								fmt.Println("Set system message.")
+							} else {
+								opts.Template = prompt
+								fmt.Println("Set prompt template.")
+							}
+							prompt = ""
+						} else {
+							prompt = `"""` + prompt + "\n"
+							if args[1] == "system" {
+								multiline = MultilineSystem
+							} else {
+								multiline = MultilineTemplate
+							}
+							scanner.Prompt.UseAlt = true
+						}
+					} else {
+						opts.System = line
+						fmt.Println("Set system message.")
+					}
+				default:
+					fmt.Printf("Unknown command '/set %s'. Type /? for help\n", args[1])
+				}
+			} else {
+				usageSet()
+			}
+		case strings.HasPrefix(line, "/show"):
+			args := strings.Fields(line)
+			if len(args) > 1 {
+				client, err := api.ClientFromEnvironment()
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error: couldn't connect to ollama server")
+					return err
+				}
+				resp, err := client.Show(cmd.Context(), &api.ShowRequest{Name: opts.Model})
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "error: couldn't get model")
+					return err
+				}
+
+				switch args[1] {
+				case "license":
+					if resp.License == "" {
+						fmt.Print("No license was specified for this model.\n\n")
+					} else {
+						fmt.Println(resp.License)
+					}
+				case "modelfile":
+					fmt.Println(resp.Modelfile)
+				case "parameters":
+					if resp.Parameters == "" {
+						fmt.Print("No parameters were specified for this model.\n\n")
+					} else {
+						if len(opts.Options) > 0 {
+							fmt.Println("User defined parameters:")
+							for k, v := range opts.Options {
+								fmt.Printf("%-*s %v\n", 30, k, v)
+							}
+							fmt.Println()
+						}
+						fmt.Println("Model defined parameters:")
+						fmt.Println(resp.Parameters)
+					}
+				case "prompt":
+					if prompt, _ := cmd.Context().Value(generateContextKey("prompt")).(string); prompt != "" {
+						fmt.Println(prompt + "\n")
+					} else {
+						fmt.Print("No prompt has been sent to the model yet.\n\n")
+					}
+				case "system":
+					switch {
+					case opts.System != "":
+						fmt.Println(opts.System + "\n")
+					case resp.System != "":
+						fmt.Println(resp.System + "\n")
+					default:
+						fmt.Print("No system message was specified for this model.\n\n")
+					}
+				case "template":
+					switch {
+					case opts.Template != "":
+						fmt.Println(opts.Template + "\n")
+					case resp.Template != "":
+						fmt.Println(resp.Template)
+					default:
+						fmt.Print("No prompt template was specified for this model.\n\n")
+					}
+				default:
+					fmt.Printf("Unknown command '/show %s'. Type /? for help\n", args[1])
+				}
+			} else {
+				usageShow()
+			}
+		case strings.HasPrefix(line, "/fork"), strings.HasPrefix(line, "/branches"):
+			if err := branchCommand(cmd, os.Stdout, strings.Fields(line), branches, &opts); errors.Is(err, errUsage) {
+				usageBranches()
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+		case strings.HasPrefix(line, "/attach"):
+			path := normalizeFilePath(strings.TrimSpace(strings.TrimPrefix(line, "/attach")))
+			if path == "" {
+				if len(attached.files) == 0 {
+					fmt.Fprintln(os.Stderr, "Usage:\n  /attach <file>    Attach a .pdf, .md or .txt file")
+					fmt.Fprintln(os.Stderr, "")
+					continue
+				}
+
+				for _, file := range attached.files {
+					fmt.Println(file)
+				}
+				fmt.Println()
+				continue
+			}
+
+			n, err := attached.Attach(cmd.Context(), client, path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				continue
+			}
+
+			fmt.Printf("Attached '%s' (%d chunks).\n", path, n)
+		case strings.HasPrefix(line, "/export"):
+			args := strings.Fields(line)
+			if len(args) != 3 || (args[1] != "markdown" && args[1] != "json") {
+				fmt.Fprintln(os.Stderr, "Usage:\n  /export markdown <file>\n  /export json <file>")
+				fmt.Fprintln(os.Stderr, "")
+				continue
+			}
+
+			if err := opts.Transcript.WriteFile(args[1], args[2]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				continue
+			}
+
+			fmt.Printf("Exported conversation to '%s'.\n", args[2])
+		case strings.HasPrefix(line, "/snippet"):
+			if args := strings.Fields(line); len(args) > 3 && args[1] == "save" {
+				if text, open := snippetText(line); open {
+					prompt = `"""` + text + "\n"
+					snippet = args[2]
+					multiline = MultilineSnippet
+					scanner.Prompt.UseAlt = true
+					continue
+				}
+			}
+
+			text, err := snippetCommand(os.Stdout, line)
+			if errors.Is(err, errUsage) {
+				usageSnippet()
+				continue
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				continue
+			}
+
+			// only /snippet insert has a prompt to send
+			if text == "" {
+				continue
+			}
+
+			prompt = text
+		case line == "/continue":
+			if generateContext, _ := cmd.Context().Value(generateContextKey("context")).([]int); len(generateContext) == 0 {
+				fmt.Println("Nothing to continue.")
+				fmt.Println()
+				continue
+			}
+
+			// pick up where the last response stopped, e.g. when it ran into num_predict
+			cont := opts
+			cont.Prompt = ""
+			cont.Images = nil
+			cont.Continue = true
+			if err := generate(cmd, cont); err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+
+			continue
+		case strings.HasPrefix(line, "/help"), strings.HasPrefix(line, "/?"):
+			args := strings.Fields(line)
+			if len(args) > 1 {
+				switch args[1] {
+				case "set", "/set":
+					usageSet()
+				case "show", "/show":
+					usageShow()
+				case "fork", "/fork", "branches", "/branches":
+					usageBranches()
+				case "snippet", "/snippet":
+					usageSnippet()
+				}
+			} else {
+				usage()
+			}
+		case line == "/exit", line == "/bye":
+			return nil
+		case strings.HasPrefix(line, "/"):
+			args := strings.Fields(line)
+			fmt.Printf("Unknown command '%s'. Type /? for help\n", args[0])
+			continue
+		default:
+			prompt += line
+		}
+
+		if len(prompt) > 0 && multiline == MultilineNone {
+			opts.Typed = prompt
+			opts.Prompt = substituteVars(prompt, vars)
+			if augmented, err := attached.Prompt(cmd.Context(), client, opts.Prompt); err != nil {
+				fmt.Fprintf(os.Stderr, "error: couldn't search attached documents: %v\n", err)
+			} else {
+				opts.Prompt = augmented
+			}
+			if multiModal {
+				newPrompt, images, err := extractFileNames(opts.Prompt)
+				if err != nil {
+					return err
+				}
+				opts.Prompt = newPrompt
+
+				// reset the context if we find another image
+				if len(images) > 0 {
+					opts.Images = images
+					ctx := cmd.Context()
+					ctx = context.WithValue(ctx, generateContextKey("context"), []int{})
+					cmd.SetContext(ctx)
+				}
+				if len(opts.Images) == 0 {
+					fmt.Println("This model requires you to add a jpeg, png, or svg image.")
+					fmt.Println()
+					prompt = ""
+					continue
+				}
+			}
+			if opts.Agent != nil {
+				err = opts.Agent.Run(cmd, opts)
+			} else {
+				err = generate(cmd, opts)
+			}
+
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+
+			prompt = ""
+		}
+	}
+}
+
+// parameterValues matches the start of a /set parameter command up to the values
+var parameterValues = regexp.MustCompile(`^\s*/set\s+parameter\s+\S+\s*`)
+
+// formatParamValues quotes each value so surrounding spaces and separators are visible
+func formatParamValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func normalizeFilePath(fp string) string {
+	// Define a map of escaped characters and their replacements
+	replacements := map[string]string{
+		"\\ ":  " ",  // Escaped space
+		"\\(":  "(",  // Escaped left parenthesis
+		"\\)":  ")",  // Escaped right parenthesis
+		"\\[":  "[",  // Escaped left square bracket
+		"\\]":  "]",  // Escaped right square bracket
+		"\\{":  "{",  // Escaped left curly brace
+		"\\}":  "}",  // Escaped right curly brace
+		"\\$":  "$",  // Escaped dollar sign
+		"\\&":  "&",  // Escaped ampersand
+		"\\;":  ";",  // Escaped semicolon
+		"\\'":  "'",  // Escaped single quote
+		"\\\\": "\\", // Escaped backslash
+		"\\*":  "*",  // Escaped asterisk
+		"\\?":  "?",  // Escaped question mark
+	}
+
+	for escaped, actual := range replacements {
+		fp = strings.ReplaceAll(fp, escaped, actual)
+	}
+	return fp
+}
+
+func extractFileNames(input string) (string, []ImageData, error) {
+	// Regex to match file paths starting with / or ./ and include escaped spaces (\ or %20)
+	// and followed by more characters and a file extension
+	regexPattern := `(?:\./|/)[\S\\ ]+?\.(?i:jpg|jpeg|png|svg)\b`
+	re := regexp.MustCompile(regexPattern)
+
+	filePaths := re.FindAllString(input, -1)
+	var imgs []ImageData
+
+	for _, fp := range filePaths {
+		nfp := normalizeFilePath(fp)
+		data, err := getImageData(nfp)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Couldn't process image: %q\n", err)
+			return "", imgs, err
+		}
+		fmt.Printf("Added image '%s'\n", nfp)
+		input = strings.ReplaceAll(input, fp, "")
+		imgs = append(imgs, data)
+	}
+	return input, imgs, nil
+}
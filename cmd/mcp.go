@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+const mcpProtocolVersion = "2024-11-05"
+
+// mcpStartTimeout limits how long a server may take to start and list its tools
+var mcpStartTimeout = 30 * time.Second
+
+// mcpConfig is read from $OLLAMA_MCP_CONFIG or ~/.ollama/mcp.json, e.g.
+//
+//	{
+//	  "mcpServers": {
+//	    "filesystem": {
+//	      "command": "npx",
+//	      "args": ["-y", "@modelcontextprotocol/server-filesystem", "/home/me/notes"]
+//	    }
+//	  }
+//	}
+type mcpConfig struct {
+	Servers map[string]mcpServerConfig `json:"mcpServers"`
+}
+
+type mcpServerConfig struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+func mcpConfigPath() (string, error) {
+	if path, ok := os.LookupEnv("OLLAMA_MCP_CONFIG"); ok {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "mcp.json"), nil
+}
+
+// loadMCPConfig returns nil if no MCP servers have been configured
+func loadMCPConfig() (*mcpConfig, error) {
+	path, err := mcpConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config mcpConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for name, server := range config.Servers {
+		if server.Command == "" {
+			return nil, fmt.Errorf("%s: server '%s' is missing a command", path, name)
+		}
+	}
+
+	return &config, nil
+}
+
+// mcpTool is a tool advertised by an MCP server
+type mcpTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+type mcpRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// mcpClient talks JSON-RPC to an MCP server over the stdin and stdout of its process
+type mcpClient struct {
+	name  string
+	tools []mcpTool
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// pipe is closed to stop a read of stdout which is waiting for a server that doesn't answer
+	pipe   io.Closer
+	stdout *bufio.Reader
+
+	mu     sync.Mutex
+	nextID int
+
+	closeOnce sync.Once
+}
+
+// startMCPServers starts each configured server and lists its tools
+func startMCPServers(ctx context.Context, config *mcpConfig) ([]*mcpClient, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(config.Servers))
+	for name := range config.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var clients []*mcpClient
+	for _, name := range names {
+		client, err := startMCPServer(ctx, name, config.Servers[name])
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+
+			return nil, fmt.Errorf("mcp server '%s': %w", name, err)
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+func startMCPServer(ctx context.Context, name string, config mcpServerConfig) (*mcpClient, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &mcpClient{name: name, cmd: cmd, stdin: stdin, pipe: stdout, stdout: bufio.NewReader(stdout)}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpStartTimeout)
+	defer cancel()
+
+	if _, err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "ollama", "version": version.Version},
+	}); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if err := c.send(mcpRequest{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	result, err := c.call(ctx, "tools/list", nil)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	var list struct {
+		Tools []mcpTool `json:"tools"`
+	}
+	if err := json.Unmarshal(result, &list); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	c.tools = list.Tools
+	return c, nil
+}
+
+func (c *mcpClient) send(req mcpRequest) error {
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.stdin.Write(append(bts, '\n'))
+	return err
+}
+
+// call sends a request and waits for its response, skipping any notifications in between
+func (c *mcpClient) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+	if err := c.send(mcpRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		resp mcpResponse
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		for {
+			line, err := c.stdout.ReadBytes('\n')
+			if err != nil {
+				ch <- result{err: fmt.Errorf("reading response: %w", err)}
+				return
+			}
+
+			var resp mcpResponse
+			if err := json.Unmarshal(line, &resp); err != nil || resp.ID != id {
+				continue
+			}
+
+			ch <- result{resp: resp}
+			return
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		// the server can't be trusted to answer in order after this, closing it ends the read
+		c.Close()
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.err != nil {
+			c.Close()
+			return nil, r.err
+		}
+
+		if r.resp.Error != nil {
+			return nil, errors.New(r.resp.Error.Message)
+		}
+
+		return r.resp.Result, nil
+	}
+}
+
+// CallTool calls the tool and returns the text of its result
+func (c *mcpClient) CallTool(ctx context.Context, name string, arguments map[string]any) (string, error) {
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+
+	result, err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": arguments})
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, content := range out.Content {
+		switch content.Type {
+		case "text":
+			sb.WriteString(content.Text)
+			sb.WriteString("\n")
+		default:
+			fmt.Fprintf(&sb, "[%s content omitted]\n", content.Type)
+		}
+	}
+
+	if out.IsError {
+		return "", errors.New(strings.TrimSpace(sb.String()))
+	}
+
+	return sb.String(), nil
+}
+
+func (c *mcpClient) Close() {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		// a process the server started may still hold its stdout open
+		c.pipe.Close()
+		c.cmd.Wait()
+	})
+}
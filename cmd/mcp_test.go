@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMCPHelperServer isn't a test, it is the MCP server the tests start by running the test binary again.
+// OLLAMA_TEST_MCP_SERVER is how it behaves: "tools" answers, "hang" never answers.
+func TestMCPHelperServer(t *testing.T) {
+	mode := os.Getenv("OLLAMA_TEST_MCP_SERVER")
+	if mode == "" {
+		return
+	}
+
+	reply := func(id int, result any, errMessage string) {
+		resp := map[string]any{"jsonrpc": "2.0", "id": id}
+		if errMessage != "" {
+			resp["error"] = map[string]any{"code": -32602, "message": errMessage}
+		} else {
+			resp["result"] = result
+		}
+
+		bts, _ := json.Marshal(resp)
+		os.Stdout.Write(append(bts, '\n'))
+	}
+
+	text := func(s string, isError bool) map[string]any {
+		return map[string]any{"content": []map[string]any{{"type": "text", "text": s}}, "isError": isError}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == 0 || mode == "hang" {
+			continue
+		}
+
+		switch req.Method {
+		case "initialize":
+			reply(req.ID, map[string]any{"protocolVersion": mcpProtocolVersion, "capabilities": map[string]any{}}, "")
+		case "tools/list":
+			reply(req.ID, map[string]any{"tools": []map[string]any{
+				{"name": "echo", "description": "Echo the text", "inputSchema": map[string]any{"type": "object"}},
+				{"name": "fail", "description": "Always fail"},
+				{"name": "sleep", "description": "Never answer"},
+			}}, "")
+		case "tools/call":
+			switch req.Params.Name {
+			case "echo":
+				// notifications and stale responses before the answer are skipped
+				os.Stdout.WriteString(`{"jsonrpc": "2.0", "method": "notifications/progress"}` + "\n")
+				reply(req.ID-1, text("stale", false), "")
+				reply(req.ID, text(req.Params.Arguments["text"].(string), false), "")
+			case "fail":
+				reply(req.ID, text("it failed", true), "")
+			case "sleep":
+			default:
+				reply(req.ID, nil, "unknown tool "+req.Params.Name)
+			}
+		default:
+			reply(req.ID, nil, "unknown method "+req.Method)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func helperMCPServer(mode string) mcpServerConfig {
+	return mcpServerConfig{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestMCPHelperServer$"},
+		Env:     map[string]string{"OLLAMA_TEST_MCP_SERVER": mode},
+	}
+}
+
+func TestMCPClient(t *testing.T) {
+	c, err := startMCPServer(context.Background(), "helper", helperMCPServer("tools"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Len(t, c.tools, 3)
+	assert.Equal(t, "echo", c.tools[0].Name)
+	assert.Equal(t, "Echo the text", c.tools[0].Description)
+	assert.JSONEq(t, `{"type": "object"}`, string(c.tools[0].InputSchema))
+
+	out, err := c.CallTool(context.Background(), "echo", map[string]any{"text": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", out)
+
+	_, err = c.CallTool(context.Background(), "fail", nil)
+	assert.EqualError(t, err, "it failed")
+
+	_, err = c.CallTool(context.Background(), "missing", nil)
+	assert.EqualError(t, err, "unknown tool missing")
+
+	// a call which isn't answered in time stops the server rather than waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = c.CallTool(ctx, "sleep", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	_, err = c.CallTool(context.Background(), "echo", map[string]any{"text": "hello"})
+	assert.Error(t, err)
+}
+
+func TestMCPStartTimeout(t *testing.T) {
+	timeout := mcpStartTimeout
+	mcpStartTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { mcpStartTimeout = timeout })
+
+	start := time.Now()
+	_, err := startMCPServer(context.Background(), "helper", helperMCPServer("hang"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestMCPConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.json")
+	t.Setenv("OLLAMA_MCP_CONFIG", path)
+
+	config, err := loadMCPConfig()
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"mcpServers": {"notes": {"command": "notes-server", "args": ["--dir", "notes"]}}}`), 0o644))
+	config, err = loadMCPConfig()
+	require.NoError(t, err)
+	assert.Equal(t, &mcpConfig{Servers: map[string]mcpServerConfig{"notes": {Command: "notes-server", Args: []string{"--dir", "notes"}}}}, config)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"mcpServers": {"notes": {}}}`), 0o644))
+	_, err = loadMCPConfig()
+	assert.ErrorContains(t, err, "server 'notes' is missing a command")
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// notify shows a desktop notification, tests replace it
+var notify = desktopNotification
+
+// addNotifyFlag adds --notify to a command which can take long enough to be left running
+func addNotifyFlag(cmd *cobra.Command, usage string) {
+	cmd.Flags().Bool("notify", false, usage)
+}
+
+// withNotify sends a desktop notification once handler finishes when --notify is set
+func withNotify(handler func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		return notifyDone(cmd, args, handler(cmd, args))
+	}
+}
+
+// notifyDone sends a desktop notification that a command run with --notify finished, or failed with err, and
+// returns err. The terminal bell is rung instead where notifications can't be sent.
+func notifyDone(cmd *cobra.Command, args []string, err error) error {
+	if enabled, _ := cmd.Flags().GetBool("notify"); !enabled || errors.Is(err, context.Canceled) || errors.Is(err, ErrNotConfirmed) {
+		return err
+	}
+
+	what := cmd.CommandPath()
+	if len(args) > 0 {
+		what += " " + args[0]
+	}
+
+	message := what + " finished"
+	if err != nil {
+		message = fmt.Sprintf("%s failed: %v", what, err)
+	}
+
+	if err := notify("Ollama", message); err != nil {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+
+	return err
+}
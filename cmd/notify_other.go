@@ -0,0 +1,11 @@
+//go:build !darwin && !windows
+
+package cmd
+
+import "os/exec"
+
+// desktopNotification shows a notification with notify-send, which fails where there is no notification
+// daemon such as over SSH
+func desktopNotification(title, message string) error {
+	return exec.Command("notify-send", title, message).Run()
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyDone(t *testing.T) {
+	var messages []string
+	t.Cleanup(func() { notify = desktopNotification })
+	notify = func(title, message string) error {
+		messages = append(messages, title+": "+message)
+		return nil
+	}
+
+	root := &cobra.Command{Use: "ollama"}
+	pull := &cobra.Command{Use: "pull"}
+	addNotifyFlag(pull, "Notify when the pull finishes")
+	root.AddCommand(pull)
+
+	failed := errors.New("connection refused")
+
+	// nothing is sent without --notify
+	assert.ErrorIs(t, notifyDone(pull, []string{"llama2"}, failed), failed)
+	assert.Empty(t, messages)
+
+	require.NoError(t, pull.Flags().Set("notify", "true"))
+	assert.NoError(t, notifyDone(pull, []string{"llama2"}, nil))
+	assert.ErrorIs(t, notifyDone(pull, []string{"llama2"}, failed), failed)
+	assert.Equal(t, []string{"Ollama: ollama pull llama2 finished", "Ollama: ollama pull llama2 failed: connection refused"}, messages)
+
+	// commands the user stopped or declined aren't reported
+	messages = nil
+	assert.ErrorIs(t, notifyDone(pull, nil, context.Canceled), context.Canceled)
+	assert.ErrorIs(t, notifyDone(pull, nil, fmt.Errorf("pull: %w", ErrNotConfirmed)), ErrNotConfirmed)
+	assert.Empty(t, messages)
+
+	// withNotify reports what the handler returns
+	err := withNotify(func(*cobra.Command, []string) error { return failed })(pull, []string{"mistral"})
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, []string{"Ollama: ollama pull mistral failed: connection refused"}, messages)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+// notifyScript shows a balloon tip from the notification area, which Windows 10 and later show as a toast. It
+// stays for a few seconds before the icon is removed, so it is left running when ollama exits.
+const notifyScript = `Add-Type -AssemblyName System.Windows.Forms
+$icon = New-Object System.Windows.Forms.NotifyIcon
+$icon.Icon = [System.Drawing.SystemIcons]::Information
+$icon.Visible = $true
+$icon.ShowBalloonTip(5000, $env:OLLAMA_NOTIFY_TITLE, $env:OLLAMA_NOTIFY_MESSAGE, 'Info')
+Start-Sleep -Seconds 6
+$icon.Dispose()`
+
+// desktopNotification shows a notification with PowerShell, the text is passed in the environment so it
+// needn't be quoted
+func desktopNotification(title, message string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", notifyScript)
+	cmd.Env = append(os.Environ(), "OLLAMA_NOTIFY_TITLE="+title, "OLLAMA_NOTIFY_MESSAGE="+message)
+	return cmd.Start()
+}
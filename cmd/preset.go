@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/format"
+)
+
+func CreatePresetHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	model, err := cmd.Flags().GetString("model")
+	if err != nil {
+		return err
+	}
+
+	system, err := cmd.Flags().GetString("system")
+	if err != nil {
+		return err
+	}
+
+	parameters, err := cmd.Flags().GetStringArray("parameter")
+	if err != nil {
+		return err
+	}
+
+	params := make(map[string][]string)
+	for _, p := range parameters {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return fmt.Errorf("invalid parameter '%s', use name=value", p)
+		}
+
+		params[k] = append(params[k], v)
+	}
+
+	options, err := api.FormatParams(params)
+	if err != nil {
+		return err
+	}
+
+	preset := api.Preset{Name: args[0], Model: model, System: system, Options: options}
+	if _, err := client.CreatePreset(cmd.Context(), &preset); err != nil {
+		return err
+	}
+
+	fmt.Printf("created preset '%s'\n", args[0])
+	return nil
+}
+
+func ListPresetsHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	list, err := client.ListPresets(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var data [][]string
+	for _, p := range list.Presets {
+		data = append(data, []string{p.Name, p.Model, format.HumanTime(p.ModifiedAt, "Never")})
+	}
+
+	renderTable(os.Stdout, stdoutWidth(), []string{"NAME", "MODEL", "MODIFIED"}, data)
+
+	return nil
+}
+
+func ShowPresetHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	preset, err := client.GetPreset(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("model\t%s\n", preset.Model)
+	if preset.System != "" {
+		fmt.Printf("system\t%s\n", preset.System)
+	}
+
+	keys := make([]string, 0, len(preset.Options))
+	for k := range preset.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Printf("%s\t%v\n", k, preset.Options[k])
+	}
+
+	return nil
+}
+
+func DeletePresetHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range args {
+		if err := client.DeletePreset(cmd.Context(), name); err != nil {
+			return err
+		}
+		fmt.Printf("deleted preset '%s'\n", name)
+	}
+
+	return nil
+}
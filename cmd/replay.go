@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+	"github.com/jmorganca/ollama/progress"
+	"github.com/jmorganca/ollama/server"
+	"github.com/jmorganca/ollama/style"
+	"github.com/jmorganca/ollama/version"
+)
+
+// ReplayHandler runs a generation recorded with OLLAMA_RECORD again and reports where its output departs
+// from the recording
+func ReplayHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	replay, err := server.ReadReplay(args[0])
+	if err != nil {
+		return err
+	}
+
+	if platform := runtime.GOOS + "/" + runtime.GOARCH; replay.Version != version.Version || replay.Platform != platform {
+		fmt.Fprintf(os.Stderr, "recorded with ollama %s on %s, replaying with ollama %s on %s\n", replay.Version, replay.Platform, version.Version, platform)
+	}
+
+	show, err := client.Show(cmd.Context(), &api.ShowRequest{Name: replay.Model})
+	if err != nil {
+		return err
+	}
+
+	if show.Digest != replay.Digest {
+		fmt.Fprintln(os.Stderr, style.Stderr.Render(style.Warning, fmt.Sprintf("'%s' has changed since it was recorded, its digest was %s and is now %s", replay.Model, replay.Digest, show.Digest)))
+	}
+
+	if replay.Error != "" {
+		fmt.Fprintf(os.Stderr, "the recorded generation failed: %s\n", replay.Error)
+	}
+
+	p := progress.NewProgress(os.Stderr)
+	defer p.StopAndClear()
+
+	spinner := progress.NewSpinner("")
+	p.Add("", spinner)
+
+	var tokens []string
+	request := apix.NewGenerateRequest(api.GenerateRequest{
+		Model:   replay.Model,
+		Prompt:  replay.Prompt,
+		Raw:     true,
+		Format:  replay.Format,
+		Images:  replay.Images,
+		Options: replay.Options,
+	})
+	request.Schema = replay.Schema
+
+	if err := apix.Generate(cmd.Context(), client, request, func(resp api.GenerateResponse) error {
+		if resp.Load != nil {
+			return nil
+		}
+
+		p.StopAndClear()
+		if resp.Response != "" {
+			tokens = append(tokens, resp.Response)
+			fmt.Print(resp.Response)
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	fmt.Println()
+
+	for i := range tokens {
+		if i >= len(replay.Tokens) {
+			fmt.Fprintf(os.Stderr, "output is longer than the recording, which ended after %d tokens\n", len(replay.Tokens))
+			return nil
+		}
+
+		if tokens[i] != replay.Tokens[i] {
+			recorded := style.Stderr.Render(style.Removed, fmt.Sprintf("%q", replay.Tokens[i]))
+			generated := style.Stderr.Render(style.Added, fmt.Sprintf("%q", tokens[i]))
+			fmt.Fprintf(os.Stderr, "output departs from the recording at token %d, %s was recorded and %s generated\n", i, recorded, generated)
+			return nil
+		}
+	}
+
+	if len(tokens) < len(replay.Tokens) {
+		fmt.Fprintf(os.Stderr, "output is shorter than the recording, it ended after %d of %d tokens\n", len(tokens), len(replay.Tokens))
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "output matches the recording, %d tokens\n", len(tokens))
+	return nil
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var varPattern = regexp.MustCompile(`{{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+
+func validVarName(name string) bool {
+	return varPattern.MatchString("{{" + name + "}}")
+}
+
+// substituteVars replaces {{name}} in the prompt with the value of each defined variable,
+// leaving any undefined references untouched
+func substituteVars(prompt string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return prompt
+	}
+
+	return varPattern.ReplaceAllStringFunc(prompt, func(match string) string {
+		name := varPattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+
+		return match
+	})
+}
+
+// varCommand runs /set var name=value and /set novar name, args are the fields of the line
+func varCommand(w io.Writer, args []string, vars map[string]string) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+
+	if args[1] == "novar" {
+		delete(vars, args[2])
+		fmt.Fprintf(w, "Removed variable '%s'\n\n", args[2])
+		return nil
+	}
+
+	name, value, ok := strings.Cut(strings.Join(args[2:], " "), "=")
+	if !ok || !validVarName(name) {
+		return errors.New("invalid variable, use '/set var name=value'")
+	}
+
+	vars[name] = value
+	fmt.Fprintf(w, "Set variable '%s' to '%s'\n\n", name, value)
+	return nil
+}
+
+func snippetsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "snippets"), nil
+}
+
+func snippetPath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid snippet name '%s'", name)
+	}
+
+	dir, err := snippetsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+func saveSnippet(name, text string) error {
+	path, err := snippetPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(text), 0o644)
+}
+
+func loadSnippet(name string) (string, error) {
+	path, err := snippetPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("snippet '%s' not found", name)
+	} else if err != nil {
+		return "", err
+	}
+
+	return string(bts), nil
+}
+
+func deleteSnippet(name string) error {
+	path, err := snippetPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("snippet '%s' not found", name)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func listSnippets() ([]string, error) {
+	dir, err := snippetsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// afterFields returns the line after its first n fields as it was typed, keeping its spaces and newlines
+func afterFields(line string, n int) string {
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+
+		line = line[end:]
+	}
+
+	return strings.TrimLeftFunc(line, unicode.IsSpace)
+}
+
+// snippetText returns the text of /snippet save after the name. Like /set system, a text starting with """ goes
+// on until """, open reports whether it goes on past this line.
+func snippetText(line string) (text string, open bool) {
+	text = afterFields(line, 3)
+	rest, ok := strings.CutPrefix(text, `"""`)
+	if !ok {
+		return text, false
+	}
+
+	if cut, closed := strings.CutSuffix(rest, `"""`); closed {
+		return cut, false
+	}
+
+	return rest, true
+}
+
+// snippetCommand runs a /snippet command of the interactive mode. It returns the prompt to send for
+// /snippet insert. A multi-line /snippet save is read by the interactive mode, which calls saveSnippet.
+func snippetCommand(w io.Writer, line string) (string, error) {
+	args := strings.Fields(line)
+	if len(args) < 2 {
+		return "", errUsage
+	}
+
+	switch args[1] {
+	case "save":
+		if len(args) < 4 {
+			return "", errUsage
+		}
+
+		text, _ := snippetText(line)
+		if err := saveSnippet(args[2], text); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(w, "Saved snippet '%s'.\n", args[2])
+	case "insert":
+		if len(args) < 3 {
+			return "", errUsage
+		}
+
+		text, err := loadSnippet(args[2])
+		if err != nil {
+			return "", err
+		}
+
+		if len(args) > 3 {
+			text += " " + afterFields(line, 3)
+		}
+
+		return text, nil
+	case "list":
+		names, err := listSnippets()
+		if err != nil {
+			return "", err
+		}
+
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+		}
+		fmt.Fprintln(w)
+	case "delete":
+		if len(args) < 3 {
+			return "", errUsage
+		}
+
+		if err := deleteSnippet(args[2]); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(w, "Deleted snippet '%s'.\n", args[2])
+	default:
+		fmt.Fprintf(w, "Unknown command '/snippet %s'. Type /? for help\n", args[1])
+	}
+
+	return "", nil
+}
+
+func usageSnippet() {
+	fmt.Fprintln(os.Stderr, "Available Commands:")
+	fmt.Fprintln(os.Stderr, "  /snippet save <name> <string>        Save a prompt snippet, use \"\"\" to begin a multi-line snippet")
+	fmt.Fprintln(os.Stderr, "  /snippet insert <name> [<string>]    Send a saved snippet followed by an optional message")
+	fmt.Fprintln(os.Stderr, "  /snippet list                        List saved snippets")
+	fmt.Fprintln(os.Stderr, "  /snippet delete <name>               Delete a saved snippet")
+	fmt.Fprintln(os.Stderr, "")
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubstituteVars(t *testing.T) {
+	vars := map[string]string{"lang": "Go", "topic": "channels"}
+	assert.Equal(t, "Explain channels in Go", substituteVars("Explain {{topic}} in {{ lang }}", vars))
+	assert.Equal(t, "Explain {{other}} in Go", substituteVars("Explain {{other}} in {{lang}}", vars))
+	assert.Equal(t, "{{lang}}", substituteVars("{{lang}}", nil))
+
+	assert.True(t, validVarName("lang_2"))
+	assert.False(t, validVarName("2lang"))
+	assert.False(t, validVarName("a b"))
+}
+
+func TestVarCommand(t *testing.T) {
+	vars := map[string]string{}
+	run := func(line string) (string, error) {
+		var w strings.Builder
+		err := varCommand(&w, strings.Fields(line), vars)
+		return w.String(), err
+	}
+
+	out, err := run("/set var greeting=hello there")
+	require.NoError(t, err)
+	assert.Equal(t, "Set variable 'greeting' to 'hello there'\n\n", out)
+	assert.Equal(t, map[string]string{"greeting": "hello there"}, vars)
+
+	out, err = run("/set novar greeting")
+	require.NoError(t, err)
+	assert.Equal(t, "Removed variable 'greeting'\n\n", out)
+	assert.Empty(t, vars)
+
+	_, err = run("/set var greeting")
+	assert.ErrorContains(t, err, "invalid variable")
+
+	_, err = run("/set var 2x=y")
+	assert.ErrorContains(t, err, "invalid variable")
+
+	_, err = run("/set var")
+	assert.ErrorIs(t, err, errUsage)
+}
+
+func TestSnippetCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	run := func(line string) (string, string, error) {
+		var w strings.Builder
+		prompt, err := snippetCommand(&w, line)
+		return prompt, w.String(), err
+	}
+
+	_, out, err := run("/snippet list")
+	require.NoError(t, err)
+	assert.Equal(t, "\n", out)
+
+	_, out, err = run("/snippet save review Review this code for bugs:")
+	require.NoError(t, err)
+	assert.Equal(t, "Saved snippet 'review'.\n", out)
+
+	prompt, out, err := run("/snippet insert review func main() {}")
+	require.NoError(t, err)
+	assert.Equal(t, "Review this code for bugs: func main() {}", prompt)
+	assert.Empty(t, out)
+
+	prompt, _, err = run("/snippet insert review")
+	require.NoError(t, err)
+	assert.Equal(t, "Review this code for bugs:", prompt)
+
+	_, out, err = run("/snippet list")
+	require.NoError(t, err)
+	assert.Equal(t, "review\n\n", out)
+
+	_, out, err = run("/snippet delete review")
+	require.NoError(t, err)
+	assert.Equal(t, "Deleted snippet 'review'.\n", out)
+
+	_, _, err = run("/snippet insert review")
+	assert.EqualError(t, err, "snippet 'review' not found")
+
+	_, _, err = run("/snippet delete review")
+	assert.EqualError(t, err, "snippet 'review' not found")
+
+	// the text is kept as it was typed
+	_, _, err = run("/snippet save table  | a |  b |\t")
+	require.NoError(t, err)
+	prompt, _, err = run("/snippet insert table  x  y")
+	require.NoError(t, err)
+	assert.Equal(t, "| a |  b |\t x  y", prompt)
+
+	_, _, err = run(`/snippet save quoted """one line"""`)
+	require.NoError(t, err)
+	prompt, _, err = run("/snippet insert quoted")
+	require.NoError(t, err)
+	assert.Equal(t, "one line", prompt)
+
+	for _, name := range []string{"../escape", `a\b`, ".hidden"} {
+		_, _, err := run("/snippet save " + name + " text")
+		assert.ErrorContains(t, err, "invalid snippet name", name)
+	}
+
+	for _, line := range []string{"/snippet", "/snippet save review", "/snippet insert", "/snippet delete"} {
+		_, _, err := run(line)
+		assert.ErrorIs(t, err, errUsage, line)
+	}
+
+	prompt, out, err = run("/snippet rename a b")
+	require.NoError(t, err)
+	assert.Empty(t, prompt)
+	assert.Equal(t, "Unknown command '/snippet rename'. Type /? for help\n", out)
+}
+
+func TestSnippetText(t *testing.T) {
+	cases := []struct {
+		line, text string
+		open       bool
+	}{
+		{"/snippet save name Review  this:", "Review  this:", false},
+		{"/snippet  save\tname\t  indented\ttext ", "indented\ttext ", false},
+		{`/snippet save name """single line"""`, "single line", false},
+		{`/snippet save name """first line`, "first line", true},
+		{`/snippet save name """`, "", true},
+		{"/snippet save name", "", false},
+	}
+
+	for _, tt := range cases {
+		text, open := snippetText(tt.line)
+		assert.Equal(t, tt.text, text, tt.line)
+		assert.Equal(t, tt.open, open, tt.line)
+	}
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/version"
+)
+
+// spdxDocument is the subset of an SPDX 2.3 document needed to record the blobs of a model
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files"`
+	Licenses          []spdxLicense      `json:"hasExtractedLicensingInfos,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string         `json:"SPDXID"`
+	Name             string         `json:"name"`
+	VersionInfo      string         `json:"versionInfo,omitempty"`
+	DownloadLocation string         `json:"downloadLocation"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	LicenseDeclared  string         `json:"licenseDeclared"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxFile struct {
+	SPDXID            string         `json:"SPDXID"`
+	FileName          string         `json:"fileName"`
+	FileTypes         []string       `json:"fileTypes"`
+	Checksums         []spdxChecksum `json:"checksums"`
+	LicenseConcluded  string         `json:"licenseConcluded"`
+	CopyrightText     string         `json:"copyrightText"`
+	Comment           string         `json:"comment"`
+	AttributionTexts  []string       `json:"attributionTexts,omitempty"`
+	LicenseInfoInFile []string       `json:"licenseInfoInFiles,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxLicense struct {
+	LicenseID     string `json:"licenseId"`
+	Name          string `json:"name"`
+	ExtractedText string `json:"extractedText"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+const spdxNoAssertion = "NOASSERTION"
+
+// newSPDXDocument describes the model as a package containing one file per blob, identified by its
+// sha256 digest, with the model's license text as the declared license
+func newSPDXDocument(name string, resp *api.ShowResponse, now time.Time) *spdxDocument {
+	license := spdxNoAssertion
+	var licenses []spdxLicense
+	if resp.License != "" {
+		license = "LicenseRef-model"
+		licenses = append(licenses, spdxLicense{
+			LicenseID:     license,
+			Name:          name + " license",
+			ExtractedText: resp.License,
+		})
+	}
+
+	var registry string
+	if len(resp.Layers) > 0 {
+		registry = resp.Layers[0].Registry
+	}
+
+	repository, tag, _ := strings.Cut(name, ":")
+	pkg := spdxPackage{
+		SPDXID:           "SPDXRef-Model",
+		Name:             repository,
+		VersionInfo:      tag,
+		DownloadLocation: spdxNoAssertion,
+		Checksums:        []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: resp.Digest}},
+		LicenseConcluded: spdxNoAssertion,
+		LicenseDeclared:  license,
+		CopyrightText:    spdxNoAssertion,
+	}
+
+	if registry != "" {
+		pkg.DownloadLocation = fmt.Sprintf("https://%s/%s", registry, repository)
+	}
+
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://ollama.ai/spdx/%s-%s", strings.ReplaceAll(name, ":", "-"), resp.Digest),
+		CreationInfo: spdxCreationInfo{
+			Created:  now.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: ollama-" + version.Version},
+		},
+		Packages: []spdxPackage{pkg},
+		Licenses: licenses,
+		Relationships: []spdxRelationship{
+			{Element: "SPDXRef-DOCUMENT", Type: "DESCRIBES", Related: pkg.SPDXID},
+		},
+	}
+
+	for i, layer := range resp.Layers {
+		file := spdxFile{
+			SPDXID:           fmt.Sprintf("SPDXRef-Layer-%d", i),
+			FileName:         "blobs/" + strings.Replace(layer.Digest, ":", "-", 1),
+			FileTypes:        []string{"BINARY"},
+			Checksums:        []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: strings.TrimPrefix(layer.Digest, "sha256:")}},
+			LicenseConcluded: spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+			Comment:          fmt.Sprintf("%s, %d bytes, from %s", layer.MediaType, layer.Size, layer.Registry),
+		}
+
+		if layer.From != "" {
+			file.AttributionTexts = []string{"inherited from " + layer.From}
+		}
+
+		if license != spdxNoAssertion && layer.MediaType == "application/vnd.ollama.image.license" {
+			file.LicenseInfoInFile = []string{license}
+		}
+
+		doc.Files = append(doc.Files, file)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{Element: pkg.SPDXID, Type: "CONTAINS", Related: file.SPDXID})
+	}
+
+	return doc
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/term"
+
+	"github.com/jmorganca/ollama/style"
+)
+
+// minColumnWidth is the narrowest a column is abbreviated to when a table is fitted to the terminal
+const minColumnWidth = 8
+
+// renderTable writes a listing, columns separated by tabs under a header in the header style. Tables wider
+// than width are fitted to it by abbreviating their widest columns, a width of 0 leaves them as they are.
+func renderTable(w io.Writer, width int, header []string, data [][]string) {
+	if width > 0 {
+		header, data = fitTable(width, header, data)
+	}
+
+	styled := make([]string, len(header))
+	for i, h := range header {
+		styled[i] = style.Stdout.Render(style.Header, h)
+	}
+
+	table := tablewriter.NewWriter(w)
+	// headers are already upper case, formatting them would change the style's escape sequences too
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader(styled)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetNoWhiteSpace(true)
+	table.SetTablePadding("\t")
+	table.AppendBulk(data)
+	table.Render()
+}
+
+// stdoutWidth is the width of the terminal, or 0 when stdout isn't a terminal so that scripts get whole values
+func stdoutWidth() int {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return 0
+	}
+
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+
+	return width
+}
+
+// fitTable shortens the widest columns of a table, ending cut values with "…", until it fits in width or all
+// columns are down to minColumnWidth
+func fitTable(width int, header []string, data [][]string) ([]string, [][]string) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, data...) {
+		for i, cell := range row {
+			if i < len(widths) && utf8.RuneCountInString(cell) > widths[i] {
+				widths[i] = utf8.RuneCountInString(cell)
+			}
+		}
+	}
+
+	// columns are separated by a tab, which takes them to the next multiple of 8
+	tableWidth := func() int {
+		var n int
+		for i, w := range widths {
+			if i < len(widths)-1 {
+				w = (w/8 + 1) * 8
+			}
+
+			n += w
+		}
+
+		return n
+	}
+
+	changed := false
+	for tableWidth() >= width {
+		widest := -1
+		for i, w := range widths {
+			if w > minColumnWidth && (widest < 0 || w > widths[widest]) {
+				widest = i
+			}
+		}
+
+		if widest < 0 {
+			break
+		}
+
+		widths[widest]--
+		changed = true
+	}
+
+	if !changed {
+		return header, data
+	}
+
+	abbreviate := func(row []string) []string {
+		fitted := make([]string, len(row))
+		for i, cell := range row {
+			fitted[i] = cell
+			if i < len(widths) && utf8.RuneCountInString(cell) > widths[i] {
+				fitted[i] = string([]rune(cell)[:widths[i]-1]) + "…"
+			}
+		}
+
+		return fitted
+	}
+
+	fitted := make([][]string, len(data))
+	for i, row := range data {
+		fitted[i] = abbreviate(row)
+	}
+
+	return abbreviate(header), fitted
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitTable(t *testing.T) {
+	header := []string{"NAME", "ID", "SIZE", "MODIFIED"}
+	data := [][]string{
+		{"registry.example.com/library/codellama:34b-instruct-q4_K_M", "8934d96d3f08", "19 GB", "2 weeks ago"},
+		{"llama2:latest", "fe938a131f40", "3.8 GB", "3 days ago"},
+	}
+
+	// tables which fit are left alone
+	fittedHeader, fitted := fitTable(120, header, data)
+	assert.Equal(t, header, fittedHeader)
+	assert.Equal(t, data, fitted)
+
+	// the widest column is abbreviated first
+	fittedHeader, fitted = fitTable(60, header, data)
+	assert.Equal(t, header, fittedHeader)
+	assert.True(t, strings.HasSuffix(fitted[0][0], "…"), fitted[0][0])
+	assert.Less(t, len([]rune(fitted[0][0])), len(data[0][0]))
+	assert.Equal(t, "llama2:latest", fitted[1][0])
+	assert.Equal(t, data[0][1:], fitted[0][1:])
+
+	var b strings.Builder
+	renderTable(&b, 60, header, data)
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		// tabs go on to the next multiple of 8
+		var width int
+		for _, r := range strings.TrimRight(line, " \t") {
+			if r == '\t' {
+				width = (width/8 + 1) * 8
+			} else {
+				width++
+			}
+		}
+
+		assert.Less(t, width, 60, line)
+	}
+
+	// no column is cut below the minimum, however narrow the terminal
+	_, fitted = fitTable(10, header, data)
+	for _, row := range fitted {
+		for _, cell := range row {
+			assert.LessOrEqual(t, len([]rune(cell)), minColumnWidth, cell)
+		}
+	}
+	assert.Equal(t, "registr…", fitted[0][0])
+	assert.Equal(t, "19 GB", fitted[0][2])
+
+	// without a terminal values are whole
+	b.Reset()
+	renderTable(&b, 0, header, data)
+	assert.Contains(t, b.String(), data[0][0])
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/server"
+)
+
+func TemplateTestHandler(cmd *cobra.Command, args []string) error {
+	model, err := cmd.Flags().GetString("model")
+	if err != nil {
+		return err
+	}
+
+	update, err := cmd.Flags().GetBool("update")
+	if err != nil {
+		return err
+	}
+
+	// the cases are run against the model's template and system message instead of the corpus' template
+	var show *api.ShowResponse
+	if model != "" {
+		if err := checkServerHeartbeat(cmd, args); err != nil {
+			return err
+		}
+
+		client, err := api.ClientFromEnvironment()
+		if err != nil {
+			return err
+		}
+
+		show, err = client.Show(cmd.Context(), &api.ShowRequest{Name: model})
+		if err != nil {
+			return err
+		}
+	}
+
+	var total, failed int
+	for _, dir := range args {
+		tmpl, cases, err := server.LoadTemplateCorpus(dir)
+		if err != nil {
+			return err
+		}
+
+		var system string
+		if show != nil {
+			tmpl, system = show.Template, show.System
+		} else if tmpl == "" {
+			return fmt.Errorf("%s has no template, add one or test a model's template with --model", dir)
+		}
+
+		for _, r := range server.RunTemplateCorpus(tmpl, system, cases) {
+			total++
+			name := filepath.Join(filepath.Base(dir), r.Case.Name)
+
+			switch {
+			case update:
+				if err := server.UpdateTemplateGolden(dir, r); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+
+				fmt.Printf("updated %s\n", name)
+			case r.Err != nil:
+				failed++
+				fmt.Printf("FAIL %s: %v\n", name, r.Err)
+			case !r.Passed():
+				failed++
+				fmt.Printf("FAIL %s\n  want: %q\n  got:  %q\n", name, r.Case.Want, r.Got)
+			default:
+				fmt.Printf("ok   %s\n", name)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d template tests failed", failed, total)
+	}
+
+	return nil
+}
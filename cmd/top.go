@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/format"
+)
+
+func TopHandler(cmd *cobra.Command, args []string) error {
+	client, err := api.ClientFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval '%s'", interval)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	// draw on the alternate screen so the terminal is left as it was on exit
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		screen, err := renderTop(ctx, client)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			screen = fmt.Sprintf("Error: %v\n", err)
+		}
+
+		// move to the top left and clear the screen before drawing
+		fmt.Print("\033[H\033[2J" + screen)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderTop draws the resource usage, request load and loaded models of the server
+func renderTop(ctx context.Context, client *api.Client) (string, error) {
+	metrics, err := client.Metrics(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	running, err := client.ListRunning(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ollama top - %s\n\n", time.Now().Format(time.TimeOnly))
+
+	fmt.Fprintf(&sb, "CPU  %d cores, load %.2f\n", metrics.NumCPU, metrics.CPULoad)
+	if metrics.MemoryTotal > 0 {
+		used := metrics.MemoryTotal - metrics.MemoryAvailable
+		fmt.Fprintf(&sb, "RAM  %s / %s (%.0f%%)\n", format.HumanBytes(int64(used)), format.HumanBytes(int64(metrics.MemoryTotal)), 100*float64(used)/float64(metrics.MemoryTotal))
+	}
+
+	for i, gpu := range metrics.GPUs {
+		fmt.Fprintf(&sb, "GPU%d %s, %.0f%% busy, %s / %s\n", i, gpu.Name, gpu.Utilization, format.HumanBytes(int64(gpu.MemoryUsed)), format.HumanBytes(int64(gpu.MemoryTotal)))
+	}
+
+	fmt.Fprintf(&sb, "\nRequests  %d active, %d queued, %d total\n", metrics.ActiveRequests, metrics.QueuedRequests, metrics.TotalRequests)
+	fmt.Fprintf(&sb, "Throughput  %.1f tokens/s over the last minute\n\n", metrics.TokensPerSecond)
+
+	if len(running.Models) == 0 {
+		sb.WriteString("No models loaded\n")
+		return sb.String(), nil
+	}
+
+	var data [][]string
+	for _, m := range running.Models {
+		processor := "CPU"
+		if m.GPULayers > 0 {
+			processor = fmt.Sprintf("GPU %d/%d layers", m.GPULayers, m.TotalLayers)
+		}
+
+		data = append(data, []string{m.Name, format.HumanBytes(m.Size), processor, format.HumanTime(m.ExpiresAt, "Never")})
+	}
+
+	renderTable(&sb, stdoutWidth(), []string{"NAME", "SIZE", "PROCESSOR", "UNTIL"}, data)
+	return sb.String(), nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// transcriptMessage is a single turn of a conversation recorded by a transcript
+type transcriptMessage struct {
+	Role      string                 `json:"role"`
+	Model     string                 `json:"model,omitempty"`
+	Content   string                 `json:"content"`
+	Images    int                    `json:"images,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	Metrics   *api.Metrics           `json:"metrics,omitempty"`
+}
+
+// transcript records a conversation along with the parameters used to generate it. Model is the model the
+// conversation started with, each response records the model which generated it.
+type transcript struct {
+	Model     string              `json:"model"`
+	System    string              `json:"system,omitempty"`
+	Template  string              `json:"template,omitempty"`
+	Format    string              `json:"format,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+	Messages  []transcriptMessage `json:"messages"`
+
+	// path is written after every exchange when set
+	path string
+}
+
+func newTranscript(model string) *transcript {
+	return &transcript{Model: model, CreatedAt: time.Now().UTC()}
+}
+
+// Add records an exchange between the user and the model
+func (t *transcript) Add(opts generateOptions, resp api.GenerateResponse) error {
+	t.System = opts.System
+	t.Template = opts.Template
+	t.Format = opts.Format
+
+	var options map[string]interface{}
+	if len(opts.Options) > 0 {
+		options = make(map[string]interface{}, len(opts.Options))
+		for k, v := range opts.Options {
+			options[k] = v
+		}
+	}
+
+	// the user's message is recorded as it was typed, without the variables and documents added to it
+	prompt := opts.Prompt
+	if opts.Typed != "" {
+		prompt = opts.Typed
+	}
+
+	metrics := resp.Metrics
+	if n := len(t.Messages); opts.Continue && n > 0 && t.Messages[n-1].Role == "assistant" {
+		// a continued response is part of the last exchange
+		t.Messages[n-1].Content += resp.Response
+		t.Messages[n-1].Metrics = &metrics
+	} else {
+		t.Messages = append(t.Messages,
+			transcriptMessage{Role: "user", Content: prompt, Images: len(opts.Images), CreatedAt: time.Now().UTC()},
+			transcriptMessage{Role: "assistant", Model: opts.Model, Content: resp.Response, Options: options, CreatedAt: resp.CreatedAt, Metrics: &metrics},
+		)
+	}
+
+	if t.path != "" {
+		return t.WriteFile(transcriptFormat(t.path), t.path)
+	}
+
+	return nil
+}
+
+// transcriptFormat picks the export format from the file extension
+func transcriptFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+
+	return "markdown"
+}
+
+func (t *transcript) WriteFile(format, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(t)
+	case "markdown", "md":
+		err = t.writeMarkdown(f)
+	default:
+		return fmt.Errorf("unknown transcript format '%s'", format)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func (t *transcript) writeMarkdown(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Conversation with %s\n\n", t.Model)
+	fmt.Fprintf(&sb, "- Started: %s\n", t.CreatedAt.Format(time.RFC3339))
+	if t.Format != "" {
+		fmt.Fprintf(&sb, "- Format: %s\n", t.Format)
+	}
+	if t.System != "" {
+		fmt.Fprintf(&sb, "- System: %s\n", t.System)
+	}
+	if t.Template != "" {
+		fmt.Fprintf(&sb, "- Template:\n\n```\n%s\n```\n", t.Template)
+	}
+
+	for _, m := range t.Messages {
+		if m.Model != "" {
+			fmt.Fprintf(&sb, "\n## %s (%s, %s)\n\n", m.Role, m.Model, m.CreatedAt.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(&sb, "\n## %s (%s)\n\n", m.Role, m.CreatedAt.Format(time.RFC3339))
+		}
+
+		if len(m.Options) > 0 {
+			keys := make([]string, 0, len(m.Options))
+			for k := range m.Options {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			params := make([]string, len(keys))
+			for i, k := range keys {
+				params[i] = fmt.Sprintf("%s=%v", k, m.Options[k])
+			}
+
+			fmt.Fprintf(&sb, "_Parameters: %s_\n\n", strings.Join(params, ", "))
+		}
+
+		if m.Images > 0 {
+			fmt.Fprintf(&sb, "_%d image(s) attached_\n\n", m.Images)
+		}
+
+		sb.WriteString(m.Content)
+		sb.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
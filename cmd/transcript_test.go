@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestTranscript(t *testing.T) {
+	tr := newTranscript("llama2")
+	tr.path = filepath.Join(t.TempDir(), "chat.json")
+
+	// the prompt is recorded as it was typed, not with the variables and documents added to it
+	opts := generateOptions{Model: "llama2", Typed: "Explain {{topic}}", Prompt: "Context: ...\n\nExplain channels"}
+	require.NoError(t, tr.Add(opts, api.GenerateResponse{Response: "Channels are pipes.", CreatedAt: time.Now()}))
+
+	// each response records the model which generated it
+	opts = generateOptions{Model: "mistral", Prompt: "And goroutines?"}
+	require.NoError(t, tr.Add(opts, api.GenerateResponse{Response: "Goroutines are threads.", CreatedAt: time.Now()}))
+
+	bts, err := os.ReadFile(tr.path)
+	require.NoError(t, err)
+
+	var saved transcript
+	require.NoError(t, json.Unmarshal(bts, &saved))
+	assert.Equal(t, "llama2", saved.Model)
+	require.Len(t, saved.Messages, 4)
+	assert.Equal(t, "Explain {{topic}}", saved.Messages[0].Content)
+	assert.Empty(t, saved.Messages[0].Model)
+	assert.Equal(t, "llama2", saved.Messages[1].Model)
+	assert.Equal(t, "And goroutines?", saved.Messages[2].Content)
+	assert.Equal(t, "mistral", saved.Messages[3].Model)
+
+	path := filepath.Join(t.TempDir(), "chat.md")
+	require.NoError(t, tr.WriteFile(transcriptFormat(path), path))
+
+	bts, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(bts), "# Conversation with llama2\n")
+	assert.Contains(t, string(bts), "## assistant (mistral, ")
+	assert.Contains(t, string(bts), "Explain {{topic}}\n")
+	assert.NotContains(t, string(bts), "Context: ...")
+}
@@ -0,0 +1,197 @@
+// Package eval reads suites of prompts with expected answers and scores the responses of models to them, to
+// compare models, such as the quantizations of one, on the same questions.
+package eval
+
+import (
+	"bufio"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// The ways a response is scored against a case's expected answer
+const (
+	// MatchExact passes responses which are the expected answer, ignoring case, surrounding whitespace and
+	// quotes, and a final full stop
+	MatchExact = "exact"
+
+	// MatchRegex passes responses which the expected answer, a regular expression, matches
+	MatchRegex = "regex"
+
+	// MatchJudge asks a judge model whether the response agrees with the expected answer
+	MatchJudge = "judge"
+)
+
+//go:embed suites/*.jsonl
+var builtin embed.FS
+
+// Case is a prompt of a suite and its expected answer. Suites are JSONL files with a case on each line, e.g.
+//
+//	{"prompt": "What is the capital of France?", "expected": "Paris"}
+//	{"prompt": "Name a prime number above 10.", "expected": "^\\W*(11|13|17|19)\\b", "match": "regex"}
+type Case struct {
+	Prompt   string `json:"prompt"`
+	System   string `json:"system,omitempty"`
+	Expected string `json:"expected"`
+
+	// Match is how the response is scored, the suite's default if it isn't set
+	Match string `json:"match,omitempty"`
+
+	re *regexp.Regexp
+}
+
+type Suite struct {
+	Name  string
+	Cases []Case
+}
+
+// Builtin lists the names of the suites which come with ollama
+func Builtin() []string {
+	entries, err := builtin.ReadDir("suites")
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = strings.TrimSuffix(entry.Name(), ".jsonl")
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Load reads a builtin suite by name, or otherwise the suite in the file. Cases without a match are scored
+// with match.
+func Load(name, match string) (*Suite, error) {
+	var f fs.File
+	var err error
+	if slices.Contains(Builtin(), name) {
+		f, err = builtin.Open(path.Join("suites", name+".jsonl"))
+	} else {
+		f, err = os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no suite '%s', name a file or one of: %s", name, strings.Join(Builtin(), ", "))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(name, f, match)
+}
+
+// Parse reads the cases of a suite, one on each line
+func Parse(name string, r io.Reader, match string) (*Suite, error) {
+	suite := Suite{Name: name}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var c Case
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+
+		if c.Match == "" {
+			c.Match = match
+		}
+
+		if err := c.check(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("%s has no cases", name)
+	}
+
+	return &suite, nil
+}
+
+func (c *Case) check() error {
+	switch {
+	case c.Prompt == "":
+		return errors.New("case is missing a prompt")
+	case c.Expected == "":
+		return errors.New("case is missing an expected answer")
+	}
+
+	switch c.Match {
+	case MatchExact, MatchJudge:
+	case MatchRegex:
+		re, err := regexp.Compile(c.Expected)
+		if err != nil {
+			return err
+		}
+
+		c.re = re
+	default:
+		return fmt.Errorf("unknown match '%s', expected %s, %s or %s", c.Match, MatchExact, MatchRegex, MatchJudge)
+	}
+
+	return nil
+}
+
+// Judged reports whether any case of the suite is scored by a judge model
+func (s *Suite) Judged() bool {
+	for _, c := range s.Cases {
+		if c.Match == MatchJudge {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Passes scores the response with the case's exact or regex match, judged cases are scored with JudgePrompt
+func (c *Case) Passes(response string) bool {
+	switch c.Match {
+	case MatchExact:
+		return normalize(response) == normalize(c.Expected)
+	case MatchRegex:
+		return c.re.MatchString(strings.TrimSpace(response))
+	}
+
+	return false
+}
+
+func normalize(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, ".")
+	s = strings.Trim(s, "\"'`")
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// JudgeSystem is the system message of the judge model
+const JudgeSystem = "You grade the answers of students. Compare the response with the reference answer and decide whether the response gives the same answer. Ignore differences in wording and formatting."
+
+// JudgeChoices are the answers the judge picks from, the first passes the response
+var JudgeChoices = []string{"yes", "no"}
+
+// JudgePrompt asks the judge model whether the response agrees with the case's expected answer
+func (c *Case) JudgePrompt(response string) string {
+	return fmt.Sprintf("Question:\n%s\n\nReference answer:\n%s\n\nResponse:\n%s\n\nDoes the response give the same answer as the reference answer? Answer yes or no.", c.Prompt, c.Expected, response)
+}
@@ -0,0 +1,94 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltin(t *testing.T) {
+	assert.Contains(t, Builtin(), "mmlu-mini")
+
+	for _, name := range Builtin() {
+		suite, err := Load(name, MatchExact)
+		require.NoError(t, err, name)
+		assert.NotEmpty(t, suite.Cases, name)
+		assert.False(t, suite.Judged(), name)
+	}
+}
+
+func TestMMLUMini(t *testing.T) {
+	suite, err := Load("mmlu-mini", MatchExact)
+	require.NoError(t, err)
+
+	c := suite.Cases[0]
+	assert.Equal(t, MatchRegex, c.Match)
+	assert.True(t, c.Passes("D"))
+	assert.True(t, c.Passes(" D. Na"))
+	assert.True(t, c.Passes("(D)"))
+	assert.True(t, c.Passes("Answer: D"))
+	assert.False(t, c.Passes("A"))
+	assert.False(t, c.Passes("Dunno"))
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"prompt": "What is the capital of France?", "expected": "Paris"}
+
+{"prompt": "Why is the sky blue?", "expected": "Rayleigh scattering", "match": "judge"}
+`), 0o644))
+
+	suite, err := Load(path, MatchExact)
+	require.NoError(t, err)
+	require.Len(t, suite.Cases, 2)
+	assert.Equal(t, MatchExact, suite.Cases[0].Match)
+	assert.True(t, suite.Judged())
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.jsonl"), MatchExact)
+	assert.ErrorContains(t, err, "mmlu-mini")
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"invalid json":     `{"prompt": `,
+		"missing prompt":   `{"expected": "Paris"}`,
+		"missing expected": `{"prompt": "What is the capital of France?"}`,
+		"unknown match":    `{"prompt": "a", "expected": "b", "match": "fuzzy"}`,
+		"invalid regex":    `{"prompt": "a", "expected": "(", "match": "regex"}`,
+		"no cases":         "\n",
+	}
+
+	for name, suite := range cases {
+		_, err := Parse("suite.jsonl", strings.NewReader(suite), MatchExact)
+		assert.Error(t, err, name)
+	}
+
+	_, err := Parse("suite.jsonl", strings.NewReader("{\"prompt\": \"a\", \"expected\": \"b\"}\n{\"prompt\": \"a\"}"), MatchExact)
+	assert.ErrorContains(t, err, "suite.jsonl:2")
+}
+
+func TestExactMatch(t *testing.T) {
+	c := Case{Prompt: "What is the capital of France?", Expected: "Paris", Match: MatchExact}
+	for _, response := range []string{"Paris", " paris.\n", `"Paris"`, "PARIS"} {
+		assert.True(t, c.Passes(response), response)
+	}
+
+	for _, response := range []string{"Paris, France", "Lyon", ""} {
+		assert.False(t, c.Passes(response), response)
+	}
+}
+
+func TestJudgePrompt(t *testing.T) {
+	c := Case{Prompt: "Why is the sky blue?", Expected: "Rayleigh scattering", Match: MatchJudge}
+	prompt := c.JudgePrompt("Because sunlight scatters off the air.")
+	assert.Contains(t, prompt, "Why is the sky blue?")
+	assert.Contains(t, prompt, "Rayleigh scattering")
+	assert.Contains(t, prompt, "Because sunlight scatters off the air.")
+
+	// judged cases are only scored by the judge
+	assert.False(t, c.Passes("Rayleigh scattering"))
+}
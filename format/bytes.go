@@ -3,6 +3,8 @@ package format
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -11,6 +13,10 @@ const (
 	MegaByte = KiloByte * 1000
 	GigaByte = MegaByte * 1000
 	TeraByte = GigaByte * 1000
+
+	KibiByte = Byte * 1024
+	MebiByte = KibiByte * 1024
+	GibiByte = MebiByte * 1024
 )
 
 func HumanBytes(b int64) string {
@@ -45,3 +51,43 @@ func HumanBytes(b int64) string {
 		return fmt.Sprintf("%d %s", int(value), unit)
 	}
 }
+
+// ParseBytes parses a size such as "512MB", "1.5 GB" or "2GiB", a number without a unit is in bytes
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	var unit float64
+	switch strings.ToUpper(strings.TrimSpace(s[i:])) {
+	case "", "B":
+		unit = Byte
+	case "KB":
+		unit = KiloByte
+	case "MB":
+		unit = MegaByte
+	case "GB":
+		unit = GigaByte
+	case "TB":
+		unit = TeraByte
+	case "KIB":
+		unit = KibiByte
+	case "MIB":
+		unit = MebiByte
+	case "GIB":
+		unit = GibiByte
+	default:
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	return int64(value * unit), nil
+}
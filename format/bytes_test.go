@@ -0,0 +1,32 @@
+package format
+
+import (
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{
+		"1024":    1024,
+		"512MB":   512 * MegaByte,
+		"1.5 GB":  1500 * MegaByte,
+		"2GiB":    2 * GibiByte,
+		"256 mib": 256 * MebiByte,
+		"0":       0,
+	}
+
+	for s, want := range cases {
+		t.Run(s, func(t *testing.T) {
+			got, err := ParseBytes(s)
+			assertEqual(t, err, nil)
+			assertEqual(t, got, want)
+		})
+	}
+
+	for _, s := range []string{"", "GB", "-1GB", "1 XB", "1.2.3MB"} {
+		t.Run(s, func(t *testing.T) {
+			if _, err := ParseBytes(s); err == nil {
+				t.Errorf("expected an error for '%s'", s)
+			}
+		})
+	}
+}
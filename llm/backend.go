@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// Backend loads model files of the formats it supports. Builds of ollama can add backends, for other inference
+// engines or model formats, with Register:
+//
+//	func init() {
+//		llm.Register(onnxBackend{})
+//	}
+//
+// Once loaded, a model is driven through the LLM interface: Predict generates a completion, Embedding embeds
+// text and Encode and Decode convert between text and the model's tokens.
+type Backend interface {
+	// Name identifies the backend, e.g. "llama.cpp"
+	Name() string
+
+	// Supports reports whether the backend can load the model file r. r is at the start of the file and can
+	// be left anywhere.
+	Supports(r io.ReadSeeker) bool
+
+	// Load loads the model, it is closed with LLM.Close when the server is done with it. Only one model is
+	// loaded at a time.
+	Load(LoadOpts) (LLM, error)
+}
+
+// LoadOpts describe the model a backend is asked to load
+type LoadOpts struct {
+	// WorkDir is a temporary directory the backend can write to, such as to extract runners
+	WorkDir string
+
+	// Model is the path of the model file. Adapters are LoRA adapters to apply to it and Projectors are
+	// multimodal projectors for its image inputs.
+	Model      string
+	Adapters   []string
+	Projectors []string
+
+	Options api.Options
+
+	// Progress reports how much of the model is loaded, it is nil if nobody is waiting for it
+	Progress func(api.LoadProgress)
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   []Backend
+
+	// builtinBackends are tried after the registered backends, so those can take over any format
+	builtinBackends = []Backend{mockBackend{}, onnx{}, llamaCpp{}}
+)
+
+// Register adds a backend. Backends are tried in the order they were registered, before the built-in ones.
+// Register panics if b is nil or another backend has the same name.
+func Register(b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if b == nil {
+		panic("llm: Register backend is nil")
+	}
+
+	for _, other := range append(backends, builtinBackends...) {
+		if other.Name() == b.Name() {
+			panic("llm: Register called twice for backend " + b.Name())
+		}
+	}
+
+	backends = append(backends, b)
+}
+
+// Registered returns the registered backend which supports the model file r, or nil if only a built-in one
+// does. r is at the start of the file when it returns.
+func Registered(r io.ReadSeeker) Backend {
+	defer r.Seek(0, io.SeekStart)
+
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	for _, b := range backends {
+		r.Seek(0, io.SeekStart)
+		if b.Supports(r) {
+			return b
+		}
+	}
+
+	return nil
+}
+
+func backendFor(r io.ReadSeeker) (Backend, error) {
+	if b := Registered(r); b != nil {
+		return b, nil
+	}
+
+	for _, b := range builtinBackends {
+		r.Seek(0, io.SeekStart)
+		if b.Supports(r) {
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no backend supports this model file")
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// outputBudget cuts a response off once it reaches a number of characters. With sentences set the
+// response ends with the last sentence which fits, so text is held back until its sentence ends.
+type outputBudget struct {
+	limit     int
+	sentences bool
+
+	// n is the number of characters emitted so far
+	n       int
+	pending []rune
+}
+
+func newOutputBudget(limit int, sentences bool) *outputBudget {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &outputBudget{limit: limit, sentences: sentences}
+}
+
+// Add returns the part of content which can be emitted and whether the budget has run out
+func (b *outputBudget) Add(content string) (string, bool) {
+	b.pending = append(b.pending, []rune(content)...)
+
+	remaining := b.limit - b.n
+	if len(b.pending) <= remaining {
+		if !b.sentences {
+			return b.emit(len(b.pending)), false
+		}
+
+		if end := sentenceEnd(b.pending, len(b.pending)); end > 0 {
+			return b.emit(end), false
+		}
+
+		return "", false
+	}
+
+	if !b.sentences {
+		return b.emit(remaining), true
+	}
+
+	if end := sentenceEnd(b.pending, remaining); end > 0 {
+		return b.emit(end), true
+	}
+
+	if b.n > 0 {
+		// the response already ends with a whole sentence
+		return "", true
+	}
+
+	// not even the first sentence fits, end at the last whole word instead
+	cut := remaining
+	for i := remaining; i > 0; i-- {
+		if unicode.IsSpace(b.pending[i]) {
+			cut = i
+			break
+		}
+	}
+
+	return strings.TrimRightFunc(b.emit(cut), unicode.IsSpace), true
+}
+
+// Flush returns the text held back when the response ends within the budget
+func (b *outputBudget) Flush() string {
+	return b.emit(len(b.pending))
+}
+
+func (b *outputBudget) emit(n int) string {
+	s := string(b.pending[:n])
+	b.pending = b.pending[n:]
+	b.n += n
+	return s
+}
+
+// sentenceEnd returns the end of the last sentence within the first max runes, or 0 if no sentence ends there.
+// A sentence ends with a full stop, question or exclamation mark and any closing quotes or brackets, followed
+// by a space so that e.g. "3.14" is not cut. CJK full stops need no space.
+func sentenceEnd(runes []rune, max int) int {
+	for i := max - 1; i >= 0; i-- {
+		switch runes[i] {
+		case '。', '！', '？':
+			return i + 1
+		case '.', '!', '?', '…':
+			end := i + 1
+			for end < len(runes) && strings.ContainsRune(`"')]”’`, runes[end]) {
+				end++
+			}
+
+			if end <= max && end < len(runes) && unicode.IsSpace(runes[end]) {
+				return end
+			}
+		}
+	}
+
+	return 0
+}
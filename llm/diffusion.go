@@ -0,0 +1,205 @@
+package llm
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// diffusionTensorPrefix starts the names of the UNet weights in stable diffusion checkpoints
+const diffusionTensorPrefix = "model.diffusion_model."
+
+// DiffusionFormat sniffs the stable diffusion weight formats which stable-diffusion.cpp can load directly and
+// returns "safetensors" or "ckpt", or an empty string for anything else such as ggml/gguf files or weights
+// of other models in the same formats
+func DiffusionFormat(r io.ReadSeeker) string {
+	defer r.Seek(0, io.SeekStart)
+
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return ""
+	}
+
+	switch {
+	case bytes.Equal(header[:4], []byte("PK\x03\x04")):
+		// pytorch checkpoints are zip archives
+		if isDiffusionCheckpoint(r) {
+			return "ckpt"
+		}
+	case header[8] == '{' && binary.LittleEndian.Uint64(header[:8]) < 100*1024*1024:
+		// safetensors start with the length of a json header
+		if isDiffusionSafetensors(r, int64(binary.LittleEndian.Uint64(header[:8]))) {
+			return "safetensors"
+		}
+	}
+
+	return ""
+}
+
+// isDiffusionSafetensors looks for the UNet in the names of the tensors, or for the architecture in the
+// metadata of the header
+func isDiffusionSafetensors(r io.ReadSeeker, n int64) bool {
+	if _, err := r.Seek(8, io.SeekStart); err != nil {
+		return false
+	}
+
+	var header map[string]json.RawMessage
+	if err := json.NewDecoder(io.LimitReader(r, n)).Decode(&header); err != nil {
+		return false
+	}
+
+	for name, value := range header {
+		if name == "__metadata__" {
+			var metadata map[string]string
+			if json.Unmarshal(value, &metadata) == nil && strings.Contains(metadata["modelspec.architecture"], "stable-diffusion") {
+				return true
+			}
+		} else if strings.HasPrefix(name, diffusionTensorPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDiffusionCheckpoint looks for the UNet in the names of the tensors pickled in the checkpoint's data.pkl
+func isDiffusionCheckpoint(r io.ReadSeeker) bool {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return false
+	}
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return false
+	}
+
+	for _, f := range zr.File {
+		if path.Base(f.Name) != "data.pkl" {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return false
+		}
+		defer rc.Close()
+
+		// the pickle only holds the structure of the checkpoint, the tensors are stored beside it
+		bts, err := io.ReadAll(io.LimitReader(rc, 64*1024*1024))
+		if err != nil {
+			return false
+		}
+
+		return bytes.Contains(bts, []byte(diffusionTensorPrefix))
+	}
+
+	return false
+}
+
+type ImageGenerateOpts struct {
+	Prompt         string
+	NegativePrompt string
+	Width          int
+	Height         int
+	Steps          int
+	CFGScale       float32
+	Seed           int64
+}
+
+var errDiffusionRunner = errors.New("stable diffusion runner not found, install stable-diffusion.cpp and set OLLAMA_SD_RUNNER to the path of its sd binary")
+
+// diffusionRunnerPath returns the path of the stable-diffusion.cpp binary, the runner is not embedded so it
+// is read from OLLAMA_SD_RUNNER or looked up on the PATH
+func diffusionRunnerPath() (string, error) {
+	if p := os.Getenv("OLLAMA_SD_RUNNER"); p != "" {
+		if _, err := os.Stat(p); err != nil {
+			return "", fmt.Errorf("%w: %v", errDiffusionRunner, err)
+		}
+
+		return p, nil
+	}
+
+	p, err := exec.LookPath("sd")
+	if err != nil {
+		return "", errDiffusionRunner
+	}
+
+	return p, nil
+}
+
+// GenerateImage runs stable-diffusion.cpp once for the prompt and returns the PNG encoded image
+func GenerateImage(ctx context.Context, workDir, model string, opts ImageGenerateOpts) ([]byte, error) {
+	runner, err := diffusionRunnerPath()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(workDir, "image")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "output.png")
+	params := []string{
+		"--model", model,
+		"--prompt", opts.Prompt,
+		"--output", output,
+		"--seed", strconv.FormatInt(opts.Seed, 10),
+	}
+
+	if opts.NegativePrompt != "" {
+		params = append(params, "--negative-prompt", opts.NegativePrompt)
+	}
+
+	if opts.Width > 0 {
+		params = append(params, "--width", strconv.Itoa(opts.Width))
+	}
+
+	if opts.Height > 0 {
+		params = append(params, "--height", strconv.Itoa(opts.Height))
+	}
+
+	if opts.Steps > 0 {
+		params = append(params, "--steps", strconv.Itoa(opts.Steps))
+	}
+
+	if opts.CFGScale > 0 {
+		params = append(params, "--cfg-scale", strconv.FormatFloat(float64(opts.CFGScale), 'f', -1, 32))
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, runner, params...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = &stderr
+
+	log.Print("starting stable diffusion runner")
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			lines := strings.Split(msg, "\n")
+			return nil, fmt.Errorf("stable diffusion runner: %s", lines[len(lines)-1])
+		}
+
+		return nil, fmt.Errorf("stable diffusion runner: %w", err)
+	}
+
+	return os.ReadFile(output)
+}
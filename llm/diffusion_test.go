@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffusionFormat(t *testing.T) {
+	safetensors := func(header string) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, uint64(len(header)))
+		b.WriteString(header)
+		return b.Bytes()
+	}
+
+	checkpoint := func(name, pickle string) []byte {
+		var b bytes.Buffer
+		zw := zip.NewWriter(&b)
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(pickle))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return b.Bytes()
+	}
+
+	cases := map[string]struct {
+		data   []byte
+		format string
+	}{
+		"safetensors unet":         {safetensors(`{"model.diffusion_model.input_blocks.0.0.weight": {}}`), "safetensors"},
+		"safetensors modelspec":    {safetensors(`{"__metadata__": {"modelspec.architecture": "stable-diffusion-xl-v1-base"}, "w": {}}`), "safetensors"},
+		"safetensors llm":          {safetensors(`{"__metadata__": {"format": "pt"}, "model.layers.0.mlp.up_proj.weight": {}}`), ""},
+		"safetensors empty":        {safetensors(`{}`), ""},
+		"safetensors bad header":   {safetensors(`{"model.diffusion_model.`), ""},
+		"checkpoint unet":          {checkpoint("archive/data.pkl", "\x80\x02}q\x00(X\x22\x00\x00\x00model.diffusion_model.out.0.weightq\x01"), "ckpt"},
+		"checkpoint other model":   {checkpoint("archive/data.pkl", "\x80\x02}q\x00(X\x1a\x00\x00\x00model.layers.0.mlp.weightq\x01"), ""},
+		"zip without a checkpoint": {checkpoint("notes.txt", "model.diffusion_model."), ""},
+		"gguf":                     {[]byte("GGUF\x03\x00\x00\x00\x00\x00\x00\x00"), ""},
+	}
+
+	for name, tt := range cases {
+		path := filepath.Join(t.TempDir(), "model")
+		require.NoError(t, os.WriteFile(path, tt.data, 0o644))
+
+		f, err := os.Open(path)
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.format, DiffusionFormat(f), name)
+
+		// the file is left at its start for whoever reads it next
+		offset, err := f.Seek(0, 1)
+		require.NoError(t, err)
+		assert.Zero(t, offset, name)
+		f.Close()
+	}
+}
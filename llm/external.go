@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// External runners run models llama.cpp can't, such as TensorRT-LLM engines. They aren't built with ollama
+// and are installed separately. Like the llama.cpp runner they serve a model on the --port they are given,
+// with the same http API: /completion, /tokenize, /detokenize and /embedding, and a 200 response to HEAD /
+// once the model is loaded.
+
+// externalRunner finds the runner named in $env, or the runner called name on the PATH
+func externalRunner(env, name string) (string, error) {
+	if runner := os.Getenv(env); runner != "" {
+		if _, err := os.Stat(runner); err != nil {
+			return "", fmt.Errorf("%s: %w", env, err)
+		}
+
+		return runner, nil
+	}
+
+	runner, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s isn't installed, install it or set %s", name, env)
+	}
+
+	return runner, nil
+}
+
+// archiveHas reports whether r is a tar archive with a file called name at its top level
+func archiveHas(r io.Reader, name string) bool {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return false
+		}
+
+		if path.Clean(hdr.Name) == name {
+			return true
+		}
+	}
+}
+
+// extractArchives is held while an archive is extracted, so it isn't extracted twice at once
+var extractArchives sync.Mutex
+
+// extractArchive extracts the tar archive to workDir/kind, once for each archive. A partly extracted archive,
+// such as from a server which was stopped, is extracted again.
+func extractArchive(workDir, kind, archive string) (string, error) {
+	extractArchives.Lock()
+	defer extractArchives.Unlock()
+
+	dir := filepath.Join(workDir, kind, filepath.Base(archive))
+	complete := filepath.Join(dir, ".complete")
+	if _, err := os.Stat(complete); err == nil {
+		return dir, nil
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+
+		p := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, 0o755); err != nil {
+				return "", err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				return "", err
+			}
+
+			out, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+			if err != nil {
+				return "", err
+			}
+
+			_, err = io.Copy(out, tr)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+
+			if err != nil {
+				return "", err
+			}
+		default:
+			// links and devices aren't needed to run a model
+			log.Printf("skipping %s in archive", hdr.Name)
+		}
+	}
+
+	if err := os.WriteFile(complete, nil, 0o644); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// startExternal starts the external runner with params and waits for it to serve the model, which is size bytes
+func startExternal(runner string, params []string, size int64, accelerated bool, opts api.Options, fn func(api.LoadProgress)) (*llama, error) {
+	port := rand.Intn(65535-49152) + 49152 // get a random port in the ephemeral range
+	params = append(params, "--port", strconv.Itoa(port))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, runner, params...)
+	cmd.Stdout = os.Stderr
+	statusWriter := NewStatusWriter()
+	if fn != nil {
+		statusWriter.SetProgress(fn, size, 0)
+	}
+	cmd.Stderr = statusWriter
+
+	llm := &llama{Options: opts, Running: Running{Port: port, Cmd: cmd, Cancel: cancel, exitCh: make(chan error)}}
+	llm.placement = Placement{
+		Size:        size,
+		MainGPU:     opts.MainGPU,
+		Accelerated: accelerated,
+		Runner:      runner,
+		Args:        params[:len(params)-2],
+	}
+
+	log.Printf("starting %s", filepath.Base(runner))
+	if err := llm.start(statusWriter); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return llm, nil
+}
@@ -93,9 +93,20 @@ func (c *containerGGML) Name() string {
 }
 
 func (c *containerGGML) Decode(ro *readSeekOffset) (model, error) {
-	// file contents aren't decoded
+	// unversioned files are only decoded far enough to recognize whisper models
+	var whisper whisperModel
+	if err := binary.Read(ro, binary.LittleEndian, &whisper.hyperparameters); err != nil {
+		return nil, err
+	}
+
+	// remaining file contents aren't decoded
 	ro.Seek(0, io.SeekEnd)
-	return nil, nil
+
+	if whisper.hyperparameters.NumAudioCtx != whisperAudioCtx {
+		return nil, nil
+	}
+
+	return &whisper, nil
 }
 
 type containerGGMF struct {
@@ -282,6 +282,31 @@ func (llm *ggufModel) NumLayers() int64 {
 	return int64(v)
 }
 
+// KVCacheSize estimates the bytes of the kv cache for a context of numCtx tokens, or 0 if the metadata
+// needed is missing
+func (llm *ggufModel) KVCacheSize(numCtx int, f16 bool) int64 {
+	family := llm.ModelFamily()
+	embd, _ := llm.kv[fmt.Sprintf("%s.embedding_length", family)].(uint32)
+	heads, _ := llm.kv[fmt.Sprintf("%s.attention.head_count", family)].(uint32)
+	if embd == 0 || heads == 0 {
+		return 0
+	}
+
+	// models using grouped-query attention have fewer kv heads than attention heads
+	headsKV, ok := llm.kv[fmt.Sprintf("%s.attention.head_count_kv", family)].(uint32)
+	if !ok || headsKV == 0 {
+		headsKV = heads
+	}
+
+	var bytesPerValue int64 = 4
+	if f16 {
+		bytesPerValue = 2
+	}
+
+	// a key and a value per token per layer
+	return 2 * int64(numCtx) * llm.NumLayers() * int64(embd/heads*headsKV) * bytesPerValue
+}
+
 func (llm ggufModel) readU8(r io.Reader) uint8 {
 	var u8 uint8
 	binary.Read(r, llm.bo, &u8)
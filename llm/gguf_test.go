@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKVCacheSize(t *testing.T) {
+	llama := func(kv kv) *ggufModel {
+		m := &ggufModel{kv: kv}
+		m.kv["general.architecture"] = "llama"
+		m.kv["llama.block_count"] = uint32(32)
+		return m
+	}
+
+	// a key and a value of 128 values for each of the 8 kv heads, per token and layer
+	gqa := llama(kv{"llama.embedding_length": uint32(4096), "llama.attention.head_count": uint32(32), "llama.attention.head_count_kv": uint32(8)})
+	assert.Equal(t, int64(2*2048*32*1024*2), gqa.KVCacheSize(2048, true))
+	assert.Equal(t, int64(2*2048*32*1024*4), gqa.KVCacheSize(2048, false))
+	assert.Equal(t, 2*gqa.KVCacheSize(2048, true), gqa.KVCacheSize(4096, true))
+
+	// models without grouped-query attention have as many kv heads as attention heads
+	mha := llama(kv{"llama.embedding_length": uint32(4096), "llama.attention.head_count": uint32(32)})
+	assert.Equal(t, int64(2*2048*32*4096*2), mha.KVCacheSize(2048, true))
+
+	assert.Equal(t, int64(0), llama(kv{"llama.embedding_length": uint32(4096)}).KVCacheSize(2048, true))
+	assert.Equal(t, int64(0), llama(kv{}).KVCacheSize(2048, true))
+}
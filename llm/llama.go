@@ -17,7 +17,9 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -58,13 +60,39 @@ ws ::= ([ \t\n] ws)?
 //go:embed llama.cpp/*/build/*/bin/*
 var llamaCppEmbed embed.FS
 
+// Backends lists the runner builds packed into the binary, such as "cpu", "cuda" or "metal"
+func Backends() []string {
+	dirs, err := fs.Glob(llamaCppEmbed, "llama.cpp/*/build/*")
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	backends := []string{}
+	for _, dir := range dirs {
+		if backend := path.Base(dir); !seen[backend] {
+			seen[backend] = true
+			backends = append(backends, backend)
+		}
+	}
+
+	sort.Strings(backends)
+	return backends
+}
+
 type ModelRunner struct {
 	Type        string // "gguf" or "ggml"
 	Path        string // path to the model runner executable
 	Accelerated bool
 }
 
+// extractRunners is held while runners are extracted, so a runner isn't started while it is being written
+var extractRunners sync.Mutex
+
 func chooseRunners(workDir, runnerType string) []ModelRunner {
+	extractRunners.Lock()
+	defer extractRunners.Unlock()
+
 	buildPath := path.Join("llama.cpp", runnerType, "build")
 	var runners []ModelRunner
 
@@ -232,6 +260,7 @@ type llama struct {
 	api.Options
 	ImageData []ImageData
 	Running
+	placement Placement
 }
 
 var (
@@ -239,8 +268,24 @@ var (
 	errAvailableVRAM = errors.New("not enough VRAM available, falling back to CPU only")
 )
 
-// CheckVRAM returns the free VRAM in bytes on Linux machines with NVIDIA GPUs
+// CheckVRAM returns the free VRAM in bytes on Linux machines with NVIDIA GPUs, or an error if there is too
+// little to offload to
 func CheckVRAM() (int64, error) {
+	freeBytes, err := FreeVRAM()
+	if err != nil {
+		return 0, err
+	}
+
+	if freeBytes < 2*format.GigaByte {
+		log.Printf("less than 2 GB VRAM available")
+		return 0, errAvailableVRAM
+	}
+
+	return freeBytes, nil
+}
+
+// FreeVRAM returns the free VRAM in bytes across NVIDIA GPUs
+func FreeVRAM() (int64, error) {
 	cmd := exec.Command("nvidia-smi", "--query-gpu=memory.free", "--format=csv,noheader,nounits")
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
@@ -265,16 +310,65 @@ func CheckVRAM() (int64, error) {
 		freeMiB += vram
 	}
 
-	freeBytes := freeMiB * 1024 * 1024
-	if freeBytes < 2*format.GigaByte {
-		log.Printf("less than 2 GB VRAM available")
-		return 0, errAvailableVRAM
+	return freeMiB * 1024 * 1024, nil
+}
+
+// GPUUsage returns the utilization and memory of each GPU on machines with NVIDIA GPUs
+func GPUUsage() ([]api.GPUMetrics, error) {
+	cmd := exec.Command("nvidia-smi", "--query-gpu=name,utilization.gpu,memory.used,memory.total", "--format=csv,noheader,nounits")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, errNvidiaSMI
 	}
 
-	return freeBytes, nil
+	var gpus []api.GPUMetrics
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != 4 {
+			continue
+		}
+
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		// fields are reported as "[N/A]" when the GPU does not support them
+		utilization, _ := strconv.ParseFloat(fields[1], 64)
+		usedMiB, _ := strconv.ParseUint(fields[2], 10, 64)
+		totalMiB, _ := strconv.ParseUint(fields[3], 10, 64)
+
+		gpus = append(gpus, api.GPUMetrics{
+			Name:        fields[0],
+			Utilization: utilization,
+			MemoryUsed:  usedMiB * 1024 * 1024,
+			MemoryTotal: totalMiB * 1024 * 1024,
+		})
+	}
+
+	return gpus, scanner.Err()
+}
+
+// GPUReserve is the VRAM set by $OLLAMA_GPU_RESERVE which models are never offloaded into, so other
+// applications on the GPU such as the desktop have room to grow
+func GPUReserve() (int64, error) {
+	s := os.Getenv("OLLAMA_GPU_RESERVE")
+	if s == "" {
+		return 0, nil
+	}
+
+	reserve, err := format.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("OLLAMA_GPU_RESERVE: %w", err)
+	}
+
+	return reserve, nil
 }
 
-func NumGPU(numLayer, fileSizeBytes int64, opts api.Options) int {
+// NumGPU is the number of layers to offload to the GPU. kvBytes is the size of the kv cache, 0 if it is
+// unknown; the kv cache is kept in system memory when it would not fit in VRAM along with the model.
+func NumGPU(numLayer, fileSizeBytes, kvBytes int64, opts api.Options) int {
 	if opts.NumGPU != -1 {
 		return opts.NumGPU
 	}
@@ -288,27 +382,114 @@ func NumGPU(numLayer, fileSizeBytes int64, opts api.Options) int {
 			return 0
 		}
 
-		/*
-		 Calculate bytes per layer, this will roughly be the size of the model file divided by the number of layers.
-		 We can store the model weights and the kv cache in vram,
-		 to enable kv chache vram storage add two additional layers to the number of layers retrieved from the model file.
-		*/
-		bytesPerLayer := fileSizeBytes / numLayer
+		reserve, err := GPUReserve()
+		if err != nil {
+			log.Print(err.Error())
+		}
 
-		// 75% of the absolute max number of layers we can fit in available VRAM, off-loading too many layers to the GPU can cause OOM errors
-		layers := int(freeBytes/bytesPerLayer) * 3 / 4
-		log.Printf("%d MB VRAM available, loading up to %d GPU layers", freeBytes/(1024*1024), layers)
+		if reserve > 0 {
+			if freeBytes <= reserve {
+				log.Printf("%d MB VRAM available is within the %s reserved, not loading any GPU layers", freeBytes/(1024*1024), format.HumanBytes(reserve))
+				return 0
+			}
 
-		return layers
+			freeBytes -= reserve
+		}
+
+		return fitLayers(numLayer, fileSizeBytes, kvBytes, freeBytes)
 	}
 	// default to enable metal on macOS
 	return 1
 }
 
+// fitLayers is the number of layers to offload to a GPU with freeBytes of VRAM, more than the model has
+// offloads the kv cache too
+func fitLayers(numLayer, fileSizeBytes, kvBytes, freeBytes int64) int {
+	/*
+	 Calculate bytes per layer, this will roughly be the size of the model file divided by the number of layers.
+	 We can store the model weights and the kv cache in vram,
+	 to enable kv chache vram storage add two additional layers to the number of layers retrieved from the model file.
+	*/
+	bytesPerLayer := fileSizeBytes / numLayer
+
+	// 75% of the absolute max number of layers we can fit in available VRAM, off-loading too many layers to the GPU can cause OOM errors
+	layers := int(freeBytes/bytesPerLayer) * 3 / 4
+	log.Printf("%d MB VRAM available, loading up to %d GPU layers", freeBytes/(1024*1024), layers)
+
+	// llama.cpp offloads the kv cache when asked for more layers than the model has. A long context can
+	// make it too large for VRAM, so keep it in system memory instead: generation is slower, but the
+	// model still loads.
+	if int64(layers) > numLayer && kvBytes > 0 && fileSizeBytes+kvBytes > freeBytes*3/4 {
+		log.Printf("keeping the %s kv cache in system memory, it does not fit in VRAM with the model", format.HumanBytes(kvBytes))
+		return int(numLayer)
+	}
+
+	return layers
+}
+
+// gpuLayers returns the number of layers offloaded to the GPU for a num_gpu value
+func gpuLayers(numGPU, numLayers int) int {
+	// metal offloads the whole model when num_gpu is non-zero
+	if runtime.GOOS == "darwin" && numGPU > 0 {
+		return numLayers
+	}
+
+	if numGPU > numLayers {
+		return numLayers
+	}
+
+	return numGPU
+}
+
 // StatusWriter is a writer that captures error messages from the llama runner process
 type StatusWriter struct {
 	ErrCh      chan error
 	LastErrMsg string
+
+	mu       sync.Mutex
+	progress func(api.LoadProgress)
+	load     api.LoadProgress
+}
+
+var offloadedPattern = regexp.MustCompile(`offloaded (\d+)/(\d+) layers to GPU`)
+
+// SetProgress reports model load progress parsed from the runner output to fn until it is called with nil
+func (w *StatusWriter) SetProgress(fn func(api.LoadProgress), size int64, totalLayers int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.progress = fn
+	w.load = api.LoadProgress{Total: size, TotalLayers: totalLayers}
+}
+
+// parseProgress updates load progress from runner output. llama.cpp prints a dot for every
+// percent of the model loaded and a summary of the layers offloaded to the GPU.
+func (w *StatusWriter) parseProgress(b []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.progress == nil {
+		return
+	}
+
+	if match := offloadedPattern.FindSubmatch(b); match != nil {
+		w.load.LayersOffloaded, _ = strconv.Atoi(string(match[1]))
+		w.load.TotalLayers, _ = strconv.Atoi(string(match[2]))
+		w.progress(w.load)
+		return
+	}
+
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 || len(bytes.Trim(trimmed, ".")) > 0 {
+		return
+	}
+
+	w.load.Percent += float64(len(trimmed))
+	if w.load.Percent > 100 {
+		w.load.Percent = 100
+	}
+
+	w.load.Completed = int64(float64(w.load.Total) * w.load.Percent / 100)
+	w.progress(w.load)
 }
 
 func NewStatusWriter() *StatusWriter {
@@ -327,13 +508,19 @@ func (w *StatusWriter) Write(b []byte) (int, error) {
 
 	if errMsg != "" {
 		w.LastErrMsg = errMsg
-		w.ErrCh <- fmt.Errorf("llama runner: %s", errMsg)
+		if strings.Contains(strings.ToLower(errMsg), "out of memory") {
+			w.ErrCh <- memoryError("llama runner: " + errMsg)
+		} else {
+			w.ErrCh <- fmt.Errorf("llama runner: %s", errMsg)
+		}
 	}
 
+	w.parseProgress(b)
+
 	return os.Stderr.Write(b)
 }
 
-func newLlama(model string, adapters, projectors []string, runners []ModelRunner, numLayers int64, opts api.Options) (*llama, error) {
+func newLlama(model string, adapters, projectors []string, runners []ModelRunner, numLayers, kvBytes int64, opts api.Options, fn func(api.LoadProgress)) (*llama, error) {
 	fileInfo, err := os.Stat(model)
 	if err != nil {
 		return nil, err
@@ -343,7 +530,7 @@ func newLlama(model string, adapters, projectors []string, runners []ModelRunner
 		return nil, errors.New("ollama supports only one lora adapter, but multiple were provided")
 	}
 
-	numGPU := NumGPU(numLayers, fileInfo.Size(), opts)
+	numGPU := NumGPU(numLayers, fileInfo.Size(), kvBytes, opts)
 	params := []string{
 		"--model", model,
 		"--ctx-size", fmt.Sprintf("%d", opts.NumCtx),
@@ -429,47 +616,26 @@ func newLlama(model string, adapters, projectors []string, runners []ModelRunner
 		cmd.Env = append(os.Environ(), fmt.Sprintf("LD_LIBRARY_PATH=%s", strings.Join(libraryPaths, ":")))
 		cmd.Stdout = os.Stderr
 		statusWriter := NewStatusWriter()
+		if fn != nil {
+			statusWriter.SetProgress(fn, fileInfo.Size(), int(numLayers))
+		}
 		cmd.Stderr = statusWriter
 
 		llm := &llama{Options: opts, Running: Running{Port: port, Cmd: cmd, Cancel: cancel, exitCh: make(chan error)}}
-
-		log.Print("starting llama runner")
-		if err := llm.Cmd.Start(); err != nil {
-			log.Printf("error starting the external llama runner: %v", err)
-			continue
+		llm.placement = Placement{
+			Size:        fileInfo.Size(),
+			TotalLayers: int(numLayers),
+			GPULayers:   gpuLayers(numGPU, int(numLayers)),
+			MainGPU:     opts.MainGPU,
+			Accelerated: runner.Accelerated,
+			Runner:      runner.Path,
+			Args:        params[:len(params)-2],
 		}
 
-		// monitor the llama runner process and signal when it exits
-		go func() {
-			err := llm.Cmd.Wait()
-			// default to printing the exit message of the command process, it will probably just say 'exit staus 1'
-			errMsg := err.Error()
-			// try to set a better error message if llama runner logs captured an error
-			if statusWriter.LastErrMsg != "" {
-				errMsg = statusWriter.LastErrMsg
-			}
-			log.Println(errMsg)
-			// llm.Cmd.Wait() can only be called once, use this exit channel to signal that the process has exited
-			llm.exitOnce.Do(func() {
-				close(llm.exitCh)
-			})
-		}()
-
-		if err := waitForServer(llm); err != nil {
-			log.Printf("error starting llama runner: %v", err)
-			llm.Close()
-
-			// default the runnerErr to the error returned by the most recent llama runner process
-			runnerErr = err
-
-			// capture the error directly from the runner process, if any
-			select {
-			case runnerErr = <-statusWriter.ErrCh:
-			default:
-				// the runner process probably timed out
-			}
-
+		log.Print("starting llama runner")
+		if err := llm.start(statusWriter); err != nil {
 			// try again
+			runnerErr = err
 			continue
 		}
 
@@ -485,6 +651,50 @@ func newLlama(model string, adapters, projectors []string, runners []ModelRunner
 	return nil, fmt.Errorf("failed to start a llama runner")
 }
 
+// start starts the runner process and waits for it to serve requests. If it doesn't, start returns the error
+// the runner logged if there is one.
+func (llm *llama) start(statusWriter *StatusWriter) error {
+	if err := llm.Cmd.Start(); err != nil {
+		log.Printf("error starting the external llama runner: %v", err)
+		return err
+	}
+
+	// monitor the llama runner process and signal when it exits
+	go func() {
+		err := llm.Cmd.Wait()
+		// default to printing the exit message of the command process, it will probably just say 'exit staus 1'
+		errMsg := err.Error()
+		// try to set a better error message if llama runner logs captured an error
+		if statusWriter.LastErrMsg != "" {
+			errMsg = statusWriter.LastErrMsg
+		}
+		log.Println(errMsg)
+		// llm.Cmd.Wait() can only be called once, use this exit channel to signal that the process has exited
+		llm.exitOnce.Do(func() {
+			close(llm.exitCh)
+		})
+	}()
+
+	err := waitForServer(llm)
+	// stop reporting progress once the runner has loaded the model or failed to
+	statusWriter.SetProgress(nil, 0, 0)
+	if err != nil {
+		log.Printf("error starting llama runner: %v", err)
+		llm.Close()
+
+		// capture the error directly from the runner process, if any
+		select {
+		case err = <-statusWriter.ErrCh:
+		default:
+			// the runner process probably timed out
+		}
+
+		return err
+	}
+
+	return nil
+}
+
 func waitForServer(llm *llama) error {
 	start := time.Now()
 	expiresAt := time.Now().Add(3 * time.Minute) // be generous with timeout, large models can take a while to load
@@ -530,12 +740,21 @@ func (llm *llama) SetOptions(opts api.Options) {
 	llm.Options = opts
 }
 
+func (llm *llama) Placement() Placement {
+	return llm.placement
+}
+
 type prediction struct {
 	Content string `json:"content"`
 	Model   string `json:"model"`
 	Prompt  string `json:"prompt"`
 	Stop    bool   `json:"stop"`
 
+	// StoppedLimit is set when the response ran into n_predict
+	StoppedLimit bool `json:"stopped_limit"`
+
+	CompletionProbabilities []TokenProbs `json:"completion_probabilities"`
+
 	Timings struct {
 		PredictedN  int     `json:"predicted_n"`
 		PredictedMS float64 `json:"predicted_ms"`
@@ -549,19 +768,49 @@ const maxRetries = 6
 
 type PredictOpts struct {
 	Prompt string
+	Suffix string
 	Format string
 	Images []api.ImageData
+
+	// Grammar constrains sampling with a GBNF grammar, it takes precedence over Format
+	Grammar string
+	// NumProbs is the number of most likely candidates to report for each generated token
+	NumProbs int
+	// CachePrompt reuses the runner's cache for the start of the prompt it has already evaluated
+	CachePrompt bool
+}
+
+// TokenProb is the probability of a single candidate token
+type TokenProb struct {
+	Token string  `json:"tok_str"`
+	Prob  float64 `json:"prob"`
+}
+
+// TokenProbs lists the most likely candidates for a generated token
+type TokenProbs struct {
+	Content string      `json:"content"`
+	Probs   []TokenProb `json:"probs"`
 }
 
 type PredictResult struct {
 	Content            string
+	Probs              []TokenProbs
 	Done               bool
 	PromptEvalCount    int
 	PromptEvalDuration time.Duration
 	EvalCount          int
 	EvalDuration       time.Duration
+
+	// FinishReason is set on the final result, it is FinishReasonLength if the response was cut off by
+	// num_predict or num_predict_chars
+	FinishReason string
 }
 
+const (
+	FinishReasonStop   = "stop"
+	FinishReasonLength = "length"
+)
+
 // IsRetryable checks if the line matches a condition that can be retried
 func isRetryable(line []byte) bool {
 	return bytes.Contains(line, []byte("slot unavailable"))
@@ -604,6 +853,28 @@ func (llm *llama) Predict(ctx context.Context, predict PredictOpts, fn func(Pred
 		request["grammar"] = jsonGrammar
 	}
 
+	if predict.Grammar != "" {
+		request["grammar"] = predict.Grammar
+	}
+
+	if predict.NumProbs > 0 {
+		request["n_probs"] = predict.NumProbs
+	}
+
+	if predict.CachePrompt {
+		request["cache_prompt"] = true
+	}
+
+	// fill-in-the-middle requests use the runner's infill endpoint which
+	// wraps the prefix and suffix in the model's own FIM special tokens
+	completion := "completion"
+	if predict.Suffix != "" {
+		completion = "infill"
+		request["input_prefix"] = predict.Prompt
+		request["input_suffix"] = predict.Suffix
+		request["prompt"] = ""
+	}
+
 	retryDelay := 100 * time.Microsecond
 	for retries := 0; retries < maxRetries; retries++ {
 		if retries > 0 {
@@ -620,7 +891,7 @@ func (llm *llama) Predict(ctx context.Context, predict PredictOpts, fn func(Pred
 			return fmt.Errorf("failed to marshal data: %v", err)
 		}
 
-		endpoint := fmt.Sprintf("http://127.0.0.1:%d/completion", llm.Port)
+		endpoint := fmt.Sprintf("http://127.0.0.1:%d/%s", llm.Port, completion)
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, buffer)
 		if err != nil {
 			return fmt.Errorf("error creating POST request: %v", err)
@@ -647,6 +918,11 @@ func (llm *llama) Predict(ctx context.Context, predict PredictOpts, fn func(Pred
 		buf := make([]byte, 0, maxBufferSize)
 		scanner.Buffer(buf, maxBufferSize)
 
+		// the runner only limits tokens, a character budget is enforced here
+		budget := newOutputBudget(llm.NumPredictChars, llm.StopAtSentence)
+		var evalCount int
+		var evalStart time.Time
+
 		retryNeeded := false
 		for scanner.Scan() {
 			select {
@@ -675,18 +951,55 @@ func (llm *llama) Predict(ctx context.Context, predict PredictOpts, fn func(Pred
 				}
 
 				if p.Content != "" {
-					fn(PredictResult{
-						Content: p.Content,
-					})
+					if evalCount == 0 {
+						evalStart = time.Now()
+					}
+					evalCount++
+
+					content, spent := p.Content, false
+					if budget != nil {
+						content, spent = budget.Add(p.Content)
+					}
+
+					if content != "" {
+						fn(PredictResult{
+							Content: content,
+							Probs:   p.CompletionProbabilities,
+						})
+					}
+
+					if spent {
+						// returning closes the connection, which stops the runner generating. It doesn't report
+						// timings then so the eval is timed here.
+						fn(PredictResult{
+							Done:         true,
+							EvalCount:    evalCount,
+							EvalDuration: time.Since(evalStart),
+							FinishReason: FinishReasonLength,
+						})
+						return nil
+					}
 				}
 
 				if p.Stop {
+					if budget != nil {
+						if content := budget.Flush(); content != "" {
+							fn(PredictResult{Content: content})
+						}
+					}
+
+					finishReason := FinishReasonStop
+					if p.StoppedLimit {
+						finishReason = FinishReasonLength
+					}
+
 					fn(PredictResult{
 						Done:               true,
 						PromptEvalCount:    p.Timings.PromptN,
 						PromptEvalDuration: parseDurationMs(p.Timings.PromptMS),
 						EvalCount:          p.Timings.PredictedN,
 						EvalDuration:       parseDurationMs(p.Timings.PredictedMS),
+						FinishReason:       finishReason,
 					})
 					return nil
 				}
@@ -698,9 +1011,13 @@ func (llm *llama) Predict(ctx context.Context, predict PredictOpts, fn func(Pred
 				// this means the llama runner subprocess crashed
 				llm.Close()
 				if llm.StatusWriter != nil && llm.StatusWriter.LastErrMsg != "" {
+					if strings.Contains(strings.ToLower(llm.StatusWriter.LastErrMsg), "out of memory") {
+						return memoryError("llama runner exited: " + llm.StatusWriter.LastErrMsg)
+					}
+
 					return fmt.Errorf("llama runner exited: %v", llm.StatusWriter.LastErrMsg)
 				}
-				return fmt.Errorf("llama runner exited, you may not have enough available memory to run this model")
+				return memoryError("llama runner exited, you may not have enough available memory to run this model")
 			}
 			return fmt.Errorf("error reading llm response: %v", err)
 		}
@@ -808,16 +1125,37 @@ func (llm *llama) Decode(ctx context.Context, tokens []int) (string, error) {
 }
 
 type EmbeddingRequest struct {
-	Content string `json:"content"`
+	// Content is either a string or a list of tokens
+	Content   any         `json:"content"`
+	ImageData []ImageData `json:"image_data,omitempty"`
+}
+
+type EmbeddingOpts struct {
+	Content string
+	Images  []api.ImageData
+
+	// Tokens are embedded instead of Content if set
+	Tokens []int
 }
 
 type EmbeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
-func (llm *llama) Embedding(ctx context.Context, input string) ([]float64, error) {
+func (llm *llama) Embedding(ctx context.Context, embed EmbeddingOpts) ([]float64, error) {
+	request := EmbeddingRequest{Content: embed.Content}
+	if len(embed.Tokens) > 0 {
+		request.Content = embed.Tokens
+	}
+
+	// images are referenced from the content by their id, e.g. [img-0], and are projected
+	// into the same embedding space as the text by the model's projector
+	for id, image := range embed.Images {
+		request.ImageData = append(request.ImageData, ImageData{Data: image, ID: id})
+	}
+
 	endpoint := fmt.Sprintf("http://127.0.0.1:%d/embedding", llm.Port)
-	data, err := json.Marshal(TokenizeRequest{Content: input})
+	data, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling embed data: %w", err)
 	}
@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitLayers(t *testing.T) {
+	const gb = 1_000_000_000
+
+	// a 32 layer model of 3.2 GB, 100 MB a layer
+	cases := []struct {
+		name          string
+		kvBytes, free int64
+		expected      int
+	}{
+		{"partial", 256 << 20, 1 * gb, 7},
+		{"model and kv cache fit", 256 << 20, 8 * gb, 60},
+		{"kv cache doesn't fit", 2 << 30, 5 * gb, 32},
+		{"kv cache size unknown", 0, 5 * gb, 37},
+		{"no vram", 256 << 20, 0, 0},
+	}
+
+	for _, tt := range cases {
+		assert.Equal(t, tt.expected, fitLayers(32, 32*100_000_000, tt.kvBytes, tt.free), tt.name)
+	}
+}
+
+func TestStatusWriterOutOfMemory(t *testing.T) {
+	w := NewStatusWriter()
+	w.Write([]byte("CUDA error 2 at ggml-cuda.cu:7024: out of memory\n"))
+	assert.ErrorIs(t, <-w.ErrCh, ErrOutOfMemory)
+
+	w.Write([]byte("error: failed to load model 'model.gguf'\n"))
+	err := <-w.ErrCh
+	assert.EqualError(t, err, "llama runner: failed to load model 'model.gguf'")
+	assert.NotErrorIs(t, err, ErrOutOfMemory)
+}
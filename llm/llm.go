@@ -2,7 +2,9 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -13,32 +15,100 @@ import (
 	"github.com/jmorganca/ollama/format"
 )
 
+// ErrOutOfMemory is matched, with errors.Is, by the errors of models which don't fit in memory
+var ErrOutOfMemory = errors.New("out of memory")
+
+// memoryError is an error whose message says there isn't enough memory for the model
+type memoryError string
+
+func (e memoryError) Error() string {
+	return string(e)
+}
+
+func (e memoryError) Is(target error) bool {
+	return target == ErrOutOfMemory
+}
+
 type LLM interface {
 	Predict(context.Context, PredictOpts, func(PredictResult)) error
-	Embedding(context.Context, string) ([]float64, error)
+	Embedding(context.Context, EmbeddingOpts) ([]float64, error)
 	Encode(context.Context, string) ([]int, error)
 	Decode(context.Context, []int) (string, error)
 	SetOptions(api.Options)
+	Placement() Placement
 	Close()
 	Ping(context.Context) error
 }
 
-func New(workDir, model string, adapters, projectors []string, opts api.Options) (LLM, error) {
-	if _, err := os.Stat(model); err != nil {
+// Placement describes where a loaded model's weights were placed
+type Placement struct {
+	// Size is the size of the model weights in bytes
+	Size int64
+
+	TotalLayers int
+	GPULayers   int
+	MainGPU     int
+
+	// Accelerated is true if the runner uses a GPU
+	Accelerated bool
+
+	// Runner is the runner executable and Args the flags it was started with, except its port
+	Runner string
+	Args   []string
+}
+
+// New loads the model with the first backend which supports it, reporting load progress to fn if it is not nil
+func New(workDir, model string, adapters, projectors []string, opts api.Options, fn func(api.LoadProgress)) (LLM, error) {
+	f, err := os.Open(model)
+	if err != nil {
 		return nil, err
 	}
 
-	f, err := os.Open(model)
+	b, err := backendFor(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Load(LoadOpts{
+		WorkDir:    workDir,
+		Model:      model,
+		Adapters:   adapters,
+		Projectors: projectors,
+		Options:    opts,
+		Progress:   fn,
+	})
+}
+
+// llamaCpp runs ggml and gguf models in a llama.cpp runner subprocess
+type llamaCpp struct{}
+
+func (llamaCpp) Name() string {
+	return "llama.cpp"
+}
+
+func (llamaCpp) Supports(r io.ReadSeeker) bool {
+	_, err := DecodeGGML(r)
+	return err == nil
+}
+
+func (llamaCpp) Load(lo LoadOpts) (LLM, error) {
+	f, err := os.Open(lo.Model)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
+	opts := lo.Options
 	ggml, err := DecodeGGML(f)
 	if err != nil {
 		return nil, err
 	}
 
+	if ggml.model != nil && ggml.ModelFamily() == "whisper" {
+		return nil, errors.New("whisper models can only be used for audio transcription")
+	}
+
 	if runtime.GOOS == "darwin" {
 		switch ggml.FileType() {
 		case "F32", "Q5_0", "Q5_1", "Q8_0":
@@ -70,9 +140,9 @@ func New(workDir, model string, adapters, projectors []string, opts api.Options)
 		systemMemory := int64(memory.TotalMemory())
 
 		if ggml.FileType() == "F16" && requiredMemory*f16Multiplier > systemMemory {
-			return nil, fmt.Errorf("F16 model requires at least %s of total memory", format.HumanBytes(requiredMemory))
+			return nil, memoryError(fmt.Sprintf("F16 model requires at least %s of total memory", format.HumanBytes(requiredMemory)))
 		} else if requiredMemory > systemMemory {
-			return nil, fmt.Errorf("model requires at least %s of total memory", format.HumanBytes(requiredMemory))
+			return nil, memoryError(fmt.Sprintf("model requires at least %s of total memory", format.HumanBytes(requiredMemory)))
 		}
 	}
 
@@ -82,9 +152,15 @@ func New(workDir, model string, adapters, projectors []string, opts api.Options)
 		opts.NumGQA = 0
 		opts.RopeFrequencyBase = 0.0
 		opts.RopeFrequencyScale = 0.0
-		return newLlama(model, adapters, projectors, chooseRunners(workDir, "gguf"), ggml.NumLayers(), opts)
+
+		var kvBytes int64
+		if m, ok := ggml.model.(*ggufModel); ok {
+			kvBytes = m.KVCacheSize(opts.NumCtx, opts.F16KV)
+		}
+
+		return newLlama(lo.Model, lo.Adapters, lo.Projectors, chooseRunners(lo.WorkDir, "gguf"), ggml.NumLayers(), kvBytes, opts, lo.Progress)
 	case "ggml", "ggmf", "ggjt", "ggla":
-		return newLlama(model, adapters, projectors, chooseRunners(workDir, "ggml"), ggml.NumLayers(), opts)
+		return newLlama(lo.Model, lo.Adapters, lo.Projectors, chooseRunners(lo.WorkDir, "ggml"), ggml.NumLayers(), 0, opts, lo.Progress)
 	default:
 		return nil, fmt.Errorf("unknown ggml type: %s", ggml.ModelFamily())
 	}
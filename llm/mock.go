@@ -0,0 +1,239 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// mockMagic starts the model file of a mock model, it is followed by the mock's mode
+const mockMagic = "ollama-mock "
+
+// mockEmbeddingLength is the length of the embeddings a mock model returns
+const mockEmbeddingLength = 16
+
+// MockModes are the modes a mock model can be created with. An echo model responds with its prompt, after the
+// model's template is applied, so a template controls what it says. An infill model is an echo model which can
+// also fill in the middle, it responds to a prefix and suffix with the prompt a code model would be given.
+var MockModes = []string{"echo", "infill"}
+
+// MockModel returns the model file of a mock model in mode, a mock model loads no weights and runs no runner
+func MockModel(mode string) (io.Reader, error) {
+	for _, m := range MockModes {
+		if m == mode {
+			return strings.NewReader(mockMagic + mode + "\n"), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown mock model '%s', expected one of %s", mode, strings.Join(MockModes, ", "))
+}
+
+// MockMode sniffs the model file of a mock model and returns its mode, or an empty string for anything else
+func MockMode(r io.ReadSeeker) string {
+	defer r.Seek(0, io.SeekStart)
+
+	header := make([]byte, 64)
+	n, _ := io.ReadFull(r, header)
+	mode, ok := bytes.CutPrefix(header[:n], []byte(mockMagic))
+	if !ok {
+		return ""
+	}
+
+	mode, _, ok = bytes.Cut(mode, []byte("\n"))
+	if !ok {
+		return ""
+	}
+
+	return string(mode)
+}
+
+// mockBackend loads mock models
+type mockBackend struct{}
+
+func (mockBackend) Name() string {
+	return "mock"
+}
+
+func (mockBackend) Supports(r io.ReadSeeker) bool {
+	return MockMode(r) != ""
+}
+
+func (mockBackend) Load(lo LoadOpts) (LLM, error) {
+	f, err := os.Open(lo.Model)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mode := MockMode(f)
+
+	// with no weights to read the model is loaded at once
+	if lo.Progress != nil {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		lo.Progress(api.LoadProgress{Percent: 100, Completed: fi.Size(), Total: fi.Size()})
+	}
+
+	return newMock(mode, lo.Options), nil
+}
+
+// mock is a deterministic LLM for testing clients and the server without a GPU or model weights. Tokens are the
+// bytes of the text.
+type mock struct {
+	mode string
+	api.Options
+}
+
+func newMock(mode string, opts api.Options) *mock {
+	return &mock{mode: mode, Options: opts}
+}
+
+func (m *mock) Predict(ctx context.Context, predict PredictOpts, fn func(PredictResult)) error {
+	response := predict.Prompt
+	if predict.Suffix != "" {
+		if m.mode != "infill" {
+			return errors.New("mock model can't fill in the middle")
+		}
+
+		response = "<PRE> " + predict.Prompt + " <SUF>" + predict.Suffix + " <MID>"
+	}
+	finishReason := FinishReasonStop
+	for _, stop := range m.Stop {
+		if stop == "" {
+			continue
+		}
+
+		if i := strings.Index(response, stop); i >= 0 {
+			response = response[:i]
+		}
+	}
+
+	// the response is streamed a word at a time, with each word counted as a token
+	var words []string
+	start := 0
+	for i, r := range response {
+		if i > start && unicode.IsSpace(r) && !unicode.IsSpace(rune(response[i-1])) {
+			words = append(words, response[start:i])
+			start = i
+		}
+	}
+
+	if start < len(response) {
+		words = append(words, response[start:])
+	}
+
+	if m.NumPredict > 0 && len(words) > m.NumPredict {
+		words = words[:m.NumPredict]
+		finishReason = FinishReasonLength
+	}
+
+	for _, word := range words {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fn(PredictResult{Content: word, Probs: mockProbs(word, predict.NumProbs)})
+	}
+
+	fn(PredictResult{
+		Done:            true,
+		PromptEvalCount: len(predict.Prompt),
+		EvalCount:       len(words),
+		FinishReason:    finishReason,
+	})
+
+	return nil
+}
+
+// mockProbs makes the word three times as likely as the same word in upper case, which is the only other
+// candidate
+func mockProbs(word string, n int) []TokenProbs {
+	if n <= 0 {
+		return nil
+	}
+
+	candidates := []TokenProb{{Token: word, Prob: 0.75}, {Token: strings.ToUpper(word), Prob: 0.25}}
+	if n < len(candidates) {
+		candidates = candidates[:n]
+	}
+
+	return []TokenProbs{{Content: word, Probs: candidates}}
+}
+
+// Embedding returns a unit vector derived from a hash of the content, so the same content always has the same
+// embedding
+func (m *mock) Embedding(ctx context.Context, embed EmbeddingOpts) ([]float64, error) {
+	content := embed.Content
+	if len(embed.Tokens) > 0 {
+		var err error
+		if content, err = m.Decode(ctx, embed.Tokens); err != nil {
+			return nil, err
+		}
+	}
+
+	embedding := make([]float64, mockEmbeddingLength)
+	var norm float64
+	for i := range embedding {
+		h := fnv.New64a()
+		binary.Write(h, binary.LittleEndian, uint32(i))
+		h.Write([]byte(content))
+
+		embedding[i] = float64(h.Sum64())/math.MaxUint64*2 - 1
+		norm += embedding[i] * embedding[i]
+	}
+
+	for i := range embedding {
+		embedding[i] /= math.Sqrt(norm)
+	}
+
+	return embedding, nil
+}
+
+func (m *mock) Encode(ctx context.Context, prompt string) ([]int, error) {
+	tokens := make([]int, len(prompt))
+	for i := 0; i < len(prompt); i++ {
+		tokens[i] = int(prompt[i])
+	}
+
+	return tokens, nil
+}
+
+func (m *mock) Decode(ctx context.Context, tokens []int) (string, error) {
+	b := make([]byte, len(tokens))
+	for i, token := range tokens {
+		if token < 0 || token > math.MaxUint8 {
+			return "", fmt.Errorf("invalid token %d", token)
+		}
+
+		b[i] = byte(token)
+	}
+
+	return string(b), nil
+}
+
+func (m *mock) SetOptions(opts api.Options) {
+	m.Options = opts
+}
+
+func (m *mock) Placement() Placement {
+	return Placement{Runner: "mock"}
+}
+
+func (m *mock) Close() {}
+
+func (m *mock) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// IsONNXModel reports whether r is an ONNX model archive, a tar of an exported sentence-transformers model
+// with its model.onnx and tokenizer.json at the top level
+func IsONNXModel(r io.ReadSeeker) bool {
+	defer r.Seek(0, io.SeekStart)
+
+	if !archiveHas(r, "model.onnx") {
+		return false
+	}
+
+	r.Seek(0, io.SeekStart)
+	return archiveHas(r, "tokenizer.json")
+}
+
+// onnx runs ONNX embedding models with ollama-onnx-runner, or the runner in $OLLAMA_ONNX_RUNNER, which runs
+// them with onnxruntime
+type onnx struct{}
+
+func (onnx) Name() string {
+	return "onnx"
+}
+
+func (onnx) Supports(r io.ReadSeeker) bool {
+	return IsONNXModel(r)
+}
+
+func (onnx) Load(lo LoadOpts) (LLM, error) {
+	if len(lo.Adapters) > 0 || len(lo.Projectors) > 0 {
+		return nil, errors.New("ONNX models can't be used with adapters or projectors")
+	}
+
+	runner, err := externalRunner("OLLAMA_ONNX_RUNNER", "ollama-onnx-runner")
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(lo.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := extractArchive(lo.WorkDir, "onnx", lo.Model)
+	if err != nil {
+		return nil, fmt.Errorf("extracting ONNX model: %w", err)
+	}
+
+	params := []string{
+		"--model-dir", dir,
+		"--ctx-size", strconv.Itoa(lo.Options.NumCtx),
+		"--batch-size", strconv.Itoa(lo.Options.NumBatch),
+	}
+
+	if lo.Options.NumThread > 0 {
+		params = append(params, "--threads", strconv.Itoa(lo.Options.NumThread))
+	}
+
+	llm, err := startExternal(runner, params, fileInfo.Size(), false, lo.Options, lo.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return embedOnly{llm}, nil
+}
+
+// embedOnly is a runner for a model which can only embed text
+type embedOnly struct {
+	*llama
+}
+
+func (embedOnly) Predict(context.Context, PredictOpts, func(PredictResult)) error {
+	return errors.New("this model can only generate embeddings")
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// IsTensorRTEngine reports whether r is a TensorRT-LLM engine archive, a tar of the directory trtllm-build
+// writes which has the engine's config.json
+func IsTensorRTEngine(r io.Reader) bool {
+	return archiveHas(r, "config.json")
+}
+
+// NewTensorRT starts a runner for the TensorRT-LLM engine archive engine, with ollama-tensorrt-runner or the
+// runner in $OLLAMA_TENSORRT_RUNNER. Engines are built for a GPU architecture and TensorRT-LLM version, so it
+// is up to the caller to fall back to the model's weights if the runner can't load it.
+func NewTensorRT(workDir, engine string, opts api.Options, fn func(api.LoadProgress)) (LLM, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("TensorRT-LLM engines only run on linux")
+	}
+
+	if opts.NumGPU == 0 {
+		return nil, errors.New("TensorRT-LLM engines need a GPU but num_gpu is 0")
+	}
+
+	runner, err := externalRunner("OLLAMA_TENSORRT_RUNNER", "ollama-tensorrt-runner")
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(engine)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := extractArchive(workDir, "tensorrt", engine)
+	if err != nil {
+		return nil, fmt.Errorf("extracting TensorRT-LLM engine: %w", err)
+	}
+
+	params := []string{
+		"--engine-dir", dir,
+		"--ctx-size", strconv.Itoa(opts.NumCtx),
+		"--batch-size", strconv.Itoa(opts.NumBatch),
+	}
+
+	if opts.MainGPU > 0 {
+		params = append(params, "--main-gpu", strconv.Itoa(opts.MainGPU))
+	}
+
+	return startExternal(runner, params, fileInfo.Size(), true, opts, fn)
+}
@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/jmorganca/ollama/tokenizer"
+)
+
+// ErrNoTokenizer is returned by LoadTokenizer for models without a vocabulary in their metadata
+var ErrNoTokenizer = errors.New("model has no tokenizer")
+
+// LoadTokenizer reads the vocabulary of the gguf model at path, so its text can be tokenized without
+// running the model
+func LoadTokenizer(path string) (tokenizer.Tokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ggml, err := DecodeGGML(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := ggml.model.(*ggufModel)
+	if !ok {
+		return nil, ErrNoTokenizer
+	}
+
+	model, _ := m.kv["tokenizer.ggml.model"].(string)
+	tokens, _ := m.kv["tokenizer.ggml.tokens"].([]any)
+	if model == "" || len(tokens) == 0 {
+		return nil, ErrNoTokenizer
+	}
+
+	v := tokenizer.Vocabulary{
+		BOS: kvInt(m.kv, "tokenizer.ggml.bos_token_id", -1),
+		EOS: kvInt(m.kv, "tokenizer.ggml.eos_token_id", -1),
+		UNK: kvInt(m.kv, "tokenizer.ggml.unknown_token_id", -1),
+		// llama.cpp adds BOS to the prompts of SentencePiece models unless they say otherwise
+		AddBOS: model == "llama",
+	}
+
+	if add, ok := m.kv["tokenizer.ggml.add_bos_token"].(bool); ok {
+		v.AddBOS = add
+	}
+
+	if add, ok := m.kv["tokenizer.ggml.add_eos_token"].(bool); ok {
+		v.AddEOS = add
+	}
+
+	for _, token := range tokens {
+		s, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid token %v", token)
+		}
+
+		v.Tokens = append(v.Tokens, s)
+	}
+
+	types, _ := m.kv["tokenizer.ggml.token_type"].([]any)
+	for _, t := range types {
+		v.Types = append(v.Types, tokenizer.TokenType(anyInt(t, int(tokenizer.TypeNormal))))
+	}
+
+	scores, _ := m.kv["tokenizer.ggml.scores"].([]any)
+	for _, score := range scores {
+		s, _ := score.(float32)
+		v.Scores = append(v.Scores, s)
+	}
+
+	merges, _ := m.kv["tokenizer.ggml.merges"].([]any)
+	for _, merge := range merges {
+		s, _ := merge.(string)
+		v.Merges = append(v.Merges, s)
+	}
+
+	pre, _ := m.kv["tokenizer.ggml.pre"].(string)
+	return tokenizer.New(model, pre, &v)
+}
+
+// infillTokens start the prefix of a fill in the middle prompt in the vocabularies of the models trained for
+// it, such as CodeLlama's and StarCoder's
+var infillTokens = []string{"▁<PRE>", "<PRE>", "<fim_prefix>", "<|fim_prefix|>"}
+
+// SupportsInfill reports whether the model at path can fill in the middle, which models trained for it have
+// special tokens in their vocabulary for. Mock models can if they are infill mocks.
+func SupportsInfill(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if mode := MockMode(f); mode != "" {
+		return mode == "infill", nil
+	}
+
+	ggml, err := DecodeGGML(f)
+	if err != nil {
+		return false, err
+	}
+
+	m, ok := ggml.model.(*ggufModel)
+	if !ok {
+		return false, nil
+	}
+
+	tokens, _ := m.kv["tokenizer.ggml.tokens"].([]any)
+	for _, token := range tokens {
+		if s, ok := token.(string); ok && slices.Contains(infillTokens, s) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// kvInt is the integer value of key, or def if it isn't set
+func kvInt(kv kv, key string, def int) int {
+	if v, ok := kv[key]; ok {
+		return anyInt(v, def)
+	}
+
+	return def
+}
+
+func anyInt(v any, def int) int {
+	switch v := v.(type) {
+	case uint8:
+		return int(v)
+	case int8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case int16:
+		return int(v)
+	case uint32:
+		return int(v)
+	case int32:
+		return int(v)
+	case uint64:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return def
+	}
+}
@@ -0,0 +1,268 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// whisperAudioCtx is the audio context size shared by every whisper model, it is used to tell
+// whisper models apart from other unversioned ggml files
+const whisperAudioCtx = 1500
+
+type whisperModel struct {
+	hyperparameters whisperHyperparameters
+}
+
+type whisperHyperparameters struct {
+	NumVocab      uint32
+	NumAudioCtx   uint32
+	NumAudioState uint32
+	NumAudioHead  uint32
+	NumAudioLayer uint32
+	NumTextCtx    uint32
+	NumTextState  uint32
+	NumTextHead   uint32
+	NumTextLayer  uint32
+	NumMels       uint32
+	FileType      uint32
+}
+
+func (w *whisperModel) ModelFamily() string {
+	return "whisper"
+}
+
+func (w *whisperModel) ModelType() string {
+	switch w.hyperparameters.NumAudioLayer {
+	case 4:
+		return "tiny"
+	case 6:
+		return "base"
+	case 12:
+		return "small"
+	case 24:
+		return "medium"
+	case 32:
+		return "large"
+	default:
+		return "unknown"
+	}
+}
+
+func (w *whisperModel) FileType() string {
+	// whisper encodes the quantization version along with the file type
+	return fileType(w.hyperparameters.FileType % 1000)
+}
+
+func (w *whisperModel) NumLayers() int64 {
+	return int64(w.hyperparameters.NumAudioLayer + w.hyperparameters.NumTextLayer)
+}
+
+type TranscribeOpts struct {
+	Filename    string
+	Language    string
+	Prompt      string
+	Temperature float32
+}
+
+type TranscribeResult struct {
+	Text string `json:"text"`
+}
+
+type Transcriber interface {
+	Transcribe(context.Context, io.Reader, TranscribeOpts) (*TranscribeResult, error)
+	Close()
+	Ping(context.Context) error
+}
+
+var errWhisperRunner = errors.New("whisper runner not found, install the whisper.cpp server and set OLLAMA_WHISPER_RUNNER to its path")
+
+// whisperRunnerPath returns the path of the whisper.cpp server, the runner is not embedded so it
+// is read from OLLAMA_WHISPER_RUNNER or looked up on the PATH
+func whisperRunnerPath() (string, error) {
+	if p := os.Getenv("OLLAMA_WHISPER_RUNNER"); p != "" {
+		if _, err := os.Stat(p); err != nil {
+			return "", fmt.Errorf("%w: %v", errWhisperRunner, err)
+		}
+
+		return p, nil
+	}
+
+	p, err := exec.LookPath("whisper-server")
+	if err != nil {
+		return "", errWhisperRunner
+	}
+
+	return p, nil
+}
+
+type whisper struct {
+	Running
+}
+
+func NewTranscriber(model string) (Transcriber, error) {
+	if _, err := os.Stat(model); err != nil {
+		return nil, err
+	}
+
+	runner, err := whisperRunnerPath()
+	if err != nil {
+		return nil, err
+	}
+
+	port := rand.Intn(65535-49152) + 49152 // get a random port in the ephemeral range
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, runner, "--model", model, "--host", "127.0.0.1", "--port", strconv.Itoa(port))
+	cmd.Stdout = os.Stderr
+	statusWriter := NewStatusWriter()
+	cmd.Stderr = statusWriter
+
+	w := &whisper{Running: Running{Port: port, Cmd: cmd, Cancel: cancel, exitCh: make(chan error), StatusWriter: statusWriter}}
+
+	log.Print("starting whisper runner")
+	if err := w.Cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("error starting the whisper runner: %v", err)
+	}
+
+	go func() {
+		if err := w.Cmd.Wait(); err != nil {
+			log.Println(err)
+		}
+
+		w.exitOnce.Do(func() {
+			close(w.exitCh)
+		})
+	}()
+
+	expiresAt := time.Now().Add(time.Minute)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.exitCh:
+			if statusWriter.LastErrMsg != "" {
+				return nil, fmt.Errorf("whisper runner: %s", statusWriter.LastErrMsg)
+			}
+			return nil, fmt.Errorf("whisper runner process has terminated")
+		case <-ticker.C:
+			if time.Now().After(expiresAt) {
+				w.Close()
+				return nil, fmt.Errorf("timed out waiting for whisper runner to start")
+			}
+
+			if err := w.Ping(context.Background()); err == nil {
+				return w, nil
+			}
+		}
+	}
+}
+
+func (w *whisper) Transcribe(ctx context.Context, audio io.Reader, opts TranscribeOpts) (*TranscribeResult, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	filename := opts.Filename
+	if filename == "" {
+		filename = "audio.wav"
+	}
+
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(part, audio); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{
+		"response_format": "json",
+		"temperature":     strconv.FormatFloat(float64(opts.Temperature), 'f', -1, 32),
+	}
+
+	if opts.Language != "" {
+		fields["language"] = opts.Language
+	}
+
+	if opts.Prompt != "" {
+		fields["prompt"] = opts.Prompt
+	}
+
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/inference", w.Port)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return nil, fmt.Errorf("transcribe request: %w", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("POST transcribe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read transcribe response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		log.Printf("whisper transcribe error: %s", bts)
+		return nil, fmt.Errorf("%s", bts)
+	}
+
+	var result TranscribeResult
+	if err := json.Unmarshal(bts, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal transcribe response: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (w *whisper) Close() {
+	w.Cancel()
+	<-w.exitCh
+	log.Print("whisper runner stopped")
+}
+
+func (w *whisper) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d", w.Port), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ping resp: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected ping status: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ggmlHeader is an unversioned ggml file with only its hyperparameters
+func ggmlHeader(t *testing.T, hp whisperHyperparameters) *bytes.Reader {
+	t.Helper()
+
+	var b bytes.Buffer
+	require.NoError(t, binary.Write(&b, binary.LittleEndian, uint32(FILE_MAGIC_GGML)))
+	require.NoError(t, binary.Write(&b, binary.LittleEndian, hp))
+	return bytes.NewReader(b.Bytes())
+}
+
+func TestDecodeWhisper(t *testing.T) {
+	// whisper tiny, quantized to f16
+	ggml, err := DecodeGGML(ggmlHeader(t, whisperHyperparameters{
+		NumVocab:      51864,
+		NumAudioCtx:   whisperAudioCtx,
+		NumAudioState: 384,
+		NumAudioHead:  6,
+		NumAudioLayer: 4,
+		NumTextCtx:    448,
+		NumTextState:  384,
+		NumTextHead:   6,
+		NumTextLayer:  4,
+		NumMels:       80,
+		FileType:      1001,
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, "whisper", ggml.ModelFamily())
+	assert.Equal(t, "tiny", ggml.ModelType())
+	assert.Equal(t, "F16", ggml.FileType())
+	assert.Equal(t, int64(8), ggml.NumLayers())
+
+	// other unversioned files aren't decoded
+	ggml, err = DecodeGGML(ggmlHeader(t, whisperHyperparameters{NumVocab: 32000, NumAudioCtx: 4096}))
+	require.NoError(t, err)
+	assert.Nil(t, ggml.model)
+
+	// a truncated file is an error rather than hyperparameters of zero
+	header := ggmlHeader(t, whisperHyperparameters{NumVocab: 51864, NumAudioCtx: whisperAudioCtx})
+	truncated := make([]byte, 12)
+	_, err = io.ReadFull(header, truncated)
+	require.NoError(t, err)
+
+	_, err = DecodeGGML(bytes.NewReader(truncated))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
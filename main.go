@@ -2,11 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 
 	"github.com/jmorganca/ollama/cmd"
-	"github.com/spf13/cobra"
+	"github.com/jmorganca/ollama/style"
 )
 
 func main() {
-	cobra.CheckErr(cmd.NewCLI().ExecuteContext(context.Background()))
+	if err := cmd.NewCLI().ExecuteContext(context.Background()); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, style.Stderr.Render(style.Error, "Error:"), err)
+		}
+
+		os.Exit(cmd.ExitCode(err))
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strconv"
 )
 
 type Command struct {
@@ -40,7 +41,7 @@ func Parse(reader io.Reader) ([]Command, error) {
 			command.Args = string(bytes.TrimSpace(fields[1]))
 			// copy command for validation
 			modelCommand = command
-		case "ADAPTER":
+		case "ADAPTER", "ENGINE":
 			command.Name = string(bytes.ToLower(fields[0]))
 			command.Args = string(bytes.TrimSpace(fields[1]))
 		case "LICENSE", "TEMPLATE", "SYSTEM", "PROMPT":
@@ -54,6 +55,24 @@ func Parse(reader io.Reader) ([]Command, error) {
 
 			command.Name = string(fields[0])
 			command.Args = string(bytes.TrimSpace(fields[1]))
+		case "LABEL":
+			key, value, ok := bytes.Cut(bytes.TrimSpace(fields[1]), []byte("="))
+			if !ok || len(bytes.TrimSpace(key)) == 0 {
+				return nil, fmt.Errorf("invalid label %q, expected LABEL key=value", fields[1])
+			}
+
+			value = bytes.TrimSpace(value)
+			if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+				s, err := strconv.Unquote(string(value))
+				if err != nil {
+					return nil, fmt.Errorf("invalid label %q: %w", fields[1], err)
+				}
+
+				value = []byte(s)
+			}
+
+			command.Name = "label"
+			command.Args = string(bytes.TrimSpace(key)) + "=" + string(value)
 		case "EMBED":
 			return nil, fmt.Errorf("deprecated command: EMBED is no longer supported, use the /embed API endpoint instead")
 		default:
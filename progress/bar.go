@@ -2,12 +2,24 @@ package progress
 
 import (
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/jmorganca/ollama/format"
-	"golang.org/x/term"
+	"github.com/jmorganca/ollama/style"
+)
+
+const (
+	// smoothing is the weight of the latest rate in the smoothed rate, lower values steady the ETA at the cost
+	// of following changes in speed more slowly
+	smoothing = 0.3
+
+	// stallTimeout is how long a bar goes without progress before it is shown as stalled. The server retries
+	// downloads which receive nothing for as long.
+	stallTimeout = 10 * time.Second
+
+	// minBarWidth is the narrowest the bar itself is drawn, other columns are left out to make room for it
+	minBarWidth = 10
 )
 
 type Bar struct {
@@ -21,8 +33,12 @@ type Bar struct {
 	started time.Time
 	stopped time.Time
 
-	maxBuckets int
-	buckets    []bucket
+	// progressed is when the value last went up
+	progressed time.Time
+
+	// sample is the value when the smoothed rate was last updated
+	sample   bucket
+	smoothed float64
 }
 
 type bucket struct {
@@ -38,9 +54,11 @@ func NewBar(message string, maxValue, initialValue int64) *Bar {
 		initialValue: initialValue,
 		currentValue: initialValue,
 		started:      time.Now(),
-		maxBuckets:   10,
 	}
 
+	b.progressed = b.started
+	b.sample = bucket{updated: b.started, value: initialValue}
+
 	if initialValue >= maxValue {
 		b.stopped = time.Now()
 	}
@@ -61,78 +79,51 @@ func formatDuration(d time.Duration) string {
 }
 
 func (b *Bar) String() string {
-	termWidth, _, err := term.GetSize(int(os.Stderr.Fd()))
-	if err != nil {
-		termWidth = 80
-	}
+	termWidth := termWidth()
 
-	var pre strings.Builder
+	var message string
 	if len(b.message) > 0 {
-		message := strings.TrimSpace(b.message)
+		message = strings.TrimSpace(b.message)
 		if b.messageWidth > 0 && len(message) > b.messageWidth {
 			message = message[:b.messageWidth]
 		}
 
-		fmt.Fprintf(&pre, "%s", message)
-		if padding := b.messageWidth - pre.Len(); padding > 0 {
-			pre.WriteString(repeat(" ", padding))
-		}
-
-		pre.WriteString(" ")
+		message += repeat(" ", b.messageWidth-len(message)) + " "
 	}
 
-	fmt.Fprintf(&pre, "%3.0f%%", b.percent())
-
-	var suf strings.Builder
-	// max 13 characters: "999 MB/999 MB"
-	if b.stopped.IsZero() {
-		curValue := format.HumanBytes(b.currentValue)
-		suf.WriteString(repeat(" ", 6-len(curValue)))
-		suf.WriteString(curValue)
-		suf.WriteString("/")
+	percent := fmt.Sprintf("%3.0f%%", b.percent())
+	sizes := b.sizes()
+	stats := b.stats()
 
-		maxValue := format.HumanBytes(b.maxValue)
-		suf.WriteString(repeat(" ", 6-len(maxValue)))
-		suf.WriteString(maxValue)
-	} else {
-		maxValue := format.HumanBytes(b.maxValue)
-		suf.WriteString(repeat(" ", 6-len(maxValue)))
-		suf.WriteString(maxValue)
-		suf.WriteString(repeat(" ", 7))
+	// on narrow terminals the rate and time remaining are left out, then the message is shortened, so the bar
+	// stays on one line. 5 extra characters are 2 boundary characters and 1 space at each end.
+	if len(message)+len(percent)+len(sizes)+len(stats)+5+minBarWidth > termWidth {
+		stats = ""
 	}
 
-	rate := b.rate()
-	// max 10 characters: "  999 MB/s"
-	if b.stopped.IsZero() && rate > 0 {
-		suf.WriteString("  ")
-		humanRate := format.HumanBytes(int64(rate))
-		suf.WriteString(repeat(" ", 6-len(humanRate)))
-		suf.WriteString(humanRate)
-		suf.WriteString("/s")
-	} else {
-		suf.WriteString(repeat(" ", 10))
+	if over := len(message) + len(percent) + len(sizes) + 5 + minBarWidth - termWidth; stats == "" && over > 0 {
+		message = strings.TrimSpace(message)
+		if n := len(message) - over; n > 0 {
+			message = message[:n] + " "
+		} else {
+			message = ""
+		}
 	}
 
-	// max 8 characters: "  59m59s"
-	if b.stopped.IsZero() && rate > 0 {
-		suf.WriteString("  ")
-		var remaining time.Duration
-		if rate > 0 {
-			remaining = time.Duration(int64(float64(b.maxValue-b.currentValue)/rate)) * time.Second
-		}
+	f := termWidth - len(message) - len(percent) - len(sizes) - len(stats) - 5
 
-		humanRemaining := formatDuration(remaining)
-		suf.WriteString(repeat(" ", 6-len(humanRemaining)))
-		suf.WriteString(humanRemaining)
-	} else {
-		suf.WriteString(repeat(" ", 8))
+	// styled once the widths are known, escape sequences take no room
+	if b.stalled() {
+		stats = style.Stderr.Render(style.Warning, stats)
+	}
+
+	if f < 0 {
+		return message + percent + " " + sizes + stats
 	}
 
-	var mid strings.Builder
-	// add 5 extra spaces: 2 boundary characters and 1 space at each end
-	f := termWidth - pre.Len() - suf.Len() - 5
 	n := int(float64(f) * b.percent() / 100)
 
+	var mid strings.Builder
 	mid.WriteString(" ▕")
 
 	if n > 0 {
@@ -145,7 +136,66 @@ func (b *Bar) String() string {
 
 	mid.WriteString("▏ ")
 
-	return pre.String() + mid.String() + suf.String()
+	return message + percent + mid.String() + sizes + stats
+}
+
+// sizes is the value and the maximum, max 13 characters: "999 MB/999 MB"
+func (b *Bar) sizes() string {
+	var sb strings.Builder
+	if b.stopped.IsZero() {
+		curValue := format.HumanBytes(b.currentValue)
+		sb.WriteString(repeat(" ", 6-len(curValue)))
+		sb.WriteString(curValue)
+		sb.WriteString("/")
+
+		maxValue := format.HumanBytes(b.maxValue)
+		sb.WriteString(repeat(" ", 6-len(maxValue)))
+		sb.WriteString(maxValue)
+	} else {
+		maxValue := format.HumanBytes(b.maxValue)
+		sb.WriteString(repeat(" ", 6-len(maxValue)))
+		sb.WriteString(maxValue)
+		sb.WriteString(repeat(" ", 7))
+	}
+
+	return sb.String()
+}
+
+// stats is the rate and the time remaining, max 18 characters: "  999 MB/s  59m59s" or " stalled, retrying"
+func (b *Bar) stats() string {
+	if b.stalled() {
+		return " stalled, retrying"
+	}
+
+	rate := b.rate()
+	if !b.stopped.IsZero() || rate <= 0 {
+		return repeat(" ", 18)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("  ")
+	humanRate := format.HumanBytes(int64(rate))
+	sb.WriteString(repeat(" ", 6-len(humanRate)))
+	sb.WriteString(humanRate)
+	sb.WriteString("/s")
+
+	sb.WriteString("  ")
+	remaining := time.Duration(int64(float64(b.maxValue-b.currentValue)/rate)) * time.Second
+	humanRemaining := formatDuration(remaining)
+	sb.WriteString(repeat(" ", 6-len(humanRemaining)))
+	sb.WriteString(humanRemaining)
+
+	return sb.String()
+}
+
+// Plain is the message and the percentage done in steps of 10%, so the bar is logged at most 11 times
+func (b *Bar) Plain() string {
+	line := fmt.Sprintf("%s %d%% of %s", strings.TrimSpace(b.message), int(b.percent())/10*10, format.HumanBytes(b.maxValue))
+	if b.stalled() {
+		line += ", stalled, retrying"
+	}
+
+	return strings.TrimSpace(line)
 }
 
 func (b *Bar) Set(value int64) {
@@ -153,24 +203,34 @@ func (b *Bar) Set(value int64) {
 		value = b.maxValue
 	}
 
+	now := time.Now()
+	if value > b.currentValue {
+		b.progressed = now
+	}
+
 	b.currentValue = value
 	if b.currentValue >= b.maxValue {
-		b.stopped = time.Now()
+		b.stopped = now
 	}
 
-	// throttle bucket updates to 1 per second
-	if len(b.buckets) == 0 || time.Since(b.buckets[len(b.buckets)-1].updated) > time.Second {
-		b.buckets = append(b.buckets, bucket{
-			updated: time.Now(),
-			value:   value,
-		})
-
-		if len(b.buckets) > b.maxBuckets {
-			b.buckets = b.buckets[1:]
+	// throttle rate updates to 1 per second, each moves the smoothed rate towards the rate since the last
+	if elapsed := now.Sub(b.sample.updated); elapsed > time.Second {
+		rate := float64(value-b.sample.value) / elapsed.Seconds()
+		if b.smoothed == 0 {
+			b.smoothed = rate
+		} else {
+			b.smoothed = smoothing*rate + (1-smoothing)*b.smoothed
 		}
+
+		b.sample = bucket{updated: now, value: value}
 	}
 }
 
+// stalled reports whether the bar hasn't progressed for stallTimeout
+func (b *Bar) stalled() bool {
+	return b.stopped.IsZero() && time.Since(b.progressed) > stallTimeout
+}
+
 func (b *Bar) percent() float64 {
 	if b.maxValue > 0 {
 		return float64(b.currentValue) / float64(b.maxValue) * 100
@@ -179,26 +239,14 @@ func (b *Bar) percent() float64 {
 	return 0
 }
 
+// rate is the average rate of a finished bar, otherwise the smoothed rate
 func (b *Bar) rate() float64 {
-	var numerator, denominator float64
-
-	if !b.stopped.IsZero() {
-		numerator = float64(b.currentValue - b.initialValue)
-		denominator = b.stopped.Sub(b.started).Round(time.Second).Seconds()
-	} else {
-		switch len(b.buckets) {
-		case 0:
-			// noop
-		case 1:
-			numerator = float64(b.buckets[0].value - b.initialValue)
-			denominator = b.buckets[0].updated.Sub(b.started).Round(time.Second).Seconds()
-		default:
-			first, last := b.buckets[0], b.buckets[len(b.buckets)-1]
-			numerator = float64(last.value - first.value)
-			denominator = last.updated.Sub(first.updated).Round(time.Second).Seconds()
-		}
+	if b.stopped.IsZero() {
+		return b.smoothed
 	}
 
+	numerator := float64(b.currentValue - b.initialValue)
+	denominator := b.stopped.Sub(b.started).Round(time.Second).Seconds()
 	if denominator != 0 {
 		return numerator / denominator
 	}
@@ -3,30 +3,59 @@ package progress
 import (
 	"fmt"
 	"io"
+	"os"
 	"sync"
 	"time"
+
+	"golang.org/x/term"
 )
 
 type State interface {
 	String() string
 }
 
+// plain is implemented by states which have a plain text line for output which isn't a terminal, otherwise
+// String is used. The line is written each time it changes, so it should change much less often than String.
+type plain interface {
+	Plain() string
+}
+
 type Progress struct {
 	mu sync.Mutex
 	w  io.Writer
 
 	pos int
 
+	// tty is set when w is a terminal. Otherwise states aren't redrawn, a line is logged each time one changes
+	// so CI logs stay readable.
+	tty    bool
+	logged []string
+
 	ticker *time.Ticker
 	states []State
 }
 
 func NewProgress(w io.Writer) *Progress {
-	p := &Progress{w: w}
+	p := &Progress{w: w, tty: isTerminal(w)}
 	go p.start()
 	return p
 }
 
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// termWidth is the width of the terminal progress is drawn on, 80 if it isn't known. Tests replace it.
+var termWidth = func() int {
+	width, _, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+
+	return width
+}
+
 func (p *Progress) stop() bool {
 	for _, state := range p.states {
 		if spinner, ok := state.(*Spinner); ok {
@@ -46,13 +75,17 @@ func (p *Progress) stop() bool {
 
 func (p *Progress) Stop() bool {
 	stopped := p.stop()
-	if stopped {
+	if stopped && p.tty {
 		fmt.Fprint(p.w, "\n")
 	}
 	return stopped
 }
 
 func (p *Progress) StopAndClear() bool {
+	if !p.tty {
+		return p.stop()
+	}
+
 	fmt.Fprint(p.w, "\033[?25l")
 	defer fmt.Fprint(p.w, "\033[?25h")
 
@@ -81,6 +114,11 @@ func (p *Progress) render() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if !p.tty {
+		p.log()
+		return nil
+	}
+
 	fmt.Fprint(p.w, "\033[?25l")
 	defer fmt.Fprint(p.w, "\033[?25h")
 
@@ -105,6 +143,25 @@ func (p *Progress) render() error {
 	return nil
 }
 
+// log writes the plain line of each state which changed since it was last logged
+func (p *Progress) log() {
+	for i, state := range p.states {
+		line := state.String()
+		if s, ok := state.(plain); ok {
+			line = s.Plain()
+		}
+
+		if i == len(p.logged) {
+			p.logged = append(p.logged, "")
+		}
+
+		if line != "" && line != p.logged[i] {
+			fmt.Fprintln(p.w, line)
+			p.logged[i] = line
+		}
+	}
+}
+
 func (p *Progress) start() {
 	p.ticker = time.NewTicker(100 * time.Millisecond)
 	for range p.ticker.C {
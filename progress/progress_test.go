@@ -0,0 +1,80 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setTermWidth(t *testing.T, width int) {
+	t.Helper()
+
+	saved := termWidth
+	t.Cleanup(func() { termWidth = saved })
+	termWidth = func() int { return width }
+}
+
+func TestProgressLines(t *testing.T) {
+	var b bytes.Buffer
+	p := &Progress{w: &b}
+
+	spinner := NewSpinner("pulling manifest")
+	defer spinner.Stop()
+	bar := NewBar("pulling 8934d96d3f08", 1000, 0)
+	p.Add("", spinner)
+	p.Add("", bar)
+
+	// without a terminal each state is logged as a line when it changes, rather than redrawn
+	p.render()
+	p.render()
+	bar.Set(120)
+	p.render()
+	bar.Set(150)
+	p.render()
+	bar.Set(1000)
+	p.render()
+
+	assert.Equal(t, strings.Join([]string{
+		"pulling manifest",
+		"pulling 8934d96d3f08 0% of 1 KB",
+		"pulling 8934d96d3f08 10% of 1 KB",
+		"pulling 8934d96d3f08 100% of 1 KB",
+	}, "\n")+"\n", b.String())
+	assert.NotContains(t, b.String(), "\033[")
+}
+
+func TestBarWidth(t *testing.T) {
+	for _, width := range []int{120, 80, 60, 40, 30} {
+		setTermWidth(t, width)
+
+		bar := NewBar("pulling 8934d96d3f08", 4_000_000_000, 0)
+		bar.Set(1_000_000_000)
+		line := bar.String()
+
+		// the last column is left free so the cursor doesn't wrap onto the next line
+		assert.Equal(t, width-1, utf8.RuneCountInString(line), line)
+		assert.Contains(t, line, " 25% ▕", width)
+		assert.Contains(t, line, "1 GB/  4 GB", width)
+	}
+
+	// the rate and time remaining go first on narrow terminals, then the message is shortened to keep the bar
+	// at its minimum width
+	setTermWidth(t, 36)
+	line := NewBar("pulling 8934d96d3f08", 4_000_000_000, 0).String()
+	assert.Equal(t, "pul   0% ▕"+strings.Repeat(" ", minBarWidth)+"▏    0 B/  4 GB", line)
+}
+
+func TestSpinnerWidth(t *testing.T) {
+	setTermWidth(t, 20)
+
+	spinner := NewSpinner("verifying sha256 digest of the model")
+	defer spinner.Stop()
+
+	line := spinner.String()
+	assert.True(t, strings.HasPrefix(line, "verifying sha256 "), line)
+	assert.LessOrEqual(t, utf8.RuneCountInString(line), 20, line)
+	assert.Equal(t, "verifying sha256 digest of the model", spinner.Plain())
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/jmorganca/ollama/style"
 )
 
 type Spinner struct {
@@ -39,6 +41,11 @@ func (s *Spinner) String() string {
 			message = message[:s.messageWidth]
 		}
 
+		// leave room for the spinner so the line doesn't wrap on narrow terminals
+		if width := termWidth() - 3; width > 0 && len(message) > width {
+			message = message[:width]
+		}
+
 		fmt.Fprintf(&sb, "%s", message)
 		if padding := s.messageWidth - sb.Len(); padding > 0 {
 			sb.WriteString(strings.Repeat(" ", padding))
@@ -49,13 +56,18 @@ func (s *Spinner) String() string {
 
 	if s.stopped.IsZero() {
 		spinner := s.parts[s.value]
-		sb.WriteString(spinner)
+		sb.WriteString(style.Stderr.Render(style.Muted, spinner))
 		sb.WriteString(" ")
 	}
 
 	return sb.String()
 }
 
+// Plain is the message without the spinner
+func (s *Spinner) Plain() string {
+	return strings.TrimSpace(s.message)
+}
+
 func (s *Spinner) start() {
 	s.ticker = time.NewTicker(100 * time.Millisecond)
 	for range s.ticker.C {
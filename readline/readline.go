@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"syscall"
 )
 
@@ -20,11 +21,17 @@ type Terminal struct {
 	outchan chan rune
 }
 
+// Completer returns the completions for line, each completion is the whole line with its last word completed
+type Completer func(line string) []string
+
 type Instance struct {
 	Prompt   *Prompt
 	Terminal *Terminal
 	History  *History
 	Pasting  bool
+
+	// Completer is used to complete the line when tab is pressed and to show a hint when there is a single completion
+	Completer Completer
 }
 
 func New(prompt Prompt) (*Instance, error) {
@@ -78,9 +85,14 @@ func (i *Instance) Readline() (string, error) {
 			fmt.Printf(ColorGrey + ph + fmt.Sprintf(CursorLeftN, len(ph)) + ColorDefault)
 		}
 
+		hint := i.hint(buf)
+		if hint != "" {
+			fmt.Printf(ColorGrey + hint + fmt.Sprintf(CursorLeftN, len(hint)) + ColorDefault)
+		}
+
 		r, err := i.Terminal.Read()
 
-		if buf.IsEmpty() {
+		if buf.IsEmpty() || hint != "" {
 			fmt.Print(ClearToEOL)
 		}
 
@@ -173,6 +185,11 @@ func (i *Instance) Readline() (string, error) {
 		case CharBackspace, CharCtrlH:
 			buf.Remove()
 		case CharTab:
+			if i.Completer != nil && !i.Pasting && buf.Pos == buf.Size() {
+				i.complete(buf)
+				continue
+			}
+
 			// todo: convert back to real tabs
 			for cnt := 0; cnt < 8; cnt++ {
 				buf.Add(' ')
@@ -214,6 +231,69 @@ func (i *Instance) Readline() (string, error) {
 	}
 }
 
+// hint returns the rest of the line when there is a single completion for it
+func (i *Instance) hint(buf *Buffer) string {
+	if i.Completer == nil || i.Pasting || buf.IsEmpty() || buf.Pos != buf.Size() {
+		return ""
+	}
+
+	line := buf.String()
+	completions := i.Completer(line)
+	if len(completions) != 1 || !strings.HasPrefix(completions[0], line) {
+		return ""
+	}
+
+	hint := completions[0][len(line):]
+	// only hint when it fits on the current line
+	if buf.PromptSize()+buf.Size()+len(hint) >= buf.Width {
+		return ""
+	}
+
+	return hint
+}
+
+// complete extends the line to the longest prefix shared by its completions, listing the
+// completions if the line can't be extended
+func (i *Instance) complete(buf *Buffer) {
+	line := buf.String()
+	completions := i.Completer(line)
+	if len(completions) == 0 {
+		return
+	}
+
+	prefix := completions[0]
+	for _, c := range completions[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if len(completions) == 1 {
+		prefix += " "
+	}
+
+	if len(prefix) > len(line) && strings.HasPrefix(prefix, line) {
+		for _, r := range prefix[len(line):] {
+			buf.Add(r)
+		}
+		return
+	}
+
+	if len(completions) > 1 {
+		words := make([]string, len(completions))
+		for n, c := range completions {
+			words[n] = c[strings.LastIndex(strings.TrimSuffix(c, " "), " ")+1:]
+		}
+
+		fmt.Printf("\n%s\n", strings.Join(words, "  "))
+		prompt := i.Prompt.Prompt
+		if i.Prompt.UseAlt {
+			prompt = i.Prompt.AltPrompt
+		}
+		fmt.Print(prompt + line)
+	}
+}
+
 func (i *Instance) HistoryEnable() {
 	i.History.Enabled = true
 }
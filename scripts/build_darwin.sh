@@ -3,7 +3,10 @@
 set -eu
 
 export VERSION=${VERSION:-0.0.0}
-export GOFLAGS="'-ldflags=-w -s \"-X=github.com/jmorganca/ollama/version.Version=$VERSION\" \"-X=github.com/jmorganca/ollama/server.mode=release\"'"
+COMMIT=$(git rev-parse HEAD 2>/dev/null || true)
+BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+LLAMA_CPP_COMMIT=$(git rev-parse --verify -q HEAD:llm/llama.cpp/gguf || true)
+export GOFLAGS="'-ldflags=-w -s \"-X=github.com/jmorganca/ollama/version.Version=$VERSION\" \"-X=github.com/jmorganca/ollama/version.Commit=$COMMIT\" \"-X=github.com/jmorganca/ollama/version.BuildDate=$BUILD_DATE\" \"-X=github.com/jmorganca/ollama/version.LlamaCppCommit=$LLAMA_CPP_COMMIT\" \"-X=github.com/jmorganca/ollama/server.mode=release\"'"
 
 mkdir -p dist
 
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	accessLogCommon = "common"
+	accessLogJSON   = "json"
+
+	// accessLogPromptLength is how many characters of a prompt are logged when prompts are logged
+	accessLogPromptLength = 200
+
+	accessLogModelKey  = "accessLog.model"
+	accessLogPromptKey = "accessLog.prompt"
+	accessLogTokensKey = "accessLog.tokens"
+)
+
+// accessLog writes a line for every request in place of gin's log. Prompts are left out unless prompts is set.
+type accessLog struct {
+	format  string
+	prompts bool
+	w       io.Writer
+}
+
+// loadAccessLog reads $OLLAMA_ACCESS_LOG, "common" or "json", and $OLLAMA_ACCESS_LOG_PROMPTS, which opts in
+// to logging the start of each prompt. It returns nil if the access log isn't enabled.
+func loadAccessLog() (*accessLog, error) {
+	format := os.Getenv("OLLAMA_ACCESS_LOG")
+	switch format {
+	case "":
+		return nil, nil
+	case accessLogCommon, accessLogJSON:
+	default:
+		return nil, fmt.Errorf("OLLAMA_ACCESS_LOG: unknown format '%s', expected %q or %q", format, accessLogCommon, accessLogJSON)
+	}
+
+	var prompts bool
+	if s := os.Getenv("OLLAMA_ACCESS_LOG_PROMPTS"); s != "" {
+		var err error
+		if prompts, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("OLLAMA_ACCESS_LOG_PROMPTS: %w", err)
+		}
+	}
+
+	return &accessLog{format: format, prompts: prompts, w: gin.DefaultWriter}, nil
+}
+
+type accessLogEntry struct {
+	Time     time.Time `json:"time"`
+	ClientIP string    `json:"client_ip"`
+	Method   string    `json:"method"`
+	Route    string    `json:"route"`
+	Path     string    `json:"path"`
+	Proto    string    `json:"proto"`
+	Status   int       `json:"status"`
+	Size     int       `json:"size"`
+	Duration float64   `json:"duration_ms"`
+
+	Model        string `json:"model,omitempty"`
+	PromptTokens int    `json:"prompt_tokens,omitempty"`
+	EvalTokens   int    `json:"eval_tokens,omitempty"`
+	Prompt       string `json:"prompt,omitempty"`
+}
+
+func (a *accessLog) Handler(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	entry := accessLogEntry{
+		Time:     start,
+		ClientIP: c.ClientIP(),
+		Method:   c.Request.Method,
+		Route:    c.FullPath(),
+		Path:     c.Request.URL.RequestURI(),
+		Proto:    c.Request.Proto,
+		Status:   c.Writer.Status(),
+		Size:     c.Writer.Size(),
+		Duration: float64(time.Since(start).Microseconds()) / 1000,
+		Model:    c.GetString(accessLogModelKey),
+	}
+
+	if entry.Size < 0 {
+		entry.Size = 0
+	}
+
+	if tokens, ok := c.Get(accessLogTokensKey); ok {
+		counts := tokens.([2]int)
+		entry.PromptTokens, entry.EvalTokens = counts[0], counts[1]
+	}
+
+	if a.prompts {
+		entry.Prompt = truncatePrompt(c.GetString(accessLogPromptKey), accessLogPromptLength)
+	}
+
+	if _, err := io.WriteString(a.w, a.line(entry)); err != nil {
+		log.Printf("access log: %v", err)
+	}
+}
+
+// line formats an entry as a line of the access log
+func (a *accessLog) line(entry accessLogEntry) string {
+	if a.format == accessLogJSON {
+		bts, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Sprintf("{\"error\":%q}\n", err.Error())
+		}
+
+		return string(bts) + "\n"
+	}
+
+	// the common log format with the model, token counts, duration and prompt after it
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s - - [%s] \"%s %s %s\" %d %d",
+		entry.ClientIP, entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method, entry.Path, entry.Proto, entry.Status, entry.Size)
+
+	if entry.Model != "" {
+		fmt.Fprintf(&sb, " model=%s", entry.Model)
+	}
+
+	if entry.PromptTokens > 0 || entry.EvalTokens > 0 {
+		fmt.Fprintf(&sb, " prompt_tokens=%d eval_tokens=%d", entry.PromptTokens, entry.EvalTokens)
+	}
+
+	fmt.Fprintf(&sb, " duration=%.3fms", entry.Duration)
+
+	if entry.Prompt != "" {
+		fmt.Fprintf(&sb, " prompt=%q", entry.Prompt)
+	}
+
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// truncatePrompt keeps the first n characters of a prompt
+func truncatePrompt(prompt string, n int) string {
+	runes := []rune(prompt)
+	if len(runes) <= n {
+		return prompt
+	}
+
+	return string(runes[:n]) + "..."
+}
+
+// logRequestModel records the model and prompt of a request for the access log
+func logRequestModel(c *gin.Context, model, prompt string) {
+	c.Set(accessLogModelKey, model)
+	c.Set(accessLogPromptKey, prompt)
+}
+
+// logRequestTokens records how many tokens a request evaluated for the access log
+func logRequestTokens(c *gin.Context, promptTokens, evalTokens int) {
+	c.Set(accessLogTokensKey, [2]int{promptTokens, evalTokens})
+}
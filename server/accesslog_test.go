@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAccessLog(t *testing.T) {
+	t.Setenv("OLLAMA_ACCESS_LOG", "")
+	a, err := loadAccessLog()
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	t.Setenv("OLLAMA_ACCESS_LOG", "json")
+	t.Setenv("OLLAMA_ACCESS_LOG_PROMPTS", "")
+	a, err = loadAccessLog()
+	require.NoError(t, err)
+	assert.Equal(t, accessLogJSON, a.format)
+	assert.False(t, a.prompts)
+
+	t.Setenv("OLLAMA_ACCESS_LOG_PROMPTS", "true")
+	a, err = loadAccessLog()
+	require.NoError(t, err)
+	assert.True(t, a.prompts)
+
+	t.Setenv("OLLAMA_ACCESS_LOG", "apache")
+	_, err = loadAccessLog()
+	assert.Error(t, err)
+}
+
+func accessLogRequest(t *testing.T, a *accessLog) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	a.w = &buf
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(a.Handler)
+	r.POST("/api/generate", func(c *gin.Context) {
+		logRequestModel(c, "llama2", "why is the sky blue? "+strings.Repeat("x", 300))
+		logRequestTokens(c, 12, 34)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/generate", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	line := accessLogRequest(t, &accessLog{format: accessLogJSON})
+
+	var entry accessLogEntry
+	require.NoError(t, json.Unmarshal([]byte(line), &entry))
+	assert.Equal(t, http.MethodPost, entry.Method)
+	assert.Equal(t, "/api/generate", entry.Route)
+	assert.Equal(t, http.StatusOK, entry.Status)
+	assert.Equal(t, "llama2", entry.Model)
+	assert.Equal(t, 12, entry.PromptTokens)
+	assert.Equal(t, 34, entry.EvalTokens)
+
+	// prompts are left out unless they are opted in to
+	assert.Empty(t, entry.Prompt)
+	assert.NotContains(t, line, "sky")
+}
+
+func TestAccessLogCommon(t *testing.T) {
+	line := accessLogRequest(t, &accessLog{format: accessLogCommon, prompts: true})
+
+	assert.Contains(t, line, `"POST /api/generate HTTP/1.1" 200`)
+	assert.Contains(t, line, "model=llama2 prompt_tokens=12 eval_tokens=34")
+	assert.Contains(t, line, `prompt="why is the sky blue? xxx`)
+
+	// the prompt is truncated
+	assert.NotContains(t, line, strings.Repeat("x", 300))
+	assert.Contains(t, line, `..."`)
+}
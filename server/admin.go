@@ -0,0 +1,144 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// listenAdmin binds the admin listeners in $OLLAMA_ADMIN_HOST, in the format of OLLAMA_HOST, and returns
+// none if it isn't set. Requests to them need $OLLAMA_ADMIN_TOKEN as a bearer token, which is required for
+// addresses other machines can reach.
+func listenAdmin() ([]net.Listener, string, error) {
+	hosts := os.Getenv("OLLAMA_ADMIN_HOST")
+	if hosts == "" {
+		return nil, "", nil
+	}
+
+	token := os.Getenv("OLLAMA_ADMIN_TOKEN")
+	if token == "" {
+		addrs, err := api.ParseHosts(hosts)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, addr := range addrs {
+			if addr.Scheme == "unix" {
+				continue
+			}
+
+			if ip := net.ParseIP(addr.Host); addr.Host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+				return nil, "", fmt.Errorf("OLLAMA_ADMIN_HOST: %s can be reached from other machines, set OLLAMA_ADMIN_TOKEN", addr.Address())
+			}
+		}
+	}
+
+	lns, err := Listen(hosts)
+	if err != nil {
+		return nil, "", fmt.Errorf("OLLAMA_ADMIN_HOST: %w", err)
+	}
+
+	return lns, token, nil
+}
+
+// adminHandler serves net/http/pprof under /debug/pprof/, a dump of every goroutine at /debug/goroutines and
+// garbage collector stats at /debug/gc
+func adminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		buf := make([]byte, 1<<20)
+		for {
+			n := runtime.Stack(buf, true)
+			if n < len(buf) {
+				w.Write(buf[:n])
+				return
+			}
+
+			buf = make([]byte, 2*len(buf))
+		}
+	})
+	mux.HandleFunc("/debug/gc", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(readGCStats())
+	})
+
+	if token == "" {
+		return mux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+type gcStats struct {
+	NumGC        uint32    `json:"num_gc"`
+	LastGC       time.Time `json:"last_gc,omitempty"`
+	PauseTotalNs uint64    `json:"pause_total_ns"`
+	// PausesNs are the most recent pauses, latest first
+	PausesNs []uint64 `json:"pauses_ns"`
+
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapSys      uint64 `json:"heap_sys"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	NextGC       uint64 `json:"next_gc"`
+	Sys          uint64 `json:"sys"`
+	NumGoroutine int    `json:"num_goroutine"`
+
+	// MemoryLimit is the soft memory limit set with GOMEMLIMIT
+	MemoryLimit int64 `json:"memory_limit"`
+}
+
+func readGCStats() gcStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	stats := gcStats{
+		NumGC:        m.NumGC,
+		PauseTotalNs: m.PauseTotalNs,
+		PausesNs:     []uint64{},
+		HeapAlloc:    m.HeapAlloc,
+		HeapSys:      m.HeapSys,
+		HeapObjects:  m.HeapObjects,
+		NextGC:       m.NextGC,
+		Sys:          m.Sys,
+		NumGoroutine: runtime.NumGoroutine(),
+	}
+
+	if m.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(m.LastGC)).UTC()
+	}
+
+	// PauseNs is a circular buffer with the latest pause at (NumGC+255)%256
+	for i := uint32(0); i < m.NumGC && i < 16; i++ {
+		stats.PausesNs = append(stats.PausesNs, m.PauseNs[(m.NumGC-1-i)%uint32(len(m.PauseNs))])
+	}
+
+	// a negative limit reads the current one without changing it
+	stats.MemoryLimit = debug.SetMemoryLimit(-1)
+
+	return stats
+}
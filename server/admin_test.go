@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenAdmin(t *testing.T) {
+	t.Setenv("OLLAMA_ADMIN_HOST", "")
+	lns, _, err := listenAdmin()
+	require.NoError(t, err)
+	assert.Empty(t, lns)
+
+	// addresses other machines can reach need a token
+	t.Setenv("OLLAMA_ADMIN_HOST", "0.0.0.0:0")
+	t.Setenv("OLLAMA_ADMIN_TOKEN", "")
+	_, _, err = listenAdmin()
+	assert.ErrorContains(t, err, "OLLAMA_ADMIN_TOKEN")
+
+	t.Setenv("OLLAMA_ADMIN_HOST", "127.0.0.1:0")
+	lns, token, err := listenAdmin()
+	require.NoError(t, err)
+	assert.Empty(t, token)
+	require.Len(t, lns, 1)
+	lns[0].Close()
+}
+
+func TestAdminHandler(t *testing.T) {
+	h := adminHandler("secret")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/gc", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/gc", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/gc", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats gcStats
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	assert.Greater(t, stats.NumGoroutine, 0)
+	assert.Greater(t, stats.HeapAlloc, uint64(0))
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/goroutines", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine ")
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/llm"
+)
+
+var errNotWhisperModel = errors.New("not a whisper model")
+
+var loadedAudio struct {
+	mu sync.Mutex
+
+	transcriber llm.Transcriber
+	modelPath   string
+
+	expireTimer *time.Timer
+}
+
+// loadTranscriber starts a whisper runner for the model if it is not already running, it is up to the
+// caller to lock loadedAudio.mu before calling this function
+func loadTranscriber(c *gin.Context, modelName string, sessionDuration time.Duration) error {
+	model, err := GetModel(modelName)
+	if err != nil {
+		return err
+	}
+
+	if model.Config.ModelFamily != "whisper" {
+		return fmt.Errorf("model '%s' is %w", modelName, errNotWhisperModel)
+	}
+
+	if loadedAudio.transcriber != nil {
+		if err := loadedAudio.transcriber.Ping(c.Request.Context()); err != nil || loadedAudio.modelPath != model.ModelPath {
+			loadedAudio.transcriber.Close()
+			loadedAudio.transcriber = nil
+		}
+	}
+
+	if loadedAudio.transcriber == nil {
+		transcriber, err := llm.NewTranscriber(model.ModelPath)
+		if err != nil {
+			return err
+		}
+
+		loadedAudio.transcriber = transcriber
+		loadedAudio.modelPath = model.ModelPath
+	}
+
+	if loadedAudio.expireTimer == nil {
+		loadedAudio.expireTimer = time.AfterFunc(sessionDuration, func() {
+			loadedAudio.mu.Lock()
+			defer loadedAudio.mu.Unlock()
+
+			if loadedAudio.transcriber != nil {
+				loadedAudio.transcriber.Close()
+			}
+
+			loadedAudio.transcriber = nil
+			loadedAudio.modelPath = ""
+		})
+	}
+
+	loadedAudio.expireTimer.Reset(sessionDuration)
+	return nil
+}
+
+// TranscriptionHandler implements the OpenAI compatible /v1/audio/transcriptions endpoint
+func TranscriptionHandler(c *gin.Context) {
+	loadedAudio.mu.Lock()
+	defer loadedAudio.mu.Unlock()
+
+	model := c.PostForm("model")
+	if model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	opts := llm.TranscribeOpts{
+		Filename: fh.Filename,
+		Language: c.PostForm("language"),
+		Prompt:   c.PostForm("prompt"),
+	}
+
+	if t := c.PostForm("temperature"); t != "" {
+		temperature, err := strconv.ParseFloat(t, 32)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "temperature must be a number"})
+			return
+		}
+
+		opts.Temperature = float32(temperature)
+	}
+
+	responseFormat := c.DefaultPostForm("response_format", "json")
+	switch responseFormat {
+	case "json", "text":
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "response_format must be json or text"})
+		return
+	}
+
+	if err := loadTranscriber(c, model, defaultSessionDuration); err != nil {
+		var pErr *fs.PathError
+		switch {
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", model)})
+		case errors.Is(err, errNotWhisperModel):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	result, err := loadedAudio.transcriber.Transcribe(c.Request.Context(), f, opts)
+	if err != nil {
+		log.Printf("transcription failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to transcribe audio"})
+		return
+	}
+
+	if responseFormat == "text" {
+		c.String(http.StatusOK, result.Text)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+// audioForm is a multipart form with the fields and, if it isn't empty, an audio file
+func audioForm(t *testing.T, fields map[string]string, audio string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	for k, v := range fields {
+		require.NoError(t, w.WriteField(k, v))
+	}
+
+	if audio != "" {
+		f, err := w.CreateFormFile("file", "audio.wav")
+		require.NoError(t, err)
+		_, err = f.Write([]byte(audio))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Close())
+	return &b, w.FormDataContentType()
+}
+
+func TestTranscriptionHandler(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_WHISPER_RUNNER", filepath.Join(t.TempDir(), "missing"))
+
+	// an unversioned ggml file with the hyperparameters of whisper tiny
+	weights := filepath.Join(t.TempDir(), "ggml-tiny.bin")
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, []uint32{0x67676d6c, 51864, 1500, 384, 6, 4, 448, 384, 6, 4, 80, 1})
+	require.NoError(t, os.WriteFile(weights, header.Bytes(), 0o644))
+
+	for _, m := range []struct{ name, modelfile string }{
+		{"whisper", "FROM " + weights},
+		{"echo", "FROM mock://echo"},
+	} {
+		commands, err := parser.Parse(strings.NewReader(m.modelfile))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), m.name, "", commands, func(api.ProgressResponse) {}))
+	}
+
+	model, err := GetModel("whisper")
+	require.NoError(t, err)
+	require.Equal(t, "whisper", model.Config.ModelFamily)
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+
+	cases := map[string]struct {
+		fields map[string]string
+		audio  string
+		status int
+		err    string
+	}{
+		"no model":          {map[string]string{}, "RIFF", http.StatusBadRequest, "model is required"},
+		"no file":           {map[string]string{"model": "whisper"}, "", http.StatusBadRequest, "file is required"},
+		"bad temperature":   {map[string]string{"model": "whisper", "temperature": "warm"}, "RIFF", http.StatusBadRequest, "temperature must be a number"},
+		"bad format":        {map[string]string{"model": "whisper", "response_format": "srt"}, "RIFF", http.StatusBadRequest, "response_format must be json or text"},
+		"missing model":     {map[string]string{"model": "missing"}, "RIFF", http.StatusNotFound, "model 'missing' not found"},
+		"unsupported model": {map[string]string{"model": "echo"}, "RIFF", http.StatusBadRequest, "model 'echo' is not a whisper model"},
+		"no runner":         {map[string]string{"model": "whisper"}, "RIFF", http.StatusInternalServerError, "whisper runner not found"},
+	}
+
+	for name, tt := range cases {
+		body, contentType := audioForm(t, tt.fields, tt.audio)
+		resp, err := srv.Client().Post(srv.URL+"/v1/audio/transcriptions", contentType, body)
+		require.NoError(t, err, name)
+		defer resp.Body.Close()
+
+		assert.Equal(t, tt.status, resp.StatusCode, name)
+
+		var e map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&e), name)
+		assert.Contains(t, e["error"], tt.err, name)
+	}
+
+	// requests which aren't forms are refused
+	resp, err := srv.Client().Post(srv.URL+"/v1/audio/transcriptions", "application/json", strings.NewReader(`{"model": "whisper"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
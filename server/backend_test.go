@@ -0,0 +1,212 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+	"github.com/jmorganca/ollama/parser"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary runs as an external runner in tests of external backends
+	if os.Getenv("OLLAMA_TEST_RUNNER") == "1" {
+		fakeRunner()
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// fakeRunner serves the runner API on --port. Tokens are the bytes of the text and the embedding of some text
+// is its length in tokens.
+func fakeRunner() {
+	var port string
+	for i, arg := range os.Args {
+		if arg == "--port" && i+1 < len(os.Args) {
+			port = os.Args[i+1]
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/tokenize", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		tokens := []int{}
+		for _, b := range []byte(req.Content) {
+			tokens = append(tokens, int(b))
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"tokens": tokens})
+	})
+	mux.HandleFunc("/embedding", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content []int `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]any{"embedding": []float64{float64(len(req.Content))}})
+	})
+
+	http.ListenAndServe(net.JoinHostPort("127.0.0.1", port), mux)
+}
+
+const shoutMagic = "shout-model\n"
+
+// shoutBackend loads models which respond with their prompt in capitals
+type shoutBackend struct{}
+
+func (shoutBackend) Name() string {
+	return "shout"
+}
+
+func (shoutBackend) Supports(r io.ReadSeeker) bool {
+	header := make([]byte, len(shoutMagic))
+	_, err := io.ReadFull(r, header)
+	return err == nil && string(header) == shoutMagic
+}
+
+func (shoutBackend) Load(llm.LoadOpts) (llm.LLM, error) {
+	return &shout{}, nil
+}
+
+type shout struct{}
+
+func (*shout) Predict(ctx context.Context, predict llm.PredictOpts, fn func(llm.PredictResult)) error {
+	fn(llm.PredictResult{Content: strings.ToUpper(predict.Prompt)})
+	fn(llm.PredictResult{Done: true, EvalCount: 1, FinishReason: llm.FinishReasonStop})
+	return nil
+}
+
+func (*shout) Embedding(context.Context, llm.EmbeddingOpts) ([]float64, error) {
+	return []float64{1}, nil
+}
+
+func (*shout) Encode(_ context.Context, s string) ([]int, error) {
+	return []int{len(s)}, nil
+}
+
+func (*shout) Decode(context.Context, []int) (string, error) {
+	return "", nil
+}
+
+func (*shout) SetOptions(api.Options) {}
+
+func (*shout) Placement() llm.Placement {
+	return llm.Placement{Runner: "shout"}
+}
+
+func (*shout) Close() {}
+
+func (*shout) Ping(context.Context) error {
+	return nil
+}
+
+func TestRegisteredBackend(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	llm.Register(shoutBackend{})
+	assert.Panics(t, func() { llm.Register(shoutBackend{}) })
+
+	p := filepath.Join(t.TempDir(), "shout.bin")
+	require.NoError(t, os.WriteFile(p, []byte(shoutMagic+"weights"), 0o644))
+
+	commands, err := parser.Parse(strings.NewReader("FROM " + p))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "shout", "", commands, func(api.ProgressResponse) {}))
+
+	model, err := GetModel("shout")
+	require.NoError(t, err)
+	assert.Equal(t, "shout", model.Config.ModelFormat)
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	stream := false
+	bts, err := json.Marshal(api.GenerateRequest{Model: "shout", Prompt: "hello", Stream: &stream})
+	require.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL+"/api/generate", "application/json", bytes.NewReader(bts))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var generate api.GenerateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&generate))
+	assert.Equal(t, "HELLO", generate.Response)
+}
+
+func TestONNXModel(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_ONNX_RUNNER", os.Args[0])
+	t.Setenv("OLLAMA_TEST_RUNNER", "1")
+
+	p := filepath.Join(t.TempDir(), "minilm.tar")
+	f, err := os.Create(p)
+	require.NoError(t, err)
+
+	tw := tar.NewWriter(f)
+	for _, name := range []string{"model.onnx", "tokenizer.json"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: 2}))
+		_, err := tw.Write([]byte("{}"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	commands, err := parser.Parse(strings.NewReader("FROM " + p))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "minilm", "", commands, func(api.ProgressResponse) {}))
+
+	model, err := GetModel("minilm")
+	require.NoError(t, err)
+	assert.Equal(t, "onnx", model.Config.ModelFormat)
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	bts, err := json.Marshal(api.EmbeddingRequest{Model: "minilm", Prompt: "llamas"})
+	require.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL+"/api/embeddings", "application/json", bytes.NewReader(bts))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var embedding api.EmbeddingResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&embedding))
+	assert.Equal(t, []float64{6}, embedding.Embedding)
+}
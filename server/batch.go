@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+// batchChunkSize is how many prompts of a batch are embedded each time it holds the model. Interactive
+// requests wait for at most one chunk.
+const batchChunkSize = 32
+
+// batchScheduler runs embedding batches one at a time, apart from the interactive requests such as chat.
+// Between chunks a batch gives the model to any interactive requests, and it only continues once they
+// have all finished.
+type batchScheduler struct {
+	// running is held by the batch being embedded
+	running sync.Mutex
+
+	mu          sync.Mutex
+	interactive int
+	// idle is closed when there are no interactive requests
+	idle chan struct{}
+}
+
+var batches = newBatchScheduler()
+
+func newBatchScheduler() *batchScheduler {
+	idle := make(chan struct{})
+	close(idle)
+	return &batchScheduler{idle: idle}
+}
+
+// Interactive marks a latency-sensitive request while the rest of its handlers run, so batches wait for it
+func (s *batchScheduler) Interactive(c *gin.Context) {
+	s.begin()
+	defer s.end()
+
+	c.Next()
+}
+
+func (s *batchScheduler) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.interactive == 0 {
+		s.idle = make(chan struct{})
+	}
+
+	s.interactive++
+}
+
+func (s *batchScheduler) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.interactive--
+	if s.interactive == 0 {
+		close(s.idle)
+	}
+}
+
+// wait blocks until there are no interactive requests
+func (s *batchScheduler) wait(ctx context.Context) error {
+	s.mu.Lock()
+	idle := s.idle
+	s.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func BatchEmbeddingHandler(c *gin.Context) {
+	var req api.BatchEmbeddingRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	if len(req.Prompts) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "prompts are required"})
+		return
+	}
+
+	if err := validEmbeddingRequest(api.EmbeddingRequest{Truncate: req.Truncate, Pooling: req.Pooling, Dimensions: req.Dimensions}); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logRequestModel(c, req.Model, req.Prompts[0])
+
+	batches.running.Lock()
+	defer batches.running.Unlock()
+
+	resp := api.BatchEmbeddingResponse{Embeddings: make([][]float64, 0, len(req.Prompts))}
+	for start := 0; start < len(req.Prompts); start += batchChunkSize {
+		if err := batches.wait(c.Request.Context()); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		end := start + batchChunkSize
+		if end > len(req.Prompts) {
+			end = len(req.Prompts)
+		}
+
+		if !embedBatchChunk(c, req, start, req.Prompts[start:end], &resp) {
+			return
+		}
+	}
+
+	logRequestTokens(c, resp.Tokens, 0)
+	c.JSON(http.StatusOK, resp)
+}
+
+// embedBatchChunk embeds prompts, the prompts of the batch from start, holding the model for all of them. It
+// writes the error response and returns false if any of them fails.
+func embedBatchChunk(c *gin.Context, req api.BatchEmbeddingRequest, start int, prompts []string, resp *api.BatchEmbeddingResponse) bool {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	if _, err := load(c, req.Model, req.Options, defaultSessionDuration, nil); err != nil {
+		var pErr *fs.PathError
+		switch {
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		case errors.Is(err, api.ErrInvalidOpts):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return false
+	}
+
+	if !loaded.Options.EmbeddingOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "embedding option must be set to true"})
+		return false
+	}
+
+	for i, prompt := range prompts {
+		tokens, err := loaded.runner.Encode(c.Request.Context(), prompt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+
+		truncated, err := truncateTokens(tokens, loaded.Options.NumCtx, req.Truncate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("prompt %d: %v", start+i, err)})
+			return false
+		}
+
+		embedding, err := embedTokens(c.Request.Context(), loaded.runner, truncated, req.Pooling)
+		if err != nil {
+			log.Printf("embedding generation failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate embedding"})
+			return false
+		}
+
+		embedding, err = reduceEmbedding(embedding, req.Dimensions, req.Normalize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+
+		resp.Embeddings = append(resp.Embeddings, embedding)
+		resp.Tokens += len(truncated)
+	}
+
+	return true
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchSchedulerWait(t *testing.T) {
+	s := newBatchScheduler()
+	require.NoError(t, s.wait(context.Background()))
+
+	s.begin()
+	s.begin()
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- s.wait(context.Background())
+	}()
+
+	s.end()
+	select {
+	case <-waited:
+		t.Fatal("batch continued while an interactive request was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.end()
+	select {
+	case err := <-waited:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("batch did not continue once interactive requests finished")
+	}
+
+	// a new interactive request pauses batches again
+	s.begin()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.wait(ctx), context.DeadlineExceeded)
+
+	s.end()
+	require.NoError(t, s.wait(context.Background()))
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chaos injects failures into responses so clients can test how they handle them. It is set by
+// $OLLAMA_CHAOS, e.g.
+//
+//	latency=100ms-2s,errors=5%,disconnects=10%
+//
+// latency delays every request by a random duration in the range, or by exactly the duration if it is not
+// a range. errors is the share of requests which fail with a 500 or 503 before they are handled.
+// disconnects is the share of requests whose connection is closed part way through the response.
+type chaos struct {
+	minLatency, maxLatency time.Duration
+	errors                 float64
+	disconnects            float64
+
+	rand func() float64
+}
+
+// loadChaos returns nil if $OLLAMA_CHAOS isn't set
+func loadChaos() (*chaos, error) {
+	s := os.Getenv("OLLAMA_CHAOS")
+	if s == "" {
+		return nil, nil
+	}
+
+	ch, err := parseChaos(s)
+	if err != nil {
+		return nil, fmt.Errorf("OLLAMA_CHAOS: %w", err)
+	}
+
+	return ch, nil
+}
+
+func parseChaos(s string) (*chaos, error) {
+	ch := chaos{rand: rand.Float64}
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid setting '%s', expected key=value", field)
+		}
+
+		var err error
+		switch key {
+		case "latency":
+			lo, hi, isRange := strings.Cut(value, "-")
+			if ch.minLatency, err = time.ParseDuration(lo); err != nil {
+				return nil, fmt.Errorf("invalid latency '%s'", value)
+			}
+
+			ch.maxLatency = ch.minLatency
+			if isRange {
+				if ch.maxLatency, err = time.ParseDuration(hi); err != nil || ch.maxLatency < ch.minLatency {
+					return nil, fmt.Errorf("invalid latency '%s'", value)
+				}
+			}
+		case "errors":
+			if ch.errors, err = parseShare(value); err != nil {
+				return nil, err
+			}
+		case "disconnects":
+			if ch.disconnects, err = parseShare(value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown setting '%s'", key)
+		}
+	}
+
+	return &ch, nil
+}
+
+// parseShare parses a share of requests as a percentage, "5%", or a fraction, "0.05"
+func parseShare(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if strings.HasSuffix(s, "%") {
+		v /= 100
+	}
+
+	if err != nil || v < 0 || v > 1 {
+		return 0, fmt.Errorf("invalid share of requests '%s'", s)
+	}
+
+	return v, nil
+}
+
+func (ch *chaos) String() string {
+	return fmt.Sprintf("latency %s-%s, %.1f%% errors, %.1f%% disconnects", ch.minLatency, ch.maxLatency, ch.errors*100, ch.disconnects*100)
+}
+
+func (ch *chaos) Handler(c *gin.Context) {
+	if ch.maxLatency > 0 {
+		d := ch.minLatency + time.Duration(ch.rand()*float64(ch.maxLatency-ch.minLatency))
+		select {
+		case <-time.After(d):
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		}
+	}
+
+	if ch.rand() < ch.errors {
+		status := http.StatusInternalServerError
+		if ch.rand() < 0.5 {
+			status = http.StatusServiceUnavailable
+		}
+
+		c.AbortWithStatusJSON(status, gin.H{"error": "chaos: injected failure"})
+		return
+	}
+
+	if ch.rand() < ch.disconnects {
+		// cut the response during one of its first few writes
+		c.Writer = &disconnectWriter{ResponseWriter: c.Writer, after: 1 + int(ch.rand()*4)}
+	}
+
+	c.Next()
+}
+
+// disconnectWriter closes the connection part way through the after'th write to the response
+type disconnectWriter struct {
+	gin.ResponseWriter
+	after  int
+	writes int
+	closed bool
+}
+
+func (w *disconnectWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, http.ErrHijacked
+	}
+
+	w.writes++
+	if w.writes < w.after {
+		return w.ResponseWriter.Write(b)
+	}
+
+	n, err := w.ResponseWriter.Write(b[:len(b)/2])
+	if err != nil {
+		return n, err
+	}
+
+	w.closed = true
+	conn, _, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		log.Printf("chaos: couldn't disconnect: %v", err)
+		return n, err
+	}
+
+	conn.Close()
+	return n, http.ErrHijacked
+}
+
+func (w *disconnectWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *disconnectWriter) Flush() {
+	if !w.closed {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChaos(t *testing.T) {
+	ch, err := parseChaos("latency=100ms-2s,errors=5%,disconnects=0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, ch.minLatency)
+	assert.Equal(t, 2*time.Second, ch.maxLatency)
+	assert.InDelta(t, 0.05, ch.errors, 1e-9)
+	assert.InDelta(t, 0.1, ch.disconnects, 1e-9)
+
+	ch, err = parseChaos("latency=50ms")
+	require.NoError(t, err)
+	assert.Equal(t, 50*time.Millisecond, ch.minLatency)
+	assert.Equal(t, 50*time.Millisecond, ch.maxLatency)
+
+	for _, s := range []string{"errors", "errors=150%", "latency=2s-1s", "latency=fast", "jitter=1s"} {
+		_, err := parseChaos(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func chaosServer(t *testing.T, ch *chaos) *httptest.Server {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ch.Handler)
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "application/x-ndjson")
+		for i := 0; i < 10; i++ {
+			c.Writer.WriteString("{\"response\":\"token\"}\n")
+			c.Writer.Flush()
+		}
+	})
+
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestChaosErrors(t *testing.T) {
+	s := chaosServer(t, &chaos{errors: 1, rand: func() float64 { return 0 }})
+
+	resp, err := http.Get(s.URL + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestChaosDisconnects(t *testing.T) {
+	s := chaosServer(t, &chaos{disconnects: 1, rand: func() float64 { return 0.5 }})
+
+	resp, err := http.Get(s.URL + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var lines int
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines++
+	}
+
+	// the stream is cut during its third write
+	assert.Error(t, scanner.Err())
+	assert.Equal(t, 2, lines)
+}
+
+func TestChaosLatency(t *testing.T) {
+	s := chaosServer(t, &chaos{minLatency: 50 * time.Millisecond, maxLatency: 50 * time.Millisecond, rand: func() float64 { return 1 }})
+
+	start := time.Now()
+	resp, err := http.Get(s.URL + "/stream")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+const defaultChunkSize = 512
+
+// chunkTokens splits tokens into windows of at most size tokens where each window
+// repeats the last overlap tokens of the one before it. It returns the token offsets
+// of each window.
+func chunkTokens(numTokens, size, overlap int) [][2]int {
+	var windows [][2]int
+	for start := 0; start < numTokens; start += size - overlap {
+		end := start + size
+		if end > numTokens {
+			end = numTokens
+		}
+
+		windows = append(windows, [2]int{start, end})
+		if end == numTokens {
+			break
+		}
+	}
+
+	return windows
+}
+
+func ChunkHandler(c *gin.Context) {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	var req api.ChunkRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.ChunkSize == 0 {
+		req.ChunkSize = defaultChunkSize
+	}
+
+	// validate the request
+	switch {
+	case req.Model == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	case req.ChunkSize < 0:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "chunk_size must be positive"})
+		return
+	case req.Overlap < 0 || req.Overlap >= req.ChunkSize:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "overlap must be at least 0 and less than chunk_size"})
+		return
+	}
+
+	sessionDuration := defaultSessionDuration
+	if _, err := load(c, req.Model, req.Options, sessionDuration, nil); err != nil {
+		var pErr *fs.PathError
+		switch {
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		case errors.Is(err, api.ErrInvalidOpts):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	tokens, err := loaded.runner.Encode(c.Request.Context(), req.Text)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.ChunkResponse{Model: req.Model, Tokens: len(tokens), Chunks: []api.Chunk{}}
+	for _, window := range chunkTokens(len(tokens), req.ChunkSize, req.Overlap) {
+		text, err := loaded.runner.Decode(c.Request.Context(), tokens[window[0]:window[1]])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp.Chunks = append(resp.Chunks, api.Chunk{
+			Text:   text,
+			Start:  window[0],
+			End:    window[1],
+			Tokens: window[1] - window[0],
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,15 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkTokens(t *testing.T) {
+	assert.Nil(t, chunkTokens(0, 4, 0))
+	assert.Equal(t, [][2]int{{0, 3}}, chunkTokens(3, 4, 1))
+	assert.Equal(t, [][2]int{{0, 4}, {4, 8}, {8, 10}}, chunkTokens(10, 4, 0))
+	assert.Equal(t, [][2]int{{0, 4}, {3, 7}, {6, 10}}, chunkTokens(10, 4, 1))
+	assert.Equal(t, [][2]int{{0, 4}, {2, 6}}, chunkTokens(6, 4, 2))
+}
@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+// choicesGrammar builds a GBNF grammar which only accepts one of the choices verbatim
+func choicesGrammar(choices []string) string {
+	alternatives := make([]string, len(choices))
+	for i, choice := range choices {
+		alternatives[i] = gbnfLiteral(choice)
+	}
+
+	return "root ::= " + strings.Join(alternatives, " | ")
+}
+
+// gbnfLiteral quotes s as a GBNF string literal
+func gbnfLiteral(s string) string {
+	var sb strings.Builder
+	sb.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteString(`"`)
+	return sb.String()
+}
+
+// nextTokenProbabilities maps the candidates for the next token onto the tokens the choices go on with, the
+// result is normalized to sum to 1
+func nextTokenProbabilities(next []string, candidates []llm.TokenProb) []float64 {
+	probs := make(map[string]float64)
+	for _, candidate := range candidates {
+		probs[strings.TrimSpace(candidate.Token)] += candidate.Prob
+	}
+
+	var total float64
+	out := make([]float64, len(next))
+	for i, token := range next {
+		out[i] = probs[strings.TrimSpace(token)]
+		total += out[i]
+	}
+
+	if total > 0 {
+		for i := range out {
+			out[i] /= total
+		}
+	}
+
+	return out
+}
+
+// invalidChoicesError is a problem with the choices themselves rather than with running the model
+type invalidChoicesError string
+
+func (e invalidChoicesError) Error() string {
+	return string(e)
+}
+
+// choiceTokens tokenizes the choice as it follows the prompt, since tokenizers merge or mark the start of a
+// text differently on its own. When the end of the prompt merges into the choice the choice is tokenized alone.
+func choiceTokens(ctx context.Context, runner llm.LLM, prompt string, promptTokens []int, choice string) ([]int, error) {
+	tokens, err := runner.Encode(ctx, prompt+choice)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) > len(promptTokens) && slices.Equal(tokens[:len(promptTokens)], promptTokens) {
+		return tokens[len(promptTokens):], nil
+	}
+
+	return runner.Encode(ctx, choice)
+}
+
+// classify scores the choices by the probability of the runner answering the prompt with each of them. The
+// probability of a choice is the product of the probabilities of its tokens, each given the prompt and the
+// tokens before it, with the runner constrained to the choices. Choices which start with the same tokens are
+// scored together until they differ, so "New York" and "New Jersey" are told apart by their second token.
+// Scoring takes a prediction for each place the choices branch rather than a single pass over all of them, and a
+// choice can't be the start of another, the model would have to stop to answer it. The runner must sample a
+// single token greedily.
+func classify(ctx context.Context, runner llm.LLM, prompt string, choices []string) ([]api.ClassifyChoice, llm.PredictResult, error) {
+	promptTokens, err := runner.Encode(ctx, prompt)
+	if err != nil {
+		return nil, llm.PredictResult{}, err
+	}
+
+	tokens := make([][]int, len(choices))
+	for i, choice := range choices {
+		if choice == "" {
+			return nil, llm.PredictResult{}, invalidChoicesError("choices must not be empty")
+		}
+
+		t, err := choiceTokens(ctx, runner, prompt, promptTokens, choice)
+		if err != nil {
+			return nil, llm.PredictResult{}, err
+		}
+
+		if len(t) == 0 {
+			return nil, llm.PredictResult{}, invalidChoicesError("choices must not be empty")
+		}
+
+		tokens[i] = t
+	}
+
+	// a choice can't be told apart from one it is the start of
+	for i := range choices {
+		for j := range choices {
+			if i != j && choices[i] == choices[j] {
+				return nil, llm.PredictResult{}, invalidChoicesError(fmt.Sprintf("choice %q is given more than once", choices[i]))
+			}
+
+			if i != j && len(tokens[i]) <= len(tokens[j]) && slices.Equal(tokens[i], tokens[j][:len(tokens[i])]) {
+				return nil, llm.PredictResult{}, invalidChoicesError(fmt.Sprintf("choice %q is the start of %q", choices[i], choices[j]))
+			}
+		}
+	}
+
+	probs := make([]float64, len(choices))
+	for i := range probs {
+		probs[i] = 1
+	}
+
+	var result llm.PredictResult
+	var score func(depth int, group []int) error
+	score = func(depth int, group []int) error {
+		// a choice which is the only one left with these tokens is the model's answer once it gets here
+		if len(group) < 2 {
+			return nil
+		}
+
+		var order []int
+		next := make(map[int][]int)
+		for _, i := range group {
+			token := tokens[i][depth]
+			if _, ok := next[token]; !ok {
+				order = append(order, token)
+			}
+
+			next[token] = append(next[token], i)
+		}
+
+		if len(order) > 1 {
+			prefix, err := runner.Decode(ctx, tokens[group[0]][:depth])
+			if err != nil {
+				return err
+			}
+
+			texts := make([]string, len(order))
+			rests := make([]string, len(group))
+			for j, token := range order {
+				if texts[j], err = runner.Decode(ctx, []int{token}); err != nil {
+					return err
+				}
+			}
+
+			for j, i := range group {
+				if rests[j], err = runner.Decode(ctx, tokens[i][depth:]); err != nil {
+					return err
+				}
+			}
+
+			var candidates []llm.TokenProb
+			fn := func(r llm.PredictResult) {
+				if len(r.Probs) > 0 && candidates == nil {
+					candidates = r.Probs[0].Probs
+				}
+
+				if r.Done {
+					result.PromptEvalCount += r.PromptEvalCount
+					result.PromptEvalDuration += r.PromptEvalDuration
+					result.EvalCount += r.EvalCount
+					result.EvalDuration += r.EvalDuration
+				}
+			}
+
+			predictReq := llm.PredictOpts{
+				Prompt:      prompt + prefix,
+				Grammar:     choicesGrammar(rests),
+				NumProbs:    len(order) * 4,
+				CachePrompt: true,
+			}
+			if err := runner.Predict(ctx, predictReq, fn); err != nil {
+				return err
+			}
+
+			for j, p := range nextTokenProbabilities(texts, candidates) {
+				for _, i := range next[order[j]] {
+					probs[i] *= p
+				}
+			}
+		}
+
+		for _, token := range order {
+			if err := score(depth+1, next[token]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	group := make([]int, len(choices))
+	for i := range group {
+		group[i] = i
+	}
+
+	if err := score(0, group); err != nil {
+		return nil, llm.PredictResult{}, err
+	}
+
+	// choices whose tokens weren't among the candidates score 0, the others are normalized to sum to 1
+	var total float64
+	for _, p := range probs {
+		total += p
+	}
+
+	out := make([]api.ClassifyChoice, len(choices))
+	for i, choice := range choices {
+		out[i] = api.ClassifyChoice{Choice: choice}
+		if total > 0 {
+			out[i].Probability = probs[i] / total
+		}
+	}
+
+	return out, result, nil
+}
+
+func ClassifyHandler(c *gin.Context) {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	checkpointStart := time.Now()
+	var req api.ClassifyRequest
+	err := c.ShouldBindJSON(&req)
+
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// validate the request
+	switch {
+	case req.Model == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	case req.Prompt == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "prompt is required"})
+		return
+	case len(req.Choices) < 2:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "at least two choices are required"})
+		return
+	case req.Raw && req.System != "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "raw mode does not support system"})
+		return
+	}
+
+	// the choices are scored a token at a time from the model's probabilities, so temperature and num_predict
+	// are ignored, as documented
+	if req.Options == nil {
+		req.Options = make(map[string]interface{})
+	}
+	req.Options["num_predict"] = 1
+	req.Options["temperature"] = 0
+
+	sessionDuration := defaultSessionDuration
+	model, err := load(c, req.Model, req.Options, sessionDuration, nil)
+	if err != nil {
+		var pErr *fs.PathError
+		switch {
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		case errors.Is(err, api.ErrInvalidOpts):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	checkpointLoaded := time.Now()
+
+	prompt := req.Prompt
+	if !req.Raw {
+		prompt, err = model.Prompt(PromptVars{
+			System: req.System,
+			Prompt: req.Prompt,
+			First:  true,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	resp := api.ClassifyResponse{Model: req.Model}
+	choices, result, err := classify(c.Request.Context(), loaded.runner, prompt, req.Choices)
+	if err != nil {
+		var invalid invalidChoicesError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	resp.PromptEvalCount = result.PromptEvalCount
+	resp.PromptEvalDuration = result.PromptEvalDuration
+	resp.EvalCount = result.EvalCount
+	resp.EvalDuration = result.EvalDuration
+
+	resp.CreatedAt = time.Now().UTC()
+	resp.Choices = choices
+	resp.TotalDuration = time.Since(checkpointStart)
+	resp.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+	c.JSON(http.StatusOK, resp)
+}
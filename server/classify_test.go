@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+
+	"github.com/jmorganca/ollama/llm"
+)
+
+func TestChoicesGrammar(t *testing.T) {
+	got := choicesGrammar([]string{"yes", `say "no"`, "a\\b"})
+	assert.Equal(t, `root ::= "yes" | "say \"no\"" | "a\\b"`, got)
+}
+
+func TestNextTokenProbabilities(t *testing.T) {
+	candidates := []llm.TokenProb{
+		{Token: " positive", Prob: 0.6},
+		{Token: " negative", Prob: 0.2},
+		{Token: " neutral", Prob: 0.0},
+	}
+
+	got := nextTokenProbabilities([]string{"positive", "negative", " neutral"}, candidates)
+	assert.Len(t, got, 3)
+	assert.InDelta(t, 0.75, got[0], 1e-9)
+	assert.InDelta(t, 0.25, got[1], 1e-9)
+	assert.InDelta(t, 0.0, got[2], 1e-9)
+
+	got = nextTokenProbabilities([]string{"a", "b"}, nil)
+	assert.Equal(t, []float64{0, 0}, got)
+}
+
+// wordRunner tokenizes text into words with their leading spaces and answers with the candidates for the next
+// token given for each prompt
+type wordRunner struct {
+	llm.LLM
+
+	vocab      []string
+	candidates map[string][]llm.TokenProb
+	// dummyPrefix starts every text with a space, like SentencePiece tokenizers
+	dummyPrefix bool
+
+	prompts  []string
+	grammars []string
+}
+
+func (r *wordRunner) Encode(ctx context.Context, s string) ([]int, error) {
+	if r.dummyPrefix {
+		s = " " + s
+	}
+
+	var tokens []int
+	for len(s) > 0 {
+		end := strings.IndexByte(s[1:], ' ') + 1
+		if end == 0 {
+			end = len(s)
+		}
+
+		i := slices.Index(r.vocab, s[:end])
+		if i < 0 {
+			i = len(r.vocab)
+			r.vocab = append(r.vocab, s[:end])
+		}
+
+		tokens = append(tokens, i)
+		s = s[end:]
+	}
+
+	return tokens, nil
+}
+
+func (r *wordRunner) Decode(ctx context.Context, tokens []int) (string, error) {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString(r.vocab[token])
+	}
+
+	return sb.String(), nil
+}
+
+func (r *wordRunner) Predict(ctx context.Context, predict llm.PredictOpts, fn func(llm.PredictResult)) error {
+	r.prompts = append(r.prompts, predict.Prompt)
+	r.grammars = append(r.grammars, predict.Grammar)
+
+	fn(llm.PredictResult{Probs: []llm.TokenProbs{{Probs: r.candidates[predict.Prompt]}}})
+	fn(llm.PredictResult{Done: true, PromptEvalCount: len(predict.Prompt), EvalCount: 1})
+	return nil
+}
+
+func TestClassify(t *testing.T) {
+	runner := &wordRunner{candidates: map[string][]llm.TokenProb{
+		"Where? ":    {{Token: "New", Prob: 0.6}, {Token: "Boston", Prob: 0.2}, {Token: "The", Prob: 0.2}},
+		"Where? New": {{Token: " York", Prob: 0.3}, {Token: " Jersey", Prob: 0.1}},
+	}}
+
+	// choices which start with the same token are told apart by the tokens after it
+	choices, result, err := classify(context.TODO(), runner, "Where? ", []string{"New York", "New Jersey", "Boston"})
+	require.NoError(t, err)
+	require.Len(t, choices, 3)
+	assert.InDelta(t, 0.5625, choices[0].Probability, 1e-9)
+	assert.InDelta(t, 0.1875, choices[1].Probability, 1e-9)
+	assert.InDelta(t, 0.25, choices[2].Probability, 1e-9)
+
+	assert.Equal(t, []string{"Where? ", "Where? New"}, runner.prompts)
+	assert.Equal(t, []string{`root ::= "New York" | "New Jersey" | "Boston"`, `root ::= " York" | " Jersey"`}, runner.grammars)
+	assert.Equal(t, 2, result.EvalCount)
+
+	// choices whose tokens aren't among the candidates score 0
+	choices, _, err = classify(context.TODO(), runner, "Where? ", []string{"New York", "Paris"})
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, choices[0].Probability, 1e-9)
+	assert.InDelta(t, 0.0, choices[1].Probability, 1e-9)
+
+	for name, invalid := range map[string][]string{
+		"empty":     {"yes", ""},
+		"duplicate": {"yes", "no", "yes"},
+		"prefix":    {"New", "New York"},
+	} {
+		_, _, err := classify(context.TODO(), runner, "Where? ", invalid)
+		var choicesErr invalidChoicesError
+		assert.ErrorAs(t, err, &choicesErr, name)
+	}
+}
+
+func TestClassifyRetokenize(t *testing.T) {
+	runner := &wordRunner{dummyPrefix: true, candidates: map[string][]llm.TokenProb{
+		"Where?":     {{Token: " New", Prob: 0.6}, {Token: " Boston", Prob: 0.2}},
+		"Where? New": {{Token: " York", Prob: 0.3}, {Token: " Jersey", Prob: 0.1}},
+	}}
+
+	// on their own the choices would start with a space token of their own, after the prompt they don't
+	choices, _, err := classify(context.TODO(), runner, "Where?", []string{" New York", " New Jersey", " Boston"})
+	require.NoError(t, err)
+	require.Len(t, choices, 3)
+	assert.InDelta(t, 0.5625, choices[0].Probability, 1e-9)
+	assert.InDelta(t, 0.1875, choices[1].Probability, 1e-9)
+	assert.InDelta(t, 0.25, choices[2].Probability, 1e-9)
+
+	assert.Equal(t, []string{"Where?", "Where? New"}, runner.prompts)
+	assert.Equal(t, []string{`root ::= " New York" | " New Jersey" | " Boston"`, `root ::= " York" | " Jersey"`}, runner.grammars)
+
+	// a choice the end of the prompt merges into is tokenized alone
+	promptTokens, err := runner.Encode(context.TODO(), "Where? ")
+	require.NoError(t, err)
+	tokens, err := choiceTokens(context.TODO(), runner, "Where? ", promptTokens, "Boston")
+	require.NoError(t, err)
+	text, err := runner.Decode(context.TODO(), tokens)
+	require.NoError(t, err)
+	assert.Equal(t, " Boston", text)
+}
+
+func TestClassifyPrefixChoices(t *testing.T) {
+	runner := &wordRunner{}
+
+	// the model can't be asked to stop after a choice, so one which starts another is refused
+	for _, choices := range [][]string{{"New", "New York"}, {"New York", "New"}, {"yes", "no", "no thanks"}} {
+		_, _, err := classify(context.TODO(), runner, "Where? ", choices)
+		var choicesErr invalidChoicesError
+		require.ErrorAs(t, err, &choicesErr, choices)
+		assert.Contains(t, err.Error(), "is the start of", choices)
+	}
+
+	assert.Empty(t, runner.prompts)
+
+	// sharing a first word isn't a prefix
+	runner.candidates = map[string][]llm.TokenProb{"Where? ": {{Token: "New", Prob: 1}}, "Where? New": {{Token: " York", Prob: 1}}}
+	_, _, err := classify(context.TODO(), runner, "Where? ", []string{"New York", "Newark"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientQueue gives the generation requests turns at the model fairly between clients: a client's requests
+// wait in order, and the clients with waiting requests take turns, so one client's batch of requests doesn't
+// hold up everyone else. Clients are told apart by their API key, or their IP when they don't send one.
+type clientQueue struct {
+	mu sync.Mutex
+
+	// max is the number of requests a client can have running or waiting, 0 for no limit
+	max int
+
+	// busy is set while a request has the turn
+	busy    bool
+	clients map[string]*queuedClient
+
+	// next are the clients with waiting requests, in the order they take turns
+	next []string
+}
+
+type queuedClient struct {
+	// inflight counts the requests running or waiting
+	inflight int
+	// waiting are closed in order to give the client's requests their turn
+	waiting []chan struct{}
+}
+
+var clients = newClientQueue()
+
+func newClientQueue() *clientQueue {
+	return &clientQueue{clients: make(map[string]*queuedClient)}
+}
+
+// loadClientLimit reads the number of requests a client can have running or waiting in
+// $OLLAMA_MAX_CLIENT_REQUESTS, 0 for no limit
+func loadClientLimit() (int, error) {
+	s := os.Getenv("OLLAMA_MAX_CLIENT_REQUESTS")
+	if s == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("OLLAMA_MAX_CLIENT_REQUESTS: invalid number '%s', expected a number of requests, or 0 for no limit", s)
+	}
+
+	return n, nil
+}
+
+// clientKey identifies the client of a request by its bearer token, hashed so the token isn't kept, or
+// otherwise by its IP. Mirrored requests are a client of their own.
+func clientKey(c *gin.Context) string {
+	if mirrored(c.Request.Context()) {
+		return "mirror"
+	}
+
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+// Turn waits for the request's turn and holds it while the rest of its handlers run. Requests beyond the
+// client's limit are refused with 429.
+func (q *clientQueue) Turn(c *gin.Context) {
+	key := clientKey(c)
+	turn, ok := q.enqueue(key)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("too many requests, a client can have %d running or waiting", q.max)})
+		return
+	}
+
+	select {
+	case <-turn:
+	case <-c.Request.Context().Done():
+		if !q.cancel(key, turn) {
+			// the turn came as the client went away, it is passed on
+			q.done(key)
+		}
+
+		c.Abort()
+		return
+	}
+
+	defer q.done(key)
+	c.Next()
+}
+
+// enqueue adds a request of the client, the channel is closed once it has the turn. It reports false if the
+// client has too many requests already.
+func (q *clientQueue) enqueue(key string) (chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	client, ok := q.clients[key]
+	if !ok {
+		client = &queuedClient{}
+		q.clients[key] = client
+	}
+
+	if q.max > 0 && client.inflight >= q.max {
+		return nil, false
+	}
+
+	client.inflight++
+
+	turn := make(chan struct{})
+	if !q.busy {
+		q.busy = true
+		close(turn)
+		return turn, true
+	}
+
+	client.waiting = append(client.waiting, turn)
+	if len(client.waiting) == 1 {
+		q.next = append(q.next, key)
+	}
+
+	return turn, true
+}
+
+// cancel removes a request which is still waiting, it reports false if the request has already been given
+// the turn
+func (q *clientQueue) cancel(key string, turn chan struct{}) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	client := q.clients[key]
+	for i, waiting := range client.waiting {
+		if waiting != turn {
+			continue
+		}
+
+		client.waiting = append(client.waiting[:i], client.waiting[i+1:]...)
+		if len(client.waiting) == 0 {
+			q.skip(key)
+		}
+
+		q.leave(key, client)
+		return true
+	}
+
+	return false
+}
+
+// done ends the turn of a request of the client and gives it to the next client's first waiting request
+func (q *clientQueue) done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.leave(key, q.clients[key])
+
+	if len(q.next) == 0 {
+		q.busy = false
+		return
+	}
+
+	next := q.next[0]
+	q.next = q.next[1:]
+
+	client := q.clients[next]
+	turn := client.waiting[0]
+	client.waiting = client.waiting[1:]
+	if len(client.waiting) > 0 {
+		// the client waits for the others before its next turn
+		q.next = append(q.next, next)
+	}
+
+	close(turn)
+}
+
+// leave drops a request from the client's count, it is up to the caller to lock q.mu
+func (q *clientQueue) leave(key string, client *queuedClient) {
+	client.inflight--
+	if client.inflight == 0 {
+		delete(q.clients, key)
+	}
+}
+
+// skip removes the client from the clients taking turns, it is up to the caller to lock q.mu
+func (q *clientQueue) skip(key string) {
+	for i, next := range q.next {
+		if next == key {
+			q.next = append(q.next[:i], q.next[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// holds reports whether the request has been given the turn
+func holds(turn chan struct{}) bool {
+	select {
+	case <-turn:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestClientQueueTakesTurns(t *testing.T) {
+	q := newClientQueue()
+
+	first, ok := q.enqueue("a")
+	require.True(t, ok)
+	assert.True(t, holds(first))
+
+	// a queues a batch before b and c send one request each
+	var batch []chan struct{}
+	for i := 0; i < 3; i++ {
+		turn, ok := q.enqueue("a")
+		require.True(t, ok)
+		batch = append(batch, turn)
+	}
+
+	b, _ := q.enqueue("b")
+	c, _ := q.enqueue("c")
+
+	order := []chan struct{}{batch[0], b, c, batch[1], batch[2]}
+	keys := []string{"a", "a", "b", "c", "a", "a"}
+	for i, turn := range order {
+		assert.False(t, holds(turn), i)
+		q.done(keys[i])
+		assert.True(t, holds(turn), i)
+	}
+
+	q.done("a")
+	assert.False(t, q.busy)
+	assert.Empty(t, q.clients)
+	assert.Empty(t, q.next)
+}
+
+func TestClientQueueLimit(t *testing.T) {
+	q := newClientQueue()
+	q.max = 2
+
+	_, ok := q.enqueue("a")
+	require.True(t, ok)
+	_, ok = q.enqueue("a")
+	require.True(t, ok)
+	_, ok = q.enqueue("a")
+	assert.False(t, ok)
+
+	_, ok = q.enqueue("b")
+	assert.True(t, ok)
+
+	q.done("a")
+	_, ok = q.enqueue("a")
+	assert.True(t, ok)
+}
+
+func TestClientQueueCancel(t *testing.T) {
+	q := newClientQueue()
+	q.enqueue("a")
+
+	b, _ := q.enqueue("b")
+	c, _ := q.enqueue("c")
+	require.True(t, q.cancel("b", b))
+	assert.NotContains(t, q.clients, "b")
+
+	q.done("a")
+	assert.True(t, holds(c))
+
+	// a request given the turn can't be cancelled, it passes the turn on instead
+	assert.False(t, q.cancel("c", c))
+}
+
+func TestClientQueueTurn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	q := newClientQueue()
+	q.max = 1
+
+	release := make(chan struct{})
+	r := gin.New()
+	r.POST("/", q.Turn, func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	post := func(ctx context.Context, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	running := make(chan *httptest.ResponseRecorder)
+	go func() {
+		running <- post(context.Background(), "sk-one")
+	}()
+
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.busy
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, http.StatusTooManyRequests, post(context.Background(), "sk-one").Code)
+
+	// a request which gives up waiting leaves the queue
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	post(ctx, "sk-two")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-running).Code)
+	assert.Equal(t, http.StatusOK, post(context.Background(), "sk-two").Code)
+	assert.Empty(t, q.clients)
+}
+
+func TestClientKey(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Request.RemoteAddr = "192.168.1.5:41234"
+	assert.Equal(t, "ip:192.168.1.5", clientKey(c))
+
+	c.Request.Header.Set("Authorization", "Bearer sk-secret")
+	key := clientKey(c)
+	assert.Regexp(t, "^key:[0-9a-f]{16}$", key)
+	assert.NotContains(t, key, "secret")
+}
+
+func TestLoadClientLimit(t *testing.T) {
+	t.Setenv("OLLAMA_MAX_CLIENT_REQUESTS", "")
+	n, err := loadClientLimit()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	t.Setenv("OLLAMA_MAX_CLIENT_REQUESTS", "4")
+	n, err = loadClientLimit()
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	t.Setenv("OLLAMA_MAX_CLIENT_REQUESTS", "-1")
+	_, err = loadClientLimit()
+	assert.Error(t, err)
+}
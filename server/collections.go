@@ -0,0 +1,493 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+const defaultTopK = 5
+
+var (
+	errCollectionNotFound = errors.New("collection not found")
+	errCollectionExists   = errors.New("collection already exists")
+
+	collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+// collection is stored as a JSON file under ~/.ollama/collections
+type collection struct {
+	Name       string         `json:"name"`
+	Model      string         `json:"model"`
+	Dimensions int            `json:"dimensions,omitempty"`
+	Documents  []api.Document `json:"documents"`
+	ModifiedAt time.Time      `json:"modified_at"`
+}
+
+func (c *collection) summary() api.Collection {
+	return api.Collection{
+		Name:       c.Name,
+		Model:      c.Model,
+		Dimensions: c.Dimensions,
+		Documents:  len(c.Documents),
+		ModifiedAt: c.ModifiedAt,
+	}
+}
+
+// collectionStore keeps every collection in memory and writes them through to disk
+type collectionStore struct {
+	mu          sync.Mutex
+	dir         string
+	collections map[string]*collection
+}
+
+var collections collectionStore
+
+func collectionsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "collections"), nil
+}
+
+// open reads the collections from disk the first time it is called, it is up to the caller to lock s.mu
+func (s *collectionStore) open() error {
+	if s.collections != nil {
+		return nil
+	}
+
+	if s.dir == "" {
+		dir, err := collectionsDir()
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.collections = make(map[string]*collection)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		bts, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		var c collection
+		if err := json.Unmarshal(bts, &c); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		s.collections[c.Name] = &c
+	}
+
+	return nil
+}
+
+func (s *collectionStore) save(c *collection) error {
+	return writeJSONFile(s.dir, c.Name, c)
+}
+
+// writeJSONFile writes v to dir/name.json so readers never see a partial write
+func writeJSONFile(dir, name string, v any) error {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(dir, name+".json"), bts)
+}
+
+func (s *collectionStore) Create(name, model string) (*api.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.collections[name]; ok {
+		return nil, errCollectionExists
+	}
+
+	c := &collection{Name: name, Model: model, Documents: []api.Document{}, ModifiedAt: time.Now().UTC()}
+	if err := s.save(c); err != nil {
+		return nil, err
+	}
+
+	s.collections[name] = c
+	summary := c.summary()
+	return &summary, nil
+}
+
+func (s *collectionStore) Get(name string) (*api.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	c, ok := s.collections[name]
+	if !ok {
+		return nil, errCollectionNotFound
+	}
+
+	summary := c.summary()
+	return &summary, nil
+}
+
+func (s *collectionStore) List() ([]api.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	list := make([]api.Collection, 0, len(s.collections))
+	for _, c := range s.collections {
+		list = append(list, c.summary())
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+func (s *collectionStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if _, ok := s.collections[name]; !ok {
+		return errCollectionNotFound
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, name+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	delete(s.collections, name)
+	return nil
+}
+
+// Upsert adds documents to the collection, replacing any with the same id. Embeddings are normalized
+// so queries can be scored with a dot product.
+func (s *collectionStore) Upsert(name string, docs []api.Document) (*api.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	c, ok := s.collections[name]
+	if !ok {
+		return nil, errCollectionNotFound
+	}
+
+	dimensions := c.Dimensions
+	for _, doc := range docs {
+		if dimensions == 0 {
+			dimensions = len(doc.Embedding)
+		}
+
+		if len(doc.Embedding) != dimensions {
+			return nil, fmt.Errorf("document '%s' has %d dimensions but the collection has %d", doc.ID, len(doc.Embedding), dimensions)
+		}
+	}
+
+	updated := *c
+	updated.Dimensions = dimensions
+	updated.Documents = append([]api.Document{}, c.Documents...)
+
+	index := make(map[string]int, len(updated.Documents))
+	for i, doc := range updated.Documents {
+		index[doc.ID] = i
+	}
+
+	for _, doc := range docs {
+		doc.Embedding = normalizeVector(doc.Embedding)
+		if i, ok := index[doc.ID]; ok {
+			updated.Documents[i] = doc
+		} else {
+			index[doc.ID] = len(updated.Documents)
+			updated.Documents = append(updated.Documents, doc)
+		}
+	}
+
+	updated.ModifiedAt = time.Now().UTC()
+	if err := s.save(&updated); err != nil {
+		return nil, err
+	}
+
+	s.collections[name] = &updated
+	summary := updated.summary()
+	return &summary, nil
+}
+
+// Query returns the topK documents most similar to the embedding
+func (s *collectionStore) Query(name string, embedding []float64, topK int) ([]api.QueryResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	c, ok := s.collections[name]
+	if !ok {
+		return nil, errCollectionNotFound
+	}
+
+	if c.Dimensions > 0 && len(embedding) != c.Dimensions {
+		return nil, fmt.Errorf("query has %d dimensions but the collection has %d", len(embedding), c.Dimensions)
+	}
+
+	embedding = normalizeVector(embedding)
+
+	results := make([]api.QueryResult, len(c.Documents))
+	for i, doc := range c.Documents {
+		var score float64
+		for j := range embedding {
+			score += embedding[j] * doc.Embedding[j]
+		}
+
+		// the embeddings are only needed to score the documents
+		doc.Embedding = nil
+		results[i] = api.QueryResult{Document: doc, Score: score}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if topK < len(results) {
+		results = results[:topK]
+	}
+
+	return results, nil
+}
+
+func normalizeVector(v []float64) []float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+
+	norm := math.Sqrt(sum)
+	if norm == 0 {
+		return v
+	}
+
+	normalized := make([]float64, len(v))
+	for i, x := range v {
+		normalized[i] = x / norm
+	}
+
+	return normalized
+}
+
+// embedText embeds text with the model for collection documents and queries
+func embedText(c *gin.Context, model, text string) ([]float64, error) {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	if _, err := load(c, model, nil, defaultSessionDuration, nil); err != nil {
+		return nil, err
+	}
+
+	return loaded.runner.Embedding(c.Request.Context(), llm.EmbeddingOpts{Content: text})
+}
+
+func collectionError(c *gin.Context, err error) {
+	var pErr *fs.PathError
+	switch {
+	case errors.Is(err, errCollectionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("collection '%s' not found", c.Param("name"))})
+	case errors.Is(err, errCollectionExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &pErr):
+		c.JSON(http.StatusNotFound, gin.H{"error": "model not found, try pulling it first"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func CreateCollectionHandler(c *gin.Context) {
+	var req api.CreateCollectionRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case !collectionNamePattern.MatchString(req.Name):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name must contain only letters, numbers, '_', '-' and '.'"})
+		return
+	case req.Model == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	resp, err := collections.Create(req.Name, req.Model)
+	if err != nil {
+		collectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func ListCollectionsHandler(c *gin.Context) {
+	list, err := collections.List()
+	if err != nil {
+		collectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ListCollectionsResponse{Collections: list})
+}
+
+func DeleteCollectionHandler(c *gin.Context) {
+	if err := collections.Delete(c.Param("name")); err != nil {
+		collectionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+func UpsertDocumentsHandler(c *gin.Context) {
+	var req api.UpsertDocumentsRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	info, err := collections.Get(name)
+	if err != nil {
+		collectionError(c, err)
+		return
+	}
+
+	for i, doc := range req.Documents {
+		if strings.TrimSpace(doc.ID) == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "every document requires an id"})
+			return
+		}
+
+		if len(doc.Embedding) == 0 {
+			embedding, err := embedText(c, info.Model, doc.Text)
+			if err != nil {
+				collectionError(c, err)
+				return
+			}
+
+			req.Documents[i].Embedding = embedding
+		}
+	}
+
+	resp, err := collections.Upsert(name, req.Documents)
+	if err != nil {
+		if errors.Is(err, errCollectionNotFound) {
+			collectionError(c, err)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func QueryCollectionHandler(c *gin.Context) {
+	var req api.QueryCollectionRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Text == "" && len(req.Embedding) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "text or embedding is required"})
+		return
+	}
+
+	if req.TopK <= 0 {
+		req.TopK = defaultTopK
+	}
+
+	name := c.Param("name")
+	info, err := collections.Get(name)
+	if err != nil {
+		collectionError(c, err)
+		return
+	}
+
+	embedding := req.Embedding
+	if len(embedding) == 0 {
+		if embedding, err = embedText(c, info.Model, req.Text); err != nil {
+			collectionError(c, err)
+			return
+		}
+	}
+
+	results, err := collections.Query(name, embedding, req.TopK)
+	if err != nil {
+		if errors.Is(err, errCollectionNotFound) {
+			collectionError(c, err)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, api.QueryCollectionResponse{Results: results})
+}
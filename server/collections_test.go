@@ -0,0 +1,68 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestCollectionStore(t *testing.T) {
+	dir := t.TempDir()
+	s := collectionStore{dir: dir}
+
+	_, err := s.Create("docs", "llama2")
+	require.NoError(t, err)
+
+	_, err = s.Create("docs", "llama2")
+	assert.ErrorIs(t, err, errCollectionExists)
+
+	info, err := s.Upsert("docs", []api.Document{
+		{ID: "a", Text: "north", Embedding: []float64{0, 2}},
+		{ID: "b", Text: "east", Embedding: []float64{3, 0}},
+		{ID: "c", Text: "north east", Embedding: []float64{1, 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, info.Documents)
+	assert.Equal(t, 2, info.Dimensions)
+
+	_, err = s.Upsert("docs", []api.Document{{ID: "d", Embedding: []float64{1, 2, 3}}})
+	assert.Error(t, err)
+
+	results, err := s.Query("docs", []float64{0, 1}, 2)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "a", results[0].ID)
+	assert.InDelta(t, 1, results[0].Score, 1e-9)
+	assert.Equal(t, "c", results[1].ID)
+	assert.Nil(t, results[0].Embedding)
+
+	// upserting an existing id replaces the document
+	info, err = s.Upsert("docs", []api.Document{{ID: "a", Text: "south", Embedding: []float64{0, -1}}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, info.Documents)
+
+	// collections are read back from disk
+	reopened := collectionStore{dir: dir}
+	results, err = reopened.Query("docs", []float64{0, 1}, 5)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, "c", results[0].ID)
+	assert.Equal(t, "south", results[2].Text)
+
+	list, err := reopened.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "llama2", list[0].Model)
+
+	require.NoError(t, reopened.Delete("docs"))
+	_, err = os.Stat(filepath.Join(dir, "docs.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = reopened.Query("docs", []float64{0, 1}, 5)
+	assert.ErrorIs(t, err, errCollectionNotFound)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compressMinSize is the smallest response worth compressing
+const compressMinSize = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows a gzip response
+func acceptsGzip(header string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = v
+			}
+		}
+
+		// an explicit gzip takes precedence over *
+		if coding == "gzip" {
+			return q > 0
+		}
+
+		accepted = q > 0
+	}
+
+	return accepted
+}
+
+// compressWriter gzips a JSON response if it is large enough, it decides when the response is first written.
+// Streamed responses are newline delimited JSON so they are never compressed, and are flushed as they are
+// written.
+type compressWriter struct {
+	gin.ResponseWriter
+
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *compressWriter) decide(size int) {
+	if w.decided {
+		return
+	}
+
+	w.decided = true
+
+	header := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if size < compressMinSize || mediaType != "application/json" || header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.decide(len(b))
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Close() error {
+	if w.gz == nil {
+		return nil
+	}
+
+	defer gzipWriters.Put(w.gz)
+	return w.gz.Close()
+}
+
+// compressResponses gzips large JSON responses for clients which accept it
+func compressResponses(c *gin.Context) {
+	if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Next()
+		return
+	}
+
+	w := &compressWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer func() {
+		w.Close()
+		c.Writer = w.ResponseWriter
+	}()
+
+	c.Next()
+}
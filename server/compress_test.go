@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := map[string]bool{
+		"":                     false,
+		"gzip":                 true,
+		"deflate, GZIP":        true,
+		"br;q=1.0, gzip;q=0.8": true,
+		"gzip;q=0":             false,
+		"*":                    true,
+		"*;q=0":                false,
+		"gzip;q=0, *":          false,
+		"identity":             false,
+	}
+
+	for header, expected := range cases {
+		assert.Equal(t, expected, acceptsGzip(header), header)
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	large := strings.Repeat("a", 2*compressMinSize)
+
+	r := gin.New()
+	r.Use(compressResponses)
+	r.GET("/large", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"license": large})
+	})
+	r.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+	})
+	r.GET("/stream", func(c *gin.Context) {
+		ch := make(chan any, 1)
+		ch <- gin.H{"response": large}
+		close(ch)
+		streamResponse(c, ch)
+	})
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	get := func(path, acceptEncoding string) (http.Header, []byte) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+
+		// setting Accept-Encoding stops the transport decompressing the response itself
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.Header, body
+	}
+
+	header, body := get("/large", "gzip")
+	assert.Equal(t, "gzip", header.Get("Content-Encoding"))
+	assert.Less(t, len(body), compressMinSize)
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	body, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, `{"license":"`+large+`"}`, string(body))
+
+	for _, path := range []string{"/small", "/stream"} {
+		header, _ = get(path, "gzip")
+		assert.Empty(t, header.Get("Content-Encoding"), path)
+	}
+
+	header, body = get("/large", "identity")
+	assert.Empty(t, header.Get("Content-Encoding"))
+	assert.Contains(t, string(body), large)
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+var errConversationNotFound = errors.New("conversation not found")
+
+// conversationStore keeps every conversation in memory and writes them through to disk
+// as JSON files under ~/.ollama/conversations
+type conversationStore struct {
+	mu            sync.Mutex
+	dir           string
+	conversations map[string]*api.Conversation
+}
+
+var conversations conversationStore
+
+func conversationsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "conversations"), nil
+}
+
+// open reads the conversations from disk the first time it is called, it is up to the caller to lock s.mu
+func (s *conversationStore) open() error {
+	if s.conversations != nil {
+		return nil
+	}
+
+	if s.dir == "" {
+		dir, err := conversationsDir()
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.conversations = make(map[string]*api.Conversation)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		bts, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		var c api.Conversation
+		if err := json.Unmarshal(bts, &c); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		s.conversations[c.ID] = &c
+	}
+
+	return nil
+}
+
+func (s *conversationStore) save(c *api.Conversation) error {
+	return writeJSONFile(s.dir, c.ID, c)
+}
+
+func newConversationID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+func (s *conversationStore) Create(model string, messages []api.Message) (*api.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	id, err := newConversationID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	c := &api.Conversation{ID: id, Model: model, Messages: messages, CreatedAt: now, ModifiedAt: now}
+	if err := s.save(c); err != nil {
+		return nil, err
+	}
+
+	s.conversations[id] = c
+	return c, nil
+}
+
+// Get returns a copy of the conversation including its messages
+func (s *conversationStore) Get(id string) (*api.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	c, ok := s.conversations[id]
+	if !ok {
+		return nil, errConversationNotFound
+	}
+
+	conversation := *c
+	conversation.Messages = append([]api.Message{}, c.Messages...)
+	return &conversation, nil
+}
+
+// List returns the conversations without their messages, most recently modified first
+func (s *conversationStore) List() ([]api.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	list := make([]api.Conversation, 0, len(s.conversations))
+	for _, c := range s.conversations {
+		summary := *c
+		summary.Messages = nil
+		list = append(list, summary)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ModifiedAt.After(list[j].ModifiedAt)
+	})
+
+	return list, nil
+}
+
+func (s *conversationStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if _, ok := s.conversations[id]; !ok {
+		return errConversationNotFound
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, id+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	delete(s.conversations, id)
+	return nil
+}
+
+// Append adds messages to the end of the conversation
+func (s *conversationStore) Append(id string, messages ...api.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	c, ok := s.conversations[id]
+	if !ok {
+		return errConversationNotFound
+	}
+
+	updated := *c
+	updated.Messages = append(append([]api.Message{}, c.Messages...), messages...)
+	updated.ModifiedAt = time.Now().UTC()
+	if err := s.save(&updated); err != nil {
+		return err
+	}
+
+	s.conversations[id] = &updated
+	return nil
+}
+
+// Continue adds messages to the end of the conversation and the reply to the last of them, which must be
+// from the assistant
+func (s *conversationStore) Continue(id string, messages []api.Message, reply api.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	c, ok := s.conversations[id]
+	if !ok {
+		return errConversationNotFound
+	}
+
+	updated := *c
+	updated.Messages = append(append([]api.Message{}, c.Messages...), messages...)
+	if len(updated.Messages) == 0 || !strings.EqualFold(updated.Messages[len(updated.Messages)-1].Role, "assistant") {
+		return errors.New("continue requires the last message to be from the assistant")
+	}
+
+	last := &updated.Messages[len(updated.Messages)-1]
+	last.Content += reply.Content
+	last.Thinking += reply.Thinking
+	updated.ModifiedAt = time.Now().UTC()
+	if err := s.save(&updated); err != nil {
+		return err
+	}
+
+	s.conversations[id] = &updated
+	return nil
+}
+
+func conversationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation '%s' not found", c.Param("id"))})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func CreateConversationHandler(c *gin.Context) {
+	var req api.CreateConversationRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	conversation, err := conversations.Create(req.Model, req.Messages)
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+func ListConversationsHandler(c *gin.Context) {
+	list, err := conversations.List()
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ListConversationsResponse{Conversations: list})
+}
+
+func GetConversationHandler(c *gin.Context) {
+	conversation, err := conversations.Get(c.Param("id"))
+	if err != nil {
+		conversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+func DeleteConversationHandler(c *gin.Context) {
+	if err := conversations.Delete(c.Param("id")); err != nil {
+		conversationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestConversationStore(t *testing.T) {
+	dir := t.TempDir()
+	s := conversationStore{dir: dir}
+
+	c, err := s.Create("llama2", []api.Message{{Role: "system", Content: "Be brief."}})
+	require.NoError(t, err)
+	assert.Len(t, c.ID, 32)
+
+	require.NoError(t, s.Append(c.ID,
+		api.Message{Role: "user", Content: "Why is the sky blue?"},
+		api.Message{Role: "assistant", Content: "Rayleigh scattering."},
+	))
+
+	assert.ErrorIs(t, s.Append("missing", api.Message{Role: "user"}), errConversationNotFound)
+
+	// conversations are read back from disk
+	reopened := conversationStore{dir: dir}
+	got, err := reopened.Get(c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "llama2", got.Model)
+	require.Len(t, got.Messages, 3)
+	assert.Equal(t, "Rayleigh scattering.", got.Messages[2].Content)
+
+	list, err := reopened.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Nil(t, list[0].Messages)
+
+	require.NoError(t, reopened.Delete(c.ID))
+	_, err = reopened.Get(c.ID)
+	assert.ErrorIs(t, err, errConversationNotFound)
+}
+
+func TestConversationStoreContinue(t *testing.T) {
+	s := conversationStore{dir: t.TempDir()}
+
+	c, err := s.Create("llama2", []api.Message{{Role: "user", Content: "Why is the sky blue?"}})
+	require.NoError(t, err)
+
+	assert.EqualError(t, s.Continue(c.ID, nil, api.Message{Role: "assistant", Content: " scattering."}), "continue requires the last message to be from the assistant")
+
+	require.NoError(t, s.Continue(c.ID, []api.Message{{Role: "assistant", Content: "Rayleigh"}}, api.Message{Role: "assistant", Content: " scattering."}))
+	require.NoError(t, s.Continue(c.ID, nil, api.Message{Role: "assistant", Content: " Blue light scatters more."}))
+
+	got, err := s.Get(c.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Messages, 2)
+	assert.Equal(t, "Rayleigh scattering. Blue light scatters more.", got.Messages[1].Content)
+}
@@ -36,6 +36,12 @@ type blobDownload struct {
 
 	Parts []*blobDownloadPart
 
+	// urls are the endpoints the blob is downloaded from in order of priority, requests start with the
+	// preferred one, which answered last
+	urls      []*url.URL
+	preferred atomic.Int32
+	hedge     time.Duration
+
 	context.CancelFunc
 
 	done       bool
@@ -72,7 +78,23 @@ func (p *blobDownloadPart) StopsAt() int64 {
 	return p.Offset + p.Size
 }
 
-func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *RegistryOptions) error {
+// get sends a request for the blob, failing over to the other endpoints if the preferred one doesn't answer
+func (b *blobDownload) get(ctx context.Context, method string, headers http.Header, opts *RegistryOptions) (*http.Response, error) {
+	first := int(b.preferred.Load())
+	urls := append(append([]*url.URL{}, b.urls[first:]...), b.urls[:first]...)
+
+	resp, i, err := fetch(ctx, urls, b.hedge, func(ctx context.Context, requestURL *url.URL) (*http.Response, error) {
+		return makeRequestWithRetry(ctx, method, requestURL, headers.Clone(), nil, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b.preferred.Store(int32((first + i) % len(b.urls)))
+	return resp, nil
+}
+
+func (b *blobDownload) Prepare(ctx context.Context, opts *RegistryOptions) error {
 	partFilePaths, err := filepath.Glob(b.Name + "-partial-*")
 	if err != nil {
 		return err
@@ -90,7 +112,7 @@ func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *R
 	}
 
 	if len(b.Parts) == 0 {
-		resp, err := makeRequestWithRetry(ctx, http.MethodHead, requestURL, nil, nil, opts)
+		resp, err := b.get(ctx, http.MethodHead, nil, opts)
 		if err != nil {
 			return err
 		}
@@ -124,11 +146,11 @@ func (b *blobDownload) Prepare(ctx context.Context, requestURL *url.URL, opts *R
 	return nil
 }
 
-func (b *blobDownload) Run(ctx context.Context, requestURL *url.URL, opts *RegistryOptions) {
-	b.err = b.run(ctx, requestURL, opts)
+func (b *blobDownload) Run(ctx context.Context, opts *RegistryOptions) {
+	b.err = b.run(ctx, opts)
 }
 
-func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *RegistryOptions) error {
+func (b *blobDownload) run(ctx context.Context, opts *RegistryOptions) error {
 	defer blobDownloadManager.Delete(b.Digest)
 	ctx, b.CancelFunc = context.WithCancel(ctx)
 
@@ -152,7 +174,7 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *Regis
 			var err error
 			for try := 0; try < maxRetries; try++ {
 				w := io.NewOffsetWriter(file, part.StartsAt())
-				err = b.downloadChunk(inner, requestURL, w, part, opts)
+				err = b.downloadChunk(inner, w, part, opts)
 				switch {
 				case errors.Is(err, context.Canceled), errors.Is(err, syscall.ENOSPC):
 					// return immediately if the context is canceled or the device is out of space
@@ -175,6 +197,11 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *Regis
 		return err
 	}
 
+	// the blob must be on disk before it is renamed into place
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
 	// explicitly close the file so we can rename it
 	if err := file.Close(); err != nil {
 		return err
@@ -190,21 +217,33 @@ func (b *blobDownload) run(ctx context.Context, requestURL *url.URL, opts *Regis
 		return err
 	}
 
+	if err := syncDir(filepath.Dir(b.Name)); err != nil {
+		return err
+	}
+
 	b.done = true
 	return nil
 }
 
-func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w io.Writer, part *blobDownloadPart, opts *RegistryOptions) error {
+func (b *blobDownload) downloadChunk(ctx context.Context, w io.Writer, part *blobDownloadPart, opts *RegistryOptions) error {
 	headers := make(http.Header)
 	headers.Set("Range", fmt.Sprintf("bytes=%d-%d", part.StartsAt(), part.StopsAt()-1))
-	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, opts)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	resp, err := b.get(ctx, http.MethodGet, headers, opts)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	n, err := io.Copy(w, io.TeeReader(resp.Body, b))
-	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, io.ErrUnexpectedEOF) {
+	var watcher stallWatcher
+	watcher.Write(nil)
+	go watcher.watch(ctx, cancel)
+
+	n, err := io.Copy(w, io.TeeReader(io.TeeReader(resp.Body, b), &watcher))
+	stalled := errors.Is(context.Cause(ctx), errPartStalled)
+	if err != nil && !stalled && !errors.Is(err, context.Canceled) && !errors.Is(err, io.ErrUnexpectedEOF) {
 		// rollback progress
 		b.Completed.Add(-n)
 		return err
@@ -215,10 +254,44 @@ func (b *blobDownload) downloadChunk(ctx context.Context, requestURL *url.URL, w
 		return err
 	}
 
+	// a stalled part is retried from what it received
+	if stalled {
+		return errPartStalled
+	}
+
 	// return nil or context.Canceled or UnexpectedEOF (resumable)
 	return err
 }
 
+// stallWatcher records when a part last received bytes, those written to it
+type stallWatcher struct {
+	last atomic.Int64
+}
+
+func (s *stallWatcher) Write(p []byte) (int, error) {
+	s.last.Store(time.Now().UnixNano())
+	return len(p), nil
+}
+
+// watch cancels the part's request with errPartStalled once it has received nothing for partStallTimeout, so a
+// connection which stopped sending is retried instead of holding up the pull
+func (s *stallWatcher) watch(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(partStallTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, s.last.Load())) > partStallTimeout {
+				cancel(errPartStalled)
+				return
+			}
+		}
+	}
+}
+
 func (b *blobDownload) newPart(offset, size int64) error {
 	part := blobDownloadPart{blobDownload: b, Offset: offset, Size: size, N: len(b.Parts)}
 	if err := b.writePart(part.Name(), &part); err != nil {
@@ -301,14 +374,25 @@ type downloadOpts struct {
 	digest  string
 	regOpts *RegistryOptions
 	fn      func(api.ProgressResponse)
+
+	// url is where the blob is downloaded from when it isn't in the registry of mp
+	url *url.URL
 }
 
 const maxRetries = 6
 
-var errMaxRetriesExceeded = errors.New("max retries exceeded")
+// partStallTimeout is how long a part may go without receiving anything before it is retried
+var partStallTimeout = 10 * time.Second
+
+var (
+	errMaxRetriesExceeded = errors.New("max retries exceeded")
+	errPartStalled        = errors.New("part stalled")
+)
 
 // downloadBlob downloads a blob from the registry and stores it in the blobs directory
 func downloadBlob(ctx context.Context, opts downloadOpts) error {
+	store.Pin(ctx, opts.digest)
+
 	fp, err := GetBlobsPath(opts.digest)
 	if err != nil {
 		return err
@@ -333,14 +417,22 @@ func downloadBlob(ctx context.Context, opts downloadOpts) error {
 	data, ok := blobDownloadManager.LoadOrStore(opts.digest, &blobDownload{Name: fp, Digest: opts.digest})
 	download := data.(*blobDownload)
 	if !ok {
-		requestURL := opts.mp.BaseURL()
-		requestURL = requestURL.JoinPath("v2", opts.mp.GetNamespaceRepository(), "blobs", opts.digest)
-		if err := download.Prepare(ctx, requestURL, opts.regOpts); err != nil {
+		if opts.url != nil {
+			download.urls = []*url.URL{opts.url}
+		} else {
+			for _, base := range registries.endpoints(opts.mp) {
+				download.urls = append(download.urls, base.JoinPath("v2", opts.mp.GetNamespaceRepository(), "blobs", opts.digest))
+			}
+
+			download.hedge = registries.hedge(opts.mp)
+		}
+
+		if err := download.Prepare(ctx, opts.regOpts); err != nil {
 			blobDownloadManager.Delete(opts.digest)
 			return err
 		}
 
-		go download.Run(context.Background(), requestURL, opts.regOpts)
+		go download.Run(context.Background(), opts.regOpts)
 	}
 
 	return download.Wait(ctx, opts.fn)
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+	"github.com/jmorganca/ollama/testutil"
+)
+
+// stallingWriter sends the first byte of a response then stops sending until the request is canceled
+type stallingWriter struct {
+	http.ResponseWriter
+	r    *http.Request
+	once sync.Once
+}
+
+func (w *stallingWriter) Write(p []byte) (int, error) {
+	var n int
+	var stalled bool
+	w.once.Do(func() {
+		n, _ = w.ResponseWriter.Write(p[:1])
+		w.ResponseWriter.(http.Flusher).Flush()
+		<-w.r.Context().Done()
+		stalled = true
+	})
+
+	if stalled {
+		return n, w.r.Context().Err()
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func TestDownloadStalledPart(t *testing.T) {
+	timeout := partStallTimeout
+	t.Cleanup(func() { partStallTimeout = timeout })
+	partStallTimeout = 100 * time.Millisecond
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	registry := testutil.NewRegistry(t.TempDir())
+
+	// the first blob download stalls after its first byte
+	var stall sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			stall.Do(func() { w = &stallingWriter{ResponseWriter: w, r: r} })
+		}
+
+		registry.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nSYSTEM hello"))
+	require.NoError(t, err)
+
+	name := strings.TrimPrefix(srv.URL, "http://") + "/library/echo:latest"
+	require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+	require.NoError(t, PushModel(context.TODO(), name, &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {}))
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	// the stalled part is retried instead of holding up the pull
+	require.NoError(t, PullModel(context.TODO(), name, &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {}))
+
+	model, err := GetModel(name)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", model.System)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// proxyVariables are read by http.ProxyFromEnvironment, which registry requests and hooks use
+var proxyVariables = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// redactURL removes the credentials from a URL, one which can't be parsed is not shown at all
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "(invalid url)"
+	}
+
+	return u.Redacted()
+}
+
+// egress lists the destinations the server may send requests to with its current configuration. The runners
+// it starts listen on 127.0.0.1, requests to them stay on the machine and are not listed.
+func egress() api.EgressResponse {
+	resp := api.EgressResponse{
+		Offline:      offline(),
+		Destinations: []api.EgressDestination{},
+	}
+
+	add := func(u, purpose, reason string) {
+		resp.Destinations = append(resp.Destinations, api.EgressDestination{URL: u, Purpose: purpose, Reason: reason})
+	}
+
+	if !resp.Offline {
+		names := make([]string, 0, len(registries))
+		for name := range registries {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		for _, name := range names {
+			for _, u := range registries.endpoints(ModelPath{ProtocolScheme: DefaultProtocolScheme, Registry: name}) {
+				if u.Host == name {
+					add(u.String(), "registry", fmt.Sprintf("pulling and pushing models of %s", name))
+				} else {
+					add(redactURL(u.String()), "mirror", fmt.Sprintf("pulling models of %s", name))
+				}
+			}
+		}
+
+		if _, ok := registries[DefaultRegistry]; !ok {
+			add(DefaultProtocolScheme+"://"+DefaultRegistry, "registry", "pulling and pushing models")
+		}
+
+		for _, host := range huggingFaceRegistries {
+			add("https://"+host, "huggingface", "pulling models from Hugging Face")
+		}
+
+		add("*", "registry", "pulling models from urls, pulling and pushing models which name another registry, and the token services and storage registries redirect to")
+	}
+
+	for _, h := range hooks {
+		if h, ok := h.(*httpHook); ok {
+			add(redactURL(h.URL), "hook", fmt.Sprintf("filtering requests with hook '%s'", h.Name))
+		} else {
+			add("*", "hook", fmt.Sprintf("filtering requests with %T, registered by the program embedding the server", h))
+		}
+	}
+
+	if len(resp.Destinations) > 0 {
+		seen := make(map[string]bool)
+		for _, name := range proxyVariables {
+			v := strings.TrimSpace(os.Getenv(name))
+			if v == "" || seen[v] {
+				continue
+			}
+
+			seen[v] = true
+			if !strings.Contains(v, "://") {
+				v = "http://" + v
+			}
+
+			add(redactURL(v), "proxy", fmt.Sprintf("sending the requests above through %s", name))
+		}
+	}
+
+	return resp
+}
+
+func EgressHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, egress())
+}
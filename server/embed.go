@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+const (
+	truncateError = "error"
+	truncateHead  = "head"
+	truncateTail  = "tail"
+
+	poolingLast = "last"
+	poolingMean = "mean"
+	poolingCLS  = "cls"
+)
+
+// truncateTokens fits tokens into limit by dropping tokens from the head or tail,
+// or returns an error if they don't fit and truncation is not allowed
+func truncateTokens(tokens []int, limit int, mode string) ([]int, error) {
+	switch mode {
+	case "", truncateError, truncateHead, truncateTail:
+	default:
+		return nil, fmt.Errorf("truncate must be one of %q, %q or %q", truncateError, truncateHead, truncateTail)
+	}
+
+	if limit <= 0 || len(tokens) <= limit {
+		return tokens, nil
+	}
+
+	switch mode {
+	case truncateHead:
+		return tokens[len(tokens)-limit:], nil
+	case truncateTail:
+		return tokens[:limit], nil
+	default:
+		return nil, fmt.Errorf("prompt is %d tokens which is longer than the context length of %d, set truncate to %q or %q to shorten it", len(tokens), limit, truncateHead, truncateTail)
+	}
+}
+
+// embedTokens embeds tokens combining the model's per token embeddings with pooling
+func embedTokens(ctx context.Context, runner llm.LLM, tokens []int, pooling string) ([]float64, error) {
+	switch pooling {
+	case "", poolingLast:
+		return runner.Embedding(ctx, llm.EmbeddingOpts{Tokens: tokens})
+	case poolingMean:
+		if len(tokens) == 0 {
+			return runner.Embedding(ctx, llm.EmbeddingOpts{})
+		}
+
+		// the runner returns the embedding of the last token, which only depends on the tokens
+		// before it, so each prefix gives the embedding at that position. the runner reuses its
+		// cache for the shared prefix so each step only evaluates one more token.
+		var sum []float64
+		for i := 1; i <= len(tokens); i++ {
+			embedding, err := runner.Embedding(ctx, llm.EmbeddingOpts{Tokens: tokens[:i]})
+			if err != nil {
+				return nil, err
+			}
+
+			if sum == nil {
+				sum = make([]float64, len(embedding))
+			}
+
+			for j := range sum {
+				sum[j] += embedding[j]
+			}
+		}
+
+		for j := range sum {
+			sum[j] /= float64(len(tokens))
+		}
+
+		return sum, nil
+	default:
+		return nil, fmt.Errorf("pooling must be one of %q, %q or %q", poolingLast, poolingMean, poolingCLS)
+	}
+}
+
+// validEmbeddingRequest checks the truncate and pooling options before the model is loaded
+func validEmbeddingRequest(req api.EmbeddingRequest) error {
+	if _, err := truncateTokens(nil, 0, req.Truncate); err != nil {
+		return err
+	}
+
+	switch req.Pooling {
+	case "", poolingLast, poolingMean:
+	case poolingCLS:
+		// the runner only supports causal models where the first token never sees the rest of the prompt
+		return fmt.Errorf("pooling %q requires a bidirectional embedding model", poolingCLS)
+	default:
+		return fmt.Errorf("pooling must be one of %q, %q or %q", poolingLast, poolingMean, poolingCLS)
+	}
+
+	if req.Dimensions < 0 {
+		return fmt.Errorf("dimensions must be positive")
+	}
+
+	if len(req.Images) > 0 && req.Pooling != "" && req.Pooling != poolingLast {
+		return fmt.Errorf("pooling %q is not supported with images", req.Pooling)
+	}
+
+	return nil
+}
+
+// reduceEmbedding keeps the first dimensions of the embedding, if set, and optionally scales it to unit length
+func reduceEmbedding(embedding []float64, dimensions int, normalize bool) ([]float64, error) {
+	if dimensions > 0 {
+		if dimensions > len(embedding) {
+			return nil, fmt.Errorf("dimensions must be at most %d for this model", len(embedding))
+		}
+
+		embedding = embedding[:dimensions]
+	}
+
+	if normalize {
+		embedding = normalizeVector(embedding)
+	}
+
+	return embedding, nil
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestTruncateTokens(t *testing.T) {
+	tokens := []int{1, 2, 3, 4, 5}
+
+	got, err := truncateTokens(tokens, 10, "")
+	require.NoError(t, err)
+	assert.Equal(t, tokens, got)
+
+	_, err = truncateTokens(tokens, 3, "")
+	assert.ErrorContains(t, err, "longer than the context length")
+
+	_, err = truncateTokens(tokens, 3, truncateError)
+	assert.Error(t, err)
+
+	got, err = truncateTokens(tokens, 3, truncateHead)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 4, 5}, got)
+
+	got, err = truncateTokens(tokens, 3, truncateTail)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, got)
+
+	_, err = truncateTokens(tokens, 10, "middle")
+	assert.Error(t, err)
+}
+
+func TestValidEmbeddingRequest(t *testing.T) {
+	assert.NoError(t, validEmbeddingRequest(api.EmbeddingRequest{}))
+	assert.NoError(t, validEmbeddingRequest(api.EmbeddingRequest{Truncate: truncateHead, Pooling: poolingMean}))
+	assert.Error(t, validEmbeddingRequest(api.EmbeddingRequest{Pooling: poolingCLS}))
+	assert.Error(t, validEmbeddingRequest(api.EmbeddingRequest{Pooling: "max"}))
+	assert.Error(t, validEmbeddingRequest(api.EmbeddingRequest{Pooling: poolingMean, Images: []api.ImageData{{}}}))
+}
+
+func TestReduceEmbedding(t *testing.T) {
+	embedding := []float64{3, 4, 12}
+
+	got, err := reduceEmbedding(embedding, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, embedding, got)
+
+	got, err = reduceEmbedding(embedding, 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{3, 4}, got)
+
+	got, err = reduceEmbedding(embedding, 0, true)
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{3.0 / 13, 4.0 / 13, 12.0 / 13}, got, 1e-9)
+
+	got, err = reduceEmbedding(embedding, 2, true)
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{0.6, 0.8}, got, 1e-9)
+
+	_, err = reduceEmbedding(embedding, 4, false)
+	assert.Error(t, err)
+
+	// the input is not modified
+	assert.Equal(t, []float64{3, 4, 12}, embedding)
+}
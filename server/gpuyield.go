@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jmorganca/ollama/format"
+	"github.com/jmorganca/ollama/llm"
+)
+
+const (
+	gpuYieldOff  = "off"
+	gpuYieldIdle = "idle"
+
+	// gpuYieldInterval is how often free VRAM is checked
+	gpuYieldInterval = 5 * time.Second
+
+	// gpuYieldPolls is how many checks in a row must find VRAM short and the model idle before it is
+	// unloaded, so a brief spike or a pause between requests doesn't unload it
+	gpuYieldPolls = 6
+
+	// defaultGPUYieldLow is the free VRAM below which other applications are considered short of memory,
+	// unless a larger OLLAMA_GPU_RESERVE is set
+	defaultGPUYieldLow = 1 * format.GigaByte
+)
+
+// gpuYield decides when to give the GPU back to other applications by unloading the model
+type gpuYield struct {
+	// low is the free VRAM below which the model is unloaded
+	low   int64
+	polls int
+
+	// pressured is how many checks in a row have wanted the model unloaded
+	pressured int
+}
+
+// loadGPUYield reads the policy in $OLLAMA_GPU_YIELD, it returns nil if models shouldn't yield the GPU:
+//   - "off", the default, keeps models loaded until they expire
+//   - "idle" unloads a model nobody is using when free VRAM stays low
+func loadGPUYield() (*gpuYield, error) {
+	switch policy := os.Getenv("OLLAMA_GPU_YIELD"); policy {
+	case "", gpuYieldOff:
+		return nil, nil
+	case gpuYieldIdle:
+		reserve, err := llm.GPUReserve()
+		if err != nil {
+			return nil, err
+		}
+
+		low := int64(defaultGPUYieldLow)
+		if reserve > low {
+			low = reserve
+		}
+
+		return &gpuYield{low: low, polls: gpuYieldPolls}, nil
+	default:
+		return nil, fmt.Errorf("OLLAMA_GPU_YIELD: unknown policy '%s', expected %q or %q", policy, gpuYieldOff, gpuYieldIdle)
+	}
+}
+
+// observe records a check of free VRAM, idle is whether a model is loaded on the GPU and not in use. It
+// reports whether the model should be unloaded.
+func (y *gpuYield) observe(free int64, idle bool) bool {
+	if !idle || free >= y.low {
+		y.pressured = 0
+		return false
+	}
+
+	y.pressured++
+	if y.pressured < y.polls {
+		return false
+	}
+
+	y.pressured = 0
+	return true
+}
+
+// yieldGPU checks free VRAM every interval until ctx is done, unloading the model when y says so
+func yieldGPU(ctx context.Context, y *gpuYield, interval time.Duration) {
+	if _, err := llm.FreeVRAM(); err != nil {
+		log.Printf("OLLAMA_GPU_YIELD: %v, models will not yield the GPU", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		free, err := llm.FreeVRAM()
+		if err != nil {
+			log.Printf("OLLAMA_GPU_YIELD: %v", err)
+			continue
+		}
+
+		// a model held by a request is in use
+		if !loaded.mu.TryLock() {
+			y.observe(free, false)
+			continue
+		}
+
+		idle := loaded.runner != nil && loaded.runner.Placement().GPULayers > 0
+		if y.observe(free, idle) {
+			log.Printf("unloading %s, only %s of VRAM is free for other applications", loaded.ShortName, format.HumanBytes(free))
+			unload()
+		}
+
+		loaded.mu.Unlock()
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/format"
+)
+
+func TestLoadGPUYield(t *testing.T) {
+	t.Setenv("OLLAMA_GPU_RESERVE", "")
+
+	for _, policy := range []string{"", "off"} {
+		t.Setenv("OLLAMA_GPU_YIELD", policy)
+		y, err := loadGPUYield()
+		require.NoError(t, err)
+		assert.Nil(t, y)
+	}
+
+	t.Setenv("OLLAMA_GPU_YIELD", "idle")
+	y, err := loadGPUYield()
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultGPUYieldLow), y.low)
+
+	// a larger reserve raises the low water mark
+	t.Setenv("OLLAMA_GPU_RESERVE", "3GB")
+	y, err = loadGPUYield()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3*format.GigaByte), y.low)
+
+	t.Setenv("OLLAMA_GPU_YIELD", "always")
+	_, err = loadGPUYield()
+	assert.Error(t, err)
+}
+
+func TestGPUYieldObserve(t *testing.T) {
+	y := &gpuYield{low: 1000, polls: 3}
+
+	// plenty of free VRAM
+	assert.False(t, y.observe(2000, true))
+
+	assert.False(t, y.observe(500, true))
+	assert.False(t, y.observe(500, true))
+
+	// the model being used starts the count again
+	assert.False(t, y.observe(500, false))
+	assert.False(t, y.observe(500, true))
+	assert.False(t, y.observe(500, true))
+	assert.True(t, y.observe(500, true))
+
+	// as does free VRAM recovering
+	assert.False(t, y.observe(500, true))
+	assert.False(t, y.observe(1500, true))
+	assert.False(t, y.observe(500, true))
+	assert.False(t, y.observe(500, true))
+	assert.True(t, y.observe(500, true))
+}
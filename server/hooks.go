@@ -0,0 +1,346 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+const (
+	// HookStagePrompt runs before the prompt is rendered, hooks see and may change the request's messages
+	HookStagePrompt = "prompt"
+	// HookStageResponse runs after generation, hooks see and may change the whole response. Responses are
+	// held back until then, so streamed responses arrive in one piece.
+	HookStageResponse = "response"
+)
+
+// Hook filters prompts and responses, e.g. to redact personal information, enforce a content policy or scan
+// for prompt injection. HTTP hooks are configured in hooks.json, other hooks are added with RegisterHook by
+// programs which embed the server.
+type Hook interface {
+	// Handles reports whether the hook runs at the stage
+	Handles(stage string) bool
+	Filter(ctx context.Context, req HookRequest) (*HookResult, error)
+}
+
+// HookRequest is what a hook is given, a generate request is passed as a system and a user message
+type HookRequest struct {
+	Stage    string        `json:"stage"`
+	Endpoint string        `json:"endpoint"`
+	Model    string        `json:"model"`
+	Messages []api.Message `json:"messages"`
+
+	// Response and Thinking are set at the response stage
+	Response string `json:"response,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+}
+
+// HookResult is a hook's decision, the zero value lets the request through unchanged
+type HookResult struct {
+	Block  bool   `json:"block,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	// Messages, Response and Thinking replace those of the request when they are set
+	Messages []api.Message `json:"messages,omitempty"`
+	Response *string       `json:"response,omitempty"`
+	Thinking *string       `json:"thinking,omitempty"`
+}
+
+// HookBlockedError is returned when a hook blocks a request or its response
+type HookBlockedError struct {
+	Reason string
+}
+
+func (e *HookBlockedError) Error() string {
+	if e.Reason == "" {
+		return "blocked by a hook"
+	}
+
+	return "blocked by a hook: " + e.Reason
+}
+
+type hookChain []Hook
+
+// hooks run in the order they are registered, each sees the request as changed by the ones before it
+var hooks hookChain
+
+// RegisterHook adds a hook to the server, it must be called before Serve
+func RegisterHook(h Hook) {
+	hooks = append(hooks, h)
+}
+
+func (hc hookChain) Handles(stage string) bool {
+	for _, h := range hc {
+		if h.Handles(stage) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run passes the request through every hook of its stage
+func (hc hookChain) Run(ctx context.Context, req HookRequest) (HookRequest, error) {
+	for _, h := range hc {
+		if !h.Handles(req.Stage) {
+			continue
+		}
+
+		result, err := h.Filter(ctx, req)
+		if err != nil {
+			return req, err
+		}
+
+		if result == nil {
+			continue
+		}
+
+		if result.Block {
+			return req, &HookBlockedError{Reason: result.Reason}
+		}
+
+		if result.Messages != nil {
+			req.Messages = result.Messages
+		}
+
+		if result.Response != nil {
+			req.Response = *result.Response
+		}
+
+		if result.Thinking != nil {
+			req.Thinking = *result.Thinking
+		}
+	}
+
+	return req, nil
+}
+
+// responseFilter collects a response for the response hooks and moderation, which see all of it once it has
+// been generated. The response is held back until then when they may change or block it.
+type responseFilter struct {
+	hold              bool
+	content, thinking strings.Builder
+}
+
+// newResponseFilter returns nil if nothing filters responses
+func newResponseFilter() *responseFilter {
+	hooked := hooks.Handles(HookStageResponse)
+	moderated := moderation.Handles(HookStageResponse)
+	if !hooked && !moderated {
+		return nil
+	}
+
+	return &responseFilter{hold: hooked || (moderated && moderation.Block)}
+}
+
+// Add collects part of the response and reports whether it is held back
+func (f *responseFilter) Add(content, thinking string) bool {
+	f.content.WriteString(content)
+	f.thinking.WriteString(thinking)
+	return f.hold
+}
+
+// Filter runs the response hooks and then moderation over the whole response, and returns the response as
+// the hooks left it
+func (f *responseFilter) Filter(c *gin.Context, endpoint, model string, messages []api.Message) (string, string, *api.ModerationResult, error) {
+	filtered, err := hooks.Run(c.Request.Context(), HookRequest{
+		Stage:    HookStageResponse,
+		Endpoint: endpoint,
+		Model:    model,
+		Messages: messages,
+		Response: f.content.String(),
+		Thinking: f.thinking.String(),
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var result *api.ModerationResult
+	if moderation.Handles(HookStageResponse) && filtered.Response != "" {
+		results, err := moderation.moderate(c.Request.Context(), c.GetString("workDir"), []string{filtered.Response})
+		if err != nil {
+			return "", "", nil, fmt.Errorf("moderation: %w", err)
+		}
+
+		result = results[0]
+		if err := moderation.flagged(result); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	return filtered.Response, filtered.Thinking, result, nil
+}
+
+// generateMessages passes the system and prompt of a generate request to hooks as messages
+func generateMessages(system, prompt string) []api.Message {
+	var messages []api.Message
+	if system != "" {
+		messages = append(messages, api.Message{Role: "system", Content: system})
+	}
+
+	if prompt != "" {
+		messages = append(messages, api.Message{Role: "user", Content: prompt})
+	}
+
+	return messages
+}
+
+// generatePrompt is the reverse of generateMessages
+func generatePrompt(messages []api.Message) (system, prompt string) {
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			system = m.Content
+		case "user":
+			prompt = m.Content
+		}
+	}
+
+	return system, prompt
+}
+
+// abortFilterError fails a request whose prompt a hook or moderation blocked, or couldn't filter
+func abortFilterError(c *gin.Context, err error) {
+	var blocked *HookBlockedError
+	var flagged *ModerationFlaggedError
+	if errors.As(err, &blocked) || errors.As(err, &flagged) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// hookConfig is read from $OLLAMA_HOOKS or ~/.ollama/hooks.json, e.g.
+//
+//	{
+//	  "hooks": [
+//	    {"name": "redact", "url": "http://127.0.0.1:8000/redact", "stages": ["prompt", "response"], "timeout": "5s"}
+//	  ]
+//	}
+type hookConfig struct {
+	Hooks []*httpHook `json:"hooks"`
+}
+
+// httpHook posts a HookRequest to its URL, which replies with a HookResult
+type httpHook struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Stages  []string `json:"stages,omitempty"`
+	Timeout string   `json:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+func hookConfigPath() (string, error) {
+	if path, ok := os.LookupEnv("OLLAMA_HOOKS"); ok {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "hooks.json"), nil
+}
+
+// loadHookConfig returns nil if no hooks have been configured
+func loadHookConfig() (*hookConfig, error) {
+	path, err := hookConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config hookConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, h := range config.Hooks {
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%s: hook '%s' needs an http or https url", path, h.Name)
+		}
+
+		if len(h.Stages) == 0 {
+			h.Stages = []string{HookStagePrompt, HookStageResponse}
+		}
+
+		for _, stage := range h.Stages {
+			if stage != HookStagePrompt && stage != HookStageResponse {
+				return nil, fmt.Errorf("%s: unknown stage '%s' for hook '%s'", path, stage, h.Name)
+			}
+		}
+
+		h.timeout = 10 * time.Second
+		if h.Timeout != "" {
+			h.timeout, err = time.ParseDuration(h.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("%s: hook '%s': %w", path, h.Name, err)
+			}
+		}
+	}
+
+	return &config, nil
+}
+
+func (h *httpHook) Handles(stage string) bool {
+	return slices.Contains(h.Stages, stage)
+}
+
+// Filter fails the request if the hook can't be reached, so a hook which is down doesn't let everything through
+func (h *httpHook) Filter(ctx context.Context, req HookRequest) (*HookResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(bts))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("hook '%s': %w", h.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("hook '%s': %d: %s", h.Name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result HookResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("hook '%s': %w", h.Name, err)
+	}
+
+	return &result, nil
+}
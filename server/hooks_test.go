@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestLoadHookConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.json")
+	t.Setenv("OLLAMA_HOOKS", path)
+
+	config, err := loadHookConfig()
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"hooks": [{"name": "redact", "url": "http://127.0.0.1:8000/redact", "timeout": "5s"}]}`), 0o644))
+	config, err = loadHookConfig()
+	require.NoError(t, err)
+	require.Len(t, config.Hooks, 1)
+	assert.True(t, config.Hooks[0].Handles(HookStagePrompt))
+	assert.True(t, config.Hooks[0].Handles(HookStageResponse))
+	assert.Equal(t, 5*time.Second, config.Hooks[0].timeout)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"hooks": [{"name": "scan", "url": "http://127.0.0.1:8000/scan", "stages": ["input"]}]}`), 0o644))
+	_, err = loadHookConfig()
+	assert.ErrorContains(t, err, "unknown stage 'input' for hook 'scan'")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"hooks": [{"name": "scan", "url": "/scan"}]}`), 0o644))
+	_, err = loadHookConfig()
+	assert.ErrorContains(t, err, "hook 'scan' needs an http or https url")
+}
+
+func TestGeneratePrompt(t *testing.T) {
+	system, prompt := generatePrompt(generateMessages("be brief", "why is the sky blue?"))
+	assert.Equal(t, "be brief", system)
+	assert.Equal(t, "why is the sky blue?", prompt)
+
+	assert.Len(t, generateMessages("", "why is the sky blue?"), 1)
+}
+
+// testHookServer redacts email addresses and blocks anything mentioning passwords
+func testHookServer(t *testing.T) *httpHook {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req HookRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		var result HookResult
+		switch req.Stage {
+		case HookStagePrompt:
+			for _, m := range req.Messages {
+				if strings.Contains(m.Content, "password") {
+					result = HookResult{Block: true, Reason: "asks for a password"}
+				}
+
+				m.Content = strings.ReplaceAll(m.Content, "jane@example.com", "[email]")
+				result.Messages = append(result.Messages, m)
+			}
+		case HookStageResponse:
+			response := strings.ReplaceAll(req.Response, "jane@example.com", "[email]")
+			result.Response = &response
+		}
+
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(hook.Close)
+
+	return &httpHook{Name: "redact", URL: hook.URL, Stages: []string{HookStagePrompt, HookStageResponse}, timeout: time.Second}
+}
+
+func TestHookChain(t *testing.T) {
+	chain := hookChain{testHookServer(t)}
+
+	req, err := chain.Run(context.TODO(), HookRequest{
+		Stage:    HookStagePrompt,
+		Messages: []api.Message{{Role: "user", Content: "write to jane@example.com"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "write to [email]", req.Messages[0].Content)
+
+	req, err = chain.Run(context.TODO(), HookRequest{Stage: HookStageResponse, Response: "Dear jane@example.com,", Thinking: "a letter"})
+	require.NoError(t, err)
+	assert.Equal(t, "Dear [email],", req.Response)
+	assert.Equal(t, "a letter", req.Thinking)
+
+	_, err = chain.Run(context.TODO(), HookRequest{
+		Stage:    HookStagePrompt,
+		Messages: []api.Message{{Role: "user", Content: "what is the admin password?"}},
+	})
+	var blocked *HookBlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, "blocked by a hook: asks for a password", err.Error())
+
+	// a hook which is down fails the request rather than letting it through
+	down := &httpHook{Name: "down", URL: "http://127.0.0.1:1", Stages: []string{HookStagePrompt}, timeout: time.Second}
+	_, err = hookChain{down}.Run(context.TODO(), HookRequest{Stage: HookStagePrompt})
+	assert.ErrorContains(t, err, "hook 'down'")
+}
+
+func TestGenerateHandlerHookBlocked(t *testing.T) {
+	original := hooks
+	t.Cleanup(func() { hooks = original })
+	hooks = hookChain{testHookServer(t)}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/generate", GenerateHandler)
+
+	bts, err := json.Marshal(api.GenerateRequest{Model: "llama2", Prompt: "what is the admin password?"})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/generate", bytes.NewReader(bts)))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "blocked by a hook: asks for a password")
+}
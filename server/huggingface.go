@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+// huggingFaceRegistries are the registry names of models pulled from the Hugging Face Hub
+var huggingFaceRegistries = []string{"hf.co", "huggingface.co"}
+
+func isHuggingFace(mp ModelPath) bool {
+	for _, registry := range huggingFaceRegistries {
+		if strings.EqualFold(mp.Registry, registry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// huggingFaceEndpoint is the Hub to pull from, HF_ENDPOINT points it at a mirror
+func huggingFaceEndpoint() (*url.URL, error) {
+	if endpoint := os.Getenv("HF_ENDPOINT"); endpoint != "" {
+		return url.Parse(endpoint)
+	}
+
+	return &url.URL{Scheme: "https", Host: "huggingface.co"}, nil
+}
+
+// huggingFaceFile is a file in a Hugging Face repository, LFS is set for files stored in Git LFS such as weights
+type huggingFaceFile struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	LFS  *struct {
+		Oid  string `json:"oid"`
+		Size int64  `json:"size"`
+	} `json:"lfs"`
+}
+
+// Quantization is the quantization in the file's name, e.g. q4_k_m
+func (f huggingFaceFile) Quantization() string {
+	name := strings.TrimSuffix(strings.ToLower(path.Base(f.Path)), ".gguf")
+	if m := quantizationPattern.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+
+	return ""
+}
+
+// selectHuggingFaceFile picks the GGUF file of the quantization in tag. Without a tag the only GGUF
+// file is used, or the Q4_K_M one when there are several.
+func selectHuggingFaceFile(repo, tag string, files []huggingFaceFile) (*huggingFaceFile, error) {
+	var ggufs []huggingFaceFile
+	for _, f := range files {
+		name := strings.ToLower(path.Base(f.Path))
+		if f.Type == "file" && f.LFS != nil && path.Ext(name) == ".gguf" && !strings.HasPrefix(name, "mmproj") {
+			ggufs = append(ggufs, f)
+		}
+	}
+
+	if len(ggufs) == 0 {
+		return nil, fmt.Errorf("%s has no GGUF files", repo)
+	}
+
+	if tag == DefaultTag {
+		if len(ggufs) == 1 {
+			return &ggufs[0], nil
+		}
+
+		tag = "q4_k_m"
+	}
+
+	var quantizations []string
+	for i := range ggufs {
+		q := ggufs[i].Quantization()
+		if strings.EqualFold(q, tag) {
+			return &ggufs[i], nil
+		}
+
+		if q != "" {
+			quantizations = append(quantizations, strings.ToUpper(q))
+		}
+	}
+
+	sort.Strings(quantizations)
+	return nil, fmt.Errorf("%s has no %s file, pull one of the tags %s", repo, strings.ToUpper(tag), strings.Join(quantizations, ", "))
+}
+
+// listHuggingFaceFiles lists every file in the main branch of the repository
+func listHuggingFaceFiles(ctx context.Context, endpoint *url.URL, repo string, regOpts *RegistryOptions) ([]huggingFaceFile, error) {
+	requestURL := endpoint.JoinPath("api", "models", repo, "tree", "main")
+	requestURL.RawQuery = "recursive=true"
+
+	resp, err := makeRequest(ctx, http.MethodGet, requestURL, nil, nil, regOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%s is gated or private, set HF_TOKEN to a Hugging Face access token which can read it", repo)
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s not found on Hugging Face: %w", repo, os.ErrNotExist)
+	case resp.StatusCode >= http.StatusBadRequest:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%d: %s", resp.StatusCode, body)
+	}
+
+	var files []huggingFaceFile
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// pullHuggingFace downloads a GGUF file from a Hugging Face repository and creates a model from it,
+// with the template and parameters of its model family when they are known
+func pullHuggingFace(ctx context.Context, name string, mp ModelPath, regOpts *RegistryOptions, fn func(api.ProgressResponse)) error {
+	endpoint, err := huggingFaceEndpoint()
+	if err != nil {
+		return err
+	}
+
+	hfOpts := &RegistryOptions{Insecure: regOpts.Insecure, Token: os.Getenv("HF_TOKEN")}
+	repo := mp.GetNamespaceRepository()
+
+	fn(api.ProgressResponse{Status: "pulling manifest"})
+	files, err := listHuggingFaceFiles(ctx, endpoint, repo, hfOpts)
+	if err != nil {
+		return err
+	}
+
+	file, err := selectHuggingFaceFile(repo, mp.Tag, files)
+	if err != nil {
+		return err
+	}
+
+	digest := "sha256:" + file.LFS.Oid
+	if err := downloadBlob(ctx, downloadOpts{
+		mp:      mp,
+		digest:  digest,
+		regOpts: hfOpts,
+		fn:      fn,
+		url:     endpoint.JoinPath(repo, "resolve", "main", file.Path),
+	}); err != nil {
+		return err
+	}
+
+	fn(api.ProgressResponse{Status: "verifying sha256 digest"})
+	if err := verifyBlob(digest); err != nil {
+		if errors.Is(err, errDigestMismatch) {
+			if fp, err := GetBlobsPath(digest); err == nil {
+				os.Remove(fp)
+			}
+		}
+
+		return err
+	}
+
+	modelfile := fmt.Sprintf("FROM @%s\n%s", digest, importModelfile(strings.ToLower(path.Base(file.Path))))
+	commands, err := parser.Parse(strings.NewReader(modelfile))
+	if err != nil {
+		return err
+	}
+
+	return CreateModel(ctx, name, "", commands, fn)
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestSelectHuggingFaceFile(t *testing.T) {
+	lfs := func(path string) huggingFaceFile {
+		f := huggingFaceFile{Type: "file", Path: path}
+		f.LFS = &struct {
+			Oid  string `json:"oid"`
+			Size int64  `json:"size"`
+		}{Oid: "0000", Size: 1}
+		return f
+	}
+
+	files := []huggingFaceFile{
+		{Type: "file", Path: "README.md"},
+		lfs("mistral-7b-instruct-v0.2.Q2_K.gguf"),
+		lfs("mistral-7b-instruct-v0.2.Q4_K_M.gguf"),
+		lfs("mistral-7b-instruct-v0.2.Q8_0.gguf"),
+	}
+
+	f, err := selectHuggingFaceFile("TheBloke/Mistral-7B-Instruct-v0.2-GGUF", "Q8_0", files)
+	require.NoError(t, err)
+	assert.Equal(t, "mistral-7b-instruct-v0.2.Q8_0.gguf", f.Path)
+
+	f, err = selectHuggingFaceFile("TheBloke/Mistral-7B-Instruct-v0.2-GGUF", DefaultTag, files)
+	require.NoError(t, err)
+	assert.Equal(t, "mistral-7b-instruct-v0.2.Q4_K_M.gguf", f.Path)
+
+	_, err = selectHuggingFaceFile("TheBloke/Mistral-7B-Instruct-v0.2-GGUF", "Q5_K_S", files)
+	assert.EqualError(t, err, "TheBloke/Mistral-7B-Instruct-v0.2-GGUF has no Q5_K_S file, pull one of the tags Q2_K, Q4_K_M, Q8_0")
+
+	_, err = selectHuggingFaceFile("TheBloke/Mistral-7B-Instruct-v0.2-GGUF", DefaultTag, files[:1])
+	assert.EqualError(t, err, "TheBloke/Mistral-7B-Instruct-v0.2-GGUF has no GGUF files")
+}
+
+func TestPullHuggingFace(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("HF_TOKEN", "hf_secret")
+
+	// the smallest GGUF file, version 3 with no tensors or metadata
+	content := []byte{'G', 'G', 'U', 'F', 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	file := "zephyr-7b-beta.Q4_K_M.gguf"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/models/TheBloke/zephyr-7B-beta-GGUF/tree/main", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer hf_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"type": "file", "path": "README.md", "size": 10},
+			{"type": "file", "path": file, "size": len(content), "lfs": map[string]any{"oid": fmt.Sprintf("%x", sha256.Sum256(content)), "size": len(content)}},
+		})
+	})
+	mux.HandleFunc("/TheBloke/zephyr-7B-beta-GGUF/resolve/main/"+file, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, file, time.Time{}, bytes.NewReader(content))
+	})
+
+	hf := httptest.NewServer(mux)
+	t.Cleanup(hf.Close)
+	t.Setenv("HF_ENDPOINT", hf.URL)
+
+	name := "hf.co/TheBloke/zephyr-7B-beta-GGUF:Q4_K_M"
+	require.NoError(t, PullModel(context.TODO(), name, &RegistryOptions{}, func(api.ProgressResponse) {}))
+
+	model, err := GetModel(name)
+	require.NoError(t, err)
+	assert.Contains(t, model.Template, "<|assistant|>")
+
+	// the downloaded file is the model layer
+	blob, err := GetBlobsPath(fmt.Sprintf("sha256:%x", sha256.Sum256(content)))
+	require.NoError(t, err)
+	assert.Equal(t, blob, model.ModelPath)
+
+	t.Setenv("HF_TOKEN", "")
+	err = PullModel(context.TODO(), name, &RegistryOptions{}, func(api.ProgressResponse) {})
+	assert.ErrorContains(t, err, "set HF_TOKEN")
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// idempotencyKeyTTL is how long a finished operation is kept for clients retrying it with the same
+// Idempotency-Key
+const idempotencyKeyTTL = 24 * time.Hour
+
+var errIdempotencyKeyReused = errors.New("Idempotency-Key was already used for a different request")
+
+// operationRegistry has the creates, pulls and pushes in progress so identical requests, e.g. a client
+// retrying after its connection dropped, join the one in progress instead of starting another
+type operationRegistry struct {
+	mu sync.Mutex
+
+	// running is keyed by the fingerprint of the request, keys by the client's Idempotency-Key
+	running map[string]*operation
+	keys    map[string]*operation
+}
+
+var operations operationRegistry
+
+// operation is a create, pull or push whose responses go to every request which joined it
+type operation struct {
+	fingerprint string
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// responses has the latest progress of each step, it is what a request joining late is sent first
+	responses []operationResponse
+	steps     map[string]int
+	seq       int64
+
+	subscribers int
+	done        bool
+	failed      bool
+	canceled    bool
+	finished    time.Time
+
+	// keep is set when a request has an Idempotency-Key, the operation then finishes even if every
+	// request leaves, so a retry gets its result
+	keep   bool
+	cancel context.CancelFunc
+}
+
+type operationResponse struct {
+	val any
+	seq int64
+}
+
+// fingerprint identifies a request by its kind and the fields which change what it does
+func fingerprint(kind string, fields ...string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.Join(append([]string{kind}, fields...), "\x00")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Join returns the responses of the operation identified by fingerprint, or by the request's Idempotency-Key,
+// starting it with run if there is none. The operation outlives the request which started it while other
+// requests have joined it or any of them sent an Idempotency-Key.
+func (r *operationRegistry) Join(c *gin.Context, fingerprint string, run func(ctx context.Context, send func(any))) (chan any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running == nil {
+		r.running = make(map[string]*operation)
+		r.keys = make(map[string]*operation)
+	}
+
+	now := time.Now()
+	for key, op := range r.keys {
+		if op.expired(now) {
+			delete(r.keys, key)
+		}
+	}
+
+	key := c.GetHeader("Idempotency-Key")
+	if op, ok := r.keys[key]; ok && key != "" {
+		if op.fingerprint != fingerprint {
+			return nil, errIdempotencyKeyReused
+		}
+
+		// a retry of a failed operation runs it again
+		if !op.retryable() {
+			return op.subscribe(c.Request.Context()), nil
+		}
+
+		delete(r.keys, key)
+	}
+
+	op, ok := r.running[fingerprint]
+	if !ok || op.retryable() {
+		ctx, cancel := context.WithCancel(context.Background())
+		op = &operation{fingerprint: fingerprint, steps: make(map[string]int), cancel: cancel}
+		op.cond = sync.NewCond(&op.mu)
+		r.running[fingerprint] = op
+
+		go func() {
+			defer cancel()
+
+			run(ctx, op.publish)
+			op.finish()
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.running[fingerprint] == op {
+				delete(r.running, fingerprint)
+			}
+		}()
+	}
+
+	if key != "" {
+		r.keys[key] = op
+		op.mu.Lock()
+		op.keep = true
+		op.mu.Unlock()
+	}
+
+	return op.subscribe(c.Request.Context()), nil
+}
+
+// publish adds a response, progress replaces the last response of the same step
+func (op *operation) publish(val any) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.seq++
+	if _, ok := val.(gin.H); ok {
+		op.failed = true
+	}
+
+	if p, ok := val.(api.ProgressResponse); ok {
+		step := p.Status + "\x00" + p.Digest
+		if i, ok := op.steps[step]; ok {
+			op.responses[i] = operationResponse{val: val, seq: op.seq}
+			op.cond.Broadcast()
+			return
+		}
+
+		op.steps[step] = len(op.responses)
+	}
+
+	op.responses = append(op.responses, operationResponse{val: val, seq: op.seq})
+	op.cond.Broadcast()
+}
+
+func (op *operation) finish() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.done = true
+	op.finished = time.Now()
+	op.cond.Broadcast()
+}
+
+// retryable reports whether a request joining the operation should start it again instead, as it failed or
+// was canceled
+func (op *operation) retryable() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	return op.canceled || (op.done && op.failed)
+}
+
+func (op *operation) expired(now time.Time) bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	return op.done && now.Sub(op.finished) > idempotencyKeyTTL
+}
+
+// subscribe sends the responses so far and those that follow until the operation finishes or ctx is done.
+// A subscriber which falls behind gets the latest progress of each step rather than every update.
+func (op *operation) subscribe(ctx context.Context) chan any {
+	ch := make(chan any)
+
+	op.mu.Lock()
+	op.subscribers++
+	op.mu.Unlock()
+
+	// wake the subscriber up when its request is done
+	go func() {
+		<-ctx.Done()
+		op.mu.Lock()
+		op.cond.Broadcast()
+		op.mu.Unlock()
+	}()
+
+	go func() {
+		defer close(ch)
+		defer op.leave()
+
+		var seen int64
+		for {
+			op.mu.Lock()
+			for op.seq == seen && !op.done && ctx.Err() == nil {
+				op.cond.Wait()
+			}
+
+			var pending []any
+			for _, r := range op.responses {
+				if r.seq > seen {
+					pending = append(pending, r.val)
+				}
+			}
+
+			seen = op.seq
+			done := op.done
+			op.mu.Unlock()
+
+			for _, val := range pending {
+				select {
+				case ch <- val:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if ctx.Err() != nil || (done && len(pending) == 0) {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// leave cancels the operation once every request has left, unless one of them asked for it to be kept
+func (op *operation) leave() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.subscribers--
+	if op.subscribers == 0 && !op.keep && !op.done {
+		op.canceled = true
+		op.cancel()
+	}
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+	"github.com/jmorganca/ollama/testutil"
+)
+
+func operationContext(ctx context.Context, key string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/pull", nil).WithContext(ctx)
+	if key != "" {
+		c.Request.Header.Set("Idempotency-Key", key)
+	}
+
+	return c
+}
+
+func collect(ch chan any) []any {
+	var got []any
+	for val := range ch {
+		got = append(got, val)
+	}
+
+	return got
+}
+
+func TestOperationJoin(t *testing.T) {
+	var r operationRegistry
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	run := func(ctx context.Context, send func(any)) {
+		runs.Add(1)
+		send(api.ProgressResponse{Status: "pulling manifest"})
+		<-release
+		send(api.ProgressResponse{Status: "success"})
+	}
+
+	first, err := r.Join(operationContext(context.Background(), ""), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+
+	// the second pull of the same model joins the first
+	second, err := r.Join(operationContext(context.Background(), ""), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+
+	close(release)
+
+	want := []any{api.ProgressResponse{Status: "pulling manifest"}, api.ProgressResponse{Status: "success"}}
+	assert.Equal(t, want, collect(first))
+	assert.Equal(t, want, collect(second))
+	assert.Equal(t, int32(1), runs.Load())
+}
+
+func TestOperationProgress(t *testing.T) {
+	var r operationRegistry
+
+	published := make(chan struct{})
+	release := make(chan struct{})
+	run := func(ctx context.Context, send func(any)) {
+		send(api.ProgressResponse{Status: "pulling manifest"})
+		for i := int64(1); i <= 10; i++ {
+			send(api.ProgressResponse{Status: "pulling abc", Digest: "sha256:abc", Total: 10, Completed: i})
+		}
+
+		close(published)
+		<-release
+		send(api.ProgressResponse{Status: "success"})
+	}
+
+	_, err := r.Join(operationContext(context.Background(), ""), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+	<-published
+
+	// a request joining late gets the latest progress of each step
+	ch, err := r.Join(operationContext(context.Background(), ""), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+
+	assert.Equal(t, api.ProgressResponse{Status: "pulling manifest"}, <-ch)
+	assert.Equal(t, api.ProgressResponse{Status: "pulling abc", Digest: "sha256:abc", Total: 10, Completed: 10}, <-ch)
+
+	close(release)
+	assert.Equal(t, []any{api.ProgressResponse{Status: "success"}}, collect(ch))
+}
+
+func TestOperationIdempotencyKey(t *testing.T) {
+	var r operationRegistry
+
+	var runs atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	run := func(ctx context.Context, send func(any)) {
+		runs.Add(1)
+		close(started)
+		select {
+		case <-release:
+			send(api.ProgressResponse{Status: "success"})
+		case <-ctx.Done():
+			send(gin.H{"error": ctx.Err().Error()})
+		}
+	}
+
+	// the client drops its connection, the pull carries on for its retry
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := r.Join(operationContext(ctx, "abc"), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+
+	<-started
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	ch, err := r.Join(operationContext(context.Background(), "abc"), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+	assert.Equal(t, []any{api.ProgressResponse{Status: "success"}}, collect(ch))
+
+	// once finished, a retry gets the result without pulling again
+	ch, err = r.Join(operationContext(context.Background(), "abc"), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+	assert.Equal(t, []any{api.ProgressResponse{Status: "success"}}, collect(ch))
+	assert.Equal(t, int32(1), runs.Load())
+
+	_, err = r.Join(operationContext(context.Background(), "abc"), fingerprint("pull", "mistral"), run)
+	assert.ErrorIs(t, err, errIdempotencyKeyReused)
+}
+
+func TestOperationRetryFailed(t *testing.T) {
+	var r operationRegistry
+
+	var runs atomic.Int32
+	run := func(ctx context.Context, send func(any)) {
+		if runs.Add(1) == 1 {
+			send(gin.H{"error": "connection reset"})
+			return
+		}
+
+		send(api.ProgressResponse{Status: "success"})
+	}
+
+	ch, err := r.Join(operationContext(context.Background(), "abc"), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+	assert.Equal(t, []any{gin.H{"error": "connection reset"}}, collect(ch))
+
+	// a failed pull is tried again
+	ch, err = r.Join(operationContext(context.Background(), "abc"), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+	assert.Equal(t, []any{api.ProgressResponse{Status: "success"}}, collect(ch))
+	assert.Equal(t, int32(2), runs.Load())
+}
+
+func TestOperationCancel(t *testing.T) {
+	var r operationRegistry
+
+	canceled := make(chan error, 1)
+	run := func(ctx context.Context, send func(any)) {
+		<-ctx.Done()
+		canceled <- ctx.Err()
+	}
+
+	// without an Idempotency-Key the operation stops when its only client leaves
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := r.Join(operationContext(ctx, ""), fingerprint("pull", "llama2"), run)
+	require.NoError(t, err)
+
+	cancel()
+	collect(ch)
+
+	select {
+	case err := <-canceled:
+		assert.True(t, errors.Is(err, context.Canceled))
+	case <-time.After(time.Second):
+		t.Fatal("operation wasn't canceled")
+	}
+}
+
+func TestPullJoin(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+
+	// hold the manifest until both clients are pulling
+	origin := testutil.NewRegistry(t.TempDir())
+	release := make(chan struct{})
+	var manifests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") {
+			manifests.Add(1)
+			<-release
+		}
+
+		origin.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	name := host + "/library/echo:latest"
+	require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+	require.NoError(t, PushModel(context.TODO(), name, &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {}))
+	manifests.Store(0)
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	r := gin.New()
+	r.POST("/api/pull", PullModelHandler)
+	router := httptest.NewServer(r)
+	t.Cleanup(router.Close)
+
+	pull := func(name string) string {
+		resp, err := http.Post(router.URL+"/api/pull", "application/json", strings.NewReader(fmt.Sprintf(`{"name": %q, "insecure": true}`, name)))
+		if err != nil {
+			return err.Error()
+		}
+		defer resp.Body.Close()
+
+		var last api.ProgressResponse
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			last = api.ProgressResponse{}
+			if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+				return err.Error()
+			}
+		}
+
+		return last.Status
+	}
+
+	results := make(chan string, 2)
+	go func() { results <- pull(host + "/library/echo") }()
+	go func() { results <- pull(name) }()
+
+	// the second client joins the first instead of failing on the locked store
+	require.Eventually(t, func() bool {
+		operations.mu.Lock()
+		defer operations.mu.Unlock()
+
+		for _, op := range operations.running {
+			op.mu.Lock()
+			subscribers := op.subscribers
+			op.mu.Unlock()
+
+			if subscribers == 2 {
+				return true
+			}
+		}
+
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(release)
+	assert.Equal(t, "success", <-results)
+	assert.Equal(t, "success", <-results)
+	assert.Equal(t, int32(1), manifests.Load())
+
+	_, err = GetModel(name)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+const (
+	maxImagesPerRequest = 4
+
+	// maxImageSteps and maxImageSize bound how long an image takes and how much memory it needs
+	maxImageSteps = 150
+	maxImageSize  = 2048
+)
+
+func parseImageSize(size string) (int, int, error) {
+	if size == "" {
+		return 512, 512, nil
+	}
+
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid size %q, expected WIDTHxHEIGHT", size)
+	}
+
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 || width > maxImageSize || width%64 != 0 {
+		return 0, 0, fmt.Errorf("invalid width %q, must be a multiple of 64 up to %d", w, maxImageSize)
+	}
+
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 || height > maxImageSize || height%64 != 0 {
+		return 0, 0, fmt.Errorf("invalid height %q, must be a multiple of 64 up to %d", h, maxImageSize)
+	}
+
+	return width, height, nil
+}
+
+// ImageGenerationHandler implements the OpenAI compatible /v1/images/generations endpoint
+func ImageGenerationHandler(c *gin.Context) {
+	var req api.ImageGenerateRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case req.Model == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	case req.Prompt == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "prompt is required"})
+		return
+	case req.N < 0 || req.N > maxImagesPerRequest:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("n must be between 1 and %d", maxImagesPerRequest)})
+		return
+	case req.Steps < 0 || req.Steps > maxImageSteps:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("steps must be between 1 and %d", maxImageSteps)})
+		return
+	case req.CFGScale < 0:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "cfg_scale must not be negative"})
+		return
+	case req.ResponseFormat != "" && req.ResponseFormat != "b64_json":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "response_format must be b64_json"})
+		return
+	}
+
+	width, height, err := parseImageSize(req.Size)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	model, err := GetModel(req.Model)
+	if err != nil {
+		var pErr *fs.PathError
+		if errors.As(err, &pErr) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if model.Config.ModelFamily != "stable-diffusion" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model '%s' is not an image generation model", req.Model)})
+		return
+	}
+
+	n := req.N
+	if n == 0 {
+		n = 1
+	}
+
+	seed := rand.Int63n(1 << 31)
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	// the stable diffusion runner needs the memory of the loaded model, so it takes its turn with the other
+	// loads and unloads the model first
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+	unload()
+
+	resp := api.ImageGenerateResponse{Created: time.Now().Unix()}
+	for i := 0; i < n; i++ {
+		opts := llm.ImageGenerateOpts{
+			Prompt:         req.Prompt,
+			NegativePrompt: req.NegativePrompt,
+			Width:          width,
+			Height:         height,
+			Steps:          req.Steps,
+			CFGScale:       req.CFGScale,
+			Seed:           seed + int64(i),
+		}
+
+		png, err := llm.GenerateImage(c.Request.Context(), c.GetString("workDir"), model.ModelPath, opts)
+		if err != nil {
+			log.Printf("image generation failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp.Data = append(resp.Data, api.GeneratedImage{
+			B64JSON: base64.StdEncoding.EncodeToString(png),
+			Seed:    opts.Seed,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+func TestParseImageSize(t *testing.T) {
+	width, height, err := parseImageSize("")
+	require.NoError(t, err)
+	assert.Equal(t, []int{512, 512}, []int{width, height})
+
+	width, height, err = parseImageSize("768x512")
+	require.NoError(t, err)
+	assert.Equal(t, []int{768, 512}, []int{width, height})
+
+	for _, size := range []string{"512", "500x512", "512x0", "4096x512", "axb"} {
+		_, _, err := parseImageSize(size)
+		assert.Error(t, err, size)
+	}
+}
+
+func TestImageGeneration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake stable diffusion runner is a shell script")
+	}
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	// a safetensors file with only the header, which names a UNet tensor
+	weights := filepath.Join(t.TempDir(), "model.safetensors")
+	tensors := `{"model.diffusion_model.out.0.weight": {"dtype": "F16", "shape": [0], "data_offsets": [0, 0]}}`
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, uint64(len(tensors)))
+	header.WriteString(tensors)
+	require.NoError(t, os.WriteFile(weights, header.Bytes(), 0o644))
+
+	for _, m := range []struct{ name, modelfile string }{
+		{"sd", "FROM " + weights},
+		{"echo", "FROM mock://echo"},
+	} {
+		commands, err := parser.Parse(strings.NewReader(m.modelfile))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), m.name, "", commands, func(api.ProgressResponse) {}))
+	}
+
+	// the runner writes its arguments as the image
+	runner := filepath.Join(t.TempDir(), "sd")
+	require.NoError(t, os.WriteFile(runner, []byte(`#!/bin/sh
+args="$*"
+while [ $# -gt 0 ]; do
+	if [ "$1" = "--output" ]; then printf '%s' "$args" > "$2"; fi
+	shift
+done
+`), 0o755))
+	t.Setenv("OLLAMA_SD_RUNNER", runner)
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(path, body string) *http.Response {
+		resp, err := srv.Client().Post(srv.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post("/api/generate", `{"model": "echo", "prompt": "hi", "stream": false}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = post("/v1/images/generations", `{"model": "sd", "prompt": "a llama", "n": 2, "size": "768x512", "steps": 20, "seed": 7}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var images api.ImageGenerateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&images))
+	require.Len(t, images.Data, 2)
+	for i, image := range images.Data {
+		assert.Equal(t, int64(7+i), image.Seed)
+
+		args, err := base64.StdEncoding.DecodeString(image.B64JSON)
+		require.NoError(t, err)
+		assert.Contains(t, string(args), "--prompt a llama")
+		assert.Contains(t, string(args), "--width 768 --height 512 --steps 20")
+	}
+
+	// the loaded model makes room for the runner
+	loaded.mu.Lock()
+	assert.Nil(t, loaded.runner)
+	loaded.mu.Unlock()
+
+	cases := map[string]struct {
+		body   string
+		status int
+		err    string
+	}{
+		"no model":        {`{"prompt": "a llama"}`, http.StatusBadRequest, "model is required"},
+		"no prompt":       {`{"model": "sd"}`, http.StatusBadRequest, "prompt is required"},
+		"too many images": {`{"model": "sd", "prompt": "a llama", "n": 5}`, http.StatusBadRequest, "n must be between 1 and 4"},
+		"too many steps":  {`{"model": "sd", "prompt": "a llama", "steps": 151}`, http.StatusBadRequest, "steps must be between 1 and 150"},
+		"negative scale":  {`{"model": "sd", "prompt": "a llama", "cfg_scale": -1}`, http.StatusBadRequest, "cfg_scale must not be negative"},
+		"too large":       {`{"model": "sd", "prompt": "a llama", "size": "4096x4096"}`, http.StatusBadRequest, "invalid width"},
+		"url format":      {`{"model": "sd", "prompt": "a llama", "response_format": "url"}`, http.StatusBadRequest, "response_format must be b64_json"},
+		"missing model":   {`{"model": "missing", "prompt": "a llama"}`, http.StatusNotFound, "model 'missing' not found"},
+		"text model":      {`{"model": "echo", "prompt": "a llama"}`, http.StatusBadRequest, "not an image generation model"},
+	}
+
+	for name, tt := range cases {
+		resp := post("/v1/images/generations", tt.body)
+		assert.Equal(t, tt.status, resp.StatusCode, name)
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body), name)
+		assert.Contains(t, body["error"], tt.err, name)
+	}
+
+	t.Setenv("OLLAMA_SD_RUNNER", filepath.Join(t.TempDir(), "missing"))
+	resp = post("/v1/images/generations", `{"model": "sd", "prompt": "a llama"}`)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
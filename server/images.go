@@ -32,6 +32,9 @@ type RegistryOptions struct {
 	Username string
 	Password string
 	Token    string
+
+	// AcceptLicense accepts the model's license when $OLLAMA_LICENSE_ACCEPTANCE is set
+	AcceptLicense bool
 }
 
 type Model struct {
@@ -42,9 +45,11 @@ type Model struct {
 	OriginalModel  string
 	AdapterPaths   []string
 	ProjectorPaths []string
+	EnginePath     string
 	Template       string
 	System         string
 	License        []string
+	Labels         map[string]string
 	Digest         string
 	Size           int64
 	Options        map[string]interface{}
@@ -146,6 +151,9 @@ type ManifestV2 struct {
 	MediaType     string   `json:"mediaType"`
 	Config        *Layer   `json:"config"`
 	Layers        []*Layer `json:"layers"`
+
+	// Annotations are the labels set with LABEL in the Modelfile
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type ConfigV2 struct {
@@ -232,6 +240,32 @@ func GetManifest(mp ModelPath) (*ManifestV2, string, error) {
 	return manifest, shaStr, nil
 }
 
+// modelLayers lists the config and layers of the model's manifest with the registry each came from
+func modelLayers(mp ModelPath) ([]api.LayerResponse, error) {
+	manifest, _, err := GetManifest(mp)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]api.LayerResponse, 0, len(manifest.Layers)+1)
+	for _, layer := range append([]*Layer{manifest.Config}, manifest.Layers...) {
+		registry := mp.Registry
+		if layer.From != "" {
+			registry = ParseModelPath(layer.From).Registry
+		}
+
+		layers = append(layers, api.LayerResponse{
+			MediaType: layer.MediaType,
+			Digest:    layer.Digest,
+			Size:      layer.Size,
+			Registry:  registry,
+			From:      layer.From,
+		})
+	}
+
+	return layers, nil
+}
+
 func GetModel(name string) (*Model, error) {
 	mp := ParseModelPath(name)
 	manifest, digest, err := GetManifest(mp)
@@ -245,6 +279,7 @@ func GetModel(name string) (*Model, error) {
 		Digest:    digest,
 		Template:  "{{ .Prompt }}",
 		License:   []string{},
+		Labels:    manifest.Annotations,
 		Size:      manifest.GetTotalSize(),
 	}
 
@@ -277,10 +312,14 @@ func GetModel(name string) (*Model, error) {
 			// Deprecated in versions  > 0.1.2
 			// TODO: remove this warning in a future version
 			log.Print("WARNING: model contains embeddings, but embeddings in modelfiles have been deprecated and will be ignored.")
+		case "application/vnd.ollama.image.diffusion":
+			model.ModelPath = filename
 		case "application/vnd.ollama.image.adapter":
 			model.AdapterPaths = append(model.AdapterPaths, filename)
 		case "application/vnd.ollama.image.projector":
 			model.ProjectorPaths = append(model.ProjectorPaths, filename)
+		case "application/vnd.ollama.image.tensorrt":
+			model.EnginePath = filename
 		case "application/vnd.ollama.image.template":
 			bts, err := os.ReadFile(filename)
 			if err != nil {
@@ -365,6 +404,7 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 
 	params := make(map[string][]string)
 	fromParams := make(map[string]any)
+	labels := make(map[string]string)
 
 	for _, c := range commands {
 		log.Printf("[%s] - %s", c.Name, c.Args)
@@ -372,8 +412,42 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 
 		switch c.Name {
 		case "model":
+			if isModelURL(c.Args) {
+				digest, err := downloadURL(ctx, c.Args, fn)
+				if err != nil {
+					return err
+				}
+
+				c.Args = "@" + digest
+			}
+
+			if mode, ok := strings.CutPrefix(c.Args, "mock://"); ok {
+				fn(api.ProgressResponse{Status: "creating mock model layer"})
+
+				bin, err := llm.MockModel(mode)
+				if err != nil {
+					return err
+				}
+
+				config.SetModelFormat("mock")
+				config.SetModelFamily("mock")
+
+				layer, err := NewLayer(bin, mediatype)
+				if err != nil {
+					return err
+				}
+
+				layers.Add(layer)
+				continue
+			}
+
+			// a model already in the blob store is used as it is instead of being written again
+			var blobDigest string
 			if strings.HasPrefix(c.Args, "@") {
-				blobPath, err := GetBlobsPath(strings.TrimPrefix(c.Args, "@"))
+				blobDigest = strings.TrimPrefix(c.Args, "@")
+				store.Pin(ctx, blobDigest)
+
+				blobPath, err := GetBlobsPath(blobDigest)
 				if err != nil {
 					return err
 				}
@@ -387,6 +461,8 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 				modelpath := ParseModelPath(c.Args)
 				manifest, _, err := GetManifest(modelpath)
 				switch {
+				case errors.Is(err, os.ErrNotExist) && offline():
+					return fmt.Errorf("%s not found: %w", c.Args, errOffline)
 				case errors.Is(err, os.ErrNotExist):
 					fn(api.ProgressResponse{Status: "pulling model"})
 					if err := PullModel(ctx, c.Args, &RegistryOptions{}, fn); err != nil {
@@ -401,6 +477,11 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 					return err
 				}
 
+				store.Pin(ctx, manifest.Config.Digest)
+				for _, layer := range manifest.Layers {
+					store.Pin(ctx, layer.Digest)
+				}
+
 				fn(api.ProgressResponse{Status: "reading model metadata"})
 				fromConfigPath, err := GetBlobsPath(manifest.Config.Digest)
 				if err != nil {
@@ -418,6 +499,11 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 					return err
 				}
 
+				// labels are inherited, LABEL in this Modelfile changes or removes them
+				for k, v := range manifest.Annotations {
+					labels[k] = v
+				}
+
 				config.SetModelFormat(fromConfig.ModelFormat)
 				config.SetModelFamily(append(fromConfig.ModelFamilies, fromConfig.ModelFamily)...)
 				config.SetModelType(fromConfig.ModelType)
@@ -455,6 +541,50 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 			}
 			defer bin.Close()
 
+			// a backend added to this build takes the file as it is, whatever its format
+			if b := llm.Registered(bin); b != nil {
+				fn(api.ProgressResponse{Status: "creating model layer"})
+
+				config.SetModelFormat(b.Name())
+
+				layer, err := NewLayer(bin, mediatype)
+				if err != nil {
+					return err
+				}
+
+				layers.Add(layer)
+				continue
+			}
+
+			if format := llm.DiffusionFormat(bin); format != "" {
+				fn(api.ProgressResponse{Status: "creating diffusion layer"})
+
+				config.SetModelFormat(format)
+				config.SetModelFamily("stable-diffusion")
+
+				layer, err := NewLayer(bin, "application/vnd.ollama.image.diffusion")
+				if err != nil {
+					return err
+				}
+
+				layers.Add(layer)
+				continue
+			}
+
+			if llm.IsONNXModel(bin) {
+				fn(api.ProgressResponse{Status: "creating model layer"})
+
+				config.SetModelFormat("onnx")
+
+				layer, err := NewLayer(bin, mediatype)
+				if err != nil {
+					return err
+				}
+
+				layers.Add(layer)
+				continue
+			}
+
 			var offset int64
 			for {
 				fn(api.ProgressResponse{Status: "creating model layer"})
@@ -477,10 +607,18 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 					mediatype = "application/vnd.ollama.image.projector"
 				}
 
-				sr := io.NewSectionReader(bin, offset, ggml.Size)
-				layer, err := NewLayer(sr, mediatype)
-				if err != nil {
-					return err
+				var layer *Layer
+				if fi, err := bin.Stat(); err == nil && blobDigest != "" && offset == 0 && ggml.Size == fi.Size() {
+					layer, err = NewLayerFromLayer(blobDigest, mediatype, "")
+					if err != nil {
+						return err
+					}
+				} else {
+					sr := io.NewSectionReader(bin, offset, ggml.Size)
+					layer, err = NewLayer(sr, mediatype)
+					if err != nil {
+						return err
+					}
 				}
 
 				layers.Add(layer)
@@ -510,6 +648,37 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 			}
 
 			layers.Add(layer)
+		case "engine":
+			if strings.HasPrefix(c.Args, "@") {
+				blobPath, err := GetBlobsPath(strings.TrimPrefix(c.Args, "@"))
+				if err != nil {
+					return err
+				}
+
+				c.Args = blobPath
+			}
+
+			fn(api.ProgressResponse{Status: "creating engine layer"})
+			bin, err := os.Open(realpath(modelFileDir, c.Args))
+			if err != nil {
+				return err
+			}
+			defer bin.Close()
+
+			if !llm.IsTensorRTEngine(bin) {
+				return fmt.Errorf("%s is not a TensorRT-LLM engine, expected a tar of the engine directory", c.Args)
+			}
+
+			if _, err := bin.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+
+			layer, err := NewLayer(bin, "application/vnd.ollama.image.tensorrt")
+			if err != nil {
+				return err
+			}
+
+			layers.Replace(layer)
 		case "license":
 			fn(api.ProgressResponse{Status: "creating license layer"})
 
@@ -520,6 +689,14 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 			}
 
 			layers.Add(layer)
+		case "label":
+			k, v, _ := strings.Cut(c.Args, "=")
+			if v == "" {
+				delete(labels, k)
+				continue
+			}
+
+			labels[k] = v
 		case "template", "system":
 			fn(api.ProgressResponse{Status: fmt.Sprintf("creating %s layer", c.Name)})
 
@@ -590,6 +767,8 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 	delete(deleteMap, configLayer.Digest)
 
 	for _, layer := range append(layers.items, configLayer) {
+		store.Pin(ctx, layer.Digest)
+
 		committed, err := layer.Commit()
 		if err != nil {
 			return err
@@ -606,7 +785,7 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 	}
 
 	fn(api.ProgressResponse{Status: "writing manifest"})
-	if err := WriteManifest(name, configLayer, layers.items); err != nil {
+	if err := WriteManifest(name, configLayer, layers.items, labels); err != nil {
 		return err
 	}
 
@@ -620,7 +799,7 @@ func CreateModel(ctx context.Context, name, modelFileDir string, commands []pars
 	return nil
 }
 
-func CopyModel(src, dest string) error {
+func CopyModel(ctx context.Context, src, dest string) error {
 	srcModelPath := ParseModelPath(src)
 	srcPath, err := srcModelPath.GetManifestPath()
 	if err != nil {
@@ -643,7 +822,26 @@ func CopyModel(src, dest string) error {
 		return err
 	}
 
-	err = os.WriteFile(destPath, input, 0o644)
+	// the blobs are pinned before checking the source is still there, so a purge of it either kept them
+	// or fails the copy
+	var manifest ManifestV2
+	if err := json.Unmarshal(input, &manifest); err != nil {
+		return err
+	}
+
+	if manifest.Config != nil {
+		store.Pin(ctx, manifest.Config.Digest)
+	}
+
+	for _, layer := range manifest.Layers {
+		store.Pin(ctx, layer.Digest)
+	}
+
+	if _, err := os.Stat(srcPath); err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(destPath, input)
 	if err != nil {
 		fmt.Println("Error reading file:", err)
 		return err
@@ -691,6 +889,24 @@ func deleteUnusedLayers(skipModelPath *ModelPath, deleteMap map[string]struct{},
 		return err
 	}
 
+	// models in the trash keep their layers until they are purged
+	err = walkTrash(func(path string, _ ModelPath, _ os.FileInfo) error {
+		manifest, _, err := readManifestFile(path)
+		if err != nil {
+			return nil
+		}
+
+		for _, layer := range manifest.Layers {
+			delete(deleteMap, layer.Digest)
+		}
+
+		delete(deleteMap, manifest.Config.Digest)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	// only delete the files which are still in the deleteMap
 	for k := range deleteMap {
 		fp, err := GetBlobsPath(k)
@@ -699,7 +915,7 @@ func deleteUnusedLayers(skipModelPath *ModelPath, deleteMap map[string]struct{},
 			continue
 		}
 		if !dryRun {
-			if err := os.Remove(fp); err != nil {
+			if err := store.removeBlob(k, fp); err != nil {
 				log.Printf("couldn't remove file '%s': %v", fp, err)
 				continue
 			}
@@ -779,35 +995,20 @@ func PruneDirectory(path string) error {
 	return nil
 }
 
+// DeleteModel moves a model to the trash, where it can be restored until it is purged, or deletes it and its
+// layers straight away when the trash is disabled
 func DeleteModel(name string) error {
 	mp := ParseModelPath(name)
-	manifest, _, err := GetManifest(mp)
-	if err != nil {
-		return err
-	}
-
-	deleteMap := make(map[string]struct{})
-	for _, layer := range manifest.Layers {
-		deleteMap[layer.Digest] = struct{}{}
-	}
-	deleteMap[manifest.Config.Digest] = struct{}{}
-
-	err = deleteUnusedLayers(&mp, deleteMap, false)
-	if err != nil {
-		return err
+	if trashRetention > 0 {
+		return trashModel(mp)
 	}
 
 	fp, err := mp.GetManifestPath()
 	if err != nil {
 		return err
 	}
-	err = os.Remove(fp)
-	if err != nil {
-		log.Printf("couldn't remove manifest file '%s': %v", fp, err)
-		return err
-	}
 
-	return nil
+	return purgeManifest(fp)
 }
 
 func ShowModelfile(model *Model) (string, error) {
@@ -849,6 +1050,14 @@ SYSTEM """{{ .System }}"""
 ADAPTER {{ $adapter }}
 {{- end }}
 
+{{- if .EnginePath }}
+ENGINE {{ .EnginePath }}
+{{- end }}
+
+{{- range $k, $v := .Labels }}
+LABEL {{ $k }}={{ printf "%q" $v }}
+{{- end }}
+
 {{- range $k, $v := .Parameters }}
 {{- range $parameter := $v }}
 PARAMETER {{ $k }} {{ printf "%#v" $parameter }}
@@ -872,6 +1081,10 @@ PARAMETER {{ $k }} {{ printf "%#v" $parameter }}
 }
 
 func PushModel(ctx context.Context, name string, regOpts *RegistryOptions, fn func(api.ProgressResponse)) error {
+	if offline() {
+		return errOffline
+	}
+
 	mp := ParseModelPath(name)
 	fn(api.ProgressResponse{Status: "retrieving manifest"})
 
@@ -922,7 +1135,14 @@ func PushModel(ctx context.Context, name string, regOpts *RegistryOptions, fn fu
 }
 
 func PullModel(ctx context.Context, name string, regOpts *RegistryOptions, fn func(api.ProgressResponse)) error {
+	if offline() {
+		return errOffline
+	}
+
 	mp := ParseModelPath(name)
+	if isHuggingFace(mp) {
+		return pullHuggingFace(ctx, name, mp, regOpts, fn)
+	}
 
 	var manifest *ManifestV2
 	var err error
@@ -956,6 +1176,16 @@ func PullModel(ctx context.Context, name string, regOpts *RegistryOptions, fn fu
 		return fmt.Errorf("pull model manifest: %s", err)
 	}
 
+	// blobs already here are kept while the others download
+	store.Pin(ctx, manifest.Config.Digest)
+	for _, layer := range manifest.Layers {
+		store.Pin(ctx, layer.Digest)
+	}
+
+	if err := checkLicenses(ctx, mp, manifest, regOpts, fn); err != nil {
+		return err
+	}
+
 	var layers []*Layer
 	layers = append(layers, manifest.Layers...)
 	layers = append(layers, manifest.Config)
@@ -1008,7 +1238,7 @@ func PullModel(ctx context.Context, name string, regOpts *RegistryOptions, fn fu
 		return err
 	}
 
-	err = os.WriteFile(fp, manifestJSON, 0o644)
+	err = writeFileAtomic(fp, manifestJSON)
 	if err != nil {
 		log.Printf("couldn't write to %s", fp)
 		return err
@@ -1028,11 +1258,14 @@ func PullModel(ctx context.Context, name string, regOpts *RegistryOptions, fn fu
 }
 
 func pullModelManifest(ctx context.Context, mp ModelPath, regOpts *RegistryOptions) (*ManifestV2, error) {
-	requestURL := mp.BaseURL().JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
-
 	headers := make(http.Header)
 	headers.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	resp, err := makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers, nil, regOpts)
+
+	// the manifest is pulled from the first mirror of the registry which has it
+	resp, _, err := fetch(ctx, registries.endpoints(mp), 0, func(ctx context.Context, base *url.URL) (*http.Response, error) {
+		requestURL := base.JoinPath("v2", mp.GetNamespaceRepository(), "manifests", mp.Tag)
+		return makeRequestWithRetry(ctx, http.MethodGet, requestURL, headers.Clone(), nil, regOpts)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -1106,6 +1339,10 @@ func makeRequestWithRetry(ctx context.Context, method string, requestURL *url.UR
 }
 
 func makeRequest(ctx context.Context, method string, requestURL *url.URL, headers http.Header, body io.Reader, regOpts *RegistryOptions) (*http.Response, error) {
+	if offline() {
+		return nil, errOffline
+	}
+
 	if requestURL.Scheme != "http" && regOpts != nil && regOpts.Insecure {
 		requestURL.Scheme = "http"
 	}
@@ -1,10 +1,23 @@
 package server
 
 import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+	"github.com/jmorganca/ollama/testutil"
 )
 
 func TestChat(t *testing.T) {
@@ -96,3 +109,146 @@ func TestChat(t *testing.T) {
 		})
 	}
 }
+
+func TestPushPullRegistry(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nSYSTEM hello"))
+	require.NoError(t, err)
+
+	origin := testutil.NewRegistry(t.TempDir())
+	name := origin.Start(t) + "/library/echo:latest"
+	require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+
+	regOpts := &RegistryOptions{Insecure: true}
+	require.NoError(t, PushModel(context.TODO(), name, regOpts, func(api.ProgressResponse) {}))
+
+	pushed, err := GetModel(name)
+	require.NoError(t, err)
+
+	// record pulling the model from the origin, then replay it once the origin is gone. Blobs already on
+	// disk aren't pulled, so each pull starts from an empty models directory.
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	recording := t.TempDir()
+	recorder := testutil.NewRecorder(recording, "http://"+ParseModelPath(name).Registry)
+	recorded := recorder.Start(t) + "/library/echo:latest"
+	require.NoError(t, PullModel(context.TODO(), recorded, regOpts, func(api.ProgressResponse) {}))
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	replayed := testutil.NewRegistry(recording).Start(t) + "/library/echo:latest"
+	require.NoError(t, PullModel(context.TODO(), replayed, regOpts, func(api.ProgressResponse) {}))
+
+	pulled, err := GetModel(replayed)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Base(pushed.ModelPath), filepath.Base(pulled.ModelPath))
+	assert.Equal(t, pushed.Config, pulled.Config)
+	assert.Equal(t, "hello", pulled.System)
+
+	bts, err := os.ReadFile(pulled.ModelPath)
+	require.NoError(t, err)
+	assert.Equal(t, "ollama-mock echo\n", string(bts))
+
+	_, err = os.Stat(filepath.Join(recording, "manifests", "library", "echo", "latest"))
+	assert.NoError(t, err)
+
+	missing := testutil.NewRegistry(recording).Start(t) + "/library/missing:latest"
+	assert.Error(t, PullModel(context.TODO(), missing, regOpts, func(api.ProgressResponse) {}))
+}
+
+func TestCreateEngine(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_TENSORRT_RUNNER", filepath.Join(t.TempDir(), "missing"))
+
+	dir := t.TempDir()
+	engine := filepath.Join(dir, "engine.tar")
+	f, err := os.Create(engine)
+	require.NoError(t, err)
+
+	tw := tar.NewWriter(f)
+	for name, content := range map[string]string{"config.json": "{}", "rank0.engine": "engine"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	notEngine := filepath.Join(dir, "weights.bin")
+	require.NoError(t, os.WriteFile(notEngine, []byte("weights"), 0o644))
+
+	create := func(modelfile string) error {
+		commands, err := parser.Parse(strings.NewReader(modelfile))
+		require.NoError(t, err)
+		return CreateModel(context.TODO(), "engine", "", commands, func(api.ProgressResponse) {})
+	}
+
+	assert.ErrorContains(t, create("FROM mock://echo\nENGINE "+notEngine), "not a TensorRT-LLM engine")
+	require.NoError(t, create("FROM mock://echo\nENGINE "+engine))
+
+	model, err := GetModel("engine")
+	require.NoError(t, err)
+	require.NotEmpty(t, model.EnginePath)
+
+	// without a runner for the engine, the model's weights are loaded instead
+	runner, err := newRunner(t.TempDir(), model, api.DefaultOptions(), nil)
+	require.NoError(t, err)
+	defer runner.Close()
+	assert.Equal(t, "mock", runner.Placement().Runner)
+}
+
+func TestCreateLabels(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	create := func(name, modelfile string) {
+		commands, err := parser.Parse(strings.NewReader(modelfile))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+	}
+
+	create("base", "FROM mock://echo\nLABEL team=nlp\nLABEL stage=\"dev build\"")
+
+	model, err := GetModel("base")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "nlp", "stage": "dev build"}, model.Labels)
+
+	// labels are inherited, changed or removed with an empty value
+	create("tuned", "FROM base\nLABEL stage=prod\nLABEL team=")
+
+	model, err = GetModel("tuned")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"stage": "prod"}, model.Labels)
+
+	mf, err := ShowModelfile(model)
+	require.NoError(t, err)
+	assert.Contains(t, mf, "LABEL stage=\"prod\"")
+
+	show, err := GetModelInfo("tuned")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"stage": "prod"}, show.Labels)
+
+	create("unlabeled", "FROM mock://echo")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/tags", nil)
+	ListModelsHandler(c)
+
+	var list api.ListResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+
+	labels := make(map[string]map[string]string)
+	for _, m := range list.Models {
+		labels[m.Name] = m.Labels
+	}
+
+	assert.Equal(t, map[string]map[string]string{
+		"base:latest":      {"team": "nlp", "stage": "dev build"},
+		"tuned:latest":     {"stage": "prod"},
+		"unlabeled:latest": nil,
+	}, labels)
+
+	_, err = parser.Parse(strings.NewReader("FROM mock://echo\nLABEL team"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+// ImportSources are the tools whose model caches can be imported
+var ImportSources = []string{"llama.cpp", "lmstudio", "gpt4all"}
+
+// ImportedModel is a GGUF file found in another tool's cache and the Modelfile generated for it
+type ImportedModel struct {
+	Name      string
+	Path      string
+	Modelfile string
+}
+
+// ImportSourceDir returns where the tool keeps its models by default, llama.cpp has no such place
+func ImportSourceDir(from string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	switch from {
+	case "lmstudio":
+		candidates = []string{
+			filepath.Join(home, ".cache", "lm-studio", "models"),
+			filepath.Join(home, ".lmstudio", "models"),
+		}
+	case "gpt4all":
+		switch runtime.GOOS {
+		case "darwin":
+			candidates = []string{filepath.Join(home, "Library", "Application Support", "nomic.ai", "GPT4All")}
+		case "windows":
+			candidates = []string{filepath.Join(os.Getenv("LOCALAPPDATA"), "nomic.ai", "GPT4All")}
+		default:
+			candidates = []string{filepath.Join(home, ".local", "share", "nomic.ai", "GPT4All")}
+		}
+	case "llama.cpp":
+		return "", errors.New("llama.cpp has no default model directory, pass the path to your models")
+	default:
+		return "", fmt.Errorf("unknown source '%s', use one of %s", from, strings.Join(ImportSources, ", "))
+	}
+
+	for _, dir := range candidates {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+
+	return "", fmt.Errorf("no %s models found in %s", from, strings.Join(candidates, " or "))
+}
+
+// FindImports finds the GGUF files under path, which may also be a single file
+func FindImports(path string) ([]ImportedModel, error) {
+	var models []ImportedModel
+	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.ToLower(d.Name())
+		if d.IsDir() || filepath.Ext(name) != ".gguf" {
+			return nil
+		}
+
+		// projectors for multimodal models are not models of their own
+		if strings.HasPrefix(name, "mmproj") {
+			return nil
+		}
+
+		modelName := importName(name)
+		models = append(models, ImportedModel{
+			Name:      modelName,
+			Path:      path,
+			Modelfile: importModelfile(modelName),
+		})
+
+		return nil
+	})
+
+	return models, err
+}
+
+var (
+	// quantizationPattern matches the quantization at the end of a file name such as mistral-7b-instruct-v0.2.Q4_K_M
+	quantizationPattern = regexp.MustCompile(`[._-]((?:i?q\d(?:_[a-z0-9]+)*)|f16|f32)$`)
+
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+)
+
+// importName names the model after its file, with the quantization as the tag
+func importName(file string) string {
+	name := strings.TrimSuffix(strings.ToLower(file), ".gguf")
+
+	tag := "latest"
+	if loc := quantizationPattern.FindStringSubmatchIndex(name); loc != nil {
+		tag = name[loc[2]:loc[3]]
+		name = name[:loc[0]]
+	}
+
+	name = strings.Trim(invalidNameChars.ReplaceAllString(name, "-"), "-.")
+	return name + ":" + tag
+}
+
+// importTemplates are the prompt templates of common model families, chosen by a word in the model's name
+var importTemplates = []struct {
+	words    []string
+	template string
+	stop     []string
+}{
+	{
+		words:    []string{"llama-2-7b-chat", "llama-2-13b-chat", "llama-2-70b-chat", "llama2-chat"},
+		template: "[INST] <<SYS>>{{ .System }}<</SYS>>\n\n{{ .Prompt }} [/INST]",
+		stop:     []string{"[INST]", "[/INST]", "<<SYS>>", "<</SYS>>"},
+	},
+	{
+		words:    []string{"mistral-7b-instruct", "mixtral-8x7b-instruct"},
+		template: "[INST] {{ .System }} {{ .Prompt }} [/INST]",
+		stop:     []string{"[INST]", "[/INST]"},
+	},
+	{
+		words:    []string{"openhermes", "nous-hermes-2", "dolphin", "qwen", "chatml"},
+		template: "<|im_start|>system\n{{ .System }}<|im_end|>\n<|im_start|>user\n{{ .Prompt }}<|im_end|>\n<|im_start|>assistant\n",
+		stop:     []string{"<|im_start|>", "<|im_end|>"},
+	},
+	{
+		words:    []string{"zephyr"},
+		template: "<|system|>\n{{ .System }}</s>\n<|user|>\n{{ .Prompt }}</s>\n<|assistant|>\n",
+		stop:     []string{"<|system|>", "<|user|>", "<|assistant|>", "</s>"},
+	},
+	{
+		words:    []string{"vicuna"},
+		template: "{{ .System }}\nUSER: {{ .Prompt }}\nASSISTANT:",
+		stop:     []string{"USER:", "ASSISTANT:"},
+	},
+}
+
+// importModelfile generates the Modelfile of an imported model, the FROM line is added when the model is imported
+func importModelfile(name string) string {
+	var sb strings.Builder
+	for _, t := range importTemplates {
+		for _, word := range t.words {
+			if !strings.Contains(name, word) {
+				continue
+			}
+
+			fmt.Fprintf(&sb, "TEMPLATE \"\"\"%s\"\"\"\n", t.template)
+			for _, stop := range t.stop {
+				fmt.Fprintf(&sb, "PARAMETER stop %q\n", stop)
+			}
+
+			return sb.String()
+		}
+	}
+
+	return ""
+}
+
+// ImportModel registers the model's file as a blob with a hard link, so it isn't copied, and creates the model
+func ImportModel(ctx context.Context, m ImportedModel, fn func(api.ProgressResponse)) error {
+	if err := store.TryLock(ctx); err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	ctx, release := store.Pins(ctx)
+	defer release()
+
+	fn(api.ProgressResponse{Status: fmt.Sprintf("hashing %s", m.Path)})
+	digest, err := fileDigest(m.Path)
+	if err != nil {
+		return err
+	}
+
+	store.Pin(ctx, digest)
+
+	blob, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(blob); errors.Is(err, os.ErrNotExist) {
+		if err := os.Link(m.Path, blob); err != nil {
+			return fmt.Errorf("couldn't link %s into the model store, the models directory must be on the same filesystem: %w", m.Path, err)
+		}
+
+		if err := syncDir(filepath.Dir(blob)); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	commands, err := parser.Parse(strings.NewReader(fmt.Sprintf("FROM @%s\n%s", digest, m.Modelfile)))
+	if err != nil {
+		return err
+	}
+
+	return CreateModel(ctx, m.Name, "", commands, fn)
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
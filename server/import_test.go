@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestImportName(t *testing.T) {
+	cases := map[string]string{
+		"mistral-7b-instruct-v0.2.Q4_K_M.gguf": "mistral-7b-instruct-v0.2:q4_k_m",
+		"llama-2-7b-chat.Q5_0.gguf":            "llama-2-7b-chat:q5_0",
+		"phi-2-IQ3_XXS.gguf":                   "phi-2:iq3_xxs",
+		"tinyllama-1.1b-f16.gguf":              "tinyllama-1.1b:f16",
+		"Nous Hermes 2 (Mistral).gguf":         "nous-hermes-2-mistral:latest",
+	}
+
+	for file, name := range cases {
+		assert.Equal(t, name, importName(file), file)
+	}
+}
+
+func TestImportModelfile(t *testing.T) {
+	assert.Equal(t, "", importModelfile("tinyllama-1.1b:f16"))
+
+	modelfile := importModelfile("mistral-7b-instruct-v0.2:q4_k_m")
+	assert.Contains(t, modelfile, "TEMPLATE \"\"\"[INST] {{ .System }} {{ .Prompt }} [/INST]\"\"\"\n")
+	assert.Contains(t, modelfile, "PARAMETER stop \"[INST]\"\n")
+}
+
+func TestFindImports(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{
+		filepath.Join("TheBloke", "zephyr-7B-beta-GGUF", "zephyr-7b-beta.Q4_K_M.gguf"),
+		filepath.Join("TheBloke", "llava-GGUF", "mmproj-model-f16.gguf"),
+		filepath.Join("TheBloke", "README.md"),
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	models, err := FindImports(dir)
+	require.NoError(t, err)
+	require.Len(t, models, 1)
+	assert.Equal(t, "zephyr-7b-beta:q4_k_m", models[0].Name)
+	assert.Equal(t, filepath.Join(dir, "TheBloke", "zephyr-7B-beta-GGUF", "zephyr-7b-beta.Q4_K_M.gguf"), models[0].Path)
+	assert.Contains(t, models[0].Modelfile, "<|assistant|>")
+}
+
+func TestImportModel(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_NOPRUNE", "1")
+
+	path := filepath.Join(t.TempDir(), "zephyr-7b-beta.Q4_K_M.gguf")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	models, err := FindImports(path)
+	require.NoError(t, err)
+	require.Len(t, models, 1)
+	require.NoError(t, ImportModel(context.TODO(), models[0], func(api.ProgressResponse) {}))
+
+	// the file is linked into the store rather than copied
+	digest, err := fileDigest(path)
+	require.NoError(t, err)
+	blob, err := GetBlobsPath(digest)
+	require.NoError(t, err)
+
+	src, err := os.Stat(path)
+	require.NoError(t, err)
+	dst, err := os.Stat(blob)
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(src, dst))
+
+	model, err := GetModel("zephyr-7b-beta:q4_k_m")
+	require.NoError(t, err)
+	assert.Contains(t, model.Template, "<|assistant|>")
+	assert.Equal(t, []interface{}{"<|system|>", "<|user|>", "<|assistant|>", "</s>"}, model.Options["stop"])
+}
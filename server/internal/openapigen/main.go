@@ -0,0 +1,24 @@
+// openapigen writes the OpenAPI document of the API to the file it is given, it is run by go generate ./server
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/jmorganca/ollama/server"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: openapigen FILE")
+	}
+
+	doc, err := server.OpenAPI()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(os.Args[1], append(doc, '\n'), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
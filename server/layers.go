@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 
@@ -65,6 +66,11 @@ func NewLayer(r io.Reader, mediatype string) (*Layer, error) {
 		return nil, err
 	}
 
+	// the blob must be on disk before it is renamed into place in Commit
+	if err := temp.Sync(); err != nil {
+		return nil, err
+	}
+
 	return &Layer{
 		MediaType:    mediatype,
 		Digest:       fmt.Sprintf("sha256:%x", sha256sum.Sum(nil)),
@@ -102,7 +108,11 @@ func (l *Layer) Commit() (bool, error) {
 	}
 
 	if _, err := os.Stat(blob); err != nil {
-		return true, os.Rename(l.tempFileName, blob)
+		if err := os.Rename(l.tempFileName, blob); err != nil {
+			return false, err
+		}
+
+		return true, syncDir(filepath.Dir(blob))
 	}
 
 	return false, nil
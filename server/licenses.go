@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+var errLicenseNotAccepted = errors.New("this model's license must be accepted before it is pulled")
+
+// permissiveLicenses are phrases which identify common permissive licenses, any other license is restrictive
+var permissiveLicenses = []string{
+	"Apache License",
+	"Permission is hereby granted, free of charge",
+	"Redistribution and use in source and binary forms",
+}
+
+// licenseAcceptance reports whether $OLLAMA_LICENSE_ACCEPTANCE is set, models with a restrictive license are
+// then only pulled once their license is accepted
+func licenseAcceptance() bool {
+	v, _ := strconv.ParseBool(os.Getenv("OLLAMA_LICENSE_ACCEPTANCE"))
+	return v
+}
+
+func restrictiveLicense(text string) bool {
+	text = strings.Join(strings.Fields(text), " ")
+	for _, phrase := range permissiveLicenses {
+		if strings.Contains(text, phrase) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// licenseTitle is the first line of a license, which is its name for most licenses
+func licenseTitle(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+
+	return ""
+}
+
+// licenseStore records the licenses accepted in licenses.json next to the models
+type licenseStore struct {
+	mu sync.Mutex
+}
+
+var licenses licenseStore
+
+func licensesPath() (string, error) {
+	dir, err := modelsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "licenses.json"), nil
+}
+
+// read returns the accepted licenses, it is up to the caller to lock s.mu
+func (s *licenseStore) read() ([]api.License, error) {
+	fp, err := licensesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		return []api.License{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var accepted []api.License
+	if err := json.Unmarshal(bts, &accepted); err != nil {
+		return nil, fmt.Errorf("%s: %w", fp, err)
+	}
+
+	return accepted, nil
+}
+
+func (s *licenseStore) List() ([]api.License, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accepted, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(accepted, func(i, j int) bool {
+		return accepted[i].AcceptedAt.Before(accepted[j].AcceptedAt)
+	})
+
+	return accepted, nil
+}
+
+func (s *licenseStore) Accepted(digest string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accepted, err := s.read()
+	if err != nil {
+		return false, err
+	}
+
+	for _, l := range accepted {
+		if l.Digest == digest {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Accept records the license with digest as accepted when model was pulled, a license accepted before keeps
+// the time it was first accepted
+func (s *licenseStore) Accept(digest, title, model string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accepted, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range accepted {
+		if l.Digest == digest {
+			return nil
+		}
+	}
+
+	accepted = append(accepted, api.License{Digest: digest, Title: title, Model: model, AcceptedAt: time.Now().UTC()})
+	bts, err := json.Marshal(accepted)
+	if err != nil {
+		return err
+	}
+
+	fp, err := licensesPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(fp, bts)
+}
+
+// checkLicenses downloads the license layers of a model being pulled and fails with the text of the first
+// restrictive license which hasn't been accepted, unless the pull accepts it, in which case it is recorded
+func checkLicenses(ctx context.Context, mp ModelPath, manifest *ManifestV2, regOpts *RegistryOptions, fn func(api.ProgressResponse)) error {
+	if !licenseAcceptance() {
+		return nil
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != "application/vnd.ollama.image.license" {
+			continue
+		}
+
+		if err := downloadBlob(ctx, downloadOpts{mp: mp, digest: layer.Digest, regOpts: regOpts, fn: fn}); err != nil {
+			return err
+		}
+
+		if err := verifyBlob(layer.Digest); err != nil {
+			return err
+		}
+
+		fp, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		bts, err := os.ReadFile(fp)
+		if err != nil {
+			return err
+		}
+
+		text := string(bts)
+		if !restrictiveLicense(text) {
+			continue
+		}
+
+		accepted, err := licenses.Accepted(layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case accepted:
+		case regOpts.AcceptLicense:
+			if err := licenses.Accept(layer.Digest, licenseTitle(text), mp.GetShortTagname()); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w, pull it again with --accept-license once you agree to it:\n\n%s", errLicenseNotAccepted, strings.TrimSpace(text))
+		}
+	}
+
+	return nil
+}
+
+func ListLicensesHandler(c *gin.Context) {
+	accepted, err := licenses.List()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ListLicensesResponse{Licenses: accepted})
+}
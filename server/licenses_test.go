@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+	"github.com/jmorganca/ollama/testutil"
+)
+
+func TestRestrictiveLicense(t *testing.T) {
+	assert.False(t, restrictiveLicense("                                 Apache License\n                           Version 2.0, January 2004"))
+	assert.False(t, restrictiveLicense("MIT License\n\nCopyright (c) 2023\n\nPermission is hereby granted, free of charge, to any person"))
+	assert.True(t, restrictiveLicense("LLAMA 2 COMMUNITY LICENSE AGREEMENT\nLlama 2 Version Release Date: July 18, 2023"))
+}
+
+func TestPullLicenseAcceptance(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nLICENSE \"\"\"\nACME MODEL LICENSE\nDon't use it for anything.\n\"\"\""))
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(testutil.NewRegistry(t.TempDir()))
+	t.Cleanup(srv.Close)
+
+	name := strings.TrimPrefix(srv.URL, "http://") + "/library/echo:latest"
+	require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+	require.NoError(t, PushModel(context.TODO(), name, &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {}))
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	t.Setenv("OLLAMA_LICENSE_ACCEPTANCE", "1")
+
+	// the license has to be accepted, the error shows it
+	err = PullModel(context.TODO(), name, &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {})
+	assert.ErrorIs(t, err, errLicenseNotAccepted)
+	assert.ErrorContains(t, err, "Don't use it for anything.")
+
+	_, err = GetModel(name)
+	assert.Error(t, err)
+
+	require.NoError(t, PullModel(context.TODO(), name, &RegistryOptions{Insecure: true, AcceptLicense: true}, func(api.ProgressResponse) {}))
+
+	accepted, err := licenses.List()
+	require.NoError(t, err)
+	require.Len(t, accepted, 1)
+	assert.Equal(t, "ACME MODEL LICENSE", accepted[0].Title)
+	assert.Equal(t, ParseModelPath(name).GetShortTagname(), accepted[0].Model)
+	assert.False(t, accepted[0].AcceptedAt.IsZero())
+
+	// once accepted, pulls don't need to accept it again
+	require.NoError(t, PullModel(context.TODO(), name, &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {}))
+
+	accepted, err = licenses.List()
+	require.NoError(t, err)
+	assert.Len(t, accepted, 1)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// Listen binds every address in hosts, which is in the format of OLLAMA_HOST. If any address can't be bound
+// the ones already bound are closed.
+func Listen(hosts string) ([]net.Listener, error) {
+	addrs, err := api.ParseHosts(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var lns []net.Listener
+	for _, addr := range addrs {
+		ln, err := listen(addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+
+			return nil, err
+		}
+
+		lns = append(lns, ln)
+	}
+
+	return lns, nil
+}
+
+func listen(addr api.Host) (net.Listener, error) {
+	if addr.Network() == "unix" {
+		if err := removeStaleSocket(addr.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen(addr.Network(), addr.Address())
+}
+
+// removeStaleSocket removes a socket left behind by a server which didn't exit cleanly, a socket a server is
+// still listening on is left alone so binding it fails
+func removeStaleSocket(path string) error {
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if fi.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not tested on windows")
+	}
+
+	dir, err := os.MkdirTemp("", "ollama-listen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// a socket left behind by a server which didn't exit cleanly is replaced
+	sock := filepath.Join(dir, "ollama.sock")
+	stale, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	lns, err := Listen("127.0.0.1:0,unix://" + sock)
+	require.NoError(t, err)
+	require.Len(t, lns, 2)
+	assert.Equal(t, "tcp", lns[0].Addr().Network())
+	assert.Equal(t, "unix", lns[1].Addr().Network())
+
+	// a socket which is in use is not
+	_, err = Listen("unix://" + sock)
+	assert.Error(t, err)
+
+	for _, ln := range lns {
+		ln.Close()
+	}
+
+	// the addresses bound before one fails are released
+	notSocket := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(notSocket, nil, 0o644))
+	_, err = Listen("unix://" + sock + ",unix://" + notSocket)
+	assert.EqualError(t, err, notSocket+" exists and is not a socket")
+
+	lns, err = Listen("unix://" + sock)
+	require.NoError(t, err)
+	lns[0].Close()
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// StoreLockedError is returned when another process is changing the model store
+type StoreLockedError struct {
+	PID int
+}
+
+func (e *StoreLockedError) Error() string {
+	if e.PID == 0 {
+		return "model store is locked by another process"
+	}
+
+	return fmt.Sprintf("model store is locked by pid %d", e.PID)
+}
+
+// storeLock is an advisory lock on the model store shared by every process using it. The operations of a
+// process share its lock, and keep the blobs they are using from being pruned by pinning them, so a long
+// pull doesn't hold up deleting or copying another model.
+type storeLock struct {
+	mu sync.Mutex
+	// holders counts the operations of this process using the lock
+	holders int
+	f       *os.File
+
+	pinMu sync.Mutex
+	pins  map[string]int
+}
+
+var store = newStoreLock()
+
+func newStoreLock() *storeLock {
+	return &storeLock{pins: make(map[string]int)}
+}
+
+func storeLockPath() (string, error) {
+	dir, err := modelsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, ".lock"), nil
+}
+
+// TryLock locks the store, sharing the lock with the other operations of this process, or returns a
+// *StoreLockedError if another process holds it
+func (l *storeLock) TryLock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.holders == 0 {
+		if err := l.lockFile(); err != nil {
+			return err
+		}
+	}
+
+	l.holders++
+	return nil
+}
+
+// Lock locks the store, waiting for other processes to release it until ctx is done
+func (l *storeLock) Lock(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		err := l.TryLock(ctx)
+		var lockedErr *StoreLockedError
+		if !errors.As(err, &lockedErr) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockFile takes the lock shared with other processes, it is up to the caller to hold l.mu
+func (l *storeLock) lockFile() error {
+	path, err := storeLockPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	locked, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if !locked {
+		// the holder writes its pid to the file after locking it
+		bts, _ := os.ReadFile(path)
+		f.Close()
+
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(bts)))
+		return &StoreLockedError{PID: pid}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		unlockFile(f)
+		f.Close()
+		return err
+	}
+
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		unlockFile(f)
+		f.Close()
+		return err
+	}
+
+	l.f = f
+	return nil
+}
+
+func (l *storeLock) Unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.holders--
+	if l.holders > 0 {
+		return
+	}
+
+	// closing the file releases the lock even if unlocking fails
+	unlockFile(l.f)
+	l.f.Close()
+	l.f = nil
+}
+
+type blobPinsKey struct{}
+
+// Pins returns a context for an operation in which the blobs passed to Pin are kept until release is called
+func (l *storeLock) Pins(ctx context.Context) (context.Context, func()) {
+	pinned := make(map[string]bool)
+	release := func() {
+		l.pinMu.Lock()
+		defer l.pinMu.Unlock()
+
+		for digest := range pinned {
+			if l.pins[digest]--; l.pins[digest] == 0 {
+				delete(l.pins, digest)
+			}
+
+			delete(pinned, digest)
+		}
+	}
+
+	return context.WithValue(ctx, blobPinsKey{}, pinned), release
+}
+
+// Pin keeps the blobs from being pruned until the operation of ctx releases its pins. Blobs are pinned
+// before they are looked for, so a blob either was pruned and is written again or stays.
+func (l *storeLock) Pin(ctx context.Context, digests ...string) {
+	pinned, ok := ctx.Value(blobPinsKey{}).(map[string]bool)
+	if !ok {
+		return
+	}
+
+	l.pinMu.Lock()
+	defer l.pinMu.Unlock()
+
+	for _, digest := range digests {
+		if !pinned[digest] {
+			pinned[digest] = true
+			l.pins[digest]++
+		}
+	}
+}
+
+// removeBlob removes the blob unless an operation has pinned it
+func (l *storeLock) removeBlob(digest, path string) error {
+	l.pinMu.Lock()
+	defer l.pinMu.Unlock()
+
+	if l.pins[digest] > 0 {
+		return nil
+	}
+
+	return os.Remove(path)
+}
+
+// lockStore locks the store for a request. If another process holds the lock the request fails
+// unless wait is set, in which case fn is told who it is waiting for.
+func lockStore(ctx context.Context, wait bool, fn func(api.ProgressResponse)) error {
+	err := store.TryLock(ctx)
+	var lockedErr *StoreLockedError
+	if !errors.As(err, &lockedErr) || !wait {
+		return err
+	}
+
+	fn(api.ProgressResponse{Status: lockedErr.Error() + ", waiting"})
+	return store.Lock(ctx)
+}
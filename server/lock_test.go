@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+	"github.com/jmorganca/ollama/testutil"
+)
+
+func TestStoreLock(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	path, err := storeLockPath()
+	require.NoError(t, err)
+
+	// another process holding the lock is simulated with a second open file
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	other, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	require.NoError(t, err)
+	defer other.Close()
+
+	locked, err := tryLockFile(other)
+	require.NoError(t, err)
+	require.True(t, locked)
+	_, err = other.WriteAt([]byte("4242"), 0)
+	require.NoError(t, err)
+
+	l := newStoreLock()
+	err = l.TryLock(context.Background())
+	assert.Equal(t, &StoreLockedError{PID: 4242}, err)
+	assert.EqualError(t, err, "model store is locked by pid 4242")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Lock(ctx), context.DeadlineExceeded)
+
+	require.NoError(t, unlockFile(other))
+
+	require.NoError(t, l.TryLock(context.Background()))
+
+	bts, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(bts))
+
+	locked, err = tryLockFile(other)
+	require.NoError(t, err)
+	assert.False(t, locked)
+
+	// the other operations of the process share the lock
+	require.NoError(t, l.TryLock(context.Background()))
+	require.NoError(t, l.Lock(context.Background()))
+
+	l.Unlock()
+	l.Unlock()
+	locked, err = tryLockFile(other)
+	require.NoError(t, err)
+	assert.False(t, locked)
+
+	l.Unlock()
+	locked, err = tryLockFile(other)
+	require.NoError(t, err)
+	assert.True(t, locked)
+}
+
+func TestStorePullAndPurge(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+
+	// hold the blobs until the purge has been started
+	origin := testutil.NewRegistry(t.TempDir())
+	release := make(chan struct{})
+	var blobs atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			blobs.Add(1)
+			<-release
+		}
+
+		origin.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	name := strings.TrimPrefix(srv.URL, "http://") + "/library/echo:latest"
+	require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+	require.NoError(t, PushModel(context.TODO(), name, &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {}))
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err = parser.Parse(strings.NewReader("FROM mock://echo\nSYSTEM hello"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "other", "", commands, func(api.ProgressResponse) {}))
+
+	r := gin.New()
+	r.POST("/api/pull", PullModelHandler)
+	r.DELETE("/api/delete", DeleteModelHandler)
+
+	pulled := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/pull", strings.NewReader(fmt.Sprintf(`{"name": %q, "insecure": true, "stream": false}`, name))))
+		pulled <- w
+	}()
+
+	require.Eventually(t, func() bool { return blobs.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	purged := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/delete", strings.NewReader(`{"name": "other", "purge": true}`)))
+		purged <- w
+	}()
+
+	// the purge doesn't wait for the pull, and keeps the blob of the echo model it shares with it
+	select {
+	case w := <-purged:
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the purge waited for the pull")
+	}
+
+	close(release)
+
+	w := <-pulled
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	model, err := GetModel(name)
+	require.NoError(t, err)
+	assert.FileExists(t, model.ModelPath)
+
+	_, err = GetModel("other")
+	assert.Error(t, err)
+}
+
+func TestStorePins(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	layer, err := NewLayer(strings.NewReader("pinned"), "application/vnd.ollama.image.system")
+	require.NoError(t, err)
+	_, err = layer.Commit()
+	require.NoError(t, err)
+
+	blob, err := GetBlobsPath(layer.Digest)
+	require.NoError(t, err)
+
+	ctx, release := store.Pins(context.Background())
+	store.Pin(ctx, layer.Digest)
+
+	require.NoError(t, deleteUnusedLayers(nil, map[string]struct{}{layer.Digest: {}}, false))
+	assert.FileExists(t, blob)
+
+	release()
+	release()
+	assert.Empty(t, store.pins)
+
+	require.NoError(t, deleteUnusedLayers(nil, map[string]struct{}{layer.Digest: {}}, false))
+	assert.NoFileExists(t, blob)
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/format"
+)
+
+const (
+	logFileName = "server.log"
+
+	defaultLogMaxSize = 100 * format.MegaByte
+	defaultLogMaxAge  = 7 * 24 * time.Hour
+
+	// defaultLogLines is how many lines of the log are sent before following it
+	defaultLogLines = 100
+)
+
+// LogDir is where the server writes its log, $OLLAMA_LOG_DIR or ~/.ollama/logs
+func LogDir() (string, error) {
+	if dir := os.Getenv("OLLAMA_LOG_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "logs"), nil
+}
+
+// logFile writes to server.log, moving it aside once it grows past maxSize. Moved logs are removed once
+// they are older than maxAge.
+type logFile struct {
+	mu   sync.Mutex
+	dir  string
+	f    *os.File
+	size int64
+
+	maxSize int64
+	maxAge  time.Duration
+}
+
+func openLogFile(dir string, maxSize int64, maxAge time.Duration) (*logFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	l := &logFile{dir: dir, maxSize: maxSize, maxAge: maxAge}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	l.prune()
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.f = f
+	l.size = fi.Size()
+	return nil
+}
+
+func (l *logFile) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate moves the log aside as server-<time>.log and starts a new one, it is up to the caller to lock l.mu
+func (l *logFile) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("server-%s.log", time.Now().UTC().Format("20060102T150405.000"))
+	if err := os.Rename(filepath.Join(l.dir, logFileName), filepath.Join(l.dir, name)); err != nil {
+		return err
+	}
+
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	go l.prune()
+	return nil
+}
+
+// prune removes moved logs older than maxAge
+func (l *logFile) prune() {
+	names, err := filepath.Glob(filepath.Join(l.dir, "server-*.log"))
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil || time.Since(fi.ModTime()) < l.maxAge {
+			continue
+		}
+
+		if err := os.Remove(name); err != nil {
+			log.Printf("couldn't remove old log %s: %v", name, err)
+		}
+	}
+}
+
+// SetupLogging copies the server's log to server.log in LogDir. The log is moved aside once it grows past
+// $OLLAMA_LOG_MAX_SIZE, 100MB by default, and moved logs are removed after $OLLAMA_LOG_MAX_AGE, 7 days.
+func SetupLogging() error {
+	dir, err := LogDir()
+	if err != nil {
+		return err
+	}
+
+	maxSize := int64(defaultLogMaxSize)
+	if s := os.Getenv("OLLAMA_LOG_MAX_SIZE"); s != "" {
+		if maxSize, err = format.ParseBytes(s); err != nil || maxSize <= 0 {
+			return fmt.Errorf("OLLAMA_LOG_MAX_SIZE: invalid size '%s'", s)
+		}
+	}
+
+	maxAge := defaultLogMaxAge
+	if s := os.Getenv("OLLAMA_LOG_MAX_AGE"); s != "" {
+		if maxAge, err = time.ParseDuration(s); err != nil || maxAge <= 0 {
+			return fmt.Errorf("OLLAMA_LOG_MAX_AGE: invalid duration '%s'", s)
+		}
+	}
+
+	l, err := openLogFile(dir, maxSize, maxAge)
+	if err != nil {
+		return err
+	}
+
+	log.SetOutput(io.MultiWriter(os.Stderr, l))
+	gin.DefaultWriter = io.MultiWriter(os.Stdout, l)
+	gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, l)
+	return nil
+}
+
+// tailLines returns the last n lines of r
+func tailLines(r io.Reader, n int) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// followLog reads lines added to the log at path from offset until done is closed, it starts again from the
+// beginning of the log when it is rotated
+func followLog(path string, offset int64, done <-chan struct{}, fn func(string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	var partial string
+	for {
+		line, err := r.ReadString('\n')
+		partial += line
+		switch {
+		case err == nil:
+			if !fn(strings.TrimSuffix(partial, "\n")) {
+				return nil
+			}
+
+			partial = ""
+			continue
+		case !errors.Is(err, io.EOF):
+			return err
+		}
+
+		// the log was moved aside, read what's left of it and then the new one
+		if rotated(path, f) {
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+
+			for _, line := range strings.SplitAfter(partial+string(rest), "\n") {
+				if line != "" && !fn(strings.TrimSuffix(line, "\n")) {
+					return nil
+				}
+			}
+
+			nf, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+
+			f.Close()
+			f = nf
+			r.Reset(f)
+			partial = ""
+			continue
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// rotated reports whether path is no longer the file f
+func rotated(path string, f *os.File) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	current, err := f.Stat()
+	return err == nil && !os.SameFile(fi, current)
+}
+
+// LogsHandler streams the server's log. Logs can include prompts and client addresses, so they are only
+// sent to clients on the same machine, and not through a proxy there.
+func LogsHandler(c *gin.Context) {
+	var req api.LogsRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if host, _, err := net.SplitHostPort(c.Request.RemoteAddr); err != nil || !net.ParseIP(host).IsLoopback() || c.GetHeader("X-Forwarded-For") != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "logs are only available on the machine running the server"})
+		return
+	}
+
+	dir, err := LogDir()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	path := filepath.Join(dir, logFileName)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "the server is not logging to a file"})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := req.Lines
+	if n <= 0 {
+		n = defaultLogLines
+	}
+
+	lines, err := tailLines(f, n)
+	offset, _ := f.Seek(0, io.SeekCurrent)
+	f.Close()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ch := make(chan any)
+	go func() {
+		defer close(ch)
+
+		for _, line := range lines {
+			ch <- api.LogsResponse{Line: line}
+		}
+
+		if !req.Follow {
+			return
+		}
+
+		done := c.Request.Context().Done()
+		err := followLog(path, offset, done, func(line string) bool {
+			select {
+			case ch <- api.LogsResponse{Line: line}:
+				return true
+			case <-done:
+				return false
+			}
+		})
+		if err != nil {
+			select {
+			case ch <- gin.H{"error": err.Error()}:
+			case <-done:
+			}
+		}
+	}()
+
+	streamResponse(c, ch)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFileRotate(t *testing.T) {
+	dir := t.TempDir()
+
+	// a moved log old enough to be removed
+	old := filepath.Join(dir, "server-20200101T000000.000.log")
+	require.NoError(t, os.WriteFile(old, []byte("old\n"), 0o644))
+	require.NoError(t, os.Chtimes(old, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour)))
+
+	l, err := openLogFile(dir, 16, 24*time.Hour)
+	require.NoError(t, err)
+	defer l.f.Close()
+
+	_, err = os.Stat(old)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for i := 0; i < 3; i++ {
+		_, err := fmt.Fprintf(l, "line %d\n", i)
+		require.NoError(t, err)
+	}
+
+	bts, err := os.ReadFile(filepath.Join(dir, logFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "line 2\n", string(bts))
+
+	moved, err := filepath.Glob(filepath.Join(dir, "server-*.log"))
+	require.NoError(t, err)
+	require.Len(t, moved, 1)
+
+	bts, err = os.ReadFile(moved[0])
+	require.NoError(t, err)
+	assert.Equal(t, "line 0\nline 1\n", string(bts))
+}
+
+func TestTailLines(t *testing.T) {
+	lines, err := tailLines(strings.NewReader("a\nb\nc\nd\n"), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "d"}, lines)
+
+	lines, err = tailLines(strings.NewReader("a\n"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, lines)
+}
+
+func TestFollowLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, logFileName)
+	require.NoError(t, os.WriteFile(path, []byte("before\n"), 0o644))
+
+	l, err := openLogFile(dir, 1024, time.Hour)
+	require.NoError(t, err)
+	defer l.f.Close()
+
+	done := make(chan struct{})
+	lines := make(chan string)
+	go func() {
+		followLog(path, int64(len("before\n")), done, func(line string) bool {
+			lines <- line
+			return true
+		})
+	}()
+
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a log line")
+			return ""
+		}
+	}
+
+	fmt.Fprintln(l, "after")
+	assert.Equal(t, "after", next())
+
+	// lines written after the log is moved aside come from the new log
+	l.mu.Lock()
+	require.NoError(t, l.rotate())
+	l.mu.Unlock()
+
+	fmt.Fprintln(l, "rotated")
+	assert.Equal(t, "rotated", next())
+
+	close(done)
+}
+
+func TestLogsHandlerRemote(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/logs", LogsHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/logs", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+// maxTopLogprobs is the most alternatives to a token a request can ask for, and the number of candidates
+// asked of the runner, so that the token generated is usually among them
+const maxTopLogprobs = 20
+
+// unlikelyLogprob is the log probability of a token which wasn't among the runner's candidates, or whose
+// probability is too small to take the log of. OpenAI uses it for the same.
+const unlikelyLogprob = -9999.0
+
+func logprob(p float64) float64 {
+	if p <= 0 {
+		return unlikelyLogprob
+	}
+
+	return math.Max(math.Log(p), unlikelyLogprob)
+}
+
+// tokenLogprobs turns the candidates the runner reports for each generated token into the token's log
+// probability and those of the top most likely tokens
+func tokenLogprobs(probs []llm.TokenProbs, top int) []api.TokenLogprob {
+	logprobs := make([]api.TokenLogprob, len(probs))
+	for i, p := range probs {
+		candidates := append([]llm.TokenProb(nil), p.Probs...)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Prob > candidates[j].Prob
+		})
+
+		logprobs[i] = api.TokenLogprob{Token: p.Content, Logprob: unlikelyLogprob}
+		for _, candidate := range candidates {
+			if candidate.Token == p.Content {
+				logprobs[i].Logprob = logprob(candidate.Prob)
+				break
+			}
+		}
+
+		for j := 0; j < top && j < len(candidates); j++ {
+			logprobs[i].TopLogprobs = append(logprobs[i].TopLogprobs, api.TopLogprob{
+				Token:   candidates[j].Token,
+				Logprob: logprob(candidates[j].Prob),
+			})
+		}
+	}
+
+	return logprobs
+}
+
+// openaiLogprobs are the log probabilities of the tokens of a chat completion
+func openaiLogprobs(logprobs []api.TokenLogprob) *api.ChatCompletionLogprobs {
+	content := make([]api.ChatCompletionLogprob, len(logprobs))
+	for i, l := range logprobs {
+		content[i] = api.ChatCompletionLogprob{
+			Token:       l.Token,
+			Logprob:     l.Logprob,
+			Bytes:       tokenBytes(l.Token),
+			TopLogprobs: make([]api.ChatCompletionTopLogprob, len(l.TopLogprobs)),
+		}
+
+		for j, t := range l.TopLogprobs {
+			content[i].TopLogprobs[j] = api.ChatCompletionTopLogprob{Token: t.Token, Logprob: t.Logprob, Bytes: tokenBytes(t.Token)}
+		}
+	}
+
+	return &api.ChatCompletionLogprobs{Content: content}
+}
+
+func tokenBytes(token string) []int {
+	bts := make([]int, len(token))
+	for i := 0; i < len(token); i++ {
+		bts[i] = int(token[i])
+	}
+
+	return bts
+}
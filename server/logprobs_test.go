@@ -0,0 +1,52 @@
+package server
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+func TestTokenLogprobs(t *testing.T) {
+	probs := []llm.TokenProbs{
+		{Content: " blue", Probs: []llm.TokenProb{{Token: " grey", Prob: 0.2}, {Token: " blue", Prob: 0.7}, {Token: " red", Prob: 0}}},
+		{Content: " sky", Probs: []llm.TokenProb{{Token: " sea", Prob: 0.9}}},
+	}
+
+	logprobs := tokenLogprobs(probs, 2)
+	require.Len(t, logprobs, 2)
+
+	assert.Equal(t, " blue", logprobs[0].Token)
+	assert.InDelta(t, math.Log(0.7), logprobs[0].Logprob, 1e-9)
+	require.Len(t, logprobs[0].TopLogprobs, 2)
+	assert.Equal(t, " blue", logprobs[0].TopLogprobs[0].Token)
+	assert.Equal(t, " grey", logprobs[0].TopLogprobs[1].Token)
+
+	// a token which isn't among the candidates is too unlikely to have been reported
+	assert.Equal(t, unlikelyLogprob, logprobs[1].Logprob)
+
+	logprobs = tokenLogprobs(probs, 3)
+	assert.Equal(t, unlikelyLogprob, logprobs[0].TopLogprobs[2].Logprob)
+
+	logprobs = tokenLogprobs(probs, 0)
+	assert.Empty(t, logprobs[0].TopLogprobs)
+}
+
+func TestOpenAILogprobs(t *testing.T) {
+	logprobs := openaiLogprobs([]api.TokenLogprob{
+		{Token: "é", Logprob: -0.1, TopLogprobs: []api.TopLogprob{{Token: "é", Logprob: -0.1}, {Token: "e", Logprob: -2.4}}},
+		{Token: "!", Logprob: -0.5},
+	})
+
+	require.Len(t, logprobs.Content, 2)
+	assert.Equal(t, []int{0xc3, 0xa9}, logprobs.Content[0].Bytes)
+	assert.Equal(t, []int{'e'}, logprobs.Content[0].TopLogprobs[1].Bytes)
+
+	// top_logprobs is always a list in OpenAI's responses
+	assert.NotNil(t, logprobs.Content[1].TopLogprobs)
+	assert.Empty(t, logprobs.Content[1].TopLogprobs)
+}
@@ -3,11 +3,16 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 )
 
-func WriteManifest(name string, config *Layer, layers []*Layer) error {
+func WriteManifest(name string, config *Layer, layers []*Layer, labels map[string]string) error {
 	manifest := ManifestV2{
 		SchemaVersion: 2,
 		MediaType:     "application/vnd.docker.distribution.manifest.v2+json",
@@ -15,6 +20,10 @@ func WriteManifest(name string, config *Layer, layers []*Layer) error {
 		Layers:        layers,
 	}
 
+	if len(labels) > 0 {
+		manifest.Annotations = labels
+	}
+
 	var b bytes.Buffer
 	if err := json.NewEncoder(&b).Encode(manifest); err != nil {
 		return err
@@ -26,9 +35,141 @@ func WriteManifest(name string, config *Layer, layers []*Layer) error {
 		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(manifestPath), 0755); err != nil {
+	return writeFileAtomic(manifestPath, b.Bytes())
+}
+
+// writeFileAtomic writes data to path so that after a crash the file is either complete or unchanged.
+// The data is written to a temporary file in the same directory, synced to disk and renamed over path.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir flushes renames in dir to disk, directories can't be opened for syncing on windows
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// CheckManifests moves manifests which can't be read or reference missing blobs out of the way
+// to the quarantine directory next to the manifests, so a store left broken by a crash doesn't
+// break listing and pruning models. Temporary files left by interrupted writes are removed.
+func CheckManifests() error {
+	manifests, err := GetManifestPath()
+	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(manifestPath, b.Bytes(), 0644)
+	quarantine := filepath.Join(filepath.Dir(manifests), "quarantine")
+
+	return filepath.Walk(manifests, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(path, ".tmp") {
+			log.Printf("removing incomplete manifest %s", path)
+			return os.Remove(path)
+		}
+
+		if err := checkManifest(path); err != nil {
+			rel, err2 := filepath.Rel(manifests, path)
+			if err2 != nil {
+				return err2
+			}
+
+			dest := filepath.Join(quarantine, rel)
+			log.Printf("moving broken manifest %s to %s: %v", rel, dest, err)
+
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+
+			return os.Rename(path, dest)
+		}
+
+		return nil
+	})
+}
+
+// checkManifest returns an error if the manifest at path is invalid or any of its blobs are missing or truncated
+func checkManifest(path string) error {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var manifest ManifestV2
+	if err := json.Unmarshal(bts, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	if manifest.Config == nil {
+		return errors.New("invalid manifest: missing config")
+	}
+
+	for _, layer := range append([]*Layer{manifest.Config}, manifest.Layers...) {
+		blob, err := GetBlobsPath(layer.Digest)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Stat(blob)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return fmt.Errorf("missing blob %s", layer.Digest)
+		case err != nil:
+			return err
+		case fi.Size() != layer.Size:
+			return fmt.Errorf("blob %s is %d bytes, expected %d", layer.Digest, fi.Size(), layer.Size)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a", "b")
+
+	require.NoError(t, writeFileAtomic(path, []byte("one")))
+	require.NoError(t, writeFileAtomic(path, []byte("two")))
+
+	bts, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(bts))
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestCheckManifests(t *testing.T) {
+	models := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", models)
+
+	blob := func(digest, content string) *Layer {
+		path, err := GetBlobsPath(digest)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return &Layer{MediaType: "application/vnd.ollama.image.model", Digest: digest, Size: int64(len(content))}
+	}
+
+	config := blob("sha256:aaaa", "{}")
+	weights := blob("sha256:bbbb", "weights")
+
+	require.NoError(t, WriteManifest("good", config, []*Layer{weights}, nil))
+	require.NoError(t, WriteManifest("missing", config, []*Layer{{Digest: "sha256:cccc", Size: 1}}, nil))
+	require.NoError(t, WriteManifest("truncated", config, []*Layer{{Digest: weights.Digest, Size: 100}}, nil))
+
+	manifests, err := GetManifestPath()
+	require.NoError(t, err)
+
+	dir := filepath.Join(manifests, "registry.ollama.ai", "library")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "invalid"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid", "latest"), []byte(`{"schemaVersion": 2, "lay`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "good", "latest.123.tmp"), []byte(`{`), 0o644))
+
+	require.NoError(t, CheckManifests())
+
+	_, _, err = GetManifest(ParseModelPath("good"))
+	assert.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(dir, "good", "latest.123.tmp"))
+
+	for _, name := range []string{"missing", "truncated", "invalid"} {
+		assert.NoFileExists(t, filepath.Join(dir, name, "latest"))
+		assert.FileExists(t, filepath.Join(models, "quarantine", "registry.ollama.ai", "library", name, "latest"))
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// storeVersion is the version of the model store layout this version of ollama reads and writes.
+// Changing the layout means increasing it and adding a migration to storeMigrations.
+const storeVersion = 1
+
+// StoreMigration changes the layout of the model store
+type StoreMigration struct {
+	// Version is the version of the store after the migration
+	Version     int
+	Description string
+
+	migrate func(models string) error
+}
+
+// storeMigrations are run in order on stores older than their version
+var storeMigrations = []StoreMigration{
+	{
+		Version:     1,
+		Description: "record the version of the model store",
+		migrate:     func(string) error { return nil },
+	},
+}
+
+func storeVersionPath() (string, error) {
+	dir, err := modelsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "version"), nil
+}
+
+// readStoreVersion returns the version of the model store, stores from before versioning are version 0
+func readStoreVersion() (int, error) {
+	path, err := storeVersionPath()
+	if err != nil {
+		return 0, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(bts)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid model store version: %w", err)
+	}
+
+	return version, nil
+}
+
+func writeStoreVersion(version int) error {
+	path, err := storeVersionPath()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, []byte(strconv.Itoa(version)+"\n"))
+}
+
+// MigrateStore brings the model store up to date with storeVersion, calling fn before each migration.
+// Each migration is recorded as it finishes so an interrupted migration resumes where it stopped.
+// If dryRun is set the migrations are only reported.
+func MigrateStore(dryRun bool, fn func(StoreMigration)) error {
+	if err := store.TryLock(context.Background()); err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	return migrateStore(dryRun, fn)
+}
+
+// migrateStore is MigrateStore for a caller which has locked the store
+func migrateStore(dryRun bool, fn func(StoreMigration)) error {
+	version, err := readStoreVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > storeVersion {
+		return fmt.Errorf("model store version %d is newer than the supported version %d, upgrade ollama to use it", version, storeVersion)
+	}
+
+	models, err := modelsDir()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range storeMigrations {
+		if m.Version <= version {
+			continue
+		}
+
+		fn(m)
+		if dryRun {
+			continue
+		}
+
+		if err := m.migrate(models); err != nil {
+			return fmt.Errorf("migrating model store to version %d: %w", m.Version, err)
+		}
+
+		if err := writeStoreVersion(m.Version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
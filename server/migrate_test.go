@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateStore(t *testing.T) {
+	models := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", models)
+
+	migrations := storeMigrations
+	t.Cleanup(func() { storeMigrations = migrations })
+
+	var migrated []int
+	storeMigrations = []StoreMigration{
+		{Version: 1, Description: "one", migrate: func(dir string) error {
+			assert.Equal(t, models, dir)
+			migrated = append(migrated, 1)
+			return nil
+		}},
+		{Version: 2, Description: "two", migrate: func(string) error {
+			migrated = append(migrated, 2)
+			return errors.New("interrupted")
+		}},
+	}
+
+	var reported []string
+	report := func(m StoreMigration) { reported = append(reported, m.Description) }
+
+	// a dry run reports the migrations without running them
+	require.NoError(t, MigrateStore(true, report))
+	assert.Equal(t, []string{"one", "two"}, reported)
+	assert.Empty(t, migrated)
+
+	version, err := readStoreVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	// a failed migration leaves the store at the version of the last one to finish
+	assert.EqualError(t, MigrateStore(false, report), "migrating model store to version 2: interrupted")
+	assert.Equal(t, []int{1, 2}, migrated)
+
+	version, err = readStoreVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	storeMigrations[1].migrate = func(string) error {
+		migrated = append(migrated, 2)
+		return nil
+	}
+
+	require.NoError(t, MigrateStore(false, report))
+	assert.Equal(t, []int{1, 2, 2}, migrated)
+
+	version, err = readStoreVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+}
+
+func TestMigrateStoreNewer(t *testing.T) {
+	models := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", models)
+
+	require.NoError(t, os.WriteFile(filepath.Join(models, "version"), []byte("99\n"), 0o644))
+	assert.ErrorContains(t, MigrateStore(false, func(StoreMigration) {}), "model store version 99 is newer")
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// registryConfig is read from $OLLAMA_REGISTRIES or ~/.ollama/registries.json, it lists the endpoints models
+// of a registry are pulled from, e.g.
+//
+//	{
+//	  "registry.ollama.ai": {
+//	    "endpoints": ["https://mirror.example.com", "https://registry.ollama.ai"],
+//	    "hedge": "5s"
+//	  }
+//	}
+type registryConfig map[string]*registryMirrors
+
+type registryMirrors struct {
+	// Endpoints are tried in order, the registry itself is tried last if it is not listed
+	Endpoints []string `json:"endpoints"`
+
+	// Hedge is how long a blob download waits for an endpoint to answer before also asking the next one
+	Hedge string `json:"hedge,omitempty"`
+
+	endpoints []*url.URL
+	hedge     time.Duration
+}
+
+// registries configures where models are pulled from, it is nil when no mirrors are configured
+var registries registryConfig
+
+func registryConfigPath() (string, error) {
+	if path, ok := os.LookupEnv("OLLAMA_REGISTRIES"); ok {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "registries.json"), nil
+}
+
+// loadRegistryConfig returns nil if no mirrors have been configured
+func loadRegistryConfig() (registryConfig, error) {
+	path, err := registryConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config registryConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for registry, mirrors := range config {
+		for _, endpoint := range mirrors.Endpoints {
+			u, err := url.Parse(endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("%s: endpoint '%s' of '%s' needs an http or https url", path, endpoint, registry)
+			}
+
+			mirrors.endpoints = append(mirrors.endpoints, u)
+		}
+
+		if mirrors.Hedge != "" {
+			mirrors.hedge, err = time.ParseDuration(mirrors.Hedge)
+			if err != nil {
+				return nil, fmt.Errorf("%s: hedge of '%s': %w", path, registry, err)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// endpoints are the base URLs a model is pulled from in order of priority
+func (c registryConfig) endpoints(mp ModelPath) []*url.URL {
+	base := mp.BaseURL()
+
+	mirrors, ok := c[mp.Registry]
+	if !ok {
+		return []*url.URL{base}
+	}
+
+	var endpoints []*url.URL
+	for _, u := range mirrors.endpoints {
+		if u.Host == base.Host {
+			base = nil
+		}
+
+		endpoints = append(endpoints, u)
+	}
+
+	if base != nil {
+		endpoints = append(endpoints, base)
+	}
+
+	return endpoints
+}
+
+// hedge is how long to wait for an endpoint of the registry before also asking the next one, 0 never hedges
+func (c registryConfig) hedge(mp ModelPath) time.Duration {
+	if mirrors, ok := c[mp.Registry]; ok {
+		return mirrors.hedge
+	}
+
+	return 0
+}
+
+// cancelOnClose releases the context of a request when its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// fetch sends a request to each of the urls in order until one succeeds. With a hedge delay the request is
+// also sent to the next url when none has answered within it, the first to answer is used and the others are
+// canceled. It returns the index of the url which answered.
+func fetch(ctx context.Context, urls []*url.URL, hedge time.Duration, do func(context.Context, *url.URL) (*http.Response, error)) (*http.Response, int, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+		i    int
+	}
+
+	results := make(chan result, len(urls))
+	cancels := make([]context.CancelFunc, len(urls))
+
+	var next, inflight int
+	start := func() {
+		i := next
+		next++
+		inflight++
+
+		var actx context.Context
+		actx, cancels[i] = context.WithCancel(ctx)
+		go func() {
+			resp, err := do(actx, urls[i])
+			results <- result{resp, err, i}
+		}()
+	}
+
+	// stop cancels every request but the one which answered, and closes any other answers which arrive
+	stop := func(winner int) {
+		for i, cancel := range cancels {
+			if cancel != nil && i != winner {
+				cancel()
+			}
+		}
+
+		go func(n int) {
+			for ; n > 0; n-- {
+				if r := <-results; r.resp != nil {
+					r.resp.Body.Close()
+				}
+			}
+		}(inflight)
+	}
+
+	var timer *time.Timer
+	var hedged <-chan time.Time
+	if hedge > 0 {
+		timer = time.NewTimer(hedge)
+		defer timer.Stop()
+		hedged = timer.C
+	}
+
+	start()
+
+	var err error
+	for inflight > 0 {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				stop(r.i)
+				r.resp.Body = cancelOnClose{r.resp.Body, cancels[r.i]}
+				return r.resp, r.i, nil
+			}
+
+			cancels[r.i]()
+			err = r.err
+			if ctx.Err() != nil {
+				stop(-1)
+				return nil, 0, ctx.Err()
+			}
+
+			if next < len(urls) {
+				log.Printf("%s failed: %v, trying %s", urls[r.i].Host, r.err, urls[next].Host)
+				start()
+			}
+		case <-hedged:
+			if next < len(urls) {
+				log.Printf("%s is slow, also trying %s", urls[next-1].Host, urls[next].Host)
+				start()
+				timer.Reset(hedge)
+			}
+		}
+	}
+
+	return nil, 0, err
+}
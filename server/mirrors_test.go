@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRegistryConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "registries.json")
+	t.Setenv("OLLAMA_REGISTRIES", path)
+
+	config, err := loadRegistryConfig()
+	require.NoError(t, err)
+	assert.Nil(t, config)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"registry.ollama.ai": {"endpoints": ["https://mirror.example.com"], "hedge": "2s"}}`), 0644))
+	config, err = loadRegistryConfig()
+	require.NoError(t, err)
+
+	mp := ParseModelPath("llama2:7b")
+	var endpoints []string
+	for _, u := range config.endpoints(mp) {
+		endpoints = append(endpoints, u.String())
+	}
+
+	assert.Equal(t, []string{"https://mirror.example.com", "https://registry.ollama.ai"}, endpoints)
+	assert.Equal(t, 2*time.Second, config.hedge(mp))
+
+	// models of other registries are pulled from the registry itself
+	other := ParseModelPath("example.com/library/llama2:7b")
+	assert.Len(t, config.endpoints(other), 1)
+	assert.Zero(t, config.hedge(other))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"registry.ollama.ai": {"endpoints": ["mirror.example.com"]}}`), 0644))
+	_, err = loadRegistryConfig()
+	assert.ErrorContains(t, err, "needs an http or https url")
+}
+
+func TestFetch(t *testing.T) {
+	get := func(ctx context.Context, u *url.URL) (*http.Response, error) {
+		return makeRequestWithRetry(ctx, http.MethodGet, u, nil, nil, &RegistryOptions{})
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+
+		io.WriteString(w, "slow")
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "up")
+	}))
+	defer up.Close()
+
+	parse := func(servers ...*httptest.Server) []*url.URL {
+		var urls []*url.URL
+		for _, s := range servers {
+			u, err := url.Parse(s.URL)
+			require.NoError(t, err)
+			urls = append(urls, u)
+		}
+
+		return urls
+	}
+
+	body := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		bts, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(bts)
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		resp, i, err := fetch(context.Background(), parse(down, up), 0, get)
+		require.NoError(t, err)
+		assert.Equal(t, 1, i)
+		assert.Equal(t, "up", body(resp))
+	})
+
+	t.Run("all down", func(t *testing.T) {
+		_, _, err := fetch(context.Background(), parse(down, down), 0, get)
+		assert.ErrorContains(t, err, "503")
+	})
+
+	t.Run("hedge", func(t *testing.T) {
+		resp, i, err := fetch(context.Background(), parse(slow, up), 50*time.Millisecond, get)
+		require.NoError(t, err)
+		assert.Equal(t, 1, i)
+		assert.Equal(t, "up", body(resp))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, _, err := fetch(ctx, parse(slow, up), 0, get)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
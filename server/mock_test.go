@@ -0,0 +1,717 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+	"github.com/jmorganca/ollama/parser"
+)
+
+func TestMockModel(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	create := func(name, modelfile string) error {
+		commands, err := parser.Parse(strings.NewReader(modelfile))
+		require.NoError(t, err)
+		return CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {})
+	}
+
+	require.NoError(t, create("echo", "FROM mock://echo\nTEMPLATE You said: {{ .Prompt }}"))
+	assert.ErrorContains(t, create("unknown", "FROM mock://unknown"), "unknown mock model")
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(path string, body any, v any) int {
+		bts, err := json.Marshal(body)
+		require.NoError(t, err)
+
+		resp, err := srv.Client().Post(srv.URL+path, "application/json", bytes.NewReader(bts))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		return resp.StatusCode
+	}
+
+	stream := false
+
+	var generate api.GenerateResponse
+	require.Equal(t, http.StatusOK, post("/api/generate", api.GenerateRequest{Model: "echo", Prompt: "hello there", Stream: &stream}, &generate))
+	assert.Equal(t, "You said: hello there", generate.Response)
+	assert.Equal(t, 4, generate.EvalCount)
+
+	require.Equal(t, http.StatusOK, post("/api/generate", api.GenerateRequest{
+		Model:   "echo",
+		Prompt:  "one two three",
+		Stream:  &stream,
+		Options: map[string]interface{}{"num_predict": 3},
+	}, &generate))
+	assert.Equal(t, "You said: one", generate.Response)
+
+	var chat api.ChatResponse
+	require.Equal(t, http.StatusOK, post("/api/chat", api.ChatRequest{
+		Model:    "echo",
+		Messages: []api.Message{{Role: "user", Content: "hi"}},
+		Stream:   &stream,
+	}, &chat))
+	assert.Equal(t, "assistant", chat.Message.Role)
+	assert.Contains(t, chat.Message.Content, "hi")
+
+	var first, second api.EmbeddingResponse
+	require.Equal(t, http.StatusOK, post("/api/embeddings", api.EmbeddingRequest{Model: "echo", Prompt: "llamas"}, &first))
+	require.Equal(t, http.StatusOK, post("/api/embeddings", api.EmbeddingRequest{Model: "echo", Prompt: "llamas"}, &second))
+	assert.Len(t, first.Embedding, 16)
+	assert.Equal(t, first.Embedding, second.Embedding)
+}
+
+func TestReturnPrompt(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nTEMPLATE [INST] {{ .Prompt }} [/INST]"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(path string, body any, v any) {
+		bts, err := json.Marshal(body)
+		require.NoError(t, err)
+
+		resp, err := srv.Client().Post(srv.URL+path, "application/json", bytes.NewReader(bts))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+
+	stream := false
+
+	var generate api.GenerateResponse
+	post("/api/generate", apix.GenerateRequest{
+		GenerateRequest: api.GenerateRequest{Model: "echo", Prompt: "hello", Stream: &stream},
+		ReturnPrompt:    true,
+	}, &generate)
+	assert.Equal(t, "[INST] hello [/INST]", generate.Prompt)
+
+	var without api.GenerateResponse
+	post("/api/generate", api.GenerateRequest{Model: "echo", Prompt: "hello", Stream: &stream}, &without)
+	assert.Empty(t, without.Prompt)
+
+	var chat api.ChatResponse
+	post("/api/chat", apix.ChatRequest{
+		ChatRequest: api.ChatRequest{
+			Model: "echo",
+			Messages: []api.Message{
+				{Role: "user", Content: "hi"},
+				{Role: "assistant", Content: "hello"},
+				{Role: "user", Content: "bye"},
+			},
+			Stream: &stream,
+		},
+		ReturnPrompt: true,
+	}, &chat)
+	assert.Equal(t, "[INST] hi [/INST]hello[INST] bye [/INST]", chat.Prompt)
+}
+
+func TestCompletions(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nTEMPLATE You said: {{ .Prompt }}"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(body string) *http.Response {
+		resp, err := srv.Client().Post(srv.URL+"/v1/completions", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// the prompt is completed as it is, without the template
+	resp := post(`{"model": "echo", "prompt": "hello there"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var completion api.CompletionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+	assert.Equal(t, "text_completion", completion.Object)
+	assert.Equal(t, "echo", completion.Model)
+	require.Len(t, completion.Choices, 1)
+	assert.Equal(t, "hello there", completion.Choices[0].Text)
+	assert.Equal(t, "stop", *completion.Choices[0].FinishReason)
+	require.NotNil(t, completion.Usage)
+	assert.Equal(t, completion.Usage.PromptTokens+completion.Usage.CompletionTokens, completion.Usage.TotalTokens)
+
+	resp = post(`{"model": "echo", "prompt": ["one two three"], "max_tokens": 1}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+	assert.Equal(t, "one", completion.Choices[0].Text)
+	assert.Equal(t, "length", *completion.Choices[0].FinishReason)
+
+	resp = post(`{"model": "echo", "prompt": "one two three", "stream": true}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var text strings.Builder
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		events = append(events, data)
+		if data == "[DONE]" {
+			continue
+		}
+
+		var chunk api.CompletionResponse
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		text.WriteString(chunk.Choices[0].Text)
+	}
+
+	require.GreaterOrEqual(t, len(events), 2)
+	assert.Equal(t, "[DONE]", events[len(events)-1])
+	assert.Equal(t, "one two three", text.String())
+
+	var last api.CompletionResponse
+	require.NoError(t, json.Unmarshal([]byte(events[len(events)-2]), &last))
+	assert.Equal(t, "stop", *last.Choices[0].FinishReason)
+	assert.Nil(t, last.Usage)
+
+	// the usage of a stream is sent in a last chunk of its own when it is asked for
+	resp = post(`{"model": "echo", "prompt": "one two three", "stream": true, "stream_options": {"include_usage": true}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	events = events[:0]
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+
+	require.GreaterOrEqual(t, len(events), 3)
+	assert.Equal(t, "[DONE]", events[len(events)-1])
+
+	var usage api.CompletionResponse
+	require.NoError(t, json.Unmarshal([]byte(events[len(events)-2]), &usage))
+	assert.Empty(t, usage.Choices)
+	require.NotNil(t, usage.Usage)
+	assert.Equal(t, 3, usage.Usage.CompletionTokens)
+	assert.Equal(t, len("one two three"), usage.Usage.PromptTokens)
+	assert.Equal(t, usage.Usage.PromptTokens+usage.Usage.CompletionTokens, usage.Usage.TotalTokens)
+
+	require.NoError(t, json.Unmarshal([]byte(events[len(events)-3]), &last))
+	assert.Equal(t, "stop", *last.Choices[0].FinishReason)
+	assert.Nil(t, last.Usage)
+
+	resp = post(`{"model": "missing", "prompt": "hi"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "prompt": ["one", "two"]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestInfill(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	for name, modelfile := range map[string]string{"echo": "FROM mock://echo", "code": "FROM mock://infill"} {
+		commands, err := parser.Parse(strings.NewReader(modelfile))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+	}
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(path, body string) *http.Response {
+		resp, err := srv.Client().Post(srv.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post("/api/infill", `{"model": "code", "prefix": "def fib(n):", "suffix": "return n", "stream": false}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var infill api.GenerateResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&infill))
+	assert.Equal(t, "<PRE> def fib(n): <SUF>return n <MID>", infill.Response)
+	assert.True(t, infill.Done)
+
+	// an empty suffix is still filled in the middle
+	resp = post("/api/infill", `{"model": "code", "prefix": "def fib(n):", "max_tokens": 2, "stream": false}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&infill))
+	assert.Equal(t, "<PRE> def", infill.Response)
+
+	resp = post("/api/infill", `{"model": "code", "prefix": "def fib(n):", "suffix": "return n"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var chunk api.GenerateResponse
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &chunk))
+		text.WriteString(chunk.Response)
+	}
+
+	assert.Equal(t, "<PRE> def fib(n): <SUF>return n <MID>", text.String())
+
+	// the OpenAI completion's suffix fills in the middle too
+	resp = post("/v1/completions", `{"model": "code", "prompt": "def fib(n):", "suffix": "return n"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var completion api.CompletionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+	require.Len(t, completion.Choices, 1)
+	assert.Equal(t, "<PRE> def fib(n): <SUF>return n <MID>", completion.Choices[0].Text)
+
+	cases := map[string]struct {
+		path, body string
+		status     int
+		err        string
+	}{
+		"no infill":         {"/api/infill", `{"model": "echo", "prefix": "a", "suffix": "b"}`, http.StatusBadRequest, "model 'echo' can't fill in the middle"},
+		"no infill openai":  {"/v1/completions", `{"model": "echo", "prompt": "a", "suffix": "b"}`, http.StatusBadRequest, "model 'echo' can't fill in the middle"},
+		"missing model":     {"/api/infill", `{"model": "missing", "prefix": "a"}`, http.StatusNotFound, "model 'missing' not found"},
+		"no model":          {"/api/infill", `{"prefix": "a"}`, http.StatusBadRequest, "model is required"},
+		"no prefix, suffix": {"/api/infill", `{"model": "code"}`, http.StatusBadRequest, "prefix or suffix is required"},
+	}
+
+	for name, tt := range cases {
+		resp := post(tt.path, tt.body)
+		assert.Equal(t, tt.status, resp.StatusCode, name)
+
+		bts, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(bts), tt.err, name)
+	}
+
+	// whether a model can fill in the middle is only read from its file once
+	for name, want := range map[string]bool{"code": true, "echo": false} {
+		model, err := GetModel(name)
+		require.NoError(t, err)
+
+		ok, found := infillModels.Load(model.ModelPath)
+		require.True(t, found, name)
+		assert.Equal(t, want, ok, name)
+	}
+}
+
+func TestOpenAIEmbeddings(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(body string) *http.Response {
+		resp, err := srv.Client().Post(srv.URL+"/v1/embeddings", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post(`{"model": "echo", "input": ["llamas", "alpacas"]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var embeddings api.EmbeddingsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&embeddings))
+	assert.Equal(t, "list", embeddings.Object)
+	assert.Equal(t, "echo", embeddings.Model)
+	require.Len(t, embeddings.Data, 2)
+	assert.Equal(t, embeddings.Usage.PromptTokens, embeddings.Usage.TotalTokens)
+
+	floats := make([][]float64, 2)
+	for i, data := range embeddings.Data {
+		assert.Equal(t, "embedding", data.Object)
+		assert.Equal(t, i, data.Index)
+
+		// embeddings are normalized as OpenAI's are
+		var norm float64
+		for _, v := range data.Embedding.([]any) {
+			floats[i] = append(floats[i], v.(float64))
+			norm += v.(float64) * v.(float64)
+		}
+
+		assert.InDelta(t, 1, norm, 1e-6)
+	}
+
+	// a single input, encoded as little endian float32s
+	resp = post(`{"model": "echo", "input": "llamas", "encoding_format": "base64"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&embeddings))
+	require.Len(t, embeddings.Data, 1)
+	assert.Equal(t, base64Embedding(floats[0]), embeddings.Data[0].Embedding)
+
+	resp = post(`{"model": "echo", "input": "llamas", "encoding_format": "binary"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "input": [[1, 2, 3]]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "missing", "input": "llamas"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestChatCompletions(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(body string) *http.Response {
+		resp, err := srv.Client().Post(srv.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post(`{"model": "echo", "messages": [{"role": "user", "content": [{"type": "text", "text": "one two three"}]}], "max_tokens": 1, "seed": 42, "top_p": 0.5}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var completion api.ChatCompletionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&completion))
+	assert.Equal(t, "chat.completion", completion.Object)
+	assert.Equal(t, "echo", completion.Model)
+	assert.Regexp(t, "^chatcmpl-[0-9A-Za-z]{24}$", completion.ID)
+	assert.Regexp(t, "^fp_[0-9a-f]{10}$", completion.SystemFingerprint)
+	require.Len(t, completion.Choices, 1)
+	require.NotNil(t, completion.Choices[0].Message)
+	assert.Equal(t, "assistant", completion.Choices[0].Message.Role)
+	assert.NotEmpty(t, completion.Choices[0].Message.Content)
+	assert.Equal(t, "length", *completion.Choices[0].FinishReason)
+	require.NotNil(t, completion.Usage)
+	assert.Equal(t, 1, completion.Usage.CompletionTokens)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "stream": true}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var text strings.Builder
+	var events []string
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		events = append(events, data)
+		if data == "[DONE]" {
+			continue
+		}
+
+		var chunk api.ChatCompletionResponse
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		assert.Equal(t, completion.SystemFingerprint, chunk.SystemFingerprint)
+		ids[chunk.ID] = true
+		require.NotNil(t, chunk.Choices[0].Delta)
+		text.WriteString(chunk.Choices[0].Delta.Content.(string))
+	}
+
+	require.GreaterOrEqual(t, len(events), 2)
+	assert.Equal(t, "[DONE]", events[len(events)-1])
+	assert.Contains(t, text.String(), "hi")
+
+	// every chunk of a stream has the same ID, which isn't another completion's
+	assert.Len(t, ids, 1)
+	assert.NotContains(t, ids, completion.ID)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "stream": true, "stream_options": {"include_usage": true}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var usage api.ChatCompletionResponse
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok && data != "[DONE]" {
+			require.NoError(t, json.Unmarshal([]byte(data), &usage))
+		}
+	}
+
+	assert.Equal(t, "chat.completion.chunk", usage.Object)
+	assert.Empty(t, usage.Choices)
+	require.NotNil(t, usage.Usage)
+	assert.Positive(t, usage.Usage.PromptTokens)
+	assert.Positive(t, usage.Usage.CompletionTokens)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "n": 2, "seed": 7}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var choices api.ChatCompletionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&choices))
+	require.Len(t, choices.Choices, 2)
+	for i, choice := range choices.Choices {
+		assert.Equal(t, i, choice.Index)
+		assert.Contains(t, choice.Message.Content, "hi")
+	}
+
+	require.NotNil(t, choices.Usage)
+	assert.Equal(t, choices.Usage.PromptTokens+choices.Usage.CompletionTokens, choices.Usage.TotalTokens)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "n": 2, "stream": true, "stream_options": {"include_usage": true}}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	streamed := make(map[int]string)
+	events = nil
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		events = append(events, data)
+		if data == "[DONE]" {
+			continue
+		}
+
+		var chunk api.ChatCompletionResponse
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		for _, choice := range chunk.Choices {
+			streamed[choice.Index] += choice.Delta.Content.(string)
+		}
+	}
+
+	assert.Len(t, streamed, 2)
+	assert.Contains(t, streamed[1], "hi")
+	assert.Equal(t, "[DONE]", events[len(events)-1])
+	assert.Equal(t, 1, strings.Count(strings.Join(events, "\n"), `"usage"`))
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "n": 0}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "n": 129}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var tooMany map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tooMany))
+	assert.Equal(t, "n must be between 1 and 128", tooMany["error"])
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "one two three"}], "logprobs": true, "top_logprobs": 2}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var logprobs api.ChatCompletionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&logprobs))
+	require.NotNil(t, logprobs.Choices[0].Logprobs)
+	content := logprobs.Choices[0].Logprobs.Content
+	require.Len(t, content, logprobs.Usage.CompletionTokens)
+
+	var joined strings.Builder
+	for _, token := range content {
+		joined.WriteString(token.Token)
+		assert.InDelta(t, math.Log(0.75), token.Logprob, 1e-9)
+		require.Len(t, token.TopLogprobs, 2)
+		assert.Equal(t, token.Token, token.TopLogprobs[0].Token)
+		assert.Equal(t, len(token.Token), len(token.Bytes))
+	}
+
+	assert.Equal(t, logprobs.Choices[0].Message.Content, joined.String())
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "one two three"}], "logprobs": true, "stream": true}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tokens int
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok && data != "[DONE]" {
+			var chunk api.ChatCompletionResponse
+			require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			if chunk.Choices[0].Logprobs != nil {
+				tokens += len(chunk.Choices[0].Logprobs.Content)
+				assert.Empty(t, chunk.Choices[0].Logprobs.Content[0].TopLogprobs)
+			}
+		}
+	}
+
+	assert.Positive(t, tokens)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "top_logprobs": 2}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "logprobs": true, "top_logprobs": 21}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "stop": 1}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "response_format": {"type": "json_schema", "json_schema": {"name": "greeting", "schema": {"type": "object", "properties": {"greeting": {"type": "string"}}}}}}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "response_format": {"type": "json_schema", "json_schema": {"name": "greeting", "schema": {"type": "object", "patternProperties": {}}}}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "echo", "messages": [{"role": "user", "content": "hi"}], "response_format": {"type": "yaml"}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = post(`{"model": "missing", "messages": [{"role": "user", "content": "hi"}]}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestChatCompletionToolCalls(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	// the model replies with the user's message, which is a tool call or not
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nTEMPLATE {{ .Prompt }}"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(content string, stream bool) *http.Response {
+		bts, err := json.Marshal(api.ChatCompletionRequest{
+			Model:    "echo",
+			Messages: []api.ChatCompletionMessage{{Role: "user", Content: content}},
+			Stream:   stream,
+			Tools:    []api.Tool{weatherTool},
+		})
+		require.NoError(t, err)
+
+		resp, err := srv.Client().Post(srv.URL+"/v1/chat/completions", "application/json", bytes.NewReader(bts))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp
+	}
+
+	// chunks reads the chunks of a streamed chat completion
+	chunks := func(resp *http.Response) []api.ChatCompletionResponse {
+		var chunks []api.ChatCompletionResponse
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+
+			var chunk api.ChatCompletionResponse
+			require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			chunks = append(chunks, chunk)
+		}
+
+		return chunks
+	}
+
+	call := `{"tool": "get_weather", "arguments": {"city": "Paris"}}`
+
+	var completion api.ChatCompletionResponse
+	require.NoError(t, json.NewDecoder(post(call, false).Body).Decode(&completion))
+	require.Len(t, completion.Choices, 1)
+	assert.Equal(t, "tool_calls", *completion.Choices[0].FinishReason)
+	assert.Nil(t, completion.Choices[0].Message.Content)
+	require.Len(t, completion.Choices[0].Message.ToolCalls, 1)
+	assert.Equal(t, "get_weather", completion.Choices[0].Message.ToolCalls[0].Function.Name)
+	assert.JSONEq(t, `{"city": "Paris"}`, completion.Choices[0].Message.ToolCalls[0].Function.Arguments)
+
+	// a streamed tool call is held back and sent with the last chunk
+	streamed := chunks(post(call, true))
+	require.NotEmpty(t, streamed)
+	last := streamed[len(streamed)-1].Choices[0]
+	assert.Equal(t, "tool_calls", *last.FinishReason)
+	require.Len(t, last.Delta.ToolCalls, 1)
+	assert.Equal(t, "get_weather", last.Delta.ToolCalls[0].Function.Name)
+	for _, chunk := range streamed[:len(streamed)-1] {
+		assert.Empty(t, chunk.Choices[0].Delta.Content)
+		assert.Empty(t, chunk.Choices[0].Delta.ToolCalls)
+	}
+
+	// other replies are streamed as they are
+	streamed = chunks(post("It is sunny in Paris", true))
+	require.Greater(t, len(streamed), 2)
+	assert.Equal(t, "It", streamed[0].Choices[0].Delta.Content)
+
+	var text strings.Builder
+	for _, chunk := range streamed {
+		text.WriteString(chunk.Choices[0].Delta.Content.(string))
+		assert.Empty(t, chunk.Choices[0].Delta.ToolCalls)
+	}
+
+	assert.Equal(t, "It is sunny in Paris", text.String())
+	assert.Equal(t, "stop", *streamed[len(streamed)-1].Choices[0].FinishReason)
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+// defaultModerationCategories follow the categories of the OpenAI moderation API
+var defaultModerationCategories = []string{"hate", "harassment", "self-harm", "sexual", "violence", "illicit"}
+
+// moderationConfig is read from $OLLAMA_MODERATION or ~/.ollama/moderation.json, e.g.
+//
+//	{"model": "llama-guard", "threshold": 0.8, "block": true, "stages": ["prompt", "response"]}
+type moderationConfig struct {
+	Model      string   `json:"model"`
+	Categories []string `json:"categories,omitempty"`
+	Threshold  float64  `json:"threshold,omitempty"`
+
+	// Block fails requests whose input or output is flagged instead of only annotating them
+	Block  bool     `json:"block,omitempty"`
+	Stages []string `json:"stages,omitempty"`
+}
+
+// moderation moderates generations when it is configured
+var moderation *moderationConfig
+
+func moderationConfigPath() (string, error) {
+	if path, ok := os.LookupEnv("OLLAMA_MODERATION"); ok {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "moderation.json"), nil
+}
+
+// loadModerationConfig returns nil if moderation has not been configured
+func loadModerationConfig() (*moderationConfig, error) {
+	path, err := moderationConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config moderationConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if config.Model == "" {
+		return nil, fmt.Errorf("%s: moderation is missing a model", path)
+	}
+
+	if config.Threshold < 0 || config.Threshold > 1 {
+		return nil, fmt.Errorf("%s: threshold must be between 0 and 1", path)
+	}
+
+	if len(config.Stages) == 0 {
+		config.Stages = []string{HookStagePrompt, HookStageResponse}
+	}
+
+	for _, stage := range config.Stages {
+		if stage != HookStagePrompt && stage != HookStageResponse {
+			return nil, fmt.Errorf("%s: unknown stage '%s'", path, stage)
+		}
+	}
+
+	return &config, nil
+}
+
+// Handles reports whether generations are moderated at the stage
+func (m *moderationConfig) Handles(stage string) bool {
+	return m != nil && slices.Contains(m.Stages, stage)
+}
+
+func (m *moderationConfig) categories() []string {
+	if len(m.Categories) == 0 {
+		return defaultModerationCategories
+	}
+
+	return m.Categories
+}
+
+func (m *moderationConfig) threshold() float64 {
+	if m.Threshold == 0 {
+		return 0.5
+	}
+
+	return m.Threshold
+}
+
+// ModerationFlaggedError is returned when moderation blocks a request or its response
+type ModerationFlaggedError struct {
+	Categories []string
+}
+
+func (e *ModerationFlaggedError) Error() string {
+	return "flagged by moderation as " + strings.Join(e.Categories, ", ")
+}
+
+// flagged returns a ModerationFlaggedError if the result is flagged and flagged results are blocked
+func (m *moderationConfig) flagged(result *api.ModerationResult) error {
+	if !m.Block || result == nil || !result.Flagged {
+		return nil
+	}
+
+	var categories []string
+	for category, flagged := range result.Categories {
+		if flagged {
+			categories = append(categories, category)
+		}
+	}
+
+	sort.Strings(categories)
+	return &ModerationFlaggedError{Categories: categories}
+}
+
+// loadedModerator runs the moderation model next to the loaded model, so moderating a generation doesn't
+// unload the model generating it
+var loadedModerator struct {
+	mu sync.Mutex
+
+	runner llm.LLM
+	*Model
+
+	expireTimer *time.Timer
+}
+
+// loadModerator starts a runner for the moderation model if it is not already running, it is up to the
+// caller to lock loadedModerator.mu before calling this function
+func loadModerator(ctx context.Context, workDir, modelName string, sessionDuration time.Duration) error {
+	model, err := GetModel(modelName)
+	if err != nil {
+		return err
+	}
+
+	if loadedModerator.runner != nil {
+		if err := loadedModerator.runner.Ping(ctx); err != nil || loadedModerator.ModelPath != model.ModelPath {
+			loadedModerator.runner.Close()
+			loadedModerator.runner = nil
+		}
+	}
+
+	if loadedModerator.runner == nil {
+		opts := api.DefaultOptions()
+		if err := opts.FromMap(model.Options); err != nil {
+			return err
+		}
+
+		// only the first token is needed to score the categories, sample it greedily
+		opts.NumPredict = 1
+		opts.Temperature = 0
+
+		runner, err := llm.New(workDir, model.ModelPath, model.AdapterPaths, model.ProjectorPaths, opts, nil)
+		if err != nil {
+			return err
+		}
+
+		loadedModerator.runner = runner
+	}
+
+	loadedModerator.Model = model
+
+	if loadedModerator.expireTimer == nil {
+		loadedModerator.expireTimer = time.AfterFunc(sessionDuration, func() {
+			loadedModerator.mu.Lock()
+			defer loadedModerator.mu.Unlock()
+
+			if loadedModerator.runner != nil {
+				loadedModerator.runner.Close()
+			}
+
+			loadedModerator.runner = nil
+			loadedModerator.Model = nil
+		})
+	}
+
+	loadedModerator.expireTimer.Reset(sessionDuration)
+	return nil
+}
+
+// moderationSystem asks the model to answer with the single category which fits the text best
+func moderationSystem(categories []string) string {
+	return fmt.Sprintf("You are a content moderator. Classify the text as one of: safe, %s. Answer with the category only.", strings.Join(categories, ", "))
+}
+
+// moderationResult turns the probability of each answer into category scores
+func moderationResult(choices []api.ClassifyChoice, threshold float64) *api.ModerationResult {
+	result := &api.ModerationResult{
+		Categories:     make(map[string]bool),
+		CategoryScores: make(map[string]float64),
+	}
+
+	for _, choice := range choices {
+		if choice.Choice == "safe" {
+			continue
+		}
+
+		result.CategoryScores[choice.Choice] = choice.Probability
+		result.Categories[choice.Choice] = choice.Probability >= threshold
+		result.Flagged = result.Flagged || result.Categories[choice.Choice]
+	}
+
+	return result
+}
+
+// moderate scores each text with the moderation model
+func (m *moderationConfig) moderate(ctx context.Context, workDir string, texts []string) ([]*api.ModerationResult, error) {
+	loadedModerator.mu.Lock()
+	defer loadedModerator.mu.Unlock()
+
+	if err := loadModerator(ctx, workDir, m.Model, defaultSessionDuration); err != nil {
+		return nil, err
+	}
+
+	categories := m.categories()
+	choices := append([]string{"safe"}, categories...)
+
+	results := make([]*api.ModerationResult, len(texts))
+	for i, text := range texts {
+		prompt, err := loadedModerator.Prompt(PromptVars{
+			System: moderationSystem(categories),
+			Prompt: text,
+			First:  true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		scores, _, err := classify(ctx, loadedModerator.runner, prompt, choices)
+		if err != nil {
+			return nil, err
+		}
+
+		results[i] = moderationResult(scores, m.threshold())
+	}
+
+	return results, nil
+}
+
+// moderateInput moderates the input of a generation when moderation runs at the prompt stage
+func moderateInput(c *gin.Context, text string) (*api.ModerationResult, error) {
+	if !moderation.Handles(HookStagePrompt) || text == "" {
+		return nil, nil
+	}
+
+	results, err := moderation.moderate(c.Request.Context(), c.GetString("workDir"), []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("moderation: %w", err)
+	}
+
+	return results[0], moderation.flagged(results[0])
+}
+
+// chatInput is the text moderated of a chat request, the content of its user messages
+func chatInput(messages []api.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		if m.Role == "user" && m.Content != "" {
+			if sb.Len() > 0 {
+				sb.WriteString("\n\n")
+			}
+
+			sb.WriteString(m.Content)
+		}
+	}
+
+	return sb.String()
+}
+
+// moderationInputs reads the input of a moderation request, which is a string or a list of strings
+func moderationInputs(input any) ([]string, error) {
+	switch input := input.(type) {
+	case string:
+		return []string{input}, nil
+	case []any:
+		texts := make([]string, len(input))
+		for i, v := range input {
+			text, ok := v.(string)
+			if !ok {
+				return nil, errors.New("input must be a string or a list of strings")
+			}
+
+			texts[i] = text
+		}
+
+		return texts, nil
+	}
+
+	return nil, errors.New("input must be a string or a list of strings")
+}
+
+// ModerationHandler implements the OpenAI compatible /v1/moderations endpoint
+func ModerationHandler(c *gin.Context) {
+	var req api.ModerationRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	texts, err := moderationInputs(req.Input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the configured moderation model and categories are used unless the request names a model
+	config := moderationConfig{Model: req.Model}
+	if moderation != nil {
+		config = *moderation
+		if req.Model != "" {
+			config.Model = req.Model
+		}
+	}
+
+	if config.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	results, err := config.moderate(c.Request.Context(), c.GetString("workDir"), texts)
+	if err != nil {
+		var pErr *fs.PathError
+		var invalid invalidChoicesError
+		switch {
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", config.Model)})
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("moderation failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := api.ModerationResponse{
+		ID:      "modr-" + hex.EncodeToString(id),
+		Model:   config.Model,
+		Results: make([]api.ModerationResult, len(results)),
+	}
+
+	for i, result := range results {
+		resp.Results[i] = *result
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
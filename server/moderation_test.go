@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestLoadModerationConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moderation.json")
+	t.Setenv("OLLAMA_MODERATION", path)
+
+	config, err := loadModerationConfig()
+	require.NoError(t, err)
+	assert.Nil(t, config)
+	assert.False(t, config.Handles(HookStagePrompt))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"model": "llama-guard", "stages": ["response"]}`), 0o644))
+	config, err = loadModerationConfig()
+	require.NoError(t, err)
+	assert.False(t, config.Handles(HookStagePrompt))
+	assert.True(t, config.Handles(HookStageResponse))
+	assert.Equal(t, defaultModerationCategories, config.categories())
+	assert.Equal(t, 0.5, config.threshold())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"threshold": 0.9}`), 0o644))
+	_, err = loadModerationConfig()
+	assert.ErrorContains(t, err, "moderation is missing a model")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"model": "llama-guard", "threshold": 2}`), 0o644))
+	_, err = loadModerationConfig()
+	assert.ErrorContains(t, err, "threshold must be between 0 and 1")
+}
+
+func TestModerationResult(t *testing.T) {
+	config := &moderationConfig{Model: "llama-guard", Threshold: 0.6, Block: true}
+
+	result := moderationResult([]api.ClassifyChoice{
+		{Choice: "safe", Probability: 0.1},
+		{Choice: "hate", Probability: 0.2},
+		{Choice: "violence", Probability: 0.7},
+	}, config.threshold())
+
+	assert.True(t, result.Flagged)
+	assert.Equal(t, map[string]bool{"hate": false, "violence": true}, result.Categories)
+	assert.Equal(t, map[string]float64{"hate": 0.2, "violence": 0.7}, result.CategoryScores)
+	assert.EqualError(t, config.flagged(result), "flagged by moderation as violence")
+
+	// flagged results are only annotated unless they are blocked
+	config.Block = false
+	assert.NoError(t, config.flagged(result))
+
+	result = moderationResult([]api.ClassifyChoice{{Choice: "safe", Probability: 0.9}, {Choice: "hate", Probability: 0.1}}, config.threshold())
+	assert.False(t, result.Flagged)
+}
+
+func TestModerationInputs(t *testing.T) {
+	texts, err := moderationInputs("hello")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello"}, texts)
+
+	texts, err = moderationInputs([]any{"hello", "world"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello", "world"}, texts)
+
+	_, err = moderationInputs([]any{"hello", 1})
+	assert.EqualError(t, err, "input must be a string or a list of strings")
+
+	_, err = moderationInputs(nil)
+	assert.Error(t, err)
+}
+
+func TestChatInput(t *testing.T) {
+	assert.Equal(t, "hi\n\nhow are you?", chatInput([]api.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: "how are you?"},
+	}))
+}
+
+func TestModerationHandlerModelRequired(t *testing.T) {
+	original := moderation
+	t.Cleanup(func() { moderation = original })
+	moderation = nil
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/moderations", ModerationHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/moderations", bytes.NewBufferString(`{"input": "hello"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "model is required")
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+var errOffline = errors.New("ollama is offline, models can't be pulled or pushed while OLLAMA_OFFLINE is set")
+
+// offline reports whether $OLLAMA_OFFLINE is set, an offline server only uses the models it has and never
+// contacts a registry
+func offline() bool {
+	v, _ := strconv.ParseBool(os.Getenv("OLLAMA_OFFLINE"))
+	return v
+}
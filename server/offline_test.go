@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestOffline(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	var requests int
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer registry.Close()
+
+	u, err := url.Parse(registry.URL)
+	require.NoError(t, err)
+
+	t.Setenv("OLLAMA_OFFLINE", "1")
+	assert.True(t, offline())
+
+	_, err = makeRequest(context.Background(), http.MethodGet, u, nil, nil, nil)
+	assert.ErrorIs(t, err, errOffline)
+
+	err = PullModel(context.Background(), u.Host+"/library/llama2:7b", &RegistryOptions{Insecure: true}, func(api.ProgressResponse) {})
+	assert.ErrorIs(t, err, errOffline)
+	assert.Zero(t, requests)
+
+	t.Setenv("OLLAMA_OFFLINE", "0")
+	assert.False(t, offline())
+
+	resp, err := makeRequest(context.Background(), http.MethodGet, u, nil, nil, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, requests)
+}
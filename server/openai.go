@@ -0,0 +1,841 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+	"github.com/jmorganca/ollama/version"
+)
+
+// openaiStrings reads a field of an OpenAI request which is a string or a list of strings
+func openaiStrings(field string, v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		s := make([]string, len(v))
+		for i, e := range v {
+			text, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a string or a list of strings", field)
+			}
+
+			s[i] = text
+		}
+
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("%s must be a string or a list of strings", field)
+}
+
+// openaiOptions translates the sampling parameters of an OpenAI request into options
+func openaiOptions(req api.CompletionOptions) (map[string]interface{}, error) {
+	stop, err := openaiStrings("stop", req.Stop)
+	if err != nil {
+		return nil, err
+	}
+
+	options := make(map[string]interface{})
+	if req.MaxTokens != nil {
+		options["num_predict"] = *req.MaxTokens
+	}
+
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+
+	if req.TopP != nil {
+		options["top_p"] = *req.TopP
+	}
+
+	if req.PresencePenalty != nil {
+		options["presence_penalty"] = *req.PresencePenalty
+	}
+
+	if req.FrequencyPenalty != nil {
+		options["frequency_penalty"] = *req.FrequencyPenalty
+	}
+
+	if req.Seed != nil {
+		options["seed"] = *req.Seed
+	}
+
+	if len(stop) > 0 {
+		options["stop"] = stop
+	}
+
+	return options, nil
+}
+
+// openaiContent reads the content of an OpenAI chat message, a string or a list of text parts
+func openaiContent(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []any:
+		var sb strings.Builder
+		for _, e := range v {
+			part, ok := e.(map[string]any)
+			if !ok || part["type"] != "text" {
+				return "", errors.New("only text content is supported")
+			}
+
+			text, _ := part["text"].(string)
+			sb.WriteString(text)
+		}
+
+		return sb.String(), nil
+	}
+
+	return "", errors.New("content must be a string or a list of text parts")
+}
+
+// CompletionHandler implements the OpenAI compatible /v1/completions endpoint. The request is turned into a raw
+// generate request, as completion models expect the prompt as it is, or an infill request if it has a suffix,
+// and the handler's responses are rewritten as completions.
+func CompletionHandler(c *gin.Context) {
+	var req api.CompletionRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prompts, err := openaiStrings("prompt", req.Prompt)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(prompts) > 1 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "only one prompt is supported"})
+		return
+	}
+
+	options, err := openaiOptions(req.CompletionOptions)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var prompt string
+	if len(prompts) > 0 {
+		prompt = prompts[0]
+	}
+
+	w := &completionWriter{
+		model:        req.Model,
+		stream:       req.Stream,
+		includeUsage: req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+	}
+
+	// a completion with a suffix fills in the middle between the prompt and the suffix
+	if req.Suffix != "" {
+		serveCompletion(c, []any{api.InfillRequest{
+			Model:   req.Model,
+			Prefix:  prompt,
+			Suffix:  req.Suffix,
+			Stream:  &req.Stream,
+			Options: options,
+		}}, w, InfillHandler)
+		return
+	}
+
+	generate := apix.NewGenerateRequest(api.GenerateRequest{
+		Model:   req.Model,
+		Prompt:  prompt,
+		Raw:     true,
+		Stream:  &req.Stream,
+		Options: options,
+	})
+
+	serveCompletion(c, []any{generate}, w, GenerateHandler)
+}
+
+// ChatCompletionHandler implements the OpenAI compatible /v1/chat/completions endpoint. The request is turned
+// into a chat request and ChatHandler's responses are rewritten as chat completions.
+func ChatCompletionHandler(c *gin.Context) {
+	var req api.ChatCompletionRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, err := openaiOptions(req.CompletionOptions)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	messages, err := openaiMessages(req.Messages)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tools, required, err := openaiTools(req.Tools, req.ToolChoice)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(tools) > 0 {
+		messages = toolSystem(messages, tools, required)
+	}
+
+	chat := apix.NewChatRequest(api.ChatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   &req.Stream,
+		Options:  options,
+	})
+
+	chat.Logprobs = req.Logprobs
+	if req.TopLogprobs != nil {
+		chat.TopLogprobs = *req.TopLogprobs
+	}
+
+	if err := openaiResponseFormat(chat, req.ResponseFormat); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+
+	if n < 1 || n > maxChoices {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("n must be between 1 and %d", maxChoices)})
+		return
+	}
+
+	// each choice is a generation of its own, with the next seed so that seeded choices differ
+	chats := make([]any, n)
+	for i := range chats {
+		choice := *chat
+		if req.Seed != nil && i > 0 {
+			choice.Options = make(map[string]interface{}, len(options))
+			for k, v := range options {
+				choice.Options[k] = v
+			}
+
+			choice.Options["seed"] = *req.Seed + i
+		}
+
+		chats[i] = &choice
+	}
+
+	serveCompletion(c, chats, &completionWriter{
+		model:        req.Model,
+		stream:       req.Stream,
+		includeUsage: req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+		chat:         true,
+		tools:        tools,
+		logprobs:     req.Logprobs,
+	}, ChatHandler)
+}
+
+// openaiResponseFormat constrains the reply of chat to the format: json_object is the json format and the
+// schema of json_schema is compiled to a grammar
+func openaiResponseFormat(chat *apix.ChatRequest, format *api.ResponseFormat) error {
+	if format == nil {
+		return nil
+	}
+
+	switch format.Type {
+	case "", "text":
+	case "json_object":
+		chat.Format = "json"
+	case "json_schema":
+		if format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 {
+			return errors.New("response_format json_schema requires a json_schema with a schema")
+		}
+
+		chat.Schema = format.JSONSchema.Schema
+	default:
+		return fmt.Errorf("unknown response_format type '%s', expected \"text\", \"json_object\" or \"json_schema\"", format.Type)
+	}
+
+	return nil
+}
+
+// maxChoices is the most choices a chat completion can ask for, as with OpenAI
+const maxChoices = 128
+
+// completionIDLength is the number of random base62 characters after the prefix of a completion's ID
+const completionIDLength = 24
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// completionID is the prefix followed by random base62 characters, shared by every chunk of a stream
+func completionID(prefix string) (string, error) {
+	id := make([]byte, 0, len(prefix)+completionIDLength)
+	id = append(id, prefix...)
+
+	b := make([]byte, completionIDLength)
+	for len(id) < cap(id) {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+
+		for _, c := range b {
+			// bytes past the largest multiple of 62 are skipped so every character is as likely
+			if c < 248 && len(id) < cap(id) {
+				id = append(id, base62[c%62])
+			}
+		}
+	}
+
+	return string(id), nil
+}
+
+// systemFingerprint identifies the model and the server version generating a completion, so clients can
+// tell when either changes
+func systemFingerprint(digest string) string {
+	sum := sha256.Sum256([]byte(digest + "\x00" + version.Version))
+	return "fp_" + hex.EncodeToString(sum[:5])
+}
+
+// serveCompletion calls handler with each of reqs as the request body in turn, rewriting its responses with w
+// as the choices of completions, or of chat completions if w.chat is set. Chat completions which are calls of
+// tools are returned as tool calls. The choices of a stream are sent one after the other, otherwise they are
+// returned together once all are generated.
+func serveCompletion(c *gin.Context, reqs []any, w *completionWriter, handler gin.HandlerFunc) {
+	prefix := "cmpl-"
+	if w.chat {
+		prefix = "chatcmpl-"
+	}
+
+	id, err := completionID(prefix)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	w.ResponseWriter = c.Writer
+	w.id = id
+	w.created = time.Now().Unix()
+
+	// a model which can't be found is left to the handler to report
+	if model, err := GetModel(w.model); err == nil {
+		w.fingerprint = systemFingerprint(model.Digest)
+	}
+
+	c.Writer = w
+	for i, req := range reqs {
+		bts, err := json.Marshal(req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		w.index = i
+		w.held.Reset()
+		w.heldLogprobs = nil
+		w.released = false
+		w.buf = nil
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(bts))
+		handler(c)
+
+		if w.status >= http.StatusBadRequest || w.failed {
+			break
+		}
+	}
+
+	if !w.stream {
+		if w.status < http.StatusBadRequest {
+			w.writeChoices()
+		}
+
+		return
+	}
+
+	if !w.started {
+		return
+	}
+
+	if w.includeUsage && !w.failed && w.usage != nil {
+		bts, err := json.Marshal(w.usageChunk())
+		if err == nil {
+			w.data(bts)
+		}
+	}
+
+	// clients read until [DONE], it is sent after an error too
+	w.data([]byte("[DONE]"))
+}
+
+// completionWriter rewrites the generate or chat responses written to it as completions, server-sent events
+// when they are streamed. Errors are written as they are.
+type completionWriter struct {
+	gin.ResponseWriter
+
+	id          string
+	fingerprint string
+	model       string
+	created     int64
+	stream      bool
+	chat        bool
+	tools       []api.Tool
+
+	// logprobs adds the log probabilities of the tokens to the choices of chat completions
+	logprobs bool
+
+	// includeUsage sends the usage of a stream in a last chunk without choices
+	includeUsage bool
+
+	// index is the choice being generated, usage counts the tokens of the choices generated so far
+	index int
+	usage *api.CompletionUsage
+
+	// choices are the completions of each choice when they aren't streamed, written together at the end
+	choices []any
+
+	status int
+	buf    []byte
+
+	// started is set once the stream has been sent to, errors after that are sent as events. failed is set by
+	// an error sent as an event, which ends the stream.
+	started bool
+	failed  bool
+
+	// held is the text held back while it may still be tool calls, released once it can't be, with the log
+	// probabilities of its tokens
+	held         strings.Builder
+	heldLogprobs []api.TokenLogprob
+	released     bool
+}
+
+// completionResponse has the fields of a generate or a chat response
+type completionResponse struct {
+	api.GenerateResponse
+
+	Message  *api.Message       `json:"message,omitempty"`
+	Logprobs []api.TokenLogprob `json:"logprobs,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+func (r completionResponse) text() string {
+	if r.Message != nil {
+		return r.Message.Content
+	}
+
+	return r.Response
+}
+
+func (r *completionResponse) setText(text string) {
+	if r.Message != nil {
+		r.Message.Content = text
+	} else {
+		r.Response = text
+	}
+}
+
+// holdToolCalls holds back the text of the responses while it may still be tool calls. The tool calls are
+// returned once the response is done, otherwise the text held back is sent on.
+func (w *completionWriter) holdToolCalls(resp *completionResponse) []api.ToolCall {
+	if len(w.tools) == 0 || w.released {
+		return nil
+	}
+
+	w.held.WriteString(resp.text())
+	w.heldLogprobs = append(w.heldLogprobs, resp.Logprobs...)
+
+	var text string
+	var logprobs []api.TokenLogprob
+	switch {
+	case resp.Done:
+		if calls, ok := parseToolCalls(w.held.String(), w.tools); ok {
+			resp.setText("")
+			resp.Logprobs = nil
+			return calls
+		}
+
+		text, logprobs = w.held.String(), w.heldLogprobs
+	case !mightBeToolCalls(w.held.String()):
+		text, logprobs = w.held.String(), w.heldLogprobs
+		w.released = true
+	}
+
+	resp.setText(text)
+	resp.Logprobs = logprobs
+	return nil
+}
+
+func (w *completionWriter) WriteHeader(status int) {
+	w.status = status
+	if !w.started {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *completionWriter) Write(b []byte) (int, error) {
+	if w.status >= http.StatusBadRequest {
+		if w.started {
+			// a later choice failed once the stream was sent to, the error is an event like those of the runner
+			w.failed = true
+			if err := w.data(bytes.TrimSpace(b)); err != nil {
+				return 0, err
+			}
+
+			return len(b), nil
+		}
+
+		return w.ResponseWriter.Write(b)
+	}
+
+	if !w.stream {
+		var resp completionResponse
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return 0, err
+		}
+
+		calls := w.holdToolCalls(&resp)
+		w.count(resp)
+		w.choices = append(w.choices, w.completion(resp, calls))
+		return len(b), nil
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx and proxies like it would otherwise hold back events until they have a buffer's worth
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// the stream is newline delimited json, a line may be split over writes
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := w.buf[:i]
+		w.buf = w.buf[i+1:]
+
+		if err := w.event(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// event writes a line of the stream as a server-sent event
+func (w *completionWriter) event(line []byte) error {
+	var resp completionResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return err
+	}
+
+	calls := w.holdToolCalls(&resp)
+	var data any = w.completion(resp, calls)
+	switch {
+	case resp.Error != "":
+		data = gin.H{"error": resp.Error}
+		w.failed = true
+	case !resp.Done && resp.text() == "":
+		// load progress, keepalives and text held back have no text, a comment keeps the connection open instead
+		w.started = true
+		return w.send([]byte(": keepalive\n\n"))
+	}
+
+	bts, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.count(resp)
+	w.started = true
+	return w.data(bts)
+}
+
+// data sends a server-sent event with the data, which is a single line
+func (w *completionWriter) data(b []byte) error {
+	event := make([]byte, 0, len(b)+8)
+	event = append(event, "data: "...)
+	event = append(event, b...)
+	event = append(event, "\n\n"...)
+	return w.send(event)
+}
+
+// send writes an event and flushes it, so that it reaches the client as it is sent rather than when the
+// handler flushes, or once the response ends for the events sent after the handler has returned
+func (w *completionWriter) send(event []byte) error {
+	if _, err := w.ResponseWriter.Write(event); err != nil {
+		return err
+	}
+
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// count adds the tokens of a choice's final response to the usage. The prompt is counted once, as it's the
+// same for every choice.
+func (w *completionWriter) count(resp completionResponse) {
+	if !resp.Done || resp.Error != "" {
+		return
+	}
+
+	if w.usage == nil {
+		w.usage = &api.CompletionUsage{PromptTokens: resp.PromptEvalCount}
+	}
+
+	w.usage.CompletionTokens += resp.EvalCount
+	w.usage.TotalTokens = w.usage.PromptTokens + w.usage.CompletionTokens
+}
+
+// usageChunk is the last chunk of a stream which asks for its usage, it has no choices
+func (w *completionWriter) usageChunk() any {
+	if w.chat {
+		return api.ChatCompletionResponse{
+			ID:                w.id,
+			Object:            "chat.completion.chunk",
+			Created:           w.created,
+			Model:             w.model,
+			SystemFingerprint: w.fingerprint,
+			Choices:           []api.ChatCompletionChoice{},
+			Usage:             w.usage,
+		}
+	}
+
+	return api.CompletionResponse{
+		ID:                w.id,
+		Object:            "text_completion",
+		Created:           w.created,
+		Model:             w.model,
+		SystemFingerprint: w.fingerprint,
+		Choices:           []api.CompletionChoice{},
+		Usage:             w.usage,
+	}
+}
+
+// writeChoices writes the completions of the choices which weren't streamed as one completion with their usage
+func (w *completionWriter) writeChoices() {
+	if len(w.choices) == 0 {
+		return
+	}
+
+	var completion any
+	switch first := w.choices[0].(type) {
+	case api.ChatCompletionResponse:
+		for _, choice := range w.choices[1:] {
+			first.Choices = append(first.Choices, choice.(api.ChatCompletionResponse).Choices...)
+		}
+
+		first.Usage = w.usage
+		completion = first
+	case api.CompletionResponse:
+		for _, choice := range w.choices[1:] {
+			first.Choices = append(first.Choices, choice.(api.CompletionResponse).Choices...)
+		}
+
+		first.Usage = w.usage
+		completion = first
+	}
+
+	bts, err := json.Marshal(completion)
+	if err != nil {
+		w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+		bts, _ = json.Marshal(gin.H{"error": err.Error()})
+	}
+
+	w.ResponseWriter.Write(bts)
+}
+
+// completion is the completion of the choice being generated with the text of resp, without its usage
+func (w *completionWriter) completion(resp completionResponse, calls []api.ToolCall) any {
+	var reason *string
+	if resp.Done {
+		r := resp.FinishReason
+		if r == "" {
+			r = "stop"
+		}
+
+		reason = &r
+	}
+
+	if !w.chat {
+		return api.CompletionResponse{
+			ID:                w.id,
+			Object:            "text_completion",
+			Created:           w.created,
+			Model:             w.model,
+			SystemFingerprint: w.fingerprint,
+			Choices:           []api.CompletionChoice{{Text: resp.text(), Index: w.index, FinishReason: reason}},
+		}
+	}
+
+	msg := &api.ChatCompletionMessage{Role: "assistant", Content: resp.text()}
+	if len(calls) > 0 {
+		r := "tool_calls"
+		reason = &r
+		msg.Content = nil
+		msg.ToolCalls = calls
+	}
+
+	choice := api.ChatCompletionChoice{Index: w.index, Message: msg, FinishReason: reason}
+	object := "chat.completion"
+	if w.stream {
+		choice = api.ChatCompletionChoice{Index: w.index, Delta: msg, FinishReason: reason}
+		object = "chat.completion.chunk"
+	}
+
+	// the last chunk of a stream has no tokens, and a reply which calls tools has no content to have them of
+	if w.logprobs && len(calls) == 0 && (!w.stream || len(resp.Logprobs) > 0) {
+		choice.Logprobs = openaiLogprobs(resp.Logprobs)
+	}
+
+	return api.ChatCompletionResponse{
+		ID:                w.id,
+		Object:            object,
+		Created:           w.created,
+		Model:             w.model,
+		SystemFingerprint: w.fingerprint,
+		Choices:           []api.ChatCompletionChoice{choice},
+	}
+}
+
+// EmbeddingsHandler implements the OpenAI compatible /v1/embeddings endpoint. The inputs are embedded as a
+// batch, normalized as OpenAI's embeddings are, and BatchEmbeddingHandler's response is rewritten as a list
+// of embeddings.
+func EmbeddingsHandler(c *gin.Context) {
+	var req api.EmbeddingsRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input, err := openaiStrings("input", req.Input)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(input) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "input is required"})
+		return
+	}
+
+	switch req.EncodingFormat {
+	case "", "float", "base64":
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown encoding_format '%s', expected \"float\" or \"base64\"", req.EncodingFormat)})
+		return
+	}
+
+	bts, err := json.Marshal(api.BatchEmbeddingRequest{
+		Model:      req.Model,
+		Prompts:    input,
+		Dimensions: req.Dimensions,
+		Normalize:  true,
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(bts))
+	c.Writer = &embeddingsWriter{ResponseWriter: c.Writer, model: req.Model, base64: req.EncodingFormat == "base64"}
+	BatchEmbeddingHandler(c)
+}
+
+// embeddingsWriter rewrites the batch embedding response written to it as OpenAI embeddings. Errors are
+// written as they are.
+type embeddingsWriter struct {
+	gin.ResponseWriter
+
+	model  string
+	base64 bool
+
+	status int
+}
+
+func (w *embeddingsWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *embeddingsWriter) Write(b []byte) (int, error) {
+	if w.status >= http.StatusBadRequest {
+		return w.ResponseWriter.Write(b)
+	}
+
+	var resp api.BatchEmbeddingResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return 0, err
+	}
+
+	embeddings := api.EmbeddingsResponse{
+		Object: "list",
+		Data:   make([]api.EmbeddingData, len(resp.Embeddings)),
+		Model:  w.model,
+		Usage:  api.EmbeddingsUsage{PromptTokens: resp.Tokens, TotalTokens: resp.Tokens},
+	}
+
+	for i, embedding := range resp.Embeddings {
+		var data any = embedding
+		if w.base64 {
+			data = base64Embedding(embedding)
+		}
+
+		embeddings.Data[i] = api.EmbeddingData{Object: "embedding", Embedding: data, Index: i}
+	}
+
+	bts, err := json.Marshal(embeddings)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := w.ResponseWriter.Write(bts); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// base64Embedding encodes an embedding as OpenAI does, little endian float32s in base64
+func base64Embedding(embedding []float64) string {
+	b := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(float32(v)))
+	}
+
+	return base64.StdEncoding.EncodeToString(b)
+}
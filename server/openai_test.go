@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestOpenAIOptions(t *testing.T) {
+	var req api.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "llama2",
+		"messages": [{"role": "user", "content": "hi"}],
+		"max_tokens": 64,
+		"temperature": 0.2,
+		"top_p": 0.9,
+		"presence_penalty": 0.5,
+		"frequency_penalty": 1.5,
+		"seed": 42,
+		"stop": ["\n\n", "User:"]
+	}`), &req))
+
+	options, err := openaiOptions(req.CompletionOptions)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"num_predict":       64,
+		"temperature":       float32(0.2),
+		"top_p":             float32(0.9),
+		"presence_penalty":  float32(0.5),
+		"frequency_penalty": float32(1.5),
+		"seed":              42,
+		"stop":              []string{"\n\n", "User:"},
+	}, options)
+
+	// the options are valid for the model
+	var opts api.Options
+	require.NoError(t, opts.FromMap(options))
+	assert.Equal(t, 42, opts.Seed)
+	assert.Equal(t, float32(1.5), opts.FrequencyPenalty)
+
+	// parameters which aren't sent keep the model's defaults
+	options, err = openaiOptions(api.CompletionOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, options)
+
+	_, err = openaiOptions(api.CompletionOptions{Stop: 1})
+	assert.Error(t, err)
+}
+
+func TestOpenAIContent(t *testing.T) {
+	content, err := openaiContent("hi")
+	require.NoError(t, err)
+	assert.Equal(t, "hi", content)
+
+	content, err = openaiContent([]any{map[string]any{"type": "text", "text": "hello "}, map[string]any{"type": "text", "text": "there"}})
+	require.NoError(t, err)
+	assert.Equal(t, "hello there", content)
+
+	_, err = openaiContent([]any{map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/llama.png"}}})
+	assert.Error(t, err)
+}
+
+func TestCompletionID(t *testing.T) {
+	ids := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := completionID("chatcmpl-")
+		require.NoError(t, err)
+		assert.Regexp(t, "^chatcmpl-[0-9A-Za-z]{24}$", id)
+		assert.False(t, ids[id], id)
+		ids[id] = true
+	}
+}
+
+func TestSystemFingerprint(t *testing.T) {
+	fp := systemFingerprint("sha256:abc")
+	assert.Regexp(t, "^fp_[0-9a-f]{10}$", fp)
+	assert.Equal(t, fp, systemFingerprint("sha256:abc"))
+	assert.NotEqual(t, fp, systemFingerprint("sha256:def"))
+}
+
+// flushRecorder counts the flushes of the response
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestCompletionStreamEvents(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	// the handler's stream is never flushed, the events are flushed as they are sent
+	w := &completionWriter{model: "test", stream: true, chat: true, includeUsage: true}
+	serveCompletion(c, []any{struct{}{}}, w, func(c *gin.Context) {
+		c.Writer.Write([]byte(`{"message": {"role": "assistant", "content": "hi"}, "done": false}` + "\n"))
+		c.Writer.Write([]byte(`{"message": {"role": "assistant", "content": ""}, "done": true, "eval_count": 1}` + "\n"))
+	})
+
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "no", rec.Header().Get("X-Accel-Buffering"))
+
+	events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n\n"), "\n\n")
+	require.Len(t, events, 4)
+	assert.Equal(t, "data: [DONE]", events[3])
+	assert.Equal(t, 4, rec.flushes)
+
+	for _, event := range events[:3] {
+		data, ok := strings.CutPrefix(event, "data: ")
+		require.True(t, ok, event)
+		assert.NotContains(t, data, "\n")
+
+		var chunk api.ChatCompletionResponse
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		assert.Equal(t, w.id, chunk.ID)
+	}
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+	"github.com/jmorganca/ollama/version"
+)
+
+//go:generate go run ./internal/openapigen openapi.json
+
+// openapiDocument is the OpenAPI document generated from openapiRoutes and the api types. TestOpenAPI fails if
+// it is out of date, regenerate it with go generate ./server.
+//
+//go:embed openapi.json
+var openapiDocument []byte
+
+// openapiRoute documents a route. Request and Response are values of the types of its bodies, nil if it has
+// none, which are described in the document by the json encoding of their fields.
+type openapiRoute struct {
+	Method, Path string
+	Summary      string
+
+	Request  any
+	Response any
+
+	// Stream is set for routes which stream their responses as newline delimited json unless the request
+	// sets stream to false
+	Stream bool
+
+	// Idempotent is set for routes which accept an Idempotency-Key header
+	Idempotent bool
+
+	// RequestType and ResponseType are the content types of bodies which aren't json
+	RequestType, ResponseType string
+}
+
+// openapiFile is a body or form field which is a file
+type openapiFile []byte
+
+// transcriptionForm is the multipart form of /v1/audio/transcriptions
+type transcriptionForm struct {
+	Model          string      `json:"model"`
+	File           openapiFile `json:"file"`
+	Language       string      `json:"language,omitempty"`
+	Prompt         string      `json:"prompt,omitempty"`
+	Temperature    float32     `json:"temperature,omitempty"`
+	ResponseFormat string      `json:"response_format,omitempty"`
+}
+
+// openapiRoutes are the routes served by GenerateRoutes. Add new routes here too, TestOpenAPI fails if a route
+// is missing.
+var openapiRoutes = []openapiRoute{
+	{Method: http.MethodPost, Path: "/api/generate", Summary: "Generate a completion", Request: apix.GenerateRequest{}, Response: api.GenerateResponse{}, Stream: true},
+	{Method: http.MethodPost, Path: "/api/chat", Summary: "Generate a chat completion", Request: apix.ChatRequest{}, Response: api.ChatResponse{}, Stream: true},
+	{Method: http.MethodPost, Path: "/api/load", Summary: "Load a model", Request: api.LoadRequest{}, Response: api.LoadResponse{}, Stream: true},
+	{Method: http.MethodPost, Path: "/api/infill", Summary: "Fill in the middle", Request: api.InfillRequest{}, Response: api.GenerateResponse{}, Stream: true},
+	{Method: http.MethodPost, Path: "/api/classify", Summary: "Classify a prompt", Request: api.ClassifyRequest{}, Response: api.ClassifyResponse{}},
+	{Method: http.MethodPost, Path: "/api/embeddings", Summary: "Generate embeddings", Request: api.EmbeddingRequest{}, Response: api.EmbeddingResponse{}},
+	{Method: http.MethodPost, Path: "/api/embeddings/batch", Summary: "Generate embeddings in a batch", Request: api.BatchEmbeddingRequest{}, Response: api.BatchEmbeddingResponse{}},
+	{Method: http.MethodPost, Path: "/api/chunk", Summary: "Chunk text", Request: api.ChunkRequest{}, Response: api.ChunkResponse{}},
+	{Method: http.MethodPost, Path: "/api/tokenize", Summary: "Tokenize text", Request: api.TokenizeRequest{}, Response: api.TokenizeResponse{}},
+	{Method: http.MethodPost, Path: "/api/detokenize", Summary: "Detokenize tokens", Request: api.DetokenizeRequest{}, Response: api.DetokenizeResponse{}},
+
+	{Method: http.MethodPost, Path: "/api/create", Summary: "Create a model", Request: api.CreateRequest{}, Response: api.ProgressResponse{}, Stream: true, Idempotent: true},
+	{Method: http.MethodPost, Path: "/api/pull", Summary: "Pull a model", Request: api.PullRequest{}, Response: api.ProgressResponse{}, Stream: true, Idempotent: true},
+	{Method: http.MethodPost, Path: "/api/push", Summary: "Push a model", Request: api.PushRequest{}, Response: api.ProgressResponse{}, Stream: true, Idempotent: true},
+	{Method: http.MethodPost, Path: "/api/show", Summary: "Show model information", Request: api.ShowRequest{}, Response: api.ShowResponse{}},
+	{Method: http.MethodPost, Path: "/api/copy", Summary: "Copy a model", Request: api.CopyRequest{}},
+	{Method: http.MethodDelete, Path: "/api/delete", Summary: "Delete a model", Request: api.DeleteRequest{}},
+	{Method: http.MethodPost, Path: "/api/restore", Summary: "Restore a deleted model", Request: api.RestoreRequest{}},
+	{Method: http.MethodGet, Path: "/api/trash", Summary: "List deleted models", Response: api.TrashResponse{}},
+	{Method: http.MethodGet, Path: "/api/tags", Summary: "List local models", Response: api.ListResponse{}},
+	{Method: http.MethodHead, Path: "/api/tags", Summary: "Check the server is running"},
+	{Method: http.MethodGet, Path: "/api/ps", Summary: "List running models", Response: api.ProcessResponse{}},
+	{Method: http.MethodPost, Path: "/api/blobs/{digest}", Summary: "Create a blob", Request: openapiFile{}, RequestType: "application/octet-stream"},
+	{Method: http.MethodHead, Path: "/api/blobs/{digest}", Summary: "Check a blob exists"},
+	{Method: http.MethodPost, Path: "/api/shares", Summary: "Share a model", Request: api.ShareRequest{}, Response: api.ShareResponse{}},
+	{Method: http.MethodGet, Path: "/api/shares/{token}", Summary: "Download a shared model", Response: openapiFile{}, ResponseType: shareArchiveType},
+	{Method: http.MethodHead, Path: "/api/shares/{token}", Summary: "Check a share exists"},
+
+	{Method: http.MethodGet, Path: "/api/presets", Summary: "List presets", Response: api.ListPresetsResponse{}},
+	{Method: http.MethodPost, Path: "/api/presets", Summary: "Create a preset", Request: api.Preset{}, Response: api.Preset{}},
+	{Method: http.MethodGet, Path: "/api/presets/{name}", Summary: "Get a preset", Response: api.Preset{}},
+	{Method: http.MethodDelete, Path: "/api/presets/{name}", Summary: "Delete a preset"},
+	{Method: http.MethodGet, Path: "/api/conversations", Summary: "List conversations", Response: api.ListConversationsResponse{}},
+	{Method: http.MethodPost, Path: "/api/conversations", Summary: "Create a conversation", Request: api.CreateConversationRequest{}, Response: api.Conversation{}},
+	{Method: http.MethodGet, Path: "/api/conversations/{id}", Summary: "Get a conversation", Response: api.Conversation{}},
+	{Method: http.MethodDelete, Path: "/api/conversations/{id}", Summary: "Delete a conversation"},
+	{Method: http.MethodGet, Path: "/api/collections", Summary: "List collections", Response: api.ListCollectionsResponse{}},
+	{Method: http.MethodPost, Path: "/api/collections", Summary: "Create a collection", Request: api.CreateCollectionRequest{}, Response: api.Collection{}},
+	{Method: http.MethodDelete, Path: "/api/collections/{name}", Summary: "Delete a collection"},
+	{Method: http.MethodPost, Path: "/api/collections/{name}/documents", Summary: "Add documents to a collection", Request: api.UpsertDocumentsRequest{}, Response: api.Collection{}},
+	{Method: http.MethodPost, Path: "/api/collections/{name}/query", Summary: "Query a collection", Request: api.QueryCollectionRequest{}, Response: api.QueryCollectionResponse{}},
+
+	{Method: http.MethodGet, Path: "/api/metrics", Summary: "Server metrics", Response: api.MetricsResponse{}},
+	{Method: http.MethodGet, Path: "/api/egress", Summary: "Network destinations", Response: api.EgressResponse{}},
+	{Method: http.MethodGet, Path: "/api/licenses", Summary: "List accepted licenses", Response: api.ListLicensesResponse{}},
+	{Method: http.MethodPost, Path: "/api/logs", Summary: "Read the server log", Request: api.LogsRequest{}, Response: api.LogsResponse{}, ResponseType: "application/x-ndjson"},
+	{Method: http.MethodGet, Path: "/api/version", Summary: "Version", Response: api.VersionResponse{}},
+	{Method: http.MethodHead, Path: "/api/version", Summary: "Check the server is running"},
+	{Method: http.MethodGet, Path: "/api/openapi.json", Summary: "This document", Response: map[string]any{}},
+	{Method: http.MethodGet, Path: "/", Summary: "Check the server is running", Response: "", ResponseType: "text/plain"},
+	{Method: http.MethodHead, Path: "/", Summary: "Check the server is running"},
+
+	{Method: http.MethodPost, Path: "/v1/audio/transcriptions", Summary: "Transcribe audio, compatible with OpenAI", Request: transcriptionForm{}, RequestType: "multipart/form-data", Response: api.TranscriptionResponse{}},
+	{Method: http.MethodPost, Path: "/v1/images/generations", Summary: "Generate images, compatible with OpenAI", Request: api.ImageGenerateRequest{}, Response: api.ImageGenerateResponse{}},
+	{Method: http.MethodPost, Path: "/v1/moderations", Summary: "Moderate text, compatible with OpenAI", Request: api.ModerationRequest{}, Response: api.ModerationResponse{}},
+	{Method: http.MethodPost, Path: "/v1/completions", Summary: "Complete text, compatible with OpenAI", Request: api.CompletionRequest{}, Response: api.CompletionResponse{}},
+	{Method: http.MethodPost, Path: "/v1/chat/completions", Summary: "Complete a chat, compatible with OpenAI", Request: api.ChatCompletionRequest{}, Response: api.ChatCompletionResponse{}},
+	{Method: http.MethodPost, Path: "/v1/embeddings", Summary: "Generate embeddings, compatible with OpenAI", Request: api.EmbeddingsRequest{}, Response: api.EmbeddingsResponse{}},
+}
+
+// OpenAPI generates the OpenAPI 3 document of the API
+func OpenAPI() ([]byte, error) {
+	schemas := openapiSchemas{
+		"Error": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"error": map[string]any{"type": "string"}},
+		},
+	}
+
+	paths := make(map[string]map[string]any)
+	for _, route := range openapiRoutes {
+		op := map[string]any{
+			"summary": route.Summary,
+			"responses": map[string]any{
+				"default": map[string]any{
+					"description": "error",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+					},
+				},
+			},
+		}
+
+		var parameters []any
+		for _, match := range openapiPathParameter.FindAllStringSubmatch(route.Path, -1) {
+			parameters = append(parameters, map[string]any{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+
+		if route.Idempotent {
+			parameters = append(parameters, map[string]any{
+				"name":        "Idempotency-Key",
+				"in":          "header",
+				"description": "retries with the same key join the request in progress, or return its result once it has finished",
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+
+		if parameters != nil {
+			op["parameters"] = parameters
+		}
+
+		if route.Request != nil {
+			contentType := route.RequestType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+
+			op["requestBody"] = map[string]any{
+				"content": map[string]any{contentType: map[string]any{"schema": schemas.schema(reflect.TypeOf(route.Request))}},
+			}
+		}
+
+		ok := map[string]any{"description": "OK"}
+		if route.Response != nil {
+			schema := schemas.schema(reflect.TypeOf(route.Response))
+
+			contentType := route.ResponseType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+
+			content := map[string]any{contentType: map[string]any{"schema": schema}}
+			if route.Stream {
+				content["application/x-ndjson"] = map[string]any{"schema": schema}
+			}
+
+			ok["content"] = content
+		}
+
+		op["responses"].(map[string]any)["200"] = ok
+
+		if paths[route.Path] == nil {
+			paths[route.Path] = make(map[string]any)
+		}
+
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+
+	return json.MarshalIndent(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Ollama API",
+			"version": "0.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}, "", "  ")
+}
+
+var openapiPathParameter = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openapiSchemas are the schemas of named struct types, which are referred to by name
+type openapiSchemas map[string]any
+
+var (
+	openapiTimeType     = reflect.TypeOf(time.Time{})
+	openapiDurationType = reflect.TypeOf(time.Duration(0))
+	openapiFileType     = reflect.TypeOf(openapiFile{})
+)
+
+func (s openapiSchemas) schema(t reflect.Type) map[string]any {
+	switch t {
+	case openapiTimeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case openapiDurationType:
+		return map[string]any{"type": "integer", "description": "nanoseconds"}
+	case openapiFileType:
+		return map[string]any{"type": "string", "format": "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// byte slices are encoded as base64
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+
+		if _, ok := s[t.Name()]; !ok {
+			// reserve the name first, for types which refer to themselves
+			s[t.Name()] = nil
+			s[t.Name()] = s.object(t)
+		}
+
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		// interfaces can be anything
+		return map[string]any{}
+	}
+}
+
+// object is the schema of the fields of the struct t, as encoding/json encodes them
+func (s openapiSchemas) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	s.fields(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (s openapiSchemas) fields(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+
+		// the fields of embedded structs are encoded as fields of the struct they are embedded in
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			s.fields(f.Type, properties)
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = s.schema(f.Type)
+	}
+}
+
+// openapiServed is the OpenAPI document with the version of the server
+var openapiServed struct {
+	once sync.Once
+	doc  []byte
+	err  error
+}
+
+func OpenAPIHandler(c *gin.Context) {
+	openapiServed.once.Do(func() {
+		var doc map[string]any
+		if openapiServed.err = json.Unmarshal(openapiDocument, &doc); openapiServed.err != nil {
+			return
+		}
+
+		doc["info"].(map[string]any)["version"] = version.Version
+		openapiServed.doc, openapiServed.err = json.Marshal(doc)
+	})
+
+	doc, err := openapiServed.doc, openapiServed.err
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("invalid OpenAPI document: %v", err)})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", doc)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/version"
+)
+
+func TestOpenAPI(t *testing.T) {
+	doc, err := OpenAPI()
+	require.NoError(t, err)
+	require.Equal(t, string(doc)+"\n", string(openapiDocument), "openapi.json is out of date, run go generate ./server")
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	router, ok := s.GenerateRoutes().(*gin.Engine)
+	require.True(t, ok)
+
+	// every route is documented, and every documented route is served
+	ginParameter := regexp.MustCompile(`:([^/]+)`)
+
+	served := make(map[string]bool)
+	for _, route := range router.Routes() {
+		served[route.Method+" "+ginParameter.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	documented := make(map[string]bool)
+	for _, route := range openapiRoutes {
+		documented[route.Method+" "+route.Path] = true
+	}
+
+	assert.Equal(t, served, documented)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var servedDoc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&servedDoc))
+	assert.Equal(t, "3.0.3", servedDoc.OpenAPI)
+	assert.Equal(t, version.Version, servedDoc.Info.Version)
+	assert.Contains(t, servedDoc.Paths["/api/generate"], "post")
+	assert.Contains(t, servedDoc.Paths["/v1/moderations"], "post")
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+)
+
+var errPresetNotFound = errors.New("preset not found")
+
+// presetStore keeps every preset in memory and writes them through to disk
+// as JSON files under ~/.ollama/presets
+type presetStore struct {
+	mu      sync.Mutex
+	dir     string
+	presets map[string]*api.Preset
+}
+
+var presets presetStore
+
+func presetsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "presets"), nil
+}
+
+// open reads the presets from disk the first time it is called, it is up to the caller to lock s.mu
+func (s *presetStore) open() error {
+	if s.presets != nil {
+		return nil
+	}
+
+	if s.dir == "" {
+		dir, err := presetsDir()
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.presets = make(map[string]*api.Preset)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		bts, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		var p api.Preset
+		if err := json.Unmarshal(bts, &p); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		s.presets[p.Name] = &p
+	}
+
+	return nil
+}
+
+// Put creates the preset or replaces the preset with the same name
+func (s *presetStore) Put(p api.Preset) (*api.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	p.ModifiedAt = time.Now().UTC()
+	if err := writeJSONFile(s.dir, p.Name, &p); err != nil {
+		return nil, err
+	}
+
+	s.presets[p.Name] = &p
+	return &p, nil
+}
+
+func (s *presetStore) Get(name string) (*api.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	p, ok := s.presets[name]
+	if !ok {
+		return nil, errPresetNotFound
+	}
+
+	preset := *p
+	return &preset, nil
+}
+
+func (s *presetStore) List() ([]api.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	list := make([]api.Preset, 0, len(s.presets))
+	for _, p := range s.presets {
+		list = append(list, *p)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+func (s *presetStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if _, ok := s.presets[name]; !ok {
+		return errPresetNotFound
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, name+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	delete(s.presets, name)
+	return nil
+}
+
+// applyPreset fills in the model, system message and options of the chat request from the preset.
+// Anything set by the request itself takes precedence. The system message is only added at the
+// start of a conversation, history holds any earlier messages.
+func applyPreset(req *apix.ChatRequest, p *api.Preset, history []api.Message) {
+	if req.Model == "" {
+		req.Model = p.Model
+	}
+
+	if len(p.Options) > 0 {
+		options := make(map[string]interface{}, len(p.Options)+len(req.Options))
+		for k, v := range p.Options {
+			options[k] = v
+		}
+
+		for k, v := range req.Options {
+			options[k] = v
+		}
+
+		req.Options = options
+	}
+
+	if p.System != "" && len(history) == 0 && (len(req.Messages) == 0 || req.Messages[0].Role != "system") {
+		req.Messages = append([]api.Message{{Role: "system", Content: p.System}}, req.Messages...)
+	}
+}
+
+func presetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errPresetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("preset '%s' not found", c.Param("name"))})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func CreatePresetHandler(c *gin.Context) {
+	var req api.Preset
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case !collectionNamePattern.MatchString(req.Name):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name must contain only letters, numbers, '_', '-' and '.'"})
+		return
+	case req.Model == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	opts := api.DefaultOptions()
+	if err := opts.FromMap(req.Options); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := opts.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preset, err := presets.Put(req)
+	if err != nil {
+		presetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
+
+func ListPresetsHandler(c *gin.Context) {
+	list, err := presets.List()
+	if err != nil {
+		presetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ListPresetsResponse{Presets: list})
+}
+
+func GetPresetHandler(c *gin.Context) {
+	preset, err := presets.Get(c.Param("name"))
+	if err != nil {
+		presetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
+
+func DeletePresetHandler(c *gin.Context) {
+	if err := presets.Delete(c.Param("name")); err != nil {
+		presetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+)
+
+func TestPresetStore(t *testing.T) {
+	dir := t.TempDir()
+	s := presetStore{dir: dir}
+
+	_, err := s.Put(api.Preset{Name: "support-bot", Model: "llama2", System: "You are a support agent."})
+	require.NoError(t, err)
+
+	// putting a preset with the same name replaces it
+	_, err = s.Put(api.Preset{Name: "support-bot", Model: "mistral"})
+	require.NoError(t, err)
+
+	reopened := presetStore{dir: dir}
+	p, err := reopened.Get("support-bot")
+	require.NoError(t, err)
+	assert.Equal(t, "mistral", p.Model)
+	assert.Empty(t, p.System)
+
+	list, err := reopened.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	require.NoError(t, reopened.Delete("support-bot"))
+	_, err = reopened.Get("support-bot")
+	assert.ErrorIs(t, err, errPresetNotFound)
+}
+
+func TestApplyPreset(t *testing.T) {
+	preset := &api.Preset{
+		Model:   "llama2",
+		System:  "Be brief.",
+		Options: map[string]interface{}{"temperature": 0.1, "num_ctx": 4096},
+	}
+
+	req := apix.ChatRequest{ChatRequest: api.ChatRequest{
+		Messages: []api.Message{{Role: "user", Content: "hi"}},
+		Options:  map[string]interface{}{"temperature": 0.9},
+	}}
+	applyPreset(&req, preset, nil)
+
+	assert.Equal(t, "llama2", req.Model)
+	assert.Equal(t, map[string]interface{}{"temperature": 0.9, "num_ctx": 4096}, req.Options)
+	require.Len(t, req.Messages, 2)
+	assert.Equal(t, api.Message{Role: "system", Content: "Be brief."}, req.Messages[0])
+
+	// the request's own model and system message win
+	req = apix.ChatRequest{ChatRequest: api.ChatRequest{
+		Model:    "mistral",
+		Messages: []api.Message{{Role: "system", Content: "Be verbose."}, {Role: "user", Content: "hi"}},
+	}}
+	applyPreset(&req, preset, nil)
+	assert.Equal(t, "mistral", req.Model)
+	assert.Equal(t, "Be verbose.", req.Messages[0].Content)
+	assert.Len(t, req.Messages, 2)
+
+	// the system message isn't added part way through a conversation
+	req = apix.ChatRequest{ChatRequest: api.ChatRequest{Messages: []api.Message{{Role: "user", Content: "and then?"}}}}
+	applyPreset(&req, preset, []api.Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}})
+	assert.Len(t, req.Messages, 1)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// basePath is the prefix the API is served under, read from $OLLAMA_BASE_PATH, e.g. /ollama when a reverse
+// proxy passes requests for /ollama/ on without stripping it
+func basePath() string {
+	p := strings.TrimSpace(os.Getenv("OLLAMA_BASE_PATH"))
+	if p == "" {
+		return ""
+	}
+
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return ""
+	}
+
+	return p
+}
+
+// defaultTrustedProxies are trusted when $OLLAMA_TRUSTED_PROXIES is not set, a reverse proxy on the same
+// machine
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+// trustedProxies are the addresses whose X-Forwarded-For and X-Forwarded-Proto headers are believed
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies reads a comma separated list of IP addresses and CIDR ranges, $OLLAMA_TRUSTED_PROXIES
+// set but empty trusts no proxies
+func parseTrustedProxies(s string, ok bool) (trustedProxies, error) {
+	values := defaultTrustedProxies
+	if ok {
+		values = strings.Split(s, ",")
+	}
+
+	var proxies trustedProxies
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if strings.Contains(v, "/") {
+			prefix, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("OLLAMA_TRUSTED_PROXIES: %w", err)
+			}
+
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("OLLAMA_TRUSTED_PROXIES: %w", err)
+		}
+
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return proxies, nil
+}
+
+// Strings is the list gin.Engine.SetTrustedProxies takes
+func (p trustedProxies) Strings() []string {
+	s := make([]string, len(p))
+	for i, prefix := range p {
+		s[i] = prefix.String()
+	}
+
+	return s
+}
+
+// Trusts reports whether a request from remoteAddr, an address and port, came through a trusted proxy
+func (p trustedProxies) Trusts(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scheme is the scheme the client used, which is X-Forwarded-Proto if the request came through a trusted proxy
+func (p trustedProxies) Scheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && p.Trusts(r.RemoteAddr) {
+		proto, _, _ = strings.Cut(proto, ",")
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// logFormatter is gin's default log line with the scheme the client used, the client IP it logs is the
+// forwarded one for requests through a trusted proxy
+func (p trustedProxies) logFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %-5s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		p.Scheme(param.Request),
+		param.Path,
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasePath(t *testing.T) {
+	cases := map[string]string{
+		"":         "",
+		"/":        "",
+		"ollama":   "/ollama",
+		"/ollama/": "/ollama",
+		" /a//b/ ": "/a/b",
+	}
+
+	for value, expected := range cases {
+		t.Setenv("OLLAMA_BASE_PATH", value)
+		assert.Equal(t, expected, basePath(), value)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies("", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.0/8", "::1/128"}, proxies.Strings())
+	assert.True(t, proxies.Trusts("127.0.0.1:54321"))
+	assert.True(t, proxies.Trusts("[::1]:54321"))
+	assert.False(t, proxies.Trusts("10.0.0.2:54321"))
+
+	proxies, err = parseTrustedProxies("10.0.0.0/8, 192.168.1.10", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.10/32"}, proxies.Strings())
+	assert.True(t, proxies.Trusts("10.0.0.2:54321"))
+	assert.True(t, proxies.Trusts("[::ffff:192.168.1.10]:54321"))
+	assert.False(t, proxies.Trusts("127.0.0.1:54321"))
+
+	// set but empty trusts no proxies
+	proxies, err = parseTrustedProxies("", true)
+	require.NoError(t, err)
+	assert.Empty(t, proxies)
+
+	_, err = parseTrustedProxies("10.0.0.0/33", true)
+	assert.Error(t, err)
+	_, err = parseTrustedProxies("proxy.local", true)
+	assert.Error(t, err)
+}
+
+func TestTrustedProxiesScheme(t *testing.T) {
+	proxies, err := parseTrustedProxies("", false)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Forwarded-Proto", "HTTPS, http")
+
+	r.RemoteAddr = "127.0.0.1:54321"
+	assert.Equal(t, "https", proxies.Scheme(r))
+
+	// the header is ignored from anyone else
+	r.RemoteAddr = "10.0.0.2:54321"
+	assert.Equal(t, "http", proxies.Scheme(r))
+}
+
+func TestGenerateRoutesProxy(t *testing.T) {
+	proxies, err := parseTrustedProxies("", false)
+	require.NoError(t, err)
+
+	s := &Server{WorkDir: t.TempDir(), BasePath: "/ollama", proxies: proxies}
+	router := s.GenerateRoutes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ollama/api/version", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+// isModelURL reports whether a FROM line names a file on a web server
+func isModelURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// parseSHA256 reads a hex sha256 checksum, with or without the sha256: prefix, as a blob digest
+func parseSHA256(s string) (string, error) {
+	sum := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "sha256:"))
+	if !sha256Pattern.MatchString(sum) {
+		return "", fmt.Errorf("'%s' is not a sha256 checksum", s)
+	}
+
+	return "sha256:" + sum, nil
+}
+
+// parseModelURL splits the sha256 query parameter, which isn't sent to the web server, from the URL of a model
+func parseModelURL(s string) (*url.URL, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", fmt.Errorf("'%s' is not an http or https url", s)
+	}
+
+	query := u.Query()
+	if !query.Has("sha256") {
+		return u, "", nil
+	}
+
+	sum := query.Get("sha256")
+	query.Del("sha256")
+	u.RawQuery = query.Encode()
+	return u, sum, nil
+}
+
+// sidecarChecksum reads the checksum published next to a file in <file>.sha256, as sha256sum writes it
+func sidecarChecksum(ctx context.Context, u *url.URL, regOpts *RegistryOptions) (string, error) {
+	sidecar := *u
+	sidecar.Path += ".sha256"
+	sidecar.RawPath = ""
+
+	resp, err := makeRequest(ctx, http.MethodGet, &sidecar, nil, nil, regOpts)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%s has no checksum, add ?sha256=<checksum> to the url or publish it in %s", u.Redacted(), sidecar.Redacted())
+	case resp.StatusCode >= http.StatusBadRequest:
+		return "", fmt.Errorf("%s: %s", sidecar.Redacted(), resp.Status)
+	}
+
+	bts, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(bts))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s is empty", sidecar.Redacted())
+	}
+
+	return fields[0], nil
+}
+
+// downloadURL downloads a file from a web server into the blob store and verifies it against its checksum,
+// which is in the url's sha256 parameter or else in a sidecar file
+func downloadURL(ctx context.Context, s string, fn func(api.ProgressResponse)) (string, error) {
+	u, sum, err := parseModelURL(s)
+	if err != nil {
+		return "", err
+	}
+
+	regOpts := &RegistryOptions{}
+	if sum == "" {
+		fn(api.ProgressResponse{Status: "pulling checksum"})
+		sum, err = sidecarChecksum(ctx, u, regOpts)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	digest, err := parseSHA256(sum)
+	if err != nil {
+		return "", err
+	}
+
+	if err := downloadBlob(ctx, downloadOpts{
+		digest:  digest,
+		regOpts: regOpts,
+		fn:      fn,
+		url:     u,
+	}); err != nil {
+		return "", err
+	}
+
+	fn(api.ProgressResponse{Status: "verifying sha256 digest"})
+	if err := verifyBlob(digest); err != nil {
+		if errors.Is(err, errDigestMismatch) {
+			if fp, err := GetBlobsPath(digest); err == nil {
+				os.Remove(fp)
+			}
+		}
+
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// urlModelName names a model pulled from a url after its file, e.g. mistral-7b-instruct-v0.2:q4_k_m for
+// mistral-7b-instruct-v0.2.Q4_K_M.gguf
+func urlModelName(s string) (string, error) {
+	u, _, err := parseModelURL(s)
+	if err != nil {
+		return "", err
+	}
+
+	name := importName(path.Base(u.Path))
+	if strings.HasPrefix(name, ":") {
+		return "", fmt.Errorf("can't name a model after '%s', give it a name", u.Redacted())
+	}
+
+	return name, nil
+}
+
+// pullURL downloads a GGUF file from a web server and creates a model from it, with the template and
+// parameters of its model family when they are known. A model shared by another server is pulled as it is.
+// Without a name the model is named after the file, or the shared model.
+func pullURL(ctx context.Context, name, s string, fn func(api.ProgressResponse)) error {
+	u, _, err := parseModelURL(s)
+	if err != nil {
+		return err
+	}
+
+	resp, err := makeRequest(ctx, http.MethodHead, u, nil, nil, &RegistryOptions{})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s: %s", u.Redacted(), resp.Status)
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == shareArchiveType {
+		if name == "" {
+			name = resp.Header.Get("Ollama-Model")
+		}
+
+		return pullShare(ctx, name, u, fn)
+	}
+
+	if name == "" {
+		name, err = urlModelName(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	digest, err := downloadURL(ctx, s, fn)
+	if err != nil {
+		return err
+	}
+
+	modelfile := fmt.Sprintf("FROM @%s\n%s", digest, importModelfile(strings.ToLower(path.Base(u.Path))))
+	commands, err := parser.Parse(strings.NewReader(modelfile))
+	if err != nil {
+		return err
+	}
+
+	return CreateModel(ctx, name, "", commands, fn)
+}
+
+// pullShare downloads the archive of a model shared by another server
+func pullShare(ctx context.Context, name string, u *url.URL, fn func(api.ProgressResponse)) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+
+	fn(api.ProgressResponse{Status: "pulling manifest"})
+	resp, err := makeRequest(ctx, http.MethodGet, u, nil, nil, &RegistryOptions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s: %s", u.Redacted(), resp.Status)
+	}
+
+	return importShareArchive(ctx, name, resp.Body, fn)
+}
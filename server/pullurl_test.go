@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+func TestURLModelName(t *testing.T) {
+	name, err := urlModelName("https://example.com/models/zephyr-7b-beta.Q4_K_M.gguf?sha256=abc")
+	require.NoError(t, err)
+	assert.Equal(t, "zephyr-7b-beta:q4_k_m", name)
+
+	_, err = urlModelName("https://example.com/")
+	assert.Error(t, err)
+
+	_, err = urlModelName("ftp://example.com/model.gguf")
+	assert.Error(t, err)
+}
+
+func TestPullURL(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	// the smallest GGUF file, version 3 with no tensors or metadata
+	content := []byte{'G', 'G', 'U', 'F', 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	sum := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	var queries []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/zephyr-7b-beta.Q4_K_M.gguf", func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		http.ServeContent(w, r, "zephyr-7b-beta.Q4_K_M.gguf", time.Time{}, bytes.NewReader(content))
+	})
+	mux.HandleFunc("/zephyr-7b-beta.Q4_K_M.gguf.sha256", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  zephyr-7b-beta.Q4_K_M.gguf\n", sum)
+	})
+	mux.HandleFunc("/unsigned.gguf", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "unsigned.gguf", time.Time{}, bytes.NewReader(content))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	fn := func(api.ProgressResponse) {}
+
+	t.Run("sidecar", func(t *testing.T) {
+		require.NoError(t, pullURL(context.TODO(), "zephyr", srv.URL+"/zephyr-7b-beta.Q4_K_M.gguf", fn))
+
+		model, err := GetModel("zephyr")
+		require.NoError(t, err)
+		assert.Contains(t, model.Template, "<|assistant|>")
+
+		blob, err := GetBlobsPath("sha256:" + sum)
+		require.NoError(t, err)
+		assert.Equal(t, blob, model.ModelPath)
+	})
+
+	t.Run("query", func(t *testing.T) {
+		require.NoError(t, DeleteModel("zephyr"))
+
+		queries = nil
+		require.NoError(t, pullURL(context.TODO(), "zephyr", srv.URL+"/zephyr-7b-beta.Q4_K_M.gguf?token=abc&sha256="+strings.ToUpper(sum), fn))
+
+		// the checksum isn't sent to the web server
+		require.NotEmpty(t, queries)
+		for _, q := range queries {
+			assert.Equal(t, "token=abc", q)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		require.NoError(t, DeleteModel("zephyr"))
+
+		other := fmt.Sprintf("%x", sha256.Sum256([]byte("other")))
+		err := pullURL(context.TODO(), "zephyr", srv.URL+"/unsigned.gguf?sha256="+other, fn)
+		assert.ErrorIs(t, err, errDigestMismatch)
+	})
+
+	t.Run("no checksum", func(t *testing.T) {
+		err := pullURL(context.TODO(), "unsigned", srv.URL+"/unsigned.gguf", fn)
+		assert.ErrorContains(t, err, "has no checksum")
+	})
+
+	t.Run("from", func(t *testing.T) {
+		commands, err := parser.Parse(strings.NewReader(fmt.Sprintf("FROM %s/unsigned.gguf?sha256=%s\nPARAMETER temperature 0", srv.URL, sum)))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), "unsigned", "", commands, fn))
+
+		model, err := GetModel("unsigned")
+		require.NoError(t, err)
+		assert.Equal(t, float64(0), model.Options["temperature"])
+	})
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+	"github.com/jmorganca/ollama/version"
+)
+
+// Replay is a generation recorded for debugging: the prompt exactly as it was sent to the runner, the
+// options and runner flags it ran with and the tokens it produced. `ollama replay` runs it again.
+type Replay struct {
+	Version   string    `json:"version"`
+	Platform  string    `json:"platform"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Endpoint is the API the generation was requested from, generate or chat
+	Endpoint string                 `json:"endpoint"`
+	Model    string                 `json:"model"`
+	Digest   string                 `json:"digest"`
+	Prompt   string                 `json:"prompt"`
+	Format   string                 `json:"format,omitempty"`
+	Schema   json.RawMessage        `json:"schema,omitempty"`
+	Images   []api.ImageData        `json:"images,omitempty"`
+	Options  map[string]interface{} `json:"options"`
+	Runner   llm.Placement          `json:"runner"`
+
+	// Tokens are the pieces of the response in the order the runner produced them
+	Tokens []string `json:"tokens"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Response is the whole recorded response
+func (r *Replay) Response() string {
+	return strings.Join(r.Tokens, "")
+}
+
+// ReadReplay reads a replay file written by the server
+func ReadReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r Replay
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// recordDir is where replays are written, recording is off unless OLLAMA_RECORD is set
+func recordDir() string {
+	return os.Getenv("OLLAMA_RECORD")
+}
+
+// recorder captures a generation of the loaded model, it is nil when recording is off
+type recorder struct {
+	Replay
+}
+
+// newRecorder starts recording a generation of the loaded model, the caller must hold loaded.mu
+func newRecorder(endpoint string, predict llm.PredictOpts, schema json.RawMessage) *recorder {
+	if recordDir() == "" {
+		return nil
+	}
+
+	return &recorder{Replay{
+		Version:   version.Version,
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		CreatedAt: time.Now().UTC(),
+		Endpoint:  endpoint,
+		Model:     loaded.Model.ShortName,
+		Digest:    loaded.Model.Digest,
+		Prompt:    predict.Prompt,
+		Format:    predict.Format,
+		Schema:    schema,
+		Images:    predict.Images,
+		Options:   loaded.Options.Map(),
+		Runner:    loaded.runner.Placement(),
+		Tokens:    []string{},
+	}}
+}
+
+func (r *recorder) Add(content string) {
+	if r == nil || content == "" {
+		return
+	}
+
+	r.Tokens = append(r.Tokens, content)
+}
+
+// Close writes the replay, recording errors are logged rather than failing the request
+func (r *recorder) Close(err error) {
+	if r == nil {
+		return
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	path, err := r.write()
+	if err != nil {
+		log.Printf("couldn't record replay: %v", err)
+		return
+	}
+
+	log.Printf("recorded replay %s", path)
+}
+
+func (r *recorder) write() (string, error) {
+	dir := recordDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp(dir, "replay-"+r.CreatedAt.Format("20060102T150405")+"-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.Replay); err != nil {
+		return "", err
+	}
+
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/llm"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Setenv("OLLAMA_RECORD", "")
+
+	// recording is off by default and a nil recorder does nothing
+	rec := newRecorder("generate", llm.PredictOpts{Prompt: "why is the sky blue?"}, nil)
+	assert.Nil(t, rec)
+	rec.Add("because")
+	rec.Close(nil)
+
+	dir := filepath.Join(t.TempDir(), "replays")
+	t.Setenv("OLLAMA_RECORD", dir)
+
+	rec = &recorder{Replay{
+		Endpoint: "generate",
+		Model:    "llama2:latest",
+		Prompt:   "[INST] why is the sky blue? [/INST]",
+		Options:  map[string]interface{}{"seed": float64(42)},
+		Runner:   llm.Placement{Runner: "ollama-runner", Args: []string{"--ctx-size", "2048"}},
+		Tokens:   []string{},
+	}}
+	for _, token := range []string{" Because", "", " of", " Rayleigh"} {
+		rec.Add(token)
+	}
+	rec.Close(errors.New("context canceled"))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	replay, err := ReadReplay(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, "[INST] why is the sky blue? [/INST]", replay.Prompt)
+	assert.Equal(t, []string{" Because", " of", " Rayleigh"}, replay.Tokens)
+	assert.Equal(t, " Because of Rayleigh", replay.Response())
+	assert.Equal(t, float64(42), replay.Options["seed"])
+	assert.Equal(t, []string{"--ctx-size", "2048"}, replay.Runner.Args)
+	assert.Equal(t, "context canceled", replay.Error)
+}
@@ -25,6 +25,8 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/api/apix"
+	"github.com/jmorganca/ollama/format"
 	"github.com/jmorganca/ollama/llm"
 	"github.com/jmorganca/ollama/parser"
 	"github.com/jmorganca/ollama/version"
@@ -34,6 +36,13 @@ var mode string = gin.DebugMode
 
 type Server struct {
 	WorkDir string
+
+	// BasePath is the prefix every route is served under
+	BasePath  string
+	proxies   trustedProxies
+	accessLog *accessLog
+	chaos     *chaos
+	routing   *routingConfig
 }
 
 func init() {
@@ -60,16 +69,41 @@ var loaded struct {
 	*api.Options
 }
 
+// infillModels caches whether each model blob, whose path names its digest, can fill in the middle, so
+// infill requests don't decode the model's vocabulary every time
+var infillModels sync.Map
+
+func supportsInfill(path string) (bool, error) {
+	if ok, found := infillModels.Load(path); found {
+		return ok.(bool), nil
+	}
+
+	ok, err := llm.SupportsInfill(path)
+	if err != nil {
+		return false, err
+	}
+
+	infillModels.Store(path, ok)
+	return ok, nil
+}
+
 var defaultSessionDuration = 5 * time.Minute
 
 // load a model into memory if it is not already loaded, it is up to the caller to lock loaded.mu before calling this function
-func load(c *gin.Context, modelName string, reqOpts map[string]interface{}, sessionDuration time.Duration) (*Model, error) {
+func load(c *gin.Context, modelName string, reqOpts map[string]interface{}, sessionDuration time.Duration, fn func(api.LoadProgress)) (*Model, error) {
+	return loadModel(c.Request.Context(), c.GetString("workDir"), modelName, reqOpts, sessionDuration, fn)
+}
+
+// loadModel is load for callers outside of a request
+func loadModel(ctx context.Context, workDir, modelName string, reqOpts map[string]interface{}, sessionDuration time.Duration, fn func(api.LoadProgress)) (*Model, error) {
 	model, err := GetModel(modelName)
 	if err != nil {
 		return nil, err
 	}
 
-	workDir := c.GetString("workDir")
+	if model.Config.ModelFamily == "stable-diffusion" {
+		return nil, fmt.Errorf("model '%s' is an image generation model, use /v1/images/generations instead", modelName)
+	}
 
 	opts := api.DefaultOptions()
 	if err := opts.FromMap(model.Options); err != nil {
@@ -81,7 +115,9 @@ func load(c *gin.Context, modelName string, reqOpts map[string]interface{}, sess
 		return nil, err
 	}
 
-	ctx := c.Request.Context()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
 
 	// check if the loaded model is still running in a subprocess, in case something unexpected happened
 	if loaded.runner != nil {
@@ -92,14 +128,23 @@ func load(c *gin.Context, modelName string, reqOpts map[string]interface{}, sess
 			loaded.runner = nil
 			loaded.Model = nil
 			loaded.Options = nil
+			running.Set(nil)
 		}
 	}
 
 	needLoad := loaded.runner == nil || // is there a model loaded?
-		loaded.ModelPath != model.ModelPath || // has the base model changed?
-		!reflect.DeepEqual(loaded.AdapterPaths, model.AdapterPaths) || // have the adapters changed?
+		!sameWeights(loaded.Model, model) || // have the weights changed?
 		!reflect.DeepEqual(loaded.Options.Runner, opts.Runner) // have the runner options changed?
 
+	if !needLoad {
+		// models which only differ in their template, system prompt or parameters share the loaded runner
+		if loaded.Model.Name != model.Name {
+			log.Printf("switching from %s to %s without reloading their weights", loaded.Model.ShortName, model.ShortName)
+		}
+
+		loaded.Model = model
+	}
+
 	if needLoad {
 		if loaded.runner != nil {
 			log.Println("changing loaded model")
@@ -107,9 +152,10 @@ func load(c *gin.Context, modelName string, reqOpts map[string]interface{}, sess
 			loaded.runner = nil
 			loaded.Model = nil
 			loaded.Options = nil
+			running.Set(nil)
 		}
 
-		llmRunner, err := llm.New(workDir, model.ModelPath, model.AdapterPaths, model.ProjectorPaths, opts)
+		llmRunner, err := newRunner(workDir, model, opts, fn)
 		if err != nil {
 			// some older models are not compatible with newer versions of llama.cpp
 			// show a generalized compatibility error until there is a better way to
@@ -129,6 +175,7 @@ func load(c *gin.Context, modelName string, reqOpts map[string]interface{}, sess
 	// update options for the loaded llm
 	// TODO(mxyng): this isn't thread safe, but it should be fine for now
 	loaded.runner.SetOptions(opts)
+	loaded.Options = &opts
 
 	loaded.expireAt = time.Now().Add(sessionDuration)
 
@@ -141,26 +188,132 @@ func load(c *gin.Context, modelName string, reqOpts map[string]interface{}, sess
 				return
 			}
 
-			if loaded.runner != nil {
-				loaded.runner.Close()
-			}
-
-			loaded.runner = nil
-			loaded.Model = nil
-			loaded.Options = nil
+			unload()
 		})
 	}
 
 	loaded.expireTimer.Reset(sessionDuration)
+
+	placement := loaded.runner.Placement()
+	running.Set(&api.ProcessModel{
+		Name:        model.ShortName,
+		Digest:      model.Digest,
+		Size:        placement.Size,
+		GPULayers:   placement.GPULayers,
+		TotalLayers: placement.TotalLayers,
+		ExpiresAt:   loaded.expireAt.UTC(),
+	})
+
 	return model, nil
 }
 
+// unload stops the loaded model's runner, it is up to the caller to lock loaded.mu
+func unload() {
+	if loaded.runner != nil {
+		loaded.runner.Close()
+	}
+
+	loaded.runner = nil
+	loaded.Model = nil
+	loaded.Options = nil
+	running.Set(nil)
+}
+
+// newRunner starts a runner for the model, using its TensorRT-LLM engine if it has one which loads on this machine.
+// Engines can't apply adapters or take images, so models with either always run on llama.cpp.
+func newRunner(workDir string, model *Model, opts api.Options, fn func(api.LoadProgress)) (llm.LLM, error) {
+	if model.EnginePath != "" && len(model.AdapterPaths) == 0 && len(model.ProjectorPaths) == 0 {
+		runner, err := llm.NewTensorRT(workDir, model.EnginePath, opts, fn)
+		if err == nil {
+			return runner, nil
+		}
+
+		log.Printf("couldn't load the TensorRT-LLM engine of %s, falling back to llama.cpp: %v", model.ShortName, err)
+	}
+
+	return llm.New(workDir, model.ModelPath, model.AdapterPaths, model.ProjectorPaths, opts, fn)
+}
+
+// sameWeights reports whether two models run on the same weights, so one can use the runner loaded for the
+// other. Adapters are applied when a runner starts, so models with different adapters can't share one.
+func sameWeights(a, b *Model) bool {
+	return a.ModelPath == b.ModelPath &&
+		a.EnginePath == b.EnginePath &&
+		reflect.DeepEqual(a.AdapterPaths, b.AdapterPaths) &&
+		reflect.DeepEqual(a.ProjectorPaths, b.ProjectorPaths)
+}
+
+// keepLoaded pushes back when the loaded model expires, it is up to the caller to lock loaded.mu
+func keepLoaded(sessionDuration time.Duration) {
+	loaded.expireAt = time.Now().Add(sessionDuration)
+	loaded.expireTimer.Reset(sessionDuration)
+	running.SetExpiry(loaded.expireAt.UTC())
+}
+
+// loadWithProgress loads the model like load, streaming progress built by fn to the client while the model loads.
+// If fn is nil or the model is already loaded nothing is written.
+func loadWithProgress(c *gin.Context, modelName string, reqOpts map[string]interface{}, sessionDuration time.Duration, fn func(api.LoadProgress) any) (*Model, error) {
+	if fn == nil {
+		return load(c, modelName, reqOpts, sessionDuration, nil)
+	}
+
+	type result struct {
+		model *Model
+		err   error
+	}
+
+	progress := make(chan api.LoadProgress)
+	done := make(chan result, 1)
+	go func() {
+		model, err := load(c, modelName, reqOpts, sessionDuration, func(p api.LoadProgress) {
+			progress <- p
+		})
+		done <- result{model, err}
+	}()
+
+	for {
+		select {
+		case p := <-progress:
+			if !c.Writer.Written() {
+				c.Header("Content-Type", "application/x-ndjson")
+				c.Status(http.StatusOK)
+			}
+
+			bts, err := json.Marshal(fn(p))
+			if err != nil {
+				log.Printf("loadWithProgress: json.Marshal failed with %s", err)
+				continue
+			}
+
+			if _, err := c.Writer.Write(append(bts, '\n')); err != nil {
+				log.Printf("loadWithProgress: w.Write failed with %s", err)
+			}
+			c.Writer.Flush()
+		case r := <-done:
+			return r.model, r.err
+		}
+	}
+}
+
+// writeStreamError writes an error as the last object of a streamed response
+func writeStreamError(c *gin.Context, err error) {
+	bts, merr := json.Marshal(gin.H{"error": err.Error()})
+	if merr != nil {
+		log.Printf("writeStreamError: json.Marshal failed with %s", merr)
+		return
+	}
+
+	if _, err := c.Writer.Write(append(bts, '\n')); err != nil {
+		log.Printf("writeStreamError: w.Write failed with %s", err)
+	}
+}
+
 func GenerateHandler(c *gin.Context) {
 	loaded.mu.Lock()
 	defer loaded.mu.Unlock()
 
 	checkpointStart := time.Now()
-	var req api.GenerateRequest
+	var req apix.GenerateRequest
 	err := c.ShouldBindJSON(&req)
 
 	switch {
@@ -172,6 +325,8 @@ func GenerateHandler(c *gin.Context) {
 		return
 	}
 
+	logRequestModel(c, req.Model, req.Prompt)
+
 	// validate the request
 	switch {
 	case req.Model == "":
@@ -180,32 +335,89 @@ func GenerateHandler(c *gin.Context) {
 	case len(req.Format) > 0 && req.Format != "json":
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be json"})
 		return
+	case len(req.Format) > 0 && len(req.Schema) > 0:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format and schema can't both be set"})
+		return
 	case req.Raw && (req.Template != "" || req.System != "" || len(req.Context) > 0):
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "raw mode does not support template, system, or context"})
 		return
+	case req.Continue && (len(req.Context) == 0 || req.Prompt != ""):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "continue requires a context and no prompt"})
+		return
+	}
+
+	var grammar string
+	if len(req.Schema) > 0 {
+		var err error
+		grammar, err = schemaGrammar(req.Schema)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if hooks.Handles(HookStagePrompt) && (req.Prompt != "" || req.System != "") {
+		filtered, err := hooks.Run(c.Request.Context(), HookRequest{
+			Stage:    HookStagePrompt,
+			Endpoint: "generate",
+			Model:    req.Model,
+			Messages: generateMessages(req.System, req.Prompt),
+		})
+		if err != nil {
+			abortFilterError(c, err)
+			return
+		}
+
+		req.System, req.Prompt = generatePrompt(filtered.Messages)
+	}
+
+	inputModeration, err := moderateInput(c, req.Prompt)
+	if err != nil {
+		abortFilterError(c, err)
+		return
 	}
 
 	sessionDuration := defaultSessionDuration
-	model, err := load(c, req.Model, req.Options, sessionDuration)
+
+	var progressFn func(api.LoadProgress) any
+	if req.Stream == nil || *req.Stream {
+		progressFn = func(p api.LoadProgress) any {
+			return api.GenerateResponse{Model: req.Model, CreatedAt: time.Now().UTC(), Load: &p}
+		}
+	}
+
+	model, err := loadWithProgress(c, req.Model, req.Options, sessionDuration, progressFn)
 	if err != nil {
 		var pErr *fs.PathError
 		switch {
+		case c.Writer.Written():
+			// load progress has already been streamed so the error must be streamed too
+			writeStreamError(c, err)
 		case errors.As(err, &pErr):
 			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
 		case errors.Is(err, api.ErrInvalidOpts):
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
 		return
 	}
 
+	var optionsUsed map[string]interface{}
+	if req.Debug {
+		optionsUsed = loaded.Options.Map()
+	}
+
 	// an empty request loads the model
-	if req.Prompt == "" && req.Template == "" && req.System == "" {
+	if req.Prompt == "" && req.Template == "" && req.System == "" && !req.Continue {
 		c.JSON(http.StatusOK, api.GenerateResponse{
-			CreatedAt: time.Now().UTC(),
-			Model:     req.Model,
-			Done:      true})
+			CreatedAt:   time.Now().UTC(),
+			Model:       req.Model,
+			Done:        true,
+			OptionsUsed: optionsUsed,
+		})
 		return
 	}
 
@@ -215,6 +427,15 @@ func GenerateHandler(c *gin.Context) {
 	switch {
 	case req.Raw:
 		prompt = req.Prompt
+	case req.Continue:
+		// the context ends with the response, so generating from it extends the response
+		prevCtx, err := loaded.runner.Decode(c.Request.Context(), req.Context)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		prompt = strings.TrimPrefix(prevCtx, " ")
 	case req.Prompt != "":
 		if req.Template != "" {
 			// override the default model template
@@ -247,6 +468,22 @@ func GenerateHandler(c *gin.Context) {
 		prompt = rebuild.String()
 	}
 
+	var thinking *thinkingParser
+	if req.Think {
+		thinking = newThinkingParser()
+	}
+
+	predictReq := llm.PredictOpts{
+		Prompt:      prompt,
+		Format:      req.Format,
+		Images:      req.Images,
+		Grammar:     grammar,
+		CachePrompt: req.Continue,
+	}
+	rec := newRecorder("generate", predictReq, req.Schema)
+	filter := newResponseFilter()
+
+	var timings streamTimings
 	ch := make(chan any)
 	var generated strings.Builder
 	go func() {
@@ -254,8 +491,8 @@ func GenerateHandler(c *gin.Context) {
 
 		fn := func(r llm.PredictResult) {
 			// Update model expiration
-			loaded.expireAt = time.Now().Add(sessionDuration)
-			loaded.expireTimer.Reset(sessionDuration)
+			keepLoaded(sessionDuration)
+			rec.Add(r.Content)
 
 			// Build up the full response
 			if _, err := generated.WriteString(r.Content); err != nil {
@@ -264,10 +501,11 @@ func GenerateHandler(c *gin.Context) {
 			}
 
 			resp := api.GenerateResponse{
-				Model:     req.Model,
-				CreatedAt: time.Now().UTC(),
-				Done:      r.Done,
-				Response:  r.Content,
+				Model:        req.Model,
+				CreatedAt:    time.Now().UTC(),
+				Done:         r.Done,
+				Response:     r.Content,
+				FinishReason: r.FinishReason,
 				Metrics: api.Metrics{
 					PromptEvalCount:    r.PromptEvalCount,
 					PromptEvalDuration: r.PromptEvalDuration,
@@ -276,9 +514,60 @@ func GenerateHandler(c *gin.Context) {
 				},
 			}
 
+			if !r.Done {
+				timings.Add(resp.CreatedAt)
+			}
+
+			if thinking != nil {
+				resp.Thinking, resp.Response = thinking.Add(r.Content)
+				if r.Done {
+					th, content := thinking.Flush()
+					resp.Thinking += th
+					resp.Response += content
+				}
+			}
+
+			var outputModeration *api.ModerationResult
+			if filter != nil {
+				if filter.Add(resp.Response, resp.Thinking) && !r.Done {
+					return
+				}
+
+				if r.Done {
+					response, thought, output, err := filter.Filter(c, "generate", req.Model, generateMessages(req.System, req.Prompt))
+					if err != nil {
+						ch <- gin.H{"error": err.Error()}
+						return
+					}
+
+					if filter.hold {
+						resp.Response, resp.Thinking = response, thought
+
+						// the context continues from the response the client was given
+						generated.Reset()
+						generated.WriteString(resp.Response)
+					}
+
+					outputModeration = output
+				}
+			}
+
 			if r.Done {
+				if inputModeration != nil || outputModeration != nil {
+					resp.Moderation = &api.Moderation{Input: inputModeration, Output: outputModeration}
+				}
+
 				resp.TotalDuration = time.Since(checkpointStart)
 				resp.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				resp.FirstTokenDuration = timings.FirstTokenDuration(checkpointStart)
+				resp.ChunkTimestamps = timings.chunks
+				resp.OptionsUsed = optionsUsed
+				if req.ReturnPrompt {
+					resp.Prompt = prompt
+				}
+				setContextUsage(&resp.Metrics, loaded.Options.NumCtx)
+				requests.Record(r.EvalCount)
+				logRequestTokens(c, r.PromptEvalCount, r.EvalCount)
 
 				if !req.Raw {
 					embd, err := loaded.runner.Encode(c.Request.Context(), prompt+generated.String())
@@ -294,12 +583,9 @@ func GenerateHandler(c *gin.Context) {
 		}
 
 		// Start prediction
-		predictReq := llm.PredictOpts{
-			Prompt: prompt,
-			Format: req.Format,
-			Images: req.Images,
-		}
-		if err := loaded.runner.Predict(c.Request.Context(), predictReq, fn); err != nil {
+		err := loaded.runner.Predict(c.Request.Context(), predictReq, fn)
+		rec.Close(err)
+		if err != nil {
 			ch <- gin.H{"error": err.Error()}
 		}
 	}()
@@ -307,11 +593,12 @@ func GenerateHandler(c *gin.Context) {
 	if req.Stream != nil && !*req.Stream {
 		// Accumulate responses into the final response
 		var final api.GenerateResponse
-		var sb strings.Builder
+		var sb, tb strings.Builder
 		for resp := range ch {
 			switch r := resp.(type) {
 			case api.GenerateResponse:
 				sb.WriteString(r.Response)
+				tb.WriteString(r.Thinking)
 				final = r
 			case gin.H:
 				if errorMsg, ok := r["error"].(string); ok {
@@ -328,19 +615,24 @@ func GenerateHandler(c *gin.Context) {
 		}
 
 		final.Response = sb.String()
+		final.Thinking = tb.String()
 		c.JSON(http.StatusOK, final)
 		return
 	}
 
-	streamResponse(c, ch)
+	streamResponseWithHeartbeat(c, ch, func() any {
+		return api.GenerateResponse{Model: req.Model, CreatedAt: time.Now().UTC()}
+	})
 }
 
-func EmbeddingHandler(c *gin.Context) {
+func InfillHandler(c *gin.Context) {
 	loaded.mu.Lock()
 	defer loaded.mu.Unlock()
 
-	var req api.EmbeddingRequest
+	checkpointStart := time.Now()
+	var req api.InfillRequest
 	err := c.ShouldBindJSON(&req)
+
 	switch {
 	case errors.Is(err, io.EOF):
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
@@ -350,90 +642,150 @@ func EmbeddingHandler(c *gin.Context) {
 		return
 	}
 
-	if req.Model == "" {
+	logRequestModel(c, req.Model, req.Prefix)
+
+	// validate the request
+	switch {
+	case req.Model == "":
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
 		return
+	case req.Prefix == "" && req.Suffix == "":
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "prefix or suffix is required"})
+		return
 	}
 
-	sessionDuration := defaultSessionDuration
-	_, err = load(c, req.Model, req.Options, sessionDuration)
-	if err != nil {
-		var pErr *fs.PathError
-		switch {
-		case errors.As(err, &pErr):
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
-		case errors.Is(err, api.ErrInvalidOpts):
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if req.MaxTokens > 0 {
+		if req.Options == nil {
+			req.Options = make(map[string]interface{})
 		}
-		return
-	}
 
-	if !loaded.Options.EmbeddingOnly {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "embedding option must be set to true"})
-		return
+		req.Options["num_predict"] = req.MaxTokens
 	}
 
-	embedding, err := loaded.runner.Embedding(c.Request.Context(), req.Prompt)
+	// a model which wasn't trained to fill in the middle would be given tokens it doesn't know
+	model, err := GetModel(req.Model)
 	if err != nil {
-		log.Printf("embedding generation failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate embedding"})
+		var pErr *fs.PathError
+		if errors.As(err, &pErr) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		} else {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	resp := api.EmbeddingResponse{
-		Embedding: embedding,
-	}
-	c.JSON(http.StatusOK, resp)
-}
-
-func PullModelHandler(c *gin.Context) {
-	var req api.PullRequest
-	err := c.ShouldBindJSON(&req)
-	switch {
-	case errors.Is(err, io.EOF):
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+	if ok, err := supportsInfill(model.ModelPath); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
-	case err != nil:
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model '%s' can't fill in the middle, use a code model trained for infilling", req.Model)})
 		return
 	}
 
-	if req.Name == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+	sessionDuration := defaultSessionDuration
+	if _, err := load(c, req.Model, req.Options, sessionDuration, nil); err != nil {
+		var pErr *fs.PathError
+		switch {
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		case errors.Is(err, api.ErrInvalidOpts):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
+	checkpointLoaded := time.Now()
+
 	ch := make(chan any)
 	go func() {
 		defer close(ch)
-		fn := func(r api.ProgressResponse) {
-			ch <- r
-		}
 
-		regOpts := &RegistryOptions{
-			Insecure: req.Insecure,
+		fn := func(r llm.PredictResult) {
+			// Update model expiration
+			keepLoaded(sessionDuration)
+
+			resp := api.GenerateResponse{
+				Model:        req.Model,
+				CreatedAt:    time.Now().UTC(),
+				Done:         r.Done,
+				Response:     r.Content,
+				FinishReason: r.FinishReason,
+				Metrics: api.Metrics{
+					PromptEvalCount:    r.PromptEvalCount,
+					PromptEvalDuration: r.PromptEvalDuration,
+					EvalCount:          r.EvalCount,
+					EvalDuration:       r.EvalDuration,
+				},
+			}
+
+			if r.Done {
+				resp.TotalDuration = time.Since(checkpointStart)
+				resp.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				requests.Record(r.EvalCount)
+				logRequestTokens(c, r.PromptEvalCount, r.EvalCount)
+			}
+
+			ch <- resp
 		}
 
-		ctx, cancel := context.WithCancel(c.Request.Context())
-		defer cancel()
+		// an empty suffix still needs to go through the infill endpoint so the
+		// model sees its fill-in-the-middle tokens, use a single newline instead
+		suffix := req.Suffix
+		if suffix == "" {
+			suffix = "\n"
+		}
 
-		if err := PullModel(ctx, req.Name, regOpts, fn); err != nil {
+		predictReq := llm.PredictOpts{
+			Prompt: req.Prefix,
+			Suffix: suffix,
+		}
+		if err := loaded.runner.Predict(c.Request.Context(), predictReq, fn); err != nil {
 			ch <- gin.H{"error": err.Error()}
 		}
 	}()
 
 	if req.Stream != nil && !*req.Stream {
-		waitForStream(c, ch)
+		// Accumulate responses into the final response
+		var final api.GenerateResponse
+		var sb strings.Builder
+		for resp := range ch {
+			switch r := resp.(type) {
+			case api.GenerateResponse:
+				sb.WriteString(r.Response)
+				final = r
+			case gin.H:
+				if errorMsg, ok := r["error"].(string); ok {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+					return
+				} else {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected error format in response"})
+					return
+				}
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected error"})
+				return
+			}
+		}
+
+		final.Response = sb.String()
+		c.JSON(http.StatusOK, final)
 		return
 	}
 
-	streamResponse(c, ch)
+	streamResponseWithHeartbeat(c, ch, func() any {
+		return api.GenerateResponse{Model: req.Model, CreatedAt: time.Now().UTC()}
+	})
 }
 
-func PushModelHandler(c *gin.Context) {
-	var req api.PushRequest
+func EmbeddingHandler(c *gin.Context) {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	var req api.EmbeddingRequest
 	err := c.ShouldBindJSON(&req)
 	switch {
 	case errors.Is(err, io.EOF):
@@ -444,29 +796,226 @@ func PushModelHandler(c *gin.Context) {
 		return
 	}
 
-	if req.Name == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
 		return
 	}
 
-	ch := make(chan any)
-	go func() {
-		defer close(ch)
+	logRequestModel(c, req.Model, req.Prompt)
+
+	if err := validEmbeddingRequest(req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionDuration := defaultSessionDuration
+	_, err = load(c, req.Model, req.Options, sessionDuration, nil)
+	if err != nil {
+		var pErr *fs.PathError
+		switch {
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		case errors.Is(err, api.ErrInvalidOpts):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if !loaded.Options.EmbeddingOnly {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "embedding option must be set to true"})
+		return
+	}
+
+	if len(req.Images) > 0 && len(loaded.ProjectorPaths) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model '%s' does not support image embeddings", req.Model)})
+		return
+	}
+
+	tokens, err := loaded.runner.Encode(c.Request.Context(), req.Prompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	truncated, err := truncateTokens(tokens, loaded.Options.NumCtx, req.Truncate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var embedding []float64
+	if len(req.Images) > 0 {
+		prompt := req.Prompt
+		if len(truncated) < len(tokens) {
+			if prompt, err = loaded.runner.Decode(c.Request.Context(), truncated); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		embedding, err = loaded.runner.Embedding(c.Request.Context(), llm.EmbeddingOpts{
+			Content: embeddingContent(prompt, len(req.Images)),
+			Images:  req.Images,
+		})
+	} else {
+		embedding, err = embedTokens(c.Request.Context(), loaded.runner, truncated, req.Pooling)
+	}
+	if err != nil {
+		log.Printf("embedding generation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate embedding"})
+		return
+	}
+
+	embedding, err = reduceEmbedding(embedding, req.Dimensions, req.Normalize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logRequestTokens(c, len(truncated), 0)
+
+	resp := api.EmbeddingResponse{
+		Embedding: embedding,
+		Tokens:    len(truncated),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// embeddingContent references each image by id ahead of the prompt so images and text
+// are embedded together as a single sequence
+func embeddingContent(prompt string, numImages int) string {
+	var sb strings.Builder
+	for i := 0; i < numImages; i++ {
+		fmt.Fprintf(&sb, "[img-%d]", i)
+	}
+
+	if numImages > 0 && prompt != "" {
+		sb.WriteString(" ")
+	}
+
+	sb.WriteString(prompt)
+	return sb.String()
+}
+
+func PullModelHandler(c *gin.Context) {
+	var req api.PullRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.URL != "" {
+		if _, _, err := parseModelURL(req.URL); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if req.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if offline() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errOffline.Error()})
+		return
+	}
+
+	// pulls of the same model share one download, however the model is named
+	name := req.Name
+	if req.URL == "" {
+		name = ParseModelPath(req.Name).GetFullTagname()
+	}
+
+	ch, err := operations.Join(c, fingerprint("pull", name, req.URL, strconv.FormatBool(req.Insecure), strconv.FormatBool(req.AcceptLicense)), func(ctx context.Context, send func(any)) {
 		fn := func(r api.ProgressResponse) {
-			ch <- r
+			send(r)
 		}
 
 		regOpts := &RegistryOptions{
-			Insecure: req.Insecure,
+			Insecure:      req.Insecure,
+			AcceptLicense: req.AcceptLicense,
 		}
 
-		ctx, cancel := context.WithCancel(c.Request.Context())
-		defer cancel()
+		if err := lockStore(ctx, req.Wait, fn); err != nil {
+			send(gin.H{"error": err.Error()})
+			return
+		}
+		defer store.Unlock()
+
+		ctx, release := store.Pins(ctx)
+		defer release()
+
+		var err error
+		if req.URL != "" {
+			err = pullURL(ctx, req.Name, req.URL, fn)
+		} else {
+			err = PullModel(ctx, req.Name, regOpts, fn)
+		}
+
+		if err != nil {
+			send(gin.H{"error": err.Error()})
+		}
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Stream != nil && !*req.Stream {
+		waitForStream(c, ch)
+		return
+	}
+
+	streamResponse(c, ch)
+}
+
+func PushModelHandler(c *gin.Context) {
+	var req api.PushRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if offline() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errOffline.Error()})
+		return
+	}
+
+	ch, err := operations.Join(c, fingerprint("push", ParseModelPath(req.Name).GetFullTagname(), strconv.FormatBool(req.Insecure), req.Username, req.Password), func(ctx context.Context, send func(any)) {
+		fn := func(r api.ProgressResponse) {
+			send(r)
+		}
+
+		regOpts := &RegistryOptions{
+			Insecure: req.Insecure,
+		}
 
 		if err := PushModel(ctx, req.Name, regOpts, fn); err != nil {
-			ch <- gin.H{"error": err.Error()}
+			send(gin.H{"error": err.Error()})
 		}
-	}()
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 
 	if req.Stream != nil && !*req.Stream {
 		waitForStream(c, ch)
@@ -521,20 +1070,28 @@ func CreateModelHandler(c *gin.Context) {
 		return
 	}
 
-	ch := make(chan any)
-	go func() {
-		defer close(ch)
+	ch, err := operations.Join(c, fingerprint("create", ParseModelPath(req.Name).GetFullTagname(), req.Path, req.Modelfile), func(ctx context.Context, send func(any)) {
 		fn := func(resp api.ProgressResponse) {
-			ch <- resp
+			send(resp)
 		}
 
-		ctx, cancel := context.WithCancel(c.Request.Context())
-		defer cancel()
+		if err := lockStore(ctx, req.Wait, fn); err != nil {
+			send(gin.H{"error": err.Error()})
+			return
+		}
+		defer store.Unlock()
+
+		ctx, release := store.Pins(ctx)
+		defer release()
 
 		if err := CreateModel(ctx, req.Name, filepath.Dir(req.Path), commands, fn); err != nil {
-			ch <- gin.H{"error": err.Error()}
+			send(gin.H{"error": err.Error()})
 		}
-	}()
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 
 	if req.Stream != nil && !*req.Stream {
 		waitForStream(c, ch)
@@ -561,7 +1118,18 @@ func DeleteModelHandler(c *gin.Context) {
 		return
 	}
 
-	if err := DeleteModel(req.Name); err != nil {
+	if err := store.TryLock(c.Request.Context()); err != nil {
+		storeLockError(c, err)
+		return
+	}
+	defer store.Unlock()
+
+	del := DeleteModel
+	if req.Purge {
+		del = PurgeModel
+	}
+
+	if err := del(req.Name); err != nil {
 		if os.IsNotExist(err) {
 			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Name)})
 		} else {
@@ -633,6 +1201,7 @@ func GetModelInfo(name string) (*api.ShowResponse, error) {
 		System:   model.System,
 		Template: model.Template,
 		Details:  modelDetails,
+		Labels:   model.Labels,
 	}
 
 	mf, err := ShowModelfile(model)
@@ -642,6 +1211,12 @@ func GetModelInfo(name string) (*api.ShowResponse, error) {
 
 	resp.Modelfile = mf
 
+	resp.Digest = model.Digest
+	resp.Layers, err = modelLayers(ParseModelPath(name))
+	if err != nil {
+		return nil, err
+	}
+
 	var params []string
 	cs := 30
 	for k, v := range model.Options {
@@ -701,6 +1276,7 @@ func ListModelsHandler(c *gin.Context) {
 			Size:    model.Size,
 			Digest:  model.Digest,
 			Details: modelDetails,
+			Labels:  model.Labels,
 		}, nil
 	}
 
@@ -731,6 +1307,17 @@ func ListModelsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, api.ListResponse{Models: models})
 }
 
+// storeLockError responds with 409 Conflict when another process is changing the model store
+func storeLockError(c *gin.Context, err error) {
+	var lockedErr *StoreLockedError
+	if errors.As(err, &lockedErr) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
 func CopyModelHandler(c *gin.Context) {
 	var req api.CopyRequest
 	err := c.ShouldBindJSON(&req)
@@ -753,7 +1340,16 @@ func CopyModelHandler(c *gin.Context) {
 		return
 	}
 
-	if err := CopyModel(req.Source, req.Destination); err != nil {
+	if err := store.TryLock(c.Request.Context()); err != nil {
+		storeLockError(c, err)
+		return
+	}
+	defer store.Unlock()
+
+	ctx, release := store.Pins(c.Request.Context())
+	defer release()
+
+	if err := CopyModel(ctx, req.Source, req.Destination); err != nil {
 		if os.IsNotExist(err) {
 			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Source)})
 		} else {
@@ -779,6 +1375,12 @@ func HeadBlobHandler(c *gin.Context) {
 }
 
 func CreateBlobHandler(c *gin.Context) {
+	if err := store.TryLock(c.Request.Context()); err != nil {
+		storeLockError(c, err)
+		return
+	}
+	defer store.Unlock()
+
 	layer, err := NewLayer(c.Request.Body, "")
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -804,14 +1406,88 @@ var defaultAllowOrigins = []string{
 	"0.0.0.0",
 }
 
+// checkStore migrates the store to the current layout, sets aside manifests broken by a crash during
+// an earlier create or pull, purges models deleted longer ago than the trash keeps them and prunes unused
+// layers, unless another process is changing the store
+func checkStore() error {
+	if err := store.TryLock(context.Background()); err != nil {
+		var lockedErr *StoreLockedError
+		if errors.As(err, &lockedErr) {
+			log.Printf("skipping model store checks: %v", err)
+			return nil
+		}
+
+		return err
+	}
+	defer store.Unlock()
+
+	err := migrateStore(false, func(m StoreMigration) {
+		log.Printf("migrating model store to version %d: %s", m.Version, m.Description)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := CheckManifests(); err != nil {
+		return err
+	}
+
+	if err := PurgeTrash(); err != nil {
+		return err
+	}
+
+	if noprune := os.Getenv("OLLAMA_NOPRUNE"); noprune == "" {
+		// clean up unused layers and manifests
+		if err := PruneLayers(); err != nil {
+			return err
+		}
+
+		manifestsPath, err := GetManifestPath()
+		if err != nil {
+			return err
+		}
+
+		if err := PruneDirectory(manifestsPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func NewServer() (*Server, error) {
 	workDir, err := os.MkdirTemp("", "ollama")
 	if err != nil {
 		return nil, err
 	}
 
+	proxies, err := parseTrustedProxies(os.LookupEnv("OLLAMA_TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, err
+	}
+
+	accessLog, err := loadAccessLog()
+	if err != nil {
+		return nil, err
+	}
+
+	chaos, err := loadChaos()
+	if err != nil {
+		return nil, err
+	}
+
+	routing, err := loadRoutingConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Server{
-		WorkDir: workDir,
+		WorkDir:   workDir,
+		BasePath:  basePath(),
+		proxies:   proxies,
+		accessLog: accessLog,
+		chaos:     chaos,
+		routing:   routing,
 	}, nil
 }
 
@@ -834,56 +1510,138 @@ func (s *Server) GenerateRoutes() http.Handler {
 		)
 	}
 
-	r := gin.Default()
+	logger := gin.LoggerWithFormatter(s.proxies.logFormatter)
+	if s.accessLog != nil {
+		logger = s.accessLog.Handler
+	}
+
+	r := gin.New()
 	r.Use(
+		logger,
+		gin.Recovery(),
 		cors.New(config),
+	)
+
+	if s.chaos != nil {
+		log.Printf("WARNING: injecting failures into responses: %s", s.chaos)
+		r.Use(s.chaos.Handler)
+	}
+
+	r.Use(
+		compressResponses,
 		func(c *gin.Context) {
 			c.Set("workDir", s.WorkDir)
 			c.Next()
 		},
 	)
 
-	r.POST("/api/pull", PullModelHandler)
-	r.POST("/api/generate", GenerateHandler)
-	r.POST("/api/chat", ChatHandler)
-	r.POST("/api/embeddings", EmbeddingHandler)
-	r.POST("/api/create", CreateModelHandler)
-	r.POST("/api/push", PushModelHandler)
-	r.POST("/api/copy", CopyModelHandler)
-	r.DELETE("/api/delete", DeleteModelHandler)
-	r.POST("/api/show", ShowModelHandler)
-	r.POST("/api/blobs/:digest", CreateBlobHandler)
-	r.HEAD("/api/blobs/:digest", HeadBlobHandler)
+	// the client IP logged is X-Forwarded-For for requests through a trusted proxy
+	if err := r.SetTrustedProxies(s.proxies.Strings()); err != nil {
+		log.Printf("couldn't set trusted proxies: %v", err)
+	}
+
+	// routes are served under the base path, for a reverse proxy which doesn't strip it
+	g := r.Group(s.BasePath)
+
+	if s.routing != nil {
+		for _, route := range s.routing.Routes {
+			log.Printf("routing requests for %s: %s", route.Model, route)
+		}
+	}
+
+	// generation requests are routed before they take their turn, mirrored requests come back through r
+	route := s.routing.Handler(r)
+
+	g.POST("/api/pull", PullModelHandler)
+	g.GET("/api/ps", ListRunningHandler)
+	g.GET("/api/metrics", MetricsHandler)
+	g.GET("/api/egress", EgressHandler)
+	g.GET("/api/licenses", ListLicensesHandler)
+	g.POST("/api/logs", LogsHandler)
+	g.POST("/api/generate", route, requests.Track, clients.Turn, batches.Interactive, GenerateHandler)
+	g.POST("/api/chat", route, requests.Track, clients.Turn, batches.Interactive, ChatHandler)
+	g.POST("/api/load", requests.Track, LoadHandler)
+	g.POST("/api/infill", requests.Track, clients.Turn, batches.Interactive, InfillHandler)
+	g.POST("/api/classify", requests.Track, ClassifyHandler)
+	g.POST("/api/embeddings", requests.Track, EmbeddingHandler)
+	g.POST("/api/embeddings/batch", requests.Track, BatchEmbeddingHandler)
+	g.POST("/api/chunk", requests.Track, ChunkHandler)
+	g.POST("/api/tokenize", TokenizeHandler)
+	g.POST("/api/detokenize", DetokenizeHandler)
+	g.GET("/api/presets", ListPresetsHandler)
+	g.POST("/api/presets", CreatePresetHandler)
+	g.GET("/api/presets/:name", GetPresetHandler)
+	g.DELETE("/api/presets/:name", DeletePresetHandler)
+	g.GET("/api/conversations", ListConversationsHandler)
+	g.POST("/api/conversations", CreateConversationHandler)
+	g.GET("/api/conversations/:id", GetConversationHandler)
+	g.DELETE("/api/conversations/:id", DeleteConversationHandler)
+	g.GET("/api/collections", ListCollectionsHandler)
+	g.POST("/api/collections", CreateCollectionHandler)
+	g.DELETE("/api/collections/:name", DeleteCollectionHandler)
+	g.POST("/api/collections/:name/documents", requests.Track, UpsertDocumentsHandler)
+	g.POST("/api/collections/:name/query", requests.Track, QueryCollectionHandler)
+	g.POST("/api/create", CreateModelHandler)
+	g.POST("/api/push", PushModelHandler)
+	g.POST("/api/shares", CreateShareHandler)
+	g.GET("/api/shares/:token", ShareArchiveHandler)
+	g.HEAD("/api/shares/:token", ShareArchiveHandler)
+	g.POST("/api/copy", CopyModelHandler)
+	g.DELETE("/api/delete", DeleteModelHandler)
+	g.POST("/api/restore", RestoreModelHandler)
+	g.GET("/api/trash", ListTrashHandler)
+	g.POST("/api/show", ShowModelHandler)
+	g.GET("/api/openapi.json", OpenAPIHandler)
+	g.POST("/api/blobs/:digest", CreateBlobHandler)
+	g.HEAD("/api/blobs/:digest", HeadBlobHandler)
+
+	g.POST("/v1/audio/transcriptions", TranscriptionHandler)
+	g.POST("/v1/images/generations", requests.Track, clients.Turn, batches.Interactive, ImageGenerationHandler)
+	g.POST("/v1/moderations", requests.Track, ModerationHandler)
+	g.POST("/v1/completions", route, requests.Track, clients.Turn, batches.Interactive, CompletionHandler)
+	g.POST("/v1/chat/completions", route, requests.Track, clients.Turn, batches.Interactive, ChatCompletionHandler)
+	g.POST("/v1/embeddings", requests.Track, EmbeddingsHandler)
 
 	for _, method := range []string{http.MethodGet, http.MethodHead} {
-		r.Handle(method, "/", func(c *gin.Context) {
+		g.Handle(method, "/", func(c *gin.Context) {
 			c.String(http.StatusOK, "Ollama is running")
 		})
 
-		r.Handle(method, "/api/tags", ListModelsHandler)
-		r.Handle(method, "/api/version", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"version": version.Version})
+		g.Handle(method, "/api/tags", ListModelsHandler)
+		g.Handle(method, "/api/version", func(c *gin.Context) {
+			c.JSON(http.StatusOK, api.VersionResponse{
+				Version:        version.Version,
+				Commit:         version.Commit,
+				BuildDate:      version.BuildDate,
+				GoVersion:      runtime.Version(),
+				LlamaCppCommit: version.LlamaCppCommit,
+				Backends:       llm.Backends(),
+			})
 		})
 	}
 
 	return r
 }
 
-func Serve(ln net.Listener) error {
-	if noprune := os.Getenv("OLLAMA_NOPRUNE"); noprune == "" {
-		// clean up unused layers and manifests
-		if err := PruneLayers(); err != nil {
-			return err
-		}
+// Serve serves the API on every listener, it returns when any of them fails
+func Serve(lns ...net.Listener) error {
+	if len(lns) == 0 {
+		return errors.New("no listeners to serve on")
+	}
 
-		manifestsPath, err := GetManifestPath()
-		if err != nil {
-			return err
-		}
+	var err error
+	trashRetention, err = loadTrashRetention()
+	if err != nil {
+		return err
+	}
 
-		if err := PruneDirectory(manifestsPath); err != nil {
-			return err
-		}
+	if err := checkStore(); err != nil {
+		return err
+	}
+
+	if trashRetention > 0 {
+		log.Printf("keeping deleted models for %s", trashRetention)
+		go purgeTrashEvery(context.Background(), trashPurgeInterval)
 	}
 
 	s, err := NewServer()
@@ -892,7 +1650,69 @@ func Serve(ln net.Listener) error {
 	}
 	r := s.GenerateRoutes()
 
-	log.Printf("Listening on %s (version %s)", ln.Addr(), version.Version)
+	schedule, err := loadScheduleConfig()
+	if err != nil {
+		return err
+	}
+
+	if schedule != nil {
+		log.Printf("running %d scheduled job(s)", len(schedule.Jobs))
+		go runSchedule(context.Background(), s.WorkDir, schedule)
+	}
+
+	hookConfig, err := loadHookConfig()
+	if err != nil {
+		return err
+	}
+
+	if hookConfig != nil {
+		log.Printf("filtering requests with %d hook(s)", len(hookConfig.Hooks))
+		for _, h := range hookConfig.Hooks {
+			RegisterHook(h)
+		}
+	}
+
+	clients.max, err = loadClientLimit()
+	if err != nil {
+		return err
+	}
+
+	if clients.max > 0 {
+		log.Printf("limiting clients to %d generation request(s) running or waiting", clients.max)
+	}
+
+	if offline() {
+		log.Printf("offline, models will not be pulled or pushed")
+	}
+
+	registries, err = loadRegistryConfig()
+	if err != nil {
+		return err
+	}
+
+	for registry, mirrors := range registries {
+		log.Printf("pulling from '%s' through %d endpoint(s)", registry, len(mirrors.endpoints))
+	}
+
+	moderation, err = loadModerationConfig()
+	if err != nil {
+		return err
+	}
+
+	if moderation != nil {
+		log.Printf("moderating generations with %s", moderation.Model)
+	}
+
+	for _, d := range egress().Destinations {
+		log.Printf("may send requests to %s: %s", d.URL, d.Reason)
+	}
+
+	shares.base = s.BasePath
+	for _, ln := range lns {
+		log.Printf("Listening on %s (version %s)", ln.Addr(), version.Version)
+		shares.addrs = append(shares.addrs, ln.Addr())
+	}
+
 	srvr := &http.Server{
 		Handler: r,
 	}
@@ -905,6 +1725,12 @@ func Serve(ln net.Listener) error {
 		if loaded.runner != nil {
 			loaded.runner.Close()
 		}
+		if loadedAudio.transcriber != nil {
+			loadedAudio.transcriber.Close()
+		}
+		if loadedModerator.runner != nil {
+			loadedModerator.runner.Close()
+		}
 		os.RemoveAll(s.WorkDir)
 		os.Exit(0)
 	}()
@@ -916,7 +1742,54 @@ func Serve(ln net.Listener) error {
 		}
 	}
 
-	return srvr.Serve(ln)
+	streaming, err = loadStreamLimits()
+	if err != nil {
+		return err
+	}
+
+	if streaming.summarize {
+		log.Printf("summarizing responses to clients more than %d responses behind", streaming.size)
+	}
+
+	yield, err := loadGPUYield()
+	if err != nil {
+		return err
+	}
+
+	if yield != nil {
+		log.Printf("unloading idle models when free VRAM stays below %s", format.HumanBytes(yield.low))
+		go yieldGPU(context.Background(), yield, gpuYieldInterval)
+	}
+
+	if reserve, err := llm.GPUReserve(); err != nil {
+		return err
+	} else if reserve > 0 {
+		log.Printf("reserving %s of VRAM for other applications", format.HumanBytes(reserve))
+	}
+
+	adminLns, token, err := listenAdmin()
+	if err != nil {
+		return err
+	}
+
+	admin := &http.Server{Handler: adminHandler(token)}
+	for _, ln := range adminLns {
+		log.Printf("serving debug endpoints on %s", ln.Addr())
+		go func(ln net.Listener) {
+			if err := admin.Serve(ln); err != nil {
+				log.Printf("admin listener %s: %v", ln.Addr(), err)
+			}
+		}(ln)
+	}
+
+	errCh := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			errCh <- srvr.Serve(ln)
+		}(ln)
+	}
+
+	return <-errCh
 }
 
 func waitForStream(c *gin.Context, ch chan interface{}) {
@@ -945,13 +1818,41 @@ func waitForStream(c *gin.Context, ch chan interface{}) {
 }
 
 func streamResponse(c *gin.Context, ch chan any) {
+	streamResponseWithHeartbeat(c, ch, nil)
+}
+
+// streamResponseWithHeartbeat streams the responses in ch, sending the response heartbeat returns whenever
+// none has been sent for the heartbeat interval, e.g. while a long prompt is evaluated, so proxies and
+// clients don't close the idle connection
+func streamResponseWithHeartbeat(c *gin.Context, ch chan any, heartbeat func() any) {
+	// responses wait in a bounded buffer for a client which reads slower than they are produced
+	buf := newStreamBuffer(streaming)
+	defer buf.Stop()
+
+	var interval time.Duration
+	if heartbeat != nil {
+		interval = streaming.heartbeat
+	}
+
+	go func() {
+		for val := range ch {
+			buf.Push(val)
+		}
+
+		buf.Close()
+	}()
+
 	c.Header("Content-Type", "application/x-ndjson")
 	c.Stream(func(w io.Writer) bool {
-		val, ok := <-ch
+		val, ok := buf.Pop(interval)
 		if !ok {
 			return false
 		}
 
+		if val == nil {
+			val = heartbeat()
+		}
+
 		bts, err := json.Marshal(val)
 		if err != nil {
 			log.Printf("streamResponse: json.Marshal failed with %s", err)
@@ -969,13 +1870,124 @@ func streamResponse(c *gin.Context, ch chan any) {
 	})
 }
 
+func LoadHandler(c *gin.Context) {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	checkpointStart := time.Now()
+
+	var req api.LoadRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	sessionDuration := defaultSessionDuration
+	if req.KeepAlive != "" {
+		sessionDuration, err = time.ParseDuration(req.KeepAlive)
+		if err != nil || sessionDuration <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid keep_alive '%s'", req.KeepAlive)})
+			return
+		}
+	}
+
+	if req.MainGPU != nil {
+		if req.Options == nil {
+			req.Options = map[string]interface{}{}
+		}
+		req.Options["main_gpu"] = *req.MainGPU
+	}
+
+	var progressFn func(api.LoadProgress) any
+	if req.Stream == nil || *req.Stream {
+		progressFn = func(p api.LoadProgress) any {
+			return api.LoadResponse{Model: req.Model, CreatedAt: time.Now().UTC(), Load: &p}
+		}
+	}
+
+	if _, err := loadWithProgress(c, req.Model, req.Options, sessionDuration, progressFn); err != nil {
+		var pErr *fs.PathError
+		switch {
+		case c.Writer.Written():
+			// load progress has already been streamed so the error must be streamed too
+			writeStreamError(c, err)
+		case errors.As(err, &pErr):
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
+		case errors.Is(err, api.ErrInvalidOpts):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	placement := loaded.runner.Placement()
+	c.JSON(http.StatusOK, api.LoadResponse{
+		Model:        req.Model,
+		CreatedAt:    time.Now().UTC(),
+		ExpiresAt:    loaded.expireAt.UTC(),
+		LoadDuration: time.Since(checkpointStart),
+		Size:         placement.Size,
+		TotalLayers:  placement.TotalLayers,
+		GPULayers:    placement.GPULayers,
+		MainGPU:      placement.MainGPU,
+	})
+}
+
+// setContextUsage reports how many tokens the prompt took and how many are left in the context window
+func setContextUsage(m *api.Metrics, numCtx int) {
+	m.PromptTokens = m.PromptEvalCount
+
+	remaining := numCtx - m.PromptEvalCount - m.EvalCount
+	if remaining < 0 {
+		remaining = 0
+	}
+	m.ContextRemaining = &remaining
+}
+
+// streamTimings records when each chunk of a streamed response was produced
+type streamTimings struct {
+	chunks []time.Time
+}
+
+func (t *streamTimings) Add(ts time.Time) {
+	t.chunks = append(t.chunks, ts)
+}
+
+// FirstTokenDuration is the time from the start of the request until the first chunk was produced
+func (t *streamTimings) FirstTokenDuration(start time.Time) time.Duration {
+	if len(t.chunks) == 0 {
+		return 0
+	}
+
+	return t.chunks[0].Sub(start)
+}
+
+// endsWithAssistant reports whether the last message of the history and the new messages is from the assistant
+func endsWithAssistant(history, messages []api.Message) bool {
+	all := append(append([]api.Message{}, history...), messages...)
+	return len(all) > 0 && strings.EqualFold(all[len(all)-1].Role, "assistant")
+}
+
 func ChatHandler(c *gin.Context) {
 	loaded.mu.Lock()
 	defer loaded.mu.Unlock()
 
 	checkpointStart := time.Now()
 
-	var req api.ChatRequest
+	var req apix.ChatRequest
 	err := c.ShouldBindJSON(&req)
 	switch {
 	case errors.Is(err, io.EOF):
@@ -986,6 +1998,46 @@ func ChatHandler(c *gin.Context) {
 		return
 	}
 
+	// the history of a stored conversation is sent ahead of the new messages
+	var history []api.Message
+	if req.Conversation != "" {
+		conversation, err := conversations.Get(req.Conversation)
+		if err != nil {
+			if errors.Is(err, errConversationNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation '%s' not found", req.Conversation)})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		if req.Model == "" {
+			req.Model = conversation.Model
+		}
+
+		history = conversation.Messages
+	}
+
+	if req.Preset != "" {
+		preset, err := presets.Get(req.Preset)
+		if err != nil {
+			if errors.Is(err, errPresetNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("preset '%s' not found", req.Preset)})
+			} else {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		applyPreset(&req, preset, history)
+	}
+
+	var latest string
+	if len(req.Messages) > 0 {
+		latest = req.Messages[len(req.Messages)-1].Content
+	}
+	logRequestModel(c, req.Model, latest)
+
 	// validate the request
 	switch {
 	case req.Model == "":
@@ -994,51 +2046,153 @@ func ChatHandler(c *gin.Context) {
 	case len(req.Format) > 0 && req.Format != "json":
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be json"})
 		return
+	case len(req.Format) > 0 && len(req.Schema) > 0:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format and schema can't both be set"})
+		return
+	case req.Continue && !endsWithAssistant(history, req.Messages):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "continue requires the last message to be from the assistant"})
+		return
+	case req.TopLogprobs < 0 || req.TopLogprobs > maxTopLogprobs:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("top_logprobs must be between 0 and %d", maxTopLogprobs)})
+		return
+	case req.TopLogprobs > 0 && !req.Logprobs:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "top_logprobs requires logprobs"})
+		return
+	}
+
+	var grammar string
+	if len(req.Schema) > 0 {
+		var err error
+		grammar, err = schemaGrammar(req.Schema)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if hooks.Handles(HookStagePrompt) && len(req.Messages) > 0 {
+		filtered, err := hooks.Run(c.Request.Context(), HookRequest{
+			Stage:    HookStagePrompt,
+			Endpoint: "chat",
+			Model:    req.Model,
+			Messages: req.Messages,
+		})
+		if err != nil {
+			abortFilterError(c, err)
+			return
+		}
+
+		req.Messages = filtered.Messages
+	}
+
+	inputModeration, err := moderateInput(c, chatInput(req.Messages))
+	if err != nil {
+		abortFilterError(c, err)
+		return
 	}
 
 	sessionDuration := defaultSessionDuration
-	model, err := load(c, req.Model, req.Options, sessionDuration)
+
+	var progressFn func(api.LoadProgress) any
+	if req.Stream == nil || *req.Stream {
+		progressFn = func(p api.LoadProgress) any {
+			return api.ChatResponse{Model: req.Model, CreatedAt: time.Now().UTC(), Load: &p}
+		}
+	}
+
+	model, err := loadWithProgress(c, req.Model, req.Options, sessionDuration, progressFn)
 	if err != nil {
 		var pErr *fs.PathError
 		switch {
+		case c.Writer.Written():
+			// load progress has already been streamed so the error must be streamed too
+			writeStreamError(c, err)
 		case errors.As(err, &pErr):
 			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", req.Model)})
 		case errors.Is(err, api.ErrInvalidOpts):
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, llm.ErrOutOfMemory):
+			c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
 		return
 	}
 
+	var optionsUsed map[string]interface{}
+	if req.Debug {
+		optionsUsed = loaded.Options.Map()
+	}
+
 	// an empty request loads the model
-	if len(req.Messages) == 0 {
-		c.JSON(http.StatusOK, api.ChatResponse{CreatedAt: time.Now().UTC(), Model: req.Model, Done: true})
+	if len(req.Messages) == 0 && !req.Continue {
+		c.JSON(http.StatusOK, api.ChatResponse{CreatedAt: time.Now().UTC(), Model: req.Model, Done: true, OptionsUsed: optionsUsed})
 		return
 	}
 
 	checkpointLoaded := time.Now()
 
-	prompt, images, err := model.ChatPrompt(req.Messages)
+	prompt, images, err := model.ChatPrompt(append(append([]api.Message{}, history...), req.Messages...))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	var thinking *thinkingParser
+	if req.Think {
+		thinking = newThinkingParser()
+	}
+
+	predictReq := llm.PredictOpts{
+		Prompt:      prompt,
+		Format:      req.Format,
+		Images:      images,
+		Grammar:     grammar,
+		CachePrompt: req.Continue,
+	}
+
+	if req.Logprobs {
+		predictReq.NumProbs = maxTopLogprobs
+	}
+
+	rec := newRecorder("chat", predictReq, req.Schema)
+	filter := newResponseFilter()
+
+	var timings streamTimings
 	ch := make(chan any)
 
 	go func() {
 		defer close(ch)
 
+		// the reply is accumulated to be added to the conversation
+		var content, thought strings.Builder
+
+		// logprobs of responses held back by the filter are sent with the next response
+		var heldLogprobs []api.TokenLogprob
+		send := func(resp api.ChatResponse) {
+			if resp.Message != nil {
+				content.WriteString(resp.Message.Content)
+				thought.WriteString(resp.Message.Thinking)
+			}
+
+			if len(heldLogprobs) > 0 {
+				resp.Logprobs = append(heldLogprobs, resp.Logprobs...)
+				heldLogprobs = nil
+			}
+
+			ch <- resp
+		}
+
 		fn := func(r llm.PredictResult) {
 			// Update model expiration
-			loaded.expireAt = time.Now().Add(sessionDuration)
-			loaded.expireTimer.Reset(sessionDuration)
+			keepLoaded(sessionDuration)
+			rec.Add(r.Content)
 
 			resp := api.ChatResponse{
-				Model:     req.Model,
-				CreatedAt: time.Now().UTC(),
-				Done:      r.Done,
+				Model:        req.Model,
+				CreatedAt:    time.Now().UTC(),
+				Done:         r.Done,
+				FinishReason: r.FinishReason,
 				Metrics: api.Metrics{
 					PromptEvalCount:    r.PromptEvalCount,
 					PromptEvalDuration: r.PromptEvalDuration,
@@ -1050,35 +2204,109 @@ func ChatHandler(c *gin.Context) {
 			if r.Done {
 				resp.TotalDuration = time.Since(checkpointStart)
 				resp.LoadDuration = checkpointLoaded.Sub(checkpointStart)
+				resp.FirstTokenDuration = timings.FirstTokenDuration(checkpointStart)
+				resp.ChunkTimestamps = timings.chunks
+				resp.OptionsUsed = optionsUsed
+				if req.ReturnPrompt {
+					resp.Prompt = prompt
+				}
+				setContextUsage(&resp.Metrics, loaded.Options.NumCtx)
+				requests.Record(r.EvalCount)
+				logRequestTokens(c, r.PromptEvalCount, r.EvalCount)
+
+				if thinking != nil {
+					// send anything still held back by the parser before the final response
+					if th, content := thinking.Flush(); th != "" || content != "" {
+						if filter == nil || !filter.Add(content, th) {
+							send(api.ChatResponse{
+								Model:     req.Model,
+								CreatedAt: time.Now().UTC(),
+								Message:   &api.Message{Role: "assistant", Content: content, Thinking: th},
+							})
+						}
+					}
+				}
+
+				var outputModeration *api.ModerationResult
+				if filter != nil {
+					content, th, output, err := filter.Filter(c, "chat", req.Model, req.Messages)
+					if err != nil {
+						ch <- gin.H{"error": err.Error()}
+						return
+					}
+
+					if filter.hold {
+						send(api.ChatResponse{
+							Model:     req.Model,
+							CreatedAt: time.Now().UTC(),
+							Message:   &api.Message{Role: "assistant", Content: content, Thinking: th},
+						})
+					}
+
+					outputModeration = output
+				}
+
+				if inputModeration != nil || outputModeration != nil {
+					resp.Moderation = &api.Moderation{Input: inputModeration, Output: outputModeration}
+				}
 			} else {
+				timings.Add(resp.CreatedAt)
 				resp.Message = &api.Message{Role: "assistant", Content: r.Content}
+				if thinking != nil {
+					resp.Message.Thinking, resp.Message.Content = thinking.Add(r.Content)
+				}
+
+				if req.Logprobs {
+					resp.Logprobs = tokenLogprobs(r.Probs, req.TopLogprobs)
+				}
+
+				if filter != nil && filter.Add(resp.Message.Content, resp.Message.Thinking) {
+					heldLogprobs = append(heldLogprobs, resp.Logprobs...)
+					return
+				}
 			}
 
-			ch <- resp
+			send(resp)
 		}
 
 		// Start prediction
-		predictReq := llm.PredictOpts{
-			Prompt: prompt,
-			Format: req.Format,
-			Images: images,
-		}
-		if err := loaded.runner.Predict(c.Request.Context(), predictReq, fn); err != nil {
+		err := loaded.runner.Predict(c.Request.Context(), predictReq, fn)
+		rec.Close(err)
+		if err != nil {
 			ch <- gin.H{"error": err.Error()}
+			return
+		}
+
+		if req.Conversation != "" {
+			reply := api.Message{Role: "assistant", Content: content.String(), Thinking: thought.String()}
+
+			var err error
+			if req.Continue {
+				err = conversations.Continue(req.Conversation, req.Messages, reply)
+			} else {
+				err = conversations.Append(req.Conversation, append(req.Messages, reply)...)
+			}
+
+			if err != nil {
+				ch <- gin.H{"error": err.Error()}
+			}
 		}
 	}()
 
 	if req.Stream != nil && !*req.Stream {
 		// Accumulate responses into the final response
 		var final api.ChatResponse
-		var sb strings.Builder
+		var sb, tb strings.Builder
+		var logprobs []api.TokenLogprob
 		for resp := range ch {
 			switch r := resp.(type) {
 			case api.ChatResponse:
 				if r.Message != nil {
 					sb.WriteString(r.Message.Content)
+					tb.WriteString(r.Message.Thinking)
 				}
 
+				logprobs = append(logprobs, r.Logprobs...)
 				final = r
 			case gin.H:
 				if errorMsg, ok := r["error"].(string); ok {
@@ -1094,10 +2322,13 @@ func ChatHandler(c *gin.Context) {
 			}
 		}
 
-		final.Message = &api.Message{Role: "assistant", Content: sb.String()}
+		final.Message = &api.Message{Role: "assistant", Content: sb.String(), Thinking: tb.String()}
+		final.Logprobs = logprobs
 		c.JSON(http.StatusOK, final)
 		return
 	}
 
-	streamResponse(c, ch)
+	streamResponseWithHeartbeat(c, ch, func() any {
+		return api.ChatResponse{Model: req.Model, CreatedAt: time.Now().UTC(), Message: &api.Message{Role: "assistant"}}
+	})
 }
@@ -10,12 +10,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
 	"github.com/jmorganca/ollama/parser"
 )
 
@@ -58,9 +63,11 @@ func Test_Routes(t *testing.T) {
 			Expected: func(t *testing.T, resp *http.Response) {
 				contentType := resp.Header.Get("Content-Type")
 				assert.Equal(t, contentType, "application/json; charset=utf-8")
-				body, err := io.ReadAll(resp.Body)
+				var version api.VersionResponse
+				err := json.NewDecoder(resp.Body).Decode(&version)
 				assert.Nil(t, err)
-				assert.Equal(t, `{"version":"0.0.0"}`, string(body))
+				assert.Equal(t, "0.0.0", version.Version)
+				assert.Equal(t, runtime.Version(), version.GoVersion)
 			},
 		},
 		{
@@ -192,3 +199,347 @@ func Test_Routes(t *testing.T) {
 	}
 
 }
+
+func TestEmbeddingContent(t *testing.T) {
+	assert.Equal(t, "hello", embeddingContent("hello", 0))
+	assert.Equal(t, "[img-0]", embeddingContent("", 1))
+	assert.Equal(t, "[img-0][img-1] a photo of a llama", embeddingContent("a photo of a llama", 2))
+}
+
+func TestSetContextUsage(t *testing.T) {
+	m := api.Metrics{PromptEvalCount: 46, EvalCount: 113}
+	setContextUsage(&m, 2048)
+	assert.Equal(t, 46, m.PromptTokens)
+	require.NotNil(t, m.ContextRemaining)
+	assert.Equal(t, 1889, *m.ContextRemaining)
+	assert.Equal(t, 2048, m.ContextSize())
+
+	m = api.Metrics{PromptEvalCount: 2000, EvalCount: 100}
+	setContextUsage(&m, 2048)
+	assert.Equal(t, 0, *m.ContextRemaining)
+}
+
+func TestGetModelInfoLayers(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	f, err := os.CreateTemp(t.TempDir(), "ollama-model")
+	require.NoError(t, err)
+	f.Close()
+
+	create := func(name, modelfile string) {
+		commands, err := parser.Parse(strings.NewReader(modelfile))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), name, "", commands, func(api.ProgressResponse) {}))
+	}
+
+	create("example.com/library/base", fmt.Sprintf("FROM %s\nLICENSE MIT", f.Name()))
+	create("derived", "FROM example.com/library/base\nSYSTEM hello")
+
+	resp, err := GetModelInfo("derived")
+	require.NoError(t, err)
+
+	model, err := GetModel("derived")
+	require.NoError(t, err)
+	assert.Equal(t, model.Digest, resp.Digest)
+
+	// the empty model file adds no model layer
+	require.Len(t, resp.Layers, 3)
+	assert.Equal(t, "application/vnd.docker.container.image.v1+json", resp.Layers[0].MediaType)
+	assert.Equal(t, "registry.ollama.ai", resp.Layers[0].Registry)
+
+	var total int64
+	for _, layer := range resp.Layers {
+		total += layer.Size
+
+		switch layer.MediaType {
+		case "application/vnd.ollama.image.license":
+			assert.Equal(t, "example.com", layer.Registry, layer.MediaType)
+			assert.Equal(t, "example.com/library/base:latest", layer.From, layer.MediaType)
+		case "application/vnd.ollama.image.system":
+			assert.Equal(t, "registry.ollama.ai", layer.Registry)
+			assert.Empty(t, layer.From)
+		}
+	}
+
+	assert.Equal(t, model.Size, total)
+}
+
+func TestEndsWithAssistant(t *testing.T) {
+	history := []api.Message{{Role: "user", Content: "Why is the sky blue?"}}
+
+	assert.False(t, endsWithAssistant(nil, nil))
+	assert.False(t, endsWithAssistant(history, nil))
+	assert.True(t, endsWithAssistant(history, []api.Message{{Role: "Assistant", Content: "Rayleigh"}}))
+	assert.True(t, endsWithAssistant(append(history, api.Message{Role: "assistant"}), nil))
+	assert.False(t, endsWithAssistant(append(history, api.Message{Role: "assistant"}), []api.Message{{Role: "user"}}))
+}
+
+func TestSameWeights(t *testing.T) {
+	base := &Model{Name: "llama2:latest", ModelPath: "/blobs/sha256-1"}
+
+	assert.True(t, sameWeights(base, &Model{Name: "llama2:pirate", ModelPath: "/blobs/sha256-1", Template: "{{ .Prompt }}"}))
+	assert.False(t, sameWeights(base, &Model{Name: "mistral:latest", ModelPath: "/blobs/sha256-2"}))
+	assert.False(t, sameWeights(base, &Model{Name: "llama2:sql", ModelPath: "/blobs/sha256-1", AdapterPaths: []string{"/blobs/sha256-3"}}))
+	assert.False(t, sameWeights(base, &Model{Name: "llava:latest", ModelPath: "/blobs/sha256-1", ProjectorPaths: []string{"/blobs/sha256-4"}}))
+}
+
+func TestLoadSharedWeights(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	adapter := filepath.Join(t.TempDir(), "sql.bin")
+	require.NoError(t, os.WriteFile(adapter, []byte("adapter"), 0o644))
+
+	for _, m := range []struct{ name, modelfile string }{
+		{"echo", "FROM mock://echo"},
+		{"echo:pirate", "FROM echo\nSYSTEM Talk like a pirate."},
+		{"echo:sql", "FROM echo\nADAPTER " + adapter},
+	} {
+		commands, err := parser.Parse(strings.NewReader(m.modelfile))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), m.name, "", commands, func(api.ProgressResponse) {}))
+	}
+
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+	defer unload()
+
+	runner := func(name string) llm.LLM {
+		_, err := loadModel(context.TODO(), "", name, nil, time.Minute, nil)
+		require.NoError(t, err)
+		assert.Equal(t, ParseModelPath(name).GetShortTagname(), loaded.Model.ShortName)
+		return loaded.runner
+	}
+
+	base := runner("echo")
+
+	// identical weights share the runner, different adapters need a runner of their own
+	assert.Same(t, base, runner("echo:pirate"))
+	sql := runner("echo:sql")
+	assert.NotSame(t, base, sql)
+	assert.NotSame(t, sql, runner("echo"))
+}
+
+// streamLines posts the request and decodes each line of the streamed response into a new T
+func streamLines[T any](t *testing.T, srv *httptest.Server, path string, body any) []T {
+	t.Helper()
+
+	bts, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	resp, err := srv.Client().Post(srv.URL+path, "application/json", bytes.NewReader(bts))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var lines []T
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var line T
+		require.NoError(t, dec.Decode(&line))
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func TestStreamTimings(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	// the final response has the time of each chunk before it, the first after the request started
+	check := func(start time.Time, chunks []time.Time, final api.Metrics) {
+		t.Helper()
+
+		require.Len(t, final.ChunkTimestamps, len(chunks))
+		for i, ts := range final.ChunkTimestamps {
+			assert.True(t, chunks[i].Equal(ts), i)
+		}
+
+		assert.Positive(t, final.FirstTokenDuration)
+		assert.LessOrEqual(t, final.FirstTokenDuration, time.Since(start))
+	}
+
+	start := time.Now()
+	var chunks []time.Time
+	var final api.GenerateResponse
+	for _, line := range streamLines[api.GenerateResponse](t, srv, "/api/generate", api.GenerateRequest{Model: "echo", Prompt: "one two three"}) {
+		switch {
+		case line.Load != nil:
+		case line.Done:
+			final = line
+		default:
+			chunks = append(chunks, line.CreatedAt)
+		}
+	}
+
+	require.True(t, final.Done)
+	assert.Len(t, chunks, 3)
+	check(start, chunks, final.Metrics)
+
+	start = time.Now()
+	chunks = nil
+	var chat api.ChatResponse
+	for _, line := range streamLines[api.ChatResponse](t, srv, "/api/chat", api.ChatRequest{Model: "echo", Messages: []api.Message{{Role: "user", Content: "one two"}}}) {
+		switch {
+		case line.Load != nil:
+		case line.Done:
+			chat = line
+		default:
+			chunks = append(chunks, line.CreatedAt)
+		}
+	}
+
+	require.True(t, chat.Done)
+	assert.NotEmpty(t, chunks)
+	check(start, chunks, chat.Metrics)
+
+	// responses which aren't streamed have the timings too
+	stream := false
+	lines := streamLines[api.GenerateResponse](t, srv, "/api/generate", api.GenerateRequest{Model: "echo", Prompt: "one two three", Stream: &stream})
+	require.Len(t, lines, 1)
+	assert.Len(t, lines[0].ChunkTimestamps, 3)
+	assert.Positive(t, lines[0].FirstTokenDuration)
+}
+
+func TestLoadHandler(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	})
+
+	post := func(body string) *http.Response {
+		resp, err := srv.Client().Post(srv.URL+"/api/load", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	cases := map[string]struct {
+		body   string
+		status int
+		err    string
+	}{
+		"no body":            {"", http.StatusBadRequest, "missing request body"},
+		"no model":           {`{"stream": false}`, http.StatusBadRequest, "model is required"},
+		"invalid keep_alive": {`{"model": "echo", "keep_alive": "soon", "stream": false}`, http.StatusBadRequest, "invalid keep_alive 'soon'"},
+		"invalid options":    {`{"model": "echo", "stream": false, "options": {"temperatur": 0}}`, http.StatusBadRequest, "invalid options"},
+		"missing model":      {`{"model": "missing", "stream": false}`, http.StatusNotFound, "model 'missing' not found"},
+	}
+
+	for name, tt := range cases {
+		resp := post(tt.body)
+		assert.Equal(t, tt.status, resp.StatusCode, name)
+
+		var e map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&e), name)
+		assert.Contains(t, e["error"], tt.err, name)
+	}
+
+	resp := post(`{"model": "echo", "keep_alive": "10m", "stream": false}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var load api.LoadResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&load))
+	assert.Equal(t, "echo", load.Model)
+	assert.Nil(t, load.Load)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), load.ExpiresAt, time.Minute)
+
+	// the model stays loaded for the requests which follow
+	loaded.mu.Lock()
+	assert.NotNil(t, loaded.runner)
+	assert.Equal(t, "echo:latest", loaded.Model.ShortName)
+	loaded.mu.Unlock()
+}
+
+func TestLoadProgress(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+
+	unloaded := func() {
+		loaded.mu.Lock()
+		defer loaded.mu.Unlock()
+		unload()
+	}
+	t.Cleanup(unloaded)
+
+	// a streamed load reports its progress before the final response
+	lines := streamLines[api.LoadResponse](t, srv, "/api/load", api.LoadRequest{Model: "echo"})
+	require.Len(t, lines, 2)
+	require.NotNil(t, lines[0].Load)
+	assert.Equal(t, float64(100), lines[0].Load.Percent)
+	assert.Equal(t, lines[0].Load.Total, lines[0].Load.Completed)
+	assert.Positive(t, lines[0].Load.Total)
+	assert.Nil(t, lines[1].Load)
+	assert.False(t, lines[1].ExpiresAt.IsZero())
+
+	// a loaded model has no progress to report
+	lines = streamLines[api.LoadResponse](t, srv, "/api/load", api.LoadRequest{Model: "echo"})
+	require.Len(t, lines, 1)
+	assert.Nil(t, lines[0].Load)
+
+	// generate and chat streams begin with the progress of loading the model
+	unloaded()
+	generate := streamLines[api.GenerateResponse](t, srv, "/api/generate", api.GenerateRequest{Model: "echo", Prompt: "hi"})
+	require.NotEmpty(t, generate)
+	require.NotNil(t, generate[0].Load)
+	assert.Empty(t, generate[0].Response)
+	for _, line := range generate[1:] {
+		assert.Nil(t, line.Load)
+	}
+
+	unloaded()
+	chat := streamLines[api.ChatResponse](t, srv, "/api/chat", api.ChatRequest{Model: "echo", Messages: []api.Message{{Role: "user", Content: "hi"}}})
+	require.NotEmpty(t, chat)
+	require.NotNil(t, chat[0].Load)
+	assert.Nil(t, chat[0].Message)
+
+	// responses which aren't streamed don't report progress
+	unloaded()
+	stream := false
+	generate = streamLines[api.GenerateResponse](t, srv, "/api/generate", api.GenerateRequest{Model: "echo", Prompt: "hi", Stream: &stream})
+	require.Len(t, generate, 1)
+	assert.Nil(t, generate[0].Load)
+	assert.True(t, generate[0].Done)
+
+	// requests with invalid options are refused before any progress is streamed
+	unloaded()
+	resp, err := srv.Client().Post(srv.URL+"/api/load", "application/json", strings.NewReader(`{"model": "echo", "options": {"temperatur": 0}}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxPendingMirrors is how many mirrored requests can wait or run at once, requests which would be
+	// mirrored beyond it are not
+	maxPendingMirrors = 4
+
+	// mirrorLogLength is how much of the response served is kept for the mirror log
+	mirrorLogLength = 1 << 20
+)
+
+// routingConfig is read from $OLLAMA_ROUTING or ~/.ollama/routing.json. A route serves a share of the
+// requests for a model with other models, and mirrors a share of them to a model whose responses are
+// discarded or logged, e.g.
+//
+//	{"routes": [{
+//	  "model": "assistant",
+//	  "split": [{"model": "assistant:ft", "percent": 10}],
+//	  "mirror": {"model": "assistant:next", "percent": 5, "log": true}
+//	}]}
+type routingConfig struct {
+	Routes []modelRoute `json:"routes"`
+
+	rand func() float64
+
+	// mirrors holds a slot for each mirrored request waiting or running
+	mirrors chan struct{}
+	pending sync.WaitGroup
+
+	logMu sync.Mutex
+}
+
+type modelRoute struct {
+	Model  string        `json:"model"`
+	Split  []routeTarget `json:"split,omitempty"`
+	Mirror *routeMirror  `json:"mirror,omitempty"`
+}
+
+// routeTarget serves the percent of the requests for the route's model
+type routeTarget struct {
+	Model   string  `json:"model"`
+	Percent float64 `json:"percent"`
+}
+
+// routeMirror sends a copy of the percent of the requests for the route's model to its model once they
+// have been served
+type routeMirror struct {
+	Model   string  `json:"model"`
+	Percent float64 `json:"percent"`
+
+	// Log appends the mirrored responses, next to the requests and the responses served, to mirror.jsonl in
+	// the log directory
+	Log bool `json:"log,omitempty"`
+}
+
+type mirroredKey struct{}
+
+// mirrored reports whether the request is a copy sent to a mirror
+func mirrored(ctx context.Context) bool {
+	return ctx.Value(mirroredKey{}) != nil
+}
+
+func routingConfigPath() (string, error) {
+	if path, ok := os.LookupEnv("OLLAMA_ROUTING"); ok {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "routing.json"), nil
+}
+
+// loadRoutingConfig returns nil if routing has not been configured
+func loadRoutingConfig() (*routingConfig, error) {
+	path, err := routingConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rt, err := parseRoutingConfig(bts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return rt, nil
+}
+
+func parseRoutingConfig(bts []byte) (*routingConfig, error) {
+	rt := routingConfig{rand: rand.Float64, mirrors: make(chan struct{}, maxPendingMirrors)}
+	if err := json.Unmarshal(bts, &rt); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i, route := range rt.Routes {
+		if route.Model == "" {
+			return nil, errors.New("route is missing a model")
+		}
+
+		model := ParseModelPath(route.Model).GetShortTagname()
+		if seen[model] {
+			return nil, fmt.Errorf("more than one route for '%s'", route.Model)
+		}
+
+		seen[model] = true
+		rt.Routes[i].Model = model
+
+		if len(route.Split) == 0 && route.Mirror == nil {
+			return nil, fmt.Errorf("route for '%s' doesn't split or mirror requests", route.Model)
+		}
+
+		var total float64
+		for j, target := range route.Split {
+			if err := checkRouteTarget(model, target.Model, target.Percent); err != nil {
+				return nil, err
+			}
+
+			rt.Routes[i].Split[j].Model = ParseModelPath(target.Model).GetShortTagname()
+			total += target.Percent
+		}
+
+		if total > 100 {
+			return nil, fmt.Errorf("route for '%s' splits more than 100%% of requests", route.Model)
+		}
+
+		if route.Mirror != nil {
+			if err := checkRouteTarget(model, route.Mirror.Model, route.Mirror.Percent); err != nil {
+				return nil, err
+			}
+
+			route.Mirror.Model = ParseModelPath(route.Mirror.Model).GetShortTagname()
+		}
+	}
+
+	return &rt, nil
+}
+
+func checkRouteTarget(model, target string, percent float64) error {
+	switch {
+	case target == "":
+		return fmt.Errorf("route for '%s' is missing a model to send requests to", model)
+	case ParseModelPath(target).GetShortTagname() == model:
+		return fmt.Errorf("route for '%s' sends requests to the same model", model)
+	case percent <= 0 || percent > 100:
+		return fmt.Errorf("route for '%s' to '%s': percent must be more than 0 and at most 100", model, target)
+	}
+
+	return nil
+}
+
+func (route modelRoute) String() string {
+	var parts []string
+	for _, target := range route.Split {
+		parts = append(parts, fmt.Sprintf("%g%% served by %s", target.Percent, target.Model))
+	}
+
+	if route.Mirror != nil {
+		parts = append(parts, fmt.Sprintf("%g%% mirrored to %s", route.Mirror.Percent, route.Mirror.Model))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (rt *routingConfig) route(model string) *modelRoute {
+	model = ParseModelPath(model).GetShortTagname()
+	for i := range rt.Routes {
+		if rt.Routes[i].Model == model {
+			return &rt.Routes[i]
+		}
+	}
+
+	return nil
+}
+
+// split picks the model to serve a request for the route's model, "" for the route's model itself
+func (rt *routingConfig) split(route *modelRoute) string {
+	roll := rt.rand() * 100
+	for _, target := range route.Split {
+		if roll < target.Percent {
+			return target.Model
+		}
+
+		roll -= target.Percent
+	}
+
+	return ""
+}
+
+// withFields returns the request with the fields set
+func withFields(req map[string]json.RawMessage, fields map[string]any) ([]byte, error) {
+	out := make(map[string]json.RawMessage, len(req)+len(fields))
+	for k, v := range req {
+		out[k] = v
+	}
+
+	for k, v := range fields {
+		bts, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		out[k] = bts
+	}
+
+	return json.Marshal(out)
+}
+
+// Handler routes generation requests by their model. Mirrored requests are sent through h once the request
+// has been served, they take turns at the model with the clients' requests as a client of their own.
+func (rt *routingConfig) Handler(h http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rt == nil || mirrored(c.Request.Context()) {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// a request which can't be read is left to its handler to refuse
+		var req map[string]json.RawMessage
+		var model string
+		if json.Unmarshal(body, &req) != nil || json.Unmarshal(req["model"], &model) != nil {
+			c.Next()
+			return
+		}
+
+		route := rt.route(model)
+		if route == nil {
+			c.Next()
+			return
+		}
+
+		served := route.Model
+		if target := rt.split(route); target != "" {
+			bts, err := withFields(req, map[string]any{"model": target})
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			served = target
+			c.Request.Body = io.NopCloser(bytes.NewReader(bts))
+			c.Request.ContentLength = int64(len(bts))
+		}
+
+		m := route.Mirror
+		if m == nil || m.Model == served || rt.rand()*100 >= m.Percent {
+			c.Next()
+			return
+		}
+
+		var response *truncatedWriter
+		if m.Log {
+			response = &truncatedWriter{ResponseWriter: c.Writer, max: mirrorLogLength}
+			c.Writer = response
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+
+		bts, err := withFields(req, map[string]any{"model": m.Model, "stream": false})
+		if err != nil {
+			log.Printf("routing: couldn't mirror %s: %v", c.Request.URL.Path, err)
+			return
+		}
+
+		ctx := context.WithValue(context.Background(), mirroredKey{}, true)
+		r, err := http.NewRequestWithContext(ctx, c.Request.Method, c.Request.URL.RequestURI(), bytes.NewReader(bts))
+		if err != nil {
+			log.Printf("routing: couldn't mirror %s: %v", c.Request.URL.Path, err)
+			return
+		}
+
+		r.Header = c.Request.Header.Clone()
+		r.Header.Del("Accept-Encoding")
+		r.RemoteAddr = c.Request.RemoteAddr
+
+		entry := mirrorLogEntry{Time: time.Now(), Path: c.Request.URL.Path, Model: served, Mirror: m.Model, Request: body}
+		if response != nil {
+			entry.Response = response.buf.String()
+		}
+
+		select {
+		case rt.mirrors <- struct{}{}:
+		default:
+			log.Printf("routing: not mirroring %s to %s, %d mirrored requests are already pending", entry.Path, m.Model, maxPendingMirrors)
+			return
+		}
+
+		rt.pending.Add(1)
+		go func() {
+			defer rt.pending.Done()
+			defer func() { <-rt.mirrors }()
+			rt.mirror(h, r, m, entry)
+		}()
+	}
+}
+
+// mirror serves the copy of a request and discards or logs its response
+func (rt *routingConfig) mirror(h http.Handler, r *http.Request, m *routeMirror, entry mirrorLogEntry) {
+	w := &mirrorWriter{header: make(http.Header), status: http.StatusOK}
+	h.ServeHTTP(w, r)
+
+	d := time.Since(entry.Time)
+	log.Printf("routing: mirrored %s for %s to %s: %d in %s", entry.Path, entry.Model, entry.Mirror, w.status, d.Round(time.Millisecond))
+
+	if !m.Log {
+		return
+	}
+
+	entry.MirrorStatus = w.status
+	entry.MirrorResponse = w.buf.String()
+	entry.MirrorDuration = float64(d.Microseconds()) / 1000
+	if err := rt.log(entry); err != nil {
+		log.Printf("routing: couldn't log mirrored response: %v", err)
+	}
+}
+
+type mirrorLogEntry struct {
+	Time     time.Time       `json:"time"`
+	Path     string          `json:"path"`
+	Model    string          `json:"model"`
+	Mirror   string          `json:"mirror"`
+	Request  json.RawMessage `json:"request"`
+	Response string          `json:"response"`
+
+	MirrorStatus   int     `json:"mirror_status"`
+	MirrorResponse string  `json:"mirror_response"`
+	MirrorDuration float64 `json:"mirror_duration_ms"`
+}
+
+// log appends the entry to mirror.jsonl in the log directory
+func (rt *routingConfig) log(entry mirrorLogEntry) error {
+	dir, err := LogDir()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	bts, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	rt.logMu.Lock()
+	defer rt.logMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(dir, "mirror.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(bts, '\n'))
+	return err
+}
+
+// truncatedWriter keeps the start of the response as it is written
+type truncatedWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+	max int
+}
+
+func (w *truncatedWriter) Write(b []byte) (int, error) {
+	if n := w.max - w.buf.Len(); n >= len(b) {
+		w.buf.Write(b)
+	} else if n > 0 {
+		w.buf.Write(b[:n])
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *truncatedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// mirrorWriter takes the response to a mirrored request in place of a client
+type mirrorWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *mirrorWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *mirrorWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+func (w *mirrorWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *mirrorWriter) Flush() {}
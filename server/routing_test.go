@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoutingConfig(t *testing.T) {
+	rt, err := parseRoutingConfig([]byte(`{"routes": [{
+		"model": "assistant",
+		"split": [{"model": "assistant:ft", "percent": 10}, {"model": "other", "percent": 20}],
+		"mirror": {"model": "assistant:next", "percent": 5, "log": true}
+	}]}`))
+	require.NoError(t, err)
+	require.Len(t, rt.Routes, 1)
+
+	route := rt.Routes[0]
+	assert.Equal(t, "assistant:latest", route.Model)
+	assert.Equal(t, []routeTarget{{"assistant:ft", 10}, {"other:latest", 20}}, route.Split)
+	assert.Equal(t, &routeMirror{Model: "assistant:next", Percent: 5, Log: true}, route.Mirror)
+	assert.Equal(t, "10% served by assistant:ft, 20% served by other:latest, 5% mirrored to assistant:next", route.String())
+
+	assert.Same(t, &rt.Routes[0], rt.route("assistant"))
+	assert.Nil(t, rt.route("assistant:ft"))
+
+	cases := map[string]string{
+		"missing model":    `{"routes": [{"split": [{"model": "b", "percent": 10}]}]}`,
+		"duplicate route":  `{"routes": [{"model": "a", "split": [{"model": "b", "percent": 10}]}, {"model": "a:latest", "mirror": {"model": "b", "percent": 10}}]}`,
+		"no split/mirror":  `{"routes": [{"model": "a"}]}`,
+		"same model":       `{"routes": [{"model": "a", "split": [{"model": "a:latest", "percent": 10}]}]}`,
+		"missing target":   `{"routes": [{"model": "a", "mirror": {"percent": 10}}]}`,
+		"zero percent":     `{"routes": [{"model": "a", "mirror": {"model": "b"}}]}`,
+		"over 100 percent": `{"routes": [{"model": "a", "split": [{"model": "b", "percent": 60}, {"model": "c", "percent": 60}]}]}`,
+		"invalid json":     `{"routes": {}}`,
+	}
+
+	for name, config := range cases {
+		_, err := parseRoutingConfig([]byte(config))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRoutingSplit(t *testing.T) {
+	rt, err := parseRoutingConfig([]byte(`{"routes": [{"model": "assistant", "split": [{"model": "a:ft", "percent": 10}, {"model": "b:ft", "percent": 20}]}]}`))
+	require.NoError(t, err)
+
+	route := rt.route("assistant")
+	for roll, want := range map[float64]string{0.05: "a:ft", 0.15: "b:ft", 0.29: "b:ft", 0.3: "", 0.99: ""} {
+		rt.rand = func() float64 { return roll }
+		assert.Equal(t, want, rt.split(route), roll)
+	}
+}
+
+// routingServer serves requests with a handler which answers with the model and stream fields of the request
+func routingServer(t *testing.T, rt *routingConfig) (*gin.Engine, func() []string) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var mirrors []string
+
+	r := gin.New()
+	r.POST("/api/chat", rt.Handler(r), func(c *gin.Context) {
+		var req struct {
+			Model  string `json:"model"`
+			Stream *bool  `json:"stream"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if mirrored(c.Request.Context()) {
+			mu.Lock()
+			mirrors = append(mirrors, req.Model)
+			mu.Unlock()
+
+			assert.Equal(t, "mirror", clientKey(c))
+			assert.False(t, *req.Stream)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"model": req.Model})
+	})
+
+	return r, func() []string {
+		rt.pending.Wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+		return mirrors
+	}
+}
+
+func postChat(r http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body)))
+	return w
+}
+
+func TestRoutingHandler(t *testing.T) {
+	rt, err := parseRoutingConfig([]byte(`{"routes": [{
+		"model": "assistant",
+		"split": [{"model": "assistant:ft", "percent": 50}],
+		"mirror": {"model": "assistant:next", "percent": 50}
+	}]}`))
+	require.NoError(t, err)
+
+	r, mirrors := routingServer(t, rt)
+
+	// the first roll splits the request, the second mirrors it
+	rolls := []float64{0.9, 0.1}
+	rt.rand = func() float64 {
+		roll := rolls[0]
+		rolls = append(rolls[1:], roll)
+		return roll
+	}
+
+	w := postChat(r, `{"model": "assistant", "stream": true}`)
+	assert.JSONEq(t, `{"model": "assistant"}`, w.Body.String())
+	assert.Equal(t, []string{"assistant:next"}, mirrors())
+
+	rolls = []float64{0.1, 0.9}
+	w = postChat(r, `{"model": "assistant:latest"}`)
+	assert.JSONEq(t, `{"model": "assistant:ft"}`, w.Body.String())
+	assert.Len(t, mirrors(), 1)
+
+	// requests for other models and requests which can't be read are passed on as they are
+	w = postChat(r, `{"model": "other"}`)
+	assert.JSONEq(t, `{"model": "other"}`, w.Body.String())
+
+	w = postChat(r, `{"model": 1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, mirrors(), 1)
+}
+
+func TestRoutingMirrorLog(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("OLLAMA_LOG_DIR", dir)
+
+	rt, err := parseRoutingConfig([]byte(`{"routes": [{"model": "assistant", "mirror": {"model": "assistant:next", "percent": 100, "log": true}}]}`))
+	require.NoError(t, err)
+
+	r, mirrors := routingServer(t, rt)
+
+	w := postChat(r, `{"model": "assistant"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"assistant:next"}, mirrors())
+
+	bts, err := os.ReadFile(filepath.Join(dir, "mirror.jsonl"))
+	require.NoError(t, err)
+
+	var entry mirrorLogEntry
+	require.NoError(t, json.Unmarshal(bts, &entry))
+	assert.Equal(t, "/api/chat", entry.Path)
+	assert.Equal(t, "assistant:latest", entry.Model)
+	assert.Equal(t, "assistant:next", entry.Mirror)
+	assert.JSONEq(t, `{"model": "assistant"}`, string(entry.Request))
+	assert.JSONEq(t, `{"model": "assistant"}`, entry.Response)
+	assert.Equal(t, http.StatusOK, entry.MirrorStatus)
+	assert.JSONEq(t, `{"model": "assistant:next"}`, entry.MirrorResponse)
+}
+
+func TestRoutingMirrorsPending(t *testing.T) {
+	rt, err := parseRoutingConfig([]byte(`{"routes": [{"model": "assistant", "mirror": {"model": "assistant:next", "percent": 100}}]}`))
+	require.NoError(t, err)
+
+	r, mirrors := routingServer(t, rt)
+
+	// mirrored requests beyond the pending limit are dropped
+	for i := 0; i < maxPendingMirrors; i++ {
+		rt.mirrors <- struct{}{}
+	}
+
+	postChat(r, `{"model": "assistant"}`)
+	assert.Empty(t, mirrors())
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+const (
+	scheduleActionKeepWarm = "keep_warm"
+	scheduleActionPull     = "pull"
+)
+
+// scheduleConfig is read from $OLLAMA_SCHEDULE or ~/.ollama/schedule.json, e.g.
+//
+//	{
+//	  "jobs": [
+//	    {"model": "llama2", "action": "keep_warm", "schedule": "* 9-17 * * 1-5"},
+//	    {"model": "llama2", "action": "pull", "schedule": "0 2 * * *"}
+//	  ]
+//	}
+type scheduleConfig struct {
+	Jobs []*scheduleJob `json:"jobs"`
+}
+
+// scheduleJob runs its action every minute matching its cron schedule
+type scheduleJob struct {
+	Model    string `json:"model"`
+	Action   string `json:"action"`
+	Schedule string `json:"schedule"`
+	Insecure bool   `json:"insecure,omitempty"`
+
+	cron    *cronSchedule
+	running sync.Mutex
+}
+
+func scheduleConfigPath() (string, error) {
+	if path, ok := os.LookupEnv("OLLAMA_SCHEDULE"); ok {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "schedule.json"), nil
+}
+
+// loadScheduleConfig returns nil if no schedule has been configured
+func loadScheduleConfig() (*scheduleConfig, error) {
+	path, err := scheduleConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	bts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config scheduleConfig
+	if err := json.Unmarshal(bts, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, job := range config.Jobs {
+		if job.Model == "" {
+			return nil, fmt.Errorf("%s: job is missing a model", path)
+		}
+
+		switch job.Action {
+		case scheduleActionKeepWarm, scheduleActionPull:
+		default:
+			return nil, fmt.Errorf("%s: unknown action '%s' for model '%s'", path, job.Action, job.Model)
+		}
+
+		job.cron, err = parseCron(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("%s: model '%s': %w", path, job.Model, err)
+		}
+	}
+
+	return &config, nil
+}
+
+// runSchedule checks the schedule at the start of every minute until ctx is done
+func runSchedule(ctx context.Context, workDir string, config *scheduleConfig) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+		}
+
+		for _, job := range config.Jobs {
+			if job.cron.Match(next) {
+				go job.run(ctx, workDir)
+			}
+		}
+	}
+}
+
+func (job *scheduleJob) run(ctx context.Context, workDir string) {
+	// skip this run if the previous one hasn't finished, e.g. a long pull
+	if !job.running.TryLock() {
+		return
+	}
+	defer job.running.Unlock()
+
+	var err error
+	switch job.Action {
+	case scheduleActionKeepWarm:
+		err = keepWarm(ctx, workDir, job.Model)
+	case scheduleActionPull:
+		log.Printf("schedule: pulling %s", job.Model)
+		if err = store.Lock(ctx); err == nil {
+			ctx, release := store.Pins(ctx)
+			err = PullModel(ctx, job.Model, &RegistryOptions{Insecure: job.Insecure}, func(api.ProgressResponse) {})
+			release()
+			store.Unlock()
+		}
+	}
+
+	if err != nil {
+		log.Printf("schedule: %s %s: %v", job.Action, job.Model, err)
+	}
+}
+
+// keepWarm loads the model unless another model is in use
+func keepWarm(ctx context.Context, workDir, name string) error {
+	loaded.mu.Lock()
+	defer loaded.mu.Unlock()
+
+	if loaded.runner != nil && loaded.Model != nil {
+		model, err := GetModel(name)
+		if err != nil {
+			return err
+		}
+
+		if loaded.ModelPath != model.ModelPath {
+			// don't evict a model someone is using
+			return nil
+		}
+	}
+
+	_, err := loadModel(ctx, workDir, name, nil, defaultSessionDuration, nil)
+	return err
+}
+
+// cronSchedule is a standard five field cron expression: minute, hour, day of month, month and day of week
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// restricted day of month and day of week fields match if either matches
+	domStar, dowStar bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule '%s': expected 5 fields", expr)
+	}
+
+	var cron cronSchedule
+	var err error
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&cron.minute, 0, 59},
+		{&cron.hour, 0, 23},
+		{&cron.dom, 1, 31},
+		{&cron.month, 1, 12},
+		{&cron.dow, 0, 7},
+	} {
+		*f.bits, err = parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %w", expr, err)
+		}
+	}
+
+	// 7 is also sunday
+	if cron.dow&(1<<7) != 0 {
+		cron.dow |= 1
+	}
+
+	cron.domStar = fields[2] == "*"
+	cron.dowStar = fields[4] == "*"
+	return &cron, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and steps, e.g. "*/15", "1-5" or "0,30"
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+
+		start, end := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			lo, hi, _ := strings.Cut(rng, "-")
+			var err error
+			if start, err = strconv.Atoi(lo); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", part)
+			}
+			if end, err = strconv.Atoi(hi); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", part)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", part)
+			}
+			start, end = n, n
+			if hasStep {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("value '%s' out of range %d-%d", part, min, max)
+		}
+
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", part)
+			}
+		}
+
+		for i := start; i <= end; i += n {
+			bits |= 1 << i
+		}
+	}
+
+	return bits, nil
+}
+
+func (c *cronSchedule) Match(t time.Time) bool {
+	if c.minute&(1<<t.Minute()) == 0 || c.hour&(1<<t.Hour()) == 0 || c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	// a monday
+	monday := time.Date(2023, time.December, 11, 9, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		expr string
+		time time.Time
+		want bool
+	}{
+		{"* * * * *", monday, true},
+		{"30 9 * * *", monday, true},
+		{"0 9 * * *", monday, false},
+		{"*/15 9-17 * * 1-5", monday, true},
+		{"*/15 9-17 * * 1-5", monday.AddDate(0, 0, 5), false},
+		{"* 10-17 * * 1-5", monday, false},
+		{"0,30 * * * *", monday, true},
+		{"* * * * 0", monday.AddDate(0, 0, 6), true},
+		{"* * * * 7", monday.AddDate(0, 0, 6), true},
+		{"* * * 1 *", monday, false},
+		// restricted day of month and day of week match if either does
+		{"* * 1 * 1", monday, true},
+		{"* * 11 * 0", monday, true},
+		{"* * 1 * 0", monday, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cron, err := parseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cron.Match(tt.time))
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
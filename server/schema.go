@@ -0,0 +1,394 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// schemaRules are the GBNF rules for JSON values which schemas are compiled to, as in the grammar of the json
+// format
+const schemaRules = `value ::= object | array | string | number | ("true" | "false" | "null") ws
+object ::= "{" ws ( string ":" ws value ("," ws string ":" ws value)* )? "}" ws
+array ::= "[" ws ( value ("," ws value)* )? "]" ws
+string ::= "\"" ( [^"\\] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F]) )* "\"" ws
+number ::= ("-"? ([0-9] | [1-9] [0-9]*)) ("." [0-9]+)? ([eE] [-+]? [0-9]+)? ws
+integer ::= ("-"? ([0-9] | [1-9] [0-9]*)) ws
+boolean ::= ("true" | "false") ws
+null ::= "null" ws
+ws ::= ([ \t\n] ws)?`
+
+// schemaAnnotations are keywords which describe a schema without constraining it
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true,
+	"examples": true, "format": true, "readOnly": true, "writeOnly": true, "deprecated": true,
+}
+
+// jsonSchema is the part of JSON schema which can be compiled to a grammar
+type jsonSchema struct {
+	Type                 any                    `json:"type"`
+	Properties           schemaProperties       `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []json.RawMessage      `json:"enum"`
+	Const                json.RawMessage        `json:"const"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	Ref                  string                 `json:"$ref"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+
+	// closed is set by additionalProperties: false
+	closed bool
+}
+
+func (s *jsonSchema) UnmarshalJSON(b []byte) error {
+	switch string(bytes.TrimSpace(b)) {
+	case "true":
+		// any value
+		return nil
+	case "false":
+		return errors.New("schemas which match nothing aren't supported")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	for k := range fields {
+		switch k {
+		case "type", "properties", "required", "additionalProperties", "items", "enum", "const", "anyOf", "oneOf", "$ref", "$defs", "definitions":
+		default:
+			if !schemaAnnotations[k] {
+				return fmt.Errorf("unsupported schema keyword '%s'", k)
+			}
+		}
+	}
+
+	if string(bytes.TrimSpace(fields["additionalProperties"])) == "false" {
+		delete(fields, "additionalProperties")
+		s.closed = true
+	}
+
+	type schema jsonSchema
+	bts, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bts, (*schema)(s))
+}
+
+// schemaProperties are the properties of an object schema in the order they are written, which is the order
+// the model writes them in
+type schemaProperties []schemaProperty
+
+type schemaProperty struct {
+	name   string
+	schema *jsonSchema
+}
+
+func (p *schemaProperties) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return errors.New("properties must be an object")
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		var schema jsonSchema
+		if err := dec.Decode(&schema); err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+
+		*p = append(*p, schemaProperty{name: t.(string), schema: &schema})
+	}
+
+	return nil
+}
+
+// schemaGrammar compiles a JSON schema to a GBNF grammar which only accepts JSON matching it. Objects have
+// their properties in the order of the schema, and oneOf is treated as anyOf.
+func schemaGrammar(b []byte) (string, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return "", fmt.Errorf("invalid schema: %w", err)
+	}
+
+	c := schemaCompiler{root: &schema, refs: make(map[string]string)}
+	root, err := c.compile(&schema)
+	if err != nil {
+		return "", fmt.Errorf("invalid schema: %w", err)
+	}
+
+	rules := append([]string{"root ::= " + root}, c.rules...)
+	return strings.Join(append(rules, schemaRules), "\n"), nil
+}
+
+type schemaCompiler struct {
+	root  *jsonSchema
+	rules []string
+
+	// refs are the rules of the definitions referenced so far, so recursive schemas refer to their own rule
+	refs map[string]string
+}
+
+// jsonLiteral is a GBNF expression for the JSON value v written compactly
+func jsonLiteral(v json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return "", err
+	}
+
+	return gbnfLiteral(buf.String()) + " ws", nil
+}
+
+// compile returns a GBNF expression for the values matching s
+func (c *schemaCompiler) compile(s *jsonSchema) (string, error) {
+	switch {
+	case s.Ref != "":
+		return c.ref(s.Ref)
+	case s.Const != nil:
+		return jsonLiteral(s.Const)
+	case len(s.Enum) > 0:
+		alternatives := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			literal, err := jsonLiteral(v)
+			if err != nil {
+				return "", err
+			}
+
+			alternatives[i] = literal
+		}
+
+		return "(" + strings.Join(alternatives, " | ") + ")", nil
+	case len(s.AnyOf) > 0 || len(s.OneOf) > 0:
+		var alternatives []string
+		for _, sub := range append(s.AnyOf, s.OneOf...) {
+			expr, err := c.compile(sub)
+			if err != nil {
+				return "", err
+			}
+
+			alternatives = append(alternatives, expr)
+		}
+
+		return "(" + strings.Join(alternatives, " | ") + ")", nil
+	}
+
+	var types []string
+	switch t := s.Type.(type) {
+	case nil:
+		switch {
+		case len(s.Properties) > 0 || s.AdditionalProperties != nil:
+			types = []string{"object"}
+		case s.Items != nil:
+			types = []string{"array"}
+		default:
+			return "value", nil
+		}
+	case string:
+		types = []string{t}
+	case []any:
+		for _, e := range t {
+			name, ok := e.(string)
+			if !ok {
+				return "", errors.New("type must be a string or a list of strings")
+			}
+
+			types = append(types, name)
+		}
+	default:
+		return "", errors.New("type must be a string or a list of strings")
+	}
+
+	alternatives := make([]string, len(types))
+	for i, t := range types {
+		var expr string
+		var err error
+		switch t {
+		case "string", "number", "integer", "boolean", "null":
+			expr = t
+		case "object":
+			expr, err = c.object(s)
+		case "array":
+			expr, err = c.array(s)
+		default:
+			err = fmt.Errorf("unknown type '%s'", t)
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		alternatives[i] = expr
+	}
+
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+
+	return "(" + strings.Join(alternatives, " | ") + ")", nil
+}
+
+// ref returns the rule of a definition, such as #/$defs/address
+func (c *schemaCompiler) ref(ref string) (string, error) {
+	if rule, ok := c.refs[ref]; ok {
+		return rule, nil
+	}
+
+	var defs map[string]*jsonSchema
+	var name string
+	switch {
+	case strings.HasPrefix(ref, "#/$defs/"):
+		defs, name = c.root.Defs, strings.TrimPrefix(ref, "#/$defs/")
+	case strings.HasPrefix(ref, "#/definitions/"):
+		defs, name = c.root.Definitions, strings.TrimPrefix(ref, "#/definitions/")
+	case ref == "#":
+		return c.define(ref, c.root)
+	}
+
+	def, ok := defs[name]
+	if !ok {
+		return "", fmt.Errorf("unknown $ref '%s'", ref)
+	}
+
+	return c.define(ref, def)
+}
+
+func (c *schemaCompiler) define(ref string, s *jsonSchema) (string, error) {
+	rule := fmt.Sprintf("ref%d", len(c.refs))
+	c.refs[ref] = rule
+
+	expr, err := c.compile(s)
+	if err != nil {
+		return "", err
+	}
+
+	c.rules = append(c.rules, rule+" ::= "+expr)
+	return rule, nil
+}
+
+func (c *schemaCompiler) object(s *jsonSchema) (string, error) {
+	if len(s.Properties) == 0 {
+		if s.closed {
+			return `"{" ws "}" ws`, nil
+		}
+
+		if s.AdditionalProperties == nil {
+			return "object", nil
+		}
+
+		value, err := c.compile(s.AdditionalProperties)
+		if err != nil {
+			return "", err
+		}
+
+		return `"{" ws ( string ":" ws ` + value + ` ("," ws string ":" ws ` + value + `)* )? "}" ws`, nil
+	}
+
+	required := make(map[string]bool)
+	for _, name := range s.Required {
+		required[name] = true
+	}
+
+	// required properties missing from properties may have any value
+	properties := append(schemaProperties(nil), s.Properties...)
+	var missing []string
+	for name := range required {
+		if !properties.has(name) {
+			missing = append(missing, name)
+		}
+	}
+
+	sort.Strings(missing)
+	for _, name := range missing {
+		properties = append(properties, schemaProperty{name: name, schema: &jsonSchema{}})
+	}
+
+	members := make([]string, len(properties))
+	for i, p := range properties {
+		value, err := c.compile(p.schema)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", p.name, err)
+		}
+
+		name, err := json.Marshal(p.name)
+		if err != nil {
+			return "", err
+		}
+
+		members[i] = gbnfLiteral(string(name)) + ` ws ":" ws ` + value
+	}
+
+	// after(i) is the properties from i on once one has been written, so each is preceded by a comma
+	after := make([]string, len(properties)+1)
+	for i := len(properties) - 1; i >= 0; i-- {
+		member := `"," ws ` + members[i]
+		if !required[properties[i].name] {
+			member = "(" + member + ")?"
+		}
+
+		after[i] = join(member, after[i+1])
+	}
+
+	// first(i) is the properties from i on before any has been written
+	first := make([]string, len(properties)+1)
+	for i := len(properties) - 1; i >= 0; i-- {
+		present := join(members[i], after[i+1])
+		switch {
+		case required[properties[i].name]:
+			first[i] = present
+		case first[i+1] == "":
+			first[i] = "(" + present + ")?"
+		default:
+			first[i] = "(" + present + " | " + first[i+1] + ")"
+		}
+	}
+
+	return join(`"{" ws`, first[0], `"}" ws`), nil
+}
+
+func (p schemaProperties) has(name string) bool {
+	for _, property := range p {
+		if property.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *schemaCompiler) array(s *jsonSchema) (string, error) {
+	if s.Items == nil {
+		return "array", nil
+	}
+
+	item, err := c.compile(s.Items)
+	if err != nil {
+		return "", err
+	}
+
+	return `"[" ws ( ` + item + ` ("," ws ` + item + `)* )? "]" ws`, nil
+}
+
+// join joins the expressions which aren't empty into a sequence
+func join(exprs ...string) string {
+	var seq []string
+	for _, expr := range exprs {
+		if expr != "" {
+			seq = append(seq, expr)
+		}
+	}
+
+	return strings.Join(seq, " ")
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rootRule is the rule a schema is compiled to, without the rules for JSON values
+func rootRule(t *testing.T, schema string) string {
+	t.Helper()
+	grammar, err := schemaGrammar([]byte(schema))
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(grammar, schemaRules))
+	return strings.TrimSuffix(strings.TrimSuffix(grammar, schemaRules), "\n")
+}
+
+func TestSchemaGrammar(t *testing.T) {
+	cases := []struct {
+		schema string
+		root   string
+	}{
+		{`{}`, `root ::= value`},
+		{`true`, `root ::= value`},
+		{`{"type": "string", "description": "a name"}`, `root ::= string`},
+		{`{"type": ["integer", "null"]}`, `root ::= (integer | null)`},
+		{`{"enum": ["red", "green", 1]}`, `root ::= ("\"red\"" ws | "\"green\"" ws | "1" ws)`},
+		{`{"const": {"a": [1, 2]}}`, `root ::= "{\"a\":[1,2]}" ws`},
+		{`{"type": "array", "items": {"type": "number"}}`, `root ::= "[" ws ( number ("," ws number)* )? "]" ws`},
+		{`{"type": "object", "additionalProperties": false}`, `root ::= "{" ws "}" ws`},
+		{`{"type": "object", "additionalProperties": {"type": "boolean"}}`, `root ::= "{" ws ( string ":" ws boolean ("," ws string ":" ws boolean)* )? "}" ws`},
+		{`{"anyOf": [{"type": "string"}, {"type": "array"}]}`, `root ::= (string | array)`},
+		{
+			`{"type": "object", "properties": {"name": {"type": "string"}, "age": {"type": "integer"}}, "required": ["name", "age"]}`,
+			`root ::= "{" ws "\"name\"" ws ":" ws string "," ws "\"age\"" ws ":" ws integer "}" ws`,
+		},
+		{
+			`{"type": "object", "properties": {"name": {"type": "string"}, "age": {"type": "integer"}}, "required": ["age"]}`,
+			`root ::= "{" ws ("\"name\"" ws ":" ws string "," ws "\"age\"" ws ":" ws integer | "\"age\"" ws ":" ws integer) "}" ws`,
+		},
+		{
+			`{"type": "object", "properties": {"name": {"type": "string"}, "age": {"type": "integer"}}}`,
+			`root ::= "{" ws ("\"name\"" ws ":" ws string ("," ws "\"age\"" ws ":" ws integer)? | ("\"age\"" ws ":" ws integer)?) "}" ws`,
+		},
+		{
+			`{"$ref": "#/$defs/node", "$defs": {"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}}}}}`,
+			"root ::= ref0\nref0 ::= \"{\" ws (\"\\\"children\\\"\" ws \":\" ws \"[\" ws ( ref0 (\",\" ws ref0)* )? \"]\" ws)? \"}\" ws",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.schema, func(t *testing.T) {
+			assert.Equal(t, tt.root, rootRule(t, tt.schema))
+		})
+	}
+}
+
+func TestSchemaGrammarPropertyOrder(t *testing.T) {
+	root := rootRule(t, `{"properties": {"z": {}, "a": {}, "m": {}}, "required": ["z", "a", "m"]}`)
+	assert.Less(t, strings.Index(root, `"\"z\""`), strings.Index(root, `"\"a\""`))
+	assert.Less(t, strings.Index(root, `"\"a\""`), strings.Index(root, `"\"m\""`))
+}
+
+func TestSchemaGrammarErrors(t *testing.T) {
+	for schema, message := range map[string]string{
+		`{"type": "object", "patternProperties": {}}`: "unsupported schema keyword 'patternProperties'",
+		`{"type": "date"}`:            "unknown type 'date'",
+		`{"type": 1}`:                 "type must be a string or a list of strings",
+		`{"$ref": "#/$defs/missing"}`: "unknown $ref '#/$defs/missing'",
+		`{"items": false}`:            "schemas which match nothing aren't supported",
+		`[]`:                          "invalid schema",
+	} {
+		_, err := schemaGrammar([]byte(schema))
+		assert.ErrorContains(t, err, message, schema)
+	}
+}
@@ -0,0 +1,461 @@
+package server
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// shareArchiveType is the media type of a shared model, a tar of its manifest.json and blobs/<digest>
+const shareArchiveType = "application/x-tar"
+
+const defaultShareDuration = time.Hour
+
+type share struct {
+	name     string
+	manifest []byte
+	expires  time.Time
+}
+
+// shareStore holds the shares of models, they are lost when the server stops
+type shareStore struct {
+	mu     sync.Mutex
+	shares map[string]*share
+
+	// addrs are the addresses the server listens on and base the prefix it serves under, the share urls are
+	// made from them
+	addrs []net.Addr
+	base  string
+}
+
+var shares = shareStore{shares: make(map[string]*share)}
+
+// add shares a manifest until it expires, the random token in its url is what authenticates a download
+func (s *shareStore) add(name string, manifest []byte, d time.Duration) (string, *share, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	token := hex.EncodeToString(b)
+	sh := &share{name: name, manifest: manifest, expires: time.Now().Add(d)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for t, other := range s.shares {
+		if time.Now().After(other.expires) {
+			delete(s.shares, t)
+		}
+	}
+
+	s.shares[token] = sh
+	return token, sh, nil
+}
+
+// get returns nil if there is no such share or it has expired
+func (s *shareStore) get(token string) *share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh, ok := s.shares[token]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(sh.expires) {
+		delete(s.shares, token)
+		return nil
+	}
+
+	return sh
+}
+
+// claim takes the share for a download so that no other download can, it returns nil if there is no such
+// share or it has expired
+func (s *shareStore) claim(token string) *share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh, ok := s.shares[token]
+	if !ok {
+		return nil
+	}
+
+	delete(s.shares, token)
+	if time.Now().After(sh.expires) {
+		return nil
+	}
+
+	return sh
+}
+
+// release gives back a share whose download failed, so that it can be downloaded again until it expires
+func (s *shareStore) release(token string, sh *share) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shares[token] = sh
+}
+
+// urls are where other machines can download a share, on every address of the machine the server listens on
+// other than loopback ones. host is used when there are none, as when a reverse proxy serves the server.
+func (s *shareStore) urls(token, host string) []string {
+	path := s.base + "/api/shares/" + token
+
+	var hosts []string
+	for _, addr := range s.addrs {
+		tcp, ok := addr.(*net.TCPAddr)
+		if !ok || tcp.IP.IsLoopback() {
+			continue
+		}
+
+		port := fmt.Sprint(tcp.Port)
+		if !tcp.IP.IsUnspecified() {
+			hosts = append(hosts, net.JoinHostPort(tcp.IP.String(), port))
+			continue
+		}
+
+		ifaddrs, err := net.InterfaceAddrs()
+		if err != nil {
+			log.Printf("could not list network addresses: %v", err)
+			continue
+		}
+
+		for _, ifaddr := range ifaddrs {
+			ipnet, ok := ifaddr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() || (ipnet.IP.To4() == nil && tcp.IP.To4() != nil) {
+				continue
+			}
+
+			hosts = append(hosts, net.JoinHostPort(ipnet.IP.String(), port))
+		}
+	}
+
+	if len(hosts) == 0 {
+		hosts = []string{host}
+	}
+
+	urls := make([]string, len(hosts))
+	for i, h := range hosts {
+		urls[i] = "http://" + h + path
+	}
+
+	return urls
+}
+
+// blobArchiveName is the name of a blob in a share archive
+func blobArchiveName(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "-", 1)
+}
+
+// writeShareArchive writes the manifest and then each blob it refers to
+func writeShareArchive(w io.Writer, manifest []byte) error {
+	var m ManifestV2
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return err
+	}
+
+	if m.Config == nil {
+		return errors.New("manifest has no config")
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0o644, Size: int64(len(manifest))}); err != nil {
+		return err
+	}
+
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, layer := range append([]*Layer{m.Config}, m.Layers...) {
+		if seen[layer.Digest] {
+			continue
+		}
+
+		seen[layer.Digest] = true
+		if err := writeArchiveBlob(tw, layer.Digest); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeArchiveBlob(tw *tar.Writer, digest string) error {
+	fp, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{Name: blobArchiveName(digest), Mode: 0o644, Size: fi.Size()}); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// archiveProgress reports the progress of a blob read from an archive at most every 100ms
+type archiveProgress struct {
+	digest    string
+	total     int64
+	completed int64
+	reported  time.Time
+	fn        func(api.ProgressResponse)
+}
+
+func (p *archiveProgress) Write(b []byte) (int, error) {
+	p.completed += int64(len(b))
+	if p.completed == p.total || time.Since(p.reported) > 100*time.Millisecond {
+		p.report()
+	}
+
+	return len(b), nil
+}
+
+func (p *archiveProgress) report() {
+	p.reported = time.Now()
+	p.fn(api.ProgressResponse{
+		Status:    fmt.Sprintf("pulling %s", p.digest[7:19]),
+		Digest:    p.digest,
+		Total:     p.total,
+		Completed: p.completed,
+	})
+}
+
+// importShareArchive stores the blobs of a share archive, verifying each against its digest, and then its
+// manifest as the model name
+func importShareArchive(ctx context.Context, name string, r io.Reader, fn func(api.ProgressResponse)) error {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != "manifest.json" {
+		return errors.New("not a model archive")
+	}
+
+	manifest, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var m ManifestV2
+	if err := json.Unmarshal(manifest, &m); err != nil || m.Config == nil {
+		return errors.New("not a model archive")
+	}
+
+	want := make(map[string]bool)
+	for _, layer := range append([]*Layer{m.Config}, m.Layers...) {
+		if digest, err := parseSHA256(strings.TrimPrefix(layer.Digest, "sha256:")); err != nil || digest != layer.Digest {
+			return fmt.Errorf("invalid digest '%s' in model archive", layer.Digest)
+		}
+
+		want[layer.Digest] = true
+		store.Pin(ctx, layer.Digest)
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		digest := strings.Replace(strings.TrimPrefix(hdr.Name, "blobs/"), "-", ":", 1)
+		if !want[digest] || hdr.Name != blobArchiveName(digest) {
+			return fmt.Errorf("unexpected file '%s' in model archive", hdr.Name)
+		}
+
+		delete(want, digest)
+		if err := importArchiveBlob(digest, hdr.Size, tr, fn); err != nil {
+			return err
+		}
+	}
+
+	// blobs the archive left out must already be here
+	for digest := range want {
+		fp, err := GetBlobsPath(digest)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(fp); err != nil {
+			return fmt.Errorf("model archive is missing %s", digest)
+		}
+	}
+
+	fn(api.ProgressResponse{Status: "writing manifest"})
+	fp, err := ParseModelPath(name).GetManifestPath()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(fp, manifest); err != nil {
+		return err
+	}
+
+	fn(api.ProgressResponse{Status: "success"})
+	return nil
+}
+
+func importArchiveBlob(digest string, size int64, r io.Reader, fn func(api.ProgressResponse)) error {
+	p := &archiveProgress{digest: digest, total: size, fn: fn}
+
+	fp, err := GetBlobsPath(digest)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(fp); err == nil {
+		p.completed = size
+		p.report()
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(fp), filepath.Base(fp)+"-import-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h, p), r); err != nil {
+		return err
+	}
+
+	if got := fmt.Sprintf("sha256:%x", h.Sum(nil)); got != digest {
+		return fmt.Errorf("%w: want %s, got %s", errDigestMismatch, digest, got)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), fp)
+}
+
+func CreateShareHandler(c *gin.Context) {
+	var req api.ShareRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	d := defaultShareDuration
+	if req.Duration != "" {
+		d, err = time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid duration '%s'", req.Duration)})
+			return
+		}
+	}
+
+	mp := ParseModelPath(req.Name)
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	manifest, err := os.ReadFile(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Name)})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, sh, err := shares.add(mp.GetShortTagname(), manifest, d)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ShareResponse{
+		Name:      sh.name,
+		URLs:      shares.urls(token, c.Request.Host),
+		ExpiresAt: sh.expires,
+	})
+}
+
+// ShareArchiveHandler sends the archive of a shared model. A download claims the share before anything is
+// written, so a share is downloaded once, and gives it back if it fails.
+func ShareArchiveHandler(c *gin.Context) {
+	token := c.Param("token")
+
+	var sh *share
+	if c.Request.Method == http.MethodHead {
+		sh = shares.get(token)
+	} else {
+		sh = shares.claim(token)
+	}
+
+	if sh == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "share not found or expired"})
+		return
+	}
+
+	c.Header("Content-Type", shareArchiveType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.NewReplacer("/", "-", ":", "-").Replace(sh.name)+".tar"))
+	c.Header("Ollama-Model", sh.name)
+
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Status(http.StatusOK)
+	if err := writeShareArchive(c.Writer, sh.manifest); err != nil {
+		log.Printf("share of %s failed: %v", sh.name, err)
+		shares.release(token, sh)
+		return
+	}
+
+	log.Printf("share of %s downloaded by %s", sh.name, c.ClientIP())
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+func TestShare(t *testing.T) {
+	src := t.TempDir()
+	t.Setenv("OLLAMA_MODELS", src)
+
+	// the smallest GGUF file, version 3 with no tensors or metadata
+	gguf := filepath.Join(t.TempDir(), "model.gguf")
+	require.NoError(t, os.WriteFile(gguf, []byte{'G', 'G', 'U', 'F', 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 0o644))
+
+	fn := func(api.ProgressResponse) {}
+	commands, err := parser.Parse(strings.NewReader("FROM " + gguf + "\nTEMPLATE [INST] {{ .Prompt }} [/INST]"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "shared", "", commands, fn))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+
+	bts, err := json.Marshal(api.ShareRequest{Name: "shared", Duration: "1m"})
+	require.NoError(t, err)
+
+	resp, err := http.Post(srv.URL+"/api/shares", "application/json", bytes.NewReader(bts))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var share api.ShareResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&share))
+	assert.Equal(t, "shared:latest", share.Name)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), share.ExpiresAt, 5*time.Second)
+	require.Len(t, share.URLs, 1)
+
+	resp, err = http.Get(share.URLs[0])
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	archive, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	// a share can only be downloaded once
+	resp, err = http.Get(share.URLs[0])
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the model is pulled into another store under its own name, this server stands in for the other one
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", shareArchiveType)
+		w.Header().Set("Ollama-Model", "shared:latest")
+		w.Write(archive)
+	}))
+	t.Cleanup(other.Close)
+
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+	require.NoError(t, pullURL(context.TODO(), "", other.URL+"/api/shares/token", fn))
+
+	model, err := GetModel("shared")
+	require.NoError(t, err)
+	assert.Equal(t, "[INST] {{ .Prompt }} [/INST]", model.Template)
+
+	token, _, err := shares.add("shared:latest", []byte("{}"), -time.Second)
+	require.NoError(t, err)
+	assert.Nil(t, shares.get(token))
+	assert.Nil(t, shares.claim(token))
+}
+
+func TestShareDownloadedOnce(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	fn := func(api.ProgressResponse) {}
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "shared", "", commands, fn))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+
+	manifest, _, err := GetManifest(ParseModelPath("shared"))
+	require.NoError(t, err)
+
+	bts, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	token, _, err := shares.add("shared:latest", bts, time.Minute)
+	require.NoError(t, err)
+
+	// checking a share doesn't claim it
+	resp, err := http.Head(srv.URL + "/api/shares/" + token)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// of the downloads made at once, only one gets the archive
+	const downloads = 8
+	statuses := make(chan int, downloads)
+	var wg sync.WaitGroup
+	for i := 0; i < downloads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := http.Get(srv.URL + "/api/shares/" + token)
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			defer resp.Body.Close()
+
+			io.Copy(io.Discard, resp.Body)
+			statuses <- resp.StatusCode
+		}()
+	}
+
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+
+	assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusNotFound: downloads - 1}, counts)
+
+	// a download which fails gives the share back
+	token, _, err = shares.add("shared:latest", []byte(`{"schemaVersion":2}`), time.Minute)
+	require.NoError(t, err)
+
+	resp, err = http.Get(srv.URL + "/api/shares/" + token)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.NotNil(t, shares.get(token))
+}
+
+func TestImportShareArchiveDigest(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	// digests name the files blobs are written to, so ones which aren't sha256 digests are refused
+	manifest := []byte(`{"schemaVersion":2,"config":{"digest":"sha256:../../../etc/passwd"}}`)
+
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0o644, Size: int64(len(manifest))}))
+	_, err := tw.Write(manifest)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	err = importShareArchive(context.TODO(), "evil", &b, func(api.ProgressResponse) {})
+	assert.ErrorContains(t, err, "invalid digest")
+}
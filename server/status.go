@@ -0,0 +1,151 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+)
+
+// runningModel is a copy of what is loaded so the status endpoints don't have to wait for loaded.mu,
+// which is held for the whole of every request using the model
+type runningModel struct {
+	mu    sync.Mutex
+	model *api.ProcessModel
+}
+
+var running runningModel
+
+func (r *runningModel) Set(model *api.ProcessModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.model = model
+}
+
+func (r *runningModel) SetExpiry(expiresAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.model != nil {
+		r.model.ExpiresAt = expiresAt
+	}
+}
+
+func (r *runningModel) List() []api.ProcessModel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	models := []api.ProcessModel{}
+	if r.model != nil {
+		models = append(models, *r.model)
+	}
+
+	return models
+}
+
+// tokenSample is the number of tokens a response generated and when it finished
+type tokenSample struct {
+	at     time.Time
+	tokens int
+}
+
+// throughputWindow is how far back generated tokens count towards the throughput
+const throughputWindow = time.Minute
+
+// requestStats counts the requests that use the loaded model and the tokens they generate
+type requestStats struct {
+	mu       sync.Mutex
+	inflight int
+	total    int64
+	samples  []tokenSample
+}
+
+var requests requestStats
+
+// Track counts the request while the rest of its handlers run
+func (s *requestStats) Track(c *gin.Context) {
+	s.mu.Lock()
+	s.inflight++
+	s.total++
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inflight--
+		s.mu.Unlock()
+	}()
+
+	c.Next()
+}
+
+// Record adds the tokens generated by a finished response
+func (s *requestStats) Record(tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(time.Now())
+	s.samples = append(s.samples, tokenSample{at: time.Now(), tokens: tokens})
+}
+
+// prune drops samples older than the throughput window, it is up to the caller to lock s.mu
+func (s *requestStats) prune(now time.Time) {
+	i := 0
+	for i < len(s.samples) && now.Sub(s.samples[i].at) > throughputWindow {
+		i++
+	}
+
+	s.samples = s.samples[i:]
+}
+
+// Metrics fills in the request counts and throughput
+func (s *requestStats) Metrics(m *api.MetricsResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// requests take turns holding loaded.mu so only one of them is ever active
+	if s.inflight > 0 {
+		m.ActiveRequests = 1
+		m.QueuedRequests = s.inflight - 1
+	}
+
+	m.TotalRequests = s.total
+
+	s.prune(time.Now())
+
+	var tokens int
+	for _, sample := range s.samples {
+		tokens += sample.tokens
+	}
+
+	m.TokensPerSecond = float64(tokens) / throughputWindow.Seconds()
+}
+
+func ListRunningHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, api.ProcessResponse{Models: running.List()})
+}
+
+func MetricsHandler(c *gin.Context) {
+	m := api.MetricsResponse{NumCPU: runtime.NumCPU()}
+	requests.Metrics(&m)
+	streams.Metrics(&m)
+
+	var err error
+	m.CPULoad, m.MemoryTotal, m.MemoryAvailable, err = systemUsage()
+	if err != nil {
+		log.Printf("could not read system usage: %v", err)
+	}
+
+	// machines without NVIDIA GPUs report none
+	if gpus, err := llm.GPUUsage(); err == nil {
+		m.GPUs = gpus
+	}
+
+	c.JSON(http.StatusOK, m)
+}
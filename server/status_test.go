@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestRequestStats(t *testing.T) {
+	var s requestStats
+
+	var m api.MetricsResponse
+	s.Metrics(&m)
+	assert.Equal(t, 0, m.ActiveRequests)
+	assert.Equal(t, 0, m.QueuedRequests)
+
+	s.inflight = 3
+	s.total = 10
+	s.samples = []tokenSample{
+		{at: time.Now().Add(-2 * time.Minute), tokens: 600},
+		{at: time.Now(), tokens: 120},
+		{at: time.Now(), tokens: 60},
+	}
+
+	s.Metrics(&m)
+	assert.Equal(t, 1, m.ActiveRequests)
+	assert.Equal(t, 2, m.QueuedRequests)
+	assert.Equal(t, int64(10), m.TotalRequests)
+	assert.Equal(t, 3.0, m.TokensPerSecond)
+	assert.Len(t, s.samples, 2)
+}
+
+func TestRequestStatsTrack(t *testing.T) {
+	var s requestStats
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", s.Track, func(c *gin.Context) {
+		var m api.MetricsResponse
+		s.Metrics(&m)
+		assert.Equal(t, 1, m.ActiveRequests)
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var m api.MetricsResponse
+	s.Metrics(&m)
+	assert.Equal(t, 0, m.ActiveRequests)
+	assert.Equal(t, int64(1), m.TotalRequests)
+}
+
+func TestRunningModel(t *testing.T) {
+	var r runningModel
+	assert.Empty(t, r.List())
+
+	expiresAt := time.Now().Add(time.Minute)
+	r.Set(&api.ProcessModel{Name: "llama2:latest"})
+	r.SetExpiry(expiresAt)
+	assert.Equal(t, []api.ProcessModel{{Name: "llama2:latest", ExpiresAt: expiresAt}}, r.List())
+
+	r.Set(nil)
+	r.SetExpiry(expiresAt)
+	assert.Empty(t, r.List())
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+const (
+	streamOverflowPause   = "pause"
+	streamOverflowSummary = "summary"
+
+	// defaultStreamBuffer is how many responses a stream holds for a client which reads slower than they
+	// are generated
+	defaultStreamBuffer = 64
+
+	// defaultStreamHeartbeat is how long a stream goes without a response before a keepalive is sent, well
+	// under the 60 second idle timeout common to proxies
+	defaultStreamHeartbeat = 10 * time.Second
+)
+
+// streamLimits bounds the responses each stream holds for its client, and what happens once it is full
+type streamLimits struct {
+	size int
+
+	// summarize merges responses waiting for the client instead of pausing generation
+	summarize bool
+
+	// heartbeat is how long a stream waits for a response before sending a keepalive, 0 sends none
+	heartbeat time.Duration
+}
+
+var streaming = streamLimits{size: defaultStreamBuffer, heartbeat: defaultStreamHeartbeat}
+
+// loadStreamLimits reads the buffer size in $OLLAMA_STREAM_BUFFER, the keepalive interval in
+// $OLLAMA_STREAM_HEARTBEAT and the policy in $OLLAMA_STREAM_OVERFLOW:
+//   - "pause", the default, pauses generation until the client catches up
+//   - "summary" merges the text of responses waiting for the client, so it gets one response with all of it
+func loadStreamLimits() (streamLimits, error) {
+	limits := streamLimits{size: defaultStreamBuffer, heartbeat: defaultStreamHeartbeat}
+	if s := os.Getenv("OLLAMA_STREAM_BUFFER"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return limits, fmt.Errorf("OLLAMA_STREAM_BUFFER: invalid size '%s', expected a positive number", s)
+		}
+
+		limits.size = n
+	}
+
+	if s := os.Getenv("OLLAMA_STREAM_HEARTBEAT"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return limits, fmt.Errorf("OLLAMA_STREAM_HEARTBEAT: invalid interval '%s', expected a duration such as 10s, or 0 to disable", s)
+		}
+
+		limits.heartbeat = d
+	}
+
+	switch policy := os.Getenv("OLLAMA_STREAM_OVERFLOW"); policy {
+	case "", streamOverflowPause:
+	case streamOverflowSummary:
+		limits.summarize = true
+	default:
+		return limits, fmt.Errorf("OLLAMA_STREAM_OVERFLOW: unknown policy '%s', expected %q or %q", policy, streamOverflowPause, streamOverflowSummary)
+	}
+
+	return limits, nil
+}
+
+// streamBuffer holds the responses of one stream between the handler producing them and the client
+type streamBuffer struct {
+	limits streamLimits
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []any
+
+	// closed is set once the handler has sent its last response, stopped once the client has gone
+	closed  bool
+	stopped bool
+}
+
+func newStreamBuffer(limits streamLimits) *streamBuffer {
+	b := &streamBuffer{limits: limits}
+	b.cond = sync.NewCond(&b.mu)
+	streams.open()
+	return b
+}
+
+// Push adds a response for the client. When the buffer is full it is merged into the last response waiting if
+// the buffer summarizes and the two can be merged, otherwise Push waits for the client to read one.
+func (b *streamBuffer) Push(val any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	paused := false
+	for len(b.pending) >= b.limits.size && !b.stopped {
+		if b.limits.summarize {
+			if merged, ok := mergeResponses(b.pending[len(b.pending)-1], val); ok {
+				b.pending[len(b.pending)-1] = merged
+				streams.summarized()
+				return
+			}
+		}
+
+		if !paused {
+			paused = true
+			streams.paused()
+		}
+
+		b.cond.Wait()
+	}
+
+	// nobody is left to read it
+	if b.stopped {
+		return
+	}
+
+	b.pending = append(b.pending, val)
+	streams.buffered(1, len(b.pending))
+	b.cond.Broadcast()
+}
+
+// Close marks the end of the responses, the client reads those still waiting first
+func (b *streamBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// Pop waits for the next response, it returns false once there are no more. If timeout is set and passes
+// without a response, Pop returns a nil response so the caller can keep the connection alive.
+func (b *streamBuffer) Pop(timeout time.Duration) (any, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var expired bool
+	if timeout > 0 && len(b.pending) == 0 {
+		timer := time.AfterFunc(timeout, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			expired = true
+			b.cond.Broadcast()
+		})
+		defer timer.Stop()
+	}
+
+	for len(b.pending) == 0 && !b.closed && !b.stopped && !expired {
+		b.cond.Wait()
+	}
+
+	if len(b.pending) == 0 && expired && !b.closed && !b.stopped {
+		return nil, true
+	}
+
+	if len(b.pending) == 0 || b.stopped {
+		return nil, false
+	}
+
+	val := b.pending[0]
+	b.pending[0] = nil
+	b.pending = b.pending[1:]
+	streams.buffered(-1, 0)
+	b.cond.Broadcast()
+	return val, true
+}
+
+// Stop drops the responses waiting once the client has gone, later pushes are dropped too so the handler
+// doesn't wait for a client which won't read them
+func (b *streamBuffer) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopped {
+		return
+	}
+
+	b.stopped = true
+	streams.close(len(b.pending))
+	b.pending = nil
+	b.cond.Broadcast()
+}
+
+// mergeResponses folds the text of next into prev when neither of them is a final response, it reports
+// whether they could be merged. Progress of the same step keeps the latest.
+func mergeResponses(prev, next any) (any, bool) {
+	switch p := prev.(type) {
+	case api.GenerateResponse:
+		n, ok := next.(api.GenerateResponse)
+		if !ok || p.Done || n.Done || p.Load != nil || n.Load != nil {
+			return nil, false
+		}
+
+		p.CreatedAt = n.CreatedAt
+		p.Response += n.Response
+		p.Thinking += n.Thinking
+		return p, true
+	case api.ChatResponse:
+		n, ok := next.(api.ChatResponse)
+		if !ok || p.Done || n.Done || p.Message == nil || n.Message == nil || p.Message.Role != n.Message.Role {
+			return nil, false
+		}
+
+		msg := *p.Message
+		msg.Content += n.Message.Content
+		msg.Thinking += n.Message.Thinking
+
+		p.CreatedAt = n.CreatedAt
+		p.Message = &msg
+		if len(n.Logprobs) > 0 {
+			p.Logprobs = append(append([]api.TokenLogprob(nil), p.Logprobs...), n.Logprobs...)
+		}
+
+		return p, true
+	case api.ProgressResponse:
+		n, ok := next.(api.ProgressResponse)
+		if !ok || p.Status != n.Status || p.Digest != n.Digest {
+			return nil, false
+		}
+
+		return n, true
+	}
+
+	return nil, false
+}
+
+// streamStats tracks how many responses are waiting for slow clients across all streams
+type streamStats struct {
+	mu      sync.Mutex
+	active  int
+	waiting int
+	peak    int
+	pauses  int64
+	summary int64
+}
+
+var streams streamStats
+
+func (s *streamStats) open() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active++
+}
+
+func (s *streamStats) close(dropped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	s.waiting -= dropped
+}
+
+// buffered adds n to the responses waiting, occupancy is how many the stream holds after adding them
+func (s *streamStats) buffered(n, occupancy int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.waiting += n
+	if occupancy > s.peak {
+		s.peak = occupancy
+	}
+}
+
+func (s *streamStats) paused() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pauses++
+}
+
+func (s *streamStats) summarized() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary++
+}
+
+// Metrics fills in the occupancy of the stream buffers
+func (s *streamStats) Metrics(m *api.MetricsResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	overflow := streamOverflowPause
+	if streaming.summarize {
+		overflow = streamOverflowSummary
+	}
+
+	m.Streams = api.StreamMetrics{
+		Active:     s.active,
+		Buffered:   s.waiting,
+		BufferSize: streaming.size,
+		Overflow:   overflow,
+		Peak:       s.peak,
+		Pauses:     s.pauses,
+		Summarized: s.summary,
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+func TestLoadStreamLimits(t *testing.T) {
+	t.Setenv("OLLAMA_STREAM_BUFFER", "")
+	t.Setenv("OLLAMA_STREAM_OVERFLOW", "")
+	t.Setenv("OLLAMA_STREAM_HEARTBEAT", "")
+
+	limits, err := loadStreamLimits()
+	require.NoError(t, err)
+	assert.Equal(t, streamLimits{size: defaultStreamBuffer, heartbeat: defaultStreamHeartbeat}, limits)
+
+	t.Setenv("OLLAMA_STREAM_BUFFER", "8")
+	t.Setenv("OLLAMA_STREAM_OVERFLOW", "summary")
+	t.Setenv("OLLAMA_STREAM_HEARTBEAT", "0")
+	limits, err = loadStreamLimits()
+	require.NoError(t, err)
+	assert.Equal(t, streamLimits{size: 8, summarize: true}, limits)
+
+	t.Setenv("OLLAMA_STREAM_HEARTBEAT", "30s")
+	limits, err = loadStreamLimits()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, limits.heartbeat)
+
+	t.Setenv("OLLAMA_STREAM_HEARTBEAT", "often")
+	_, err = loadStreamLimits()
+	assert.Error(t, err)
+
+	t.Setenv("OLLAMA_STREAM_HEARTBEAT", "")
+
+	t.Setenv("OLLAMA_STREAM_BUFFER", "0")
+	_, err = loadStreamLimits()
+	assert.Error(t, err)
+
+	t.Setenv("OLLAMA_STREAM_BUFFER", "")
+	t.Setenv("OLLAMA_STREAM_OVERFLOW", "drop")
+	_, err = loadStreamLimits()
+	assert.Error(t, err)
+}
+
+func TestStreamBufferPause(t *testing.T) {
+	buf := newStreamBuffer(streamLimits{size: 2})
+	defer buf.Stop()
+
+	buf.Push(api.GenerateResponse{Response: "a"})
+	buf.Push(api.GenerateResponse{Response: "b"})
+
+	// the buffer is full so the next response waits for the client
+	pushed := make(chan struct{})
+	go func() {
+		buf.Push(api.GenerateResponse{Response: "c"})
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push didn't wait for a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	val, ok := buf.Pop(0)
+	require.True(t, ok)
+	assert.Equal(t, api.GenerateResponse{Response: "a"}, val)
+	<-pushed
+
+	buf.Close()
+
+	var got []string
+	for {
+		val, ok := buf.Pop(0)
+		if !ok {
+			break
+		}
+
+		got = append(got, val.(api.GenerateResponse).Response)
+	}
+
+	assert.Equal(t, []string{"b", "c"}, got)
+}
+
+func TestStreamBufferSummary(t *testing.T) {
+	buf := newStreamBuffer(streamLimits{size: 2, summarize: true})
+	defer buf.Stop()
+
+	buf.Push(api.ChatResponse{Message: &api.Message{Role: "assistant", Content: "The"}})
+	buf.Push(api.ChatResponse{Message: &api.Message{Role: "assistant", Content: " sky"}})
+	buf.Push(api.ChatResponse{Message: &api.Message{Role: "assistant", Content: " is"}})
+	buf.Push(api.ChatResponse{Message: &api.Message{Role: "assistant", Content: " blue"}})
+
+	// the final response is never merged, it waits for the client instead
+	done := make(chan struct{})
+	go func() {
+		buf.Push(api.ChatResponse{Message: &api.Message{Role: "assistant"}, Done: true})
+		buf.Close()
+		close(done)
+	}()
+
+	var got []api.ChatResponse
+	for {
+		val, ok := buf.Pop(0)
+		if !ok {
+			break
+		}
+
+		got = append(got, val.(api.ChatResponse))
+	}
+
+	<-done
+	require.Len(t, got, 3)
+	assert.Equal(t, "The", got[0].Message.Content)
+	assert.Equal(t, " sky is blue", got[1].Message.Content)
+	assert.True(t, got[2].Done)
+}
+
+func TestMergeResponses(t *testing.T) {
+	merged, ok := mergeResponses(api.GenerateResponse{Response: "a", Thinking: "x"}, api.GenerateResponse{Response: "b", Thinking: "y"})
+	require.True(t, ok)
+	assert.Equal(t, api.GenerateResponse{Response: "ab", Thinking: "xy"}, merged)
+
+	_, ok = mergeResponses(api.GenerateResponse{Response: "a"}, api.GenerateResponse{Done: true})
+	assert.False(t, ok)
+
+	merged, ok = mergeResponses(api.ProgressResponse{Status: "pulling", Digest: "sha256:1", Completed: 1}, api.ProgressResponse{Status: "pulling", Digest: "sha256:1", Completed: 5})
+	require.True(t, ok)
+	assert.Equal(t, int64(5), merged.(api.ProgressResponse).Completed)
+
+	_, ok = mergeResponses(api.ProgressResponse{Status: "pulling"}, api.ProgressResponse{Status: "verifying"})
+	assert.False(t, ok)
+
+	_, ok = mergeResponses(api.GenerateResponse{Response: "a"}, map[string]any{"error": "failed"})
+	assert.False(t, ok)
+}
+
+func TestStreamMetrics(t *testing.T) {
+	streams = streamStats{}
+	t.Cleanup(func() { streams = streamStats{} })
+
+	buf := newStreamBuffer(streamLimits{size: 4})
+	buf.Push(api.GenerateResponse{Response: "a"})
+	buf.Push(api.GenerateResponse{Response: "b"})
+	buf.Push(api.GenerateResponse{Response: "c"})
+	_, _ = buf.Pop(0)
+
+	var m api.MetricsResponse
+	streams.Metrics(&m)
+	assert.Equal(t, api.StreamMetrics{Active: 1, Buffered: 2, BufferSize: defaultStreamBuffer, Peak: 3, Overflow: "pause"}, m.Streams)
+
+	// the responses a client leaves behind are dropped
+	buf.Stop()
+	streams.Metrics(&m)
+	assert.Equal(t, 0, m.Streams.Active)
+	assert.Equal(t, 0, m.Streams.Buffered)
+	assert.Equal(t, 3, m.Streams.Peak)
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	limits := streaming
+	streaming.heartbeat = 20 * time.Millisecond
+	t.Cleanup(func() { streaming = limits })
+
+	// the response arrives after several heartbeat intervals, e.g. once a long prompt is evaluated
+	r := gin.New()
+	r.POST("/api/generate", func(c *gin.Context) {
+		ch := make(chan any)
+		go func() {
+			defer close(ch)
+
+			time.Sleep(100 * time.Millisecond)
+			ch <- api.GenerateResponse{Model: "test", Response: "hi", Done: true}
+		}()
+
+		streamResponseWithHeartbeat(c, ch, func() any {
+			return api.GenerateResponse{Model: "test"}
+		})
+	})
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Post(srv.URL+"/api/generate", "application/json", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var got []api.GenerateResponse
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var r api.GenerateResponse
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		got = append(got, r)
+	}
+
+	require.NoError(t, scanner.Err())
+	require.Greater(t, len(got), 1)
+
+	// heartbeats are empty responses ahead of the real one
+	for _, r := range got[:len(got)-1] {
+		assert.Equal(t, api.GenerateResponse{Model: "test"}, r)
+	}
+
+	assert.Equal(t, "hi", got[len(got)-1].Response)
+	assert.True(t, got[len(got)-1].Done)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemUsage returns the one minute load average and the total and available memory in bytes
+func systemUsage() (load float64, total, available uint64, err error) {
+	bts, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	fields := strings.Fields(string(bts))
+	if len(fields) == 0 {
+		return 0, 0, 0, fmt.Errorf("unexpected /proc/loadavg: %q", bts)
+	}
+
+	load, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer f.Close()
+
+	// lines look like "MemTotal:       16318916 kB"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+
+	return load, total, available, scanner.Err()
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package server
+
+// systemUsage is only implemented on Linux, elsewhere the load and memory are reported as 0
+func systemUsage() (load float64, total, available uint64, err error) {
+	return 0, 0, 0, nil
+}
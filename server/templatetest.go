@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+// A template test corpus is a directory with a template, in a file called template, and its cases: the
+// messages of a conversation in NAME.json and the prompt the template should render for them in NAME.golden.
+// server/testdata/templates has a corpus for the template of each model family.
+
+// TemplateCase is a conversation from a template test corpus
+type TemplateCase struct {
+	Name     string
+	Messages []api.Message
+
+	// Want is the prompt the conversation should render as, it is empty if the case has no golden file yet
+	Want string
+}
+
+// TemplateResult is the prompt a template rendered for a case, or the error rendering it
+type TemplateResult struct {
+	Case TemplateCase
+	Got  string
+	Err  error
+}
+
+func (r TemplateResult) Passed() bool {
+	return r.Err == nil && r.Got == r.Case.Want
+}
+
+// LoadTemplateCorpus reads the template and cases of the corpus in dir. The template is empty if dir has no
+// template file, so the cases can be run against a model's template instead.
+func LoadTemplateCorpus(dir string) (string, []TemplateCase, error) {
+	tmpl, err := os.ReadFile(filepath.Join(dir, "template"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(files) == 0 {
+		return "", nil, fmt.Errorf("no template test cases in %s", dir)
+	}
+
+	sort.Strings(files)
+
+	var cases []TemplateCase
+	for _, file := range files {
+		bts, err := os.ReadFile(file)
+		if err != nil {
+			return "", nil, err
+		}
+
+		tc := TemplateCase{Name: strings.TrimSuffix(filepath.Base(file), ".json")}
+		if err := json.Unmarshal(bts, &tc.Messages); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		golden, err := os.ReadFile(strings.TrimSuffix(file, ".json") + ".golden")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+
+		tc.Want = string(golden)
+		cases = append(cases, tc)
+	}
+
+	return string(tmpl), cases, nil
+}
+
+// RunTemplateCorpus renders the prompt of each case with the template and default system message, the
+// same way chat requests are rendered
+func RunTemplateCorpus(tmpl, system string, cases []TemplateCase) []TemplateResult {
+	m := Model{Template: tmpl, System: system}
+
+	results := make([]TemplateResult, len(cases))
+	for i, tc := range cases {
+		results[i].Case = tc
+		results[i].Got, _, results[i].Err = m.ChatPrompt(tc.Messages)
+	}
+
+	return results
+}
+
+// UpdateTemplateGolden writes the prompt rendered for the case to its golden file in dir
+func UpdateTemplateGolden(dir string, r TemplateResult) error {
+	if r.Err != nil {
+		return r.Err
+	}
+
+	return os.WriteFile(filepath.Join(dir, r.Case.Name+".golden"), []byte(r.Got), 0o644)
+}
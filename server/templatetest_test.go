@@ -0,0 +1,69 @@
+package server
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the template test corpora")
+
+// TestTemplateCorpus renders the cases in testdata/templates with the template of each model family. After
+// an intended change to how prompts are rendered, update the golden files with go test ./server -update
+// and review the differences.
+func TestTemplateCorpus(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "templates", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			tmpl, cases, err := LoadTemplateCorpus(dir)
+			require.NoError(t, err)
+			require.NotEmpty(t, tmpl, "no template in %s", dir)
+
+			for _, r := range RunTemplateCorpus(tmpl, "", cases) {
+				t.Run(r.Case.Name, func(t *testing.T) {
+					require.NoError(t, r.Err)
+					if *updateGolden {
+						require.NoError(t, UpdateTemplateGolden(dir, r))
+						return
+					}
+
+					assert.Equal(t, r.Case.Want, r.Got)
+				})
+			}
+		})
+	}
+}
+
+func TestLoadTemplateCorpus(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.json"), []byte(`[{"role": "user", "content": "hello"}]`), 0o644))
+
+	// a corpus without a template or golden files can still be run against a model's template
+	tmpl, cases, err := LoadTemplateCorpus(dir)
+	require.NoError(t, err)
+	assert.Empty(t, tmpl)
+	assert.Equal(t, []TemplateCase{{Name: "hello", Messages: []api.Message{{Role: "user", Content: "hello"}}}}, cases)
+
+	results := RunTemplateCorpus("{{ .System }}: {{ .Prompt }}", "be brief", cases)
+	require.Len(t, results, 1)
+	assert.Equal(t, "be brief: hello", results[0].Got)
+	assert.False(t, results[0].Passed())
+
+	require.NoError(t, UpdateTemplateGolden(dir, results[0]))
+	_, cases, err = LoadTemplateCorpus(dir)
+	require.NoError(t, err)
+	assert.True(t, RunTemplateCorpus("{{ .System }}: {{ .Prompt }}", "be brief", cases)[0].Passed())
+
+	_, _, err = LoadTemplateCorpus(t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"strings"
+)
+
+const (
+	defaultThinkingOpenTag  = "<think>"
+	defaultThinkingCloseTag = "</think>"
+)
+
+type thinkingState int
+
+const (
+	thinkingStateStart thinkingState = iota
+	thinkingStateThinking
+	thinkingStateDone
+)
+
+// thinkingParser splits streamed model output into the reasoning wrapped in the
+// opening and closing tags and the content which follows it. Tags may be split
+// across chunks so partial tags are held back until they can be resolved.
+type thinkingParser struct {
+	openTag  string
+	closeTag string
+
+	state thinkingState
+	buf   strings.Builder
+}
+
+func newThinkingParser() *thinkingParser {
+	return &thinkingParser{
+		openTag:  defaultThinkingOpenTag,
+		closeTag: defaultThinkingCloseTag,
+	}
+}
+
+// Add consumes the next chunk of output and returns the thinking and content which can be emitted so far
+func (p *thinkingParser) Add(s string) (thinking, content string) {
+	p.buf.WriteString(s)
+	buf := p.buf.String()
+
+	for {
+		switch p.state {
+		case thinkingStateStart:
+			trimmed := strings.TrimLeft(buf, " \t\r\n")
+			switch {
+			case strings.HasPrefix(trimmed, p.openTag):
+				buf = trimmed[len(p.openTag):]
+				p.state = thinkingStateThinking
+				continue
+			case strings.HasPrefix(p.openTag, trimmed):
+				// not enough output to tell if this is an opening tag
+				p.reset(buf)
+				return "", ""
+			default:
+				p.state = thinkingStateDone
+				continue
+			}
+		case thinkingStateThinking:
+			if before, after, found := strings.Cut(buf, p.closeTag); found {
+				p.state = thinkingStateDone
+				p.reset("")
+				return thinking + before, strings.TrimLeft(after, " \t\r\n")
+			}
+
+			// hold back anything which could be the start of the closing tag
+			n := partialSuffix(buf, p.closeTag)
+			p.reset(buf[len(buf)-n:])
+			return thinking + buf[:len(buf)-n], ""
+		default:
+			p.reset("")
+			return thinking, content + buf
+		}
+	}
+}
+
+// Flush returns anything still buffered once the output has ended
+func (p *thinkingParser) Flush() (thinking, content string) {
+	buf := p.buf.String()
+	p.reset("")
+
+	if p.state == thinkingStateThinking {
+		return buf, ""
+	}
+
+	return "", buf
+}
+
+func (p *thinkingParser) reset(s string) {
+	p.buf.Reset()
+	p.buf.WriteString(s)
+}
+
+// partialSuffix returns the length of the longest suffix of s which is a prefix of tag
+func partialSuffix(s, tag string) int {
+	n := len(tag) - 1
+	if len(s) < n {
+		n = len(s)
+	}
+
+	for ; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+
+	return 0
+}
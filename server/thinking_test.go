@@ -0,0 +1,65 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThinkingParser(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunks       []string
+		wantThinking string
+		wantContent  string
+	}{
+		{
+			name:         "no thinking",
+			chunks:       []string{"Hello", " world"},
+			wantContent:  "Hello world",
+			wantThinking: "",
+		},
+		{
+			name:         "single chunk",
+			chunks:       []string{"<think>let me see</think>\n\nThe answer is 4."},
+			wantThinking: "let me see",
+			wantContent:  "The answer is 4.",
+		},
+		{
+			name:         "tags split across chunks",
+			chunks:       []string{"  <th", "ink>2 + 2", " is 4</th", "in", "k>", "4"},
+			wantThinking: "2 + 2 is 4",
+			wantContent:  "4",
+		},
+		{
+			name:         "unterminated thinking",
+			chunks:       []string{"<think>", "still going <"},
+			wantThinking: "still going <",
+		},
+		{
+			name:        "tag not at start",
+			chunks:      []string{"A", "<think>B</think>"},
+			wantContent: "A<think>B</think>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newThinkingParser()
+
+			var thinking, content string
+			for _, chunk := range tt.chunks {
+				th, c := p.Add(chunk)
+				thinking += th
+				content += c
+			}
+
+			th, c := p.Flush()
+			thinking += th
+			content += c
+
+			assert.Equal(t, tt.wantThinking, thinking)
+			assert.Equal(t, tt.wantContent, content)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/llm"
+	"github.com/jmorganca/ollama/tokenizer"
+)
+
+// tokenizers are the tokenizers read from models, by the path of their weights, which are never changed
+var tokenizers = struct {
+	mu sync.Mutex
+	m  map[string]tokenizer.Tokenizer
+}{m: make(map[string]tokenizer.Tokenizer)}
+
+// modelTokenizer returns the tokenizer of the model name, read from its weights so the model isn't loaded
+func modelTokenizer(name string) (tokenizer.Tokenizer, error) {
+	model, err := GetModel(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizers.mu.Lock()
+	defer tokenizers.mu.Unlock()
+
+	if t, ok := tokenizers.m[model.ModelPath]; ok {
+		return t, nil
+	}
+
+	t, err := llm.LoadTokenizer(model.ModelPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizers.m[model.ModelPath] = t
+	return t, nil
+}
+
+// tokenizerError writes the error from modelTokenizer
+func tokenizerError(c *gin.Context, model string, err error) {
+	var pErr *fs.PathError
+	switch {
+	case errors.As(err, &pErr):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found, try pulling it first", model)})
+	case errors.Is(err, llm.ErrNoTokenizer):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model '%s' has no tokenizer", model)})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func TokenizeHandler(c *gin.Context) {
+	var req api.TokenizeRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	t, err := modelTokenizer(req.Model)
+	if err != nil {
+		tokenizerError(c, req.Model, err)
+		return
+	}
+
+	addSpecial := req.AddSpecial == nil || *req.AddSpecial
+	tokens := t.Encode(req.Content, addSpecial, req.ParseSpecial)
+	if tokens == nil {
+		tokens = []int{}
+	}
+
+	c.JSON(http.StatusOK, api.TokenizeResponse{Tokens: tokens})
+}
+
+func DetokenizeHandler(c *gin.Context) {
+	var req api.DetokenizeRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	t, err := modelTokenizer(req.Model)
+	if err != nil {
+		tokenizerError(c, req.Model, err)
+		return
+	}
+
+	size := len(t.Vocabulary().Tokens)
+	for _, id := range req.Tokens {
+		if id < 0 || id >= size {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("token %d is out of range for a vocabulary of %d tokens", id, size)})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, api.DetokenizeResponse{Content: t.Decode(req.Tokens, req.RenderSpecial)})
+}
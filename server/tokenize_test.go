@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+// writeGGUF writes a version 3 gguf file with the metadata kv and no tensors. Values are strings, uint32s,
+// bools and arrays of strings or int32s.
+func writeGGUF(t *testing.T, path string, kv [][2]any) {
+	var b bytes.Buffer
+	write := func(v any) { require.NoError(t, binary.Write(&b, binary.LittleEndian, v)) }
+	writeString := func(s string) {
+		write(uint64(len(s)))
+		b.WriteString(s)
+	}
+
+	b.WriteString("GGUF")
+	write(uint32(3))
+	write(uint64(0))
+	write(uint64(len(kv)))
+
+	for _, e := range kv {
+		writeString(e[0].(string))
+		switch v := e[1].(type) {
+		case string:
+			write(uint32(8))
+			writeString(v)
+		case uint32:
+			write(uint32(4))
+			write(v)
+		case bool:
+			write(uint32(7))
+			write(v)
+		case []string:
+			write(uint32(9))
+			write(uint32(8))
+			write(uint64(len(v)))
+			for _, s := range v {
+				writeString(s)
+			}
+		case []int32:
+			write(uint32(9))
+			write(uint32(5))
+			write(uint64(len(v)))
+			write(v)
+		default:
+			t.Fatalf("unsupported value %T", v)
+		}
+	}
+
+	require.NoError(t, os.WriteFile(path, b.Bytes(), 0o644))
+}
+
+func TestTokenize(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	tokens := []string{"<|endoftext|>"}
+	types := []int32{3}
+	for _, r := range "dehlorwĠ" {
+		tokens = append(tokens, string(r))
+		types = append(types, 1)
+	}
+
+	tokens = append(tokens, "he", "ll", "hell", "hello", "Ġw", "or", "Ġwor", "Ġworl", "Ġworld")
+	for len(types) < len(tokens) {
+		types = append(types, 1)
+	}
+
+	gguf := filepath.Join(t.TempDir(), "model.gguf")
+	writeGGUF(t, gguf, [][2]any{
+		{"general.architecture", "llama"},
+		{"tokenizer.ggml.model", "gpt2"},
+		{"tokenizer.ggml.pre", "gpt2"},
+		{"tokenizer.ggml.tokens", tokens},
+		{"tokenizer.ggml.token_type", types},
+		{"tokenizer.ggml.merges", []string{"h e", "l l", "he ll", "hell o", "Ġ w", "o r", "Ġw or", "Ġwor l", "Ġworl d"}},
+		{"tokenizer.ggml.bos_token_id", uint32(0)},
+		{"tokenizer.ggml.eos_token_id", uint32(0)},
+		{"tokenizer.ggml.add_bos_token", true},
+	})
+
+	commands, err := parser.Parse(strings.NewReader("FROM " + gguf))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "tokens", "", commands, func(api.ProgressResponse) {}))
+
+	empty := filepath.Join(t.TempDir(), "empty.gguf")
+	writeGGUF(t, empty, nil)
+
+	commands, err = parser.Parse(strings.NewReader("FROM " + empty))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "empty", "", commands, func(api.ProgressResponse) {}))
+
+	s, err := setupServer(t)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s.GenerateRoutes())
+	t.Cleanup(srv.Close)
+
+	post := func(path string, req, resp any) int {
+		bts, err := json.Marshal(req)
+		require.NoError(t, err)
+
+		r, err := srv.Client().Post(srv.URL+path, "application/json", bytes.NewReader(bts))
+		require.NoError(t, err)
+		defer r.Body.Close()
+
+		if resp != nil && r.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(resp))
+		}
+
+		return r.StatusCode
+	}
+
+	id := func(token string) int {
+		for i, s := range tokens {
+			if s == token {
+				return i
+			}
+		}
+
+		t.Fatalf("no token %q", token)
+		return -1
+	}
+
+	hello, world := id("hello"), id("Ġworld")
+
+	var tokenized api.TokenizeResponse
+	require.Equal(t, http.StatusOK, post("/api/tokenize", api.TokenizeRequest{Model: "tokens", Content: "hello world"}, &tokenized))
+	assert.Equal(t, []int{0, hello, world}, tokenized.Tokens)
+
+	addSpecial := false
+	require.Equal(t, http.StatusOK, post("/api/tokenize", api.TokenizeRequest{Model: "tokens", Content: "hello<|endoftext|>", AddSpecial: &addSpecial, ParseSpecial: true}, &tokenized))
+	assert.Equal(t, []int{hello, 0}, tokenized.Tokens)
+
+	var detokenized api.DetokenizeResponse
+	require.Equal(t, http.StatusOK, post("/api/detokenize", api.DetokenizeRequest{Model: "tokens", Tokens: []int{0, hello, world}}, &detokenized))
+	assert.Equal(t, "hello world", detokenized.Content)
+
+	require.Equal(t, http.StatusOK, post("/api/detokenize", api.DetokenizeRequest{Model: "tokens", Tokens: []int{0, hello}, RenderSpecial: true}, &detokenized))
+	assert.Equal(t, "<|endoftext|>hello", detokenized.Content)
+
+	assert.Equal(t, http.StatusBadRequest, post("/api/detokenize", api.DetokenizeRequest{Model: "tokens", Tokens: []int{len(tokens)}}, nil))
+	assert.Equal(t, http.StatusBadRequest, post("/api/tokenize", api.TokenizeRequest{Model: "empty", Content: "hello"}, nil))
+	assert.Equal(t, http.StatusNotFound, post("/api/tokenize", api.TokenizeRequest{Model: "missing", Content: "hello"}, nil))
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+const toolInstructions = `You can call the following functions to help answer the user:
+%s
+To call a function reply with only a JSON object for the call and nothing else, e.g. {"tool": "<function>", "arguments": {...}} with arguments matching the function's parameters. To call several functions at once reply with a JSON list of calls. The results will be sent back to you. When you have enough information, reply to the user normally.`
+
+// openaiTools checks the tools and tool_choice of a chat completion request, returning the tools offered to the
+// model and whether it must call one
+func openaiTools(tools []api.Tool, choice any) ([]api.Tool, bool, error) {
+	for i, tool := range tools {
+		if tool.Type != "function" {
+			return nil, false, fmt.Errorf("tools[%d]: unknown type '%s', expected \"function\"", i, tool.Type)
+		}
+
+		if tool.Function.Name == "" {
+			return nil, false, fmt.Errorf("tools[%d]: function name is required", i)
+		}
+	}
+
+	switch choice := choice.(type) {
+	case nil:
+		return tools, false, nil
+	case string:
+		switch choice {
+		case "auto":
+			return tools, false, nil
+		case "none":
+			return nil, false, nil
+		case "required":
+			if len(tools) == 0 {
+				return nil, false, errors.New("tool_choice is \"required\" but no tools are given")
+			}
+
+			return tools, true, nil
+		}
+	case map[string]any:
+		function, _ := choice["function"].(map[string]any)
+		name, _ := function["name"].(string)
+		for _, tool := range tools {
+			if tool.Function.Name == name {
+				return []api.Tool{tool}, true, nil
+			}
+		}
+
+		return nil, false, fmt.Errorf("tool_choice: unknown function '%s'", name)
+	}
+
+	return nil, false, errors.New("tool_choice must be \"auto\", \"none\", \"required\" or a function")
+}
+
+// toolSystem describes the tools offered to the model in the system message, adding one if there is none
+func toolSystem(messages []api.Message, tools []api.Tool, required bool) []api.Message {
+	var sb strings.Builder
+	for _, tool := range tools {
+		fmt.Fprintf(&sb, "\n- %s", tool.Function.Name)
+		if tool.Function.Description != "" {
+			fmt.Fprintf(&sb, ": %s", tool.Function.Description)
+		}
+
+		if len(tool.Function.Parameters) > 0 {
+			fmt.Fprintf(&sb, " (parameters: %s)", tool.Function.Parameters)
+		}
+	}
+
+	instructions := fmt.Sprintf(toolInstructions, sb.String())
+	if required {
+		instructions += " You must call a function before replying."
+	}
+
+	if len(messages) > 0 && messages[0].Role == "system" {
+		messages[0].Content += "\n\n" + instructions
+		return messages
+	}
+
+	return append([]api.Message{{Role: "system", Content: instructions}}, messages...)
+}
+
+// openaiMessages converts the messages of a chat completion request. Tool calls and their results are written
+// as the model is asked to make and is sent them, as chat templates only have system, user and assistant
+// messages.
+func openaiMessages(msgs []api.ChatCompletionMessage) ([]api.Message, error) {
+	// names are the functions called, by the ID of the call
+	names := make(map[string]string)
+
+	messages := make([]api.Message, len(msgs))
+	for i, msg := range msgs {
+		content, err := openaiContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+
+		switch {
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			for _, call := range msg.ToolCalls {
+				names[call.ID] = call.Function.Name
+			}
+
+			calls, err := toolCallText(msg.ToolCalls)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+
+			if content != "" {
+				calls = content + "\n\n" + calls
+			}
+
+			messages[i] = api.Message{Role: "assistant", Content: calls}
+		case msg.Role == "tool":
+			name, ok := names[msg.ToolCallID]
+			if !ok {
+				return nil, fmt.Errorf("messages[%d]: unknown tool_call_id '%s'", i, msg.ToolCallID)
+			}
+
+			content = fmt.Sprintf("Result of the %s tool call:\n```\n%s\n```", name, strings.TrimRight(content, "\n"))
+			messages[i] = api.Message{Role: "user", Content: content}
+		default:
+			messages[i] = api.Message{Role: msg.Role, Content: content}
+		}
+	}
+
+	return messages, nil
+}
+
+// modelToolCall is a tool call as the model makes it. Some models name the fields after the function calls
+// they were trained on instead.
+type modelToolCall struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+
+	Name       string          `json:"name,omitempty"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// toolCallText writes tool calls the way the model is asked to make them
+func toolCallText(calls []api.ToolCall) (string, error) {
+	text := make([]modelToolCall, len(calls))
+	for i, call := range calls {
+		args := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(args) {
+			return "", fmt.Errorf("tool_calls[%d]: arguments must be JSON", i)
+		}
+
+		text[i] = modelToolCall{Tool: call.Function.Name, Arguments: args}
+	}
+
+	var v any = text
+	if len(text) == 1 {
+		v = text[0]
+	}
+
+	bts, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bts), nil
+}
+
+// trimCodeBlock removes the code block models often wrap JSON in
+func trimCodeBlock(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+	return strings.TrimSpace(text)
+}
+
+// mightBeToolCalls reports whether text is the start of a response which could still be tool calls
+func mightBeToolCalls(text string) bool {
+	text = strings.TrimSpace(text)
+	for _, prefix := range []string{"{", "[", "```"} {
+		if strings.HasPrefix(text, prefix) || strings.HasPrefix(prefix, text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseToolCalls returns the calls in a response which is only calls of the tools offered
+func parseToolCalls(text string, tools []api.Tool) ([]api.ToolCall, bool) {
+	text = trimCodeBlock(text)
+
+	var calls []modelToolCall
+	switch {
+	case strings.HasPrefix(text, "["):
+		if err := json.Unmarshal([]byte(text), &calls); err != nil || len(calls) == 0 {
+			return nil, false
+		}
+	case strings.HasPrefix(text, "{"):
+		var call modelToolCall
+		if err := json.Unmarshal([]byte(text), &call); err != nil {
+			return nil, false
+		}
+
+		calls = []modelToolCall{call}
+	default:
+		return nil, false
+	}
+
+	toolCalls := make([]api.ToolCall, len(calls))
+	for i, call := range calls {
+		name, args := call.Tool, call.Arguments
+		if name == "" {
+			name, args = call.Name, call.Parameters
+		}
+
+		if !offersTool(tools, name) {
+			return nil, false
+		}
+
+		// arguments are passed on as a JSON string, which some models already encode them as
+		arguments := "{}"
+		if err := json.Unmarshal(args, &arguments); err != nil && len(args) > 0 {
+			arguments = string(args)
+		}
+
+		id := make([]byte, 12)
+		if _, err := rand.Read(id); err != nil {
+			return nil, false
+		}
+
+		toolCalls[i] = api.ToolCall{
+			Index:    i,
+			ID:       "call_" + hex.EncodeToString(id),
+			Type:     "function",
+			Function: api.ToolCallFunction{Name: name, Arguments: arguments},
+		}
+	}
+
+	return toolCalls, true
+}
+
+func offersTool(tools []api.Tool, name string) bool {
+	for _, tool := range tools {
+		if tool.Function.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
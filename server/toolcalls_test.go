@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+var weatherTool = api.Tool{
+	Type: "function",
+	Function: api.ToolFunction{
+		Name:        "get_weather",
+		Description: "Get the weather in a city",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+	},
+}
+
+func TestOpenAITools(t *testing.T) {
+	timeTool := api.Tool{Type: "function", Function: api.ToolFunction{Name: "get_time"}}
+	tools := []api.Tool{weatherTool, timeTool}
+
+	offered, required, err := openaiTools(tools, nil)
+	require.NoError(t, err)
+	assert.Equal(t, tools, offered)
+	assert.False(t, required)
+
+	offered, _, err = openaiTools(tools, "none")
+	require.NoError(t, err)
+	assert.Empty(t, offered)
+
+	offered, required, err = openaiTools(tools, "required")
+	require.NoError(t, err)
+	assert.Equal(t, tools, offered)
+	assert.True(t, required)
+
+	offered, required, err = openaiTools(tools, map[string]any{"type": "function", "function": map[string]any{"name": "get_time"}})
+	require.NoError(t, err)
+	assert.Equal(t, []api.Tool{timeTool}, offered)
+	assert.True(t, required)
+
+	_, _, err = openaiTools(tools, map[string]any{"type": "function", "function": map[string]any{"name": "get_news"}})
+	assert.Error(t, err)
+
+	_, _, err = openaiTools(nil, "required")
+	assert.Error(t, err)
+
+	_, _, err = openaiTools(tools, "sometimes")
+	assert.Error(t, err)
+
+	_, _, err = openaiTools([]api.Tool{{Type: "retrieval"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestToolSystem(t *testing.T) {
+	messages := toolSystem([]api.Message{{Role: "user", Content: "hi"}}, []api.Tool{weatherTool}, false)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "system", messages[0].Role)
+	assert.Contains(t, messages[0].Content, "- get_weather: Get the weather in a city (parameters: {")
+	assert.NotContains(t, messages[0].Content, "You must call")
+
+	messages = toolSystem([]api.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}, []api.Tool{weatherTool}, true)
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0].Content, "Be brief.\n\nYou can call the following functions")
+	assert.Contains(t, messages[0].Content, "You must call a function before replying.")
+}
+
+func TestOpenAIMessages(t *testing.T) {
+	var req api.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"messages": [
+			{"role": "user", "content": "What's the weather in Paris?"},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\": \"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "Sunny, 21C\n"}
+		]
+	}`), &req))
+
+	messages, err := openaiMessages(req.Messages)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Message{
+		{Role: "user", Content: "What's the weather in Paris?"},
+		{Role: "assistant", Content: `{"tool":"get_weather","arguments":{"city":"Paris"}}`},
+		{Role: "user", Content: "Result of the get_weather tool call:\n```\nSunny, 21C\n```"},
+	}, messages)
+
+	_, err = openaiMessages([]api.ChatCompletionMessage{{Role: "tool", ToolCallID: "call_2", Content: "Sunny"}})
+	assert.ErrorContains(t, err, "unknown tool_call_id")
+}
+
+func TestParseToolCalls(t *testing.T) {
+	tools := []api.Tool{weatherTool}
+
+	calls, ok := parseToolCalls(`{"tool": "get_weather", "arguments": {"city": "Paris"}}`, tools)
+	require.True(t, ok)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "function", calls[0].Type)
+	assert.Equal(t, "get_weather", calls[0].Function.Name)
+	assert.JSONEq(t, `{"city": "Paris"}`, calls[0].Function.Arguments)
+	assert.Contains(t, calls[0].ID, "call_")
+
+	// models trained on function calls may name the fields differently, or wrap the calls in a code block
+	calls, ok = parseToolCalls("```json\n[{\"name\": \"get_weather\", \"parameters\": {\"city\": \"Paris\"}}, {\"tool\": \"get_weather\", \"arguments\": \"{\\\"city\\\": \\\"Rome\\\"}\"}]\n```", tools)
+	require.True(t, ok)
+	require.Len(t, calls, 2)
+	assert.JSONEq(t, `{"city": "Paris"}`, calls[0].Function.Arguments)
+	assert.JSONEq(t, `{"city": "Rome"}`, calls[1].Function.Arguments)
+	assert.Equal(t, 1, calls[1].Index)
+	assert.NotEqual(t, calls[0].ID, calls[1].ID)
+
+	calls, ok = parseToolCalls(`{"tool": "get_weather"}`, tools)
+	require.True(t, ok)
+	assert.Equal(t, "{}", calls[0].Function.Arguments)
+
+	for _, text := range []string{
+		"It's sunny in Paris.",
+		`{"tool": "get_news", "arguments": {}}`,
+		`{"city": "Paris"}`,
+		`{"tool": "get_weather", "arguments": {"city": "Paris"}} and then`,
+	} {
+		_, ok := parseToolCalls(text, tools)
+		assert.False(t, ok, text)
+	}
+}
+
+func TestMightBeToolCalls(t *testing.T) {
+	for _, text := range []string{"", " ", "{", " [{\"tool\"", "`", "``", "```json\n{"} {
+		assert.True(t, mightBeToolCalls(text), text)
+	}
+
+	for _, text := range []string{"It", "Sure", "`code`"} {
+		assert.False(t, mightBeToolCalls(text), text)
+	}
+}
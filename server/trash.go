@@ -0,0 +1,366 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jmorganca/ollama/api"
+)
+
+const (
+	// defaultTrashRetention is how long a deleted model can be restored before its layers are removed
+	defaultTrashRetention = 24 * time.Hour
+
+	// trashPurgeInterval is how often models which have been in the trash too long are purged
+	trashPurgeInterval = time.Hour
+)
+
+var errModelExists = errors.New("a model with this name already exists, remove or copy it before restoring")
+
+var trashRetention = defaultTrashRetention
+
+// loadTrashRetention reads how long deleted models are kept in the trash from $OLLAMA_TRASH_RETENTION, 0
+// deletes them straight away
+func loadTrashRetention() (time.Duration, error) {
+	s := os.Getenv("OLLAMA_TRASH_RETENTION")
+	if s == "" {
+		return defaultTrashRetention, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("OLLAMA_TRASH_RETENTION: invalid duration '%s', expected a duration such as 24h, or 0 to disable", s)
+	}
+
+	return d, nil
+}
+
+// trashDir has the manifests of deleted models, laid out like the manifests directory. The time a manifest
+// was deleted is its modification time.
+func trashDir() (string, error) {
+	dir, err := modelsDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "trash"), nil
+}
+
+func (mp ModelPath) trashPath() (string, error) {
+	dir, err := trashDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, mp.Registry, mp.Namespace, mp.Repository, mp.Tag), nil
+}
+
+func readManifestFile(fp string) (*ManifestV2, string, error) {
+	bts, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var manifest ManifestV2
+	if err := json.Unmarshal(bts, &manifest); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", fp, err)
+	}
+
+	sum := sha256.Sum256(bts)
+	return &manifest, hex.EncodeToString(sum[:]), nil
+}
+
+// walkTrash calls fn with the path and model name of each manifest in the trash
+func walkTrash(fn func(path string, mp ModelPath, info os.FileInfo) error) error {
+	dir, err := trashDir()
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == dir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		parent, tag := filepath.Split(rel)
+		mp := ParseModelPath(strings.Trim(filepath.ToSlash(parent), "/") + ":" + tag)
+		return fn(path, mp, info)
+	})
+}
+
+// trashModel moves the manifest of a model to the trash, its layers are kept until it is purged
+func trashModel(mp ModelPath) error {
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(fp); err != nil {
+		return err
+	}
+
+	trashed, err := mp.trashPath()
+	if err != nil {
+		return err
+	}
+
+	// a model deleted again replaces the one deleted before
+	if err := purgeManifest(trashed); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(trashed), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(fp, trashed); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return os.Chtimes(trashed, now, now)
+}
+
+// purgeManifest removes a manifest and the layers no other model uses
+func purgeManifest(fp string) error {
+	manifest, _, err := readManifestFile(fp)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fp); err != nil {
+		return err
+	}
+
+	deleteMap := make(map[string]struct{})
+	for _, layer := range manifest.Layers {
+		deleteMap[layer.Digest] = struct{}{}
+	}
+	deleteMap[manifest.Config.Digest] = struct{}{}
+
+	return deleteUnusedLayers(nil, deleteMap, false)
+}
+
+// PurgeModel deletes a model, or the model of that name in the trash, and its layers straight away
+func PurgeModel(name string) error {
+	mp := ParseModelPath(name)
+
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		return err
+	}
+
+	err = purgeManifest(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		if fp, err = mp.trashPath(); err != nil {
+			return err
+		}
+
+		err = purgeManifest(fp)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return pruneTrashDirectory()
+}
+
+// RestoreModel moves a deleted model back from the trash
+func RestoreModel(name string) error {
+	mp := ParseModelPath(name)
+
+	trashed, err := mp.trashPath()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(trashed); err != nil {
+		return err
+	}
+
+	fp, err := mp.GetManifestPath()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(fp); err == nil {
+		return errModelExists
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(trashed, fp); err != nil {
+		return err
+	}
+
+	return pruneTrashDirectory()
+}
+
+// ListTrash lists the models in the trash, most recently deleted first
+func ListTrash() ([]api.TrashedModel, error) {
+	models := make([]api.TrashedModel, 0)
+	err := walkTrash(func(path string, mp ModelPath, info os.FileInfo) error {
+		manifest, digest, err := readManifestFile(path)
+		if err != nil {
+			log.Printf("skipping file: %s: %v", path, err)
+			return nil
+		}
+
+		size := manifest.Config.Size
+		for _, layer := range manifest.Layers {
+			size += layer.Size
+		}
+
+		models = append(models, api.TrashedModel{
+			Name:      mp.GetShortTagname(),
+			Size:      size,
+			Digest:    digest,
+			DeletedAt: info.ModTime(),
+			ExpiresAt: info.ModTime().Add(trashRetention),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].DeletedAt.After(models[j].DeletedAt)
+	})
+
+	return models, nil
+}
+
+// PurgeTrash removes the models which have been in the trash longer than the retention, and their layers
+func PurgeTrash() error {
+	var expired []string
+	err := walkTrash(func(path string, mp ModelPath, info os.FileInfo) error {
+		if time.Since(info.ModTime()) >= trashRetention {
+			expired = append(expired, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, fp := range expired {
+		log.Printf("purging deleted model %s", fp)
+		if err := purgeManifest(fp); err != nil {
+			return err
+		}
+	}
+
+	return pruneTrashDirectory()
+}
+
+func pruneTrashDirectory() error {
+	dir, err := trashDir()
+	if err != nil {
+		return err
+	}
+
+	if err := PruneDirectory(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// purgeTrashEvery purges the trash every interval until ctx is done, skipping a purge while another process
+// is changing the model store
+func purgeTrashEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.TryLock(ctx); err != nil {
+				continue
+			}
+
+			if err := PurgeTrash(); err != nil {
+				log.Printf("couldn't purge the trash: %v", err)
+			}
+
+			store.Unlock()
+		}
+	}
+}
+
+func RestoreModelHandler(c *gin.Context) {
+	var req api.RestoreRequest
+	err := c.ShouldBindJSON(&req)
+	switch {
+	case errors.Is(err, io.EOF):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing request body"})
+		return
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if err := store.TryLock(c.Request.Context()); err != nil {
+		storeLockError(c, err)
+		return
+	}
+	defer store.Unlock()
+
+	switch err := RestoreModel(req.Name); {
+	case errors.Is(err, os.ErrNotExist):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found in the trash", req.Name)})
+	case errors.Is(err, errModelExists):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, nil)
+	}
+}
+
+func ListTrashHandler(c *gin.Context) {
+	models, err := ListTrash()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.TrashResponse{Models: models})
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jmorganca/ollama/api"
+	"github.com/jmorganca/ollama/parser"
+)
+
+func TestLoadTrashRetention(t *testing.T) {
+	t.Setenv("OLLAMA_TRASH_RETENTION", "")
+	d, err := loadTrashRetention()
+	require.NoError(t, err)
+	assert.Equal(t, defaultTrashRetention, d)
+
+	t.Setenv("OLLAMA_TRASH_RETENTION", "72h")
+	d, err = loadTrashRetention()
+	require.NoError(t, err)
+	assert.Equal(t, 72*time.Hour, d)
+
+	t.Setenv("OLLAMA_TRASH_RETENTION", "0")
+	d, err = loadTrashRetention()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	t.Setenv("OLLAMA_TRASH_RETENTION", "a while")
+	_, err = loadTrashRetention()
+	assert.Error(t, err)
+}
+
+func TestTrash(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	retention := trashRetention
+	t.Cleanup(func() { trashRetention = retention })
+	trashRetention = defaultTrashRetention
+
+	create := func(system string) []string {
+		commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nSYSTEM " + system))
+		require.NoError(t, err)
+		require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+		manifest, _, err := GetManifest(ParseModelPath("echo"))
+		require.NoError(t, err)
+
+		var blobs []string
+		for _, layer := range append(manifest.Layers, manifest.Config) {
+			fp, err := GetBlobsPath(layer.Digest)
+			require.NoError(t, err)
+			blobs = append(blobs, fp)
+		}
+
+		return blobs
+	}
+
+	blobs := create("hello")
+
+	// a deleted model keeps its layers, even when unused layers are pruned
+	require.NoError(t, DeleteModel("echo"))
+	_, err := GetModel("echo")
+	assert.Error(t, err)
+
+	require.NoError(t, PruneLayers())
+	for _, fp := range blobs {
+		assert.FileExists(t, fp)
+	}
+
+	trash, err := ListTrash()
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, "echo:latest", trash[0].Name)
+	assert.Equal(t, trash[0].DeletedAt.Add(defaultTrashRetention), trash[0].ExpiresAt)
+
+	require.NoError(t, RestoreModel("echo"))
+	model, err := GetModel("echo")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", model.System)
+
+	trash, err = ListTrash()
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+
+	// a model isn't restored over one created since
+	require.NoError(t, DeleteModel("echo"))
+	create("goodbye")
+	assert.ErrorIs(t, RestoreModel("echo"), errModelExists)
+
+	_, err = os.Stat(blobs[len(blobs)-1])
+	assert.NoError(t, err)
+
+	// models are purged once they have been in the trash longer than the retention
+	require.NoError(t, PurgeTrash())
+	trash, err = ListTrash()
+	require.NoError(t, err)
+	assert.Len(t, trash, 1)
+
+	trashRetention = 0
+	require.NoError(t, PurgeTrash())
+	trash, err = ListTrash()
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+	assert.NoFileExists(t, blobs[len(blobs)-1])
+
+	assert.ErrorIs(t, RestoreModel("echo"), os.ErrNotExist)
+}
+
+func TestPurgeModel(t *testing.T) {
+	t.Setenv("OLLAMA_MODELS", t.TempDir())
+
+	commands, err := parser.Parse(strings.NewReader("FROM mock://echo\nSYSTEM hello"))
+	require.NoError(t, err)
+	require.NoError(t, CreateModel(context.TODO(), "echo", "", commands, func(api.ProgressResponse) {}))
+
+	manifest, _, err := GetManifest(ParseModelPath("echo"))
+	require.NoError(t, err)
+
+	config, err := GetBlobsPath(manifest.Config.Digest)
+	require.NoError(t, err)
+
+	// a model purged from the trash is gone with its layers
+	require.NoError(t, DeleteModel("echo"))
+	require.NoError(t, PurgeModel("echo"))
+	assert.NoFileExists(t, config)
+
+	trash, err := ListTrash()
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+
+	assert.ErrorIs(t, PurgeModel("echo"), os.ErrNotExist)
+}
@@ -0,0 +1,140 @@
+// Package style colors the output of the ollama command. Colors are left out of output which isn't a
+// terminal, when $NO_COLOR is set, or with --no-color. $OLLAMA_THEME picks colors which suit the terminal's
+// background.
+package style
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Style is a kind of output the theme colors
+type Style int
+
+const (
+	Error Style = iota
+	Warning
+	Header
+	Muted
+	Added
+	Removed
+)
+
+// Theme has the SGR parameters of each style, such as "1" for bold or "31" for red. Styles which aren't in
+// the theme are left as they are.
+type Theme map[Style]string
+
+var themes = map[string]Theme{
+	"dark": {
+		Error:   "31",
+		Warning: "33",
+		Header:  "1",
+		Muted:   "90",
+		Added:   "32",
+		Removed: "31",
+	},
+	"light": {
+		Error:   "31",
+		Warning: "38;5;130",
+		Header:  "1",
+		Muted:   "38;5;242",
+		Added:   "38;5;28",
+		Removed: "31",
+	},
+	"none": {},
+}
+
+const defaultTheme = "dark"
+
+// Output styles text written to a stream
+type Output struct {
+	theme Theme
+}
+
+var (
+	Stdout = &Output{}
+	Stderr = &Output{}
+)
+
+func init() {
+	// an unknown theme is reported when the command configures the style
+	_ = Configure(false)
+}
+
+// Configure sets the theme from $OLLAMA_THEME for stdout and stderr when they are terminals, unless noColor
+// or $NO_COLOR is set
+func Configure(noColor bool) error {
+	theme, err := loadTheme()
+	if err != nil {
+		return err
+	}
+
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		theme = nil
+	}
+
+	Stdout.theme = themeFor(os.Stdout, theme)
+	Stderr.theme = themeFor(os.Stderr, theme)
+	return nil
+}
+
+func loadTheme() (Theme, error) {
+	name := os.Getenv("OLLAMA_THEME")
+	if name == "" {
+		name = defaultTheme
+	}
+
+	theme, ok := themes[name]
+	if !ok {
+		names := make([]string, 0, len(themes))
+		for name := range themes {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		return nil, fmt.Errorf("OLLAMA_THEME: unknown theme '%s', expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	return theme, nil
+}
+
+func themeFor(w io.Writer, theme Theme) Theme {
+	if f, ok := w.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+		return nil
+	}
+
+	return theme
+}
+
+// Render returns text in the style
+func (o *Output) Render(s Style, text string) string {
+	if start := o.Start(s); start != "" {
+		return start + text + o.End()
+	}
+
+	return text
+}
+
+// Start returns the sequence which starts the style, for text which is written as it is streamed. It is
+// ended with End.
+func (o *Output) Start(s Style) string {
+	if params := o.theme[s]; params != "" {
+		return "\033[" + params + "m"
+	}
+
+	return ""
+}
+
+// End returns the sequence which ends a style started with Start
+func (o *Output) End() string {
+	if len(o.theme) > 0 {
+		return "\033[0m"
+	}
+
+	return ""
+}
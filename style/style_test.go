@@ -0,0 +1,50 @@
+package style
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	o := &Output{theme: themes["dark"]}
+	assert.Equal(t, "\033[31mError:\033[0m", o.Render(Error, "Error:"))
+	assert.Equal(t, "\033[90m", o.Start(Muted))
+	assert.Equal(t, "\033[0m", o.End())
+
+	o = &Output{theme: themes["none"]}
+	assert.Equal(t, "Error:", o.Render(Error, "Error:"))
+	assert.Empty(t, o.Start(Muted))
+	assert.Empty(t, o.End())
+
+	o = &Output{}
+	assert.Equal(t, "Error:", o.Render(Error, "Error:"))
+}
+
+func TestLoadTheme(t *testing.T) {
+	t.Setenv("OLLAMA_THEME", "")
+	theme, err := loadTheme()
+	require.NoError(t, err)
+	assert.Equal(t, themes["dark"], theme)
+
+	t.Setenv("OLLAMA_THEME", "light")
+	theme, err = loadTheme()
+	require.NoError(t, err)
+	assert.Equal(t, themes["light"], theme)
+
+	t.Setenv("OLLAMA_THEME", "solarized")
+	_, err = loadTheme()
+	assert.ErrorContains(t, err, "expected one of dark, light, none")
+}
+
+func TestConfigure(t *testing.T) {
+	t.Setenv("OLLAMA_THEME", "dark")
+	t.Setenv("NO_COLOR", "1")
+	require.NoError(t, Configure(false))
+	assert.Equal(t, "Error:", Stdout.Render(Error, "Error:"))
+	assert.Equal(t, "Error:", Stderr.Render(Error, "Error:"))
+
+	t.Setenv("OLLAMA_THEME", "solarized")
+	assert.Error(t, Configure(false))
+}
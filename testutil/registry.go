@@ -0,0 +1,449 @@
+// Package testutil has helpers for testing ollama, and tools built on it, without reaching the internet.
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const manifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+// Registry serves the registry protocol ollama pulls and pushes models with, from manifests and blobs in a
+// directory:
+//
+//	manifests/<namespace>/<repository>/<tag>
+//	blobs/sha256-<hex>
+//
+// A registry made with NewRecorder fetches whatever it doesn't have from a real registry and saves it in the
+// directory, so a later NewRegistry on the same directory replays it without the real registry.
+type Registry struct {
+	dir string
+
+	// upstream is the registry misses are recorded from, there is none when replaying
+	upstream string
+	client   *http.Client
+
+	mu       sync.Mutex
+	requests []string
+}
+
+// NewRegistry serves the manifests and blobs in dir. Models pushed to it are written to dir.
+func NewRegistry(dir string) *Registry {
+	return &Registry{dir: dir}
+}
+
+// NewRecorder serves the manifests and blobs in dir, fetching the ones it doesn't have from the registry at
+// upstream, such as https://registry.ollama.ai, and saving them in dir
+func NewRecorder(dir, upstream string) *Registry {
+	return &Registry{dir: dir, upstream: strings.TrimSuffix(upstream, "/"), client: http.DefaultClient}
+}
+
+// Start serves the registry on a local port until the test ends. Models are named with its host, e.g.
+// <host>/library/llama2:latest, and need to be pulled or pushed with insecure set since it serves plain http.
+func (r *Registry) Start(t interface{ Cleanup(func()) }) (host string) {
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Requests lists the requests the registry has served, as "<method> <path>", in the order they were made
+func (r *Registry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.requests...)
+}
+
+type registryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]registryError{"errors": {{Code: code, Message: message}}})
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	r.mu.Unlock()
+
+	path, ok := strings.CutPrefix(req.URL.Path, "/v2/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "not a registry path")
+		return
+	}
+
+	if name, upload, ok := strings.Cut(path, "/blobs/uploads/"); ok {
+		r.serveUpload(w, req, name, upload)
+		return
+	}
+
+	if i := strings.LastIndex(path, "/manifests/"); i > 0 {
+		r.serveManifest(w, req, path[:i], path[i+len("/manifests/"):])
+		return
+	}
+
+	if i := strings.LastIndex(path, "/blobs/"); i > 0 {
+		r.serveBlob(w, req, path[:i], path[i+len("/blobs/"):])
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "not a registry path")
+}
+
+func (r *Registry) manifestPath(name, tag string) (string, error) {
+	if !validName(name) || !validName(tag) || strings.Contains(tag, "/") {
+		return "", fmt.Errorf("invalid name %s:%s", name, tag)
+	}
+
+	return filepath.Join(r.dir, "manifests", filepath.FromSlash(name), tag), nil
+}
+
+func (r *Registry) blobPath(digest string) (string, error) {
+	hexDigest, ok := strings.CutPrefix(digest, "sha256:")
+	if _, err := hex.DecodeString(hexDigest); !ok || err != nil || len(hexDigest) != 64 {
+		return "", fmt.Errorf("invalid digest %s", digest)
+	}
+
+	return filepath.Join(r.dir, "blobs", "sha256-"+hexDigest), nil
+}
+
+func validName(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `\:`) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, name, tag string) {
+	p, err := r.manifestPath(name, tag)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "NAME_INVALID", err.Error())
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if !r.record(w, req, p, "") {
+			return
+		}
+
+		w.Header().Set("Content-Type", manifestMediaType)
+		http.ServeFile(w, req, p)
+	case http.MethodPut:
+		var manifest struct {
+			Config struct {
+				Digest string `json:"digest"`
+			} `json:"config"`
+			Layers []struct {
+				Digest string `json:"digest"`
+			} `json:"layers"`
+		}
+
+		bts, err := io.ReadAll(req.Body)
+		if err == nil {
+			err = json.Unmarshal(bts, &manifest)
+		}
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+
+		// like a real registry, a manifest is only accepted once its blobs have been pushed
+		digests := []string{manifest.Config.Digest}
+		for _, layer := range manifest.Layers {
+			digests = append(digests, layer.Digest)
+		}
+
+		for _, digest := range digests {
+			bp, err := r.blobPath(digest)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+				return
+			}
+
+			if _, err := os.Stat(bp); err != nil {
+				writeError(w, http.StatusBadRequest, "BLOB_UNKNOWN", fmt.Sprintf("blob %s has not been pushed", digest))
+				return
+			}
+		}
+
+		if err := writeFile(p, bts); err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", req.Method)
+	}
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, name, digest string) {
+	p, err := r.blobPath(digest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", req.Method)
+		return
+	}
+
+	if !r.record(w, req, p, digest) {
+		return
+	}
+
+	// ServeFile answers the range requests blobs are downloaded in
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	http.ServeFile(w, req, p)
+}
+
+// record makes sure the manifest or blob at p is in the registry's directory, fetching it from upstream if
+// it is recording. It writes the response and returns false if it couldn't.
+func (r *Registry) record(w http.ResponseWriter, req *http.Request, p, digest string) bool {
+	if _, err := os.Stat(p); err == nil {
+		return true
+	}
+
+	if r.upstream == "" {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("%s is not in the registry", req.URL.Path))
+		return false
+	}
+
+	// the whole manifest or blob is fetched, whatever the request was for
+	upstreamReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, r.upstream+req.URL.Path, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return false
+	}
+
+	for _, key := range []string{"Accept", "Authorization", "User-Agent"} {
+		if v := req.Header.Get(key); v != "" {
+			upstreamReq.Header.Set(key, v)
+		}
+	}
+
+	resp, err := r.client.Do(upstreamReq)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "UNKNOWN", err.Error())
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// the client handles the upstream's errors, such as asking it to authenticate
+		if auth := resp.Header.Get("WWW-Authenticate"); auth != "" {
+			w.Header().Set("WWW-Authenticate", auth)
+		}
+
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return false
+	}
+
+	bts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "UNKNOWN", err.Error())
+		return false
+	}
+
+	if digest != "" && fmt.Sprintf("sha256:%x", sha256.Sum256(bts)) != digest {
+		writeError(w, http.StatusBadGateway, "DIGEST_INVALID", fmt.Sprintf("upstream sent a blob which doesn't match %s", digest))
+		return false
+	}
+
+	if err := writeFile(p, bts); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return false
+	}
+
+	return true
+}
+
+// serveUpload handles blob uploads: a POST starts one, or mounts a blob the registry already has, PATCHes
+// write parts of it and a PUT with the digest finishes it
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, name, id string) {
+	if !validName(name) {
+		writeError(w, http.StatusBadRequest, "NAME_INVALID", fmt.Sprintf("invalid name %s", name))
+		return
+	}
+
+	uploads := filepath.Join(r.dir, "uploads")
+	if err := os.MkdirAll(uploads, 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	if id == "" {
+		if req.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", req.Method)
+			return
+		}
+
+		if mount := req.URL.Query().Get("mount"); mount != "" {
+			if p, err := r.blobPath(mount); err == nil {
+				if _, err := os.Stat(p); err == nil {
+					w.Header().Set("Docker-Content-Digest", mount)
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+			}
+		}
+
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+
+		id = hex.EncodeToString(b[:])
+		if err := os.WriteFile(filepath.Join(uploads, id), nil, 0o644); err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+
+		w.Header().Set("Location", uploadURL(req, name, id))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if _, err := hex.DecodeString(id); err != nil {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "unknown upload")
+		return
+	}
+
+	p := filepath.Join(uploads, id)
+	f, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "unknown upload")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	defer f.Close()
+
+	switch req.Method {
+	case http.MethodPatch, http.MethodPut:
+		var offset int64
+		if start, _, ok := strings.Cut(req.Header.Get("Content-Range"), "-"); ok {
+			if offset, err = strconv.ParseInt(start, 10, 64); err != nil {
+				writeError(w, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", err.Error())
+				return
+			}
+		} else if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+
+		if _, err := io.Copy(io.NewOffsetWriter(f, offset), req.Body); err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", req.Method)
+		return
+	}
+
+	if req.Method == http.MethodPatch {
+		w.Header().Set("Location", uploadURL(req, name, id))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	digest := req.URL.Query().Get("digest")
+	bp, err := r.blobPath(digest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return
+	}
+
+	if err := f.Close(); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	if sum, err := fileDigest(p); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	} else if sum != digest {
+		os.Remove(p)
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("upload doesn't match %s", digest))
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(bp), 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	if err := os.Rename(p, bp); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// uploadURL is the absolute url of an upload, ollama requests the Location it's given as it is
+func uploadURL(req *http.Request, name, id string) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s/blobs/uploads/%s", scheme, req.Host, name, id)
+}
+
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// writeFile writes a manifest or blob so that it is either whole or missing
+func writeFile(p string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,303 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bpe tokenizes like GPT-2's byte-level BPE, used by models such as llama 3: text is split into words by a
+// pre-tokenizer, the bytes of each word are written as printable runes and then pairs of pieces are merged
+// in the order of the vocabulary's merges until none can be merged.
+type bpe struct {
+	vocab *Vocabulary
+	split func(string) []string
+	ranks map[[2]string]int
+}
+
+func newBPE(v *Vocabulary, split func(string) []string) *bpe {
+	ranks := make(map[[2]string]int, len(v.Merges))
+	for i, merge := range v.Merges {
+		left, right, ok := strings.Cut(merge, " ")
+		if !ok {
+			continue
+		}
+
+		if _, ok := ranks[[2]string{left, right}]; !ok {
+			ranks[[2]string{left, right}] = i
+		}
+	}
+
+	return &bpe{vocab: v, split: split, ranks: ranks}
+}
+
+func (t *bpe) Vocabulary() *Vocabulary {
+	return t.vocab
+}
+
+func (t *bpe) Encode(s string, addSpecial, parseSpecial bool) []int {
+	var ids []int
+	if addSpecial && t.vocab.AddBOS && t.vocab.BOS >= 0 {
+		ids = append(ids, t.vocab.BOS)
+	}
+
+	for _, f := range t.vocab.split(s, parseSpecial) {
+		if f.id >= 0 {
+			ids = append(ids, f.id)
+			continue
+		}
+
+		for _, word := range t.split(f.text) {
+			ids = t.encode(word, ids)
+		}
+	}
+
+	if addSpecial && t.vocab.AddEOS && t.vocab.EOS >= 0 {
+		ids = append(ids, t.vocab.EOS)
+	}
+
+	return ids
+}
+
+// encode appends the tokens of word to ids
+func (t *bpe) encode(word string, ids []int) []int {
+	var symbols []string
+	for _, b := range []byte(word) {
+		symbols = append(symbols, string(byteRunes[b]))
+	}
+
+	for len(symbols) > 1 {
+		// merge the pair with the lowest rank, the leftmost of any with the same rank
+		best, rank := -1, 0
+		for i := 0; i+1 < len(symbols); i++ {
+			if r, ok := t.ranks[[2]string{symbols[i], symbols[i+1]}]; ok && (best < 0 || r < rank) {
+				best, rank = i, r
+			}
+		}
+
+		if best < 0 {
+			break
+		}
+
+		symbols[best] += symbols[best+1]
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+
+	for _, symbol := range symbols {
+		if id, ok := t.vocab.ID(symbol); ok {
+			ids = append(ids, id)
+			continue
+		}
+
+		for _, r := range symbol {
+			if id, ok := t.vocab.ID(string(r)); ok {
+				ids = append(ids, id)
+			} else if t.vocab.UNK >= 0 {
+				ids = append(ids, t.vocab.UNK)
+			}
+		}
+	}
+
+	return ids
+}
+
+func (t *bpe) Decode(ids []int, renderSpecial bool) string {
+	var sb strings.Builder
+	for _, id := range ids {
+		if id < 0 || id >= len(t.vocab.Tokens) {
+			continue
+		}
+
+		token := t.vocab.Tokens[id]
+		switch t.vocab.Type(id) {
+		case TypeControl:
+			if renderSpecial {
+				sb.WriteString(token)
+			}
+		case TypeUserDefined:
+			sb.WriteString(token)
+		default:
+			for _, r := range token {
+				if b, ok := runeBytes[r]; ok {
+					sb.WriteByte(b)
+				} else {
+					sb.WriteRune(r)
+				}
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// byteRunes are the printable runes GPT-2 writes bytes as, and runeBytes the bytes they are written for.
+// Printable bytes are written as themselves, the others as runes from U+0100.
+var byteRunes, runeBytes = func() ([256]rune, map[rune]byte) {
+	var runes [256]rune
+	bytes := make(map[rune]byte, 256)
+
+	n := 0
+	for b := 0; b < 256; b++ {
+		r := rune(b)
+		if !(b >= '!' && b <= '~' || b >= 0xa1 && b <= 0xac || b >= 0xae && b <= 0xff) {
+			r = rune(256 + n)
+			n++
+		}
+
+		runes[b] = r
+		bytes[r] = byte(b)
+	}
+
+	return runes, bytes
+}()
+
+// preTokenizer returns the pre-tokenizer named in tokenizer.ggml.pre. The pre-tokenizers match the regular
+// expressions of their models, which use lookaheads Go's regexp doesn't support, so they are written by hand.
+func preTokenizer(pre string) (func(string) []string, error) {
+	switch pre {
+	case "", "default", "gpt2", "gpt-2":
+		return splitWith(gpt2Word), nil
+	case "llama-bpe", "llama3", "cl100k", "tiktoken":
+		return splitWith(cl100kWord), nil
+	default:
+		return nil, fmt.Errorf("unsupported pre-tokenizer '%s'", pre)
+	}
+}
+
+// splitWith splits text into the words matched by word, which returns the length of the word at the start of
+// the text it is given
+func splitWith(word func(string) int) func(string) []string {
+	return func(s string) []string {
+		var words []string
+		for s != "" {
+			n := word(s)
+			if n <= 0 {
+				_, n = utf8.DecodeRuneInString(s)
+			}
+
+			words = append(words, s[:n])
+			s = s[n:]
+		}
+
+		return words
+	}
+}
+
+// gpt2Word matches 's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+
+func gpt2Word(s string) int {
+	if n := contraction(s, false); n > 0 {
+		return n
+	}
+
+	space := 0
+	if strings.HasPrefix(s, " ") {
+		space = 1
+	}
+
+	for _, class := range []func(rune) bool{unicode.IsLetter, unicode.IsNumber, isOther} {
+		if n := runLength(s[space:], class); n > 0 {
+			return space + n
+		}
+	}
+
+	return spaces(s)
+}
+
+// cl100kWord matches (?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|
+// \s*[\r\n]+|\s+(?!\S)|\s+
+func cl100kWord(s string) int {
+	if n := contraction(s, true); n > 0 {
+		return n
+	}
+
+	r, size := utf8.DecodeRuneInString(s)
+	if r != '\r' && r != '\n' && !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		if n := runLength(s[size:], unicode.IsLetter); n > 0 {
+			return size + n
+		}
+	}
+
+	if n := runLength(s, unicode.IsLetter); n > 0 {
+		return n
+	}
+
+	// numbers are split into at most three digits
+	if digits := 0; unicode.IsNumber(r) {
+		for i, r := range s {
+			if digits == 3 || !unicode.IsNumber(r) {
+				return i
+			}
+
+			digits++
+		}
+
+		return len(s)
+	}
+
+	space := 0
+	if strings.HasPrefix(s, " ") {
+		space = 1
+	}
+
+	if n := runLength(s[space:], isOther); n > 0 {
+		n += space
+		return n + runLength(s[n:], func(r rune) bool { return r == '\r' || r == '\n' })
+	}
+
+	// \s*[\r\n]+ ends after the last newline in the whitespace
+	run := runLength(s, unicode.IsSpace)
+	if i := strings.LastIndexAny(s[:run], "\r\n"); i >= 0 {
+		return i + 1
+	}
+
+	return spaces(s)
+}
+
+// contraction matches 's|'t|'re|'ve|'m|'ll|'d, ignoring case if fold is set
+func contraction(s string, fold bool) int {
+	if !strings.HasPrefix(s, "'") {
+		return 0
+	}
+
+	for _, suffix := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+		if len(s) > len(suffix) {
+			if next := s[1 : 1+len(suffix)]; next == suffix || fold && strings.EqualFold(next, suffix) {
+				return 1 + len(suffix)
+			}
+		}
+	}
+
+	return 0
+}
+
+// spaces matches \s+(?!\S)|\s+: a run of whitespace, except the last space before other text
+func spaces(s string) int {
+	n := runLength(s, unicode.IsSpace)
+	if n == 0 || n == len(s) {
+		return n
+	}
+
+	_, size := utf8.DecodeLastRuneInString(s[:n])
+	if n > size {
+		return n - size
+	}
+
+	return n
+}
+
+// runLength is the length of the runes at the start of s in class
+func runLength(s string, class func(rune) bool) int {
+	for i, r := range s {
+		if !class(r) {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// isOther matches [^\s\p{L}\p{N}]
+func isOther(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
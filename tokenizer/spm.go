@@ -0,0 +1,186 @@
+package tokenizer
+
+import (
+	"container/heap"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sentencePiece tokenizes like SentencePiece's BPE models, such as llama's: spaces become ▁, text starts with
+// one, and pairs of pieces are merged into the highest scoring token they make until none can be merged.
+// Characters which aren't tokens are written as their bytes, <0x..>.
+type sentencePiece struct {
+	vocab *Vocabulary
+}
+
+func newSentencePiece(v *Vocabulary) *sentencePiece {
+	return &sentencePiece{vocab: v}
+}
+
+func (t *sentencePiece) Vocabulary() *Vocabulary {
+	return t.vocab
+}
+
+func (t *sentencePiece) Encode(s string, addSpecial, parseSpecial bool) []int {
+	var ids []int
+	if addSpecial && t.vocab.AddBOS && t.vocab.BOS >= 0 {
+		ids = append(ids, t.vocab.BOS)
+	}
+
+	// like llama.cpp, the text at the start and after each special token starts with a space
+	prevSpecial := true
+	for _, f := range t.vocab.split(s, parseSpecial) {
+		if f.id >= 0 {
+			ids = append(ids, f.id)
+			prevSpecial = true
+			continue
+		}
+
+		text := f.text
+		if prevSpecial {
+			text = " " + text
+		}
+
+		ids = t.encode(strings.ReplaceAll(text, " ", "▁"), ids)
+		prevSpecial = false
+	}
+
+	if addSpecial && t.vocab.AddEOS && t.vocab.EOS >= 0 {
+		ids = append(ids, t.vocab.EOS)
+	}
+
+	return ids
+}
+
+type spmSymbol struct {
+	text       string
+	prev, next int
+}
+
+type spmBigram struct {
+	left, right int
+	score       float32
+	size        int
+}
+
+// spmQueue pops the highest scoring bigram, the leftmost of any with the same score
+type spmQueue []spmBigram
+
+func (q spmQueue) Len() int { return len(q) }
+
+func (q spmQueue) Less(i, j int) bool {
+	return q[i].score > q[j].score || (q[i].score == q[j].score && q[i].left < q[j].left)
+}
+
+func (q spmQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *spmQueue) Push(x any) { *q = append(*q, x.(spmBigram)) }
+
+func (q *spmQueue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// encode appends the tokens of text, with its spaces already replaced with ▁, to ids
+func (t *sentencePiece) encode(text string, ids []int) []int {
+	var symbols []spmSymbol
+	for i := 0; i < len(text); {
+		_, n := utf8.DecodeRuneInString(text[i:])
+		symbols = append(symbols, spmSymbol{text: text[i : i+n], prev: len(symbols) - 1, next: len(symbols) + 1})
+		i += n
+	}
+
+	if len(symbols) == 0 {
+		return ids
+	}
+
+	symbols[len(symbols)-1].next = -1
+
+	var queue spmQueue
+	addBigram := func(left, right int) {
+		if left < 0 || right < 0 {
+			return
+		}
+
+		merged := symbols[left].text + symbols[right].text
+		if id, ok := t.vocab.ID(merged); ok {
+			heap.Push(&queue, spmBigram{left: left, right: right, score: t.vocab.Scores[id], size: len(merged)})
+		}
+	}
+
+	for i := 1; i < len(symbols); i++ {
+		addBigram(i-1, i)
+	}
+
+	for queue.Len() > 0 {
+		bigram := heap.Pop(&queue).(spmBigram)
+		left, right := &symbols[bigram.left], &symbols[bigram.right]
+
+		// skip bigrams of symbols which have since been merged into others
+		if left.text == "" || right.text == "" || len(left.text)+len(right.text) != bigram.size {
+			continue
+		}
+
+		left.text += right.text
+		right.text = ""
+		left.next = right.next
+		if right.next >= 0 {
+			symbols[right.next].prev = bigram.left
+		}
+
+		addBigram(left.prev, bigram.left)
+		addBigram(bigram.left, left.next)
+	}
+
+	for i := 0; i >= 0; i = symbols[i].next {
+		if id, ok := t.vocab.ID(symbols[i].text); ok {
+			ids = append(ids, id)
+			continue
+		}
+
+		// a character which isn't a token is written as its bytes
+		for _, b := range []byte(symbols[i].text) {
+			if id, ok := t.vocab.ID(fmt.Sprintf("<0x%02X>", b)); ok {
+				ids = append(ids, id)
+			} else if t.vocab.UNK >= 0 {
+				ids = append(ids, t.vocab.UNK)
+			}
+		}
+	}
+
+	return ids
+}
+
+func (t *sentencePiece) Decode(ids []int, renderSpecial bool) string {
+	var sb strings.Builder
+	for _, id := range ids {
+		if id < 0 || id >= len(t.vocab.Tokens) {
+			continue
+		}
+
+		token := t.vocab.Tokens[id]
+		switch t.vocab.Type(id) {
+		case TypeByte:
+			if b, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(token, "<0x"), ">"), 16, 8); err == nil {
+				sb.WriteByte(byte(b))
+			}
+		case TypeControl:
+			if renderSpecial {
+				sb.WriteString(token)
+			}
+		case TypeUnknown:
+			// llama.cpp writes unknown tokens as ▅
+			sb.WriteString("▅")
+		case TypeUserDefined:
+			sb.WriteString(token)
+		default:
+			sb.WriteString(strings.ReplaceAll(token, "▁", " "))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,170 @@
+// Package tokenizer converts between text and the tokens of a model, from the vocabulary in its metadata. It
+// follows llama.cpp, which runs the models, so text is tokenized the same way whether it is sent to a runner
+// or not.
+package tokenizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tokenizer converts between text and tokens
+type Tokenizer interface {
+	// Encode tokenizes s. addSpecial adds the tokens the model expects around a prompt, such as BOS.
+	// parseSpecial tokenizes the text of control tokens in s, such as <|im_start|>, as those tokens, otherwise
+	// it is tokenized like any other text.
+	Encode(s string, addSpecial, parseSpecial bool) []int
+
+	// Decode is the text of tokens. renderSpecial writes the text of control tokens, which are otherwise left
+	// out.
+	Decode(ids []int, renderSpecial bool) string
+
+	Vocabulary() *Vocabulary
+}
+
+// TokenType is the type of a token in a vocabulary, as numbered in gguf files
+type TokenType int32
+
+const (
+	TypeNormal      TokenType = 1
+	TypeUnknown     TokenType = 2
+	TypeControl     TokenType = 3
+	TypeUserDefined TokenType = 4
+	TypeUnused      TokenType = 5
+	TypeByte        TokenType = 6
+)
+
+// Vocabulary is the tokens of a model and how they are put together
+type Vocabulary struct {
+	Tokens []string
+	// Types are the types of Tokens, tokens are TypeNormal if it is empty
+	Types []TokenType
+	// Scores rank the tokens of a SentencePiece vocabulary, higher tokens are merged first
+	Scores []float32
+	// Merges rank the pairs of tokens merged by BPE, such as "Ġ t", earlier pairs are merged first
+	Merges []string
+
+	// BOS, EOS and UNK are the ids of the special tokens, or -1 if there are none
+	BOS, EOS, UNK int
+
+	// AddBOS and AddEOS are whether prompts start with BOS and end with EOS
+	AddBOS, AddEOS bool
+
+	ids map[string]int
+	// special are the control and user-defined tokens, longest first
+	special []int
+}
+
+// New returns the tokenizer for vocabularies of the type in gguf's tokenizer.ggml.model, "llama" for
+// SentencePiece and "gpt2" for byte-level BPE. pre is the pre-tokenizer of a BPE vocabulary, in
+// tokenizer.ggml.pre, which splits text into the words tokens are merged within.
+func New(model, pre string, v *Vocabulary) (Tokenizer, error) {
+	if len(v.Types) > 0 && len(v.Types) != len(v.Tokens) {
+		return nil, fmt.Errorf("vocabulary has %d tokens but %d types", len(v.Tokens), len(v.Types))
+	}
+
+	v.ids = make(map[string]int, len(v.Tokens))
+	v.special = nil
+	for id, token := range v.Tokens {
+		// the first of any duplicate tokens wins, like llama.cpp
+		if _, ok := v.ids[token]; !ok {
+			v.ids[token] = id
+		}
+
+		if t := v.Type(id); (t == TypeControl || t == TypeUserDefined) && token != "" {
+			v.special = append(v.special, id)
+		}
+	}
+
+	sort.SliceStable(v.special, func(i, j int) bool {
+		return len(v.Tokens[v.special[i]]) > len(v.Tokens[v.special[j]])
+	})
+
+	switch model {
+	case "llama":
+		if len(v.Scores) != len(v.Tokens) {
+			return nil, fmt.Errorf("vocabulary has %d tokens but %d scores", len(v.Tokens), len(v.Scores))
+		}
+
+		return newSentencePiece(v), nil
+	case "gpt2":
+		split, err := preTokenizer(pre)
+		if err != nil {
+			return nil, err
+		}
+
+		return newBPE(v, split), nil
+	default:
+		return nil, fmt.Errorf("unsupported tokenizer '%s'", model)
+	}
+}
+
+// ID returns the id of token and whether it is in the vocabulary
+func (v *Vocabulary) ID(token string) (int, bool) {
+	id, ok := v.ids[token]
+	return id, ok
+}
+
+// Type returns the type of the token id
+func (v *Vocabulary) Type(id int) TokenType {
+	if id < len(v.Types) {
+		return v.Types[id]
+	}
+
+	return TypeNormal
+}
+
+// fragment is a piece of text to tokenize, or a special token matched in it if id isn't -1
+type fragment struct {
+	text string
+	id   int
+}
+
+// split finds the special tokens in s. User-defined tokens are always matched, control tokens only when
+// parseSpecial is set. Longer tokens are matched before shorter ones.
+func (v *Vocabulary) split(s string, parseSpecial bool) []fragment {
+	if s == "" {
+		return nil
+	}
+
+	fragments := []fragment{{text: s, id: -1}}
+	for _, id := range v.special {
+		if v.Type(id) == TypeControl && !parseSpecial {
+			continue
+		}
+
+		token := v.Tokens[id]
+
+		var next []fragment
+		for _, f := range fragments {
+			if f.id != -1 {
+				next = append(next, f)
+				continue
+			}
+
+			text := f.text
+			for {
+				i := strings.Index(text, token)
+				if i < 0 {
+					break
+				}
+
+				if i > 0 {
+					next = append(next, fragment{text: text[:i], id: -1})
+				}
+
+				next = append(next, fragment{text: token, id: id})
+				text = text[i+len(token):]
+			}
+
+			if text != "" {
+				next = append(next, fragment{text: text, id: -1})
+			}
+		}
+
+		fragments = next
+	}
+
+	return fragments
+}
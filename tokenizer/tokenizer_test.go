@@ -0,0 +1,149 @@
+package tokenizer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreTokenizers(t *testing.T) {
+	cases := []struct {
+		pre   string
+		text  string
+		words []string
+	}{
+		{"gpt2", "Hello world", []string{"Hello", " world"}},
+		{"gpt2", "I'm here", []string{"I", "'m", " here"}},
+		{"gpt2", "a  b", []string{"a", " ", " b"}},
+		{"gpt2", "\n\nfoo", []string{"\n", "\n", "foo"}},
+		{"gpt2", "x = 42!", []string{"x", " =", " 42", "!"}},
+		{"gpt2", "end  ", []string{"end", "  "}},
+		{"llama-bpe", "12345", []string{"123", "45"}},
+		{"llama-bpe", "hello\n\nworld", []string{"hello", "\n\n", "world"}},
+		{"llama-bpe", "  world", []string{" ", " world"}},
+		{"llama-bpe", "foo.bar", []string{"foo", ".bar"}},
+		{"llama-bpe", "I'M ok", []string{"I", "'M", " ok"}},
+		{"llama-bpe", "ok!\n\n", []string{"ok", "!\n\n"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("%s %q", tt.pre, tt.text), func(t *testing.T) {
+			split, err := preTokenizer(tt.pre)
+			require.NoError(t, err)
+			assert.Equal(t, tt.words, split(tt.text))
+		})
+	}
+
+	_, err := preTokenizer("unknown")
+	assert.Error(t, err)
+}
+
+func sentencePieceVocabulary() *Vocabulary {
+	v := &Vocabulary{
+		Tokens: []string{"<unk>", "<s>", "</s>", "<|im_start|>"},
+		Types:  []TokenType{TypeUnknown, TypeControl, TypeControl, TypeControl},
+		Scores: []float32{0, 0, 0, 0},
+		BOS:    1,
+		EOS:    2,
+		UNK:    0,
+		AddBOS: true,
+	}
+
+	for b := 0; b < 256; b++ {
+		v.Tokens = append(v.Tokens, fmt.Sprintf("<0x%02X>", b))
+		v.Types = append(v.Types, TypeByte)
+		v.Scores = append(v.Scores, 0)
+	}
+
+	for i, token := range []string{"▁", "h", "e", "l", "o", "▁h", "ll", "▁he", "llo", "▁hello"} {
+		v.Tokens = append(v.Tokens, token)
+		v.Types = append(v.Types, TypeNormal)
+		v.Scores = append(v.Scores, -float32(i))
+	}
+
+	return v
+}
+
+func TestSentencePiece(t *testing.T) {
+	tok, err := New("llama", "", sentencePieceVocabulary())
+	require.NoError(t, err)
+
+	v := tok.Vocabulary()
+	id := func(token string) int {
+		id, ok := v.ID(token)
+		require.True(t, ok, token)
+		return id
+	}
+
+	assert.Equal(t, []int{id("▁hello")}, tok.Encode("hello", false, false))
+	assert.Equal(t, []int{v.BOS, id("▁hello")}, tok.Encode("hello", true, false))
+	assert.Equal(t, []int{v.BOS}, tok.Encode("", true, false))
+
+	// 🦙 isn't a token, so it is written as its bytes
+	emoji := tok.Encode("hello🦙", false, false)
+	assert.Equal(t, []int{id("▁hello"), id("<0xF0>"), id("<0x9F>"), id("<0xA6>"), id("<0x99>")}, emoji)
+	assert.Equal(t, " hello🦙", tok.Decode(emoji, false))
+
+	// control tokens are only parsed and rendered when asked
+	special := tok.Encode("<|im_start|>hello", false, true)
+	assert.Equal(t, []int{id("<|im_start|>"), id("▁hello")}, special)
+	assert.Equal(t, "<|im_start|> hello", tok.Decode(special, true))
+	assert.Equal(t, " hello", tok.Decode(special, false))
+	assert.NotContains(t, tok.Encode("<|im_start|>hello", false, false), id("<|im_start|>"))
+}
+
+func TestBPE(t *testing.T) {
+	v := &Vocabulary{
+		Tokens: []string{"<|endoftext|>"},
+		Types:  []TokenType{TypeControl},
+		Merges: []string{"h e", "l l", "o Ġ", "Ġ w", "he ll", "hell o", "Ġw o", "r l", "rl d", "Ġwo rld", "Ã ©"},
+		BOS:    0,
+		EOS:    0,
+		UNK:    -1,
+	}
+
+	for _, r := range byteRunes {
+		v.Tokens = append(v.Tokens, string(r))
+		v.Types = append(v.Types, TypeNormal)
+	}
+
+	for _, token := range []string{"he", "ll", "Ġw", "hell", "hello", "Ġwo", "rl", "rld", "Ġworld", "Ã©"} {
+		v.Tokens = append(v.Tokens, token)
+		v.Types = append(v.Types, TypeNormal)
+	}
+
+	tok, err := New("gpt2", "gpt2", v)
+	require.NoError(t, err)
+
+	id := func(token string) int {
+		id, ok := v.ID(token)
+		require.True(t, ok, token)
+		return id
+	}
+
+	for _, s := range []string{"hello world", "é", "hello<|endoftext|>"} {
+		ids := tok.Encode(s, false, false)
+		assert.Equal(t, s, tok.Decode(ids, false), s)
+	}
+
+	assert.Equal(t, []int{id("hello"), id("Ġworld")}, tok.Encode("hello world", false, false))
+	assert.Equal(t, []int{id("Ã©")}, tok.Encode("é", false, false))
+
+	special := tok.Encode("hello<|endoftext|>", false, true)
+	assert.Equal(t, []int{id("hello"), 0}, special)
+	assert.Equal(t, "hello", tok.Decode(special, false))
+	assert.Equal(t, "hello<|endoftext|>", tok.Decode(special, true))
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New("bert", "", &Vocabulary{})
+	assert.Error(t, err)
+
+	_, err = New("llama", "", &Vocabulary{Tokens: []string{"a"}})
+	assert.Error(t, err)
+
+	_, err = New("gpt2", "unknown", &Vocabulary{})
+	assert.Error(t, err)
+}
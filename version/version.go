@@ -1,3 +1,33 @@
 package version
 
+import "runtime/debug"
+
 var Version string = "0.0.0"
+
+// Commit, BuildDate and LlamaCppCommit are set at build time with -ldflags "-X ...". When they aren't, Commit
+// and BuildDate fall back to the commit and its time recorded by the go toolchain in a git checkout.
+var (
+	Commit         string
+	BuildDate      string
+	LlamaCppCommit string
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if Commit == "" {
+				Commit = setting.Value
+			}
+		case "vcs.time":
+			if BuildDate == "" {
+				BuildDate = setting.Value
+			}
+		}
+	}
+}